@@ -42,11 +42,11 @@ func New(client *dcrd.Dcrd, webServer *web.Server, xcBot *exchanges.ExchangeBot)
 		return nil, errors.New("Attack cost requires exchange bot, set 'exchange-monitor=1' to enable it.")
 	}
 
-	hash, err := client.Rpc.GetBestBlockHash()
+	hash, err := client.Rpc().GetBestBlockHash()
 	if err != nil {
 		return nil, err
 	}
-	blockHeader, err := client.Rpc.GetBlockHeader(hash)
+	blockHeader, err := client.Rpc().GetBlockHeader(hash)
 	if err != nil {
 		return nil, err
 	}
@@ -70,6 +70,7 @@ func New(client *dcrd.Dcrd, webServer *web.Server, xcBot *exchanges.ExchangeBot)
 	}
 
 	ac.client.Notif.RegisterBlockHandlerGroup(ac.ConnectBlock)
+	ac.client.Notif.RegisterReorgHandlerGroup(ac.Reorg)
 
 	ac.server.AddRoute("/attackcost", web.GET, ac.attackCost)
 	ac.server.AddRoute("/api/chart/market/{token}/depth", web.GET, ac.getMarketDepthChart, exchangeTokenContext)
@@ -84,7 +85,7 @@ func (ac *Attackcost) ConnectBlock(w *wire.BlockHeader) error {
 	hash := w.BlockHash()
 
 	// Hashrate
-	header, err := ac.client.Rpc.GetBlockHeaderVerbose(&hash)
+	header, err := ac.client.Rpc().GetBlockHeaderVerbose(&hash)
 	if err != nil {
 		return err
 	}
@@ -92,26 +93,26 @@ func (ac *Attackcost) ConnectBlock(w *wire.BlockHeader) error {
 	ac.hashrate = dcrd.CalculateHashRate(header.Difficulty, targetTimePerBlock)
 
 	// Coin supply
-	coinSupply, err := ac.client.Rpc.GetCoinSupply()
+	coinSupply, err := ac.client.Rpc().GetCoinSupply()
 	if err != nil {
 		return err
 	}
 	ac.coinSupply = int64(coinSupply)
 
 	// Stake difficulty (ticket price)
-	stakeDiff, err := ac.client.Rpc.GetStakeDifficulty()
+	stakeDiff, err := ac.client.Rpc().GetStakeDifficulty()
 	if err != nil {
 		return err
 	}
 	ac.ticketPrice = stakeDiff.CurrentStakeDifficulty
 
 	// Ticket pool info
-	poolValue, err := ac.client.Rpc.GetTicketPoolValue()
+	poolValue, err := ac.client.Rpc().GetTicketPoolValue()
 	if err != nil {
 		return err
 	}
 	ac.ticketPoolValue = poolValue.ToCoin()
-	hashes, err := ac.client.Rpc.LiveTickets()
+	hashes, err := ac.client.Rpc().LiveTickets()
 	if err != nil {
 		return err
 	}
@@ -120,6 +121,15 @@ func (ac *Attackcost) ConnectBlock(w *wire.BlockHeader) error {
 	return nil
 }
 
+// Reorg recomputes the attack cost inputs at the common ancestor of a reorg.
+func (ac *Attackcost) Reorg(reorg *dcrd.ReorgData) error {
+	blockHeader, err := ac.client.Rpc().GetBlockHeader(&reorg.CommonAncestor)
+	if err != nil {
+		return err
+	}
+	return ac.ConnectBlock(blockHeader)
+}
+
 // attackCost is the page handler for the "/attack-cost" path.
 func (ac *Attackcost) attackCost(w http.ResponseWriter, r *http.Request) {
 	price := 24.42
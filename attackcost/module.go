@@ -0,0 +1,54 @@
+package attackcost
+
+import (
+	"context"
+
+	"github.com/decred/dcrdata/exchanges/v2"
+	"github.com/decred/slog"
+	"github.com/planetdecred/pdanalytics/dcrd"
+	"github.com/planetdecred/pdanalytics/module"
+	"github.com/planetdecred/pdanalytics/web"
+)
+
+// AttackCostOptions are the config options of the attack cost calculator
+// module.
+type AttackCostOptions struct {
+	EnableAttackCost bool `long:"attack-cost" description:"Enable/Disables the attack cost calculator component."`
+}
+
+type attackCostModule struct {
+	options AttackCostOptions
+	client  *dcrd.Dcrd
+	server  *web.Server
+	xcBot   *exchanges.ExchangeBot
+}
+
+func init() {
+	module.Register(&attackCostModule{
+		options: AttackCostOptions{
+			EnableAttackCost: true,
+		},
+	})
+}
+
+func (m *attackCostModule) Name() string                 { return "attackcost" }
+func (m *attackCostModule) LogSubsystem() string         { return "ATCK" }
+func (m *attackCostModule) UseLogger(logger slog.Logger) { UseLogger(logger) }
+func (m *attackCostModule) Options() interface{}         { return &m.options }
+func (m *attackCostModule) Enabled() bool                { return m.options.EnableAttackCost }
+
+func (m *attackCostModule) Init(deps *module.Deps) error {
+	m.client = deps.Dcrd
+	m.server = deps.Server
+	m.xcBot = deps.XcBot
+	return nil
+}
+
+func (m *attackCostModule) Start(ctx context.Context) error {
+	_, err := New(m.client, m.server, m.xcBot)
+	return err
+}
+
+func (m *attackCostModule) Stop() error { return nil }
+
+func (m *attackCostModule) Health() module.Health { return module.Healthy }
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/planetdecred/pdanalytics/backup"
+	"github.com/planetdecred/pdanalytics/postgres"
+	"github.com/planetdecred/pdanalytics/version"
+)
+
+// backupCommand holds the options of the backup command.
+type backupCommand struct {
+	Output  string `short:"o" long:"output" description:"File to write the archive to, the standard output when not set"`
+	Modules string `long:"modules" description:"Comma separated list of the modules to back up (e.g. --modules=mempool,pow), all when not set"`
+}
+
+// restoreCommand holds the options of the restore command.
+type restoreCommand struct {
+	Modules string `long:"modules" description:"Comma separated list of the modules to restore (e.g. --modules=mempool,pow), all those of the archive when not set"`
+
+	Args struct {
+		File string `positional-arg-name:"file" description:"Archive written by the backup command, - for the standard input"`
+	} `positional-args:"yes" required:"yes"`
+}
+
+// splitModules returns the module names of a comma separated list.
+func splitModules(list string) []string {
+	var modules []string
+	for _, name := range strings.Split(list, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			modules = append(modules, name)
+		}
+	}
+	return modules
+}
+
+// runBackup writes the tables of the modules of the backup command to an
+// archive.
+func runBackup(ctx context.Context, cfg *config) error {
+	if cfg.DBBackend != "postgres" {
+		return fmt.Errorf("the backup command requires the postgres backend")
+	}
+	opts := cfg.Backup
+	modules := splitModules(opts.Modules)
+	if _, err := postgres.ModuleTables(modules...); err != nil {
+		return err
+	}
+
+	var out io.Writer = os.Stdout
+	if opts.Output != "" {
+		f, err := os.Create(opts.Output)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		out = f
+	} else {
+		// The logs would mix with the archive.
+		logOutput = os.Stderr
+	}
+
+	// The backup is read from the primary, a replica may lag behind.
+	db, err := postgres.NewPgDb(cfg.dbConnOptions(), cfg.DebugLevel == "debug")
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	manifest := &backup.Manifest{
+		AppVersion: version.Version(),
+		Network:    activeChain.Name,
+		Created:    time.Now().UTC(),
+	}
+	if err = db.Backup(ctx, out, manifest, modules...); err != nil {
+		return fmt.Errorf("failed to back up the database: %v", err)
+	}
+	for _, module := range manifest.Modules {
+		log.Infof("Backed up the %d tables of the %s module", len(module.Tables), module.Name)
+	}
+	return nil
+}
+
+// runRestore copies the tables of the archive of the restore command into the
+// empty tables of the database.
+func runRestore(ctx context.Context, cfg *config) error {
+	if cfg.DBBackend != "postgres" {
+		return fmt.Errorf("the restore command requires the postgres backend")
+	}
+	opts := cfg.Restore
+
+	var in io.Reader = os.Stdin
+	if opts.Args.File != "-" {
+		f, err := os.Open(opts.Args.File)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		in = f
+	}
+	r, err := backup.NewReader(in)
+	if err != nil {
+		return err
+	}
+	manifest := r.Manifest()
+	if manifest.Network != activeChain.Name {
+		return fmt.Errorf("the backup is of the %s network, pdanalytics runs on %s",
+			manifest.Network, activeChain.Name)
+	}
+	log.Infof("Restoring the backup of %s made by pdanalytics %s", manifest.Created.Format(time.RFC3339),
+		manifest.AppVersion)
+
+	db, err := postgres.NewPgDb(cfg.dbConnOptions(), cfg.DebugLevel == "debug")
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	if err = setupTables(ctx, db); err != nil {
+		return err
+	}
+	if err = db.Restore(ctx, r, splitModules(opts.Modules)...); err != nil {
+		return fmt.Errorf("failed to restore the backup: %v", err)
+	}
+	log.Info("The backup is restored")
+	return nil
+}
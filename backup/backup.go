@@ -0,0 +1,186 @@
+// Package backup reads and writes the pdanalytics backup archives. An archive
+// is a gzip compressed stream of JSON lines: the manifest first, then for
+// every table a header object followed by its rows, each an array of the text
+// representations of the column values, null for NULL.
+package backup
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+)
+
+// FormatVersion is the version of the archive format written.
+const FormatVersion = 1
+
+// Manifest describes the content of an archive.
+type Manifest struct {
+	FormatVersion int       `json:"format_version"`
+	AppVersion    string    `json:"app_version"`
+	Network       string    `json:"network"`
+	Created       time.Time `json:"created"`
+	Modules       []Module  `json:"modules"`
+}
+
+// Module holds the tables of a module and their schema version.
+type Module struct {
+	Name          string  `json:"name"`
+	SchemaVersion int     `json:"schema_version"`
+	Tables        []Table `json:"tables"`
+}
+
+// Table describes a table of an archive.
+type Table struct {
+	Name    string   `json:"name"`
+	Columns []string `json:"columns"`
+	Rows    int64    `json:"rows"`
+	// From and To are the time range of the rows, for the tables with a
+	// time column and rows.
+	From *time.Time `json:"from,omitempty"`
+	To   *time.Time `json:"to,omitempty"`
+}
+
+// Module returns the module of the named table.
+func (m *Manifest) Module(table string) (Module, bool) {
+	for _, module := range m.Modules {
+		for _, t := range module.Tables {
+			if t.Name == table {
+				return module, true
+			}
+		}
+	}
+	return Module{}, false
+}
+
+// header is the line starting the rows of a table.
+type header struct {
+	Table string `json:"table"`
+}
+
+// manifestLine is the first line of an archive.
+type manifestLine struct {
+	Manifest *Manifest `json:"manifest"`
+}
+
+// Writer writes an archive.
+type Writer struct {
+	gz  *gzip.Writer
+	buf *bufio.Writer
+	enc *json.Encoder
+}
+
+// NewWriter starts an archive with the manifest. The tables must be written
+// in the order of the manifest.
+func NewWriter(w io.Writer, m *Manifest) (*Writer, error) {
+	gz := gzip.NewWriter(w)
+	buf := bufio.NewWriter(gz)
+	bw := &Writer{gz: gz, buf: buf, enc: json.NewEncoder(buf)}
+	m.FormatVersion = FormatVersion
+	if err := bw.enc.Encode(manifestLine{m}); err != nil {
+		return nil, err
+	}
+	return bw, nil
+}
+
+// BeginTable starts the rows of the named table.
+func (w *Writer) BeginTable(name string) error {
+	return w.enc.Encode(header{name})
+}
+
+// WriteRow writes a row of the current table.
+func (w *Writer) WriteRow(values []*string) error {
+	return w.enc.Encode(values)
+}
+
+// Close ends the archive, it does not close the underlying writer.
+func (w *Writer) Close() error {
+	if err := w.buf.Flush(); err != nil {
+		return err
+	}
+	return w.gz.Close()
+}
+
+// Reader reads an archive.
+type Reader struct {
+	r        *bufio.Reader
+	manifest *Manifest
+	// next is the table of the header read ahead, when the rows of the
+	// previous table were read up to it.
+	next  string
+	ahead bool
+}
+
+// NewReader reads the manifest of the archive and checks its format version.
+func NewReader(r io.Reader) (*Reader, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("not a pdanalytics backup: %v", err)
+	}
+	br := &Reader{r: bufio.NewReader(gz)}
+	line, err := br.r.ReadBytes('\n')
+	if err != nil {
+		return nil, fmt.Errorf("not a pdanalytics backup: %v", err)
+	}
+	var first manifestLine
+	if err = json.Unmarshal(line, &first); err != nil || first.Manifest == nil {
+		return nil, fmt.Errorf("not a pdanalytics backup, the manifest is missing")
+	}
+	if first.Manifest.FormatVersion > FormatVersion {
+		return nil, fmt.Errorf("the backup format version %d is newer than the supported version %d, "+
+			"upgrade pdanalytics", first.Manifest.FormatVersion, FormatVersion)
+	}
+	br.manifest = first.Manifest
+	return br, nil
+}
+
+// Manifest returns the manifest of the archive.
+func (r *Reader) Manifest() *Manifest {
+	return r.manifest
+}
+
+// NextTable skips the remaining rows of the current table and returns the
+// name of the next one, or io.EOF after the last table.
+func (r *Reader) NextTable() (string, error) {
+	for !r.ahead {
+		_, err := r.ReadRow()
+		if err == io.EOF && !r.ahead {
+			return "", io.EOF
+		}
+		if err != nil && err != io.EOF {
+			return "", err
+		}
+	}
+	r.ahead = false
+	return r.next, nil
+}
+
+// ReadRow returns the next row of the current table, or io.EOF after its
+// last row.
+func (r *Reader) ReadRow() ([]*string, error) {
+	if r.ahead {
+		return nil, io.EOF
+	}
+	line, err := r.r.ReadBytes('\n')
+	if err == io.EOF && len(line) == 0 {
+		return nil, io.EOF
+	}
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	if len(line) > 0 && line[0] == '{' {
+		var h header
+		if err = json.Unmarshal(line, &h); err != nil || h.Table == "" {
+			return nil, fmt.Errorf("invalid table header %q", line)
+		}
+		r.next, r.ahead = h.Table, true
+		return nil, io.EOF
+	}
+	var values []*string
+	if err = json.Unmarshal(line, &values); err != nil {
+		return nil, fmt.Errorf("invalid row: %v", err)
+	}
+	return values, nil
+}
@@ -0,0 +1,66 @@
+package backup
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+func str(s string) *string { return &s }
+
+func TestArchive(t *testing.T) {
+	manifest := &Manifest{
+		Network: "testnet3",
+		Modules: []Module{{Name: "pow", SchemaVersion: 0, Tables: []Table{
+			{Name: "pow_data", Columns: []string{"time", "source"}, Rows: 2},
+			{Name: "pow_bin", Columns: []string{"time"}, Rows: 0},
+		}}},
+	}
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.BeginTable("pow_data")
+	w.WriteRow([]*string{str("1600000000"), str("f2pool")})
+	w.WriteRow([]*string{str("1600000060"), nil})
+	w.BeginTable("pow_bin")
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := NewReader(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m := r.Manifest(); m.Network != "testnet3" || m.FormatVersion != FormatVersion {
+		t.Fatalf("got network %s and format version %d", m.Network, m.FormatVersion)
+	}
+	if module, _ := r.Manifest().Module("pow_bin"); module.Name != "pow" {
+		t.Errorf("got module %q of pow_bin, want pow", module.Name)
+	}
+
+	table, err := r.NextTable()
+	if err != nil || table != "pow_data" {
+		t.Fatalf("got table %q, %v, want pow_data", table, err)
+	}
+	row, err := r.ReadRow()
+	if err != nil || *row[0] != "1600000000" || *row[1] != "f2pool" {
+		t.Fatalf("got row %v, %v", row, err)
+	}
+	// The remaining row is skipped.
+	table, err = r.NextTable()
+	if err != nil || table != "pow_bin" {
+		t.Fatalf("got table %q, %v, want pow_bin", table, err)
+	}
+	if _, err = r.ReadRow(); err != io.EOF {
+		t.Fatalf("got %v reading the rows of an empty table, want io.EOF", err)
+	}
+	if _, err = r.NextTable(); err != io.EOF {
+		t.Fatalf("got %v after the last table, want io.EOF", err)
+	}
+
+	if _, err = NewReader(bytes.NewReader([]byte("not an archive"))); err == nil {
+		t.Error("read an invalid archive")
+	}
+}
@@ -0,0 +1,78 @@
+package boltdb
+
+import (
+	"time"
+
+	"github.com/planetdecred/pdanalytics/chart"
+)
+
+// The hour, day, week and month bins are computed on read from the raw
+// records, sorted by time. Like the postgres bins, only the complete bins are
+// returned.
+
+// binStart returns the unix time of the start of the bin of the given level t
+// falls in. The weeks start on Monday and all the bins are in UTC.
+func binStart(t time.Time, bin string) (int64, error) {
+	t = t.UTC()
+	switch bin {
+	case string(chart.HourBin):
+		return t.Truncate(time.Hour).Unix(), nil
+	case string(chart.DayBin):
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC).Unix(), nil
+	case string(chart.WeekBin):
+		daysSinceMonday := (int(t.Weekday()) + 6) % 7
+		return time.Date(t.Year(), t.Month(), t.Day()-daysSinceMonday, 0, 0, 0, 0, time.UTC).Unix(), nil
+	case string(chart.MonthBin):
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC).Unix(), nil
+	}
+	return 0, chart.InvalidBinErr
+}
+
+// binInterval is a bin and the range [first, end) of the records in it.
+type binInterval struct {
+	start int64
+	first int
+	end   int
+}
+
+// completeBins groups n records sorted by time into the complete bins of the
+// given level. unixTime returns the unix time of the i-th record.
+func completeBins(n int, unixTime func(i int) int64, bin string) ([]binInterval, error) {
+	current, err := binStart(time.Now(), bin)
+	if err != nil {
+		return nil, err
+	}
+	var bins []binInterval
+	for i := 0; i < n; i++ {
+		start, _ := binStart(time.Unix(unixTime(i), 0), bin)
+		if start >= current {
+			break
+		}
+		if last := len(bins) - 1; last >= 0 && bins[last].start == start {
+			bins[last].end = i + 1
+			continue
+		}
+		bins = append(bins, binInterval{start: start, first: i, end: i + 1})
+	}
+	return bins, nil
+}
+
+// avg returns the average of value over the records of the bin.
+func (b binInterval) avg(value func(i int) float64) float64 {
+	var total float64
+	for i := b.first; i < b.end; i++ {
+		total += value(i)
+	}
+	return total / float64(b.end-b.first)
+}
+
+// max returns the maximum of value over the records of the bin.
+func (b binInterval) max(value func(i int) int64) int64 {
+	max := value(b.first)
+	for i := b.first + 1; i < b.end; i++ {
+		if v := value(i); v > max {
+			max = v
+		}
+	}
+	return max
+}
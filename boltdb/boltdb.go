@@ -0,0 +1,280 @@
+// Package boltdb implements the module data stores on an embedded storm
+// database, so the light modules run without a PostgreSQL server.
+package boltdb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/asdine/storm/v3"
+	"github.com/planetdecred/pdanalytics/commstats"
+	"github.com/planetdecred/pdanalytics/exchanges/ticks"
+	"github.com/planetdecred/pdanalytics/mempool"
+	"github.com/planetdecred/pdanalytics/module"
+	"github.com/planetdecred/pdanalytics/netsnapshot"
+	"github.com/planetdecred/pdanalytics/pow"
+	"github.com/planetdecred/pdanalytics/propagation"
+	"github.com/planetdecred/pdanalytics/vsp"
+)
+
+// errDef defines the default error returned if the embedded db was not
+// initialized correctly.
+var errDef = fmt.Errorf("BoltDb was not initialized correctly")
+
+// tablesBucket holds the creation time of every table, keyed by table name.
+const tablesBucket = "tables"
+
+// The tables are storm nodes named like the postgres tables they replace. The
+// hour, day, week and month bins are computed on read from the raw records,
+// so there are no _bin tables.
+const (
+	mempoolTable         = "mempool"
+	mempoolTxTable       = "mempool_tx"
+	networkSnapshotTable = "network_snapshot"
+	nodeVersionTable     = "node_version"
+	nodeLocationTable    = "node_location"
+	nodeTable            = "node"
+	heartbeatTable       = "heartbeat"
+	propagationTable     = "propagation"
+	blockTable           = "block"
+	voteTable            = "vote"
+	exchangeTable        = "exchange"
+	exchangeTickTable    = "exchange_tick"
+	redditTable          = "reddit"
+	twitterTable         = "twitter"
+	githubTable          = "github"
+	youtubeTable         = "youtube"
+	powDataTable         = "pow_data"
+	vspTable             = "vsp"
+	vspTickTable         = "vsp_tick"
+)
+
+// table is a storm node and the record type it holds.
+type table struct {
+	name   string
+	record interface{}
+}
+
+// moduleTables are the tables wanted by a module.
+type moduleTables struct {
+	module string
+	tables []table
+}
+
+// createTables holds the tables of each module, in creation order.
+var createTables = []moduleTables{
+	{"mempool", []table{
+		{mempoolTable, &mempoolRecord{}},
+		{mempoolTxTable, &mempoolTxRecord{}},
+	}},
+	{"netsnapshot", []table{
+		{networkSnapshotTable, &snapshotRecord{}},
+		{nodeVersionTable, &nodeVersionRecord{}},
+		{nodeLocationTable, &nodeLocationRecord{}},
+		{nodeTable, &nodeRecord{}},
+		{heartbeatTable, &heartbeatRecord{}},
+	}},
+	{"propagation", []table{
+		{propagationTable, &propagationRecord{}},
+		{blockTable, &blockRecord{}},
+		{voteTable, &voteRecord{}},
+	}},
+	{"exchanges", []table{
+		{exchangeTable, &exchangeRecord{}},
+		{exchangeTickTable, &exchangeTickRecord{}},
+	}},
+	{"commstats", []table{
+		{redditTable, &redditRecord{}},
+		{twitterTable, &twitterRecord{}},
+		{githubTable, &githubRecord{}},
+		{youtubeTable, &youtubeRecord{}},
+	}},
+	{"pow", []table{
+		{powDataTable, &powRecord{}},
+	}},
+	{"vsp", []table{
+		{vspTable, &vspRecord{}},
+		{vspTickTable, &vspTickRecord{}},
+	}},
+}
+
+var (
+	_ module.DB             = (*BoltDb)(nil)
+	_ mempool.DataStore     = (*BoltDb)(nil)
+	_ pow.PowDataStore      = (*BoltDb)(nil)
+	_ vsp.DataStore         = (*BoltDb)(nil)
+	_ commstats.DataStore   = (*BoltDb)(nil)
+	_ ticks.Store           = (*BoltDb)(nil)
+	_ netsnapshot.DataStore = (*BoltDb)(nil)
+	_ propagation.Store     = (*BoltDb)(nil)
+)
+
+// BoltDb stores the data of the light modules in a storm DB, a single bbolt
+// file in the data directory.
+type BoltDb struct {
+	sdb *storm.DB
+}
+
+// NewBoltDb opens an existing database or creates a new storm DB instance
+// with the provided path.
+func NewBoltDb(dbPath string) (*BoltDb, error) {
+	if dbPath == "" {
+		return nil, errors.New("missing db path")
+	}
+
+	_, err := os.Stat(dbPath)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	db, err := storm.Open(dbPath, storm.Batch())
+	if err != nil {
+		return nil, err
+	}
+	log.Infof("Opened embedded DB: %s", dbPath)
+
+	return &BoltDb{sdb: db}, nil
+}
+
+// Close closes the embedded DB instance.
+func (db *BoltDb) Close() error {
+	if db == nil || db.sdb == nil {
+		return nil
+	}
+	log.Trace("Closing embedded db")
+	return db.sdb.Close()
+}
+
+// Ping checks that the database is open.
+func (db *BoltDb) Ping(ctx context.Context) error {
+	if db == nil || db.sdb == nil {
+		return errDef
+	}
+	_, err := db.sdb.KeyExists(tablesBucket, tablesBucket)
+	if errors.Is(err, storm.ErrNotFound) {
+		return nil
+	}
+	return err
+}
+
+// TableExists reports whether the named table was created.
+func (db *BoltDb) TableExists(name string) bool {
+	if db == nil || db.sdb == nil {
+		return false
+	}
+	exists, err := db.sdb.KeyExists(tablesBucket, name)
+	return err == nil && exists
+}
+
+// CreateTables creates the missing tables and the indexes of their records.
+func (db *BoltDb) CreateTables(ctx context.Context) error {
+	if db == nil || db.sdb == nil {
+		return errDef
+	}
+	for _, mt := range createTables {
+		for _, t := range mt.tables {
+			if db.TableExists(t.name) {
+				continue
+			}
+			if err := db.sdb.From(t.name).Init(t.record); err != nil {
+				return fmt.Errorf("failed to create the %s table: %v", t.name, err)
+			}
+			if err := db.sdb.Set(tablesBucket, t.name, time.Now().Unix()); err != nil {
+				return err
+			}
+			log.Infof("Created %s table", t.name)
+		}
+	}
+	return nil
+}
+
+// TableModules returns the names of the modules that own embedded tables, in
+// table creation order.
+func TableModules() []string {
+	modules := make([]string, 0, len(createTables))
+	for _, mt := range createTables {
+		modules = append(modules, mt.module)
+	}
+	return modules
+}
+
+// ModuleTables returns the names of the tables wanted by the named modules, in
+// creation order. All the tables are returned when no module is named.
+func ModuleTables(modules ...string) ([]string, error) {
+	wanted := make(map[string]bool, len(modules))
+	for _, name := range modules {
+		wanted[name] = true
+	}
+	var tables []string
+	for _, mt := range createTables {
+		if len(modules) > 0 && !wanted[mt.module] {
+			continue
+		}
+		delete(wanted, mt.module)
+		for _, t := range mt.tables {
+			tables = append(tables, t.name)
+		}
+	}
+	for _, name := range modules {
+		if !wanted[name] {
+			continue
+		}
+		return nil, fmt.Errorf("module %s has no embedded tables, expected one of %s", name,
+			strings.Join(TableModules(), ", "))
+	}
+	return tables, nil
+}
+
+// DropTables drops all the tables.
+func (db *BoltDb) DropTables() error {
+	return db.DropModuleTables()
+}
+
+// DropModuleTables drops the tables wanted by the named modules, or all the
+// tables when no module is named.
+func (db *BoltDb) DropModuleTables(modules ...string) error {
+	if db == nil || db.sdb == nil {
+		return errDef
+	}
+	tables, err := ModuleTables(modules...)
+	if err != nil {
+		return err
+	}
+	for i := len(tables) - 1; i >= 0; i-- {
+		if !db.TableExists(tables[i]) {
+			continue
+		}
+		if err = db.sdb.Drop(tables[i]); err != nil {
+			return fmt.Errorf("failed to drop the %s table: %v", tables[i], err)
+		}
+		if err = db.sdb.Delete(tablesBucket, tables[i]); err != nil {
+			return err
+		}
+		log.Infof("Dropped %s table", tables[i])
+	}
+	return nil
+}
+
+// count returns the number of records of the given type in a table.
+func (db *BoltDb) count(tableName string, record interface{}) (int64, error) {
+	if db == nil || db.sdb == nil {
+		return 0, errDef
+	}
+	n, err := db.sdb.From(tableName).Count(record)
+	if err != nil && !errors.Is(err, storm.ErrNotFound) {
+		return 0, err
+	}
+	return int64(n), nil
+}
+
+// ignoreNotFound returns nil for the storm.ErrNotFound returned by the queries
+// without results, which are empty results here.
+func ignoreNotFound(err error) error {
+	if errors.Is(err, storm.ErrNotFound) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,327 @@
+package boltdb
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/asdine/storm/v3/q"
+	"github.com/planetdecred/pdanalytics/commstats"
+)
+
+// The community stat records are keyed by their date in unix nanoseconds so a
+// date is only stored once, like the postgres primary keys. The column method
+// of each record returns the value of the postgres column name, for the charts
+// and their filters.
+
+type redditRecord struct {
+	Date           int64  `storm:"id"`
+	Subreddit      string `storm:"index"`
+	Subscribers    int
+	ActiveAccounts int
+}
+
+func (r redditRecord) date() int64 { return r.Date }
+
+func (r redditRecord) column(name string) interface{} {
+	switch name {
+	case "subreddit":
+		return r.Subreddit
+	case "subscribers":
+		return r.Subscribers
+	case "active_accounts":
+		return r.ActiveAccounts
+	}
+	return nil
+}
+
+type twitterRecord struct {
+	Date      int64  `storm:"id"`
+	Handle    string `storm:"index"`
+	Followers int
+}
+
+func (r twitterRecord) date() int64 { return r.Date }
+
+func (r twitterRecord) column(name string) interface{} {
+	switch name {
+	case "handle":
+		return r.Handle
+	case "followers":
+		return r.Followers
+	}
+	return nil
+}
+
+type githubRecord struct {
+	Date       int64  `storm:"id"`
+	Repository string `storm:"index"`
+	Stars      int
+	Folks      int
+}
+
+func (r githubRecord) date() int64 { return r.Date }
+
+func (r githubRecord) column(name string) interface{} {
+	switch name {
+	case "repository":
+		return r.Repository
+	case "stars":
+		return r.Stars
+	case "folks":
+		return r.Folks
+	}
+	return nil
+}
+
+type youtubeRecord struct {
+	Date        int64 `storm:"id"`
+	Subscribers int
+	ViewCount   int
+	Channel     string `storm:"index"`
+}
+
+func (r youtubeRecord) date() int64 { return r.Date }
+
+func (r youtubeRecord) column(name string) interface{} {
+	switch name {
+	case "subscribers":
+		return r.Subscribers
+	case "view_count":
+		return r.ViewCount
+	case "channel":
+		return r.Channel
+	}
+	return nil
+}
+
+type commStatRecord interface {
+	date() int64
+	column(name string) interface{}
+}
+
+// storeCommStat saves the record unless its date is already stored. existing
+// receives the stored record, if any.
+func (db *BoltDb) storeCommStat(table string, record, existing interface{}, date time.Time) error {
+	if db == nil || db.sdb == nil {
+		return errDef
+	}
+	err := db.sdb.From(table).One("Date", date.UnixNano(), existing)
+	if err == nil { // Ignore duplicate entries
+		return nil
+	}
+	if err = ignoreNotFound(err); err != nil {
+		return err
+	}
+	return db.sdb.From(table).Save(record)
+}
+
+// commStatPage reads a page of the records of the table matching the
+// matchers into to, the most recent first.
+func (db *BoltDb) commStatPage(table string, to interface{}, offset, limit int, matchers ...q.Matcher) error {
+	if db == nil || db.sdb == nil {
+		return errDef
+	}
+	err := db.sdb.From(table).Select(matchers...).Reverse().Skip(offset).Limit(limit).Find(to)
+	return ignoreNotFound(err)
+}
+
+func (db *BoltDb) commStatCount(table string, record interface{}, matchers ...q.Matcher) (int64, error) {
+	if db == nil || db.sdb == nil {
+		return 0, errDef
+	}
+	count, err := db.sdb.From(table).Select(matchers...).Count(record)
+	return int64(count), ignoreNotFound(err)
+}
+
+func (db *BoltDb) StoreRedditStat(ctx context.Context, stat commstats.Reddit) error {
+	return db.storeCommStat(redditTable, &redditRecord{
+		Date:           stat.Date.UnixNano(),
+		Subscribers:    stat.Subscribers,
+		ActiveAccounts: stat.AccountsActive,
+		Subreddit:      stat.Subreddit,
+	}, &redditRecord{}, stat.Date)
+}
+
+func (db *BoltDb) LastCommStatEntry() (entryTime time.Time) {
+	_ = db.LastEntry(context.Background(), redditTable, &entryTime)
+	return
+}
+
+func (db *BoltDb) CountRedditStat(ctx context.Context, subreddit string) (int64, error) {
+	return db.commStatCount(redditTable, &redditRecord{}, q.Eq("Subreddit", subreddit))
+}
+
+func (db *BoltDb) RedditStats(ctx context.Context, subreddit string, offtset int, limit int) ([]commstats.Reddit, error) {
+	var records []redditRecord
+	if err := db.commStatPage(redditTable, &records, offtset, limit, q.Eq("Subreddit", subreddit)); err != nil {
+		return nil, err
+	}
+	var result []commstats.Reddit
+	for _, record := range records {
+		result = append(result, commstats.Reddit{
+			Date:           time.Unix(0, record.Date).UTC(),
+			Subreddit:      record.Subreddit,
+			Subscribers:    record.Subscribers,
+			AccountsActive: record.ActiveAccounts,
+		})
+	}
+	return result, nil
+}
+
+// twitter
+func (db *BoltDb) StoreTwitterStat(ctx context.Context, twitter commstats.Twitter) error {
+	return db.storeCommStat(twitterTable, &twitterRecord{
+		Date:      twitter.Date.UnixNano(),
+		Followers: twitter.Followers,
+		Handle:    twitter.Handle,
+	}, &twitterRecord{}, twitter.Date)
+}
+
+func (db *BoltDb) CountTwitterStat(ctx context.Context, handle string) (int64, error) {
+	return db.commStatCount(twitterTable, &twitterRecord{}, q.Eq("Handle", handle))
+}
+
+func (db *BoltDb) TwitterStats(ctx context.Context, handle string, offtset int, limit int) ([]commstats.Twitter, error) {
+	var records []twitterRecord
+	if err := db.commStatPage(twitterTable, &records, offtset, limit, q.Eq("Handle", handle)); err != nil {
+		return nil, err
+	}
+	var result []commstats.Twitter
+	for _, record := range records {
+		result = append(result, commstats.Twitter{
+			Date:      time.Unix(0, record.Date).UTC(),
+			Followers: record.Followers,
+		})
+	}
+	return result, nil
+}
+
+// youtube
+func (db *BoltDb) StoreYoutubeStat(ctx context.Context, youtube commstats.Youtube) error {
+	return db.storeCommStat(youtubeTable, &youtubeRecord{
+		Date:        youtube.Date.UnixNano(),
+		Subscribers: youtube.Subscribers,
+		ViewCount:   youtube.ViewCount,
+		Channel:     youtube.Channel,
+	}, &youtubeRecord{}, youtube.Date)
+}
+
+func (db *BoltDb) CountYoutubeStat(ctx context.Context, channel string) (int64, error) {
+	return db.commStatCount(youtubeTable, &youtubeRecord{}, q.Eq("Channel", channel))
+}
+
+func (db *BoltDb) YoutubeStat(ctx context.Context, channel string, offtset int, limit int) ([]commstats.Youtube, error) {
+	var records []youtubeRecord
+	if err := db.commStatPage(youtubeTable, &records, offtset, limit, q.Eq("Channel", channel)); err != nil {
+		return nil, err
+	}
+	var result []commstats.Youtube
+	for _, record := range records {
+		result = append(result, commstats.Youtube{
+			Date:        time.Unix(0, record.Date).UTC(),
+			Subscribers: record.Subscribers,
+			ViewCount:   record.ViewCount,
+			Channel:     record.Channel,
+		})
+	}
+	return result, nil
+}
+
+// github
+func (db *BoltDb) StoreGithubStat(ctx context.Context, github commstats.Github) error {
+	return db.storeCommStat(githubTable, &githubRecord{
+		Date:       github.Date.UnixNano(),
+		Repository: github.Repository,
+		Stars:      github.Stars,
+		Folks:      github.Folks,
+	}, &githubRecord{}, github.Date)
+}
+
+func (db *BoltDb) CountGithubStat(ctx context.Context, repository string) (int64, error) {
+	return db.commStatCount(githubTable, &githubRecord{}, q.Eq("Repository", repository))
+}
+
+func (db *BoltDb) GithubStat(ctx context.Context, repository string, offtset int, limit int) ([]commstats.Github, error) {
+	var records []githubRecord
+	if err := db.commStatPage(githubTable, &records, offtset, limit, q.Eq("Repository", repository)); err != nil {
+		return nil, err
+	}
+	var result []commstats.Github
+	for _, record := range records {
+		result = append(result, commstats.Github{
+			Date:  time.Unix(0, record.Date).UTC(),
+			Folks: record.Folks,
+			Stars: record.Stars,
+		})
+	}
+	return result, nil
+}
+
+// commStatRecords returns the records of the platform table, ordered by date.
+func (db *BoltDb) commStatRecords(platform string) ([]commStatRecord, error) {
+	if db == nil || db.sdb == nil {
+		return nil, errDef
+	}
+	var records []commStatRecord
+	var err error
+	switch platform {
+	case redditTable:
+		var rows []redditRecord
+		err = db.sdb.From(platform).All(&rows)
+		for _, r := range rows {
+			records = append(records, r)
+		}
+	case twitterTable:
+		var rows []twitterRecord
+		err = db.sdb.From(platform).All(&rows)
+		for _, r := range rows {
+			records = append(records, r)
+		}
+	case githubTable:
+		var rows []githubRecord
+		err = db.sdb.From(platform).All(&rows)
+		for _, r := range rows {
+			records = append(records, r)
+		}
+	case youtubeTable:
+		var rows []youtubeRecord
+		err = db.sdb.From(platform).All(&rows)
+		for _, r := range rows {
+			records = append(records, r)
+		}
+	default:
+		return nil, fmt.Errorf("unknown community stat platform %s", platform)
+	}
+	return records, ignoreNotFound(err)
+}
+
+// CommunityChart returns the dataType column of the platform records matching
+// the filters. The filter values are quoted, as they are for the postgres
+// query.
+func (db *BoltDb) CommunityChart(ctx context.Context, platform string, dataType string, filters map[string]string) (stats []commstats.ChartData, err error) {
+	dataType = strings.ToLower(dataType)
+	records, err := db.commStatRecords(platform)
+	if err != nil {
+		return nil, err
+	}
+
+records:
+	for _, record := range records {
+		for attribute, value := range filters {
+			if fmt.Sprint(record.column(attribute)) != strings.Trim(value, "'") {
+				continue records
+			}
+		}
+		value, ok := record.column(dataType).(int)
+		if !ok {
+			return nil, fmt.Errorf("unknown %s column %s", platform, dataType)
+		}
+		stats = append(stats, commstats.ChartData{
+			Date:   time.Unix(0, record.date()).UTC(),
+			Record: int64(value),
+		})
+	}
+	return
+}
@@ -0,0 +1,441 @@
+package boltdb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/asdine/storm/v3"
+	"github.com/asdine/storm/v3/q"
+	"github.com/planetdecred/pdanalytics/app/helpers"
+	"github.com/planetdecred/pdanalytics/chart"
+	"github.com/planetdecred/pdanalytics/dbhelper"
+	"github.com/planetdecred/pdanalytics/exchanges/ticks"
+)
+
+type exchangeRecord struct {
+	ID   int    `storm:"id,increment"`
+	Name string `storm:"unique"`
+	URL  string
+}
+
+// exchangeTickRecord is an exchange tick, keyed by exchange, interval,
+// currency pair and time so a tick is only stored once.
+type exchangeTickRecord struct {
+	ID           string `storm:"id"`
+	ExchangeID   int    `storm:"index"`
+	Interval     int    `storm:"index"`
+	CurrencyPair string `storm:"index"`
+	High         float64
+	Low          float64
+	Open         float64
+	Close        float64
+	Volume       float64
+	Time         int64 `storm:"index"`
+}
+
+var zeroTime time.Time
+
+func exchangeTickRecordID(exchangeID, interval int, pair string, time int64) string {
+	return fmt.Sprintf("%d:%d:%s:%020d", exchangeID, interval, pair, time)
+}
+
+func (t *exchangeTickRecord) toDto(exchangeName string) ticks.TickDto {
+	return ticks.TickDto{
+		ExchangeID:   t.ExchangeID,
+		Interval:     t.Interval,
+		CurrencyPair: t.CurrencyPair,
+		Time:         helpers.UnixTime(t.Time).Format(dbhelper.DateTemplate),
+		Close:        t.Close,
+		ExchangeName: exchangeName,
+		High:         t.High,
+		Low:          t.Low,
+		Open:         t.Open,
+		Volume:       t.Volume,
+	}
+}
+
+func (db *BoltDb) ExchangeTableName() string {
+	return exchangeTable
+}
+
+func (db *BoltDb) ExchangeTickTableName() string {
+	return exchangeTickTable
+}
+
+func (db *BoltDb) exchangeByName(name string) (*exchangeRecord, error) {
+	if db == nil || db.sdb == nil {
+		return nil, errDef
+	}
+	var exchange exchangeRecord
+	if err := db.sdb.From(exchangeTable).One("Name", name, &exchange); err != nil {
+		return nil, err
+	}
+	return &exchange, nil
+}
+
+// lastExchangeTick returns the most recent tick matching the matchers.
+func (db *BoltDb) lastExchangeTick(matchers ...q.Matcher) (*exchangeTickRecord, error) {
+	var records []exchangeTickRecord
+	err := db.sdb.From(exchangeTickTable).Select(matchers...).OrderBy("Time").Reverse().Limit(1).Find(&records)
+	if err != nil {
+		return nil, err
+	}
+	return &records[0], nil
+}
+
+func (db *BoltDb) RegisterExchange(ctx context.Context, exchange ticks.ExchangeData) (time.Time, time.Time, time.Time, error) {
+	xch, err := db.exchangeByName(exchange.Name)
+	if err != nil {
+		if err == storm.ErrNotFound {
+			err = db.sdb.From(exchangeTable).Save(&exchangeRecord{
+				Name: exchange.Name,
+				URL:  exchange.WebsiteURL,
+			})
+		}
+		return zeroTime, zeroTime, zeroTime, err
+	}
+
+	lastTime := func(interval time.Duration) (t time.Time) {
+		tick, err := db.lastExchangeTick(q.Eq("ExchangeID", xch.ID), q.Eq("Interval", int(interval.Minutes())))
+		if err == nil {
+			t = helpers.UnixTime(tick.Time)
+		}
+		return
+	}
+	return lastTime(exchange.ShortInterval), lastTime(exchange.LongInterval),
+		lastTime(exchange.HistoricInterval), nil
+}
+
+func (db *BoltDb) StoreExchangeTicks(ctx context.Context, name string, interval int, pair string, data []ticks.Tick) (time.Time, error) {
+	if len(data) == 0 {
+		return zeroTime, fmt.Errorf("No ticks received for %s", name)
+	}
+
+	exchange, err := db.exchangeByName(name)
+	if err != nil {
+		return zeroTime, err
+	}
+
+	tx, err := db.sdb.From(exchangeTickTable).Begin(true)
+	if err != nil {
+		return zeroTime, err
+	}
+	defer tx.Rollback()
+
+	var lastTime time.Time
+	for _, tick := range data {
+		t := tick.Time.UTC()
+		record := &exchangeTickRecord{
+			ID:           exchangeTickRecordID(exchange.ID, interval, pair, t.Unix()),
+			ExchangeID:   exchange.ID,
+			Interval:     interval,
+			CurrencyPair: pair,
+			High:         tick.High,
+			Low:          tick.Low,
+			Open:         tick.Open,
+			Close:        tick.Close,
+			Volume:       tick.Volume,
+			Time:         t.Unix(),
+		}
+		if err = tx.Save(record); err != nil {
+			return lastTime, err
+		}
+		lastTime = t
+	}
+	if err = tx.Commit(); err != nil {
+		return zeroTime, err
+	}
+
+	firstTime := data[0].Time
+	if len(data) == 1 {
+		log.Infof("%-9s %7s, received %6dm ticks, storing      1 entries %s", name, pair,
+			interval, firstTime.Format(dbhelper.DateTemplate))
+	} else {
+		log.Infof("%-9s %7s, received %6dm ticks, storing %6v entries %s to %s", name, pair,
+			interval, len(data), firstTime.Format(dbhelper.DateTemplate), lastTime.Format(dbhelper.DateTemplate))
+	}
+	return lastTime, nil
+}
+
+// AllExchange fetches a slice of all exchange from the db
+func (db *BoltDb) AllExchange(ctx context.Context) ([]ticks.ExchangeDto, error) {
+	if db == nil || db.sdb == nil {
+		return nil, errDef
+	}
+	var records []exchangeRecord
+	err := db.sdb.From(exchangeTable).Select(q.Not(q.Eq("Name", "bluetrade"))).Find(&records)
+	if err = ignoreNotFound(err); err != nil {
+		return nil, err
+	}
+	var result = make([]ticks.ExchangeDto, len(records))
+	for i, e := range records {
+		result[i] = ticks.ExchangeDto{
+			ID:   e.ID,
+			Name: e.Name,
+			URL:  e.URL,
+		}
+	}
+	return result, nil
+}
+
+func (db *BoltDb) FetchExchangeForSync(ctx context.Context, lastID int, skip, take int) ([]ticks.ExchangeData, int64, error) {
+	if db == nil || db.sdb == nil {
+		return nil, 0, errDef
+	}
+	total, err := db.sdb.From(exchangeTable).Select(q.Gt("ID", lastID)).Count(&exchangeRecord{})
+	if err = ignoreNotFound(err); err != nil {
+		return nil, 0, err
+	}
+	var records []exchangeRecord
+	err = db.sdb.From(exchangeTable).Select(q.Gt("ID", lastID)).Skip(skip).Limit(take).Find(&records)
+	if err = ignoreNotFound(err); err != nil {
+		return nil, 0, err
+	}
+	var exchanges []ticks.ExchangeData
+	for _, exchange := range records {
+		exchanges = append(exchanges, ticks.ExchangeData{
+			ID:         exchange.ID,
+			Name:       exchange.Name,
+			WebsiteURL: exchange.URL,
+		})
+	}
+	return exchanges, int64(total), nil
+}
+
+func (db *BoltDb) ExchangeTickCount(ctx context.Context) (int64, error) {
+	return db.count(exchangeTickTable, &exchangeTickRecord{})
+}
+
+// exchangeNames maps the exchange ids to their names.
+func (db *BoltDb) exchangeNames() (map[int]string, error) {
+	var records []exchangeRecord
+	if err := ignoreNotFound(db.sdb.From(exchangeTable).All(&records)); err != nil {
+		return nil, err
+	}
+	names := make(map[int]string, len(records))
+	for _, e := range records {
+		names[e.ID] = e.Name
+	}
+	return names, nil
+}
+
+// exchangeTicksPage returns a page of the ticks matching the matchers, the
+// most recent first, and the number of matching ticks.
+func (db *BoltDb) exchangeTicksPage(offset, limit int, matchers ...q.Matcher) ([]ticks.TickDto, int64, error) {
+	names, err := db.exchangeNames()
+	if err != nil {
+		return nil, 0, err
+	}
+	total, err := db.sdb.From(exchangeTickTable).Select(matchers...).Count(&exchangeTickRecord{})
+	if err = ignoreNotFound(err); err != nil {
+		return nil, 0, err
+	}
+	var records []exchangeTickRecord
+	err = db.sdb.From(exchangeTickTable).Select(matchers...).OrderBy("Time").Reverse().
+		Skip(offset).Limit(limit).Find(&records)
+	if err = ignoreNotFound(err); err != nil {
+		return nil, 0, err
+	}
+	tickDtos := []ticks.TickDto{}
+	for i := range records {
+		tickDtos = append(tickDtos, records[i].toDto(names[records[i].ExchangeID]))
+	}
+	return tickDtos, int64(total), nil
+}
+
+// FetchExchangeTicks fetches a slice exchange ticks of the supplied exchange name
+func (db *BoltDb) FetchExchangeTicks(ctx context.Context, currencyPair, name string, interval, offset, limit int) ([]ticks.TickDto, int64, error) {
+	if db == nil || db.sdb == nil {
+		return nil, 0, errDef
+	}
+	var matchers []q.Matcher
+	if name != "All" && name != "" {
+		exchange, err := db.exchangeByName(name)
+		if err != nil {
+			return nil, 0, err
+		}
+		matchers = append(matchers, q.Eq("ExchangeID", exchange.ID))
+	}
+	if currencyPair != "" && currencyPair != "All" {
+		matchers = append(matchers, q.Eq("CurrencyPair", currencyPair))
+	}
+	if interval > 0 {
+		matchers = append(matchers, q.Eq("Interval", interval))
+	}
+	return db.exchangeTicksPage(offset, limit, matchers...)
+}
+
+func (db *BoltDb) AllExchangeTicks(ctx context.Context, currencyPair string, interval, offset, limit int) ([]ticks.TickDto, int64, error) {
+	if db == nil || db.sdb == nil {
+		return nil, 0, errDef
+	}
+	var matchers []q.Matcher
+	if currencyPair != "" {
+		matchers = append(matchers, q.Eq("CurrencyPair", currencyPair))
+	}
+	if interval != -1 {
+		matchers = append(matchers, q.Eq("Interval", interval))
+	}
+	return db.exchangeTicksPage(offset, limit, matchers...)
+}
+
+// exchangeTicks returns the ticks of the exchange, or of all the exchanges
+// when exchangeName is "All" or empty, matching the matchers.
+func (db *BoltDb) exchangeTicks(exchangeName string, matchers ...q.Matcher) ([]exchangeTickRecord, error) {
+	if db == nil || db.sdb == nil {
+		return nil, errDef
+	}
+	if exchangeName != "All" && exchangeName != "" {
+		exchange, err := db.exchangeByName(exchangeName)
+		if err != nil {
+			return nil, err
+		}
+		matchers = append(matchers, q.Eq("ExchangeID", exchange.ID))
+	}
+	var records []exchangeTickRecord
+	err := db.sdb.From(exchangeTickTable).Select(matchers...).OrderBy("Time").Find(&records)
+	return records, ignoreNotFound(err)
+}
+
+func distinctCurrencyPairs(records []exchangeTickRecord) []ticks.TickDtoCP {
+	seen := make(map[string]bool)
+	result := []ticks.TickDtoCP{}
+	for _, r := range records {
+		if !seen[r.CurrencyPair] {
+			seen[r.CurrencyPair] = true
+			result = append(result, ticks.TickDtoCP{CurrencyPair: r.CurrencyPair})
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].CurrencyPair < result[j].CurrencyPair })
+	return result
+}
+
+func distinctIntervals(records []exchangeTickRecord) []ticks.TickDtoInterval {
+	seen := make(map[int]bool)
+	result := []ticks.TickDtoInterval{}
+	for _, r := range records {
+		if !seen[r.Interval] {
+			seen[r.Interval] = true
+			result = append(result, ticks.TickDtoInterval{Interval: r.Interval})
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Interval < result[j].Interval })
+	return result
+}
+
+func (db *BoltDb) AllExchangeTicksCurrencyPair(ctx context.Context) ([]ticks.TickDtoCP, error) {
+	records, err := db.exchangeTicks("")
+	if err != nil {
+		return nil, err
+	}
+	return distinctCurrencyPairs(records), nil
+}
+
+func (db *BoltDb) CurrencyPairByExchange(ctx context.Context, exchangeName string) ([]ticks.TickDtoCP, error) {
+	records, err := db.exchangeTicks(exchangeName)
+	if err != nil {
+		return nil, err
+	}
+	return distinctCurrencyPairs(records), nil
+}
+
+func (db *BoltDb) AllExchangeTicksInterval(ctx context.Context) ([]ticks.TickDtoInterval, error) {
+	records, err := db.exchangeTicks("")
+	if err != nil {
+		return nil, err
+	}
+	return distinctIntervals(records), nil
+}
+
+func (db *BoltDb) TickIntervalsByExchangeAndPair(ctx context.Context, exchangeName string, currencyPair string) ([]ticks.TickDtoInterval, error) {
+	records, err := db.exchangeTicks(exchangeName, q.Eq("CurrencyPair", currencyPair))
+	if err != nil {
+		return nil, err
+	}
+	return distinctIntervals(records), nil
+}
+
+func (db *BoltDb) ExchangeTicksChartData(ctx context.Context, selectedTick string, currencyPair string, selectedInterval int, source string) ([]ticks.TickChartData, error) {
+	if db == nil || db.sdb == nil {
+		return nil, errDef
+	}
+	if _, err := db.exchangeByName(source); err != nil {
+		return nil, fmt.Errorf("The selected exchange, %s does not exist, %s", source, err.Error())
+	}
+	matchers := []q.Matcher{q.Eq("CurrencyPair", currencyPair)}
+	if selectedInterval != -1 {
+		matchers = append(matchers, q.Eq("Interval", selectedInterval))
+	}
+	records, err := db.exchangeTicks(source, matchers...)
+	if err != nil {
+		return nil, fmt.Errorf("Error in fetching exchange tick, %s", err.Error())
+	}
+
+	tickChart := []ticks.TickChartData{}
+	for _, tick := range records {
+		var filter float64
+		switch selectedTick {
+		case "high":
+			filter = tick.High
+		case "low":
+			filter = tick.Low
+		case "open":
+			filter = tick.Open
+		case "Volume":
+			filter = tick.Volume
+		default:
+			filter = tick.Close
+		}
+		tickChart = append(tickChart, ticks.TickChartData{
+			Time:   helpers.UnixTime(tick.Time),
+			Filter: filter,
+		})
+	}
+	return tickChart, nil
+}
+
+func (db *BoltDb) LastExchangeTickEntryTime() (time time.Time) {
+	if db == nil || db.sdb == nil {
+		return
+	}
+	tick, err := db.lastExchangeTick()
+	if err == nil {
+		time = helpers.UnixTime(tick.Time)
+	}
+	return
+}
+
+func (db *BoltDb) FetchEncodeExchangeChart(ctx context.Context, dataType, _ string, binString string, setKey ...string) ([]byte, error) {
+	if len(setKey) < 1 {
+		return nil, errors.New("exchange set key is required for exchange chart")
+	}
+	exchangeName, currencyPair, interval := chart.ExtractExchangeKey(setKey[0])
+	if _, err := db.exchangeByName(exchangeName); err != nil {
+		return nil, fmt.Errorf("the selected exchange, %s does not exist, %s", exchangeName, err.Error())
+	}
+	records, err := db.exchangeTicks(exchangeName, q.Eq("CurrencyPair", currencyPair), q.Eq("Interval", interval))
+	if err != nil {
+		return nil, fmt.Errorf("error in fetching exchange tick, %s", err.Error())
+	}
+
+	var dates chart.ChartUints
+	var yAxis chart.ChartFloats
+	for _, t := range records {
+		dates = append(dates, uint64(t.Time))
+		switch strings.ToLower(dataType) {
+		case string(chart.ExchangeOpenAxis):
+			yAxis = append(yAxis, t.Open)
+		case string(chart.ExchangeCloseAxis):
+			yAxis = append(yAxis, t.Close)
+		case string(chart.ExchangeHighAxis):
+			yAxis = append(yAxis, t.High)
+		case string(chart.ExchangeLowAxis):
+			yAxis = append(yAxis, t.Low)
+		}
+	}
+	return chart.Encode(nil, dates, yAxis)
+}
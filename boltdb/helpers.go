@@ -0,0 +1,147 @@
+package boltdb
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/asdine/storm/v3"
+	"github.com/planetdecred/pdanalytics/app/helpers"
+	"github.com/planetdecred/pdanalytics/chart"
+	"github.com/volatiletech/null/v8"
+)
+
+const dateTemplate = "2006-01-02 15:04"
+
+func unixTimeToString(t int64) string {
+	return helpers.UnixTime(t).Format(dateTemplate)
+}
+
+// roundValue formats a proportion as a percentage, like postgres.RoundValue.
+func roundValue(input float64) string {
+	return strconv.FormatFloat(input*100, 'f', 3, 64)
+}
+
+// sortedDates returns the distinct dates of the sets in ascending order.
+func sortedDates(sets ...map[uint64]float64) chart.ChartUints {
+	seen := make(map[uint64]bool)
+	var dates chart.ChartUints
+	for _, set := range sets {
+		for date := range set {
+			if !seen[date] {
+				seen[date] = true
+				dates = append(dates, date)
+			}
+		}
+	}
+	sort.Slice(dates, func(i, j int) bool { return dates[i] < dates[j] })
+	return dates
+}
+
+// nullUints aligns the values of a series, keyed by date, to dates. The dates
+// before the first value of the series are nil and the missing values after it
+// are invalid, as the postgres charts do.
+func nullUints(dates chart.ChartUints, values map[uint64]float64) chart.ChartNullUints {
+	series := make(chart.ChartNullUints, len(dates))
+	var hasFoundOne bool
+	for i, date := range dates {
+		if v, found := values[date]; found {
+			series[i] = &null.Uint64{Valid: true, Uint64: uint64(math.Round(v))}
+			hasFoundOne = true
+		} else if hasFoundOne {
+			series[i] = &null.Uint64{Valid: false}
+		}
+	}
+	return series
+}
+
+// nullFloats is nullUints for float values.
+func nullFloats(dates chart.ChartUints, values map[uint64]float64) chart.ChartNullFloats {
+	series := make(chart.ChartNullFloats, len(dates))
+	var hasFoundOne bool
+	for i, date := range dates {
+		if v, found := values[date]; found {
+			series[i] = &null.Float64{Valid: true, Float64: v}
+			hasFoundOne = true
+		} else if hasFoundOne {
+			series[i] = &null.Float64{Valid: false}
+		}
+	}
+	return series
+}
+
+// LastEntry reads the last entry of the table into receiver, a *time.Time, an
+// *int64 or an *int. Like the postgres LastEntry, it returns sql.ErrNoRows
+// when the table is empty.
+func (db *BoltDb) LastEntry(ctx context.Context, tableName string, receiver interface{}) error {
+	if db == nil || db.sdb == nil {
+		return errDef
+	}
+	last := db.sdb.From(tableName).Select().Reverse().Limit(1)
+	var value interface{}
+	var err error
+	switch tableName {
+	case exchangeTable:
+		var records []exchangeRecord
+		if err = last.Find(&records); err == nil {
+			value = int64(records[0].ID)
+		}
+	case mempoolTable:
+		var records []mempoolRecord
+		if err = last.Find(&records); err == nil {
+			value = time.Unix(0, records[0].Time).UTC()
+		}
+	case blockTable:
+		var records []blockRecord
+		if err = last.Find(&records); err == nil {
+			value = records[0].Height
+		}
+	case voteTable:
+		var records []voteRecord
+		if err = last.OrderBy("ReceiveTime").Find(&records); err == nil {
+			value = timeFromNano(records[0].ReceiveTime)
+		}
+	case redditTable, twitterTable, githubTable, youtubeTable:
+		var records []commStatRecord
+		if records, err = db.commStatRecords(tableName); err == nil && len(records) > 0 {
+			value = time.Unix(0, records[len(records)-1].date()).UTC()
+		}
+	case networkSnapshotTable:
+		var records []snapshotRecord
+		if err = last.Find(&records); err == nil {
+			value = records[0].Timestamp
+		}
+	default:
+		return fmt.Errorf("no last entry for table %s", tableName)
+	}
+	if err != nil && !errors.Is(err, storm.ErrNotFound) {
+		return err
+	}
+	if value == nil {
+		return sql.ErrNoRows
+	}
+
+	switch r := receiver.(type) {
+	case *time.Time:
+		if v, ok := value.(time.Time); ok {
+			*r = v
+			return nil
+		}
+	case *int64:
+		if v, ok := value.(int64); ok {
+			*r = v
+			return nil
+		}
+	case *int:
+		if v, ok := value.(int64); ok {
+			*r = int(v)
+			return nil
+		}
+	}
+	return fmt.Errorf("cannot read the last %s entry into %T", tableName, receiver)
+}
@@ -0,0 +1,399 @@
+package boltdb
+
+import (
+	"context"
+	"database/sql"
+	"math"
+	"time"
+
+	"github.com/planetdecred/pdanalytics/chart"
+	"github.com/planetdecred/pdanalytics/dbhelper"
+	"github.com/planetdecred/pdanalytics/mempool"
+)
+
+const (
+	// chart data types
+	MempoolSize     = "size"
+	MempoolFees     = "fees"
+	MempoolTxCount  = "tx-count"
+	MempoolFeeRates = "fee-rates"
+	MempoolLatency  = "confirmation-latency"
+)
+
+// mempoolRecord is a mempool entry, keyed by its time in unix nanoseconds so
+// the records are stored in time order.
+type mempoolRecord struct {
+	Time                 int64 `storm:"id"`
+	FirstSeenTime        int64
+	NumberOfTransactions int
+	Voters               int
+	Tickets              int
+	Revocations          int
+	Size                 int32
+	TotalFee             float64
+	Total                float64
+	FeeRates             mempool.FeeRates
+	Types                []mempool.TypeStats
+}
+
+// mempoolTxRecord is a transaction that left the mempool, keyed by its hash.
+// The times are in unix nanoseconds.
+type mempoolTxRecord struct {
+	Hash            string `storm:"id"`
+	Type            string
+	Size            int32
+	FeeRate         int64
+	FeeRateBucket   int64
+	FirstSeenTime   int64
+	FirstSeenHeight int64
+	Outcome         string
+	Height          int64
+	Time            int64 `storm:"index"`
+}
+
+func (r *mempoolTxRecord) mempoolTx() mempool.MempoolTx {
+	return mempool.MempoolTx{
+		Hash:            r.Hash,
+		Type:            r.Type,
+		Size:            r.Size,
+		FeeRate:         r.FeeRate,
+		FeeRateBucket:   r.FeeRateBucket,
+		FirstSeenTime:   time.Unix(0, r.FirstSeenTime).UTC(),
+		FirstSeenHeight: r.FirstSeenHeight,
+		Outcome:         r.Outcome,
+		Height:          r.Height,
+		Time:            time.Unix(0, r.Time).UTC(),
+	}
+}
+
+func (db *BoltDb) MempoolTableName() string {
+	return mempoolTable
+}
+
+func (db *BoltDb) StoreMempool(ctx context.Context, mempoolDto mempool.Mempool) error {
+	if db == nil || db.sdb == nil {
+		return errDef
+	}
+	record := &mempoolRecord{
+		Time:                 mempoolDto.Time.UnixNano(),
+		FirstSeenTime:        mempoolDto.FirstSeenTime.UnixNano(),
+		NumberOfTransactions: mempoolDto.NumberOfTransactions,
+		Voters:               mempoolDto.Voters,
+		Tickets:              mempoolDto.Tickets,
+		Revocations:          mempoolDto.Revocations,
+		Size:                 mempoolDto.Size,
+		TotalFee:             mempoolDto.TotalFee,
+		Total:                mempoolDto.Total,
+		FeeRates:             mempoolDto.FeeRates,
+		Types:                mempoolDto.Types,
+	}
+	if err := db.sdb.From(mempoolTable).Save(record); err != nil {
+		return err
+	}
+	log.Infof("Added mempool entry at %s, tx count %2d, total size: %6d B, Total Fee: %010.8f",
+		mempoolDto.Time.Format(dbhelper.DateTemplate), mempoolDto.NumberOfTransactions, mempoolDto.Size, mempoolDto.TotalFee)
+	return nil
+}
+
+// StoreMempoolTxs stores the transactions that left the mempool, keeping the
+// first record of a transaction.
+func (db *BoltDb) StoreMempoolTxs(ctx context.Context, txs []mempool.MempoolTx) error {
+	if db == nil || db.sdb == nil {
+		return errDef
+	}
+	node, err := db.sdb.From(mempoolTxTable).Begin(true)
+	if err != nil {
+		return err
+	}
+	defer node.Rollback()
+	for _, tx := range txs {
+		var existing mempoolTxRecord
+		if err = node.One("Hash", tx.Hash, &existing); err == nil {
+			continue
+		} else if err = ignoreNotFound(err); err != nil {
+			return err
+		}
+		record := &mempoolTxRecord{
+			Hash:            tx.Hash,
+			Type:            tx.Type,
+			Size:            tx.Size,
+			FeeRate:         tx.FeeRate,
+			FeeRateBucket:   tx.FeeRateBucket,
+			FirstSeenTime:   tx.FirstSeenTime.UnixNano(),
+			FirstSeenHeight: tx.FirstSeenHeight,
+			Outcome:         tx.Outcome,
+			Height:          tx.Height,
+			Time:            tx.Time.UnixNano(),
+		}
+		if err = node.Save(record); err != nil {
+			return err
+		}
+	}
+	return node.Commit()
+}
+
+// mempoolTxs returns the transactions that left the mempool since the time.
+func (db *BoltDb) mempoolTxs(since time.Time) ([]mempool.MempoolTx, error) {
+	var records []mempoolTxRecord
+	err := db.sdb.From(mempoolTxTable).Range("Time", since.UnixNano(), int64(math.MaxInt64), &records)
+	if err = ignoreNotFound(err); err != nil {
+		return nil, err
+	}
+	txs := make([]mempool.MempoolTx, len(records))
+	for i := range records {
+		txs[i] = records[i].mempoolTx()
+	}
+	return txs, nil
+}
+
+func (db *BoltDb) ConfirmationLatency(ctx context.Context, since time.Time) ([]mempool.LatencyStats, error) {
+	if db == nil || db.sdb == nil {
+		return nil, errDef
+	}
+	txs, err := db.mempoolTxs(since)
+	if err != nil {
+		return nil, err
+	}
+	return mempool.ConfirmationLatencyStats(txs), nil
+}
+
+// UpdateMempoolAggregateData is a no-op, the mempool bins are computed on
+// read.
+func (db *BoltDb) UpdateMempoolAggregateData(ctx context.Context) error {
+	return nil
+}
+
+// LastMempoolBlockHeight returns sql.ErrNoRows as the block height is not
+// kept with the mempool entries.
+func (db *BoltDb) LastMempoolBlockHeight() (height int64, err error) {
+	return 0, sql.ErrNoRows
+}
+
+func (db *BoltDb) LastMempoolTime() (entryTime time.Time, err error) {
+	err = db.LastEntry(context.Background(), mempoolTable, &entryTime)
+	return
+}
+
+func (db *BoltDb) MempoolCount(ctx context.Context) (int64, error) {
+	return db.count(mempoolTable, &mempoolRecord{})
+}
+
+func (db *BoltDb) Mempools(ctx context.Context, offtset int, limit int) ([]mempool.Dto, error) {
+	if db == nil || db.sdb == nil {
+		return nil, errDef
+	}
+	var records []mempoolRecord
+	err := db.sdb.From(mempoolTable).Select().Reverse().Skip(offtset).Limit(limit).Find(&records)
+	if err = ignoreNotFound(err); err != nil {
+		return nil, err
+	}
+	var result []mempool.Dto
+	for _, m := range records {
+		result = append(result, mempool.Dto{
+			TotalFee:             m.TotalFee,
+			FirstSeenTime:        time.Unix(0, m.FirstSeenTime).UTC().Format(dbhelper.DateTemplate),
+			Total:                m.Total,
+			Voters:               m.Voters,
+			Tickets:              m.Tickets,
+			Revocations:          m.Revocations,
+			Time:                 time.Unix(0, m.Time).UTC().Format(dbhelper.DateTemplate),
+			Size:                 m.Size,
+			NumberOfTransactions: m.NumberOfTransactions,
+		})
+	}
+	return result, nil
+}
+
+// *****CHARTS GETTER******* //
+
+func (db *BoltDb) FetchEncodeChart(ctx context.Context, dataType, binString string) ([]byte, error) {
+	if db == nil || db.sdb == nil {
+		return nil, errDef
+	}
+	if txType, ok := mempool.ParseTypeChart(dataType); ok {
+		return db.fetchEncodeType(txType, binString)
+	}
+	if dataType == MempoolFeeRates {
+		return db.fetchEncodeFeeRates(binString)
+	}
+	if dataType == MempoolLatency {
+		return db.fetchEncodeLatency(binString)
+	}
+
+	var value func(m *mempoolRecord) float64
+	switch dataType {
+	case MempoolSize:
+		value = func(m *mempoolRecord) float64 { return float64(m.Size) }
+	case MempoolFees:
+		value = func(m *mempoolRecord) float64 { return m.TotalFee }
+	case MempoolTxCount:
+		value = func(m *mempoolRecord) float64 { return float64(m.NumberOfTransactions) }
+	default:
+		return nil, chart.UnknownChartErr
+	}
+
+	var records []mempoolRecord
+	if err := ignoreNotFound(db.sdb.From(mempoolTable).All(&records)); err != nil {
+		return nil, err
+	}
+
+	var dates chart.ChartUints
+	var uints chart.ChartUints
+	var floats chart.ChartFloats
+	add := func(t int64, v float64) {
+		dates = append(dates, uint64(t))
+		if dataType == MempoolFees {
+			floats = append(floats, v)
+		} else {
+			uints = append(uints, uint64(math.Round(v)))
+		}
+	}
+
+	if binString == string(chart.DefaultBin) {
+		for i := range records {
+			add(time.Unix(0, records[i].Time).Unix(), value(&records[i]))
+		}
+	} else {
+		bins, err := completeBins(len(records), func(i int) int64 {
+			return time.Unix(0, records[i].Time).Unix()
+		}, binString)
+		if err != nil {
+			return nil, err
+		}
+		for _, b := range bins {
+			add(b.start, b.avg(func(i int) float64 { return value(&records[i]) }))
+		}
+	}
+
+	if dataType == MempoolFees {
+		return chart.Encode(nil, dates, floats)
+	}
+	return chart.Encode(nil, dates, uints)
+}
+
+// fetchEncodeFeeRates encodes the fee-rates chart of the records that have a
+// fee rate distribution. The binned percentiles and bucket sizes are the
+// averages of the records of the bin.
+func (db *BoltDb) fetchEncodeFeeRates(binString string) ([]byte, error) {
+	var all []mempoolRecord
+	if err := ignoreNotFound(db.sdb.From(mempoolTable).All(&all)); err != nil {
+		return nil, err
+	}
+	var records []mempoolRecord
+	for _, m := range all {
+		if len(m.FeeRates.Buckets) > 0 {
+			records = append(records, m)
+		}
+	}
+
+	var dates chart.ChartUints
+	var rates []mempool.FeeRates
+	if binString == string(chart.DefaultBin) {
+		for _, m := range records {
+			dates = append(dates, uint64(time.Unix(0, m.Time).Unix()))
+			rates = append(rates, m.FeeRates)
+		}
+		return mempool.EncodeFeeRatesChart(dates, rates)
+	}
+
+	bins, err := completeBins(len(records), func(i int) int64 {
+		return time.Unix(0, records[i].Time).Unix()
+	}, binString)
+	if err != nil {
+		return nil, err
+	}
+	for _, b := range bins {
+		avg := func(value func(r *mempool.FeeRates) int64) int64 {
+			return int64(math.Round(b.avg(func(i int) float64 { return float64(value(&records[i].FeeRates)) })))
+		}
+		binned := mempool.FeeRates{
+			P10: avg(func(r *mempool.FeeRates) int64 { return r.P10 }),
+			P50: avg(func(r *mempool.FeeRates) int64 { return r.P50 }),
+			P90: avg(func(r *mempool.FeeRates) int64 { return r.P90 }),
+		}
+		for j, bucket := range records[b.first].FeeRates.Buckets {
+			value := func(r *mempool.FeeRates) int64 {
+				if j < len(r.Buckets) {
+					return r.Buckets[j].Size
+				}
+				return 0
+			}
+			binned.Buckets = append(binned.Buckets, mempool.FeeRateBucket{
+				FeeRate: bucket.FeeRate,
+				Size:    avg(value),
+			})
+		}
+		dates = append(dates, uint64(b.start))
+		rates = append(rates, binned)
+	}
+	return mempool.EncodeFeeRatesChart(dates, rates)
+}
+
+// fetchEncodeLatency encodes the confirmation-latency chart, the median
+// latencies per block for the default bin.
+func (db *BoltDb) fetchEncodeLatency(binString string) ([]byte, error) {
+	txs, err := db.mempoolTxs(time.Time{})
+	if err != nil {
+		return nil, err
+	}
+	if binString == string(chart.DefaultBin) {
+		return mempool.EncodeLatencyChart(mempool.MedianLatencies(txs, func(tx *mempool.MempoolTx) (int64, bool) {
+			return tx.Time.Unix(), true
+		}))
+	}
+
+	current, err := binStart(time.Now(), binString)
+	if err != nil {
+		return nil, err
+	}
+	return mempool.EncodeLatencyChart(mempool.MedianLatencies(txs, func(tx *mempool.MempoolTx) (int64, bool) {
+		start, _ := binStart(tx.Time, binString)
+		return start, start < current
+	}))
+}
+
+// fetchEncodeType encodes the chart of the mempool transactions of a type,
+// from the records that have the breakdown by type.
+func (db *BoltDb) fetchEncodeType(txType, binString string) ([]byte, error) {
+	var all []mempoolRecord
+	if err := ignoreNotFound(db.sdb.From(mempoolTable).All(&all)); err != nil {
+		return nil, err
+	}
+	var times []int64
+	var stats []mempool.TypeStats
+	for _, m := range all {
+		for _, t := range m.Types {
+			if t.Type == txType {
+				times = append(times, time.Unix(0, m.Time).Unix())
+				stats = append(stats, t)
+				break
+			}
+		}
+	}
+
+	if binString == string(chart.DefaultBin) {
+		dates := make(chart.ChartUints, len(times))
+		for i, t := range times {
+			dates[i] = uint64(t)
+		}
+		return mempool.EncodeTypeChart(dates, stats)
+	}
+
+	bins, err := completeBins(len(stats), func(i int) int64 { return times[i] }, binString)
+	if err != nil {
+		return nil, err
+	}
+	var dates chart.ChartUints
+	var binned []mempool.TypeStats
+	for _, b := range bins {
+		dates = append(dates, uint64(b.start))
+		binned = append(binned, mempool.TypeStats{
+			Type:  txType,
+			Count: int(math.Round(b.avg(func(i int) float64 { return float64(stats[i].Count) }))),
+			Size:  int64(math.Round(b.avg(func(i int) float64 { return float64(stats[i].Size) }))),
+			Fees:  b.avg(func(i int) float64 { return stats[i].Fees }),
+			Total: b.avg(func(i int) float64 { return stats[i].Total }),
+		})
+	}
+	return mempool.EncodeTypeChart(dates, binned)
+}
@@ -0,0 +1,1002 @@
+package boltdb
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net"
+	"sort"
+	"strings"
+
+	"github.com/asdine/storm/v3"
+	"github.com/asdine/storm/v3/q"
+	"github.com/planetdecred/pdanalytics/chart"
+	"github.com/planetdecred/pdanalytics/netsnapshot"
+)
+
+type snapshotRecord struct {
+	Timestamp           int64 `storm:"id"`
+	Height              int64
+	NodeCount           int
+	ReachableNodes      int
+	OldestNode          string
+	OldestNodeTimestamp int64
+	Latency             int
+}
+
+// heartbeatRecord is a heartbeat of a node in a snapshot, keyed by the
+// snapshot timestamp and the node address.
+type heartbeatRecord struct {
+	ID            string `storm:"id"`
+	Timestamp     int64  `storm:"index"`
+	NodeID        string `storm:"index"`
+	LastSeen      int64
+	Latency       int
+	CurrentHeight int64
+}
+
+type nodeRecord struct {
+	Address         string `storm:"id"`
+	IPVersion       int
+	Country         string
+	Region          string
+	City            string
+	Zip             string
+	LastAttempt     int64
+	LastSeen        int64
+	LastSuccess     int64
+	FailureCount    int
+	IsDead          bool `storm:"index"`
+	ConnectionTime  int64
+	ProtocolVersion int
+	UserAgent       string
+	Services        string
+	StartingHeight  int64
+	CurrentHeight   int64
+}
+
+// nodeVersionRecord and nodeLocationRecord are the node counts of a user
+// agent or a country in a snapshot, the default bin of the node version and
+// location charts. The other bins are computed on read.
+type nodeVersionRecord struct {
+	ID        string `storm:"id"`
+	Timestamp int64  `storm:"index"`
+	Height    int64
+	UserAgent string `storm:"index"`
+	NodeCount int
+}
+
+type nodeLocationRecord struct {
+	ID        string `storm:"id"`
+	Timestamp int64  `storm:"index"`
+	Height    int64
+	Country   string `storm:"index"`
+	NodeCount int
+}
+
+func snapshotKey(timestamp int64, value string) string {
+	return fmt.Sprintf("%020d:%s", timestamp, value)
+}
+
+func (r *snapshotRecord) toSnapshot() *netsnapshot.SnapShot {
+	return &netsnapshot.SnapShot{
+		Timestamp:           r.Timestamp,
+		Height:              r.Height,
+		NodeCount:           r.NodeCount,
+		ReachableNodeCount:  r.ReachableNodes,
+		OldestNode:          r.OldestNode,
+		OldestNodeTimestamp: r.OldestNodeTimestamp,
+		Latency:             r.Latency,
+	}
+}
+
+func (n *nodeRecord) toNetworkPeer() *netsnapshot.NetworkPeer {
+	peer := &netsnapshot.NetworkPeer{
+		Address:         n.Address,
+		LastSeen:        n.LastSeen,
+		ConnectionTime:  n.ConnectionTime,
+		ProtocolVersion: uint32(n.ProtocolVersion),
+		UserAgent:       n.UserAgent,
+		StartingHeight:  n.StartingHeight,
+		CurrentHeight:   n.CurrentHeight,
+		Services:        n.Services,
+		IsDead:          n.IsDead,
+	}
+	peer.IPInfo = netsnapshot.IPInfo{
+		CountryName: n.Country,
+		RegionName:  n.Region,
+		City:        n.City,
+		Zip:         n.Zip,
+	}
+	return peer
+}
+
+func (db *BoltDb) heartbeats(timestamp int64) ([]heartbeatRecord, error) {
+	var records []heartbeatRecord
+	err := db.sdb.From(heartbeatTable).Find("Timestamp", timestamp, &records)
+	return records, ignoreNotFound(err)
+}
+
+func (db *BoltDb) SaveSnapshot(ctx context.Context, snapshot netsnapshot.SnapShot) error {
+	if db == nil || db.sdb == nil {
+		return errDef
+	}
+	heartbeats, err := db.heartbeats(snapshot.Timestamp)
+	if err != nil {
+		return err
+	}
+	snapshot.ReachableNodeCount = len(heartbeats)
+
+	var totalLatency, latencyCount int
+	for _, h := range heartbeats {
+		if h.Latency > 0 {
+			totalLatency += h.Latency
+			latencyCount++
+		}
+		if snapshot.OldestNodeTimestamp != 0 {
+			continue
+		}
+		var node nodeRecord
+		if err = db.sdb.From(nodeTable).One("Address", h.NodeID, &node); err != nil {
+			if err = ignoreNotFound(err); err != nil {
+				return err
+			}
+			continue
+		}
+		if snapshot.OldestNode == "" || node.ConnectionTime > snapshot.OldestNodeTimestamp {
+			snapshot.OldestNode = node.Address
+			snapshot.OldestNodeTimestamp = node.ConnectionTime
+		}
+	}
+	if latencyCount > 0 {
+		snapshot.Latency = totalLatency / latencyCount
+	}
+
+	return db.sdb.From(networkSnapshotTable).Save(&snapshotRecord{
+		Timestamp:           snapshot.Timestamp,
+		Height:              snapshot.Height,
+		NodeCount:           snapshot.NodeCount,
+		ReachableNodes:      snapshot.ReachableNodeCount,
+		OldestNode:          snapshot.OldestNode,
+		OldestNodeTimestamp: snapshot.OldestNodeTimestamp,
+		Latency:             snapshot.Latency,
+	})
+}
+
+func (db *BoltDb) FindNetworkSnapshot(ctx context.Context, timestamp int64) (*netsnapshot.SnapShot, error) {
+	if db == nil || db.sdb == nil {
+		return nil, errDef
+	}
+	var record snapshotRecord
+	if err := db.sdb.From(networkSnapshotTable).One("Timestamp", timestamp, &record); err != nil {
+		return nil, err
+	}
+	return record.toSnapshot(), nil
+}
+
+// adjacentSnapshot returns the first snapshot matching the matcher, in
+// timestamp order or in reverse when reverse is true.
+func (db *BoltDb) adjacentSnapshot(matcher q.Matcher, reverse bool) (*netsnapshot.SnapShot, error) {
+	if db == nil || db.sdb == nil {
+		return nil, errDef
+	}
+	query := db.sdb.From(networkSnapshotTable).Select(matcher).Limit(1)
+	if reverse {
+		query = query.Reverse()
+	}
+	var records []snapshotRecord
+	if err := query.Find(&records); err != nil {
+		return nil, err
+	}
+	return records[0].toSnapshot(), nil
+}
+
+func (db *BoltDb) PreviousSnapshot(ctx context.Context, timestamp int64) (*netsnapshot.SnapShot, error) {
+	return db.adjacentSnapshot(q.Lt("Timestamp", timestamp), true)
+}
+
+func (db *BoltDb) NextSnapshot(ctx context.Context, timestamp int64) (*netsnapshot.SnapShot, error) {
+	return db.adjacentSnapshot(q.Gt("Timestamp", timestamp), false)
+}
+
+func (db *BoltDb) SnapshotCount(ctx context.Context) (int64, error) {
+	return db.count(networkSnapshotTable, &snapshotRecord{})
+}
+
+func (db *BoltDb) Snapshots(ctx context.Context, offset, limit int, forChart bool) ([]netsnapshot.SnapShot, int64, error) {
+	if db == nil || db.sdb == nil {
+		return nil, 0, errDef
+	}
+	query := db.sdb.From(networkSnapshotTable).Select(q.Gt("Height", 0)).Skip(offset)
+	if !forChart {
+		query = query.Limit(limit).Reverse()
+	}
+	var records []snapshotRecord
+	if err := ignoreNotFound(query.Find(&records)); err != nil {
+		return nil, 0, err
+	}
+	snapshots := make([]netsnapshot.SnapShot, len(records))
+	for i := range records {
+		snapshots[i] = *records[i].toSnapshot()
+	}
+
+	total, err := db.sdb.From(networkSnapshotTable).Select(q.Gt("Height", 0)).Count(&snapshotRecord{})
+	if err = ignoreNotFound(err); err != nil {
+		return nil, 0, err
+	}
+	return snapshots, int64(total), nil
+}
+
+func (db *BoltDb) SnapshotsByTime(ctx context.Context, startDate int64, pageSize int) ([]netsnapshot.SnapShot, error) {
+	if db == nil || db.sdb == nil {
+		return nil, errDef
+	}
+	query := db.sdb.From(networkSnapshotTable).Select(q.Gt("Height", 0), q.Gt("Timestamp", startDate))
+	if pageSize > 0 {
+		query = query.Limit(pageSize)
+	}
+	var records []snapshotRecord
+	if err := ignoreNotFound(query.Find(&records)); err != nil {
+		return nil, err
+	}
+	snapshots := make([]netsnapshot.SnapShot, len(records))
+	for i, r := range records {
+		snapshots[i] = netsnapshot.SnapShot{
+			Timestamp:          r.Timestamp,
+			Height:             r.Height,
+			NodeCount:          r.NodeCount,
+			ReachableNodeCount: r.ReachableNodes,
+		}
+	}
+	return snapshots, nil
+}
+
+func (db *BoltDb) SnapshotsByBin(ctx context.Context, bin string) ([]netsnapshot.SnapShot, error) {
+	if db == nil || db.sdb == nil {
+		return nil, errDef
+	}
+	var records []snapshotRecord
+	if err := ignoreNotFound(db.sdb.From(networkSnapshotTable).All(&records)); err != nil {
+		return nil, err
+	}
+	bins, err := completeBins(len(records), func(i int) int64 { return records[i].Timestamp }, bin)
+	if err != nil {
+		return nil, err
+	}
+	snapshots := make([]netsnapshot.SnapShot, len(bins))
+	for i, b := range bins {
+		snapshots[i] = netsnapshot.SnapShot{
+			Timestamp: b.start,
+			Height:    b.max(func(i int) int64 { return records[i].Height }),
+			NodeCount: int(math.Round(b.avg(func(i int) float64 { return float64(records[i].NodeCount) }))),
+			ReachableNodeCount: int(math.Round(b.avg(func(i int) float64 {
+				return float64(records[i].ReachableNodes)
+			}))),
+		}
+	}
+	return snapshots, nil
+}
+
+func (db *BoltDb) DeleteSnapshot(ctx context.Context, timestamp int64) {
+	if db == nil || db.sdb == nil {
+		return
+	}
+	var snapshot snapshotRecord
+	if err := db.sdb.From(networkSnapshotTable).One("Timestamp", timestamp, &snapshot); err != nil {
+		return
+	}
+	_ = db.sdb.From(heartbeatTable).Select(q.Eq("Timestamp", timestamp)).Delete(&heartbeatRecord{})
+	_ = db.sdb.From(networkSnapshotTable).DeleteStruct(&snapshot)
+}
+
+func (db *BoltDb) SaveHeartbeat(ctx context.Context, heartbeat netsnapshot.Heartbeat) error {
+	if db == nil || db.sdb == nil {
+		return errDef
+	}
+	id := snapshotKey(heartbeat.Timestamp, heartbeat.Address)
+	var record heartbeatRecord
+	err := db.sdb.From(heartbeatTable).One("ID", id, &record)
+	if err == nil {
+		if heartbeat.CurrentHeight > 0 {
+			record.CurrentHeight = heartbeat.CurrentHeight
+		}
+		if heartbeat.Latency > 0 {
+			record.Latency = heartbeat.Latency
+		}
+		if heartbeat.LastSeen > 0 {
+			record.LastSeen = heartbeat.LastSeen
+		}
+	} else if err == storm.ErrNotFound {
+		record = heartbeatRecord{
+			ID:            id,
+			Timestamp:     heartbeat.Timestamp,
+			NodeID:        heartbeat.Address,
+			LastSeen:      heartbeat.LastSeen,
+			Latency:       heartbeat.Latency,
+			CurrentHeight: heartbeat.CurrentHeight,
+		}
+	} else {
+		return err
+	}
+
+	if err = db.sdb.From(heartbeatTable).Save(&record); err != nil {
+		return fmt.Errorf("error in saving hearbeat, %s", err.Error())
+	}
+	return nil
+}
+
+func (db *BoltDb) node(address string) (*nodeRecord, error) {
+	if db == nil || db.sdb == nil {
+		return nil, errDef
+	}
+	var node nodeRecord
+	if err := db.sdb.From(nodeTable).One("Address", address, &node); err != nil {
+		return nil, err
+	}
+	return &node, nil
+}
+
+func (db *BoltDb) AttemptPeer(ctx context.Context, address string, now int64) error {
+	node, err := db.node(address)
+	if err != nil {
+		return ignoreNotFound(err)
+	}
+	node.LastAttempt = now
+	return db.sdb.From(nodeTable).Save(node)
+}
+
+// RecordNodeConnectionFailure increase the number of failare for the specified node
+// and mark the node as dead if the maxAllowedFailure is reached
+func (db *BoltDb) RecordNodeConnectionFailure(ctx context.Context, address string, maxAllowedFailure int) error {
+	node, err := db.node(address)
+	if err != nil {
+		return ignoreNotFound(err)
+	}
+	node.FailureCount++
+	if node.FailureCount >= maxAllowedFailure {
+		node.IsDead = true
+	}
+	return db.sdb.From(nodeTable).Save(node)
+}
+
+func (db *BoltDb) NodeExists(ctx context.Context, address string) (bool, error) {
+	_, err := db.node(address)
+	if err == storm.ErrNotFound {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (db *BoltDb) FindNode(ctx context.Context, address string) (*netsnapshot.NetworkPeer, error) {
+	n, err := db.node(address)
+	if err != nil {
+		return nil, err
+	}
+	peer := n.toNetworkPeer()
+	peer.LastSuccess = n.LastSuccess
+	peer.IPVersion = n.IPVersion
+	peer.LastAttempt = n.LastAttempt
+	return peer, nil
+}
+
+// SaveNode inserts the new node information. The node is marked as alive by default
+func (db *BoltDb) SaveNode(ctx context.Context, peer netsnapshot.NetworkPeer) error {
+	if db == nil || db.sdb == nil {
+		return errDef
+	}
+	if exists, err := db.NodeExists(ctx, peer.Address); err != nil {
+		return err
+	} else if exists {
+		return fmt.Errorf("node %s already exists", peer.Address)
+	}
+	return db.sdb.From(nodeTable).Save(&nodeRecord{
+		Address:         peer.Address,
+		IPVersion:       peer.IPVersion,
+		Country:         peer.CountryName,
+		Region:          peer.RegionName,
+		City:            peer.City,
+		Zip:             peer.Zip,
+		LastAttempt:     peer.LastSeen,
+		LastSeen:        peer.LastSeen,
+		LastSuccess:     peer.LastSuccess,
+		ConnectionTime:  peer.ConnectionTime,
+		ProtocolVersion: int(peer.ProtocolVersion),
+		UserAgent:       peer.UserAgent,
+		Services:        peer.Services,
+		StartingHeight:  peer.StartingHeight,
+		CurrentHeight:   peer.CurrentHeight,
+	})
+}
+
+// UpdateNode updates the node information in the database
+//
+// It reset the node's failure count and marks it as alive
+func (db *BoltDb) UpdateNode(ctx context.Context, peer netsnapshot.NetworkPeer) error {
+	node, err := db.node(peer.Address)
+	if err != nil {
+		return fmt.Errorf("update failed: %s", err.Error())
+	}
+	node.LastAttempt = peer.LastAttempt
+	node.LastSeen = peer.LastSeen
+	node.LastSuccess = peer.LastSuccess
+	node.Services = peer.Services
+	node.StartingHeight = peer.StartingHeight
+	node.UserAgent = peer.UserAgent
+	node.CurrentHeight = peer.CurrentHeight
+	node.IsDead = false
+	node.FailureCount = 0
+	if node.Country == "" {
+		node.Country = peer.CountryName
+		node.Region = peer.RegionName
+		node.City = peer.City
+		node.Zip = peer.Zip
+		node.IPVersion = peer.IPVersion
+	}
+	if node.ConnectionTime == 0 {
+		node.ConnectionTime = peer.ConnectionTime
+	}
+	return db.sdb.From(nodeTable).Save(node)
+}
+
+// snapshotNodes returns the nodes with a heartbeat in the snapshot.
+func (db *BoltDb) snapshotNodes(timestamp int64) ([]nodeRecord, error) {
+	heartbeats, err := db.heartbeats(timestamp)
+	if err != nil {
+		return nil, err
+	}
+	var nodes []nodeRecord
+	for _, h := range heartbeats {
+		node, err := db.node(h.NodeID)
+		if err != nil {
+			if err = ignoreNotFound(err); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		nodes = append(nodes, *node)
+	}
+	return nodes, nil
+}
+
+func (db *BoltDb) NetworkPeers(ctx context.Context, timestamp int64, q string, offset int,
+	limit int) ([]netsnapshot.NetworkPeer, int64, error) {
+	nodes, err := db.snapshotNodes(timestamp)
+	if err != nil {
+		return nil, 0, err
+	}
+	var matches []nodeRecord
+	for _, node := range nodes {
+		if q == "" || node.Address == q || node.UserAgent == q || node.Country == q {
+			matches = append(matches, node)
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool { return matches[i].LastSeen > matches[j].LastSeen })
+
+	var peers []netsnapshot.NetworkPeer
+	for i := offset; i < len(matches) && i < offset+limit; i++ {
+		peers = append(peers, *matches[i].toNetworkPeer())
+	}
+	return peers, int64(len(matches)), nil
+}
+
+func (db *BoltDb) GetAvailableNodes(ctx context.Context) ([]net.IP, error) {
+	if db == nil || db.sdb == nil {
+		return nil, errDef
+	}
+	var nodes []nodeRecord
+	err := db.sdb.From(nodeTable).Find("IsDead", false, &nodes)
+	if err = ignoreNotFound(err); err != nil {
+		return nil, err
+	}
+	var peers = make([]net.IP, 0, len(nodes))
+	for _, node := range nodes {
+		peers = append(peers, net.ParseIP(node.Address))
+	}
+	return peers, nil
+}
+
+func (db *BoltDb) NetworkPeer(ctx context.Context, address string) (*netsnapshot.NetworkPeer, error) {
+	node, err := db.node(address)
+	if err != nil {
+		return nil, err
+	}
+	return node.toNetworkPeer(), nil
+}
+
+func averageLatency(heartbeats []heartbeatRecord) int {
+	var total, count int
+	for _, h := range heartbeats {
+		if h.Latency > 0 {
+			total += h.Latency
+			count++
+		}
+	}
+	if count == 0 {
+		return 0
+	}
+	return total / count
+}
+
+func (db *BoltDb) AverageLatency(ctx context.Context, address string) (int, error) {
+	if db == nil || db.sdb == nil {
+		return 0, errDef
+	}
+	var heartbeats []heartbeatRecord
+	err := db.sdb.From(heartbeatTable).Find("NodeID", address, &heartbeats)
+	if err = ignoreNotFound(err); err != nil {
+		return 0, err
+	}
+	return averageLatency(heartbeats), nil
+}
+
+func (db *BoltDb) GetIPLocation(ctx context.Context, ip string) (string, int, error) {
+	node, err := db.node(ip)
+	if err != nil {
+		return "", -1, err
+	}
+	return node.Country, node.IPVersion, nil
+}
+
+func (db *BoltDb) TotalPeerCount(ctx context.Context, timestamp int64) (int64, error) {
+	if db == nil || db.sdb == nil {
+		return 0, errDef
+	}
+	count, err := db.sdb.From(heartbeatTable).Select(q.Eq("Timestamp", timestamp)).Count(&heartbeatRecord{})
+	return int64(count), ignoreNotFound(err)
+}
+
+func (db *BoltDb) SeenNodesByTimestamp(ctx context.Context) ([]netsnapshot.NodeCount, error) {
+	if db == nil || db.sdb == nil {
+		return nil, errDef
+	}
+	var heartbeats []heartbeatRecord
+	if err := ignoreNotFound(db.sdb.From(heartbeatTable).All(&heartbeats)); err != nil {
+		return nil, err
+	}
+	// The heartbeats are keyed by timestamp first, so they are in order.
+	var result []netsnapshot.NodeCount
+	for _, h := range heartbeats {
+		if last := len(result) - 1; last >= 0 && result[last].Timestamp == h.Timestamp {
+			result[last].Count++
+			continue
+		}
+		result = append(result, netsnapshot.NodeCount{Timestamp: h.Timestamp, Count: 1})
+	}
+	return result, nil
+}
+
+// peerGroup is the number of nodes of a snapshot sharing a value, the user
+// agent or the country.
+type peerGroup struct {
+	timestamp int64
+	height    int64
+	value     string
+	nodes     int64
+}
+
+// peerGroups groups the nodes of the snapshots after startDate by the value
+// returned by key, ordered by timestamp then by node count. Only the values in
+// sources are counted when sources is not empty, "Unknown" being the empty
+// value.
+func (db *BoltDb) peerGroups(startDate int64, key func(*nodeRecord) string, sources ...string) ([]peerGroup, error) {
+	if db == nil || db.sdb == nil {
+		return nil, errDef
+	}
+	var wanted map[string]bool
+	if len(sources) > 0 {
+		wanted = make(map[string]bool, len(sources))
+		for _, source := range sources {
+			wanted[strings.ReplaceAll(source, "Unknown", "")] = true
+		}
+	}
+
+	var snapshots []snapshotRecord
+	err := db.sdb.From(networkSnapshotTable).Select(q.Gt("Timestamp", startDate)).Find(&snapshots)
+	if err = ignoreNotFound(err); err != nil {
+		return nil, err
+	}
+
+	var groups []peerGroup
+	for _, snapshot := range snapshots {
+		nodes, err := db.snapshotNodes(snapshot.Timestamp)
+		if err != nil {
+			return nil, err
+		}
+		counts := make(map[string]int64)
+		for i := range nodes {
+			value := key(&nodes[i])
+			if wanted == nil || wanted[value] {
+				counts[value]++
+			}
+		}
+		first := len(groups)
+		for value, count := range counts {
+			groups = append(groups, peerGroup{
+				timestamp: snapshot.Timestamp,
+				height:    snapshot.Height,
+				value:     value,
+				nodes:     count,
+			})
+		}
+		snapshotGroups := groups[first:]
+		sort.Slice(snapshotGroups, func(i, j int) bool {
+			if snapshotGroups[i].nodes != snapshotGroups[j].nodes {
+				return snapshotGroups[i].nodes > snapshotGroups[j].nodes
+			}
+			return snapshotGroups[i].value < snapshotGroups[j].value
+		})
+	}
+	return groups, nil
+}
+
+// splitSources splits the "|" separated sources.
+func splitSources(sources string) []string {
+	if len(strings.Trim(sources, "")) == 0 {
+		return nil
+	}
+	return strings.Split(sources, "|")
+}
+
+// pageGroups returns the page of groups, all of them when limit is -1.
+func pageGroups(groups []peerGroup, offset, limit int) []peerGroup {
+	if limit == -1 {
+		return groups
+	}
+	if offset > len(groups) {
+		offset = len(groups)
+	}
+	end := len(groups)
+	if limit >= 0 && offset+limit < end {
+		end = offset + limit
+	}
+	return groups[offset:end]
+}
+
+func unknownIfEmpty(value string) string {
+	if strings.Trim(value, " ") == "" {
+		return "Unknown"
+	}
+	return value
+}
+
+func (db *BoltDb) PeerCountByUserAgents(ctx context.Context, sources string, offset, limit int) ([]netsnapshot.UserAgentInfo, int64, error) {
+	groups, err := db.peerGroups(0, func(n *nodeRecord) string { return n.UserAgent }, splitSources(sources)...)
+	if err != nil {
+		return nil, 0, err
+	}
+	count := len(groups)
+	page := pageGroups(groups, offset, limit)
+	userAgents := make([]netsnapshot.UserAgentInfo, len(page))
+	for i, item := range page {
+		userAgents[i] = netsnapshot.UserAgentInfo{
+			UserAgent: unknownIfEmpty(item.value),
+			Nodes:     item.nodes,
+			Timestamp: item.timestamp,
+		}
+	}
+	return userAgents, int64(count), nil
+}
+
+func (db *BoltDb) PeerCountByCountries(ctx context.Context, sources string, offset, limit int) ([]netsnapshot.CountryInfo, int64, error) {
+	groups, err := db.peerGroups(0, func(n *nodeRecord) string { return n.Country }, splitSources(sources)...)
+	if err != nil {
+		return nil, 0, err
+	}
+	count := len(groups)
+	page := pageGroups(groups, offset, limit)
+	countries := make([]netsnapshot.CountryInfo, len(page))
+	for i, item := range page {
+		countries[i] = netsnapshot.CountryInfo{
+			Country:   unknownIfEmpty(item.value),
+			Nodes:     item.nodes,
+			Timestamp: item.timestamp,
+		}
+	}
+	return countries, int64(count), nil
+}
+
+func (db *BoltDb) PeerCountByIPVersion(ctx context.Context, timestamp int64, iPVersion int) (int64, error) {
+	nodes, err := db.snapshotNodes(timestamp)
+	if err != nil {
+		return 0, err
+	}
+	var total int64
+	for _, node := range nodes {
+		if node.IPVersion == iPVersion {
+			total++
+		}
+	}
+	return total, nil
+}
+
+func (db *BoltDb) LastSnapshotTime(ctx context.Context) (timestamp int64) {
+	if db == nil || db.sdb == nil {
+		return
+	}
+	var records []snapshotRecord
+	err := db.sdb.From(networkSnapshotTable).Select(q.Gt("Height", 0)).Reverse().Limit(1).Find(&records)
+	if err == nil {
+		timestamp = records[0].Timestamp
+	}
+	return
+}
+
+func (db *BoltDb) LastSnapshot(ctx context.Context) (*netsnapshot.SnapShot, error) {
+	return db.FindNetworkSnapshot(ctx, db.LastSnapshotTime(ctx))
+}
+
+// distinctNodeValues returns the distinct values of the nodes returned by
+// key, in ascending order.
+func (db *BoltDb) distinctNodeValues(key func(*nodeRecord) string) ([]string, error) {
+	if db == nil || db.sdb == nil {
+		return nil, errDef
+	}
+	var nodes []nodeRecord
+	if err := ignoreNotFound(db.sdb.From(nodeTable).All(&nodes)); err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool)
+	var values []string
+	for i := range nodes {
+		if value := key(&nodes[i]); !seen[value] {
+			seen[value] = true
+			values = append(values, value)
+		}
+	}
+	sort.Strings(values)
+	return values, nil
+}
+
+func (db *BoltDb) AllNodeVersions(ctx context.Context) ([]string, error) {
+	versions, err := db.distinctNodeValues(func(n *nodeRecord) string { return n.UserAgent })
+	sort.Sort(sort.Reverse(sort.StringSlice(versions)))
+	return versions, err
+}
+
+func (db *BoltDb) AllNodeContries(ctx context.Context) ([]string, error) {
+	return db.distinctNodeValues(func(n *nodeRecord) string { return n.Country })
+}
+
+// UpdateSnapshotNodesBin stores the default bin of the node versions and
+// locations of the snapshots taken since the last update. The snapshot, node
+// version and location bins are computed on read.
+func (db *BoltDb) UpdateSnapshotNodesBin(ctx context.Context) error {
+	if db == nil || db.sdb == nil {
+		return errDef
+	}
+	log.Info("Updating snapshot node bin data")
+
+	// The records are keyed by timestamp first, the last one is the most
+	// recent.
+	var lastVersion []nodeVersionRecord
+	err := db.sdb.From(nodeVersionTable).Select().Reverse().Limit(1).Find(&lastVersion)
+	if err = ignoreNotFound(err); err != nil {
+		return err
+	}
+	var lastEntry int64
+	if len(lastVersion) > 0 {
+		lastEntry = lastVersion[0].Timestamp
+	}
+	log.Info("Updating snapshot node versions")
+	err = db.updateNodeCounts(ctx, nodeVersionTable, lastEntry,
+		func(n *nodeRecord) string { return n.UserAgent },
+		func(g peerGroup) interface{} {
+			return &nodeVersionRecord{
+				ID:        snapshotKey(g.timestamp, g.value),
+				Timestamp: g.timestamp,
+				Height:    g.height,
+				UserAgent: g.value,
+				NodeCount: int(g.nodes),
+			}
+		})
+	if err != nil {
+		return err
+	}
+
+	var lastLocation []nodeLocationRecord
+	err = db.sdb.From(nodeLocationTable).Select().Reverse().Limit(1).Find(&lastLocation)
+	if err = ignoreNotFound(err); err != nil {
+		return err
+	}
+	lastEntry = 0
+	if len(lastLocation) > 0 {
+		lastEntry = lastLocation[0].Timestamp
+	}
+	log.Info("Updating snapshot node locations")
+	return db.updateNodeCounts(ctx, nodeLocationTable, lastEntry,
+		func(n *nodeRecord) string { return n.Country },
+		func(g peerGroup) interface{} {
+			return &nodeLocationRecord{
+				ID:        snapshotKey(g.timestamp, g.value),
+				Timestamp: g.timestamp,
+				Height:    g.height,
+				Country:   g.value,
+				NodeCount: int(g.nodes),
+			}
+		})
+}
+
+// updateNodeCounts stores a record, made by toRecord, per value returned by
+// key for each snapshot after lastEntry. Like the postgres default bin, a
+// value missing in a snapshot is stored with a zero count.
+func (db *BoltDb) updateNodeCounts(ctx context.Context, table string, lastEntry int64,
+	key func(*nodeRecord) string, toRecord func(peerGroup) interface{}) error {
+	groups, err := db.peerGroups(lastEntry, key)
+	if err != nil {
+		return err
+	}
+
+	var values []string
+	seen := make(map[string]bool)
+	counts := make(map[int64]map[string]peerGroup)
+	var snapshots []peerGroup
+	for _, g := range groups {
+		if !seen[g.value] {
+			seen[g.value] = true
+			values = append(values, g.value)
+		}
+		if _, found := counts[g.timestamp]; !found {
+			counts[g.timestamp] = make(map[string]peerGroup)
+			snapshots = append(snapshots, peerGroup{timestamp: g.timestamp, height: g.height})
+		}
+		counts[g.timestamp][g.value] = g
+	}
+
+	tx, err := db.sdb.From(table).Begin(true)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, snapshot := range snapshots {
+		for _, value := range values {
+			g := snapshot
+			g.value = value
+			g.nodes = counts[snapshot.timestamp][value].nodes
+			if err = tx.Save(toRecord(g)); err != nil {
+				return err
+			}
+		}
+	}
+	if err = ctx.Err(); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// nodeCount is a node count of a user agent or a country.
+type nodeCount struct {
+	timestamp int64
+	height    int64
+	nodes     int64
+}
+
+// nodeCountsByBin returns the counts unchanged for the default bin, or their
+// averages by bin.
+func nodeCountsByBin(counts []nodeCount, bin string) ([]nodeCount, error) {
+	if bin == string(chart.DefaultBin) {
+		return counts, nil
+	}
+	bins, err := completeBins(len(counts), func(i int) int64 { return counts[i].timestamp }, bin)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]nodeCount, len(bins))
+	for i, b := range bins {
+		result[i] = nodeCount{
+			timestamp: b.start,
+			height:    b.max(func(i int) int64 { return counts[i].height }),
+			nodes:     int64(math.Round(b.avg(func(i int) float64 { return float64(counts[i].nodes) }))),
+		}
+	}
+	return result, nil
+}
+
+func (db *BoltDb) NodeVersionsByBin(ctx context.Context, userAgent, bin string) ([]netsnapshot.UserAgentInfo, error) {
+	if db == nil || db.sdb == nil {
+		return nil, errDef
+	}
+	var records []nodeVersionRecord
+	err := db.sdb.From(nodeVersionTable).Select(q.Eq("UserAgent", userAgent)).OrderBy("Timestamp").Find(&records)
+	if err = ignoreNotFound(err); err != nil {
+		return nil, err
+	}
+	counts := make([]nodeCount, len(records))
+	for i, r := range records {
+		counts[i] = nodeCount{timestamp: r.Timestamp, height: r.Height, nodes: int64(r.NodeCount)}
+	}
+	if counts, err = nodeCountsByBin(counts, bin); err != nil {
+		return nil, err
+	}
+
+	result := make([]netsnapshot.UserAgentInfo, len(counts))
+	for i, c := range counts {
+		result[i] = netsnapshot.UserAgentInfo{
+			Nodes:     c.nodes,
+			Timestamp: c.timestamp,
+			Height:    c.height,
+			UserAgent: userAgent,
+		}
+	}
+	return result, nil
+}
+
+func (db *BoltDb) NodeLocationsByBin(ctx context.Context, country, bin string) ([]netsnapshot.CountryInfo, error) {
+	if db == nil || db.sdb == nil {
+		return nil, errDef
+	}
+	var records []nodeLocationRecord
+	err := db.sdb.From(nodeLocationTable).Select(q.Eq("Country", country)).OrderBy("Timestamp").Find(&records)
+	if err = ignoreNotFound(err); err != nil {
+		return nil, err
+	}
+	counts := make([]nodeCount, len(records))
+	for i, r := range records {
+		counts[i] = nodeCount{timestamp: r.Timestamp, height: r.Height, nodes: int64(r.NodeCount)}
+	}
+	if counts, err = nodeCountsByBin(counts, bin); err != nil {
+		return nil, err
+	}
+
+	locations := make([]netsnapshot.CountryInfo, len(counts))
+	for i, c := range counts {
+		locations[i] = netsnapshot.CountryInfo{
+			Nodes:     c.nodes,
+			Height:    c.height,
+			Timestamp: c.timestamp,
+			Country:   country,
+		}
+	}
+	return locations, nil
+}
+
+func (db *BoltDb) FetchNodeLocations(ctx context.Context, offset, limit int) ([]netsnapshot.CountryInfo, int64, error) {
+	if db == nil || db.sdb == nil {
+		return nil, 0, errDef
+	}
+	var records []nodeLocationRecord
+	err := db.sdb.From(nodeLocationTable).Select(q.Gt("NodeCount", 0)).OrderBy("Timestamp").Reverse().
+		Skip(offset).Limit(limit).Find(&records)
+	if err = ignoreNotFound(err); err != nil {
+		return nil, 0, err
+	}
+	var result = make([]netsnapshot.CountryInfo, len(records))
+	for i, rec := range records {
+		result[i] = netsnapshot.CountryInfo{
+			Country:   rec.Country,
+			Height:    rec.Height,
+			Timestamp: rec.Timestamp,
+			Nodes:     int64(rec.NodeCount),
+		}
+	}
+	count, err := db.count(nodeLocationTable, &nodeLocationRecord{})
+	if err != nil {
+		return nil, 0, err
+	}
+	return result, count, nil
+}
+
+func (db *BoltDb) FetchNodeVersion(ctx context.Context, offset, limit int) ([]netsnapshot.UserAgentInfo, int64, error) {
+	if db == nil || db.sdb == nil {
+		return nil, 0, errDef
+	}
+	var records []nodeVersionRecord
+	err := db.sdb.From(nodeVersionTable).Select(q.Gt("NodeCount", 0)).OrderBy("Timestamp").Reverse().
+		Skip(offset).Limit(limit).Find(&records)
+	if err = ignoreNotFound(err); err != nil {
+		return nil, 0, err
+	}
+	var result = make([]netsnapshot.UserAgentInfo, len(records))
+	for i, rec := range records {
+		result[i] = netsnapshot.UserAgentInfo{
+			UserAgent: rec.UserAgent,
+			Height:    rec.Height,
+			Timestamp: rec.Timestamp,
+			Nodes:     int64(rec.NodeCount),
+		}
+	}
+	count, err := db.count(nodeVersionTable, &nodeVersionRecord{})
+	if err != nil {
+		return nil, 0, err
+	}
+	return result, count, nil
+}
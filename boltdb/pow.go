@@ -0,0 +1,331 @@
+package boltdb
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/asdine/storm/v3/q"
+	"github.com/planetdecred/pdanalytics/app/helpers"
+	"github.com/planetdecred/pdanalytics/chart"
+	"github.com/planetdecred/pdanalytics/pow"
+)
+
+// powRecord is a PoW entry of a pool, keyed by source and time. The pool
+// hashrate is in Th/s.
+type powRecord struct {
+	ID           string `storm:"id"`
+	Time         int64  `storm:"index"`
+	Source       string `storm:"index"`
+	PoolHashrate float64
+	Workers      int64
+	CoinPrice    float64
+	BtcPrice     float64
+}
+
+func powRecordID(source string, time int64) string {
+	return fmt.Sprintf("%s:%020d", source, time)
+}
+
+// toDomainObj returns the entry as collected, with the pool hashrate in H/s.
+func (r *powRecord) toDomainObj() pow.PowData {
+	return pow.PowData{
+		Time:         r.Time,
+		PoolHashrate: r.PoolHashrate * pow.Thash,
+		Workers:      r.Workers,
+		Source:       r.Source,
+		CoinPrice:    r.CoinPrice,
+		BtcPrice:     r.BtcPrice,
+	}
+}
+
+func (r *powRecord) toDto() pow.PowDataDto {
+	return pow.PowDataDto{
+		Time:           helpers.UnixTime(r.Time).Format(dateTemplate),
+		PoolHashrateTh: fmt.Sprintf("%.0f", r.PoolHashrate),
+		Workers:        r.Workers,
+		Source:         r.Source,
+		CoinPrice:      r.CoinPrice,
+		BtcPrice:       r.BtcPrice,
+	}
+}
+
+func (db *BoltDb) PowTableName() string {
+	return powDataTable
+}
+
+func (db *BoltDb) LastPowEntryTime(source string) (time int64) {
+	if db == nil || db.sdb == nil {
+		return
+	}
+	var matchers []q.Matcher
+	if source != "" {
+		matchers = append(matchers, q.Eq("Source", source))
+	}
+	var records []powRecord
+	err := db.sdb.From(powDataTable).Select(matchers...).OrderBy("Time").Reverse().Limit(1).Find(&records)
+	if err != nil {
+		if err = ignoreNotFound(err); err != nil {
+			log.Errorf("Error in getting last PoW entry time: %s", err.Error())
+		}
+		return
+	}
+	return records[0].Time
+}
+
+func (db *BoltDb) AddPowData(ctx context.Context, data []pow.PowData) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if db == nil || db.sdb == nil {
+		return errDef
+	}
+
+	tx, err := db.sdb.From(powDataTable).Begin(true)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, d := range data {
+		record := &powRecord{
+			ID:           powRecordID(d.Source, d.Time),
+			Time:         d.Time,
+			Source:       d.Source,
+			PoolHashrate: math.Round(d.PoolHashrate / pow.Thash),
+			Workers:      d.Workers,
+			CoinPrice:    d.CoinPrice,
+			BtcPrice:     d.BtcPrice,
+		}
+		if err = tx.Save(record); err != nil {
+			return err
+		}
+	}
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+
+	if len(data) == 1 {
+		log.Infof("Added %4d PoW   entry from %10s %s", len(data), data[0].Source, unixTimeToString(data[0].Time))
+	} else if len(data) > 1 {
+		last := data[len(data)-1]
+		log.Infof("Added %4d PoW entries from %10s %s to %s",
+			len(data), last.Source, unixTimeToString(data[0].Time), unixTimeToString(last.Time))
+	}
+	return nil
+}
+
+// UpdatePowChart is a no-op, the PoW bins are computed on read.
+func (db *BoltDb) UpdatePowChart(ctx context.Context) error {
+	return nil
+}
+
+func (db *BoltDb) PowCount(ctx context.Context) (int64, error) {
+	return db.count(powDataTable, &powRecord{})
+}
+
+// powPage returns a page of the PoW entries matching the matchers, the most
+// recent first, and the number of matching entries.
+func (db *BoltDb) powPage(offset, limit int, matchers ...q.Matcher) ([]powRecord, int64, error) {
+	if db == nil || db.sdb == nil {
+		return nil, 0, errDef
+	}
+	query := db.sdb.From(powDataTable).Select(matchers...)
+	total, err := query.Count(&powRecord{})
+	if err = ignoreNotFound(err); err != nil {
+		return nil, 0, err
+	}
+	var records []powRecord
+	err = db.sdb.From(powDataTable).Select(matchers...).OrderBy("Time").Reverse().
+		Skip(offset).Limit(limit).Find(&records)
+	if err = ignoreNotFound(err); err != nil {
+		return nil, 0, err
+	}
+	return records, int64(total), nil
+}
+
+func (db *BoltDb) FetchPowData(ctx context.Context, offset, limit int) ([]pow.PowDataDto, int64, error) {
+	records, total, err := db.powPage(offset, limit)
+	if err != nil {
+		return nil, 0, err
+	}
+	var result []pow.PowDataDto
+	for i := range records {
+		result = append(result, records[i].toDto())
+	}
+	return result, total, nil
+}
+
+func (db *BoltDb) FetchPowDataBySource(ctx context.Context, source string, offset, limit int) ([]pow.PowDataDto, int64, error) {
+	records, total, err := db.powPage(offset, limit, q.Eq("Source", source))
+	if err != nil {
+		return nil, 0, err
+	}
+	var result []pow.PowDataDto
+	for i := range records {
+		result = append(result, records[i].toDto())
+	}
+	return result, total, nil
+}
+
+// FetchPowDataForSync returns PoW data for the sync operation
+func (db *BoltDb) FetchPowDataForSync(ctx context.Context, date int64, skip, take int) ([]pow.PowData, int64, error) {
+	if db == nil || db.sdb == nil {
+		return nil, 0, errDef
+	}
+	total, err := db.sdb.From(powDataTable).Select(q.Gt("Time", date)).Count(&powRecord{})
+	if err = ignoreNotFound(err); err != nil {
+		return nil, 0, err
+	}
+	var records []powRecord
+	err = db.sdb.From(powDataTable).Select(q.Gt("Time", date)).OrderBy("Time").
+		Skip(skip).Limit(take).Find(&records)
+	if err = ignoreNotFound(err); err != nil {
+		return nil, 0, err
+	}
+	var result []pow.PowData
+	for i := range records {
+		result = append(result, records[i].toDomainObj())
+	}
+	return result, int64(total), nil
+}
+
+// powRecords returns the PoW entries of the sources, or of all the sources
+// when none is given, ordered by time.
+func (db *BoltDb) powRecords(sources ...string) ([]powRecord, error) {
+	if db == nil || db.sdb == nil {
+		return nil, errDef
+	}
+	var matchers []q.Matcher
+	if len(sources) > 0 {
+		matchers = append(matchers, q.In("Source", sources))
+	}
+	var records []powRecord
+	err := db.sdb.From(powDataTable).Select(matchers...).OrderBy("Time").Find(&records)
+	return records, ignoreNotFound(err)
+}
+
+func (db *BoltDb) FetchPowSourceData(ctx context.Context) ([]pow.PowDataSource, error) {
+	records, err := db.powRecords()
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool)
+	var result []pow.PowDataSource
+	for _, r := range records {
+		if !seen[r.Source] {
+			seen[r.Source] = true
+			result = append(result, pow.PowDataSource{Source: r.Source})
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Source < result[j].Source })
+	return result, nil
+}
+
+func (db *BoltDb) GetPowDistinctDates(ctx context.Context, sources []string) ([]time.Time, error) {
+	records, err := db.powRecords(sources...)
+	if err != nil {
+		return nil, err
+	}
+	var dates []time.Time
+	for i, r := range records {
+		if i == 0 || r.Time != records[i-1].Time {
+			dates = append(dates, helpers.UnixTime(r.Time).UTC())
+		}
+	}
+	return dates, nil
+}
+
+func (db *BoltDb) FetchPowChartData(ctx context.Context, source string, dataType string) ([]pow.PowChartData, error) {
+	var value func(r *powRecord) string
+	switch strings.ToLower(dataType) {
+	case "pool_hashrate":
+		value = func(r *powRecord) string { return fmt.Sprintf("%.0f", r.PoolHashrate) }
+	case "workers":
+		value = func(r *powRecord) string { return fmt.Sprint(r.Workers) }
+	case "coin_price":
+		value = func(r *powRecord) string { return fmt.Sprint(r.CoinPrice) }
+	case "btc_price":
+		value = func(r *powRecord) string { return fmt.Sprint(r.BtcPrice) }
+	default:
+		return nil, fmt.Errorf("unknown PoW data type %s", dataType)
+	}
+
+	records, err := db.powRecords(source)
+	if err != nil {
+		return nil, err
+	}
+	var result []pow.PowChartData
+	for i := range records {
+		result = append(result, pow.PowChartData{
+			Date:   helpers.UnixTime(records[i].Time),
+			Record: value(&records[i]),
+		})
+	}
+	return result, nil
+}
+
+func (db *BoltDb) FetchEncodePowChart(ctx context.Context, dataType,
+	binString string, pools ...string) ([]byte, error) {
+	var value func(r *powRecord) float64
+	switch strings.ToLower(dataType) {
+	case string(chart.WorkerAxis):
+		value = func(r *powRecord) float64 { return float64(r.Workers) }
+	case string(chart.HashrateAxis):
+		value = func(r *powRecord) float64 { return r.PoolHashrate }
+	default:
+		return nil, chart.UnknownChartErr
+	}
+
+	// The raw chart has the dates of all the pools, like the postgres one.
+	var records []powRecord
+	var err error
+	if binString == string(chart.DefaultBin) {
+		records, err = db.powRecords()
+	} else {
+		records, err = db.powRecords(pools...)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	bySource := make(map[string][]powRecord)
+	for _, r := range records {
+		bySource[r.Source] = append(bySource[r.Source], r)
+	}
+	allDates := make(map[uint64]float64)
+	values := make(map[string]map[uint64]float64, len(pools))
+	for _, p := range pools {
+		values[p] = make(map[uint64]float64)
+	}
+	for source, sourceRecords := range bySource {
+		if binString == string(chart.DefaultBin) {
+			for i := range sourceRecords {
+				allDates[uint64(sourceRecords[i].Time)] = 0
+				if set, found := values[source]; found {
+					set[uint64(sourceRecords[i].Time)] = value(&sourceRecords[i])
+				}
+			}
+			continue
+		}
+		bins, err := completeBins(len(sourceRecords), func(i int) int64 {
+			return sourceRecords[i].Time
+		}, binString)
+		if err != nil {
+			return nil, err
+		}
+		for _, b := range bins {
+			allDates[uint64(b.start)] = 0
+			values[source][uint64(b.start)] = b.avg(func(i int) float64 { return value(&sourceRecords[i]) })
+		}
+	}
+
+	dates := sortedDates(allDates)
+	var deviations []chart.ChartNullUints
+	for _, p := range pools {
+		deviations = append(deviations, nullUints(dates, values[p]))
+	}
+	return chart.MakePowChart(dates, deviations, pools)
+}
@@ -0,0 +1,515 @@
+package boltdb
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/asdine/storm/v3"
+	"github.com/asdine/storm/v3/q"
+	"github.com/planetdecred/pdanalytics/chart"
+	"github.com/planetdecred/pdanalytics/dbhelper"
+	"github.com/planetdecred/pdanalytics/propagation"
+)
+
+// The block and vote times are stored in unix nanoseconds, zero being a time
+// that is not known.
+
+type blockRecord struct {
+	Height            int64 `storm:"id"`
+	Hash              string
+	InternalTimestamp int64
+	ReceiveTime       int64
+}
+
+type voteRecord struct {
+	Hash              string `storm:"id"`
+	VotingOn          int64  `storm:"index"`
+	BlockHash         string `storm:"index"`
+	ReceiveTime       int64  `storm:"index"`
+	TargetedBlockTime int64
+	BlockReceiveTime  int64
+	ValidatorID       int
+	Validity          string
+}
+
+// propagationRecord is the deviation of the block receive time of a source
+// from this instance, keyed by source and height.
+type propagationRecord struct {
+	ID        string `storm:"id"`
+	Height    int64
+	Time      int64
+	Source    string `storm:"index"`
+	Deviation float64
+}
+
+func nanoTime(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixNano()
+}
+
+func timeFromNano(n int64) time.Time {
+	if n == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, n).UTC()
+}
+
+func (b *blockRecord) delay() float64 {
+	return timeFromNano(b.ReceiveTime).Sub(timeFromNano(b.InternalTimestamp)).Seconds()
+}
+
+func (v *voteRecord) blockReceiveTimeDiff() float64 {
+	return timeFromNano(v.ReceiveTime).Sub(timeFromNano(v.BlockReceiveTime)).Seconds()
+}
+
+func (v *voteRecord) toDto() propagation.VoteDto {
+	timeDiff := timeFromNano(v.ReceiveTime).Sub(timeFromNano(v.TargetedBlockTime)).Seconds()
+	var shortBlockHash string
+	if len(v.BlockHash) > 0 {
+		shortBlockHash = v.BlockHash[len(v.BlockHash)-8:]
+	}
+	return propagation.VoteDto{
+		Hash:                  v.Hash,
+		ReceiveTime:           timeFromNano(v.ReceiveTime).Format(dbhelper.DateTemplate),
+		TargetedBlockTimeDiff: fmt.Sprintf("%04.2f", timeDiff),
+		BlockReceiveTimeDiff:  fmt.Sprintf("%04.2f", v.blockReceiveTimeDiff()),
+		VotingOn:              v.VotingOn,
+		BlockHash:             v.BlockHash,
+		ShortBlockHash:        shortBlockHash,
+		ValidatorId:           v.ValidatorID,
+		Validity:              v.Validity,
+	}
+}
+
+func (db *BoltDb) BlockTableName() string {
+	return blockTable
+}
+
+func (db *BoltDb) VoteTableName() string {
+	return voteTable
+}
+
+func (db *BoltDb) SaveBlock(ctx context.Context, block propagation.Block) error {
+	if db == nil || db.sdb == nil {
+		return errDef
+	}
+	tx, err := db.sdb.Begin(true)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Ignore duplicate entries
+	var existing blockRecord
+	err = tx.From(blockTable).One("Height", int64(block.BlockHeight), &existing)
+	if err == storm.ErrNotFound {
+		err = tx.From(blockTable).Save(&blockRecord{
+			Height:            int64(block.BlockHeight),
+			Hash:              block.BlockHash,
+			InternalTimestamp: nanoTime(block.BlockInternalTime),
+			ReceiveTime:       nanoTime(block.BlockReceiveTime),
+		})
+	}
+	if err != nil {
+		return err
+	}
+
+	var votes []voteRecord
+	err = tx.From(voteTable).Find("VotingOn", int64(block.BlockHeight), &votes)
+	if err = ignoreNotFound(err); err != nil {
+		return err
+	}
+	for i := range votes {
+		votes[i].BlockReceiveTime = nanoTime(block.BlockReceiveTime)
+		votes[i].BlockHash = block.BlockHash
+		if err = tx.From(voteTable).Save(&votes[i]); err != nil {
+			log.Errorf("Unable to fetch vote for block receive time update: %s", err.Error())
+		}
+	}
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+
+	log.Infof("New block received at %s, PropagationHeight: %d, Hash: ...%s",
+		block.BlockReceiveTime.Format(dbhelper.DateMiliTemplate), block.BlockHeight, block.BlockHash[len(block.BlockHash)-23:])
+	return nil
+}
+
+func (db *BoltDb) BlockCount(ctx context.Context) (int64, error) {
+	return db.count(blockTable, &blockRecord{})
+}
+
+// blocks returns a page of the blocks, the last received first.
+func (db *BoltDb) blocks(offset, limit int) ([]blockRecord, error) {
+	if db == nil || db.sdb == nil {
+		return nil, errDef
+	}
+	var records []blockRecord
+	err := db.sdb.From(blockTable).Select().OrderBy("ReceiveTime").Reverse().
+		Skip(offset).Limit(limit).Find(&records)
+	return records, ignoreNotFound(err)
+}
+
+func blockToDto(block *blockRecord) propagation.BlockDto {
+	return propagation.BlockDto{
+		BlockHash:         block.Hash,
+		BlockHeight:       uint32(block.Height),
+		BlockInternalTime: timeFromNano(block.InternalTimestamp).Format(dbhelper.DateTemplate),
+		BlockReceiveTime:  timeFromNano(block.ReceiveTime).Format(dbhelper.DateTemplate),
+		Delay:             fmt.Sprintf("%04.2f", block.delay()),
+	}
+}
+
+func (db *BoltDb) Blocks(ctx context.Context, offset int, limit int) ([]propagation.BlockDto, error) {
+	records, err := db.blocks(offset, limit)
+	if err != nil {
+		return nil, err
+	}
+	var blocks []propagation.BlockDto
+	for i := range records {
+		block := blockToDto(&records[i])
+		if block.Votes, err = db.votesByBlock(records[i].Height); err != nil {
+			return nil, err
+		}
+		blocks = append(blocks, block)
+	}
+	return blocks, nil
+}
+
+func (db *BoltDb) BlocksWithoutVotes(ctx context.Context, offset int, limit int) ([]propagation.BlockDto, error) {
+	records, err := db.blocks(offset, limit)
+	if err != nil {
+		return nil, err
+	}
+	var blocks []propagation.BlockDto
+	for i := range records {
+		blocks = append(blocks, blockToDto(&records[i]))
+	}
+	return blocks, nil
+}
+
+func (db *BoltDb) SaveVote(ctx context.Context, vote propagation.Vote) error {
+	if db == nil || db.sdb == nil {
+		return errDef
+	}
+	var existing voteRecord
+	err := db.sdb.From(voteTable).One("Hash", vote.Hash, &existing)
+	if err == nil { // Ignore duplicate entries
+		return nil
+	}
+	if err = ignoreNotFound(err); err != nil {
+		return err
+	}
+
+	record := &voteRecord{
+		Hash:              vote.Hash,
+		VotingOn:          vote.VotingOn,
+		BlockHash:         vote.BlockHash,
+		ReceiveTime:       nanoTime(vote.ReceiveTime),
+		TargetedBlockTime: nanoTime(vote.TargetedBlockTime),
+		ValidatorID:       vote.ValidatorId,
+		Validity:          vote.Validity,
+	}
+
+	// get the target block
+	var block blockRecord
+	if err = db.sdb.From(blockTable).One("Height", vote.VotingOn, &block); err == nil {
+		record.BlockReceiveTime = block.ReceiveTime
+	}
+
+	if err = db.sdb.From(voteTable).Save(record); err != nil {
+		return err
+	}
+
+	log.Infof("New vote received at %s for %d, Validator Id %d, Hash ...%s",
+		vote.ReceiveTime.Format(dbhelper.DateMiliTemplate), vote.VotingOn, vote.ValidatorId, vote.Hash[len(vote.Hash)-23:])
+	return nil
+}
+
+func votesToDtos(records []voteRecord) []propagation.VoteDto {
+	var votes = make([]propagation.VoteDto, len(records))
+	for i := range records {
+		votes[i] = records[i].toDto()
+	}
+	return votes
+}
+
+func (db *BoltDb) Votes(ctx context.Context, offset int, limit int) ([]propagation.VoteDto, error) {
+	if db == nil || db.sdb == nil {
+		return nil, errDef
+	}
+	var records []voteRecord
+	err := db.sdb.From(voteTable).Select().OrderBy("ReceiveTime").Reverse().
+		Skip(offset).Limit(limit).Find(&records)
+	if err = ignoreNotFound(err); err != nil {
+		return nil, err
+	}
+	return votesToDtos(records), nil
+}
+
+func (db *BoltDb) VotesByBlock(ctx context.Context, blockHash string) ([]propagation.VoteDto, error) {
+	if db == nil || db.sdb == nil {
+		return nil, errDef
+	}
+	var records []voteRecord
+	err := db.sdb.From(voteTable).Select(q.Eq("BlockHash", blockHash)).OrderBy("ReceiveTime").Reverse().Find(&records)
+	if err = ignoreNotFound(err); err != nil {
+		return nil, err
+	}
+	return votesToDtos(records), nil
+}
+
+func (db *BoltDb) votesByBlock(blockHeight int64) ([]propagation.VoteDto, error) {
+	var records []voteRecord
+	err := db.sdb.From(voteTable).Select(q.Eq("VotingOn", blockHeight)).OrderBy("ReceiveTime").Find(&records)
+	if err = ignoreNotFound(err); err != nil {
+		return nil, err
+	}
+	var votes []propagation.VoteDto
+	for i := range records {
+		votes = append(votes, records[i].toDto())
+	}
+	return votes, nil
+}
+
+func (db *BoltDb) VotesCount(ctx context.Context) (int64, error) {
+	return db.count(voteTable, &voteRecord{})
+}
+
+func (db *BoltDb) VotesBlockReceiveTimeDiffs(ctx context.Context) ([]propagation.PropagationChartData, error) {
+	if db == nil || db.sdb == nil {
+		return nil, errDef
+	}
+	var records []voteRecord
+	err := db.sdb.From(voteTable).Select().OrderBy("VotingOn").Find(&records)
+	if err = ignoreNotFound(err); err != nil {
+		return nil, err
+	}
+	var chartData = make([]propagation.PropagationChartData, len(records))
+	for i := range records {
+		chartData[i] = propagation.PropagationChartData{
+			BlockHeight: records[i].VotingOn, TimeDifference: records[i].blockReceiveTimeDiff(),
+		}
+	}
+	return chartData, nil
+}
+
+func (db *BoltDb) BlockDelays(ctx context.Context, height int) ([]propagation.PropagationChartData, error) {
+	if db == nil || db.sdb == nil {
+		return nil, errDef
+	}
+	var records []blockRecord
+	err := db.sdb.From(blockTable).Select(q.Gt("Height", int64(height))).Find(&records)
+	if err = ignoreNotFound(err); err != nil {
+		return nil, err
+	}
+	var chartData = make([]propagation.PropagationChartData, len(records))
+	for i := range records {
+		chartData[i] = propagation.PropagationChartData{
+			BlockHeight:    records[i].Height,
+			TimeDifference: records[i].delay(),
+			BlockTime:      timeFromNano(records[i].InternalTimestamp),
+		}
+	}
+	return chartData, nil
+}
+
+// propagationRecords returns the default propagation records of the source,
+// ordered by time.
+func (db *BoltDb) propagationRecords(source string) ([]propagationRecord, error) {
+	if db == nil || db.sdb == nil {
+		return nil, errDef
+	}
+	var records []propagationRecord
+	err := db.sdb.From(propagationTable).Select(q.Eq("Source", source)).OrderBy("Time").Find(&records)
+	return records, ignoreNotFound(err)
+}
+
+// UpdatePropagationDataForSource computes and store the difference
+// in block receive time of this instance and provided source
+// for all the blocks received since the last update of the source
+func (db *BoltDb) UpdatePropagationDataForSource(ctx context.Context, source string, sourceDB propagation.Store) error {
+	log.Infof("Fetching propagation data for %s", source)
+	records, err := db.propagationRecords(source)
+	if err != nil {
+		return err
+	}
+	var lastHeight int64
+	if len(records) > 0 {
+		lastHeight = records[len(records)-1].Height
+	}
+
+	mainBlockDelays, err := db.BlockDelays(ctx, int(lastHeight))
+	if err != nil {
+		return err
+	}
+	blockDelays, err := sourceDB.BlockDelays(ctx, int(lastHeight))
+	if err != nil {
+		return err
+	}
+	receiveTimeMap := make(map[int64]float64)
+	for _, record := range blockDelays {
+		receiveTimeMap[record.BlockHeight], _ = strconv.ParseFloat(fmt.Sprintf("%04.2f", record.TimeDifference), 64)
+	}
+
+	tx, err := db.sdb.From(propagationTable).Begin(true)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, rec := range mainBlockDelays {
+		record := &propagationRecord{
+			ID:     fmt.Sprintf("%s:%020d", source, rec.BlockHeight),
+			Height: rec.BlockHeight,
+			Time:   rec.BlockTime.Unix(),
+			Source: source,
+		}
+		if sourceTime, found := receiveTimeMap[rec.BlockHeight]; found {
+			localTime, _ := strconv.ParseFloat(fmt.Sprintf("%04.2f", rec.TimeDifference), 64)
+			record.Deviation = localTime - sourceTime
+		}
+		if err = tx.Save(record); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// UpdatePropagationBinsForSource is a no-op, the propagation bins are
+// computed on read.
+func (db *BoltDb) UpdatePropagationBinsForSource(ctx context.Context, source string) error {
+	return nil
+}
+
+// UpdateBlockBinData is a no-op, the block bins are computed on read.
+func (db *BoltDb) UpdateBlockBinData(ctx context.Context) error {
+	return nil
+}
+
+// UpdateVoteTimeDeviationData is a no-op, the vote bins are computed on read.
+func (db *BoltDb) UpdateVoteTimeDeviationData(ctx context.Context) error {
+	return nil
+}
+
+func (db *BoltDb) SourceDeviations(ctx context.Context, source, bin string) (records []propagation.SourceDeviation, err error) {
+	data, err := db.propagationRecords(source)
+	if err != nil {
+		return nil, err
+	}
+	if bin == string(chart.DefaultBin) {
+		for _, d := range data {
+			records = append(records, propagation.SourceDeviation{
+				Height:    d.Height,
+				Time:      d.Time,
+				Deviation: d.Deviation,
+			})
+		}
+		return
+	}
+
+	bins, err := completeBins(len(data), func(i int) int64 { return data[i].Time }, bin)
+	if err != nil {
+		return nil, err
+	}
+	for _, b := range bins {
+		records = append(records, propagation.SourceDeviation{
+			Height:    b.max(func(i int) int64 { return data[i].Height }),
+			Time:      b.start,
+			Deviation: b.avg(func(i int) float64 { return data[i].Deviation }),
+		})
+	}
+	return
+}
+
+func (db *BoltDb) BlockBinData(ctx context.Context, bin string) (records []propagation.BlockBinDto, err error) {
+	if db == nil || db.sdb == nil {
+		return nil, errDef
+	}
+	var blocks []blockRecord
+	err = db.sdb.From(blockTable).Select().OrderBy("InternalTimestamp").Find(&blocks)
+	if err = ignoreNotFound(err); err != nil {
+		return nil, err
+	}
+	bins, err := completeBins(len(blocks), func(i int) int64 {
+		return timeFromNano(blocks[i].InternalTimestamp).Unix()
+	}, bin)
+	if err != nil {
+		return nil, err
+	}
+	for _, b := range bins {
+		records = append(records, propagation.BlockBinDto{
+			Height:            b.max(func(i int) int64 { return blocks[i].Height }),
+			ReceiveTimeDiff:   b.avg(func(i int) float64 { return blocks[i].delay() }),
+			InternalTimestamp: b.start,
+		})
+	}
+	return
+}
+
+func (db *BoltDb) VoteReceiveTimeDeviations(ctx context.Context, bin string) (result []propagation.VoteReceiveTimeDeviation, err error) {
+	if db == nil || db.sdb == nil {
+		return nil, errDef
+	}
+	var records []voteRecord
+	err = db.sdb.From(voteTable).Select(q.Gt("BlockReceiveTime", int64(0))).OrderBy("TargetedBlockTime").Find(&records)
+	if err = ignoreNotFound(err); err != nil {
+		return nil, err
+	}
+	bins, err := completeBins(len(records), func(i int) int64 {
+		return timeFromNano(records[i].TargetedBlockTime).Unix()
+	}, bin)
+	if err != nil {
+		return nil, err
+	}
+	for _, b := range bins {
+		result = append(result, propagation.VoteReceiveTimeDeviation{
+			BlockHeight:           b.max(func(i int) int64 { return records[i].VotingOn }),
+			BlockTime:             b.start,
+			ReceiveTimeDifference: b.avg(func(i int) float64 { return records[i].blockReceiveTimeDiff() }),
+		})
+	}
+	return
+}
+
+// RollbackBlocks deletes the blocks above the given height together with the
+// votes and the propagation data derived from them. It is used to undo the
+// blocks detached from the best chain during a reorg.
+func (db *BoltDb) RollbackBlocks(ctx context.Context, height uint32) error {
+	if db == nil || db.sdb == nil {
+		return errDef
+	}
+	tx, err := db.sdb.Begin(true)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	above := func(field string) q.Matcher { return q.Gt(field, int64(height)) }
+	votes, err := tx.From(voteTable).Select(above("VotingOn")).Count(&voteRecord{})
+	if err = ignoreNotFound(err); err != nil {
+		return err
+	}
+	if err = ignoreNotFound(tx.From(voteTable).Select(above("VotingOn")).Delete(&voteRecord{})); err != nil {
+		return err
+	}
+	blocks, err := tx.From(blockTable).Select(above("Height")).Count(&blockRecord{})
+	if err = ignoreNotFound(err); err != nil {
+		return err
+	}
+	if err = ignoreNotFound(tx.From(blockTable).Select(above("Height")).Delete(&blockRecord{})); err != nil {
+		return err
+	}
+	if err = ignoreNotFound(tx.From(propagationTable).Select(above("Height")).Delete(&propagationRecord{})); err != nil {
+		return err
+	}
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+
+	log.Infof("Rolled back %d blocks and %d votes above height %d", blocks, votes, height)
+	return nil
+}
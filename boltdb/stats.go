@@ -0,0 +1,101 @@
+package boltdb
+
+import (
+	"context"
+	"time"
+
+	"github.com/planetdecred/pdanalytics/stats"
+	bolt "go.etcd.io/bbolt"
+)
+
+// recordTime returns the time of a record, for the tables with one.
+func recordTime(record interface{}) (time.Time, bool) {
+	switch r := record.(type) {
+	case *mempoolRecord:
+		return time.Unix(0, r.Time).UTC(), true
+	case *mempoolTxRecord:
+		return time.Unix(0, r.Time).UTC(), true
+	case *snapshotRecord:
+		return time.Unix(r.Timestamp, 0).UTC(), true
+	case *heartbeatRecord:
+		return time.Unix(r.Timestamp, 0).UTC(), true
+	case *blockRecord:
+		return timeFromNano(r.ReceiveTime), r.ReceiveTime != 0
+	case *voteRecord:
+		return timeFromNano(r.ReceiveTime), r.ReceiveTime != 0
+	case *exchangeTickRecord:
+		return time.Unix(r.Time, 0).UTC(), true
+	case *powRecord:
+		return time.Unix(r.Time, 0).UTC(), true
+	case *vspTickRecord:
+		return time.Unix(r.Time, 0).UTC(), true
+	case commStatRecord:
+		return time.Unix(0, r.date()).UTC(), true
+	}
+	return time.Time{}, false
+}
+
+// StorageModules returns the modules that own embedded tables.
+func (db *BoltDb) StorageModules() []string {
+	return TableModules()
+}
+
+// ModuleStorageStats returns the record count, bucket size and time range of
+// the existing tables of the module.
+func (db *BoltDb) ModuleStorageStats(ctx context.Context, module string) ([]stats.TableStats, error) {
+	if db == nil || db.sdb == nil {
+		return nil, errDef
+	}
+	var result []stats.TableStats
+	for _, mt := range createTables {
+		if mt.module != module {
+			continue
+		}
+		for _, t := range mt.tables {
+			if !db.TableExists(t.name) {
+				continue
+			}
+			table, err := db.tableStats(t)
+			if err != nil {
+				return nil, err
+			}
+			result = append(result, table)
+		}
+	}
+	return result, nil
+}
+
+func (db *BoltDb) tableStats(t table) (stats.TableStats, error) {
+	table := stats.TableStats{Name: t.name}
+	err := db.sdb.Bolt.View(func(tx *bolt.Tx) error {
+		if b := tx.Bucket([]byte(t.name)); b != nil {
+			s := b.Stats()
+			table.Size = int64(s.BranchAlloc + s.LeafAlloc)
+		}
+		return nil
+	})
+	if err != nil {
+		return table, err
+	}
+
+	var oldest, newest time.Time
+	err = db.sdb.From(t.name).Select().Each(t.record, func(record interface{}) error {
+		table.Rows++
+		if rt, ok := recordTime(record); ok {
+			if oldest.IsZero() || rt.Before(oldest) {
+				oldest = rt
+			}
+			if rt.After(newest) {
+				newest = rt
+			}
+		}
+		return nil
+	})
+	if err = ignoreNotFound(err); err != nil {
+		return table, err
+	}
+	if !oldest.IsZero() {
+		table.Oldest, table.Newest = &oldest, &newest
+	}
+	return table, nil
+}
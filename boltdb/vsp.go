@@ -0,0 +1,327 @@
+package boltdb
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/asdine/storm/v3"
+	"github.com/asdine/storm/v3/q"
+	"github.com/planetdecred/pdanalytics/app/helpers"
+	"github.com/planetdecred/pdanalytics/chart"
+	"github.com/planetdecred/pdanalytics/vsp"
+)
+
+type vspRecord struct {
+	ID                   int    `storm:"id,increment"`
+	Name                 string `storm:"unique"`
+	APIEnabled           bool
+	APIVersionsSupported []int64
+	Network              string
+	URL                  string
+	Launched             int64
+}
+
+type vspTickRecord struct {
+	ID               int `storm:"id,increment"`
+	VSPID            int `storm:"index"`
+	Immature         int
+	Live             int
+	Voted            int
+	Missed           int
+	PoolFees         float64
+	ProportionLive   float64
+	ProportionMissed float64
+	UserCount        int
+	UsersActive      int
+	Time             int64 `storm:"index"`
+}
+
+func (t *vspTickRecord) toDto(vspName string) vsp.VSPTickDto {
+	return vsp.VSPTickDto{
+		ID:               t.ID,
+		VSP:              vspName,
+		Time:             helpers.UnixTime(t.Time).Format(dateTemplate),
+		Immature:         t.Immature,
+		Live:             t.Live,
+		Missed:           t.Missed,
+		PoolFees:         t.PoolFees,
+		ProportionLive:   roundValue(t.ProportionLive),
+		ProportionMissed: roundValue(t.ProportionMissed),
+		UserCount:        t.UserCount,
+		UsersActive:      t.UsersActive,
+		Voted:            t.Voted,
+	}
+}
+
+func (db *BoltDb) VspTableName() string {
+	return vspTable
+}
+
+func (db *BoltDb) VspTickTableName() string {
+	return vspTickTable
+}
+
+// StoreVSPs stores the vsp responses, creating the missing VSPs, and returns
+// the number of ticks stored. The ticks already stored are skipped.
+func (db *BoltDb) StoreVSPs(ctx context.Context, data vsp.Response) (int, []error) {
+	if ctx.Err() != nil {
+		return 0, []error{ctx.Err()}
+	}
+	if db == nil || db.sdb == nil {
+		return 0, []error{errDef}
+	}
+	errs := make([]error, 0, len(data))
+	completed := 0
+	for name, tick := range data {
+		stored, err := db.storeVspResponse(name, tick)
+		if err != nil {
+			log.Trace(err)
+			errs = append(errs, err)
+		} else if stored {
+			completed++
+		}
+		if ctx.Err() != nil {
+			return 0, append(errs, ctx.Err())
+		}
+	}
+	if completed == 0 {
+		log.Info("Unable to store any vsp entry")
+	}
+	return completed, errs
+}
+
+func (db *BoltDb) storeVspResponse(name string, resp *vsp.ResposeData) (bool, error) {
+	tx, err := db.sdb.Begin(true)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	pool := new(vspRecord)
+	err = tx.From(vspTable).One("Name", name, pool)
+	if err == storm.ErrNotFound {
+		pool = &vspRecord{
+			Name:                 name,
+			APIEnabled:           resp.APIEnabled,
+			APIVersionsSupported: resp.APIVersionsSupported,
+			Network:              resp.Network,
+			URL:                  resp.URL,
+			Launched:             resp.Launched,
+		}
+		err = tx.From(vspTable).Save(pool)
+	}
+	if err != nil {
+		return false, err
+	}
+
+	var existing vspTickRecord
+	err = tx.From(vspTickTable).Select(q.Eq("VSPID", pool.ID), q.Eq("Time", resp.LastUpdated)).First(&existing)
+	if err == nil {
+		return false, nil
+	}
+	if err != storm.ErrNotFound {
+		return false, err
+	}
+
+	tick := &vspTickRecord{
+		VSPID:            pool.ID,
+		Immature:         resp.Immature,
+		Live:             resp.Live,
+		Voted:            resp.Voted,
+		Missed:           resp.Missed,
+		PoolFees:         resp.PoolFees,
+		ProportionLive:   resp.ProportionLive,
+		ProportionMissed: resp.ProportionMissed,
+		UserCount:        resp.UserCount,
+		UsersActive:      resp.UserCountActive,
+		Time:             resp.LastUpdated,
+	}
+	if err = tx.From(vspTickTable).Save(tick); err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+func (db *BoltDb) vsps() ([]vspRecord, error) {
+	if db == nil || db.sdb == nil {
+		return nil, errDef
+	}
+	var records []vspRecord
+	err := db.sdb.From(vspTable).Select().OrderBy("URL", "Name").Find(&records)
+	return records, ignoreNotFound(err)
+}
+
+func (db *BoltDb) FetchVSPs(ctx context.Context) ([]vsp.VSPDto, error) {
+	records, err := db.vsps()
+	if err != nil {
+		return nil, err
+	}
+	var result []vsp.VSPDto
+	for _, item := range records {
+		parsedURL, err := url.Parse(item.URL)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, vsp.VSPDto{
+			ID:                   item.ID,
+			Name:                 item.Name,
+			APIEnabled:           item.APIEnabled,
+			APIVersionsSupported: item.APIVersionsSupported,
+			Network:              item.Network,
+			URL:                  item.URL,
+			Host:                 parsedURL.Host,
+			Launched:             helpers.UnixTime(item.Launched),
+		})
+	}
+	return result, nil
+}
+
+// vspTicksPage returns a page of the ticks matching the matchers, the most
+// recent first, and the number of matching ticks.
+func (db *BoltDb) vspTicksPage(offset, limit int, matchers ...q.Matcher) ([]vsp.VSPTickDto, int64, error) {
+	records, err := db.vsps()
+	if err != nil {
+		return nil, 0, err
+	}
+	names := make(map[int]string, len(records))
+	for _, r := range records {
+		names[r.ID] = r.Name
+	}
+
+	total, err := db.sdb.From(vspTickTable).Select(matchers...).Count(&vspTickRecord{})
+	if err = ignoreNotFound(err); err != nil {
+		return nil, 0, err
+	}
+	var ticks []vspTickRecord
+	err = db.sdb.From(vspTickTable).Select(matchers...).OrderBy("Time").Reverse().
+		Skip(offset).Limit(limit).Find(&ticks)
+	if err = ignoreNotFound(err); err != nil {
+		return nil, 0, err
+	}
+	var result []vsp.VSPTickDto
+	for i := range ticks {
+		result = append(result, ticks[i].toDto(names[ticks[i].VSPID]))
+	}
+	return result, int64(total), nil
+}
+
+func (db *BoltDb) FilteredVSPTicks(ctx context.Context, vspName string, offset, limit int) ([]vsp.VSPTickDto, int64, error) {
+	if db == nil || db.sdb == nil {
+		return nil, 0, errDef
+	}
+	var vspInfo vspRecord
+	if err := db.sdb.From(vspTable).One("Name", vspName, &vspInfo); err != nil {
+		log.Errorf("Error in FilteredVSPTicks - %s", err.Error())
+		return nil, 0, err
+	}
+	return db.vspTicksPage(offset, limit, q.Eq("VSPID", vspInfo.ID))
+}
+
+func (db *BoltDb) AllVSPTicks(ctx context.Context, offset, limit int) ([]vsp.VSPTickDto, int64, error) {
+	return db.vspTicksPage(offset, limit)
+}
+
+func (db *BoltDb) LastVspTickEntryTime() (time time.Time) {
+	if db == nil || db.sdb == nil {
+		return
+	}
+	var ticks []vspTickRecord
+	err := db.sdb.From(vspTickTable).Select().OrderBy("Time").Reverse().Limit(1).Find(&ticks)
+	if err == nil {
+		time = helpers.UnixTime(ticks[0].Time)
+	}
+	return
+}
+
+func (db *BoltDb) VspTickCount(ctx context.Context) (int64, error) {
+	return db.count(vspTickTable, &vspTickRecord{})
+}
+
+// UpdateVspChart is a no-op, the VSP bins are computed on read.
+func (db *BoltDb) UpdateVspChart(ctx context.Context) error {
+	return nil
+}
+
+func (db *BoltDb) FetchEncodeVspChart(ctx context.Context,
+	dataType, binString string, vspSources ...string) ([]byte, error) {
+	var value func(t *vspTickRecord) float64
+	var isFloat bool
+	switch strings.ToLower(dataType) {
+	case string(chart.ImmatureAxis):
+		value = func(t *vspTickRecord) float64 { return float64(t.Immature) }
+	case string(chart.LiveAxis):
+		value = func(t *vspTickRecord) float64 { return float64(t.Live) }
+	case string(chart.VotedAxis):
+		value = func(t *vspTickRecord) float64 { return float64(t.Voted) }
+	case string(chart.MissedAxis):
+		value = func(t *vspTickRecord) float64 { return float64(t.Missed) }
+	case string(chart.PoolFeesAxis):
+		value, isFloat = func(t *vspTickRecord) float64 { return t.PoolFees }, true
+	case string(chart.ProportionLiveAxis):
+		value, isFloat = func(t *vspTickRecord) float64 { return t.ProportionLive }, true
+	case string(chart.ProportionMissedAxis):
+		value, isFloat = func(t *vspTickRecord) float64 { return t.ProportionMissed }, true
+	case string(chart.UserCountAxis):
+		value = func(t *vspTickRecord) float64 { return float64(t.UserCount) }
+	case string(chart.UsersActiveAxis):
+		value = func(t *vspTickRecord) float64 { return float64(t.UsersActive) }
+	default:
+		return nil, chart.UnknownChartErr
+	}
+
+	records, err := db.vsps()
+	if err != nil {
+		return nil, err
+	}
+	ids := make(map[string]int, len(records))
+	for _, r := range records {
+		ids[r.Name] = r.ID
+	}
+
+	allDates := make(map[uint64]float64)
+	values := make(map[string]map[uint64]float64, len(vspSources))
+	for _, source := range vspSources {
+		id, found := ids[source]
+		if !found {
+			return nil, fmt.Errorf("unknown VSP %s", source)
+		}
+		var ticks []vspTickRecord
+		err = db.sdb.From(vspTickTable).Select(q.Eq("VSPID", id)).OrderBy("Time").Find(&ticks)
+		if err = ignoreNotFound(err); err != nil {
+			return nil, err
+		}
+
+		set := make(map[uint64]float64)
+		if binString == string(chart.DefaultBin) {
+			for i := range ticks {
+				set[uint64(ticks[i].Time)] = value(&ticks[i])
+			}
+		} else {
+			bins, err := completeBins(len(ticks), func(i int) int64 { return ticks[i].Time }, binString)
+			if err != nil {
+				return nil, err
+			}
+			for _, b := range bins {
+				set[uint64(b.start)] = b.avg(func(i int) float64 { return value(&ticks[i]) })
+			}
+		}
+		for date := range set {
+			allDates[date] = 0
+		}
+		values[source] = set
+	}
+
+	dates := sortedDates(allDates)
+	var deviations []chart.ChartNullData
+	for _, source := range vspSources {
+		if isFloat {
+			deviations = append(deviations, nullFloats(dates, values[source]))
+		} else {
+			deviations = append(deviations, nullUints(dates, values[source]))
+		}
+	}
+	return chart.MakeVspChart(dates, deviations, vspSources)
+}
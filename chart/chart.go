@@ -43,6 +43,8 @@ const (
 	DefaultBin binLevel = "default"
 	HourBin    binLevel = "hour"
 	DayBin     binLevel = "day"
+	WeekBin    binLevel = "week"
+	MonthBin   binLevel = "month"
 )
 
 func ParseBin(binString string) binLevel {
@@ -51,6 +53,10 @@ func ParseBin(binString string) binLevel {
 		return HourBin
 	case DayBin:
 		return DayBin
+	case WeekBin:
+		return WeekBin
+	case MonthBin:
+		return MonthBin
 	default:
 		return DefaultBin
 	}
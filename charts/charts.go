@@ -30,11 +30,11 @@ func New(client *dcrd.Dcrd, webServer *web.Server) (*Charts, error) {
 		client: client,
 	}
 
-	hash, err := client.Rpc.GetBestBlockHash()
+	hash, err := client.Rpc().GetBestBlockHash()
 	if err != nil {
 		return nil, err
 	}
-	blockHeader, err := client.Rpc.GetBlockHeader(hash)
+	blockHeader, err := client.Rpc().GetBlockHeader(hash)
 	if err != nil {
 		return nil, err
 	}
@@ -59,6 +59,7 @@ func New(client *dcrd.Dcrd, webServer *web.Server) (*Charts, error) {
 	}
 
 	chrt.client.Notif.RegisterBlockHandlerGroup(chrt.ConnectBlock)
+	chrt.client.Notif.RegisterReorgHandlerGroup(chrt.Reorg)
 
 	chrt.server.AddRoute("/charts", web.GET, chrt.charts)
 	chrt.server.AddRoute("/api/charts/{chartDataType}", web.GET, chrt.ChartTypeData, web.ChartDataTypeCtx)
@@ -70,7 +71,7 @@ func (ch *Charts) ConnectBlock(w *wire.BlockHeader) error {
 	ch.reorgLock.Lock()
 	defer ch.reorgLock.Unlock()
 
-	hashes, err := ch.client.Rpc.LiveTickets()
+	hashes, err := ch.client.Rpc().LiveTickets()
 	if err != nil {
 		return err
 	}
@@ -79,6 +80,15 @@ func (ch *Charts) ConnectBlock(w *wire.BlockHeader) error {
 	return nil
 }
 
+// Reorg refreshes the ticket pool size after blocks are detached.
+func (ch *Charts) Reorg(reorg *dcrd.ReorgData) error {
+	blockHeader, err := ch.client.Rpc().GetBlockHeader(&reorg.CommonAncestor)
+	if err != nil {
+		return err
+	}
+	return ch.ConnectBlock(blockHeader)
+}
+
 //charts is the page handler for the "/charts" path
 func (ch *Charts) charts(w http.ResponseWriter, r *http.Request) {
 	ch.reorgLock.Lock()
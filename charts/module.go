@@ -0,0 +1,50 @@
+package charts
+
+import (
+	"context"
+
+	"github.com/decred/slog"
+	"github.com/planetdecred/pdanalytics/dcrd"
+	"github.com/planetdecred/pdanalytics/module"
+	"github.com/planetdecred/pdanalytics/web"
+)
+
+// ChartsOptions are the config options of the charts module.
+type ChartsOptions struct {
+	EnableCharts bool `long:"charts" description:"Enable/Disable Charts"`
+}
+
+type chartsModule struct {
+	options ChartsOptions
+	client  *dcrd.Dcrd
+	server  *web.Server
+}
+
+func init() {
+	module.Register(&chartsModule{
+		options: ChartsOptions{
+			EnableCharts: true,
+		},
+	})
+}
+
+func (m *chartsModule) Name() string                 { return "charts" }
+func (m *chartsModule) LogSubsystem() string         { return "CHRTS" }
+func (m *chartsModule) UseLogger(logger slog.Logger) { UseLogger(logger) }
+func (m *chartsModule) Options() interface{}         { return &m.options }
+func (m *chartsModule) Enabled() bool                { return m.options.EnableCharts }
+
+func (m *chartsModule) Init(deps *module.Deps) error {
+	m.client = deps.Dcrd
+	m.server = deps.Server
+	return nil
+}
+
+func (m *chartsModule) Start(ctx context.Context) error {
+	_, err := New(m.client, m.server)
+	return err
+}
+
+func (m *chartsModule) Stop() error { return nil }
+
+func (m *chartsModule) Health() module.Health { return module.Healthy }
@@ -6,10 +6,12 @@ package commstats
 
 import (
 	"context"
+	"database/sql"
+	"fmt"
 	"net/http"
 	"time"
 
-	"github.com/planetdecred/pdanalytics/app"
+	"github.com/planetdecred/pdanalytics/scheduler"
 	"github.com/planetdecred/pdanalytics/web"
 )
 
@@ -18,7 +20,8 @@ const (
 	retryLimit       = 3
 )
 
-func Activate(ctx context.Context, store DataStore, server *web.Server, options *CommunityStatOptions) error {
+func Activate(ctx context.Context, store DataStore, server *web.Server, sched *scheduler.Scheduler,
+	options *CommunityStatOptions) error {
 	c := &Collector{
 		client:    http.Client{Timeout: 10 * time.Second},
 		dataStore: store,
@@ -27,9 +30,9 @@ func Activate(ctx context.Context, store DataStore, server *web.Server, options
 	}
 
 	if options.CommunityStat {
-		go func() {
-			c.Run(ctx)
-		}()
+		if err := c.registerJobs(sched); err != nil {
+			return err
+		}
 	}
 
 	if options.CommunityStatHttp {
@@ -40,26 +43,41 @@ func Activate(ctx context.Context, store DataStore, server *web.Server, options
 	return nil
 }
 
-func (c *Collector) Run(ctx context.Context) {
-	if ctx.Err() != nil {
-		return
+// registerJobs schedules a collection job for every community platform.
+func (c *Collector) registerJobs(sched *scheduler.Scheduler) error {
+	jobs := []struct {
+		table    string
+		interval int
+		run      func(context.Context) error
+	}{
+		{"twitter", c.options.TwitterStatInterval, c.collectAndStoreTwitterStat},
+		{"youtube", c.options.YoutubeStatInterval, c.collectAndStoreYoutubeStat},
+		{"github", c.options.GithubStatInterval, c.collectAndStoreGithubStat},
+		{"reddit", c.options.RedditStatInterval, c.collectAndStoreRedditStat},
 	}
 
-	// continually check the state of the app until its free to run this module
-	app.MarkBusyIfFree()
-
-	log.Info("Fetching community stats...")
-
-	app.ReleaseForNewModule()
-
-	go c.startTwitterCollector(ctx)
-
-	go c.startYoutubeCollector(ctx)
-
-	// github
-	go c.startGithubCollector(ctx)
-
-	go c.startRedditCollector(ctx)
+	for _, job := range jobs {
+		table := job.table
+		interval := time.Duration(job.interval) * time.Minute
+		err := sched.Register(scheduler.Job{
+			Name:     "commstats-" + table,
+			Interval: interval,
+			Timeout:  interval,
+			LastRun: func(ctx context.Context) (time.Time, error) {
+				var lastCollectionDate time.Time
+				err := c.dataStore.LastEntry(ctx, table, &lastCollectionDate)
+				if err != nil && err != sql.ErrNoRows {
+					return time.Time{}, fmt.Errorf("cannot fetch last %s entry time, %s", table, err.Error())
+				}
+				return lastCollectionDate, nil
+			},
+			Run: job.run,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 func (c *Collector) setupServer() error {
@@ -0,0 +1,48 @@
+package commstats_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/planetdecred/pdanalytics/commstats"
+	"github.com/planetdecred/pdanalytics/memdb"
+	"github.com/planetdecred/pdanalytics/testutil"
+)
+
+func TestGithubStat(t *testing.T) {
+	const repository = "decred/dcrd"
+	testutil.MockAPIs(t, map[string]http.Handler{
+		"api.github.com": testutil.JSON(`{"stargazers_count":610,"network_count":250}`),
+	})
+	sched := testutil.NewScheduler(t)
+	server := testutil.NewServer(t)
+	db := memdb.New()
+
+	err := commstats.Activate(context.Background(), db, server.Server, sched, &commstats.CommunityStatOptions{
+		CommunityStat:       true,
+		CommunityStatHttp:   true,
+		GithubRepositories:  []string{repository},
+		GithubStatInterval:  60,
+		RedditStatInterval:  60,
+		TwitterStatInterval: 60,
+		YoutubeStatInterval: 60,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	testutil.WaitForJob(t, sched, "commstats-github", 5*time.Second)
+
+	var data struct {
+		Stats []commstats.Github `json:"stats"`
+		Total int64              `json:"total"`
+	}
+	server.GetJSON("/getCommunityStat?platform=GitHub&repository="+repository, &data)
+	if data.Total != 1 || len(data.Stats) != 1 {
+		t.Fatalf("got %d of %d stats, want 1", len(data.Stats), data.Total)
+	}
+	if stat := data.Stats[0]; stat.Repository != repository || stat.Stars != 610 || stat.Folks != 250 {
+		t.Errorf("unexpected stat %+v", stat)
+	}
+}
@@ -2,64 +2,20 @@ package commstats
 
 import (
 	"context"
-	"database/sql"
 	"encoding/json"
 	"fmt"
 	"net/http"
-	"time"
 
-	"github.com/planetdecred/pdanalytics/app"
 	"github.com/planetdecred/pdanalytics/app/helpers"
 )
 
-func (c *Collector) startGithubCollector(ctx context.Context) {
-	var lastCollectionDate time.Time
-	err := c.dataStore.LastEntry(ctx, "github", &lastCollectionDate)
-	if err != nil && err != sql.ErrNoRows {
-		log.Errorf("Cannot fetch last Github entry time, %s", err.Error())
-		return
-	}
-
-	secondsPassed := time.Since(lastCollectionDate)
-	period := time.Duration(c.options.TwitterStatInterval) * time.Minute
-
-	if secondsPassed < period {
-		timeLeft := period - secondsPassed
-		log.Infof("Fetching Github stats every %dm, collected %s ago, will fetch in %s.", period/time.Minute, helpers.DurationToString(secondsPassed),
-			helpers.DurationToString(timeLeft))
-
-		time.Sleep(timeLeft)
-	}
-
-	registerStarter := func() {
-		app.MarkBusyIfFree()
-	}
-
-	registerStarter()
-	c.collectAndStoreGithubStat(ctx)
-	app.ReleaseForNewModule()
-
-	ticker := time.NewTicker(time.Duration(c.options.TwitterStatInterval) * time.Minute)
-	for {
-		select {
-		case <-ctx.Done():
-			return
-		case <-ticker.C:
-			registerStarter()
-			c.collectAndStoreGithubStat(ctx)
-			app.ReleaseForNewModule()
-		}
-	}
-}
-
-func (c *Collector) collectAndStoreGithubStat(ctx context.Context) {
+func (c *Collector) collectAndStoreGithubStat(ctx context.Context) error {
 	log.Info("Starting Github stats collection cycle")
 	for _, repo := range c.options.GithubRepositories {
 		githubStars, githubFolks, err := c.getGithubData(ctx, repo)
 		for retry := 0; err != nil; retry++ {
 			if retry == retryLimit {
-				log.Error(err)
-				return
+				return err
 			}
 			log.Warn(err)
 			githubStars, githubFolks, err = c.getGithubData(ctx, repo)
@@ -73,13 +29,13 @@ func (c *Collector) collectAndStoreGithubStat(ctx context.Context) {
 		}
 		err = c.dataStore.StoreGithubStat(ctx, githubStat)
 		if err != nil {
-			log.Error("Unable to save Github stat, %s", err.Error())
-			return
+			return fmt.Errorf("Unable to save Github stat, %s", err.Error())
 		}
 
 		log.Infof("New Github stat collected for %s at %s, Stars %d, Folks %d", repo,
 			githubStat.Date.Format(dateMiliTemplate), githubStars, githubFolks)
 	}
+	return nil
 }
 
 func (c *Collector) getGithubData(ctx context.Context, repository string) (int, int, error) {
@@ -0,0 +1,85 @@
+package commstats
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/decred/slog"
+	"github.com/planetdecred/pdanalytics/module"
+	"github.com/planetdecred/pdanalytics/scheduler"
+	"github.com/planetdecred/pdanalytics/web"
+)
+
+const (
+	defaultRedditInterval      = 60
+	defaultTwitterStatInterval = 60 * 24
+	defaultGithubStatInterval  = 60 * 24
+	defaultYoutubeInterval     = 60 * 24
+)
+
+var (
+	defaultSubreddits          = []string{"decred"}
+	defaultTwitterHandles      = []string{"decredproject"}
+	defaultGithubRepositories  = []string{"decred/dcrd", "decred/dcrdata", "decred/dcrwallet", "decred/politeia", "decred/decrediton"}
+	defaultYoutubeChannelNames = []string{"Decred"}
+	defaultYoutubeChannelId    = []string{"UCJ2bYDaPYHpSmJPh_M5dNSg"}
+)
+
+type commstatsModule struct {
+	options CommunityStatOptions
+	server  *web.Server
+	sched   *scheduler.Scheduler
+	store   DataStore
+}
+
+func init() {
+	module.Register(&commstatsModule{
+		options: CommunityStatOptions{
+			CommunityStat:       true,
+			CommunityStatHttp:   true,
+			RedditStatInterval:  defaultRedditInterval,
+			Subreddit:           defaultSubreddits,
+			TwitterStatInterval: defaultTwitterStatInterval,
+			TwitterHandles:      defaultTwitterHandles,
+			GithubStatInterval:  defaultGithubStatInterval,
+			GithubRepositories:  defaultGithubRepositories,
+			YoutubeStatInterval: defaultYoutubeInterval,
+			YoutubeChannelName:  defaultYoutubeChannelNames,
+			YoutubeChannelId:    defaultYoutubeChannelId,
+		},
+	})
+}
+
+func (m *commstatsModule) Name() string                 { return "commstats" }
+func (m *commstatsModule) LogSubsystem() string         { return "COMM" }
+func (m *commstatsModule) UseLogger(logger slog.Logger) { UseLogger(logger) }
+func (m *commstatsModule) Options() interface{}         { return &m.options }
+
+func (m *commstatsModule) Enabled() bool {
+	return m.options.CommunityStat || m.options.CommunityStatHttp
+}
+
+func (m *commstatsModule) Init(deps *module.Deps) error {
+	db, err := deps.DB()
+	if err != nil {
+		return err
+	}
+	store, ok := db.(DataStore)
+	if !ok {
+		return fmt.Errorf("%T is not a commstats.DataStore", db)
+	}
+	m.server = deps.Server
+	m.sched = deps.Scheduler
+	m.store = store
+	return nil
+}
+
+func (m *commstatsModule) Start(ctx context.Context) error {
+	return Activate(ctx, m.store, m.server, m.sched, &m.options)
+}
+
+func (m *commstatsModule) Stop() error { return nil }
+
+func (m *commstatsModule) Health() module.Health {
+	return module.JobsHealth(m.sched, "commstats")
+}
@@ -2,13 +2,10 @@ package commstats
 
 import (
 	"context"
-	"database/sql"
 	"encoding/json"
 	"fmt"
 	"net/http"
-	"time"
 
-	"github.com/planetdecred/pdanalytics/app"
 	"github.com/planetdecred/pdanalytics/app/helpers"
 )
 
@@ -16,48 +13,7 @@ const (
 	redditRequestURL = "https://www.reddit.com/r/%s/about.json"
 )
 
-func (c *Collector) startRedditCollector(ctx context.Context) {
-	var lastCollectionDate time.Time
-	err := c.dataStore.LastEntry(ctx, "reddit", &lastCollectionDate)
-	if err != nil && err != sql.ErrNoRows {
-		log.Errorf("Cannot fetch last Reddit entry time, %s", err.Error())
-		return
-	}
-
-	secondsPassed := time.Since(lastCollectionDate)
-	period := time.Duration(c.options.TwitterStatInterval) * time.Minute
-
-	if secondsPassed < period {
-		timeLeft := period - secondsPassed
-		log.Infof("Fetching Reddit stats every %dm, collected %s ago, will fetch in %s.", period/time.Minute, helpers.DurationToString(secondsPassed),
-			helpers.DurationToString(timeLeft))
-
-		time.Sleep(timeLeft)
-	}
-
-	registerStarter := func() {
-		// continually check the state of the app until its free to run this module
-		app.MarkBusyIfFree()
-	}
-
-	registerStarter()
-	c.collectAndStoreRedditStat(ctx)
-	app.ReleaseForNewModule()
-
-	ticker := time.NewTicker(time.Duration(c.options.RedditStatInterval) * time.Minute)
-	for {
-		select {
-		case <-ctx.Done():
-			return
-		case <-ticker.C:
-			registerStarter()
-			c.collectAndStoreRedditStat(ctx)
-			app.ReleaseForNewModule()
-		}
-	}
-}
-
-func (c *Collector) collectAndStoreRedditStat(ctx context.Context) {
+func (c *Collector) collectAndStoreRedditStat(ctx context.Context) error {
 	log.Info("Starting Reddit stats collection cycle")
 
 	for _, subreddit := range c.options.Subreddit {
@@ -65,8 +21,7 @@ func (c *Collector) collectAndStoreRedditStat(ctx context.Context) {
 		resp, err := c.fetchRedditStat(ctx, subreddit)
 		for retry := 0; err != nil; retry++ {
 			if retry == retryLimit {
-				log.Error(err)
-				return
+				return err
 			}
 			log.Warn(err)
 			resp, err = c.fetchRedditStat(ctx, subreddit)
@@ -79,12 +34,12 @@ func (c *Collector) collectAndStoreRedditStat(ctx context.Context) {
 			Subreddit:      subreddit,
 		})
 		if err != nil {
-			log.Error("Unable to save reddit stat, %s", err.Error())
-			return
+			return fmt.Errorf("Unable to save reddit stat, %s", err.Error())
 		}
 		log.Infof("New Reddit stat collected for %s at %s, Subscribers  %d, Active Users %d", subreddit,
 			helpers.NowUTC().Format(dateMiliTemplate), resp.Data.Subscribers, resp.Data.AccountsActive)
 	}
+	return nil
 }
 
 func (c *Collector) fetchRedditStat(ctx context.Context, subreddit string) (response *RedditResponse, err error) {
@@ -2,14 +2,11 @@ package commstats
 
 import (
 	"context"
-	"database/sql"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
-	"time"
 
-	"github.com/planetdecred/pdanalytics/app"
 	"github.com/planetdecred/pdanalytics/app/helpers"
 )
 
@@ -17,55 +14,13 @@ const (
 	twitterRequestURL = "https://cdn.syndication.twimg.com/widgets/followbutton/info.json?screen_names=%s"
 )
 
-func (c *Collector) startTwitterCollector(ctx context.Context) {
-	var lastCollectionDate time.Time
-	err := c.dataStore.LastEntry(ctx, "twitter", &lastCollectionDate)
-	if err != nil && err != sql.ErrNoRows {
-		log.Errorf("Cannot fetch last twitter entry time, %s", err.Error())
-		return
-	}
-
-	secondsPassed := time.Since(lastCollectionDate)
-	period := time.Duration(c.options.TwitterStatInterval) * time.Minute
-
-	if secondsPassed < period {
-		timeLeft := period - secondsPassed
-		log.Infof("Fetching Twitter stats every %dm, collected %s ago, will fetch in %s.", period/time.Minute, helpers.DurationToString(secondsPassed),
-			helpers.DurationToString(timeLeft))
-
-		time.Sleep(timeLeft)
-	}
-
-	registerStarter := func() {
-		// continually check the state of the app until its free to run this module
-		app.MarkBusyIfFree()
-	}
-
-	registerStarter()
-	c.collectAndStoreTwitterStat(ctx)
-	app.ReleaseForNewModule()
-
-	ticker := time.NewTicker(time.Duration(c.options.TwitterStatInterval) * time.Minute)
-	for {
-		select {
-		case <-ctx.Done():
-			return
-		case <-ticker.C:
-			registerStarter()
-			c.collectAndStoreTwitterStat(ctx)
-			app.ReleaseForNewModule()
-		}
-	}
-}
-
-func (c *Collector) collectAndStoreTwitterStat(ctx context.Context) {
+func (c *Collector) collectAndStoreTwitterStat(ctx context.Context) error {
 	log.Info("Starting Twitter stats collection cycle")
 	for _, handle := range c.options.TwitterHandles {
 		followers, err := c.getTwitterFollowers(ctx, handle)
 		for retry := 0; err != nil; retry++ {
 			if retry == retryLimit {
-				log.Error(err)
-				return
+				return err
 			}
 			log.Warn(err)
 			followers, err = c.getTwitterFollowers(ctx, handle)
@@ -74,13 +29,13 @@ func (c *Collector) collectAndStoreTwitterStat(ctx context.Context) {
 		var twitterStat = Twitter{Date: helpers.NowUTC(), Followers: followers, Handle: handle}
 		err = c.dataStore.StoreTwitterStat(ctx, twitterStat)
 		if err != nil {
-			log.Error("Unable to save twitter stat, %s", err.Error())
-			return
+			return fmt.Errorf("Unable to save twitter stat, %s", err.Error())
 		}
 
 		log.Infof("New Twitter stat collected for %s at %s, Followers %d", handle,
 			twitterStat.Date.Format(dateMiliTemplate), twitterStat.Followers)
 	}
+	return nil
 }
 
 func (c *Collector) getTwitterFollowers(ctx context.Context, handle string) (int, error) {
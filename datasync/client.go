@@ -0,0 +1,89 @@
+package datasync
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/planetdecred/pdanalytics/app/helpers"
+)
+
+// Puller pulls the synced tables from an upstream pdanalytics instance.
+type Puller struct {
+	source   string
+	store    DataStore
+	client   *http.Client
+	pageSize int
+}
+
+// NewPuller returns a puller of the instance at the source base URL, e.g.
+// https://analytics.example.org.
+func NewPuller(source string, store DataStore) *Puller {
+	return &Puller{
+		source:   strings.TrimSuffix(source, "/"),
+		store:    store,
+		client:   &http.Client{Timeout: time.Minute},
+		pageSize: defaultPageSize,
+	}
+}
+
+// Pull syncs the tables in order, each from the cursor saved by the previous
+// pull. It stops at the first table that fails, as the ticks need their
+// exchange or VSP.
+func (p *Puller) Pull(ctx context.Context) error {
+	for _, t := range tables {
+		if err := p.pullTable(ctx, t); err != nil {
+			return fmt.Errorf("syncing %s from %s failed: %v", t.name, p.source, err)
+		}
+	}
+	return nil
+}
+
+// pullTable saves the pages of records of the table until it has them all,
+// saving the cursor after every page so an interrupted sync resumes from
+// there.
+func (p *Puller) pullTable(ctx context.Context, t table) error {
+	after, err := p.store.SyncCursor(ctx, p.source, t.name)
+	if err != nil {
+		return err
+	}
+
+	var synced int
+	for {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		page := Page{Records: t.records()}
+		url := fmt.Sprintf("%s/api/sync/%s?after=%d&limit=%d", p.source, t.name, after, p.pageSize)
+		if err = helpers.GetResponse(ctx, p.client, url, &page); err != nil {
+			return err
+		}
+		if page.Error != "" {
+			return fmt.Errorf("upstream error: %s", page.Error)
+		}
+
+		n, err := t.save(ctx, p.store, page.Records)
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			break
+		}
+		after = page.Next
+		if err = p.store.SaveSyncCursor(ctx, p.source, t.name, after); err != nil {
+			return err
+		}
+		synced += n
+		log.Debugf("Synced %d %s records from %s, %d remaining", n, t.name, p.source, page.Remaining)
+		if page.Remaining <= 0 {
+			break
+		}
+	}
+
+	if synced > 0 {
+		log.Infof("Synced %d %s records from %s", synced, t.name, p.source)
+	}
+	return nil
+}
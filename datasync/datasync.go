@@ -0,0 +1,203 @@
+// Package datasync shares the exchange, PoW and VSP history between
+// pdanalytics instances. An instance serves the records of the synced tables
+// after a cursor on /api/sync/{table}, and pulls them from upstream instances,
+// resuming from the cursor of the last record it synced.
+package datasync
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/planetdecred/pdanalytics/exchanges/ticks"
+	"github.com/planetdecred/pdanalytics/pow"
+	"github.com/planetdecred/pdanalytics/vsp"
+)
+
+const (
+	defaultPageSize = 1000
+	maxPageSize     = 5000
+)
+
+// DataStore reads and saves the records of the synced tables, and the sync
+// cursors. The *ForSync methods return the records after a cursor, ordered by
+// cursor, and the number of records after the cursor. The *FromSync methods
+// ignore the records already stored.
+type DataStore interface {
+	FetchExchangeForSync(ctx context.Context, lastID int, skip, take int) ([]ticks.ExchangeData, int64, error)
+	SaveExchangeFromSync(ctx context.Context, exchangeData interface{}) error
+	FetchExchangeTicksForSync(ctx context.Context, lastID int, skip, take int) ([]ticks.TickSyncDto, int64, error)
+	SaveExchangeTickFromSync(ctx context.Context, tickData interface{}) error
+	FetchPowDataForSync(ctx context.Context, date int64, skip, take int) ([]pow.PowData, int64, error)
+	AddPowDataFromSync(ctx context.Context, data interface{}) error
+	FetchVspSourcesForSync(ctx context.Context, lastID int64, skip, take int) ([]vsp.VSPDto, int64, error)
+	AddVspSourceFromSync(ctx context.Context, vspData interface{}) error
+	FetchVspTicksForSync(ctx context.Context, lastID int64, skip, take int) ([]vsp.VSPTickSyncDto, int64, error)
+	AddVspTickFromSync(ctx context.Context, tickData interface{}) error
+
+	// SyncCursor returns the cursor of the last record of table synced from
+	// source, or 0 if none was.
+	SyncCursor(ctx context.Context, source, table string) (int64, error)
+	SaveSyncCursor(ctx context.Context, source, table string, cursor int64) error
+}
+
+// Page is a page of the records of a table after a cursor.
+type Page struct {
+	Records interface{} `json:"records"`
+	// Next is the cursor of the last record of the page, to request the
+	// next page with. It is the requested cursor when the page is empty.
+	Next int64 `json:"next"`
+	// Remaining is the number of records after the page.
+	Remaining int64  `json:"remaining"`
+	Error     string `json:"error,omitempty"`
+}
+
+// table is a synced table.
+type table struct {
+	name string
+	// fetch returns up to limit records after the cursor.
+	fetch func(ctx context.Context, store DataStore, after int64, limit int) (Page, error)
+	// records returns a pointer to an empty slice of the records of the
+	// table, to decode a page into.
+	records func() interface{}
+	// save stores the records decoded into the value returned by records and
+	// returns their number.
+	save func(ctx context.Context, store DataStore, records interface{}) (int, error)
+}
+
+// tables are the synced tables, the exchanges and VSPs before their ticks.
+var tables = []table{
+	{
+		name: "exchange",
+		fetch: func(ctx context.Context, store DataStore, after int64, limit int) (Page, error) {
+			exchanges, total, err := store.FetchExchangeForSync(ctx, int(after), 0, limit)
+			page := Page{Records: exchanges, Next: after, Remaining: total - int64(len(exchanges))}
+			if len(exchanges) > 0 {
+				page.Next = int64(exchanges[len(exchanges)-1].ID)
+			}
+			return page, err
+		},
+		records: func() interface{} { return &[]ticks.ExchangeData{} },
+		save: func(ctx context.Context, store DataStore, records interface{}) (int, error) {
+			exchanges := *records.(*[]ticks.ExchangeData)
+			for _, exchange := range exchanges {
+				if err := store.SaveExchangeFromSync(ctx, exchange); err != nil {
+					return 0, err
+				}
+			}
+			return len(exchanges), nil
+		},
+	},
+	{
+		name: "exchange_tick",
+		fetch: func(ctx context.Context, store DataStore, after int64, limit int) (Page, error) {
+			xcTicks, total, err := store.FetchExchangeTicksForSync(ctx, int(after), 0, limit)
+			page := Page{Records: xcTicks, Next: after, Remaining: total - int64(len(xcTicks))}
+			if len(xcTicks) > 0 {
+				page.Next = int64(xcTicks[len(xcTicks)-1].ID)
+			}
+			return page, err
+		},
+		records: func() interface{} { return &[]ticks.TickSyncDto{} },
+		save: func(ctx context.Context, store DataStore, records interface{}) (int, error) {
+			xcTicks := *records.(*[]ticks.TickSyncDto)
+			for _, tick := range xcTicks {
+				if err := store.SaveExchangeTickFromSync(ctx, tick); err != nil {
+					return 0, err
+				}
+			}
+			return len(xcTicks), nil
+		},
+	},
+	{
+		name:    "pow_data",
+		fetch:   fetchPowPage,
+		records: func() interface{} { return &[]pow.PowData{} },
+		save: func(ctx context.Context, store DataStore, records interface{}) (int, error) {
+			data := *records.(*[]pow.PowData)
+			for _, entry := range data {
+				if err := store.AddPowDataFromSync(ctx, entry); err != nil {
+					return 0, err
+				}
+			}
+			return len(data), nil
+		},
+	},
+	{
+		name: "vsp",
+		fetch: func(ctx context.Context, store DataStore, after int64, limit int) (Page, error) {
+			vsps, total, err := store.FetchVspSourcesForSync(ctx, after, 0, limit)
+			page := Page{Records: vsps, Next: after, Remaining: total - int64(len(vsps))}
+			if len(vsps) > 0 {
+				page.Next = int64(vsps[len(vsps)-1].ID)
+			}
+			return page, err
+		},
+		records: func() interface{} { return &[]vsp.VSPDto{} },
+		save: func(ctx context.Context, store DataStore, records interface{}) (int, error) {
+			vsps := *records.(*[]vsp.VSPDto)
+			for _, source := range vsps {
+				if err := store.AddVspSourceFromSync(ctx, source); err != nil {
+					return 0, err
+				}
+			}
+			return len(vsps), nil
+		},
+	},
+	{
+		name: "vsp_tick",
+		fetch: func(ctx context.Context, store DataStore, after int64, limit int) (Page, error) {
+			vspTicks, total, err := store.FetchVspTicksForSync(ctx, after, 0, limit)
+			page := Page{Records: vspTicks, Next: after, Remaining: total - int64(len(vspTicks))}
+			if len(vspTicks) > 0 {
+				page.Next = int64(vspTicks[len(vspTicks)-1].ID)
+			}
+			return page, err
+		},
+		records: func() interface{} { return &[]vsp.VSPTickSyncDto{} },
+		save: func(ctx context.Context, store DataStore, records interface{}) (int, error) {
+			vspTicks := *records.(*[]vsp.VSPTickSyncDto)
+			for _, tick := range vspTicks {
+				if err := store.AddVspTickFromSync(ctx, tick); err != nil {
+					return 0, err
+				}
+			}
+			return len(vspTicks), nil
+		},
+	},
+}
+
+// fetchPowPage returns the PoW entries after the cursor time. The entries
+// are keyed by time and source, so the entries of the last time of a full
+// page are left to the next page, which keeps the entries of a time in a
+// single page.
+func fetchPowPage(ctx context.Context, store DataStore, after int64, limit int) (Page, error) {
+	data, total, err := store.FetchPowDataForSync(ctx, after, 0, limit)
+	if err != nil {
+		return Page{}, err
+	}
+	if len(data) == limit {
+		last := len(data)
+		for last > 0 && data[last-1].Time == data[len(data)-1].Time {
+			last--
+		}
+		// A page of a single time is kept whole.
+		if last > 0 {
+			data = data[:last]
+		}
+	}
+	page := Page{Records: data, Next: after, Remaining: total - int64(len(data))}
+	if len(data) > 0 {
+		page.Next = data[len(data)-1].Time
+	}
+	return page, nil
+}
+
+// findTable returns the synced table of the given name.
+func findTable(name string) (table, error) {
+	for _, t := range tables {
+		if t.name == name {
+			return t, nil
+		}
+	}
+	return table{}, fmt.Errorf("unknown sync table %q", name)
+}
@@ -0,0 +1,173 @@
+package datasync
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi"
+	"github.com/planetdecred/pdanalytics/exchanges/ticks"
+	"github.com/planetdecred/pdanalytics/pow"
+	"github.com/planetdecred/pdanalytics/vsp"
+)
+
+// testStore holds the records of a single exchange and VSP and the PoW
+// entries, and records what is saved.
+type testStore struct {
+	xcTicks  []ticks.TickSyncDto
+	powData  []pow.PowData
+	vspTicks []vsp.VSPTickSyncDto
+
+	savedXcTicks  int
+	savedPowData  []pow.PowData
+	savedVspTicks int
+	cursors       map[string]int64
+}
+
+func (s *testStore) FetchExchangeForSync(_ context.Context, lastID int, _, _ int) ([]ticks.ExchangeData, int64, error) {
+	if lastID >= 1 {
+		return nil, 0, nil
+	}
+	return []ticks.ExchangeData{{ID: 1, Name: "binance"}}, 1, nil
+}
+
+func (s *testStore) SaveExchangeFromSync(context.Context, interface{}) error { return nil }
+
+func (s *testStore) FetchExchangeTicksForSync(_ context.Context, lastID int, _, take int) ([]ticks.TickSyncDto, int64, error) {
+	var result []ticks.TickSyncDto
+	var total int64
+	for _, tick := range s.xcTicks {
+		if tick.ID > lastID {
+			total++
+			if len(result) < take {
+				result = append(result, tick)
+			}
+		}
+	}
+	return result, total, nil
+}
+
+func (s *testStore) SaveExchangeTickFromSync(context.Context, interface{}) error {
+	s.savedXcTicks++
+	return nil
+}
+
+func (s *testStore) FetchPowDataForSync(_ context.Context, date int64, _, take int) ([]pow.PowData, int64, error) {
+	var result []pow.PowData
+	var total int64
+	for _, entry := range s.powData {
+		if entry.Time > date {
+			total++
+			if len(result) < take {
+				result = append(result, entry)
+			}
+		}
+	}
+	return result, total, nil
+}
+
+func (s *testStore) AddPowDataFromSync(_ context.Context, data interface{}) error {
+	s.savedPowData = append(s.savedPowData, data.(pow.PowData))
+	return nil
+}
+
+func (s *testStore) FetchVspSourcesForSync(context.Context, int64, int, int) ([]vsp.VSPDto, int64, error) {
+	return nil, 0, nil
+}
+
+func (s *testStore) AddVspSourceFromSync(context.Context, interface{}) error { return nil }
+
+func (s *testStore) FetchVspTicksForSync(_ context.Context, lastID int64, _, take int) ([]vsp.VSPTickSyncDto, int64, error) {
+	var result []vsp.VSPTickSyncDto
+	var total int64
+	for _, tick := range s.vspTicks {
+		if int64(tick.ID) > lastID {
+			total++
+			if len(result) < take {
+				result = append(result, tick)
+			}
+		}
+	}
+	return result, total, nil
+}
+
+func (s *testStore) AddVspTickFromSync(context.Context, interface{}) error {
+	s.savedVspTicks++
+	return nil
+}
+
+func (s *testStore) SyncCursor(_ context.Context, source, table string) (int64, error) {
+	return s.cursors[source+" "+table], nil
+}
+
+func (s *testStore) SaveSyncCursor(_ context.Context, source, table string, cursor int64) error {
+	if s.cursors == nil {
+		s.cursors = make(map[string]int64)
+	}
+	s.cursors[source+" "+table] = cursor
+	return nil
+}
+
+func TestFetchPowPage(t *testing.T) {
+	store := &testStore{powData: []pow.PowData{
+		{Time: 10, Source: "a"}, {Time: 20, Source: "a"}, {Time: 20, Source: "b"}, {Time: 30, Source: "a"},
+	}}
+	page, err := fetchPowPage(context.Background(), store, 0, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data := page.Records.([]pow.PowData); len(data) != 1 || page.Next != 10 || page.Remaining != 3 {
+		t.Fatalf("got %d entries, next %d, %d remaining, want 1, 10, 3", len(data), page.Next, page.Remaining)
+	}
+
+	// A page of a single time is not split.
+	page, err = fetchPowPage(context.Background(), store, 10, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data := page.Records.([]pow.PowData); len(data) != 2 || page.Next != 20 || page.Remaining != 1 {
+		t.Fatalf("got %d entries, next %d, %d remaining, want 2, 20, 1", len(data), page.Next, page.Remaining)
+	}
+}
+
+func TestPull(t *testing.T) {
+	upstream := &testStore{
+		xcTicks:  []ticks.TickSyncDto{{ID: 3}, {ID: 5}, {ID: 8}},
+		powData:  []pow.PowData{{Time: 10, Source: "a", PoolHashrate: 5e12}, {Time: 10, Source: "b"}, {Time: 20, Source: "a"}},
+		vspTicks: []vsp.VSPTickSyncDto{{ID: 1, VSP: "stakey"}},
+	}
+	router := chi.NewRouter()
+	router.Get("/api/sync/{table}", tableHandler(upstream))
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	local := &testStore{}
+	puller := NewPuller(server.URL+"/", local)
+	puller.pageSize = 2
+	if err := puller.Pull(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if local.savedXcTicks != 3 || len(local.savedPowData) != 3 || local.savedVspTicks != 1 {
+		t.Fatalf("saved %d exchange ticks, %d PoW entries and %d VSP ticks, want 3, 3 and 1",
+			local.savedXcTicks, len(local.savedPowData), local.savedVspTicks)
+	}
+	if local.savedPowData[0].PoolHashrate != 5e12 {
+		t.Errorf("got pool hashrate %v, want 5e12", local.savedPowData[0].PoolHashrate)
+	}
+	if cursor := local.cursors[server.URL+" exchange_tick"]; cursor != 8 {
+		t.Errorf("got exchange tick cursor %d, want 8", cursor)
+	}
+	if cursor := local.cursors[server.URL+" pow_data"]; cursor != 20 {
+		t.Errorf("got PoW cursor %d, want 20", cursor)
+	}
+
+	// The next pull resumes from the cursors.
+	upstream.xcTicks = append(upstream.xcTicks, ticks.TickSyncDto{ID: 9})
+	if err := puller.Pull(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if local.savedXcTicks != 4 || len(local.savedPowData) != 3 {
+		t.Fatalf("saved %d exchange ticks and %d PoW entries, want 4 and 3",
+			local.savedXcTicks, len(local.savedPowData))
+	}
+}
@@ -0,0 +1,107 @@
+package datasync
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/decred/slog"
+	"github.com/planetdecred/pdanalytics/module"
+	"github.com/planetdecred/pdanalytics/scheduler"
+	"github.com/planetdecred/pdanalytics/web"
+)
+
+const defaultSyncInterval = 60
+
+// SyncOptions are the config options of the sync module.
+type SyncOptions struct {
+	EnableSyncServer bool     `long:"syncserver" description:"Serve the exchange, PoW and VSP history to other pdanalytics instances on /api/sync/{table}"`
+	SyncSources      []string `long:"syncsource" description:"Base URL of an upstream pdanalytics instance to pull the exchange, PoW and VSP history from, e.g. https://analytics.example.org. May be repeated."`
+	SyncInterval     int64    `long:"syncinterval" description:"Interval in minutes between two pulls from the sync sources"`
+}
+
+type syncModule struct {
+	options SyncOptions
+	server  *web.Server
+	sched   *scheduler.Scheduler
+	store   DataStore
+}
+
+func init() {
+	module.Register(&syncModule{
+		options: SyncOptions{
+			SyncInterval: defaultSyncInterval,
+		},
+	})
+}
+
+func (m *syncModule) Name() string                 { return "sync" }
+func (m *syncModule) LogSubsystem() string         { return "SYNC" }
+func (m *syncModule) UseLogger(logger slog.Logger) { UseLogger(logger) }
+func (m *syncModule) Options() interface{}         { return &m.options }
+func (m *syncModule) Enabled() bool {
+	return m.options.EnableSyncServer || len(m.options.SyncSources) > 0
+}
+
+// DependsOn returns the modules whose tables are synced.
+func (m *syncModule) DependsOn() []string { return []string{"exchanges", "pow", "vsp"} }
+
+func (m *syncModule) Init(deps *module.Deps) error {
+	if m.options.SyncInterval <= 0 {
+		return fmt.Errorf("invalid sync interval %d", m.options.SyncInterval)
+	}
+	for _, source := range m.options.SyncSources {
+		u, err := url.Parse(source)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("invalid sync source %q, expected an http(s) base URL", source)
+		}
+	}
+	db, err := deps.DB()
+	if err != nil {
+		return err
+	}
+	store, ok := db.(DataStore)
+	if !ok {
+		return fmt.Errorf("%T is not a datasync.DataStore", db)
+	}
+	m.server = deps.Server
+	m.sched = deps.Scheduler
+	m.store = store
+	return nil
+}
+
+func (m *syncModule) Start(ctx context.Context) error {
+	if m.options.EnableSyncServer {
+		m.server.AddRoute("/api/sync/{table}", web.GET, tableHandler(m.store))
+	}
+
+	interval := time.Duration(m.options.SyncInterval) * time.Minute
+	for i, source := range m.options.SyncSources {
+		puller := NewPuller(source, m.store)
+		err := m.sched.Register(scheduler.Job{
+			Name:     fmt.Sprintf("sync-%d", i),
+			Interval: interval,
+			Jitter:   interval / 10,
+			// The pulls from several sources write the same tables,
+			// one at a time.
+			Class:   "sync",
+			CatchUp: scheduler.CatchUpSkip,
+			Run:     puller.Pull,
+		})
+		if err != nil {
+			return err
+		}
+		log.Infof("Pulling the exchange, PoW and VSP history from %s every %v", source, interval)
+	}
+	return nil
+}
+
+func (m *syncModule) Stop() error { return nil }
+
+func (m *syncModule) Health() module.Health {
+	if len(m.options.SyncSources) == 0 {
+		return module.Healthy
+	}
+	return module.JobsHealth(m.sched, "sync")
+}
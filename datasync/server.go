@@ -0,0 +1,44 @@
+package datasync
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi"
+	"github.com/planetdecred/pdanalytics/web"
+)
+
+// tableHandler serves the records of a synced table after the cursor given by
+// the after parameter, ordered by cursor, up to limit records.
+// /api/sync/{table}?after=&limit=
+func tableHandler(store DataStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		t, err := findTable(chi.URLParam(r, "table"))
+		if err != nil {
+			w.WriteHeader(http.StatusNotFound)
+			web.RenderJSON(w, Page{Error: err.Error()})
+			return
+		}
+
+		after, err := strconv.ParseInt(r.FormValue("after"), 10, 64)
+		if err != nil {
+			after = 0
+		}
+		limit, err := strconv.Atoi(r.FormValue("limit"))
+		if err != nil || limit <= 0 {
+			limit = defaultPageSize
+		}
+		if limit > maxPageSize {
+			limit = maxPageSize
+		}
+
+		page, err := t.fetch(r.Context(), store, after, limit)
+		if err != nil {
+			log.Errorf("Cannot fetch the %s records after %d: %v", t.name, after, err)
+			w.WriteHeader(http.StatusInternalServerError)
+			web.RenderJSON(w, Page{Error: "cannot fetch the " + t.name + " records"})
+			return
+		}
+		web.RenderJSON(w, page)
+	}
+}
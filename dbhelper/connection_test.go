@@ -0,0 +1,37 @@
+package dbhelper
+
+import (
+	"testing"
+	"time"
+)
+
+func TestConnString(t *testing.T) {
+	tests := []struct {
+		name string
+		opts ConnOptions
+		want string
+	}{{
+		name: "fields",
+		opts: ConnOptions{Host: "localhost", Port: "5432", User: "postgres", Pass: "my pass", Name: "pdanalytics"},
+		want: "host=localhost user=postgres dbname=pdanalytics sslmode=disable password='my pass' port=5432",
+	}, {
+		name: "unix socket and certificates",
+		opts: ConnOptions{Host: "/run/postgresql", User: "postgres", Name: "pdanalytics", SSLMode: "verify-full",
+			SSLRootCert: "/etc/ssl/ca.pem"},
+		want: "host=/run/postgresql user=postgres dbname=pdanalytics sslmode=verify-full sslrootcert=/etc/ssl/ca.pem",
+	}, {
+		name: "url",
+		opts: ConnOptions{DSN: "postgres://postgres@db/pdanalytics?sslmode=require", Host: "ignored",
+			QueryTimeout: 30 * time.Second},
+		want: "postgres://postgres@db/pdanalytics?sslmode=require&statement_timeout=30000",
+	}, {
+		name: "key values",
+		opts: ConnOptions{DSN: "host=db dbname=pdanalytics", QueryTimeout: time.Second},
+		want: "host=db dbname=pdanalytics statement_timeout=1000",
+	}}
+	for _, test := range tests {
+		if got := test.opts.connString(); got != test.want {
+			t.Errorf("%s: got %q, want %q", test.name, got, test.want)
+		}
+	}
+}
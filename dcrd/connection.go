@@ -0,0 +1,248 @@
+package dcrd
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"time"
+
+	"github.com/decred/dcrd/chaincfg/v2"
+	"github.com/decred/dcrd/rpcclient/v5"
+)
+
+const (
+	// minReconnectDelay is the time waited after a failed attempt to connect
+	// to all the configured nodes. The delay is doubled after every failed
+	// round up to maxReconnectDelay.
+	minReconnectDelay = 2 * time.Second
+	maxReconnectDelay = 2 * time.Minute
+)
+
+// ConnectionState describes the state of the websocket connection to dcrd.
+type ConnectionState int
+
+const (
+	Disconnected ConnectionState = iota
+	Connected
+)
+
+func (s ConnectionState) String() string {
+	switch s {
+	case Connected:
+		return "connected"
+	default:
+		return "disconnected"
+	}
+}
+
+// ConnectionStateHandler is a function that will be called when the
+// connection to dcrd is lost or re-established.
+type ConnectionStateHandler func(ConnectionState)
+
+// NodeConfig holds the address, credentials and certificate of a dcrd RPC
+// server.
+type NodeConfig struct {
+	Host       string
+	User       string
+	Pass       string
+	CertFile   string
+	DisableTLS bool
+}
+
+// Connect dials the given dcrd nodes in order and returns a *Dcrd using the
+// first node that accepts the connection and runs on the network described by
+// params. The notifier's handlers are registered with every client created,
+// including the ones created by Monitor after a disconnect.
+func Connect(ctx context.Context, nodes []NodeConfig, params *chaincfg.Params, notifier *Notifier) (*Dcrd, error) {
+	if len(nodes) == 0 {
+		return nil, fmt.Errorf("no dcrd node configured")
+	}
+
+	d := &Dcrd{
+		Params: params,
+		Notif:  notifier,
+		ctx:    ctx,
+		nodes:  nodes,
+	}
+
+	var err error
+	for i := range nodes {
+		var client *rpcclient.Client
+		if client, err = d.dial(i); err != nil {
+			log.Errorf("Unable to connect to dcrd at %s: %v", nodes[i].Host, err)
+			continue
+		}
+		d.current = i
+		d.rpc = client
+		d.state = Connected
+		return d, nil
+	}
+	return nil, err
+}
+
+// dial connects to the node at index i and checks its network. Auto reconnect
+// is disabled on the client so that a lost connection shuts it down, letting
+// Monitor decide whether to re-dial the same node or fail over.
+func (d *Dcrd) dial(i int) (*rpcclient.Client, error) {
+	node := d.nodes[i]
+
+	var certs []byte
+	if !node.DisableTLS {
+		var err error
+		certs, err = ioutil.ReadFile(node.CertFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read dcrd cert file at %s: %v", node.CertFile, err)
+		}
+		log.Debugf("Attempting to connect to dcrd RPC %s as user %s "+
+			"using certificate located in %s", node.Host, node.User, node.CertFile)
+	} else {
+		log.Debugf("Attempting to connect to dcrd RPC %s as user %s (no TLS)",
+			node.Host, node.User)
+	}
+
+	client, err := rpcclient.New(&rpcclient.ConnConfig{
+		Host:                 node.Host,
+		Endpoint:             "ws",
+		User:                 node.User,
+		Pass:                 node.Pass,
+		Certificates:         certs,
+		DisableTLS:           node.DisableTLS,
+		DisableAutoReconnect: true,
+	}, d.Notif.DcrdHandlers())
+	if err != nil {
+		return nil, err
+	}
+
+	curnet, err := client.GetCurrentNet()
+	if err != nil {
+		client.Shutdown()
+		return nil, fmt.Errorf("unable to get current network from dcrd: %v", err)
+	}
+	if curnet != d.Params.Net {
+		client.Shutdown()
+		return nil, fmt.Errorf("network of connected node, %s, does not match expected network, %s",
+			curnet, d.Params.Net)
+	}
+
+	log.Infof("Connected to dcrd (JSON-RPC API) at %s on %v", node.Host, curnet)
+	return client, nil
+}
+
+// Monitor waits for the connection to dcrd to be lost and re-establishes it,
+// first with the node that was in use and then with the other configured
+// nodes. Failed rounds are retried with an increasing delay. Once connected,
+// the notifier is resynced with the new client. Monitor should be run as a
+// goroutine after Notifier.Listen and returns when the context is canceled.
+func (d *Dcrd) Monitor() {
+	for {
+		client := d.Rpc()
+		done := make(chan struct{})
+		go func() {
+			client.WaitForShutdown()
+			close(done)
+		}()
+
+		select {
+		case <-d.ctx.Done():
+			return
+		case <-done:
+		}
+
+		log.Warnf("Lost connection to dcrd at %s", d.nodes[d.current].Host)
+		d.setState(Disconnected)
+
+		if !d.reconnect() {
+			return
+		}
+	}
+}
+
+// reconnect dials the configured nodes, starting with the current one, until
+// a connection is established and the notifier is resynced. It returns false
+// if the context is canceled first.
+func (d *Dcrd) reconnect() bool {
+	delay := minReconnectDelay
+	for {
+		for n := 0; n < len(d.nodes); n++ {
+			i := (d.current + n) % len(d.nodes)
+			client, err := d.dial(i)
+			if err != nil {
+				log.Errorf("Unable to connect to dcrd at %s: %v", d.nodes[i].Host, err)
+				continue
+			}
+
+			// Swap the client before resyncing so that the block handlers
+			// run for the resync use the new node.
+			d.mtx.Lock()
+			d.current = i
+			d.rpc = client
+			d.mtx.Unlock()
+
+			if cerr := d.Notif.Resync(client); cerr != nil {
+				log.Errorf("Unable to resync with dcrd at %s: %v (%v)", d.nodes[i].Host, cerr, cerr.Cause())
+				client.Shutdown()
+				continue
+			}
+
+			d.setState(Connected)
+			return true
+		}
+
+		log.Infof("Retrying to connect to dcrd in %v", delay)
+		select {
+		case <-d.ctx.Done():
+			return false
+		case <-time.After(delay):
+		}
+		delay *= 2
+		if delay > maxReconnectDelay {
+			delay = maxReconnectDelay
+		}
+	}
+}
+
+// Shutdown closes the connection to dcrd.
+func (d *Dcrd) Shutdown() {
+	client := d.Rpc()
+	if client == nil {
+		return
+	}
+	client.Shutdown()
+	client.WaitForShutdown()
+}
+
+// Rpc returns the RPC client of the dcrd node currently in use. The client is
+// replaced when the connection fails over, so it should not be kept.
+func (d *Dcrd) Rpc() *rpcclient.Client {
+	d.mtx.RLock()
+	defer d.mtx.RUnlock()
+	return d.rpc
+}
+
+// Connected checks if the websocket connection to dcrd is up. Modules polling
+// dcrd should skip their work while it is down.
+func (d *Dcrd) Connected() bool {
+	d.mtx.RLock()
+	defer d.mtx.RUnlock()
+	return d.state == Connected
+}
+
+// RegisterConnectionStateHandler adds a handler that is called every time the
+// connection to dcrd is lost or re-established.
+func (d *Dcrd) RegisterConnectionStateHandler(handler ConnectionStateHandler) {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+	d.stateHandlers = append(d.stateHandlers, handler)
+}
+
+func (d *Dcrd) setState(state ConnectionState) {
+	d.mtx.Lock()
+	d.state = state
+	handlers := make([]ConnectionStateHandler, len(d.stateHandlers))
+	copy(handlers, d.stateHandlers)
+	d.mtx.Unlock()
+
+	for _, handler := range handlers {
+		handler(state)
+	}
+}
@@ -1,8 +1,10 @@
 package dcrd
 
 import (
+	"context"
 	"fmt"
 	"math"
+	"sync"
 	"time"
 
 	"github.com/decred/dcrd/chaincfg/v2"
@@ -10,20 +12,29 @@ import (
 	"github.com/decred/dcrd/txscript/v2"
 )
 
+// Dcrd bundles the RPC client, the chain parameters and the block
+// notifier. It is created with Connect.
 type Dcrd struct {
-	Rpc    *rpcclient.Client
 	Params *chaincfg.Params
 	Notif  *Notifier
+
+	ctx           context.Context
+	nodes         []NodeConfig
+	current       int
+	rpc           *rpcclient.Client
+	state         ConnectionState
+	stateHandlers []ConnectionStateHandler
+	mtx           sync.RWMutex
 }
 
 // IsSynced returns the sync status of dcrd node by checking the age of
 // the best block against the TargetTimePerBlock and a 5 mins tolerance
-func (d Dcrd) IsSynced() (bool, error) {
-	hash, err := d.Rpc.GetBestBlockHash()
+func (d *Dcrd) IsSynced() (bool, error) {
+	hash, err := d.Rpc().GetBestBlockHash()
 	if err != nil {
 		return false, err
 	}
-	blockHeader, err := d.Rpc.GetBlockHeader(hash)
+	blockHeader, err := d.Rpc().GetBlockHeader(hash)
 	if err != nil {
 		return false, err
 	}
@@ -2,6 +2,9 @@ package dcrd
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"path"
 	"reflect"
 	"runtime"
 	"sync"
@@ -20,18 +23,70 @@ const SyncHandlerDeadline = time.Minute * 5
 // BlockHandler is a function that will be called when dcrd reports a new block.
 type BlockHandler func(*wire.BlockHeader) error
 
+// BlockInfo wraps the header of a connected block. Backfilled is set for
+// blocks that were not announced by dcrd but fetched by the notifier to fill
+// a gap in the chain, so the time the block was processed is not the time it
+// was received.
+type BlockInfo struct {
+	Header     *wire.BlockHeader
+	Backfilled bool
+}
+
+// BlockInfoHandler is a function that will be called when dcrd reports a new
+// block and that needs to know whether the block was backfilled.
+type BlockInfoHandler func(*BlockInfo) error
+
 // TxHandler is a function that will be called when dcrd reports new mempool
 // transactions.
 type TxHandler func(*chainjson.TxRawResult) error
 
+// HandlerObserver is a function that is called after every block, reorg and tx
+// handler run. kind is one of "block", "reorg" or "tx".
+type HandlerObserver func(kind, handler string, duration time.Duration, err error)
+
+// ReorgHandler is a function that will be called when the notifier detects
+// that blocks it has already passed to the block handlers are no longer part
+// of the best chain.
+type ReorgHandler func(*ReorgData) error
+
+// ReorgData describes a chain reorganization. OldChain holds the headers of
+// the blocks detached from the best chain and NewChain the headers of the
+// blocks that replace them. Both are ordered by ascending height and neither
+// includes the common ancestor.
+type ReorgData struct {
+	CommonAncestor       chainhash.Hash
+	CommonAncestorHeight uint32
+	OldChain             []*wire.BlockHeader
+	NewChain             []*wire.BlockHeader
+}
+
+// chainClient is the part of the dcrd RPC client the notifier walks the chain
+// with.
+type chainClient interface {
+	GetBlockHash(blockHeight int64) (*chainhash.Hash, error)
+	GetBlockHeader(blockHash *chainhash.Hash) (*wire.BlockHeader, error)
+}
+
+// blockDisconnected is the anyQ payload for a block disconnected
+// notification. It lets superQueue tell it apart from a connected block.
+type blockDisconnected struct {
+	header *wire.BlockHeader
+}
+
 type Notifier struct {
-	ctx  context.Context
-	node *rpcclient.Client
+	ctx     context.Context
+	node    chainClient
+	nodeMtx sync.RWMutex
 	// The anyQ sequences all dcrd notification in the order they are received.
-	anyQ     chan interface{}
-	block    [][]BlockHandler
-	tx       [][]TxHandler
-	previous struct {
+	anyQ  chan interface{}
+	block [][]BlockInfoHandler
+	// blockNames holds the names of the registered block handlers, the
+	// BlockHandlers being wrapped in a BlockInfoHandler.
+	blockNames [][]string
+	tx         [][]TxHandler
+	reorg      [][]ReorgHandler
+	observer   HandlerObserver
+	previous   struct {
 		hash   chainhash.Hash
 		height uint32
 	}
@@ -45,15 +100,50 @@ func NewNotifier(ctx context.Context) *Notifier {
 		// through here, so the size should stay pretty big to accommodate for the
 		// inevitable explosive growth of the network.
 		anyQ:  make(chan interface{}, 1024),
-		block: make([][]BlockHandler, 0),
+		block: make([][]BlockInfoHandler, 0),
 		tx:    make([][]TxHandler, 0),
+		reorg: make([][]ReorgHandler, 0),
 	}
 }
 
 // Listen must be called once, but only after all handlers are registered.
 func (notifier *Notifier) Listen(dcrdClient *rpcclient.Client) *ContextualError {
-	// Register for block connection and chain reorg notifications.
+	if err := notifier.registerNtfns(dcrdClient); err != nil {
+		return err
+	}
+
+	go notifier.superQueue()
+	return nil
+}
+
+// Resync must be called after the connection to dcrd was re-established,
+// possibly to a different node. It registers for notifications on the new
+// client and queues the node's best block so that the blocks missed while
+// disconnected are backfilled, or the reorg to the node's chain is processed.
+func (notifier *Notifier) Resync(dcrdClient *rpcclient.Client) *ContextualError {
+	if err := notifier.registerNtfns(dcrdClient); err != nil {
+		return err
+	}
+
+	hash, err := dcrdClient.GetBestBlockHash()
+	if err != nil {
+		return newContextualError("unable to get the best block hash", err)
+	}
+	header, err := dcrdClient.GetBlockHeader(hash)
+	if err != nil {
+		return newContextualError("unable to get the best block header", err)
+	}
+
+	notifier.anyQ <- header
+	return nil
+}
+
+func (notifier *Notifier) registerNtfns(dcrdClient *rpcclient.Client) *ContextualError {
+	notifier.nodeMtx.Lock()
 	notifier.node = dcrdClient
+	notifier.nodeMtx.Unlock()
+
+	// Register for block connection and chain reorg notifications.
 
 	var err error
 	if err = dcrdClient.NotifyBlocks(); err != nil {
@@ -71,7 +161,6 @@ func (notifier *Notifier) Listen(dcrdClient *rpcclient.Client) *ContextualError
 			"notification registration failed", err)
 	}
 
-	go notifier.superQueue()
 	return nil
 }
 
@@ -91,9 +180,31 @@ func (notifier *Notifier) DcrdHandlers() *rpcclient.NotificationHandlers {
 // sequentially in the order they are registered, but the handlers within the
 // group are run asynchronously. Handlers registered with
 // RegisterBlockHandlerGroup are FIFO'd together with handlers registered with
-// RegisterBlockHandlerLiteGroup.
+// RegisterBlockInfoHandlerGroup.
 func (notifier *Notifier) RegisterBlockHandlerGroup(handlers ...BlockHandler) {
+	h := make([]BlockInfoHandler, 0, len(handlers))
+	names := make([]string, 0, len(handlers))
+	for _, handler := range handlers {
+		handler := handler
+		h = append(h, func(info *BlockInfo) error {
+			return handler(info.Header)
+		})
+		names = append(names, functionName(handler))
+	}
+	notifier.block = append(notifier.block, h)
+	notifier.blockNames = append(notifier.blockNames, names)
+}
+
+// RegisterBlockInfoHandlerGroup adds a group of block handlers that receive
+// a *BlockInfo. Such handlers are run in the same group order as handlers
+// registered with RegisterBlockHandlerGroup.
+func (notifier *Notifier) RegisterBlockInfoHandlerGroup(handlers ...BlockInfoHandler) {
+	names := make([]string, 0, len(handlers))
+	for _, handler := range handlers {
+		names = append(names, functionName(handler))
+	}
 	notifier.block = append(notifier.block, handlers)
+	notifier.blockNames = append(notifier.blockNames, names)
 }
 
 // RegisterTxHandlerGroup adds a group of tx handlers. Groups are run
@@ -103,17 +214,54 @@ func (notifier *Notifier) RegisterTxHandlerGroup(handlers ...TxHandler) {
 	notifier.tx = append(notifier.tx, handlers)
 }
 
+// RegisterReorgHandlerGroup adds a group of reorg handlers. Groups are run
+// sequentially in the order they are registered, but the handlers within the
+// group are run asynchronously. Reorg handlers are expected to roll back any
+// data recorded for the blocks in ReorgData.OldChain. Once all groups have
+// completed, the blocks in ReorgData.NewChain are passed to the block handler
+// groups in ascending order, so modules replay the new chain through their
+// regular block handlers.
+func (notifier *Notifier) RegisterReorgHandlerGroup(handlers ...ReorgHandler) {
+	notifier.reorg = append(notifier.reorg, handlers)
+}
+
+// client returns the RPC client of the node the notifier is registered with.
+func (notifier *Notifier) client() chainClient {
+	notifier.nodeMtx.RLock()
+	defer notifier.nodeMtx.RUnlock()
+	return notifier.node
+}
+
 // SetPreviousBlock modifies the height and hash of the best block. This data is
 // required to avoid connecting new blocks that are not next in the chain. It is
 // only necessary to call SetPreviousBlock if blocks are connected or
 // disconnected by a mechanism other than (*Notifier).processBlock, which
-// keeps this data up-to-date. For example, signalReorg will use
-// SetPreviousBlock after the reorg is complete.
+// keeps this data up-to-date. For example, processReorg will use
+// SetPreviousBlock after the reorg handlers are complete.
 func (notifier *Notifier) SetPreviousBlock(prevHash chainhash.Hash, prevHeight uint32) {
 	notifier.previous.hash = prevHash
 	notifier.previous.height = prevHeight
 }
 
+// SetHandlerObserver sets a function called after every handler run, e.g. to
+// export the handler durations. It must be called before Listen.
+func (notifier *Notifier) SetHandlerObserver(observer HandlerObserver) {
+	notifier.observer = observer
+}
+
+// QueueLen returns the number of notifications waiting to be processed.
+func (notifier *Notifier) QueueLen() int {
+	return len(notifier.anyQ)
+}
+
+// observe reports a run of the named handler to the observer, if any.
+func (notifier *Notifier) observe(kind, name string, start time.Time, err error) {
+	if notifier.observer == nil {
+		return
+	}
+	notifier.observer(kind, path.Base(name), time.Since(start), err)
+}
+
 func functionName(i interface{}) string {
 	return runtime.FuncForPC(reflect.ValueOf(i).Pointer()).Name()
 }
@@ -133,6 +281,10 @@ out:
 				// Process the new block.
 				log.Infof("superQueue: Processing new block %v (height %d).", msg.BlockHash(), msg.Height)
 				notifier.processBlock(msg)
+			case *blockDisconnected:
+				log.Infof("superQueue: Processing disconnected block %v (height %d).",
+					msg.header.BlockHash(), msg.header.Height)
+				notifier.processBlockDisconnected(msg.header)
 			case *chainjson.TxRawResult:
 				notifier.processTx(msg)
 			default:
@@ -144,34 +296,159 @@ out:
 	}
 }
 
-// processBlock calls the BlockHandler/BlockHandlerLite groups one at a time in
-// the order that they were registered.
+// processBlock passes a block to the block handler groups if it connects to
+// the previously connected block. When blocks are missing between the
+// previously connected block and the received one, they are backfilled first.
+// A block that does not connect otherwise signals a reorganization, which is
+// handed to processReorg.
 func (notifier *Notifier) processBlock(bh *wire.BlockHeader) {
 	hash := bh.BlockHash()
 	height := bh.Height
 	prev := notifier.previous
 
+	if hash == prev.hash {
+		log.Debugf("Block %d (%v) is already connected.", height, hash)
+		return
+	}
+
+	// A main chain block at or below the best block was already connected,
+	// unless the best block was since detached from the main chain.
+	if height <= prev.height && notifier.isMainChainBlock(hash, height) &&
+		notifier.isMainChainBlock(prev.hash, prev.height) {
+		log.Debugf("Block %d (%v) was already connected before %d (%v).",
+			height, hash, prev.height, prev.hash)
+		return
+	}
+
 	// Ensure that the received block (bh.hash, bh.height) connects to the
 	// previously connected block (q.prevHash, q.prevHeight).
 	if bh.PrevBlock != prev.hash {
+		if height > prev.height+1 {
+			missing, err := notifier.missingHeaders(bh)
+			if err != nil {
+				log.Errorf("Unable to fetch the blocks between %d and %d: %v",
+					prev.height, height, err)
+				return
+			}
+			if missing != nil {
+				log.Infof("Backfilling %d blocks between %d (%v) and %d (%v).",
+					len(missing), prev.height, prev.hash, height, hash)
+				for _, header := range missing {
+					if !notifier.connectBlock(header, true) {
+						return
+					}
+				}
+				notifier.connectBlock(bh, false)
+				return
+			}
+		}
+
 		log.Infof("Received block at %d (%v) does not connect to %d (%v). "+
-			"This is normal before reorganization.",
+			"Looking for the common ancestor.",
 			height, hash, prev.height, prev.hash)
+		reorg, err := notifier.reorgData(bh)
+		if err != nil {
+			log.Errorf("Unable to process reorganization to block %d (%v): %v",
+				height, hash, err)
+			return
+		}
+		notifier.processReorg(reorg)
 		return
 	}
 
+	notifier.connectBlock(bh, false)
+}
+
+// isMainChainBlock checks if the block with the given hash is the block at
+// the given height in dcrd's best chain.
+func (notifier *Notifier) isMainChainBlock(hash chainhash.Hash, height uint32) bool {
+	node := notifier.client()
+	if node == nil {
+		return false
+	}
+	mainHash, err := node.GetBlockHash(int64(height))
+	if err != nil {
+		log.Errorf("GetBlockHash(%d): %v", height, err)
+		return false
+	}
+	return *mainHash == hash
+}
+
+// missingHeaders fetches the headers of the main chain blocks between the
+// previously connected block and the given block. The returned headers are
+// ordered by ascending height. A nil slice is returned if the fetched blocks
+// do not link the previously connected block to the given block, which means
+// the chain was reorganized.
+func (notifier *Notifier) missingHeaders(tip *wire.BlockHeader) ([]*wire.BlockHeader, error) {
+	node := notifier.client()
+	if node == nil {
+		return nil, errors.New("the notifier is not connected to dcrd")
+	}
+
+	prevHash := notifier.previous.hash
+	headers := make([]*wire.BlockHeader, 0, tip.Height-notifier.previous.height-1)
+	for height := notifier.previous.height + 1; height < tip.Height; height++ {
+		hash, err := node.GetBlockHash(int64(height))
+		if err != nil {
+			return nil, fmt.Errorf("GetBlockHash(%d): %v", height, err)
+		}
+		header, err := node.GetBlockHeader(hash)
+		if err != nil {
+			return nil, fmt.Errorf("GetBlockHeader(%v): %v", hash, err)
+		}
+		if header.PrevBlock != prevHash {
+			return nil, nil
+		}
+		headers = append(headers, header)
+		prevHash = *hash
+	}
+
+	if tip.PrevBlock != prevHash {
+		return nil, nil
+	}
+	return headers, nil
+}
+
+// processBlockDisconnected rolls back the best block if it is the block being
+// disconnected. Disconnected blocks that were never connected by the notifier
+// are ignored.
+func (notifier *Notifier) processBlockDisconnected(bh *wire.BlockHeader) {
+	hash := bh.BlockHash()
+	prev := notifier.previous
+	if hash != prev.hash {
+		log.Debugf("Disconnected block %d (%v) is not the best block %d (%v), ignoring.",
+			bh.Height, hash, prev.height, prev.hash)
+		return
+	}
+
+	notifier.processReorg(&ReorgData{
+		CommonAncestor:       bh.PrevBlock,
+		CommonAncestorHeight: bh.Height - 1,
+		OldChain:             []*wire.BlockHeader{bh},
+	})
+}
+
+// processReorg calls the ReorgHandler groups one at a time in the order that
+// they were registered, moves the best block back to the common ancestor and
+// then connects the blocks of the new chain in order.
+func (notifier *Notifier) processReorg(reorg *ReorgData) {
+	log.Infof("Reorganization from common ancestor %d (%v): %d blocks detached, %d blocks attached.",
+		reorg.CommonAncestorHeight, reorg.CommonAncestor, len(reorg.OldChain), len(reorg.NewChain))
+
 	start := time.Now()
-	for _, handlers := range notifier.block {
+	for _, handlers := range notifier.reorg {
 		wg := new(sync.WaitGroup)
 		for _, h := range handlers {
 			wg.Add(1)
-			go func(h BlockHandler) {
+			go func(h ReorgHandler) {
 				tStart := time.Now()
 				defer wg.Done()
-				defer log.Tracef("Notifier: BlockHandler %s completed in %v",
+				err := h(reorg)
+				log.Tracef("Notifier: ReorgHandler %s completed in %v",
 					functionName(h), time.Since(tStart))
-				if err := h(bh); err != nil {
-					log.Errorf("block handler failed: %v", err)
+				notifier.observe("reorg", functionName(h), tStart, err)
+				if err != nil {
+					log.Errorf("reorg handler failed: %v", err)
 					return
 				}
 			}(h)
@@ -184,14 +461,123 @@ func (notifier *Notifier) processBlock(bh *wire.BlockHeader) {
 		select {
 		case <-done:
 		case <-time.NewTimer(SyncHandlerDeadline).C:
-			log.Errorf("at least 1 block handler has not completed before the deadline")
+			log.Errorf("at least 1 reorg handler has not completed before the deadline")
 			return
 		}
 	}
+	log.Debugf("handlers of Notifier.processReorg() completed in %v", time.Since(start))
+
+	notifier.SetPreviousBlock(reorg.CommonAncestor, reorg.CommonAncestorHeight)
+
+	// Only the last block of the new chain was announced by dcrd, the blocks
+	// before it are backfilled.
+	for i, bh := range reorg.NewChain {
+		if !notifier.connectBlock(bh, i < len(reorg.NewChain)-1) {
+			return
+		}
+	}
+}
+
+// reorgData walks back from the previously connected block and from the
+// parent of the given block until both chains meet, collecting the detached
+// and attached headers on the way.
+func (notifier *Notifier) reorgData(tip *wire.BlockHeader) (*ReorgData, error) {
+	node := notifier.client()
+	if node == nil {
+		return nil, errors.New("the notifier is not connected to dcrd")
+	}
+
+	oldHash, oldHeight := notifier.previous.hash, notifier.previous.height
+	newHash, newHeight := tip.PrevBlock, tip.Height-1
+	oldChain := make([]*wire.BlockHeader, 0)
+	newChain := []*wire.BlockHeader{tip}
+
+	for oldHash != newHash {
+		if oldHeight == 0 && newHeight == 0 {
+			return nil, fmt.Errorf("no common ancestor for block %v", tip.BlockHash())
+		}
+		if oldHeight >= newHeight {
+			header, err := node.GetBlockHeader(&oldHash)
+			if err != nil {
+				return nil, fmt.Errorf("GetBlockHeader(%v): %v", oldHash, err)
+			}
+			oldChain = append(oldChain, header)
+			oldHash, oldHeight = header.PrevBlock, header.Height-1
+		}
+		if newHeight > oldHeight {
+			header, err := node.GetBlockHeader(&newHash)
+			if err != nil {
+				return nil, fmt.Errorf("GetBlockHeader(%v): %v", newHash, err)
+			}
+			newChain = append(newChain, header)
+			newHash, newHeight = header.PrevBlock, header.Height-1
+		}
+	}
+
+	reverseHeaders(oldChain)
+	reverseHeaders(newChain)
+
+	return &ReorgData{
+		CommonAncestor:       oldHash,
+		CommonAncestorHeight: oldHeight,
+		OldChain:             oldChain,
+		NewChain:             newChain,
+	}, nil
+}
+
+func reverseHeaders(headers []*wire.BlockHeader) {
+	for i, j := 0, len(headers)-1; i < j; i, j = i+1, j-1 {
+		headers[i], headers[j] = headers[j], headers[i]
+	}
+}
+
+// connectBlock calls the BlockHandler and BlockInfoHandler groups one at a
+// time in the order that they were registered and records the block as the
+// best block. It returns false if the handlers did not complete before the
+// deadline.
+func (notifier *Notifier) connectBlock(bh *wire.BlockHeader, backfilled bool) bool {
+	hash := bh.BlockHash()
+	height := bh.Height
+	info := &BlockInfo{
+		Header:     bh,
+		Backfilled: backfilled,
+	}
+
+	start := time.Now()
+	for i, handlers := range notifier.block {
+		wg := new(sync.WaitGroup)
+		for j, h := range handlers {
+			wg.Add(1)
+			go func(h BlockInfoHandler, name string) {
+				tStart := time.Now()
+				defer wg.Done()
+				err := h(info)
+				log.Tracef("Notifier: BlockHandler %s completed in %v",
+					name, time.Since(tStart))
+				notifier.observe("block", name, tStart, err)
+				if err != nil {
+					log.Errorf("block handler failed: %v", err)
+					return
+				}
+			}(h, notifier.blockNames[i][j])
+		}
+		done := make(chan struct{})
+		go func() {
+			wg.Wait()
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-time.NewTimer(SyncHandlerDeadline).C:
+			log.Errorf("at least 1 block handler has not completed before the deadline")
+			return false
+		}
+	}
 	log.Debugf("handlers of Notifier.processBlock() completed in %v", time.Since(start))
 
 	// Record this block as the best block connected by the collectionQueue.
 	notifier.SetPreviousBlock(hash, height)
+	return true
 }
 
 // processTx calls the TxHandler groups one at a time in the order that they
@@ -203,9 +589,12 @@ func (notifier *Notifier) processTx(tx *chainjson.TxRawResult) {
 		for j, h := range handlers {
 			wg.Add(1)
 			go func(h TxHandler, i, j int) {
+				tStart := time.Now()
 				defer wg.Done()
 				defer log.Tracef("Notifier: TxHandler %d.%d completed", i, j)
-				if err := h(tx); err != nil {
+				err := h(tx)
+				notifier.observe("tx", functionName(h), tStart, err)
+				if err != nil {
 					log.Errorf("tx handler failed: %v", err)
 					return
 				}
@@ -257,6 +646,8 @@ func (notifier *Notifier) onBlockDisconnected(blockHeaderSerialized []byte) {
 	hash := blockHeader.BlockHash()
 
 	log.Debugf("OnBlockDisconnected: %d / %v", height, hash)
+
+	notifier.anyQ <- &blockDisconnected{header: blockHeader}
 }
 
 // rpcclient.NotificationHandlers.OnTxAcceptedVerbose
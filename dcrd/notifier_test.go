@@ -0,0 +1,233 @@
+package dcrd
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/decred/dcrd/chaincfg/chainhash"
+	"github.com/decred/dcrd/wire"
+)
+
+// fakeChain is a chainClient serving a main chain and the blocks of the
+// branches it replaced. The blocks are labeled with their height and branch,
+// e.g. 10a.
+type fakeChain struct {
+	headers map[chainhash.Hash]*wire.BlockHeader
+	labels  map[chainhash.Hash]string
+	byLabel map[string]*wire.BlockHeader
+	main    []chainhash.Hash
+}
+
+// newFakeChain creates the chain of the blocks 0a to tip.
+func newFakeChain(tip uint32) *fakeChain {
+	c := &fakeChain{
+		headers: make(map[chainhash.Hash]*wire.BlockHeader),
+		labels:  make(map[chainhash.Hash]string),
+		byLabel: make(map[string]*wire.BlockHeader),
+	}
+	c.add(&wire.BlockHeader{}, "a")
+	c.extend(0, tip, "a")
+	return c
+}
+
+func (c *fakeChain) add(header *wire.BlockHeader, branch string) {
+	hash := header.BlockHash()
+	label := fmt.Sprintf("%d%s", header.Height, branch)
+	c.headers[hash] = header
+	c.labels[hash] = label
+	c.byLabel[label] = header
+	c.main = append(c.main[:header.Height], hash)
+}
+
+// extend replaces the main chain above ancestor with the blocks of branch up
+// to tip.
+func (c *fakeChain) extend(ancestor, tip uint32, branch string) {
+	prev := c.main[ancestor]
+	for height := ancestor + 1; height <= tip; height++ {
+		header := &wire.BlockHeader{
+			PrevBlock: prev,
+			Height:    height,
+			Nonce:     uint32(branch[0]),
+		}
+		c.add(header, branch)
+		prev = header.BlockHash()
+	}
+}
+
+func (c *fakeChain) label(header *wire.BlockHeader) string {
+	return c.labels[header.BlockHash()]
+}
+
+func (c *fakeChain) labelAll(headers []*wire.BlockHeader) []string {
+	labels := make([]string, 0, len(headers))
+	for _, header := range headers {
+		labels = append(labels, c.label(header))
+	}
+	return labels
+}
+
+func (c *fakeChain) GetBlockHash(height int64) (*chainhash.Hash, error) {
+	if height < 0 || height >= int64(len(c.main)) {
+		return nil, fmt.Errorf("no block at height %d", height)
+	}
+	hash := c.main[height]
+	return &hash, nil
+}
+
+func (c *fakeChain) GetBlockHeader(hash *chainhash.Hash) (*wire.BlockHeader, error) {
+	header, found := c.headers[*hash]
+	if !found {
+		return nil, fmt.Errorf("no block %v", hash)
+	}
+	return header, nil
+}
+
+// ntfn is a block connected, or disconnected, notification of dcrd.
+type ntfn struct {
+	label        string
+	disconnected bool
+}
+
+func TestNotifierBlocks(t *testing.T) {
+	tests := []struct {
+		name string
+		// tip is the height of the chain of branch a, and fork the
+		// ancestor and tip of branch b replacing it, if any.
+		tip   uint32
+		fork  []uint32
+		prev  string
+		ntfns []ntfn
+		want  []string
+	}{{
+		name:  "next block",
+		tip:   11,
+		prev:  "10a",
+		ntfns: []ntfn{{label: "11a"}},
+		want:  []string{"block 11a", "info 11a"},
+	}, {
+		name:  "already connected",
+		tip:   10,
+		prev:  "10a",
+		ntfns: []ntfn{{label: "9a"}, {label: "10a"}},
+	}, {
+		name:  "gap backfill",
+		tip:   14,
+		prev:  "10a",
+		ntfns: []ntfn{{label: "14a"}},
+		want: []string{"block 11a", "info 11a backfilled", "block 12a", "info 12a backfilled",
+			"block 13a", "info 13a backfilled", "block 14a", "info 14a"},
+	}, {
+		name:  "reorg of depth 1 notified",
+		tip:   10,
+		fork:  []uint32{9, 10},
+		prev:  "10a",
+		ntfns: []ntfn{{label: "10a", disconnected: true}, {label: "10b"}},
+		want:  []string{"reorg 9a [10a] []", "reorg2", "block 10b", "info 10b"},
+	}, {
+		name:  "disconnected block not connected",
+		tip:   10,
+		fork:  []uint32{9, 10},
+		prev:  "9a",
+		ntfns: []ntfn{{label: "10a", disconnected: true}},
+	}, {
+		name:  "reorg of depth 1",
+		tip:   10,
+		fork:  []uint32{9, 11},
+		prev:  "10a",
+		ntfns: []ntfn{{label: "11b"}},
+		want: []string{"reorg 9a [10a] [10b 11b]", "reorg2", "block 10b", "info 10b backfilled",
+			"block 11b", "info 11b"},
+	}, {
+		name:  "reorg of depth 1 to a sibling",
+		tip:   10,
+		fork:  []uint32{9, 10},
+		prev:  "10a",
+		ntfns: []ntfn{{label: "10b"}},
+		want:  []string{"reorg 9a [10a] [10b]", "reorg2", "block 10b", "info 10b"},
+	}, {
+		name:  "reorg of depth 3",
+		tip:   10,
+		fork:  []uint32{7, 10},
+		prev:  "10a",
+		ntfns: []ntfn{{label: "10b"}},
+		want: []string{"reorg 7a [8a 9a 10a] [8b 9b 10b]", "reorg2", "block 8b", "info 8b backfilled",
+			"block 9b", "info 9b backfilled", "block 10b", "info 10b"},
+	}, {
+		name:  "reorg of depth 2 beyond a gap",
+		tip:   10,
+		fork:  []uint32{8, 12},
+		prev:  "10a",
+		ntfns: []ntfn{{label: "12b"}},
+		want: []string{"reorg 8a [9a 10a] [9b 10b 11b 12b]", "reorg2", "block 9b", "info 9b backfilled",
+			"block 10b", "info 10b backfilled", "block 11b", "info 11b backfilled", "block 12b", "info 12b"},
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			chain := newFakeChain(test.tip)
+			if len(test.fork) == 2 {
+				chain.extend(test.fork[0], test.fork[1], "b")
+			}
+
+			var mtx sync.Mutex
+			var calls []string
+			record := func(format string, args ...interface{}) {
+				mtx.Lock()
+				calls = append(calls, fmt.Sprintf(format, args...))
+				mtx.Unlock()
+			}
+			notifier := NewNotifier(context.Background())
+			notifier.node = chain
+			// The handlers of a group run concurrently, those of successive
+			// groups in order.
+			notifier.RegisterReorgHandlerGroup(func(reorg *ReorgData) error {
+				ancestor := chain.labels[reorg.CommonAncestor]
+				if ancestor != fmt.Sprintf("%da", reorg.CommonAncestorHeight) {
+					t.Errorf("common ancestor %s at height %d", ancestor, reorg.CommonAncestorHeight)
+				}
+				record("reorg %s %v %v", ancestor, chain.labelAll(reorg.OldChain), chain.labelAll(reorg.NewChain))
+				return nil
+			})
+			notifier.RegisterReorgHandlerGroup(func(*ReorgData) error {
+				record("reorg2")
+				return nil
+			})
+			notifier.RegisterBlockHandlerGroup(func(header *wire.BlockHeader) error {
+				record("block %s", chain.label(header))
+				return nil
+			})
+			notifier.RegisterBlockInfoHandlerGroup(func(info *BlockInfo) error {
+				if info.Backfilled {
+					record("info %s backfilled", chain.label(info.Header))
+				} else {
+					record("info %s", chain.label(info.Header))
+				}
+				return nil
+			})
+
+			prev := chain.byLabel[test.prev]
+			notifier.SetPreviousBlock(prev.BlockHash(), prev.Height)
+			for _, n := range test.ntfns {
+				if n.disconnected {
+					notifier.processBlockDisconnected(chain.byLabel[n.label])
+				} else {
+					notifier.processBlock(chain.byLabel[n.label])
+				}
+			}
+
+			if !reflect.DeepEqual(calls, test.want) {
+				t.Errorf("calls = %q, want %q", calls, test.want)
+			}
+			tip := chain.main[len(chain.main)-1]
+			if len(test.want) == 0 {
+				tip = prev.BlockHash()
+			}
+			if notifier.previous.hash != tip {
+				t.Errorf("best block %s, want %s", chain.labels[notifier.previous.hash], chain.labels[tip])
+			}
+		})
+	}
+}
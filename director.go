@@ -2,246 +2,228 @@ package main
 
 import (
 	"context"
-	"errors"
 	"fmt"
+	"path/filepath"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/decred/dcrdata/exchanges/v2"
-	"github.com/planetdecred/pdanalytics/attackcost"
-	"github.com/planetdecred/pdanalytics/charts"
-	"github.com/planetdecred/pdanalytics/commstats"
+	"github.com/planetdecred/pdanalytics/boltdb"
+	"github.com/planetdecred/pdanalytics/dbhelper"
 	"github.com/planetdecred/pdanalytics/dcrd"
-	exchangesModule "github.com/planetdecred/pdanalytics/exchanges"
-	"github.com/planetdecred/pdanalytics/gov/politeia"
-	"github.com/planetdecred/pdanalytics/homepage"
-	"github.com/planetdecred/pdanalytics/mempool"
-	"github.com/planetdecred/pdanalytics/netsnapshot"
-	"github.com/planetdecred/pdanalytics/parameters"
+	"github.com/planetdecred/pdanalytics/health"
+	"github.com/planetdecred/pdanalytics/metrics"
+	"github.com/planetdecred/pdanalytics/module"
 	"github.com/planetdecred/pdanalytics/postgres"
-	"github.com/planetdecred/pdanalytics/pow"
-	"github.com/planetdecred/pdanalytics/propagation"
-	"github.com/planetdecred/pdanalytics/stakingreward"
-	"github.com/planetdecred/pdanalytics/stats"
-	"github.com/planetdecred/pdanalytics/treasury"
-	"github.com/planetdecred/pdanalytics/vsp"
+	"github.com/planetdecred/pdanalytics/scheduler"
 	"github.com/planetdecred/pdanalytics/web"
+
+	// The module packages register themselves with the module registry when
+	// imported. Adding a module only requires importing its package here.
+	_ "github.com/planetdecred/pdanalytics/attackcost"
+	_ "github.com/planetdecred/pdanalytics/charts"
+	_ "github.com/planetdecred/pdanalytics/commstats"
+	_ "github.com/planetdecred/pdanalytics/datasync"
+	_ "github.com/planetdecred/pdanalytics/exchanges"
+	_ "github.com/planetdecred/pdanalytics/export"
+	_ "github.com/planetdecred/pdanalytics/gov/agendas"
+	_ "github.com/planetdecred/pdanalytics/gov/politeia"
+	_ "github.com/planetdecred/pdanalytics/homepage"
+	_ "github.com/planetdecred/pdanalytics/mempool"
+	_ "github.com/planetdecred/pdanalytics/netsnapshot"
+	_ "github.com/planetdecred/pdanalytics/parameters"
+	_ "github.com/planetdecred/pdanalytics/pow"
+	_ "github.com/planetdecred/pdanalytics/propagation"
+	_ "github.com/planetdecred/pdanalytics/retention"
+	_ "github.com/planetdecred/pdanalytics/stakingreward"
+	_ "github.com/planetdecred/pdanalytics/stats"
+	_ "github.com/planetdecred/pdanalytics/treasury"
+	_ "github.com/planetdecred/pdanalytics/vsp"
 )
 
-func setupModules(ctx context.Context, cfg *config, client *dcrd.Dcrd, server *web.Server, xcBot *exchanges.ExchangeBot) error {
-	var err error
+// modules is the registry the imported module packages registered with.
+var modules = module.Default()
 
-	var pgDb *postgres.PgDb
-	var dbInstance = func() (*postgres.PgDb, error) {
-		if pgDb == nil {
-			pgDb, err = postgres.NewPgDb(cfg.DBHost, cfg.DBPort, cfg.DBUser, cfg.DBPass, cfg.DBName, cfg.DebugLevel == "debug")
-			if err != nil {
-				return nil, err
-			}
-			if err = pgDb.CreateTables(ctx); err != nil {
-				log.Error("Error creating tables: ", err)
-				return nil, err
-			}
-		}
-		return pgDb, nil
-	}
-
-	if cfg.EnableStats {
-		db, err := dbInstance()
-		if err != nil {
-			return err
-		}
+// sharedDB is the database shared by the modules, postgres or the embedded
+// storm DB depending on cfg.DBBackend. It is opened, and its tables created and
+// migrated, when a module first asks for it.
+type sharedDB struct {
+	ctx   context.Context
+	cfg   *config
+	debug bool
 
-		err = stats.Activate(server, db)
-		if err != nil {
-			log.Error(err)
-			return fmt.Errorf("Failed to create staking reward component, %s", err.Error())
-		}
+	mtx    sync.Mutex
+	pgDb   *postgres.PgDb
+	boltDb *boltdb.BoltDb
+}
 
-		log.Info("Staking Reward Calculator Enabled")
+// get returns the shared database, connecting to it on the first call.
+func (s *sharedDB) get() (module.DB, error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if s.pgDb != nil {
+		return s.pgDb, nil
 	}
-
-	var stk *stakingreward.Calculator
-	if cfg.EnableStakingRewardCalculator {
-		stk, err = stakingreward.New(client, server, xcBot)
-		if err != nil {
-			log.Error(err)
-			return fmt.Errorf("Failed to create staking reward component, %s", err.Error())
-		}
-
-		log.Info("Staking Reward Calculator Enabled")
+	if s.boltDb != nil {
+		return s.boltDb, nil
 	}
-
-	var prms *parameters.Parameters
-	if cfg.EnableChainParameters {
-		prms, err = parameters.New(client, server)
+	cfg := s.cfg
+	if cfg.DBBackend == "embedded" {
+		db, err := openEmbeddedDb(s.ctx, cfg)
 		if err != nil {
-			log.Error(err)
-			return fmt.Errorf("Failed to create parameters component, %s", err.Error())
+			return nil, err
 		}
-
-		log.Info("Chain Parameters Enabled")
+		s.boltDb = db
+		return s.boltDb, nil
 	}
-
-	var chrts *charts.Charts
-	if cfg.EnableCharts {
-		chrts, err = charts.New(client, server)
-		if err != nil {
-			log.Error(err)
-			return fmt.Errorf("Failed to create Charts component, %s", err.Error())
-		}
-
-		log.Info("Charts parameters Enabled")
+	db, err := openPgDb(cfg, s.debug)
+	if err != nil {
+		return nil, err
 	}
-
-	var ac *attackcost.Attackcost
-	if cfg.EnableAttackCost {
-		ac, err = attackcost.New(client, server, xcBot)
-		if err != nil {
-			log.Error(err)
-			return fmt.Errorf("Failed to create attackcost component, %s", err.Error())
-		}
-
-		log.Info("Attack Cost Calculator Enabled")
+	db.SetBatchWrites(cfg.DBBatchSize, time.Duration(cfg.DBFlush)*time.Second)
+	if err = setupTables(s.ctx, db); err != nil {
+		db.Close()
+		return nil, err
 	}
+	s.pgDb = db
+	return s.pgDb, nil
+}
 
-	var mp *mempool.Collector
-	if cfg.EnableMempool {
-		mdb, err := dbInstance()
-		if err != nil {
-			return err
-		}
-
-		mp, err = mempool.NewCollector(ctx, client, cfg.MempoolInterval, mdb, server)
-		if err != nil {
-			log.Error(err)
-			return fmt.Errorf("Failed to create new mempool component, %s", err.Error())
-		}
-		go mp.StartMonitoring(ctx)
-
-		log.Info("Attack Cost Calculator Enabled")
+// pinger returns the shared database for the health checks, or nil if no
+// module connected to it.
+func (s *sharedDB) pinger() health.Pinger {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if s.pgDb != nil {
+		return s.pgDb
 	}
+	if s.boltDb != nil {
+		return s.boltDb
+	}
+	return nil
+}
 
-	if cfg.EnablePropagation {
-		var syncDbs = map[string]propagation.Store{}
-		//register instances
-		for i := 0; i < len(cfg.PropDBName); i++ {
-			databaseName := cfg.PropDBName[i]
-			syncDb, err := postgres.NewPgDb(cfg.PropDBHost[i], cfg.PropDBPort[i], cfg.PropDBUser[i], cfg.PropDBPass[i],
-				databaseName, cfg.DebugLevel == "debug")
-			if err != nil {
-				return err
-			}
-
-			if !syncDb.TableExists("block") {
-				msg := fmt.Sprintf("the database, %s is missing the block table", databaseName)
-				log.Error(msg)
-				return errors.New(msg)
-			}
-
-			if !syncDb.TableExists("vote") {
-				msg := fmt.Sprintf("the database, %s is missing the vote table", databaseName)
-				log.Error(msg)
-				return errors.New(msg)
-			}
-			syncDbs[databaseName] = syncDb
-		}
-
-		propDb, err := dbInstance()
-		if err != nil {
-			return err
-		}
-		_, err = propagation.New(ctx, client, propDb, syncDbs, server)
-		if err != nil {
-			log.Error(err)
-			return fmt.Errorf("Failed to create new propagation component, %s", err.Error())
+// close closes the shared database. It must be called after the modules are
+// stopped.
+func (s *sharedDB) close() {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if s.pgDb != nil {
+		if err := s.pgDb.Close(); err != nil {
+			log.Errorf("Error closing the database: %v", err)
 		}
+		s.pgDb = nil
 	}
-
-	if cfg.EnableProposals || cfg.EnableProposalsHttp {
-		err = politeia.Activate(ctx, client, cfg.PoliteiaAPIURL,
-			cfg.ProposalsFileName, cfg.PiPropRepoOwner, cfg.PiPropRepoName, cfg.DataDir, server,
-			cfg.EnableProposals, cfg.EnableProposalsHttp)
-		if err != nil {
-			log.Error(err)
-			requestShutdown()
+	if s.boltDb != nil {
+		if err := s.boltDb.Close(); err != nil {
+			log.Errorf("Error closing the embedded database: %v", err)
 		}
-		log.Info("Proposals module Enabled")
+		s.boltDb = nil
 	}
+}
 
-	if cfg.EnableNetworkSnapshot || cfg.EnableNetworkSnapshotHTTP {
-		db, err := dbInstance()
-		if err != nil {
-			return err
-		}
+// dbConnOptions returns the connection options of the shared postgres
+// database. The queries are timed by the metrics driver when the metrics are
+// enabled.
+func (cfg *config) dbConnOptions() dbhelper.ConnOptions {
+	opts := dbhelper.ConnOptions{
+		DSN:             cfg.DBDSN,
+		Host:            cfg.DBHost,
+		Port:            cfg.DBPort,
+		User:            cfg.DBUser,
+		Pass:            cfg.DBPass,
+		Name:            cfg.DBName,
+		SSLMode:         cfg.DBSSLMode,
+		SSLCert:         cfg.DBSSLCert,
+		SSLKey:          cfg.DBSSLKey,
+		SSLRootCert:     cfg.DBSSLRoot,
+		MaxOpenConns:    cfg.DBMaxOpen,
+		MaxIdleConns:    cfg.DBMaxIdle,
+		ConnMaxLifetime: time.Duration(cfg.DBConnLife) * time.Minute,
+		QueryTimeout:    time.Duration(cfg.DBTimeout) * time.Second,
+	}
+	if cfg.EnableMetrics {
+		opts.Driver = metrics.PostgresDriver
+	}
+	return opts
+}
 
-		err = netsnapshot.Activate(ctx, db, cfg.NetworkSnapshotOptions, server)
-		if err != nil {
-			log.Error(err)
-			return fmt.Errorf("Failed to activate network snapshot component, %s", err.Error())
-		}
-		log.Info("Network nodes module Enabled")
+// openPgDb connects to the shared postgres database, and to its read-only
+// replica when one is configured.
+func openPgDb(cfg *config, debug bool) (*postgres.PgDb, error) {
+	opts := cfg.dbConnOptions()
+	db, err := postgres.NewPgDb(opts, debug)
+	if err != nil {
+		return nil, err
 	}
-
-	if cfg.EnableExchange || cfg.EnableExchangeHttp {
-		db, err := dbInstance()
-		if err != nil {
-			return err
+	if cfg.DBReplica != "" {
+		opts.DSN = cfg.DBReplica
+		if err = db.OpenReplica(opts); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("failed to connect to the database replica: %v", err)
 		}
-		if err := exchangesModule.Activate(ctx, strings.Split(cfg.DisabledExchanges, ","), db, server,
-			cfg.EnableExchange, cfg.EnableExchangeHttp); err != nil {
-			return fmt.Errorf("Failed to ectivate the exchanges modules, %s", err.Error())
-		}
-		log.Info("Exchange module enabled")
+		log.Info("Serving the chart and HTTP read queries from the database replica")
 	}
+	return db, nil
+}
 
-	if cfg.CommunityStat || cfg.CommunityStatHttp {
-		db, err := dbInstance()
-		if err != nil {
-			return err
-		}
-		if err := commstats.Activate(ctx, db, server, &cfg.CommunityStatOptions); err != nil {
-			return fmt.Errorf("Failed to ectivate the exchanges modules, %s", err.Error())
-		}
-		log.Info("Community stat module enabled")
+// openEmbeddedDb opens the embedded database of the data directory and creates
+// its missing tables.
+func openEmbeddedDb(ctx context.Context, cfg *config) (*boltdb.BoltDb, error) {
+	db, err := boltdb.NewBoltDb(filepath.Join(cfg.DataDir, embeddedDbFilename))
+	if err != nil {
+		return nil, err
 	}
-
-	if cfg.EnablePow || cfg.EnablePowHttp {
-		db, err := dbInstance()
-		if err != nil {
-			return err
-		}
-		if err := pow.Activate(ctx, cfg.DisabledPows, cfg.PowInterval, db, server, cfg.EnablePow, cfg.EnablePowHttp); err != nil {
-			return fmt.Errorf("Failed to ectivate the PoW modules, %s", err.Error())
-		}
-		log.Info("PoW module enabled")
+	if err = db.CreateTables(ctx); err != nil {
+		log.Error("Error creating tables: ", err)
+		db.Close()
+		return nil, err
 	}
+	return db, nil
+}
 
-	if cfg.EnableVSP || cfg.EnableVSPHttp {
-		db, err := dbInstance()
-		if err != nil {
-			return err
-		}
-		if err := vsp.Activate(ctx, cfg.VSPInterval, db, server, cfg.EnableVSP, cfg.EnableVSPHttp); err != nil {
-			return fmt.Errorf("Failed to ectivate the VSP modules, %s", err.Error())
-		}
-		log.Info("VSP module enabled")
+// moduleDeps builds the dependencies injected into the modules.
+func moduleDeps(ctx context.Context, cfg *config, client *dcrd.Dcrd, server *web.Server,
+	sched *scheduler.Scheduler, xcBot *exchanges.ExchangeBot) (*module.Deps, *sharedDB) {
+	debug := cfg.DebugLevel == "debug"
+
+	db := &sharedDB{
+		ctx:   ctx,
+		cfg:   cfg,
+		debug: debug,
+	}
+	deps := &module.Deps{
+		Dcrd:      client,
+		Server:    server,
+		Scheduler: sched,
+		XcBot:     xcBot,
+		DataDir:   cfg.DataDir,
+		APIURL:    cfg.APIURL,
+		DB:        db.get,
+		OpenDB: func(opts dbhelper.ConnOptions) (module.DB, error) {
+			shared := cfg.dbConnOptions()
+			if opts.DSN == "" && opts.SSLMode == "" {
+				opts.SSLMode = shared.SSLMode
+				opts.SSLCert = shared.SSLCert
+				opts.SSLKey = shared.SSLKey
+				opts.SSLRootCert = shared.SSLRootCert
+			}
+			opts.Driver = shared.Driver
+			opts.MaxOpenConns = shared.MaxOpenConns
+			opts.MaxIdleConns = shared.MaxIdleConns
+			opts.ConnMaxLifetime = shared.ConnMaxLifetime
+			opts.QueryTimeout = shared.QueryTimeout
+			pgDb, err := postgres.NewPgDb(opts, debug)
+			if err != nil {
+				return nil, err
+			}
+			return pgDb, nil
+		},
 	}
-
-	if cfg.EnableTreasuryChart {
-		if err := treasury.Activate(server, xcBot, cfg.APIURL); err != nil {
-			return fmt.Errorf("Failed to activate treasury chart module, %s", err.Error())
-		}
-		log.Info("Treasury chart activated")
+	if cfg.DisabledExchanges != "" {
+		deps.DisabledExchanges = strings.Split(cfg.DisabledExchanges, ",")
 	}
 
-	_, err = homepage.New(server, homepage.Mods{
-		Stk:   stk,
-		Prm:   prms,
-		Ac:    ac,
-		Chrts: chrts,
-	})
-	if err != nil {
-		log.Error(err)
-	}
-	return nil
+	return deps, db
 }
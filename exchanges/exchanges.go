@@ -8,12 +8,10 @@ import (
 	"context"
 	"fmt"
 	"net/http"
-	"sync"
 	"time"
 
-	"github.com/planetdecred/pdanalytics/app"
-	"github.com/planetdecred/pdanalytics/app/helpers"
 	"github.com/planetdecred/pdanalytics/exchanges/ticks"
+	"github.com/planetdecred/pdanalytics/scheduler"
 	"github.com/planetdecred/pdanalytics/web"
 )
 
@@ -39,7 +37,7 @@ var (
 )
 
 func Activate(ctx context.Context, disabledexchanges []string, store ticks.Store, server *web.Server,
-	dataMode, httpMode bool) error {
+	sched *scheduler.Scheduler, dataMode, httpMode bool) error {
 	collectors := make([]ticks.Collector, 0, len(availableExchanges)-len(disabledexchanges))
 	disabledMap := make(map[string]struct{})
 	for _, e := range disabledexchanges {
@@ -78,153 +76,77 @@ func Activate(ctx context.Context, disabledexchanges []string, store ticks.Store
 	}
 
 	if dataMode {
-		go func() {
-			t.Run(ctx)
-		}()
+		if err := t.registerJobs(sched); err != nil {
+			return err
+		}
 	}
 	return nil
 }
 
-func (hub *TickHub) CollectShort(ctx context.Context) {
-	wg := new(sync.WaitGroup)
-	for _, collector := range hub.collectors {
-		if ctx.Err() != nil {
-			log.Error(ctx.Err())
-			break
-		}
-		wg.Add(1)
-		func(ctx context.Context, wg *sync.WaitGroup, collector ticks.Collector) {
-			err := collector.GetShort(ctx)
-			if err != nil {
-				log.Error(err)
-			}
-			wg.Done()
-		}(ctx, wg, collector)
-	}
-	wg.Wait()
-	log.Info("Completed short collection")
+func (hub *TickHub) CollectShort(ctx context.Context) error {
+	return hub.collect(ctx, "short", ticks.Collector.GetShort)
 }
 
-func (hub *TickHub) CollectLong(ctx context.Context) {
-	wg := new(sync.WaitGroup)
-	for _, collector := range hub.collectors {
-		if ctx.Err() != nil {
-			log.Error(ctx.Err())
-			break
-		}
-		wg.Add(1)
-		func(ctx context.Context, wg *sync.WaitGroup, collector ticks.Collector) {
-			err := collector.GetLong(ctx)
-			if err != nil {
-				log.Error(err)
-			}
-			wg.Done()
-		}(ctx, wg, collector)
-	}
-	wg.Wait()
-	log.Info("Completed long collection")
+func (hub *TickHub) CollectLong(ctx context.Context) error {
+	return hub.collect(ctx, "long", ticks.Collector.GetLong)
 }
 
-func (hub *TickHub) CollectHistoric(ctx context.Context) {
-	wg := new(sync.WaitGroup)
-	for _, collector := range hub.collectors {
-		if ctx.Err() != nil {
-			log.Error(ctx.Err())
-			break
-		}
-		wg.Add(1)
-		func(ctx context.Context, wg *sync.WaitGroup, collector ticks.Collector) {
-			err := collector.GetHistoric(ctx)
-			if err != nil {
-				log.Error(err)
-			}
-			wg.Done()
-		}(ctx, wg, collector)
-	}
-	wg.Wait()
-	log.Info("Completed historic collection")
+func (hub *TickHub) CollectHistoric(ctx context.Context) error {
+	return hub.collect(ctx, "historic", ticks.Collector.GetHistoric)
 }
 
-func (hub *TickHub) CollectAll(ctx context.Context) {
+// collect runs get for every exchange and returns an error if any of them
+// failed.
+func (hub *TickHub) collect(ctx context.Context, name string, get func(ticks.Collector, context.Context) error) error {
+	var failed int
 	for _, collector := range hub.collectors {
 		if ctx.Err() != nil {
-			log.Error(ctx.Err())
-			break
+			return ctx.Err()
 		}
-
-		err := collector.GetShort(ctx)
-		if err != nil {
-			log.Error(err)
-		}
-
-		err = collector.GetLong(ctx)
-		if err != nil {
-			log.Error(err)
-		}
-
-		err = collector.GetHistoric(ctx)
-		if err != nil {
+		if err := get(collector, ctx); err != nil {
 			log.Error(err)
+			failed++
 		}
 	}
-}
-
-func (hub *TickHub) Run(ctx context.Context) {
-	shortTicker := time.NewTicker(5 * time.Minute)
-	longTicker := time.NewTicker(time.Hour)
-	dayTicker := time.NewTicker(24 * time.Hour)
-	defer shortTicker.Stop()
-	defer longTicker.Stop()
-	defer dayTicker.Stop()
-
-	if ctx.Err() != nil {
-		log.Error(ctx.Err())
-		return
-	}
-
-	lastCollectionDate := hub.store.LastExchangeTickEntryTime()
-	secondsPassed := time.Since(lastCollectionDate)
-	period := 5 * time.Minute
-
-	if secondsPassed < period {
-		timeLeft := period - secondsPassed
-		log.Infof("Fetching exchange ticks every %dm, collected %s ago, will fetch in %s.", period/time.Minute, helpers.DurationToString(secondsPassed),
-			helpers.DurationToString(timeLeft))
-
-		time.Sleep(timeLeft)
+	if failed > 0 {
+		return fmt.Errorf("%s collection failed for %d of %d exchanges", name, failed, len(hub.collectors))
 	}
+	log.Infof("Completed %s collection", name)
+	return nil
+}
 
-	registerStarter := func() {
-		// continually check the state of the app until its free to run this module
-		app.MarkBusyIfFree()
-
-		log.Info("Starting exchange tick collection cycle")
+// registerJobs schedules the short, long and historic tick collections. They
+// share a concurrency class so that the exchange APIs are not queried by more
+// than one collection at a time.
+func (hub *TickHub) registerJobs(sched *scheduler.Scheduler) error {
+	jobs := []scheduler.Job{
+		{
+			Name:     "exchanges-short",
+			Interval: 5 * time.Minute,
+			LastRun: func(ctx context.Context) (time.Time, error) {
+				return hub.store.LastExchangeTickEntryTime(), nil
+			},
+			Run: hub.CollectShort,
+		},
+		{
+			Name:     "exchanges-long",
+			Interval: time.Hour,
+			Run:      hub.CollectLong,
+		},
+		{
+			Name:     "exchanges-historic",
+			Interval: 24 * time.Hour,
+			Run:      hub.CollectHistoric,
+		},
 	}
-
-	registerStarter()
-	hub.CollectAll(ctx)
-	app.ReleaseForNewModule()
-
-	go func() {
-		for {
-			select {
-			case <-ctx.Done():
-				return
-			case <-shortTicker.C:
-				registerStarter()
-				hub.CollectShort(ctx)
-				app.ReleaseForNewModule()
-			case <-longTicker.C:
-				registerStarter()
-				hub.CollectLong(ctx)
-				app.ReleaseForNewModule()
-			case <-dayTicker.C:
-				registerStarter()
-				hub.CollectHistoric(ctx)
-				app.ReleaseForNewModule()
-			}
+	for _, job := range jobs {
+		job.Class = "exchanges"
+		job.Timeout = clientTimeout * 10
+		if err := sched.Register(job); err != nil {
+			return err
 		}
-	}()
+	}
+	return nil
 }
 
 func (hub *TickHub) setupHttp() error {
@@ -0,0 +1,56 @@
+package exchanges_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/planetdecred/pdanalytics/exchanges"
+	"github.com/planetdecred/pdanalytics/exchanges/ticks"
+	"github.com/planetdecred/pdanalytics/memdb"
+	"github.com/planetdecred/pdanalytics/testutil"
+)
+
+func TestCollectShort(t *testing.T) {
+	// The ticks older than the last collection, two weeks ago at first, are
+	// dropped, so they are dated from now.
+	const tickTemplate = "2006-01-02T15:04:05"
+	now := time.Now().UTC().Truncate(5 * time.Minute)
+	bittrexResponse := fmt.Sprintf(`{"result":[
+		{"H":0.0031,"L":0.0029,"O":0.0030,"C":0.0030,"BV":12.5,"T":"%s"},
+		{"H":0.0032,"L":0.0030,"O":0.0030,"C":0.0031,"BV":14.0,"T":"%s"}
+	]}`, now.Add(-10*time.Minute).Format(tickTemplate), now.Add(-5*time.Minute).Format(tickTemplate))
+
+	testutil.MockAPIs(t, map[string]http.Handler{
+		"bittrex.com": testutil.JSON(bittrexResponse),
+	})
+	sched := testutil.NewScheduler(t)
+	server := testutil.NewServer(t)
+	db := memdb.New()
+
+	disabled := []string{ticks.Bittrexusd, ticks.Binance, ticks.Poloniex}
+	err := exchanges.Activate(context.Background(), disabled, db, server.Server, sched, true, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testutil.WaitForJob(t, sched, "exchanges-short", 5*time.Second)
+
+	var pairs []string
+	server.GetJSON("/api/exchanges/currency-pairs?exchange="+ticks.Bittrex, &pairs)
+	if len(pairs) != 2 || pairs[1] != "BTC/DCR" {
+		t.Fatalf("got currency pairs %v, want [All BTC/DCR]", pairs)
+	}
+
+	var data struct {
+		ExData []ticks.TickDto `json:"exData"`
+	}
+	server.GetJSON("/exchangedata?view-option=table&selected-exchange=bittrex&selected-interval=5", &data)
+	if len(data.ExData) != 2 {
+		t.Fatalf("got %d ticks, want 2", len(data.ExData))
+	}
+	if tick := data.ExData[0]; tick.Close != 0.0031 || tick.Volume != 14 {
+		t.Errorf("unexpected latest tick %+v", tick)
+	}
+}
@@ -0,0 +1,72 @@
+package exchanges
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/decred/slog"
+	"github.com/planetdecred/pdanalytics/exchanges/ticks"
+	"github.com/planetdecred/pdanalytics/module"
+	"github.com/planetdecred/pdanalytics/scheduler"
+	"github.com/planetdecred/pdanalytics/web"
+)
+
+// ExchangeOptions are the config options of the exchange module. The
+// exchanges to collect from are configured with --disabled-exchanges, which
+// is shared with the exchange monitor.
+type ExchangeOptions struct {
+	EnableExchange     bool `long:"exchange" description:"Enable/Disable the exchange historic data collector from running"`
+	EnableExchangeHttp bool `long:"exchange-http" description:"Enable/Disable the exchange historic http endpoint from running"`
+}
+
+type exchangeModule struct {
+	options  ExchangeOptions
+	server   *web.Server
+	sched    *scheduler.Scheduler
+	store    ticks.Store
+	disabled []string
+}
+
+func init() {
+	module.Register(&exchangeModule{
+		options: ExchangeOptions{
+			EnableExchange:     true,
+			EnableExchangeHttp: true,
+		},
+	})
+}
+
+func (m *exchangeModule) Name() string                 { return "exchanges" }
+func (m *exchangeModule) LogSubsystem() string         { return "EXCH" }
+func (m *exchangeModule) UseLogger(logger slog.Logger) { UseLogger(logger) }
+func (m *exchangeModule) Options() interface{}         { return &m.options }
+
+func (m *exchangeModule) Enabled() bool {
+	return m.options.EnableExchange || m.options.EnableExchangeHttp
+}
+
+func (m *exchangeModule) Init(deps *module.Deps) error {
+	db, err := deps.DB()
+	if err != nil {
+		return err
+	}
+	store, ok := db.(ticks.Store)
+	if !ok {
+		return fmt.Errorf("%T is not a ticks.Store", db)
+	}
+	m.server = deps.Server
+	m.sched = deps.Scheduler
+	m.store = store
+	m.disabled = deps.DisabledExchanges
+	return nil
+}
+
+func (m *exchangeModule) Start(ctx context.Context) error {
+	return Activate(ctx, m.disabled, m.store, m.server, m.sched, m.options.EnableExchange, m.options.EnableExchangeHttp)
+}
+
+func (m *exchangeModule) Stop() error { return nil }
+
+func (m *exchangeModule) Health() module.Health {
+	return module.JobsHealth(m.sched, "exchanges")
+}
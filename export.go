@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/planetdecred/pdanalytics/export"
+)
+
+// exportCommand holds the options of the export command.
+type exportCommand struct {
+	Format    string `long:"format" description:"File format {csv, parquet}"`
+	Output    string `short:"o" long:"output" description:"File to write the dataset to, the standard output when not set"`
+	From      string `long:"from" description:"Start of the time range, an RFC 3339 time, a date (2006-01-02) or unix seconds"`
+	To        string `long:"to" description:"End of the time range, excluded, in the format of from"`
+	Exchange  string `long:"exchange" description:"Exchange of the exchange_ticks"`
+	Pair      string `long:"pair" description:"Currency pair of the exchange_ticks, e.g. BTC/DCR"`
+	Pool      string `long:"pool" description:"Mining pool of the pow data"`
+	VSP       string `long:"vsp" description:"VSP of the vsp_ticks"`
+	Subreddit string `long:"subreddit" description:"Subreddit of the reddit stats"`
+
+	Args struct {
+		Dataset string `positional-arg-name:"dataset" description:"Dataset to export: mempool, blocks, votes, exchange_ticks, pow, vsp_ticks, reddit, twitter, github, youtube, snapshots or nodes"`
+	} `positional-args:"yes" required:"yes"`
+}
+
+// filter returns the filter of the options.
+func (c *exportCommand) filter() (export.Filter, error) {
+	var filter export.Filter
+	var err error
+	if filter.From, err = export.ParseTime(c.From); err != nil {
+		return filter, err
+	}
+	if filter.To, err = export.ParseTime(c.To); err != nil {
+		return filter, err
+	}
+	filter.Values = map[string]string{
+		export.FilterExchange:  c.Exchange,
+		export.FilterPair:      c.Pair,
+		export.FilterPool:      c.Pool,
+		export.FilterVSP:       c.VSP,
+		export.FilterSubreddit: c.Subreddit,
+	}
+	return filter, nil
+}
+
+// runExport writes the dataset of the export command to its output.
+func runExport(ctx context.Context, cfg *config) error {
+	if cfg.DBBackend != "postgres" {
+		return fmt.Errorf("the export command requires the postgres backend")
+	}
+	opts := cfg.Export
+	filter, err := opts.filter()
+	if err != nil {
+		return err
+	}
+
+	var out io.Writer = os.Stdout
+	if opts.Output != "" {
+		f, err := os.Create(opts.Output)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		out = f
+	} else {
+		// The logs would mix with the dataset.
+		logOutput = os.Stderr
+	}
+
+	db, err := openPgDb(cfg, cfg.DebugLevel == "debug")
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	rows, err := export.Export(ctx, db, opts.Args.Dataset, filter, opts.Format, out)
+	if err != nil {
+		return fmt.Errorf("failed to export the %s dataset: %v", opts.Args.Dataset, err)
+	}
+	log.Infof("Exported %d rows of the %s dataset", rows, opts.Args.Dataset)
+	return nil
+}
@@ -0,0 +1,56 @@
+package export
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+)
+
+type csvWriter struct {
+	w      *csv.Writer
+	record []string
+}
+
+// NewCSVWriter returns a RowWriter of CSV with a header line. The times are
+// RFC 3339 UTC times and the NULL values are empty.
+func NewCSVWriter(w io.Writer) RowWriter {
+	return &csvWriter{w: csv.NewWriter(w)}
+}
+
+func (c *csvWriter) WriteHeader(columns []Column) error {
+	header := make([]string, len(columns))
+	for i, column := range columns {
+		header[i] = column.Name
+	}
+	c.record = make([]string, len(columns))
+	return c.w.Write(header)
+}
+
+func (c *csvWriter) WriteRow(values []interface{}) error {
+	for i, value := range values {
+		switch v := value.(type) {
+		case nil:
+			c.record[i] = ""
+		case int64:
+			c.record[i] = strconv.FormatInt(v, 10)
+		case float64:
+			c.record[i] = strconv.FormatFloat(v, 'f', -1, 64)
+		case string:
+			c.record[i] = v
+		case bool:
+			c.record[i] = strconv.FormatBool(v)
+		case time.Time:
+			c.record[i] = v.UTC().Format(time.RFC3339)
+		default:
+			return fmt.Errorf("unsupported value %T", value)
+		}
+	}
+	return c.w.Write(c.record)
+}
+
+func (c *csvWriter) Close() error {
+	c.w.Flush()
+	return c.w.Error()
+}
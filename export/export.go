@@ -0,0 +1,200 @@
+// Package export streams the collected datasets as CSV or Parquet, from the
+// export command and the /api/export/{dataset} endpoints. The rows are written
+// as they are read from the database, so a dataset is never held in memory.
+package export
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ColumnType is the type of the values of a column.
+type ColumnType int
+
+const (
+	Int ColumnType = iota
+	Float
+	String
+	Bool
+	Time
+)
+
+// Column is a column of an exported dataset.
+type Column struct {
+	Name string
+	Type ColumnType
+}
+
+// The filters a dataset can accept besides the time range.
+const (
+	FilterExchange  = "exchange"
+	FilterPair      = "pair"
+	FilterPool      = "pool"
+	FilterVSP       = "vsp"
+	FilterSubreddit = "subreddit"
+)
+
+// Filter selects the rows of a dataset. The zero values select all the rows.
+type Filter struct {
+	// From and To bound the time of the rows, To excluded.
+	From time.Time
+	To   time.Time
+	// Values holds the values of the dataset filters by filter name.
+	Values map[string]string
+}
+
+// Dataset is an exported dataset.
+type Dataset struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Filters     []string `json:"filters,omitempty"`
+}
+
+// Datasets are the exported datasets.
+var Datasets = []Dataset{
+	{Name: "mempool", Description: "Mempool snapshots"},
+	{Name: "blocks", Description: "Block propagation, the receive time of the blocks"},
+	{Name: "votes", Description: "Vote propagation, the receive time of the votes"},
+	{Name: "exchange_ticks", Description: "Exchange ticks", Filters: []string{FilterExchange, FilterPair}},
+	{Name: "pow", Description: "Mining pool hashrate, workers and prices", Filters: []string{FilterPool}},
+	{Name: "vsp_ticks", Description: "VSP ticket and user counts", Filters: []string{FilterVSP}},
+	{Name: "reddit", Description: "Subreddit subscribers and active accounts", Filters: []string{FilterSubreddit}},
+	{Name: "twitter", Description: "Twitter followers"},
+	{Name: "github", Description: "Github stars and forks"},
+	{Name: "youtube", Description: "Youtube subscribers and views"},
+	{Name: "snapshots", Description: "Network snapshots, the node counts"},
+	{Name: "nodes", Description: "Crawled network nodes, filtered on their last seen time"},
+}
+
+// FindDataset returns the dataset of the given name.
+func FindDataset(name string) (Dataset, error) {
+	for _, d := range Datasets {
+		if d.Name == name {
+			return d, nil
+		}
+	}
+	names := make([]string, len(Datasets))
+	for i, d := range Datasets {
+		names[i] = d.Name
+	}
+	return Dataset{}, fmt.Errorf("unknown dataset %q, expected one of %s", name, strings.Join(names, ", "))
+}
+
+// accepts reports whether the dataset accepts the named filter.
+func (d Dataset) accepts(filter string) bool {
+	for _, f := range d.Filters {
+		if f == filter {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckFilter checks that the dataset accepts the filters set.
+func (d Dataset) CheckFilter(filter Filter) error {
+	for name, value := range filter.Values {
+		if value != "" && !d.accepts(name) {
+			return fmt.Errorf("the %s dataset cannot be filtered by %s", d.Name, name)
+		}
+	}
+	if !filter.From.IsZero() && !filter.To.IsZero() && !filter.From.Before(filter.To) {
+		return fmt.Errorf("the start of the time range must be before its end")
+	}
+	return nil
+}
+
+// RowWriter writes the rows of a dataset in a file format.
+type RowWriter interface {
+	// WriteHeader is called once, before the rows.
+	WriteHeader(columns []Column) error
+	// WriteRow writes a row of int64, float64, string, bool, time.Time or nil
+	// values, in the order of the columns.
+	WriteRow(values []interface{}) error
+	// Close writes the buffered rows and ends the file, it does not close
+	// the underlying writer.
+	Close() error
+}
+
+// Store streams the rows of a dataset, ordered by time, to a RowWriter.
+type Store interface {
+	ExportDataset(ctx context.Context, dataset string, filter Filter, w RowWriter) error
+}
+
+// The file formats.
+const (
+	FormatCSV     = "csv"
+	FormatParquet = "parquet"
+)
+
+// NewWriter returns the RowWriter of the named format.
+func NewWriter(format string, w io.Writer) (RowWriter, error) {
+	switch format {
+	case FormatCSV:
+		return NewCSVWriter(w), nil
+	case FormatParquet:
+		return NewParquetWriter(w), nil
+	}
+	return nil, fmt.Errorf("unknown export format %q, expected csv or parquet", format)
+}
+
+// ContentType returns the MIME type of the format.
+func ContentType(format string) string {
+	if format == FormatParquet {
+		return "application/vnd.apache.parquet"
+	}
+	return "text/csv"
+}
+
+// ParseTime parses the bound of a time range given as an RFC 3339 time, a
+// 2006-01-02 date or unix seconds. An empty string is the zero time.
+func ParseTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t.UTC(), nil
+	}
+	if t, err := time.Parse("2006-01-02", s); err == nil {
+		return t, nil
+	}
+	if unix, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return time.Unix(unix, 0).UTC(), nil
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q, expected an RFC 3339 time, a date or unix seconds", s)
+}
+
+// Export streams the rows of the dataset matching the filter to w in the
+// format, and returns the number of rows written.
+func Export(ctx context.Context, store Store, dataset string, filter Filter, format string, w io.Writer) (int64, error) {
+	d, err := FindDataset(dataset)
+	if err != nil {
+		return 0, err
+	}
+	if err = d.CheckFilter(filter); err != nil {
+		return 0, err
+	}
+	rw, err := NewWriter(format, w)
+	if err != nil {
+		return 0, err
+	}
+	counter := &countingWriter{RowWriter: rw}
+	if err = store.ExportDataset(ctx, d.Name, filter, counter); err != nil {
+		return counter.rows, err
+	}
+	return counter.rows, rw.Close()
+}
+
+// countingWriter counts the rows written.
+type countingWriter struct {
+	RowWriter
+	rows int64
+}
+
+func (c *countingWriter) WriteRow(values []interface{}) error {
+	c.rows++
+	return c.RowWriter.WriteRow(values)
+}
@@ -0,0 +1,323 @@
+package export
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi"
+)
+
+// testStore exports a dataset of two rows, or fails with err before writing
+// any.
+type testStore struct {
+	filter Filter
+	err    error
+}
+
+func (s *testStore) ExportDataset(_ context.Context, _ string, filter Filter, w RowWriter) error {
+	s.filter = filter
+	if s.err != nil {
+		return s.err
+	}
+	err := w.WriteHeader([]Column{{"time", Time}, {"pool", String}, {"hashrate", Float}, {"workers", Int},
+		{"up", Bool}})
+	if err != nil {
+		return err
+	}
+	if err = w.WriteRow([]interface{}{time.Unix(1600000000, 0), "f2pool", 12.5, int64(3), true}); err != nil {
+		return err
+	}
+	return w.WriteRow([]interface{}{time.Unix(1600000060, 0), "uupool", nil, int64(4), false})
+}
+
+func TestExportCSV(t *testing.T) {
+	store := &testStore{}
+	var buf bytes.Buffer
+	filter := Filter{Values: map[string]string{FilterPool: "f2pool"}}
+	rows, err := Export(context.Background(), store, "pow", filter, FormatCSV, &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "time,pool,hashrate,workers,up\n" +
+		"2020-09-13T12:26:40Z,f2pool,12.5,3,true\n" +
+		"2020-09-13T12:27:40Z,uupool,,4,false\n"
+	if rows != 2 || buf.String() != want {
+		t.Fatalf("got %d rows:\n%s\nwant 2 rows:\n%s", rows, buf.String(), want)
+	}
+	if store.filter.Values[FilterPool] != "f2pool" {
+		t.Errorf("got pool filter %q, want f2pool", store.filter.Values[FilterPool])
+	}
+}
+
+func TestExportParquet(t *testing.T) {
+	var buf bytes.Buffer
+	if _, err := Export(context.Background(), &testStore{}, "pow", Filter{}, FormatParquet, &buf); err != nil {
+		t.Fatal(err)
+	}
+	file := buf.Bytes()
+	if !bytes.HasPrefix(file, parquetMagic) || !bytes.HasSuffix(file, parquetMagic) {
+		t.Fatal("missing the PAR1 magic")
+	}
+	footer := int(binary.LittleEndian.Uint32(file[len(file)-8:]))
+	if footer > len(file)-12 {
+		t.Fatalf("footer length %d exceeds the %d bytes file", footer, len(file))
+	}
+	r := &thriftReader{b: file[len(file)-8-footer : len(file)-8]}
+	meta := r.structure()
+	if r.err != nil {
+		t.Fatalf("cannot decode the footer: %v", r.err)
+	}
+	if meta[3] != int64(2) {
+		t.Errorf("got %v rows, want 2", meta[3])
+	}
+
+	// The schema is the root followed by the optional columns.
+	type schemaElement struct {
+		name      string
+		typ       interface{}
+		converted interface{}
+	}
+	want := []schemaElement{
+		{"time", int64(parquetInt64), int64(convertedTimestampMillis)},
+		{"pool", int64(parquetByteArray), int64(convertedUTF8)},
+		{"hashrate", int64(parquetDouble), nil},
+		{"workers", int64(parquetInt64), nil},
+		{"up", int64(parquetBoolean), nil},
+	}
+	schema, _ := meta[2].([]interface{})
+	if len(schema) != len(want)+1 {
+		t.Fatalf("got %d schema elements, want %d", len(schema), len(want)+1)
+	}
+	if root := schema[0].(map[int16]interface{}); root[4] != "schema" || root[5] != int64(len(want)) {
+		t.Errorf("unexpected schema root %v", root)
+	}
+	for i, w := range want {
+		e := schema[i+1].(map[int16]interface{})
+		got := schemaElement{e[4].(string), e[1], e[6]}
+		if got != w || e[3] != int64(repetitionOptional) {
+			t.Errorf("got schema element %+v, want %+v", e, w)
+		}
+	}
+
+	// The row group has a data page of 2 values per column.
+	rowGroups, _ := meta[4].([]interface{})
+	if len(rowGroups) != 1 {
+		t.Fatalf("got %d row groups, want 1", len(rowGroups))
+	}
+	rowGroup := rowGroups[0].(map[int16]interface{})
+	chunks, _ := rowGroup[1].([]interface{})
+	if rowGroup[3] != int64(2) || len(chunks) != len(want) {
+		t.Fatalf("unexpected row group %v", rowGroup)
+	}
+	var columns [][]interface{}
+	for i, chunk := range chunks {
+		columnMeta := chunk.(map[int16]interface{})[3].(map[int16]interface{})
+		if columnMeta[1] != want[i].typ || columnMeta[5] != int64(2) {
+			t.Errorf("unexpected metadata %v of column %s", columnMeta, want[i].name)
+		}
+		offset := int(columnMeta[9].(int64))
+		r := &thriftReader{b: file, pos: offset}
+		header := r.structure()
+		dataPage, _ := header[5].(map[int16]interface{})
+		if r.err != nil || header[1] != int64(pageData) || dataPage[1] != int64(2) {
+			t.Fatalf("unexpected page header %v of column %s: %v", header, want[i].name, r.err)
+		}
+		if end := r.pos + int(header[3].(int64)); int64(end-offset) != columnMeta[6] {
+			t.Errorf("the %s page ends at %d, want %d", want[i].name, end, int64(offset)+columnMeta[6].(int64))
+		}
+		columns = append(columns, r.page(2, columnMeta[1].(int64)))
+		if r.err != nil {
+			t.Fatalf("cannot decode the %s page: %v", want[i].name, r.err)
+		}
+	}
+
+	rows := [][]interface{}{
+		{int64(1600000000000), "f2pool", 12.5, int64(3), true},
+		{int64(1600000060000), "uupool", nil, int64(4), false},
+	}
+	for i, row := range rows {
+		for j, value := range row {
+			if columns[j][i] != value {
+				t.Errorf("row %d: got %s %v, want %v", i, want[j].name, columns[j][i], value)
+			}
+		}
+	}
+}
+
+// thriftReader decodes the thrift compact protocol, the structs as maps of
+// the field values by id.
+type thriftReader struct {
+	b   []byte
+	pos int
+	err error
+}
+
+func (r *thriftReader) next(n int) []byte {
+	if r.err == nil && (n < 0 || r.pos+n > len(r.b)) {
+		r.err = fmt.Errorf("reading %d bytes at %d of %d", n, r.pos, len(r.b))
+	}
+	if r.err != nil {
+		return make([]byte, n)
+	}
+	r.pos += n
+	return r.b[r.pos-n : r.pos]
+}
+
+func (r *thriftReader) uvarint() uint64 {
+	v, n := binary.Uvarint(r.b[r.pos:])
+	if n <= 0 {
+		r.err = fmt.Errorf("invalid varint at %d", r.pos)
+		return 0
+	}
+	r.pos += n
+	return v
+}
+
+func (r *thriftReader) zigzag() int64 {
+	v := r.uvarint()
+	return int64(v>>1) ^ -int64(v&1)
+}
+
+func (r *thriftReader) structure() map[int16]interface{} {
+	fields := make(map[int16]interface{})
+	var id int16
+	for r.err == nil {
+		h := r.next(1)[0]
+		if h == 0 {
+			break
+		}
+		if delta := int16(h >> 4); delta > 0 {
+			id += delta
+		} else {
+			id = int16(r.zigzag())
+		}
+		fields[id] = r.value(h & 0x0f)
+	}
+	return fields
+}
+
+func (r *thriftReader) value(typ byte) interface{} {
+	switch typ {
+	case 1, 2:
+		return typ == 1
+	case 3:
+		return int64(r.next(1)[0])
+	case 4, thriftI32, thriftI64:
+		return r.zigzag()
+	case 7:
+		return math.Float64frombits(binary.LittleEndian.Uint64(r.next(8)))
+	case thriftBinary:
+		return string(r.next(int(r.uvarint())))
+	case thriftList:
+		h := r.next(1)[0]
+		size := int(h >> 4)
+		if size == 15 {
+			size = int(r.uvarint())
+		}
+		list := make([]interface{}, 0, size)
+		for i := 0; i < size && r.err == nil; i++ {
+			list = append(list, r.value(h&0x0f))
+		}
+		return list
+	case thriftStruct:
+		return r.structure()
+	}
+	r.err = fmt.Errorf("unexpected thrift type %d at %d", typ, r.pos)
+	return nil
+}
+
+// page decodes the definition levels and the plain encoded values of an
+// uncompressed data page of an optional column, the nulls as nil.
+func (r *thriftReader) page(numValues int, typ int64) []interface{} {
+	levels := &thriftReader{b: r.next(int(binary.LittleEndian.Uint32(r.next(4))))}
+	var defined []bool
+	for len(defined) < numValues && levels.err == nil {
+		h := levels.uvarint()
+		if h&1 == 1 {
+			// A bit packed run of groups of 8 levels.
+			for _, b := range levels.next(int(h >> 1)) {
+				for i := 0; i < 8; i++ {
+					defined = append(defined, b&(1<<i) != 0)
+				}
+			}
+			continue
+		}
+		v := levels.next(1)[0] == 1
+		for i := uint64(0); i < h>>1; i++ {
+			defined = append(defined, v)
+		}
+	}
+	if levels.err != nil {
+		r.err = levels.err
+		return nil
+	}
+
+	values := make([]interface{}, numValues)
+	var bit int
+	var bits []byte
+	for i := range values {
+		if !defined[i] {
+			continue
+		}
+		switch typ {
+		case parquetBoolean:
+			if bit%8 == 0 {
+				bits = r.next(1)
+			}
+			values[i] = bits[0]&(1<<(bit%8)) != 0
+			bit++
+		case parquetInt64:
+			values[i] = int64(binary.LittleEndian.Uint64(r.next(8)))
+		case parquetDouble:
+			values[i] = math.Float64frombits(binary.LittleEndian.Uint64(r.next(8)))
+		case parquetByteArray:
+			values[i] = string(r.next(int(binary.LittleEndian.Uint32(r.next(4)))))
+		}
+	}
+	return values
+}
+
+func TestCheckFilter(t *testing.T) {
+	if _, err := Export(context.Background(), &testStore{}, "mempool",
+		Filter{Values: map[string]string{FilterPool: "f2pool"}}, FormatCSV, &bytes.Buffer{}); err == nil {
+		t.Error("the mempool dataset accepted a pool filter")
+	}
+	if _, err := Export(context.Background(), &testStore{}, "blocks", Filter{}, "xlsx", &bytes.Buffer{}); err == nil {
+		t.Error("the xlsx format was accepted")
+	}
+	from, _ := ParseTime("2021-02-01")
+	to, _ := ParseTime("1609459200")
+	if err := (Dataset{Name: "blocks"}).CheckFilter(Filter{From: from, To: to}); err == nil {
+		t.Error("a time range ending before its start was accepted")
+	}
+}
+
+func TestDatasetHandler(t *testing.T) {
+	store := &testStore{}
+	router := chi.NewRouter()
+	router.Get("/api/export/{dataset}", datasetHandler(store))
+
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/api/export/pow?pool=f2pool", nil))
+	if res.Code != http.StatusOK || res.Header().Get("Content-Type") != "text/csv" ||
+		res.Header().Get("Content-Disposition") != `attachment; filename="pow.csv"` {
+		t.Errorf("got status %d and headers %v, want the csv attachment", res.Code, res.Header())
+	}
+
+	// A query failing before any row is written is reported.
+	store.err = errors.New("statement timeout")
+	res = httptest.NewRecorder()
+	router.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/api/export/pow", nil))
+	if res.Code != http.StatusInternalServerError || res.Header().Get("Content-Type") != "application/json" ||
+		res.Header().Get("Content-Disposition") != "" {
+		t.Errorf("got status %d and headers %v, want a json error", res.Code, res.Header())
+	}
+}
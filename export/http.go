@@ -0,0 +1,104 @@
+package export
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/go-chi/chi"
+	"github.com/planetdecred/pdanalytics/web"
+)
+
+// datasetsHandler lists the exported datasets and their filters.
+// /api/export
+func datasetsHandler(w http.ResponseWriter, _ *http.Request) {
+	web.RenderJSON(w, Datasets)
+}
+
+// datasetHandler streams a dataset in the format given by the format
+// parameter, csv by default, filtered by the from and to time range and the
+// filters of the dataset.
+// /api/export/{dataset}?format=&from=&to=&exchange=&pair=&pool=&vsp=&subreddit=
+func datasetHandler(store Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		d, err := FindDataset(chi.URLParam(r, "dataset"))
+		if err != nil {
+			w.WriteHeader(http.StatusNotFound)
+			web.RenderErrorfJSON(w, err.Error())
+			return
+		}
+
+		format := r.FormValue("format")
+		if format == "" {
+			format = FormatCSV
+		}
+		filter, err := requestFilter(r)
+		if err == nil {
+			err = d.CheckFilter(filter)
+		}
+		aw := &attachmentWriter{
+			ResponseWriter: w,
+			contentType:    ContentType(format),
+			filename:       d.Name + "." + format,
+		}
+		var rw RowWriter
+		if err == nil {
+			rw, err = NewWriter(format, aw)
+		}
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			web.RenderErrorfJSON(w, err.Error())
+			return
+		}
+
+		if err = store.ExportDataset(r.Context(), d.Name, filter, rw); err == nil {
+			err = rw.Close()
+		}
+		if err == nil {
+			return
+		}
+		log.Errorf("Cannot export the %s dataset: %v", d.Name, err)
+		// Once the rows are streaming, an error can only cut the response.
+		if !aw.written {
+			w.WriteHeader(http.StatusInternalServerError)
+			web.RenderErrorfJSON(w, "cannot export the %s dataset", d.Name)
+		}
+	}
+}
+
+// attachmentWriter is the ResponseWriter of an exported dataset. The
+// attachment headers are only set by the first write, so that an error before
+// any row is streamed is still answered with an error status.
+type attachmentWriter struct {
+	http.ResponseWriter
+	contentType string
+	filename    string
+	written     bool
+}
+
+func (w *attachmentWriter) Write(b []byte) (int, error) {
+	if !w.written {
+		w.written = true
+		w.Header().Set("Content-Type", w.contentType)
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, w.filename))
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// requestFilter returns the filter of the request parameters.
+func requestFilter(r *http.Request) (Filter, error) {
+	var filter Filter
+	var err error
+	if filter.From, err = ParseTime(r.FormValue("from")); err != nil {
+		return filter, err
+	}
+	if filter.To, err = ParseTime(r.FormValue("to")); err != nil {
+		return filter, err
+	}
+	filter.Values = make(map[string]string)
+	for _, name := range []string{FilterExchange, FilterPair, FilterPool, FilterVSP, FilterSubreddit} {
+		if value := r.FormValue(name); value != "" {
+			filter.Values[name] = value
+		}
+	}
+	return filter, nil
+}
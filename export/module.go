@@ -0,0 +1,55 @@
+package export
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/decred/slog"
+	"github.com/planetdecred/pdanalytics/module"
+	"github.com/planetdecred/pdanalytics/web"
+)
+
+// ExportOptions are the config options of the export module.
+type ExportOptions struct {
+	EnableExportAPI bool `long:"exportapi" description:"Serve the datasets as CSV or Parquet on /api/export/{dataset}"`
+}
+
+type exportModule struct {
+	options ExportOptions
+	server  *web.Server
+	store   Store
+}
+
+func init() {
+	module.Register(&exportModule{})
+}
+
+func (m *exportModule) Name() string                 { return "export" }
+func (m *exportModule) LogSubsystem() string         { return "EXPT" }
+func (m *exportModule) UseLogger(logger slog.Logger) { UseLogger(logger) }
+func (m *exportModule) Options() interface{}         { return &m.options }
+func (m *exportModule) Enabled() bool                { return m.options.EnableExportAPI }
+
+func (m *exportModule) Init(deps *module.Deps) error {
+	db, err := deps.DB()
+	if err != nil {
+		return err
+	}
+	store, ok := db.(Store)
+	if !ok {
+		return fmt.Errorf("%T is not an export.Store", db)
+	}
+	m.server = deps.Server
+	m.store = store
+	return nil
+}
+
+func (m *exportModule) Start(context.Context) error {
+	m.server.AddRoute("/api/export", web.GET, datasetsHandler)
+	m.server.AddRoute("/api/export/{dataset}", web.GET, datasetHandler(m.store))
+	return nil
+}
+
+func (m *exportModule) Stop() error { return nil }
+
+func (m *exportModule) Health() module.Health { return module.Healthy }
@@ -0,0 +1,412 @@
+package export
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"time"
+)
+
+// rowGroupSize is the number of rows of a Parquet row group, the rows held in
+// memory before they are written.
+const rowGroupSize = 10000
+
+var parquetMagic = []byte("PAR1")
+
+// The values of the Parquet format enums used by the writer.
+const (
+	parquetBoolean   = 0
+	parquetInt64     = 2
+	parquetDouble    = 5
+	parquetByteArray = 6
+
+	convertedUTF8            = 0
+	convertedTimestampMillis = 9
+
+	repetitionOptional = 1
+
+	encodingPlain = 0
+	encodingRLE   = 3
+
+	pageData          = 0
+	codecUncompressed = 0
+)
+
+// parquetColumn holds the values of a column for the current row group.
+type parquetColumn struct {
+	Column
+	defined []bool
+	values  bytes.Buffer
+	bools   []bool
+}
+
+// columnChunkMeta is the metadata of a written column chunk.
+type columnChunkMeta struct {
+	offset    int64
+	size      int64
+	numValues int64
+}
+
+type rowGroupMeta struct {
+	columns []columnChunkMeta
+	numRows int64
+}
+
+// parquetWriter writes a Parquet file of uncompressed, plain encoded optional
+// columns. The rows are buffered and written as a row group every
+// rowGroupSize rows.
+type parquetWriter struct {
+	w         io.Writer
+	offset    int64
+	columns   []*parquetColumn
+	rows      int
+	rowGroups []rowGroupMeta
+}
+
+// NewParquetWriter returns a RowWriter of Parquet. The times are stored as
+// millisecond timestamps and the strings as UTF-8 byte arrays.
+func NewParquetWriter(w io.Writer) RowWriter {
+	return &parquetWriter{w: w}
+}
+
+func (p *parquetWriter) write(b []byte) error {
+	n, err := p.w.Write(b)
+	p.offset += int64(n)
+	return err
+}
+
+func (p *parquetWriter) WriteHeader(columns []Column) error {
+	p.columns = make([]*parquetColumn, len(columns))
+	for i, column := range columns {
+		p.columns[i] = &parquetColumn{Column: column}
+	}
+	return p.write(parquetMagic)
+}
+
+func (p *parquetWriter) WriteRow(values []interface{}) error {
+	for i, value := range values {
+		if err := p.columns[i].add(value); err != nil {
+			return err
+		}
+	}
+	p.rows++
+	if p.rows >= rowGroupSize {
+		return p.writeRowGroup()
+	}
+	return nil
+}
+
+func (c *parquetColumn) add(value interface{}) error {
+	if value == nil {
+		c.defined = append(c.defined, false)
+		return nil
+	}
+	var buf [8]byte
+	switch c.Type {
+	case Int:
+		v, ok := value.(int64)
+		if !ok {
+			return fmt.Errorf("column %s: got %T, want int64", c.Name, value)
+		}
+		binary.LittleEndian.PutUint64(buf[:], uint64(v))
+		c.values.Write(buf[:])
+	case Float:
+		v, ok := value.(float64)
+		if !ok {
+			return fmt.Errorf("column %s: got %T, want float64", c.Name, value)
+		}
+		binary.LittleEndian.PutUint64(buf[:], math.Float64bits(v))
+		c.values.Write(buf[:])
+	case String:
+		v, ok := value.(string)
+		if !ok {
+			return fmt.Errorf("column %s: got %T, want string", c.Name, value)
+		}
+		binary.LittleEndian.PutUint32(buf[:4], uint32(len(v)))
+		c.values.Write(buf[:4])
+		c.values.WriteString(v)
+	case Bool:
+		v, ok := value.(bool)
+		if !ok {
+			return fmt.Errorf("column %s: got %T, want bool", c.Name, value)
+		}
+		c.bools = append(c.bools, v)
+	case Time:
+		v, ok := value.(time.Time)
+		if !ok {
+			return fmt.Errorf("column %s: got %T, want time.Time", c.Name, value)
+		}
+		millis := v.UnixNano() / int64(time.Millisecond)
+		binary.LittleEndian.PutUint64(buf[:], uint64(millis))
+		c.values.Write(buf[:])
+	}
+	c.defined = append(c.defined, true)
+	return nil
+}
+
+// page returns the data page of the column: the definition levels, RLE
+// encoded with a bit width of 1, followed by the plain encoded values.
+func (c *parquetColumn) page() []byte {
+	var levels []byte
+	for i := 0; i < len(c.defined); {
+		j := i
+		for j < len(c.defined) && c.defined[j] == c.defined[i] {
+			j++
+		}
+		levels = appendUvarint(levels, uint64(j-i)<<1)
+		if c.defined[i] {
+			levels = append(levels, 1)
+		} else {
+			levels = append(levels, 0)
+		}
+		i = j
+	}
+
+	page := make([]byte, 4, 4+len(levels)+c.values.Len()+len(c.bools)/8+1)
+	binary.LittleEndian.PutUint32(page, uint32(len(levels)))
+	page = append(page, levels...)
+	if c.Type == Bool {
+		packed := make([]byte, (len(c.bools)+7)/8)
+		for i, v := range c.bools {
+			if v {
+				packed[i/8] |= 1 << (i % 8)
+			}
+		}
+		return append(page, packed...)
+	}
+	return append(page, c.values.Bytes()...)
+}
+
+func (c *parquetColumn) reset() {
+	c.defined = c.defined[:0]
+	c.values.Reset()
+	c.bools = c.bools[:0]
+}
+
+// physicalType returns the Parquet type and converted type of the column,
+// the converted type being -1 when there is none.
+func (c *parquetColumn) physicalType() (int32, int32) {
+	switch c.Type {
+	case Int:
+		return parquetInt64, -1
+	case Float:
+		return parquetDouble, -1
+	case Bool:
+		return parquetBoolean, -1
+	case Time:
+		return parquetInt64, convertedTimestampMillis
+	}
+	return parquetByteArray, convertedUTF8
+}
+
+// writeRowGroup writes the buffered rows as a row group of one data page per
+// column.
+func (p *parquetWriter) writeRowGroup() error {
+	if p.rows == 0 {
+		return nil
+	}
+	group := rowGroupMeta{numRows: int64(p.rows)}
+	for _, c := range p.columns {
+		page := c.page()
+		t := &thriftWriter{}
+		t.i32(1, pageData)
+		t.i32(2, int32(len(page)))
+		t.i32(3, int32(len(page)))
+		t.beginStruct(5)
+		t.i32(1, int32(p.rows))
+		t.i32(2, encodingPlain)
+		t.i32(3, encodingRLE)
+		t.i32(4, encodingRLE)
+		t.endStruct()
+		t.stop()
+
+		offset := p.offset
+		if err := p.write(t.buf); err != nil {
+			return err
+		}
+		if err := p.write(page); err != nil {
+			return err
+		}
+		group.columns = append(group.columns, columnChunkMeta{
+			offset:    offset,
+			size:      p.offset - offset,
+			numValues: int64(p.rows),
+		})
+		c.reset()
+	}
+	p.rowGroups = append(p.rowGroups, group)
+	p.rows = 0
+	return nil
+}
+
+// Close writes the buffered rows and the file metadata.
+func (p *parquetWriter) Close() error {
+	if err := p.writeRowGroup(); err != nil {
+		return err
+	}
+
+	var numRows int64
+	for _, group := range p.rowGroups {
+		numRows += group.numRows
+	}
+
+	t := &thriftWriter{}
+	t.i32(1, 1)
+	t.listHeader(2, thriftStruct, len(p.columns)+1)
+	t.beginElem()
+	t.binary(4, "schema")
+	t.i32(5, int32(len(p.columns)))
+	t.endElem()
+	for _, c := range p.columns {
+		typ, converted := c.physicalType()
+		t.beginElem()
+		t.i32(1, typ)
+		t.i32(3, repetitionOptional)
+		t.binary(4, c.Name)
+		if converted >= 0 {
+			t.i32(6, converted)
+		}
+		t.endElem()
+	}
+	t.i64(3, numRows)
+	t.listHeader(4, thriftStruct, len(p.rowGroups))
+	for _, group := range p.rowGroups {
+		var size int64
+		t.beginElem()
+		t.listHeader(1, thriftStruct, len(group.columns))
+		for i, chunk := range group.columns {
+			typ, _ := p.columns[i].physicalType()
+			size += chunk.size
+			t.beginElem()
+			t.i64(2, chunk.offset)
+			t.beginStruct(3)
+			t.i32(1, typ)
+			t.listHeader(2, thriftI32, 2)
+			t.appendI32(encodingPlain)
+			t.appendI32(encodingRLE)
+			t.listHeader(3, thriftBinary, 1)
+			t.appendBinary(p.columns[i].Name)
+			t.i32(4, codecUncompressed)
+			t.i64(5, chunk.numValues)
+			t.i64(6, chunk.size)
+			t.i64(7, chunk.size)
+			t.i64(9, chunk.offset)
+			t.endStruct()
+			t.endElem()
+		}
+		t.i64(2, size)
+		t.i64(3, group.numRows)
+		t.endElem()
+	}
+	t.binary(6, "pdanalytics")
+	t.stop()
+
+	if err := p.write(t.buf); err != nil {
+		return err
+	}
+	var length [4]byte
+	binary.LittleEndian.PutUint32(length[:], uint32(len(t.buf)))
+	if err := p.write(length[:]); err != nil {
+		return err
+	}
+	return p.write(parquetMagic)
+}
+
+// The thrift compact protocol types.
+const (
+	thriftI32    = 5
+	thriftI64    = 6
+	thriftBinary = 8
+	thriftList   = 9
+	thriftStruct = 12
+)
+
+// thriftWriter encodes the Parquet metadata with the thrift compact
+// protocol.
+type thriftWriter struct {
+	buf []byte
+	// last is the id of the last field of the current struct, and
+	// parents those of the enclosing structs.
+	last    int16
+	parents []int16
+}
+
+func (t *thriftWriter) fieldHeader(id int16, typ byte) {
+	if delta := id - t.last; delta > 0 && delta <= 15 {
+		t.buf = append(t.buf, byte(delta)<<4|typ)
+	} else {
+		t.buf = append(t.buf, typ)
+		t.buf = appendZigzag(t.buf, int64(id))
+	}
+	t.last = id
+}
+
+func (t *thriftWriter) i32(id int16, v int32) {
+	t.fieldHeader(id, thriftI32)
+	t.appendI32(v)
+}
+
+func (t *thriftWriter) i64(id int16, v int64) {
+	t.fieldHeader(id, thriftI64)
+	t.buf = appendZigzag(t.buf, v)
+}
+
+func (t *thriftWriter) binary(id int16, s string) {
+	t.fieldHeader(id, thriftBinary)
+	t.appendBinary(s)
+}
+
+func (t *thriftWriter) appendI32(v int32) {
+	t.buf = appendZigzag(t.buf, int64(v))
+}
+
+func (t *thriftWriter) appendBinary(s string) {
+	t.buf = appendUvarint(t.buf, uint64(len(s)))
+	t.buf = append(t.buf, s...)
+}
+
+func (t *thriftWriter) listHeader(id int16, elemType byte, size int) {
+	t.fieldHeader(id, thriftList)
+	if size < 15 {
+		t.buf = append(t.buf, byte(size)<<4|elemType)
+		return
+	}
+	t.buf = append(t.buf, 0xf0|elemType)
+	t.buf = appendUvarint(t.buf, uint64(size))
+}
+
+// beginStruct starts a struct field, beginElem a struct element of a list.
+func (t *thriftWriter) beginStruct(id int16) {
+	t.fieldHeader(id, thriftStruct)
+	t.beginElem()
+}
+
+func (t *thriftWriter) beginElem() {
+	t.parents = append(t.parents, t.last)
+	t.last = 0
+}
+
+func (t *thriftWriter) endStruct() { t.endElem() }
+
+func (t *thriftWriter) endElem() {
+	t.stop()
+	t.last = t.parents[len(t.parents)-1]
+	t.parents = t.parents[:len(t.parents)-1]
+}
+
+// stop ends the current struct.
+func (t *thriftWriter) stop() {
+	t.buf = append(t.buf, 0)
+}
+
+func appendUvarint(b []byte, v uint64) []byte {
+	var buf [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(buf[:], v)
+	return append(b, buf[:n]...)
+}
+
+func appendZigzag(b []byte, v int64) []byte {
+	return appendUvarint(b, uint64((v<<1)^(v>>63)))
+}
@@ -0,0 +1,351 @@
+package agendas
+
+import (
+	"errors"
+	"sort"
+	"sync"
+
+	"github.com/asdine/storm/v3"
+	chainjson "github.com/decred/dcrd/rpc/jsonrpc/types/v2"
+	"github.com/decred/dcrd/wire"
+	"github.com/planetdecred/pdanalytics/dcrd"
+	"github.com/planetdecred/pdanalytics/module"
+	"github.com/planetdecred/pdanalytics/web"
+)
+
+type agendas struct {
+	client *dcrd.Dcrd
+	server *web.Server
+	db     *AgendaDB
+
+	// mtx serializes the updates from the block and reorg handlers and
+	// guards the fields below it.
+	mtx         sync.Mutex
+	height      int64
+	doneVersion map[uint32]bool
+
+	// tracker records the outcome of the updates.
+	tracker *module.HealthTracker
+
+	// liveMtx guards the live tally of the votes seen in the mempool.
+	liveMtx    sync.RWMutex
+	liveHeight int64
+	liveVotes  map[string]struct{}
+	live       map[string]*LiveTally
+	voting     map[string]bool
+}
+
+// activate activates the agendas module. The agendas are updated from
+// getvoteinfo on every block when dataMode is set, and the pages and chart
+// endpoints are served when httpMode is set.
+func activate(client *dcrd.Dcrd, db *AgendaDB, webServer *web.Server,
+	dataMode, httpMode bool) (*agendas, error) {
+
+	ag := &agendas{
+		client:      client,
+		server:      webServer,
+		db:          db,
+		doneVersion: make(map[uint32]bool),
+		tracker:     module.NewHealthTracker(0),
+		liveVotes:   make(map[string]struct{}),
+		live:        make(map[string]*LiveTally),
+		voting:      make(map[string]bool),
+	}
+
+	if dataMode {
+		hash, err := client.Rpc().GetBestBlockHash()
+		if err != nil {
+			return nil, err
+		}
+		header, err := client.Rpc().GetBlockHeader(hash)
+		if err != nil {
+			return nil, err
+		}
+		// A failed update is retried on the next block.
+		if err = ag.connectBlock(header); err != nil {
+			log.Errorf("Unable to update the agendas: %v", err)
+		}
+
+		client.Notif.RegisterBlockHandlerGroup(ag.connectBlock)
+		client.Notif.RegisterReorgHandlerGroup(ag.reorg)
+		client.Notif.RegisterTxHandlerGroup(ag.txHandler)
+	}
+
+	if httpMode {
+		for _, name := range []string{"agendas", "agenda"} {
+			if err := ag.server.Templates.AddTemplate(name); err != nil {
+				return nil, err
+			}
+		}
+
+		ag.server.AddRoute("/agendas", web.GET, ag.AgendasPage)
+		ag.server.AddRoute("/agenda/{agendaid}", web.GET, ag.AgendaPage, agendaIDCtx)
+		ag.server.AddRoute("/api/agenda/{agendaid}", web.GET, ag.getAgendaChartData, agendaIDCtx)
+		ag.server.AddRoute("/api/agenda/{agendaid}/live", web.GET, ag.getLiveTally, agendaIDCtx)
+
+		ag.server.AddMenuItem(web.MenuItem{
+			Href:      "/agendas",
+			HyperText: "Agendas",
+			Info:      "Consensus Deployment Agendas",
+			Attributes: map[string]string{
+				"class": "menu-item",
+				"title": "Agendas",
+			},
+		})
+	}
+
+	return ag, nil
+}
+
+func (ag *agendas) connectBlock(header *wire.BlockHeader) error {
+	ag.mtx.Lock()
+	defer ag.mtx.Unlock()
+
+	err := ag.update(header.Timestamp.Unix())
+	ag.tracker.Done(err)
+	if err == nil {
+		ag.height = int64(header.Height)
+	}
+	return err
+}
+
+func (ag *agendas) reorg(reorg *dcrd.ReorgData) error {
+	ag.mtx.Lock()
+	defer ag.mtx.Unlock()
+
+	ancestor := int64(reorg.CommonAncestorHeight)
+	if err := ag.db.Rewind(ancestor); err != nil {
+		return err
+	}
+	ag.height = ancestor
+	// The versions done with are checked again as a status transition may
+	// have been rolled back.
+	ag.doneVersion = make(map[uint32]bool)
+
+	ag.liveMtx.Lock()
+	ag.resetLive(0)
+	ag.liveMtx.Unlock()
+	return nil
+}
+
+// update records the vote info of the deployment versions that still have
+// agendas with a non final status.
+func (ag *agendas) update(blockTime int64) error {
+	versions := make([]uint32, 0, len(ag.client.Params.Deployments))
+	for version := range ag.client.Params.Deployments {
+		if !ag.doneVersion[version] {
+			versions = append(versions, version)
+		}
+	}
+	sort.Slice(versions, func(i, j int) bool { return versions[i] < versions[j] })
+
+	voting := make(map[string]bool)
+	for _, version := range versions {
+		info, err := ag.client.Rpc().GetVoteInfo(version)
+		if err != nil {
+			return err
+		}
+
+		done := len(info.Agendas) > 0
+		for i := range info.Agendas {
+			agenda := &info.Agendas[i]
+			status := AgendaStatusFromStr(agenda.Status)
+			if err = ag.updateAgenda(info, agenda, status, blockTime); err != nil {
+				return err
+			}
+			done = done && status.IsFinal()
+			if status == StatusStarted {
+				voting[agenda.ID] = true
+			}
+		}
+		if done {
+			log.Debugf("All agendas of vote version %d are final", version)
+			ag.doneVersion[version] = true
+		}
+	}
+
+	ag.liveMtx.Lock()
+	ag.voting = voting
+	ag.liveMtx.Unlock()
+	return nil
+}
+
+func (ag *agendas) updateAgenda(info *chainjson.GetVoteInfoResult, agenda *chainjson.Agenda,
+	status AgendaStatusType, blockTime int64) error {
+
+	stored, err := ag.db.AgendaInfo(agenda.ID)
+	if err != nil && !errors.Is(err, storm.ErrNotFound) {
+		return err
+	}
+	if stored == nil {
+		// The status of an agenda seen for the first time is not a
+		// transition.
+		stored = &AgendaInfo{ID: agenda.ID, Status: status}
+	}
+
+	if stored.Status != status {
+		log.Infof("Agenda %s status changed from %s to %s at height %d", agenda.ID,
+			stored.Status, status, info.StartHeight)
+		err = ag.db.SaveTransition(&StatusTransition{
+			AgendaID: agenda.ID,
+			From:     stored.Status,
+			To:       status,
+			Height:   info.StartHeight,
+			Time:     blockTime,
+		})
+		if err != nil {
+			return err
+		}
+		switch status {
+		case StatusStarted:
+			stored.VotingStarted = info.StartHeight
+		case StatusLockedIn:
+			stored.LockedIn = info.StartHeight
+		}
+	}
+
+	stored.Description = agenda.Description
+	stored.Mask = agenda.Mask
+	stored.VoteVersion = info.VoteVersion
+	stored.StartTime = agenda.StartTime
+	stored.ExpireTime = agenda.ExpireTime
+	stored.Status = status
+	stored.QuorumProgress = agenda.QuorumProgress
+	stored.Height = info.CurrentHeight
+	stored.EndHeight = info.EndHeight
+	stored.Choices = make([]Choice, 0, len(agenda.Choices))
+	for _, c := range agenda.Choices {
+		stored.Choices = append(stored.Choices, Choice{
+			ID:          c.ID,
+			Description: c.Description,
+			Bits:        c.Bits,
+			IsAbstain:   c.IsAbstain,
+			IsNo:        c.IsNo,
+			Count:       c.Count,
+			Progress:    c.Progress,
+		})
+	}
+	if err = ag.db.SaveAgenda(stored); err != nil {
+		return err
+	}
+
+	// Votes are only tallied while the agenda is being voted on.
+	if status != StatusStarted {
+		return nil
+	}
+	return ag.updateTallies(info, agenda, blockTime)
+}
+
+// updateTallies records the cumulative tally of the current rule change
+// interval and the votes included since the last update.
+func (ag *agendas) updateTallies(info *chainjson.GetVoteInfoResult, agenda *chainjson.Agenda,
+	blockTime int64) error {
+
+	prev, err := ag.db.IntervalTally(agenda.ID, info.StartHeight)
+	if err != nil {
+		return err
+	}
+	if prev != nil && prev.Height >= info.CurrentHeight {
+		return nil
+	}
+
+	interval := &IntervalTally{
+		ID:          intervalTallyID(agenda.ID, info.StartHeight),
+		AgendaID:    agenda.ID,
+		StartHeight: info.StartHeight,
+		EndHeight:   info.EndHeight,
+		Height:      info.CurrentHeight,
+	}
+	interval.Yes, interval.No, interval.Abstain = choiceCounts(agenda.Choices)
+
+	block := &BlockTally{
+		ID:          blockTallyID(agenda.ID, info.CurrentHeight),
+		AgendaID:    agenda.ID,
+		Height:      info.CurrentHeight,
+		Time:        blockTime,
+		StartHeight: info.StartHeight,
+		Yes:         interval.Yes,
+		No:          interval.No,
+		Abstain:     interval.Abstain,
+	}
+	if prev != nil {
+		if interval.Yes < prev.Yes || interval.No < prev.No || interval.Abstain < prev.Abstain {
+			log.Warnf("Agenda %s tally at height %d is lower than at height %d", agenda.ID,
+				interval.Height, prev.Height)
+		} else {
+			block.Yes -= prev.Yes
+			block.No -= prev.No
+			block.Abstain -= prev.Abstain
+		}
+	}
+
+	return ag.db.SaveTallies(interval, block)
+}
+
+// txHandler counts the vote choices of the votes entering the mempool on the
+// agendas being voted on. The tally is reset when votes on a new block arrive.
+func (ag *agendas) txHandler(tx *chainjson.TxRawResult) error {
+	msgTx, err := dcrd.MsgTxFromHex(tx.Hex)
+	if err != nil {
+		return err
+	}
+	if dcrd.DetermineTxTypeString(msgTx) != "Vote" {
+		return nil
+	}
+	validation, _, _, choices, err := dcrd.SSGenVoteChoices(msgTx, ag.client.Params)
+	if err != nil {
+		return err
+	}
+
+	ag.liveMtx.Lock()
+	defer ag.liveMtx.Unlock()
+
+	switch {
+	case validation.Height < ag.liveHeight:
+		return nil
+	case validation.Height > ag.liveHeight:
+		ag.resetLive(validation.Height)
+	}
+	if _, found := ag.liveVotes[tx.Txid]; found {
+		return nil
+	}
+	ag.liveVotes[tx.Txid] = struct{}{}
+
+	for _, choice := range choices {
+		if !ag.voting[choice.ID] {
+			continue
+		}
+		tally, found := ag.live[choice.ID]
+		if !found {
+			tally = &LiveTally{AgendaID: choice.ID, Height: ag.liveHeight}
+			ag.live[choice.ID] = tally
+		}
+		switch {
+		case choice.Choice.IsAbstain:
+			tally.Abstain++
+		case choice.Choice.IsNo:
+			tally.No++
+		default:
+			tally.Yes++
+		}
+	}
+	return nil
+}
+
+// resetLive clears the live tally for the votes on the block at height. The
+// caller must hold liveMtx.
+func (ag *agendas) resetLive(height int64) {
+	ag.liveHeight = height
+	ag.liveVotes = make(map[string]struct{})
+	ag.live = make(map[string]*LiveTally)
+}
+
+// liveTally returns a copy of the live tally of an agenda.
+func (ag *agendas) liveTally(agendaID string) LiveTally {
+	ag.liveMtx.RLock()
+	defer ag.liveMtx.RUnlock()
+	if tally, found := ag.live[agendaID]; found {
+		return *tally
+	}
+	return LiveTally{AgendaID: agendaID, Height: ag.liveHeight}
+}
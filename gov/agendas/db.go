@@ -0,0 +1,246 @@
+package agendas
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/asdine/storm/v3"
+	"github.com/asdine/storm/v3/q"
+)
+
+// errDef defines the default error returned if the agendas db was not
+// initialized correctly.
+var errDef = fmt.Errorf("AgendaDB was not initialized correctly")
+
+// AgendaDB stores the agendas, their vote tallies and status transitions in a
+// storm DB.
+type AgendaDB struct {
+	sdb *storm.DB
+}
+
+// NewAgendasDB opens an existing database or creates a new storm DB instance
+// with the provided path.
+func NewAgendasDB(dbPath string) (*AgendaDB, error) {
+	if dbPath == "" {
+		return nil, errors.New("missing db path")
+	}
+
+	_, err := os.Stat(dbPath)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	db, err := storm.Open(dbPath)
+	if err != nil {
+		return nil, err
+	}
+	log.Infof("Opened agendas DB: %s", dbPath)
+
+	return &AgendaDB{sdb: db}, nil
+}
+
+// Close closes the agendas DB instance.
+func (db *AgendaDB) Close() error {
+	if db == nil || db.sdb == nil {
+		return nil
+	}
+	return db.sdb.Close()
+}
+
+// AgendaInfo returns the agenda with the given ID.
+func (db *AgendaDB) AgendaInfo(agendaID string) (*AgendaInfo, error) {
+	if db == nil || db.sdb == nil {
+		return nil, errDef
+	}
+	agenda := new(AgendaInfo)
+	if err := db.sdb.One("ID", agendaID, agenda); err != nil {
+		return nil, err
+	}
+	return agenda, nil
+}
+
+// AllAgendas returns all the agendas, the most recent vote version first.
+func (db *AgendaDB) AllAgendas() ([]*AgendaInfo, error) {
+	if db == nil || db.sdb == nil {
+		return nil, errDef
+	}
+	var agendas []*AgendaInfo
+	err := db.sdb.Select().OrderBy("VoteVersion", "ID").Reverse().Find(&agendas)
+	if err != nil && !errors.Is(err, storm.ErrNotFound) {
+		return nil, err
+	}
+	return agendas, nil
+}
+
+// SaveAgenda inserts or updates an agenda.
+func (db *AgendaDB) SaveAgenda(agenda *AgendaInfo) error {
+	if db == nil || db.sdb == nil {
+		return errDef
+	}
+	return db.sdb.Save(agenda)
+}
+
+// IntervalTally returns the tally of an agenda in the rule change interval
+// starting at startHeight. A nil tally is returned if there is none.
+func (db *AgendaDB) IntervalTally(agendaID string, startHeight int64) (*IntervalTally, error) {
+	if db == nil || db.sdb == nil {
+		return nil, errDef
+	}
+	tally := new(IntervalTally)
+	err := db.sdb.One("ID", intervalTallyID(agendaID, startHeight), tally)
+	if errors.Is(err, storm.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return tally, nil
+}
+
+// IntervalTallies returns the tallies of an agenda ordered by height.
+func (db *AgendaDB) IntervalTallies(agendaID string) ([]*IntervalTally, error) {
+	if db == nil || db.sdb == nil {
+		return nil, errDef
+	}
+	var tallies []*IntervalTally
+	err := db.sdb.Select(q.Eq("AgendaID", agendaID)).OrderBy("StartHeight").Find(&tallies)
+	if err != nil && !errors.Is(err, storm.ErrNotFound) {
+		return nil, err
+	}
+	return tallies, nil
+}
+
+// SaveTallies saves the tally of an agenda in a rule change interval along
+// with the votes of the block it was updated at.
+func (db *AgendaDB) SaveTallies(interval *IntervalTally, block *BlockTally) error {
+	if db == nil || db.sdb == nil {
+		return errDef
+	}
+	tx, err := db.sdb.Begin(true)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err = tx.Save(interval); err != nil {
+		return err
+	}
+	if block != nil {
+		if err = tx.Save(block); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// BlockTallies returns the per block votes of an agenda ordered by height.
+func (db *AgendaDB) BlockTallies(agendaID string) ([]*BlockTally, error) {
+	if db == nil || db.sdb == nil {
+		return nil, errDef
+	}
+	var tallies []*BlockTally
+	err := db.sdb.Select(q.Eq("AgendaID", agendaID)).OrderBy("Height").Find(&tallies)
+	if err != nil && !errors.Is(err, storm.ErrNotFound) {
+		return nil, err
+	}
+	return tallies, nil
+}
+
+// SaveTransition records a status transition.
+func (db *AgendaDB) SaveTransition(transition *StatusTransition) error {
+	if db == nil || db.sdb == nil {
+		return errDef
+	}
+	transition.ID = transitionID(transition.AgendaID, transition.Height, transition.To)
+	return db.sdb.Save(transition)
+}
+
+// Transitions returns the status transitions of an agenda ordered by height.
+func (db *AgendaDB) Transitions(agendaID string) ([]*StatusTransition, error) {
+	if db == nil || db.sdb == nil {
+		return nil, errDef
+	}
+	var transitions []*StatusTransition
+	err := db.sdb.Select(q.Eq("AgendaID", agendaID)).OrderBy("Height").Find(&transitions)
+	if err != nil && !errors.Is(err, storm.ErrNotFound) {
+		return nil, err
+	}
+	return transitions, nil
+}
+
+// Rewind removes the block tallies and status transitions above height after
+// a reorg. The interval tallies are recomputed from the remaining block
+// tallies, and the status of the agendas restored to the status before the
+// removed transitions.
+func (db *AgendaDB) Rewind(height int64) error {
+	if db == nil || db.sdb == nil {
+		return errDef
+	}
+	tx, err := db.sdb.Begin(true)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var transitions []*StatusTransition
+	err = tx.Select(q.Gt("Height", height)).OrderBy("Height").Reverse().Find(&transitions)
+	if err != nil && !errors.Is(err, storm.ErrNotFound) {
+		return err
+	}
+	for _, t := range transitions {
+		agenda := new(AgendaInfo)
+		if err = tx.One("ID", t.AgendaID, agenda); err != nil {
+			return err
+		}
+		agenda.Status = t.From
+		switch t.To {
+		case StatusStarted:
+			agenda.VotingStarted = 0
+		case StatusLockedIn:
+			agenda.LockedIn = 0
+		}
+		if err = tx.Save(agenda); err != nil {
+			return err
+		}
+		if err = tx.DeleteStruct(t); err != nil {
+			return err
+		}
+	}
+
+	err = tx.Select(q.Gt("Height", height)).Delete(new(BlockTally))
+	if err != nil && !errors.Is(err, storm.ErrNotFound) {
+		return err
+	}
+
+	var intervals []*IntervalTally
+	err = tx.Select(q.Gt("Height", height)).Find(&intervals)
+	if err != nil && !errors.Is(err, storm.ErrNotFound) {
+		return err
+	}
+	for _, interval := range intervals {
+		if interval.StartHeight > height {
+			if err = tx.DeleteStruct(interval); err != nil {
+				return err
+			}
+			continue
+		}
+		var blocks []*BlockTally
+		err = tx.Select(q.Eq("AgendaID", interval.AgendaID),
+			q.Eq("StartHeight", interval.StartHeight)).Find(&blocks)
+		if err != nil && !errors.Is(err, storm.ErrNotFound) {
+			return err
+		}
+		interval.Height = height
+		interval.Yes, interval.No, interval.Abstain = 0, 0, 0
+		for _, b := range blocks {
+			interval.Yes += b.Yes
+			interval.No += b.No
+			interval.Abstain += b.Abstain
+		}
+		if err = tx.Save(interval); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,221 @@
+package agendas
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/asdine/storm/v3"
+	"github.com/go-chi/chi"
+	"github.com/planetdecred/pdanalytics/app/helpers"
+	"github.com/planetdecred/pdanalytics/dbhelper"
+	"github.com/planetdecred/pdanalytics/web"
+)
+
+// AgendasPage is the page handler for the "/agendas" path.
+func (ag *agendas) AgendasPage(w http.ResponseWriter, r *http.Request) {
+	agendaList, err := ag.db.AllAgendas()
+	if err != nil {
+		log.Errorf("Cannot fetch agendas: %v", err)
+		ag.server.StatusPage(w, r, web.DefaultErrorCode, web.DefaultErrorMessage, "", web.ExpStatusError)
+		return
+	}
+
+	str, err := ag.server.Templates.ExecTemplateToString("agendas", struct {
+		*web.CommonPageData
+		Agendas         []*AgendaInfo
+		VotingSummary   interface{}
+		BreadcrumbItems []web.BreadcrumbItem
+	}{
+		CommonPageData: ag.server.CommonData(r),
+		Agendas:        agendaList,
+		BreadcrumbItems: []web.BreadcrumbItem{
+			{
+				HyperText: "Agendas",
+				Active:    true,
+			},
+		},
+	})
+
+	if err != nil {
+		log.Errorf("Template execute failure: %v", err)
+		ag.server.StatusPage(w, r, web.DefaultErrorCode, web.DefaultErrorMessage, "", web.ExpStatusError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html")
+	w.WriteHeader(http.StatusOK)
+	io.WriteString(w, str)
+}
+
+// AgendaPage is the page handler for the "/agenda/{agendaid}" path.
+func (ag *agendas) AgendaPage(w http.ResponseWriter, r *http.Request) {
+	agendaID := getAgendaIDCtx(r)
+	agendaInfo, err := ag.db.AgendaInfo(agendaID)
+	if err != nil {
+		log.Errorf("Cannot fetch agenda %s: %v", agendaID, err)
+		ag.server.StatusPage(w, r, web.DefaultErrorCode, "the agenda ID given seems to not exist",
+			"", web.ExpStatusNotFound)
+		return
+	}
+
+	summary, err := ag.agendaSummary(agendaInfo)
+	if err != nil {
+		log.Errorf("Cannot fetch the vote summary of agenda %s: %v", agendaID, err)
+		ag.server.StatusPage(w, r, web.DefaultErrorCode, web.DefaultErrorMessage, "", web.ExpStatusError)
+		return
+	}
+
+	ag.mtx.Lock()
+	tip := ag.height
+	ag.mtx.Unlock()
+
+	var blocksLeft int64
+	var timeRemaining string
+	if agendaInfo.Status == StatusStarted && agendaInfo.EndHeight > tip {
+		blocksLeft = agendaInfo.EndHeight - tip
+		timeRemaining = helpers.DurationToString(
+			time.Duration(blocksLeft) * ag.client.Params.TargetTimePerBlock)
+	}
+
+	quorum := ag.client.Params.RuleChangeActivationQuorum
+	str, err := ag.server.Templates.ExecTemplateToString("agenda", struct {
+		*web.CommonPageData
+		*dbhelper.AgendaSummary
+		Ai              *AgendaInfo
+		BlocksLeft      int64
+		TimeRemaining   string
+		TotalVotes      uint32
+		QuorumVotes     uint32
+		RuleChangeI     uint32
+		BreadcrumbItems []web.BreadcrumbItem
+	}{
+		CommonPageData: ag.server.CommonData(r),
+		AgendaSummary:  summary,
+		Ai:             agendaInfo,
+		BlocksLeft:     blocksLeft,
+		TimeRemaining:  timeRemaining,
+		TotalVotes:     summary.Yes + summary.No + summary.Abstain,
+		QuorumVotes:    uint32(agendaInfo.QuorumProgress * float64(quorum)),
+		RuleChangeI:    quorum,
+		BreadcrumbItems: []web.BreadcrumbItem{
+			{
+				HyperText: "Agendas",
+				Href:      "/agendas",
+			},
+			{
+				HyperText: agendaInfo.ID,
+				Active:    true,
+			},
+		},
+	})
+
+	if err != nil {
+		log.Errorf("Template execute failure: %v", err)
+		ag.server.StatusPage(w, r, web.DefaultErrorCode, web.DefaultErrorMessage, "", web.ExpStatusError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html")
+	w.WriteHeader(http.StatusOK)
+	io.WriteString(w, str)
+}
+
+// agendaSummary returns the tally of the last rule change interval the agenda
+// was voted on along with its voting start and lock in heights.
+func (ag *agendas) agendaSummary(agenda *AgendaInfo) (*dbhelper.AgendaSummary, error) {
+	summary := &dbhelper.AgendaSummary{
+		VotingStarted: agenda.VotingStarted,
+		LockedIn:      agenda.LockedIn,
+	}
+	tallies, err := ag.db.IntervalTallies(agenda.ID)
+	if err != nil {
+		return nil, err
+	}
+	if len(tallies) > 0 {
+		last := tallies[len(tallies)-1]
+		summary.Yes, summary.No, summary.Abstain = last.Yes, last.No, last.Abstain
+	}
+	return summary, nil
+}
+
+func (ag *agendas) getAgendaChartData(w http.ResponseWriter, r *http.Request) {
+	agendaID := getAgendaIDCtx(r)
+	if _, err := ag.db.AgendaInfo(agendaID); err != nil {
+		if errors.Is(err, storm.ErrNotFound) {
+			http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+			return
+		}
+		log.Errorf("Unable to get agenda %s: %v", agendaID, err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	tallies, err := ag.db.BlockTallies(agendaID)
+	if err != nil {
+		log.Errorf("Unable to get agenda %s chart data: %v", agendaID, err)
+		http.Error(w, http.StatusText(http.StatusUnprocessableEntity),
+			http.StatusUnprocessableEntity)
+		return
+	}
+
+	web.RenderJSON(w, agendaChartData(tallies))
+}
+
+func (ag *agendas) getLiveTally(w http.ResponseWriter, r *http.Request) {
+	web.RenderJSON(w, ag.liveTally(getAgendaIDCtx(r)))
+}
+
+// agendaChartData builds the vote choices chart data by block and by day from
+// the per block tallies ordered by height.
+func agendaChartData(tallies []*BlockTally) *AgendaChartData {
+	byHeight := new(AgendaVoteChoices)
+	byTime := new(AgendaVoteChoices)
+	for _, t := range tallies {
+		byHeight.Height = append(byHeight.Height, t.Height)
+		byHeight.Yes = append(byHeight.Yes, t.Yes)
+		byHeight.No = append(byHeight.No, t.No)
+		byHeight.Abstain = append(byHeight.Abstain, t.Abstain)
+		byHeight.Total = append(byHeight.Total, t.Yes+t.No+t.Abstain)
+
+		day := t.Time - t.Time%86400
+		last := len(byTime.Time) - 1
+		if last < 0 || byTime.Time[last] != day {
+			byTime.Time = append(byTime.Time, day)
+			byTime.Yes = append(byTime.Yes, 0)
+			byTime.No = append(byTime.No, 0)
+			byTime.Abstain = append(byTime.Abstain, 0)
+			byTime.Total = append(byTime.Total, 0)
+			last++
+		}
+		byTime.Yes[last] += t.Yes
+		byTime.No[last] += t.No
+		byTime.Abstain[last] += t.Abstain
+		byTime.Total[last] += t.Yes + t.No + t.Abstain
+	}
+	return &AgendaChartData{
+		ByHeight: byHeight,
+		ByTime:   byTime,
+	}
+}
+
+// agendaIDCtx embeds the value at the url part {agendaid} into the request
+// context.
+func agendaIDCtx(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		agendaID := chi.URLParam(r, "agendaid")
+		ctx := context.WithValue(r.Context(), web.CtxAgendaId, agendaID)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// getAgendaIDCtx retrieves the agenda ID from the request context. If the value
+// is not set, an empty string is returned.
+func getAgendaIDCtx(r *http.Request) string {
+	agendaID, ok := r.Context().Value(web.CtxAgendaId).(string)
+	if !ok {
+		log.Trace("Agendaid not set")
+		return ""
+	}
+	return agendaID
+}
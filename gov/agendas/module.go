@@ -0,0 +1,88 @@
+package agendas
+
+import (
+	"context"
+	"path/filepath"
+
+	"github.com/decred/slog"
+	"github.com/planetdecred/pdanalytics/app/helpers"
+	"github.com/planetdecred/pdanalytics/dcrd"
+	"github.com/planetdecred/pdanalytics/module"
+	"github.com/planetdecred/pdanalytics/web"
+)
+
+const defaultAgendasDBFileName = "agendas.db"
+
+// AgendasOptions are the config options of the agendas module.
+type AgendasOptions struct {
+	EnableAgendas     bool   `long:"agendas" description:"Enable/Disable the agendas module from running"`
+	EnableAgendasHttp bool   `long:"agendashttp" description:"Enable/Disable the agendas http module from running"`
+	AgendasDBFileName string `long:"agendadbfile" description:"Agendas DB file name, relative to the data directory (default is agendas.db)." env:"DCRDATA_AGENDAS_DB_FILE_NAME"`
+}
+
+type agendasModule struct {
+	options AgendasOptions
+	client  *dcrd.Dcrd
+	server  *web.Server
+	db      *AgendaDB
+	ag      *agendas
+}
+
+func init() {
+	module.Register(&agendasModule{
+		options: AgendasOptions{
+			EnableAgendas:     true,
+			EnableAgendasHttp: true,
+			AgendasDBFileName: defaultAgendasDBFileName,
+		},
+	})
+}
+
+func (m *agendasModule) Name() string                 { return "agendas" }
+func (m *agendasModule) LogSubsystem() string         { return "AGND" }
+func (m *agendasModule) UseLogger(logger slog.Logger) { UseLogger(logger) }
+func (m *agendasModule) Options() interface{}         { return &m.options }
+
+func (m *agendasModule) Enabled() bool {
+	return m.options.EnableAgendas || m.options.EnableAgendasHttp
+}
+
+func (m *agendasModule) Init(deps *module.Deps) error {
+	dbPath := helpers.CleanAndExpandPath(m.options.AgendasDBFileName)
+	if !filepath.IsAbs(dbPath) {
+		dbPath = filepath.Join(deps.DataDir, dbPath)
+	}
+	m.options.AgendasDBFileName = dbPath
+	m.client = deps.Dcrd
+	m.server = deps.Server
+	return nil
+}
+
+func (m *agendasModule) Start(ctx context.Context) error {
+	db, err := NewAgendasDB(m.options.AgendasDBFileName)
+	if err != nil {
+		return err
+	}
+	ag, err := activate(m.client, db, m.server, m.options.EnableAgendas, m.options.EnableAgendasHttp)
+	if err != nil {
+		db.Close()
+		return err
+	}
+	m.db = db
+	m.ag = ag
+	return nil
+}
+
+// Stop closes the agendas DB.
+func (m *agendasModule) Stop() error {
+	return m.db.Close()
+}
+
+// Health reports the outcome of the last agendas update. The module is always
+// healthy when it only serves the pages.
+func (m *agendasModule) Health() module.Health {
+	if !m.options.EnableAgendas {
+		return module.Healthy
+	}
+	return m.ag.tracker.Health()
+}
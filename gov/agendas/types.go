@@ -0,0 +1,186 @@
+package agendas
+
+import (
+	"fmt"
+
+	chainjson "github.com/decred/dcrd/rpc/jsonrpc/types/v2"
+)
+
+// AgendaStatusType is the status of a consensus deployment agenda as reported
+// by dcrd's getvoteinfo.
+type AgendaStatusType int8
+
+const (
+	// StatusUnknown is the status of an agenda that dcrd has not reported.
+	StatusUnknown AgendaStatusType = iota
+	// StatusDefined is the status of an agenda whose start time has not been
+	// reached.
+	StatusDefined
+	// StatusStarted is the status of an agenda being voted on.
+	StatusStarted
+	// StatusLockedIn is the status of an agenda that passed and activates at
+	// the end of the current rule change interval.
+	StatusLockedIn
+	// StatusActive is the status of an agenda that passed and is enforced.
+	StatusActive
+	// StatusFailed is the status of an agenda that was rejected or expired.
+	StatusFailed
+)
+
+var agendaStatusStrings = map[AgendaStatusType]string{
+	StatusDefined:  "defined",
+	StatusStarted:  "started",
+	StatusLockedIn: "lockedin",
+	StatusActive:   "active",
+	StatusFailed:   "failed",
+}
+
+func (s AgendaStatusType) String() string {
+	if str, ok := agendaStatusStrings[s]; ok {
+		return str
+	}
+	return "unknown"
+}
+
+// IsFinal checks if no further status transition can occur.
+func (s AgendaStatusType) IsFinal() bool {
+	return s == StatusActive || s == StatusFailed
+}
+
+// AgendaStatusFromStr converts a getvoteinfo status string to an
+// AgendaStatusType.
+func AgendaStatusFromStr(status string) AgendaStatusType {
+	for s, str := range agendaStatusStrings {
+		if str == status {
+			return s
+		}
+	}
+	return StatusUnknown
+}
+
+// Choice is one of the choices of an agenda with the number of votes it got in
+// the current rule change interval.
+type Choice struct {
+	ID          string  `json:"id"`
+	Description string  `json:"description"`
+	Bits        uint16  `json:"bits"`
+	IsAbstain   bool    `json:"isabstain"`
+	IsNo        bool    `json:"isno"`
+	Count       uint32  `json:"count"`
+	Progress    float64 `json:"progress"`
+}
+
+// AgendaInfo is the last known state of an agenda. VotingStarted and LockedIn
+// are the first blocks of the rule change intervals in which the agenda
+// started and locked in. They are zero when the transition happened before the
+// agenda was tracked. Height and EndHeight are the block the agenda was last
+// updated at and the last block of its rule change interval.
+type AgendaInfo struct {
+	ID             string           `json:"id" storm:"id"`
+	Description    string           `json:"description"`
+	Mask           uint16           `json:"mask"`
+	VoteVersion    uint32           `json:"voteversion" storm:"index"`
+	StartTime      uint64           `json:"starttime"`
+	ExpireTime     uint64           `json:"expiretime"`
+	Status         AgendaStatusType `json:"status"`
+	QuorumProgress float64          `json:"quorumprogress"`
+	Choices        []Choice         `json:"choices"`
+	VotingStarted  int64            `json:"votingstarted"`
+	LockedIn       int64            `json:"lockedin"`
+	Height         int64            `json:"height"`
+	EndHeight      int64            `json:"endheight"`
+}
+
+// StatusTransition records the change of the status of an agenda. Height is
+// the first block of the rule change interval with the new status.
+type StatusTransition struct {
+	ID       string           `json:"-" storm:"id"`
+	AgendaID string           `json:"agenda_id" storm:"index"`
+	From     AgendaStatusType `json:"from"`
+	To       AgendaStatusType `json:"to"`
+	Height   int64            `json:"height" storm:"index"`
+	Time     int64            `json:"time"`
+}
+
+// IntervalTally is the vote tally of an agenda in a rule change interval, up
+// to and including the block at Height.
+type IntervalTally struct {
+	ID          string `json:"-" storm:"id"`
+	AgendaID    string `json:"agenda_id" storm:"index"`
+	StartHeight int64  `json:"start_height"`
+	EndHeight   int64  `json:"end_height"`
+	Height      int64  `json:"height"`
+	Yes         uint32 `json:"yes"`
+	No          uint32 `json:"no"`
+	Abstain     uint32 `json:"abstain"`
+}
+
+// BlockTally is the number of votes on an agenda included in a block. When
+// blocks are missed, e.g. while dcrd was unreachable, their votes are counted
+// in the next block processed.
+type BlockTally struct {
+	ID          string `json:"-" storm:"id"`
+	AgendaID    string `json:"agenda_id" storm:"index"`
+	Height      int64  `json:"height" storm:"index"`
+	Time        int64  `json:"time"`
+	StartHeight int64  `json:"start_height"`
+	Yes         uint32 `json:"yes"`
+	No          uint32 `json:"no"`
+	Abstain     uint32 `json:"abstain"`
+}
+
+// LiveTally counts the vote choices of the votes on the block at Height seen
+// in the mempool, before they are included in a block.
+type LiveTally struct {
+	AgendaID string `json:"agenda_id"`
+	Height   int64  `json:"height"`
+	Yes      uint32 `json:"yes"`
+	No       uint32 `json:"no"`
+	Abstain  uint32 `json:"abstain"`
+}
+
+// AgendaVoteChoices is the chart data of the votes on an agenda. Height is set
+// for the data by block and Time, the start of the day in seconds, for the data
+// by day.
+type AgendaVoteChoices struct {
+	Height  []int64  `json:"height,omitempty"`
+	Time    []int64  `json:"time,omitempty"`
+	Yes     []uint32 `json:"yes"`
+	No      []uint32 `json:"no"`
+	Abstain []uint32 `json:"abstain"`
+	Total   []uint32 `json:"total"`
+}
+
+// AgendaChartData is the response of the agenda chart endpoint.
+type AgendaChartData struct {
+	ByHeight *AgendaVoteChoices `json:"by_height"`
+	ByTime   *AgendaVoteChoices `json:"by_time"`
+}
+
+func intervalTallyID(agendaID string, startHeight int64) string {
+	return fmt.Sprintf("%s:%d", agendaID, startHeight)
+}
+
+func blockTallyID(agendaID string, height int64) string {
+	return fmt.Sprintf("%s:%d", agendaID, height)
+}
+
+func transitionID(agendaID string, height int64, to AgendaStatusType) string {
+	return fmt.Sprintf("%s:%d:%s", agendaID, height, to)
+}
+
+// choiceCounts sums the votes of the choices of an agenda into yes, no and
+// abstain. All the choices that are neither no nor abstain count as yes.
+func choiceCounts(choices []chainjson.Choice) (yes, no, abstain uint32) {
+	for _, c := range choices {
+		switch {
+		case c.IsAbstain:
+			abstain += c.Count
+		case c.IsNo:
+			no += c.Count
+		default:
+			yes += c.Count
+		}
+	}
+	return
+}
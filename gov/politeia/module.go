@@ -0,0 +1,86 @@
+package politeia
+
+import (
+	"context"
+	"path/filepath"
+
+	"github.com/decred/dcrd/dcrutil/v2"
+	"github.com/decred/slog"
+	"github.com/planetdecred/pdanalytics/app/helpers"
+	"github.com/planetdecred/pdanalytics/dcrd"
+	"github.com/planetdecred/pdanalytics/module"
+	"github.com/planetdecred/pdanalytics/web"
+)
+
+var (
+	defaultProposalsFileName  = filepath.Join(dcrutil.AppDataDir("pdanalytics", false), "data", "proposals.db")
+	defaultPoliteiaAPIURl     = "https://proposals.decred.org/"
+	defaultPiPropoalRepoOwner = "decred-proposals"
+	defaultPiProposalRepo     = "mainnet"
+)
+
+// ProposalsOptions are the config options of the proposals module.
+type ProposalsOptions struct {
+	EnableProposals     bool   `long:"proposals" description:"Enable/Disable the proposals module from running"`
+	EnableProposalsHttp bool   `long:"proposalshttp" description:"Enable/Disable the proposals http module from running"`
+	ProposalsFileName   string `long:"proposalsdbfile" description:"Proposals DB file name (default is proposals.db)." env:"DCRDATA_PROPOSALS_DB_FILE_NAME"`
+	PoliteiaAPIURL      string `long:"politeiaurl" description:"Defines the root API politeia URL (defaults to https://proposals.decred.org)."`
+	PiPropRepoOwner     string `long:"piproposalsowner" description:"Defines the owner to the github repo where Politeia's proposals are pushed."`
+	PiPropRepoName      string `long:"piproposalsrepo" description:"Defines the name of the github repo where Politeia's proposals are pushed."`
+}
+
+type proposalsModule struct {
+	options ProposalsOptions
+	client  *dcrd.Dcrd
+	server  *web.Server
+	dataDir string
+	db      *ProposalsDB
+}
+
+func init() {
+	module.Register(&proposalsModule{
+		options: ProposalsOptions{
+			EnableProposals:     true,
+			EnableProposalsHttp: true,
+			ProposalsFileName:   defaultProposalsFileName,
+			PoliteiaAPIURL:      defaultPoliteiaAPIURl,
+			PiPropRepoOwner:     defaultPiPropoalRepoOwner,
+			PiPropRepoName:      defaultPiProposalRepo,
+		},
+	})
+}
+
+func (m *proposalsModule) Name() string                 { return "proposals" }
+func (m *proposalsModule) LogSubsystem() string         { return "POLI" }
+func (m *proposalsModule) UseLogger(logger slog.Logger) { UseLogger(logger) }
+func (m *proposalsModule) Options() interface{}         { return &m.options }
+
+func (m *proposalsModule) Enabled() bool {
+	return m.options.EnableProposals || m.options.EnableProposalsHttp
+}
+
+func (m *proposalsModule) Init(deps *module.Deps) error {
+	m.options.ProposalsFileName = helpers.CleanAndExpandPath(m.options.ProposalsFileName)
+	m.client = deps.Dcrd
+	m.server = deps.Server
+	m.dataDir = deps.DataDir
+	return nil
+}
+
+func (m *proposalsModule) Start(ctx context.Context) error {
+	opts := m.options
+	db, err := Activate(ctx, m.client, opts.PoliteiaAPIURL, opts.ProposalsFileName, opts.PiPropRepoOwner,
+		opts.PiPropRepoName, m.dataDir, m.server, opts.EnableProposals, opts.EnableProposalsHttp)
+	if err != nil {
+		return err
+	}
+	m.db = db
+	return nil
+}
+
+// Stop closes the proposals DB.
+func (m *proposalsModule) Stop() error {
+	return m.db.Close()
+}
+
+func (m *proposalsModule) Health() module.Health { return module.Healthy }
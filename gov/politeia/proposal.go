@@ -29,9 +29,10 @@ type proposals struct {
 
 // Activate activates the proposal module.
 // This may take some time and should be ran in a goroutine
+// The returned proposals DB should be closed on shutdown.
 func Activate(ctx context.Context, client *dcrd.Dcrd,
 	politeiaURL, dbPath, piPropRepoOwner, piPropRepoName, dataDir string,
-	webServer *web.Server, dataMode, httpMode bool) error {
+	webServer *web.Server, dataMode, httpMode bool) (*ProposalsDB, error) {
 
 	prop := &proposals{
 		client:      client,
@@ -39,23 +40,24 @@ func Activate(ctx context.Context, client *dcrd.Dcrd,
 		politeiaURL: politeiaURL,
 	}
 
-	hash, err := client.Rpc.GetBestBlockHash()
+	hash, err := client.Rpc().GetBestBlockHash()
 	if err != nil {
-		return err
+		return nil, err
 	}
-	blockHeader, err := client.Rpc.GetBlockHeader(hash)
+	blockHeader, err := client.Rpc().GetBlockHeader(hash)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	if err = prop.connectBlock(blockHeader); err != nil {
-		return err
+		return nil, err
 	}
 	if err := prop.server.Templates.AddTemplate("proposal"); err != nil {
-		return err
+		return nil, err
 	}
 
 	client.Notif.RegisterBlockHandlerGroup(prop.connectBlock)
+	client.Notif.RegisterReorgHandlerGroup(prop.reorg)
 
 	if httpMode {
 		prop.server.AddRoute("/proposals", web.GET, prop.ProposalsPage)
@@ -63,10 +65,10 @@ func Activate(ctx context.Context, client *dcrd.Dcrd,
 		prop.server.AddRoute("/api/proposal/{token}", web.GET, prop.getProposalChartData, proposalTokenCtx)
 
 		if err := prop.server.Templates.AddTemplate("proposals"); err != nil {
-			return err
+			return nil, err
 		}
 		if err := prop.server.Templates.AddTemplate("proposal"); err != nil {
-			return err
+			return nil, err
 		}
 
 		prop.server.AddMenuItem(web.MenuItem{
@@ -82,13 +84,13 @@ func Activate(ctx context.Context, client *dcrd.Dcrd,
 
 	db, err := NewProposalsDB(politeiaURL, dbPath)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	prop.db = db
 
 	prop.start(ctx)
 
-	return nil
+	return db, nil
 }
 
 func (prop *proposals) start(ctx context.Context) {
@@ -127,3 +129,11 @@ func (prop *proposals) connectBlock(w *wire.BlockHeader) error {
 
 	return nil
 }
+
+func (prop *proposals) reorg(reorg *dcrd.ReorgData) error {
+	prop.reorgLock.Lock()
+	defer prop.reorgLock.Unlock()
+	prop.height = reorg.CommonAncestorHeight
+
+	return nil
+}
@@ -0,0 +1,172 @@
+// Package health serves the health and readiness endpoints of pdanalytics.
+// /api/health is a liveness check: it fails when a module went several
+// collection intervals without collecting anything, a state a restart may fix.
+// /api/ready is a readiness check: it fails until the modules are started and
+// while dcrd is disconnected or not synced, or the database is unreachable.
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/planetdecred/pdanalytics/dcrd"
+	"github.com/planetdecred/pdanalytics/module"
+)
+
+// checkTimeout bounds the time spent checking dcrd and the database.
+const checkTimeout = 5 * time.Second
+
+const (
+	// StatusOK is the status when all the checks pass.
+	StatusOK = "ok"
+	// StatusDegraded is the status when a dependency is unavailable or the
+	// last collection of a module failed.
+	StatusDegraded = "degraded"
+	// StatusFailing is the status when a module is stale.
+	StatusFailing = "failing"
+)
+
+// Pinger is implemented by the shared database.
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+// DcrdStatus is the state of the connection to dcrd.
+type DcrdStatus struct {
+	Connected bool   `json:"connected"`
+	Synced    bool   `json:"synced"`
+	Error     string `json:"error,omitempty"`
+}
+
+// DBStatus is the state of the shared database.
+type DBStatus struct {
+	Reachable bool    `json:"reachable"`
+	LatencyMs float64 `json:"latency_ms"`
+	Error     string  `json:"error,omitempty"`
+}
+
+// Report is the response of the health and readiness endpoints.
+type Report struct {
+	Status  string                   `json:"status"`
+	Ready   bool                     `json:"ready"`
+	Time    time.Time                `json:"time"`
+	Dcrd    DcrdStatus               `json:"dcrd"`
+	DB      *DBStatus                `json:"db,omitempty"`
+	Modules map[string]module.Health `json:"modules"`
+}
+
+// Checker builds the health reports.
+type Checker struct {
+	client  *dcrd.Dcrd
+	modules *module.Registry
+	db      func() Pinger
+	started uint32 // atomic
+}
+
+// NewChecker creates a Checker. db returns the shared database or nil if no
+// module uses it.
+func NewChecker(client *dcrd.Dcrd, modules *module.Registry, db func() Pinger) *Checker {
+	return &Checker{
+		client:  client,
+		modules: modules,
+		db:      db,
+	}
+}
+
+// SetStarted marks the end of the startup. The Checker is not ready before.
+func (c *Checker) SetStarted() {
+	atomic.StoreUint32(&c.started, 1)
+}
+
+// Report checks dcrd, the database and the modules.
+func (c *Checker) Report(ctx context.Context) *Report {
+	ctx, cancel := context.WithTimeout(ctx, checkTimeout)
+	defer cancel()
+
+	report := &Report{
+		Status:  StatusOK,
+		Time:    time.Now().UTC(),
+		Dcrd:    c.dcrdStatus(),
+		Modules: c.modules.Health(),
+	}
+	if db := c.db(); db != nil {
+		report.DB = dbStatus(ctx, db)
+	}
+
+	report.Ready = atomic.LoadUint32(&c.started) == 1 && report.Dcrd.Synced &&
+		(report.DB == nil || report.DB.Reachable)
+	if !report.Dcrd.Synced || (report.DB != nil && !report.DB.Reachable) {
+		report.Status = StatusDegraded
+	}
+	for _, h := range report.Modules {
+		if h.Stale {
+			report.Status = StatusFailing
+			break
+		}
+		if !h.Healthy {
+			report.Status = StatusDegraded
+		}
+	}
+	return report
+}
+
+func (c *Checker) dcrdStatus() DcrdStatus {
+	status := DcrdStatus{Connected: c.client.Connected()}
+	if !status.Connected {
+		return status
+	}
+	synced, err := c.client.IsSynced()
+	if err != nil {
+		status.Error = err.Error()
+		return status
+	}
+	status.Synced = synced
+	return status
+}
+
+func dbStatus(ctx context.Context, db Pinger) *DBStatus {
+	start := time.Now()
+	err := db.Ping(ctx)
+	status := &DBStatus{
+		Reachable: err == nil,
+		LatencyMs: float64(time.Since(start).Microseconds()) / 1000,
+	}
+	if err != nil {
+		status.Error = err.Error()
+	}
+	return status
+}
+
+// HealthHandler serves /api/health. It responds with 503 Service Unavailable
+// when a module is stale.
+func (c *Checker) HealthHandler(w http.ResponseWriter, r *http.Request) {
+	report := c.Report(r.Context())
+	code := http.StatusOK
+	if report.Status == StatusFailing {
+		code = http.StatusServiceUnavailable
+	}
+	writeReport(w, code, report)
+}
+
+// ReadyHandler serves /api/ready. It responds with 503 Service Unavailable
+// until the application is ready to serve up to date data.
+func (c *Checker) ReadyHandler(w http.ResponseWriter, r *http.Request) {
+	report := c.Report(r.Context())
+	code := http.StatusOK
+	if !report.Ready {
+		code = http.StatusServiceUnavailable
+	}
+	writeReport(w, code, report)
+}
+
+func writeReport(w http.ResponseWriter, code int, report *Report) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(report); err != nil {
+		log.Warnf("Unable to write the health report: %v", err)
+	}
+}
@@ -0,0 +1,103 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/planetdecred/pdanalytics/dcrd"
+	"github.com/planetdecred/pdanalytics/module"
+)
+
+type testModule struct {
+	name   string
+	health module.Health
+}
+
+func (m *testModule) Name() string                { return m.name }
+func (m *testModule) Init(*module.Deps) error     { return nil }
+func (m *testModule) Start(context.Context) error { return nil }
+func (m *testModule) Stop() error                 { return nil }
+func (m *testModule) Health() module.Health       { return m.health }
+
+type testPinger struct {
+	err error
+}
+
+func (p testPinger) Ping(context.Context) error { return p.err }
+
+func newTestChecker(t *testing.T, db Pinger, modules ...module.Module) *Checker {
+	t.Helper()
+	registry := module.NewRegistry()
+	for _, m := range modules {
+		if err := registry.Register(m); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := registry.Init(new(module.Deps)); err != nil {
+		t.Fatal(err)
+	}
+	if err := registry.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	return NewChecker(new(dcrd.Dcrd), registry, func() Pinger { return db })
+}
+
+func serve(t *testing.T, handler http.HandlerFunc) (int, *Report) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	handler(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	report := new(Report)
+	if err := json.NewDecoder(w.Body).Decode(report); err != nil {
+		t.Fatal(err)
+	}
+	return w.Code, report
+}
+
+func TestHealthHandler(t *testing.T) {
+	failing := &testModule{name: "failing", health: module.Health{LastError: "boom"}}
+	c := newTestChecker(t, testPinger{}, failing)
+
+	code, report := serve(t, c.HealthHandler)
+	if code != http.StatusOK || report.Status != StatusDegraded {
+		t.Errorf("got %d %s, want %d %s", code, report.Status, http.StatusOK, StatusDegraded)
+	}
+	if report.DB == nil || !report.DB.Reachable {
+		t.Errorf("unexpected database status %+v", report.DB)
+	}
+
+	stale := &testModule{name: "stale", health: module.Health{
+		Healthy:     true,
+		Interval:    time.Second,
+		LastSuccess: time.Now().Add(-time.Minute),
+	}}
+	c = newTestChecker(t, nil, stale)
+	code, report = serve(t, c.HealthHandler)
+	if code != http.StatusServiceUnavailable || report.Status != StatusFailing {
+		t.Errorf("got %d %s, want %d %s", code, report.Status, http.StatusServiceUnavailable, StatusFailing)
+	}
+	if !report.Modules["stale"].Stale {
+		t.Error("module not reported stale")
+	}
+	if report.DB != nil {
+		t.Error("unused database reported")
+	}
+}
+
+func TestReadyHandler(t *testing.T) {
+	c := newTestChecker(t, testPinger{err: errors.New("connection refused")})
+	c.SetStarted()
+
+	// The test dcrd client is never connected.
+	code, report := serve(t, c.ReadyHandler)
+	if code != http.StatusServiceUnavailable || report.Ready {
+		t.Errorf("got %d ready=%v, want %d ready=false", code, report.Ready, http.StatusServiceUnavailable)
+	}
+	if report.Dcrd.Connected || report.DB.Reachable || report.DB.Error == "" {
+		t.Errorf("unexpected report %+v", report)
+	}
+}
@@ -4,10 +4,6 @@ import (
 	"io"
 	"net/http"
 
-	"github.com/planetdecred/pdanalytics/attackcost"
-	"github.com/planetdecred/pdanalytics/charts"
-	"github.com/planetdecred/pdanalytics/parameters"
-	"github.com/planetdecred/pdanalytics/stakingreward"
 	"github.com/planetdecred/pdanalytics/web"
 )
 
@@ -16,11 +12,12 @@ type Home struct {
 	mods   Mods
 }
 
+// Mods holds the enabled state of the modules linked from the homepage.
 type Mods struct {
-	Ac    *attackcost.Attackcost
-	Stk   *stakingreward.Calculator
-	Prm   *parameters.Parameters
-	Chrts *charts.Charts
+	Ac    bool
+	Stk   bool
+	Prm   bool
+	Chrts bool
 }
 
 func New(server *web.Server, mods Mods) (*Home, error) {
@@ -39,10 +36,10 @@ func New(server *web.Server, mods Mods) (*Home, error) {
 }
 
 func (hm *Home) homepage(w http.ResponseWriter, r *http.Request) {
-	stk := hm.mods.Stk != nil
-	ac := hm.mods.Ac != nil
-	prm := hm.mods.Prm != nil
-	chrts := hm.mods.Chrts != nil
+	stk := hm.mods.Stk
+	ac := hm.mods.Ac
+	prm := hm.mods.Prm
+	chrts := hm.mods.Chrts
 	str, err := hm.server.Templates.ExecTemplateToString("home", struct {
 		*web.CommonPageData
 		NoModEnabled         bool
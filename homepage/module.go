@@ -0,0 +1,43 @@
+package homepage
+
+import (
+	"context"
+
+	"github.com/decred/slog"
+	"github.com/planetdecred/pdanalytics/module"
+	"github.com/planetdecred/pdanalytics/web"
+)
+
+// homeModule serves the homepage. It is always enabled.
+type homeModule struct {
+	server *web.Server
+	mods   Mods
+}
+
+func init() {
+	module.Register(&homeModule{})
+}
+
+func (m *homeModule) Name() string                 { return "homepage" }
+func (m *homeModule) LogSubsystem() string         { return "HOME" }
+func (m *homeModule) UseLogger(logger slog.Logger) { UseLogger(logger) }
+
+func (m *homeModule) Init(deps *module.Deps) error {
+	m.server = deps.Server
+	m.mods = Mods{
+		Ac:    deps.ModuleEnabled("attackcost"),
+		Stk:   deps.ModuleEnabled("stakingreward"),
+		Prm:   deps.ModuleEnabled("parameters"),
+		Chrts: deps.ModuleEnabled("charts"),
+	}
+	return nil
+}
+
+func (m *homeModule) Start(ctx context.Context) error {
+	_, err := New(m.server, m.mods)
+	return err
+}
+
+func (m *homeModule) Stop() error { return nil }
+
+func (m *homeModule) Health() module.Health { return module.Healthy }
@@ -2,28 +2,20 @@ package main
 
 import (
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 
 	"github.com/decred/slog"
 	"github.com/jrick/logrotate/rotator"
-	"github.com/planetdecred/pdanalytics/attackcost"
+	"github.com/planetdecred/pdanalytics/boltdb"
 	"github.com/planetdecred/pdanalytics/chart"
-	"github.com/planetdecred/pdanalytics/charts"
-	"github.com/planetdecred/pdanalytics/commstats"
-	"github.com/planetdecred/pdanalytics/exchanges"
-	"github.com/planetdecred/pdanalytics/gov/politeia"
-	"github.com/planetdecred/pdanalytics/homepage"
-	"github.com/planetdecred/pdanalytics/mempool"
-	"github.com/planetdecred/pdanalytics/netsnapshot"
-	"github.com/planetdecred/pdanalytics/parameters"
+	"github.com/planetdecred/pdanalytics/dcrd"
+	"github.com/planetdecred/pdanalytics/health"
+	"github.com/planetdecred/pdanalytics/metrics"
+	"github.com/planetdecred/pdanalytics/module"
 	"github.com/planetdecred/pdanalytics/postgres"
-	"github.com/planetdecred/pdanalytics/pow"
-	"github.com/planetdecred/pdanalytics/propagation"
-	"github.com/planetdecred/pdanalytics/stakingreward"
-	"github.com/planetdecred/pdanalytics/stats"
-	"github.com/planetdecred/pdanalytics/treasury"
-	"github.com/planetdecred/pdanalytics/vsp"
+	"github.com/planetdecred/pdanalytics/scheduler"
 	"github.com/planetdecred/pdanalytics/web"
 )
 
@@ -31,16 +23,21 @@ import (
 // the write-end pipe of an initialized log rotator.
 type logWriter struct{}
 
+// logOutput is the console output of the logs, the standard output unless a
+// command writes its result there.
+var logOutput io.Writer = os.Stdout
+
 // Write writes the data in p to standard out and the log rotator.
 func (logWriter) Write(p []byte) (n int, err error) {
-	os.Stdout.Write(p)
+	logOutput.Write(p)
 	return logRotator.Write(p)
 }
 
 // Loggers per subsystem.  A single backend logger is created and all subsytem
 // loggers created from it will write to the backend.  When adding new
 // subsystems, add the subsystem logger variable here and to the
-// subsystemLoggers map.
+// subsystemLoggers map. The loggers of the modules are created in init from
+// the subsystem identifiers they report.
 //
 // Loggers can not be used before the log rotator has been initialized with a
 // log file.  This must be performed early during application startup by calling
@@ -55,69 +52,53 @@ var (
 	// application shutdown.
 	logRotator *rotator.Rotator
 
-	log              = backendLog.Logger("PDAN")
-	paramLog         = backendLog.Logger("PARA")
-	attackcostLog    = backendLog.Logger("ATCK")
-	stakingrewardLog = backendLog.Logger("STCK")
-	homeLog          = backendLog.Logger(("HOME"))
-	psqlLog          = backendLog.Logger("PSQL")
-	mempoolLog       = backendLog.Logger("MEMP")
-	chartLog         = backendLog.Logger("CHRT")
-	propLog          = backendLog.Logger("PROP")
-	snapshotLog      = backendLog.Logger("NETS")
-	politeiaLog      = backendLog.Logger("POLI")
-	exchangeLog      = backendLog.Logger("EXCH")
-	webLogger        = backendLog.Logger("WEBL")
-	commLog          = backendLog.Logger("COMM")
-	powLog           = backendLog.Logger("POWL")
-	vspLog           = backendLog.Logger("VSPL")
-	statsLog         = backendLog.Logger("STAT")
-	chartsLog        = backendLog.Logger("CHRTS")
-	treasuryLog      = backendLog.Logger("TRS")
+	log          = backendLog.Logger("PDAN")
+	psqlLog      = backendLog.Logger("PSQL")
+	boltLog      = backendLog.Logger("BOLT")
+	chartLog     = backendLog.Logger("CHRT")
+	webLogger    = backendLog.Logger("WEBL")
+	dcrdLog      = backendLog.Logger("DCRD")
+	schedulerLog = backendLog.Logger("SCHD")
+	moduleLog    = backendLog.Logger("MODL")
+	healthLog    = backendLog.Logger("HLTH")
+	metricsLog   = backendLog.Logger("MTRC")
 )
 
 // Initialize package-global logger variables.
 func init() {
-	parameters.UseLogger(paramLog)
-	stakingreward.UseLogger(stakingrewardLog)
-	attackcost.UseLogger(attackcostLog)
-	homepage.UseLogger(homeLog)
-	mempool.UseLogger(mempoolLog)
 	postgres.UseLogger(psqlLog)
+	boltdb.UseLogger(boltLog)
 	chart.UseLogger(chartLog)
-	propagation.UseLogger(propLog)
-	netsnapshot.UseLogger(snapshotLog)
-	politeia.UseLogger(politeiaLog)
-	exchanges.UseLogger(exchangeLog)
 	web.UseLogger(webLogger)
-	commstats.UseLogger(commLog)
-	pow.UseLogger(powLog)
-	vsp.UseLogger(vspLog)
-	stats.UseLogger(statsLog)
-	charts.UseLogger(chartsLog)
-	treasury.UseLogger(treasuryLog)
+	dcrd.UseLogger(dcrdLog)
+	scheduler.UseLogger(schedulerLog)
+	module.UseLogger(moduleLog)
+	health.UseLogger(healthLog)
+	metrics.UseLogger(metricsLog)
+
+	for _, m := range modules.Modules() {
+		l, ok := m.(module.Logger)
+		if !ok {
+			continue
+		}
+		logger := backendLog.Logger(l.LogSubsystem())
+		l.UseLogger(logger)
+		subsystemLoggers[l.LogSubsystem()] = logger
+	}
 }
 
 // subsystemLoggers maps each subsystem identifier to its associated logger.
 var subsystemLoggers = map[string]slog.Logger{
-	"PDAN":  log,
-	"PARA":  paramLog,
-	"ATCK":  attackcostLog,
-	"STCK":  stakingrewardLog,
-	"HOME":  homeLog,
-	"PROP":  propLog,
-	"NETS":  snapshotLog,
-	"WEBL":  webLogger,
-	"MEMP":  mempoolLog,
-	"PSQL":  psqlLog,
-	"POLI":  politeiaLog,
-	"EXCH":  exchangeLog,
-	"COMM":  commLog,
-	"POWL":  powLog,
-	"VSPL":  vspLog,
-	"STAT":  statsLog,
-	"CHRTS": chartsLog,
-	"TRS":   treasuryLog,
+	"PDAN": log,
+	"WEBL": webLogger,
+	"PSQL": psqlLog,
+	"BOLT": boltLog,
+	"CHRT": chartLog,
+	"DCRD": dcrdLog,
+	"SCHD": schedulerLog,
+	"MODL": moduleLog,
+	"HLTH": healthLog,
+	"MTRC": metricsLog,
 }
 
 // initLogRotator initializes the logging rotater to write logs to logFile and
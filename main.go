@@ -2,21 +2,28 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"io/ioutil"
 	"net/http"
+	"net/url"
 	"os"
 	"os/signal"
 	"runtime/pprof"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 
-	"github.com/decred/dcrd/rpcclient/v5"
+	"github.com/decred/dcrd/dcrutil/v2"
+	"github.com/decred/dcrd/wire"
 	"github.com/decred/dcrdata/exchanges/v2"
 	"github.com/go-chi/chi"
 	"github.com/google/gops/agent"
+	"github.com/planetdecred/pdanalytics/app/helpers"
 	"github.com/planetdecred/pdanalytics/dcrd"
+	"github.com/planetdecred/pdanalytics/health"
+	"github.com/planetdecred/pdanalytics/metrics"
+	"github.com/planetdecred/pdanalytics/scheduler"
 	"github.com/planetdecred/pdanalytics/web"
 )
 
@@ -51,6 +58,21 @@ func _main(ctx context.Context) error {
 		}
 	}()
 
+	if cfg.Reset != "" {
+		return resetTables(ctx, cfg)
+	}
+	if cfg.MigrateOnly {
+		return migrateTables(ctx, cfg)
+	}
+	switch cfg.command {
+	case "export":
+		return runExport(ctx, cfg)
+	case "backup":
+		return runBackup(ctx, cfg)
+	case "restore":
+		return runRestore(ctx, cfg)
+	}
+
 	if cfg.CPUProfile != "" {
 		var f *os.File
 		f, err = os.Create(cfg.CPUProfile)
@@ -76,35 +98,24 @@ func _main(ctx context.Context) error {
 	// using (*Notifier).DcrdHandlers, for the rpcclient.Client constructor.
 	notifier := dcrd.NewNotifier(ctx)
 
-	// Connect to dcrd RPC server using a websocket.
-	dcrdClient, err := connectNodeRPC(cfg, notifier.DcrdHandlers())
-	if err != nil || dcrdClient == nil {
+	// Connect to dcrd RPC server using a websocket. The nodes are tried in
+	// order and must be on the expected network.
+	nodes, err := dcrdNodes(cfg)
+	if err != nil {
+		return err
+	}
+	dcrdClient, err := dcrd.Connect(ctx, nodes, activeChain, notifier)
+	if err != nil {
 		return fmt.Errorf("Connection to dcrd failed: %v", err)
 	}
 
 	defer func() {
-		if dcrdClient != nil {
-			log.Infof("Closing connection to dcrd.")
-			dcrdClient.Shutdown()
-			dcrdClient.WaitForShutdown()
-		}
+		log.Infof("Closing connection to dcrd.")
+		dcrdClient.Shutdown()
 		log.Infof("Bye!")
 		time.Sleep(250 * time.Millisecond)
 	}()
 
-	// Display connected network (e.g. mainnet, testnet, simnet).
-	curnet, err := dcrdClient.GetCurrentNet()
-	if err != nil {
-		return fmt.Errorf("Unable to get current network from dcrd: %v", err)
-	}
-	log.Infof("Connected to dcrd (JSON-RPC API) on %v", curnet.String())
-
-	if curnet != activeNet.Net {
-		log.Criticalf("Network of connected node, %s, does not match expected "+
-			"network, %s.", activeNet.Net, curnet)
-		return fmt.Errorf("expected network %s, got %s", activeNet.Net, curnet)
-	}
-
 	var wg sync.WaitGroup
 
 	// ExchangeBot
@@ -149,20 +160,48 @@ func _main(ctx context.Context) error {
 		return fmt.Errorf("failed to create new web server (templates missing?)")
 	}
 
+	// The metrics middleware must be added before any route.
+	if cfg.EnableMetrics {
+		webMux.Use(metrics.Middleware)
+	}
+
 	webServer.MountAssetPaths("/", "./web/public")
 
-	err = setupModules(ctx, cfg, &dcrd.Dcrd{
-		Rpc:    dcrdClient,
-		Params: activeChain,
-		Notif:  notifier,
-	}, webServer, xcBot)
+	// modCtx is canceled before the modules are stopped, also when
+	// starting them fails.
+	modCtx, cancelModules := context.WithCancel(ctx)
 
-	if err != nil {
+	// The scheduler runs the periodic collection jobs of the modules.
+	sched := scheduler.New(modCtx)
+
+	if cfg.EnableMetrics {
+		if err = startMetrics(modCtx, cfg, notifier, sched, webServer); err != nil {
+			return err
+		}
+	}
+
+	deps, db := moduleDeps(modCtx, cfg, dcrdClient, webServer, sched, xcBot)
+	defer func() {
+		cancelModules()
+		modules.Stop()
+		db.close()
+	}()
+
+	if err = modules.Init(deps); err != nil {
+		return err
+	}
+	if err = modules.Start(modCtx); err != nil {
 		return err
 	}
 
+	// The health checks report the state of dcrd, the database and the
+	// started modules. The readiness check passes once startup completes.
+	checker := health.NewChecker(dcrdClient, modules, db.pinger)
+	webServer.AddRoute("/api/health", web.GET, checker.HealthHandler)
+	webServer.AddRoute("/api/ready", web.GET, checker.ReadyHandler)
+
 	// (*notify.Notifier).processBlock will discard incoming block if PrevHash does not match
-	bestBlockHash, bestBlockHeight, err := dcrdClient.GetBestBlock()
+	bestBlockHash, bestBlockHeight, err := dcrdClient.Rpc().GetBestBlock()
 	if err != nil {
 		log.Error(err)
 		return fmt.Errorf("Failed to get best block")
@@ -180,43 +219,108 @@ func _main(ctx context.Context) error {
 	// Register for notifications from dcrd. This also sets the daemon RPC
 	// client used by other functions in the notify/notification package (i.e.
 	// common ancestor identification in processReorg).
-	cerr := notifier.Listen(dcrdClient)
+	cerr := notifier.Listen(dcrdClient.Rpc())
 	if cerr != nil {
 		return fmt.Errorf("RPC client error: %v (%v)", cerr.Error(), cerr.Cause())
 	}
 
+	// Re-dial or fail over to the next node when the connection drops.
+	go dcrdClient.Monitor()
+
+	checker.SetStarted()
+
 	wg.Wait()
+	sched.Wait()
 
 	return nil
 }
 
-func connectNodeRPC(cfg *config, ntfnHandlers *rpcclient.NotificationHandlers) (*rpcclient.Client, error) {
-	var dcrdCerts []byte
-	var err error
-	if !cfg.DisableDaemonTLS {
-		dcrdCerts, err = ioutil.ReadFile(cfg.DcrdCert)
+// startMetrics records the notifier, scheduler and block metrics and serves
+// them on the metrics listener or, without one, on the API server.
+func startMetrics(ctx context.Context, cfg *config, notifier *dcrd.Notifier, sched *scheduler.Scheduler,
+	webServer *web.Server) error {
+	if err := metrics.RegisterQueueDepth(notifier.QueueLen); err != nil {
+		return err
+	}
+	notifier.SetHandlerObserver(metrics.ObserveHandler)
+	sched.SetRunObserver(metrics.ObserveCollectorRun)
+	notifier.RegisterBlockHandlerGroup(func(header *wire.BlockHeader) error {
+		metrics.BestBlockHeight.Set(float64(header.Height))
+		metrics.TicketPrice.Set(dcrutil.Amount(header.SBits).ToCoin())
+		return nil
+	})
+
+	if cfg.MetricsListen == "" {
+		webServer.AddRoute("/metrics", web.GET, metrics.Handler().ServeHTTP)
+		return nil
+	}
+	metrics.ListenAndServe(ctx, cfg.MetricsListen)
+	return nil
+}
+
+// dcrdNodes builds the list of dcrd nodes to connect to from the dcrdserv
+// options followed by the dcrdfallback servers.
+func dcrdNodes(cfg *config) ([]dcrd.NodeConfig, error) {
+	nodes := []dcrd.NodeConfig{{
+		Host:       cfg.DcrdRPCServer,
+		User:       cfg.DcrdRPCUser,
+		Pass:       cfg.DcrdRPCPassword,
+		CertFile:   cfg.DcrdCert,
+		DisableTLS: cfg.DisableDaemonTLS,
+	}}
+
+	for i, fallback := range cfg.DcrdFallbacks {
+		node, err := parseDcrdFallback(fallback, cfg.DcrdCert)
 		if err != nil {
-			log.Errorf("Failed to read dcrd cert file at %s: %s\n",
-				cfg.DcrdCert, err.Error())
-			return nil, err
+			return nil, fmt.Errorf("invalid dcrdfallback %d: %v", i+1, err)
 		}
-		log.Debugf("Attempting to connect to dcrd RPC %s as user %s "+
-			"using certificate located in %s",
-			cfg.DcrdRPCServer, cfg.DcrdRPCUser, cfg.DcrdCert)
-	} else {
-		log.Debugf("Attempting to connect to dcrd RPC %s as user %s (no TLS)",
-			cfg.DcrdRPCServer, cfg.DcrdRPCUser)
+		nodes = append(nodes, node)
 	}
 
-	connCfg := &rpcclient.ConnConfig{
-		Host:         cfg.DcrdRPCServer,
-		Endpoint:     "ws",
-		User:         cfg.DcrdRPCUser,
-		Pass:         cfg.DcrdRPCPassword,
-		Certificates: dcrdCerts,
-		DisableTLS:   cfg.DisableDaemonTLS,
+	return nodes, nil
+}
+
+// parseDcrdFallback parses a dcrdfallback server of the form
+// user:pass@host[:port][?cert=file&notls=1]. The user, password and
+// certificate file are URL escaped, e.g. an @ in the password is written %40.
+// The certificate defaults to defaultCert, and TLS is disabled only with
+// notls.
+func parseDcrdFallback(fallback, defaultCert string) (dcrd.NodeConfig, error) {
+	const form = "expected user:pass@host:port[?cert=file&notls=1]"
+	u, err := url.Parse("//" + fallback)
+	if err != nil {
+		// The error holds the password.
+		return dcrd.NodeConfig{}, errors.New(form)
+	}
+	if u.User == nil || u.Host == "" || u.Path != "" || u.Fragment != "" {
+		return dcrd.NodeConfig{}, fmt.Errorf("%s, got %s", form, u.Redacted())
+	}
+	host, err := normalizeNetworkAddress(u.Host, defaultHost, activeNet.JSONRPCClientPort)
+	if err != nil {
+		return dcrd.NodeConfig{}, err
+	}
+	pass, _ := u.User.Password()
+	node := dcrd.NodeConfig{
+		Host:     host,
+		User:     u.User.Username(),
+		Pass:     pass,
+		CertFile: defaultCert,
+	}
+
+	for key, values := range u.Query() {
+		value := values[len(values)-1]
+		switch key {
+		case "cert":
+			node.CertFile = helpers.CleanAndExpandPath(value)
+		case "notls":
+			if node.DisableTLS, err = strconv.ParseBool(value); err != nil {
+				return dcrd.NodeConfig{}, fmt.Errorf("invalid notls %q of %s", value, host)
+			}
+		default:
+			return dcrd.NodeConfig{}, fmt.Errorf("unknown %s setting of %s, %s", key, host, form)
+		}
 	}
-	return rpcclient.New(connCfg, ntfnHandlers)
+	return node, nil
 }
 
 func listenAndServeProto(ctx context.Context, wg *sync.WaitGroup, listen, proto string, mux http.Handler) {
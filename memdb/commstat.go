@@ -0,0 +1,218 @@
+package memdb
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/planetdecred/pdanalytics/commstats"
+)
+
+// The community stats are appended in date order and, like the postgres
+// primary keys, a date is only stored once per table.
+
+func (db *MemDb) StoreRedditStat(ctx context.Context, stat commstats.Reddit) error {
+	db.mtx.Lock()
+	defer db.mtx.Unlock()
+	for _, r := range db.reddit {
+		if r.Date.Equal(stat.Date) {
+			return nil
+		}
+	}
+	db.reddit = append(db.reddit, stat)
+	return nil
+}
+
+func (db *MemDb) LastCommStatEntry() (entryTime time.Time) {
+	_ = db.LastEntry(context.Background(), redditTable, &entryTime)
+	return
+}
+
+func (db *MemDb) CountRedditStat(ctx context.Context, subreddit string) (int64, error) {
+	stats, _ := db.RedditStats(ctx, subreddit, 0, -1)
+	return int64(len(stats)), nil
+}
+
+func (db *MemDb) RedditStats(ctx context.Context, subreddit string, offtset int, limit int) ([]commstats.Reddit, error) {
+	db.mtx.RLock()
+	defer db.mtx.RUnlock()
+	var matches []commstats.Reddit
+	for i := len(db.reddit) - 1; i >= 0; i-- {
+		if db.reddit[i].Subreddit == subreddit {
+			matches = append(matches, db.reddit[i])
+		}
+	}
+	start, end := page(len(matches), offtset, limit)
+	return matches[start:end], nil
+}
+
+func (db *MemDb) StoreTwitterStat(ctx context.Context, twitter commstats.Twitter) error {
+	db.mtx.Lock()
+	defer db.mtx.Unlock()
+	for _, r := range db.twitter {
+		if r.Date.Equal(twitter.Date) {
+			return nil
+		}
+	}
+	db.twitter = append(db.twitter, twitter)
+	return nil
+}
+
+func (db *MemDb) CountTwitterStat(ctx context.Context, handle string) (int64, error) {
+	stats, _ := db.TwitterStats(ctx, handle, 0, -1)
+	return int64(len(stats)), nil
+}
+
+func (db *MemDb) TwitterStats(ctx context.Context, handle string, offtset int, limit int) ([]commstats.Twitter, error) {
+	db.mtx.RLock()
+	defer db.mtx.RUnlock()
+	var matches []commstats.Twitter
+	for i := len(db.twitter) - 1; i >= 0; i-- {
+		if db.twitter[i].Handle == handle {
+			matches = append(matches, db.twitter[i])
+		}
+	}
+	start, end := page(len(matches), offtset, limit)
+	return matches[start:end], nil
+}
+
+func (db *MemDb) StoreYoutubeStat(ctx context.Context, youtube commstats.Youtube) error {
+	db.mtx.Lock()
+	defer db.mtx.Unlock()
+	for _, r := range db.youtube {
+		if r.Date.Equal(youtube.Date) {
+			return nil
+		}
+	}
+	db.youtube = append(db.youtube, youtube)
+	return nil
+}
+
+func (db *MemDb) CountYoutubeStat(ctx context.Context, channel string) (int64, error) {
+	stats, _ := db.YoutubeStat(ctx, channel, 0, -1)
+	return int64(len(stats)), nil
+}
+
+func (db *MemDb) YoutubeStat(ctx context.Context, channel string, offtset int, limit int) ([]commstats.Youtube, error) {
+	db.mtx.RLock()
+	defer db.mtx.RUnlock()
+	var matches []commstats.Youtube
+	for i := len(db.youtube) - 1; i >= 0; i-- {
+		if db.youtube[i].Channel == channel {
+			matches = append(matches, db.youtube[i])
+		}
+	}
+	start, end := page(len(matches), offtset, limit)
+	return matches[start:end], nil
+}
+
+func (db *MemDb) StoreGithubStat(ctx context.Context, github commstats.Github) error {
+	db.mtx.Lock()
+	defer db.mtx.Unlock()
+	for _, r := range db.github {
+		if r.Date.Equal(github.Date) {
+			return nil
+		}
+	}
+	db.github = append(db.github, github)
+	return nil
+}
+
+func (db *MemDb) CountGithubStat(ctx context.Context, repository string) (int64, error) {
+	stats, _ := db.GithubStat(ctx, repository, 0, -1)
+	return int64(len(stats)), nil
+}
+
+func (db *MemDb) GithubStat(ctx context.Context, repository string, offtset int, limit int) ([]commstats.Github, error) {
+	db.mtx.RLock()
+	defer db.mtx.RUnlock()
+	var matches []commstats.Github
+	for i := len(db.github) - 1; i >= 0; i-- {
+		if db.github[i].Repository == repository {
+			matches = append(matches, db.github[i])
+		}
+	}
+	start, end := page(len(matches), offtset, limit)
+	return matches[start:end], nil
+}
+
+// commStatRow is a community stat by postgres column name, for the charts
+// and their filters.
+type commStatRow struct {
+	date    time.Time
+	columns map[string]interface{}
+}
+
+// commStatRows returns the rows of the platform table, in date order. The
+// caller must hold the lock.
+func (db *MemDb) commStatRows(platform string) ([]commStatRow, error) {
+	var rows []commStatRow
+	switch platform {
+	case redditTable:
+		for _, r := range db.reddit {
+			rows = append(rows, commStatRow{r.Date, map[string]interface{}{
+				"subreddit":       r.Subreddit,
+				"subscribers":     r.Subscribers,
+				"active_accounts": r.AccountsActive,
+			}})
+		}
+	case twitterTable:
+		for _, r := range db.twitter {
+			rows = append(rows, commStatRow{r.Date, map[string]interface{}{
+				"handle":    r.Handle,
+				"followers": r.Followers,
+			}})
+		}
+	case githubTable:
+		for _, r := range db.github {
+			rows = append(rows, commStatRow{r.Date, map[string]interface{}{
+				"repository": r.Repository,
+				"stars":      r.Stars,
+				"folks":      r.Folks,
+			}})
+		}
+	case youtubeTable:
+		for _, r := range db.youtube {
+			rows = append(rows, commStatRow{r.Date, map[string]interface{}{
+				"channel":     r.Channel,
+				"subscribers": r.Subscribers,
+				"view_count":  r.ViewCount,
+			}})
+		}
+	default:
+		return nil, fmt.Errorf("unknown community stat platform %s", platform)
+	}
+	return rows, nil
+}
+
+// CommunityChart returns the dataType column of the platform records matching
+// the filters. The filter values are quoted, as they are for the postgres
+// query.
+func (db *MemDb) CommunityChart(ctx context.Context, platform string, dataType string, filters map[string]string) (stats []commstats.ChartData, err error) {
+	db.mtx.RLock()
+	defer db.mtx.RUnlock()
+	dataType = strings.ToLower(dataType)
+	rows, err := db.commStatRows(platform)
+	if err != nil {
+		return nil, err
+	}
+
+rows:
+	for _, row := range rows {
+		for attribute, value := range filters {
+			if fmt.Sprint(row.columns[attribute]) != strings.Trim(value, "'") {
+				continue rows
+			}
+		}
+		value, ok := row.columns[dataType].(int)
+		if !ok {
+			return nil, fmt.Errorf("unknown %s column %s", platform, dataType)
+		}
+		stats = append(stats, commstats.ChartData{
+			Date:   row.date.UTC(),
+			Record: int64(value),
+		})
+	}
+	return
+}
@@ -0,0 +1,377 @@
+package memdb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/planetdecred/pdanalytics/app/helpers"
+	"github.com/planetdecred/pdanalytics/chart"
+	"github.com/planetdecred/pdanalytics/dbhelper"
+	"github.com/planetdecred/pdanalytics/exchanges/ticks"
+)
+
+var zeroTime time.Time
+
+// exchangeTick is a stored tick, keyed by exchange, interval, currency pair
+// and time so a tick is only stored once.
+type exchangeTick struct {
+	ticks.Tick
+	ExchangeID   int
+	Interval     int
+	CurrencyPair string
+}
+
+func (t *exchangeTick) toDto(exchangeName string) ticks.TickDto {
+	return ticks.TickDto{
+		ExchangeID:   t.ExchangeID,
+		Interval:     t.Interval,
+		CurrencyPair: t.CurrencyPair,
+		Time:         t.Time.Format(dbhelper.DateTemplate),
+		Close:        t.Close,
+		ExchangeName: exchangeName,
+		High:         t.High,
+		Low:          t.Low,
+		Open:         t.Open,
+		Volume:       t.Volume,
+	}
+}
+
+// exchangeTickFilter selects the ticks of an exchange, a currency pair and an
+// interval. The zero values match any.
+type exchangeTickFilter struct {
+	exchangeID   int
+	currencyPair string
+	interval     int
+}
+
+func (f exchangeTickFilter) match(t *exchangeTick) bool {
+	return (f.exchangeID == 0 || t.ExchangeID == f.exchangeID) &&
+		(f.currencyPair == "" || t.CurrencyPair == f.currencyPair) &&
+		(f.interval == 0 || t.Interval == f.interval)
+}
+
+func (db *MemDb) ExchangeTableName() string {
+	return exchangeTable
+}
+
+func (db *MemDb) ExchangeTickTableName() string {
+	return exchangeTickTable
+}
+
+// exchangeByName returns the named exchange. The caller must hold the lock.
+func (db *MemDb) exchangeByName(name string) (*ticks.ExchangeDto, error) {
+	for i := range db.exchanges {
+		if db.exchanges[i].Name == name {
+			return &db.exchanges[i], nil
+		}
+	}
+	return nil, fmt.Errorf("unknown exchange %s", name)
+}
+
+// ticksOf returns the ticks matching the filter, ordered by time. The caller
+// must hold the lock.
+func (db *MemDb) ticksOf(filter exchangeTickFilter) []exchangeTick {
+	var result []exchangeTick
+	for _, t := range db.exchangeTicks {
+		if filter.match(&t) {
+			result = append(result, t)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if !result[i].Time.Equal(result[j].Time) {
+			return result[i].Time.Before(result[j].Time)
+		}
+		if result[i].ExchangeID != result[j].ExchangeID {
+			return result[i].ExchangeID < result[j].ExchangeID
+		}
+		if result[i].CurrencyPair != result[j].CurrencyPair {
+			return result[i].CurrencyPair < result[j].CurrencyPair
+		}
+		return result[i].Interval < result[j].Interval
+	})
+	return result
+}
+
+func (db *MemDb) RegisterExchange(ctx context.Context, exchange ticks.ExchangeData) (time.Time, time.Time, time.Time, error) {
+	db.mtx.Lock()
+	defer db.mtx.Unlock()
+	xch, err := db.exchangeByName(exchange.Name)
+	if err != nil {
+		db.exchanges = append(db.exchanges, ticks.ExchangeDto{
+			ID:   len(db.exchanges) + 1,
+			Name: exchange.Name,
+			URL:  exchange.WebsiteURL,
+		})
+		return zeroTime, zeroTime, zeroTime, nil
+	}
+
+	lastTime := func(interval time.Duration) (t time.Time) {
+		records := db.ticksOf(exchangeTickFilter{exchangeID: xch.ID, interval: int(interval.Minutes())})
+		if len(records) > 0 {
+			t = records[len(records)-1].Time
+		}
+		return
+	}
+	return lastTime(exchange.ShortInterval), lastTime(exchange.LongInterval),
+		lastTime(exchange.HistoricInterval), nil
+}
+
+func (db *MemDb) StoreExchangeTicks(ctx context.Context, name string, interval int, pair string, data []ticks.Tick) (time.Time, error) {
+	if len(data) == 0 {
+		return zeroTime, fmt.Errorf("No ticks received for %s", name)
+	}
+	db.mtx.Lock()
+	defer db.mtx.Unlock()
+	exchange, err := db.exchangeByName(name)
+	if err != nil {
+		return zeroTime, err
+	}
+
+	var lastTime time.Time
+	for _, tick := range data {
+		tick.Time = tick.Time.UTC()
+		key := fmt.Sprintf("%d:%d:%s:%020d", exchange.ID, interval, pair, tick.Time.Unix())
+		db.exchangeTicks[key] = exchangeTick{
+			Tick:         tick,
+			ExchangeID:   exchange.ID,
+			Interval:     interval,
+			CurrencyPair: pair,
+		}
+		lastTime = tick.Time
+	}
+	return lastTime, nil
+}
+
+// AllExchange fetches a slice of all exchange from the db
+func (db *MemDb) AllExchange(ctx context.Context) ([]ticks.ExchangeDto, error) {
+	db.mtx.RLock()
+	defer db.mtx.RUnlock()
+	return append([]ticks.ExchangeDto(nil), db.exchanges...), nil
+}
+
+func (db *MemDb) FetchExchangeForSync(ctx context.Context, lastID int, skip, take int) ([]ticks.ExchangeData, int64, error) {
+	db.mtx.RLock()
+	defer db.mtx.RUnlock()
+	var exchanges []ticks.ExchangeData
+	for _, e := range db.exchanges {
+		if e.ID > lastID {
+			exchanges = append(exchanges, ticks.ExchangeData{
+				ID:         e.ID,
+				Name:       e.Name,
+				WebsiteURL: e.URL,
+			})
+		}
+	}
+	start, end := page(len(exchanges), skip, take)
+	return exchanges[start:end], int64(len(exchanges)), nil
+}
+
+func (db *MemDb) ExchangeTickCount(ctx context.Context) (int64, error) {
+	db.mtx.RLock()
+	defer db.mtx.RUnlock()
+	return int64(len(db.exchangeTicks)), nil
+}
+
+// exchangeTicksPage returns a page of the ticks matching the filter, the most
+// recent first, and the number of matching ticks. The caller must hold the
+// lock.
+func (db *MemDb) exchangeTicksPage(filter exchangeTickFilter, offset, limit int) ([]ticks.TickDto, int64) {
+	names := make(map[int]string, len(db.exchanges))
+	for _, e := range db.exchanges {
+		names[e.ID] = e.Name
+	}
+	records := db.ticksOf(filter)
+	start, end := page(len(records), offset, limit)
+	tickDtos := []ticks.TickDto{}
+	for i := start; i < end; i++ {
+		t := &records[len(records)-1-i]
+		tickDtos = append(tickDtos, t.toDto(names[t.ExchangeID]))
+	}
+	return tickDtos, int64(len(records))
+}
+
+// FetchExchangeTicks fetches a slice exchange ticks of the supplied exchange name
+func (db *MemDb) FetchExchangeTicks(ctx context.Context, currencyPair, name string, interval, offset, limit int) ([]ticks.TickDto, int64, error) {
+	db.mtx.RLock()
+	defer db.mtx.RUnlock()
+	var filter exchangeTickFilter
+	if name != "All" && name != "" {
+		exchange, err := db.exchangeByName(name)
+		if err != nil {
+			return nil, 0, err
+		}
+		filter.exchangeID = exchange.ID
+	}
+	if currencyPair != "All" {
+		filter.currencyPair = currencyPair
+	}
+	if interval > 0 {
+		filter.interval = interval
+	}
+	result, total := db.exchangeTicksPage(filter, offset, limit)
+	return result, total, nil
+}
+
+func (db *MemDb) AllExchangeTicks(ctx context.Context, currencyPair string, interval, offset, limit int) ([]ticks.TickDto, int64, error) {
+	db.mtx.RLock()
+	defer db.mtx.RUnlock()
+	filter := exchangeTickFilter{currencyPair: currencyPair}
+	if interval != -1 {
+		filter.interval = interval
+	}
+	result, total := db.exchangeTicksPage(filter, offset, limit)
+	return result, total, nil
+}
+
+// exchangeTicksOf returns the ticks of the exchange, or of all the exchanges
+// when exchangeName is "All" or empty, matching the filter. The caller must
+// hold the lock.
+func (db *MemDb) exchangeTicksOf(exchangeName string, filter exchangeTickFilter) ([]exchangeTick, error) {
+	if exchangeName != "All" && exchangeName != "" {
+		exchange, err := db.exchangeByName(exchangeName)
+		if err != nil {
+			return nil, err
+		}
+		filter.exchangeID = exchange.ID
+	}
+	return db.ticksOf(filter), nil
+}
+
+func distinctCurrencyPairs(records []exchangeTick) []ticks.TickDtoCP {
+	seen := make(map[string]bool)
+	result := []ticks.TickDtoCP{}
+	for _, r := range records {
+		if !seen[r.CurrencyPair] {
+			seen[r.CurrencyPair] = true
+			result = append(result, ticks.TickDtoCP{CurrencyPair: r.CurrencyPair})
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].CurrencyPair < result[j].CurrencyPair })
+	return result
+}
+
+func distinctIntervals(records []exchangeTick) []ticks.TickDtoInterval {
+	seen := make(map[int]bool)
+	result := []ticks.TickDtoInterval{}
+	for _, r := range records {
+		if !seen[r.Interval] {
+			seen[r.Interval] = true
+			result = append(result, ticks.TickDtoInterval{Interval: r.Interval})
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Interval < result[j].Interval })
+	return result
+}
+
+func (db *MemDb) AllExchangeTicksCurrencyPair(ctx context.Context) ([]ticks.TickDtoCP, error) {
+	db.mtx.RLock()
+	defer db.mtx.RUnlock()
+	return distinctCurrencyPairs(db.ticksOf(exchangeTickFilter{})), nil
+}
+
+func (db *MemDb) CurrencyPairByExchange(ctx context.Context, exchangeName string) ([]ticks.TickDtoCP, error) {
+	db.mtx.RLock()
+	defer db.mtx.RUnlock()
+	records, err := db.exchangeTicksOf(exchangeName, exchangeTickFilter{})
+	if err != nil {
+		return nil, err
+	}
+	return distinctCurrencyPairs(records), nil
+}
+
+func (db *MemDb) AllExchangeTicksInterval(ctx context.Context) ([]ticks.TickDtoInterval, error) {
+	db.mtx.RLock()
+	defer db.mtx.RUnlock()
+	return distinctIntervals(db.ticksOf(exchangeTickFilter{})), nil
+}
+
+func (db *MemDb) TickIntervalsByExchangeAndPair(ctx context.Context, exchangeName string, currencyPair string) ([]ticks.TickDtoInterval, error) {
+	db.mtx.RLock()
+	defer db.mtx.RUnlock()
+	records, err := db.exchangeTicksOf(exchangeName, exchangeTickFilter{currencyPair: currencyPair})
+	if err != nil {
+		return nil, err
+	}
+	return distinctIntervals(records), nil
+}
+
+func (db *MemDb) ExchangeTicksChartData(ctx context.Context, selectedTick string, currencyPair string, selectedInterval int, source string) ([]ticks.TickChartData, error) {
+	db.mtx.RLock()
+	defer db.mtx.RUnlock()
+	filter := exchangeTickFilter{currencyPair: currencyPair}
+	if selectedInterval != -1 {
+		filter.interval = selectedInterval
+	}
+	records, err := db.exchangeTicksOf(source, filter)
+	if err != nil {
+		return nil, fmt.Errorf("The selected exchange, %s does not exist, %s", source, err.Error())
+	}
+
+	tickChart := []ticks.TickChartData{}
+	for _, tick := range records {
+		var filter float64
+		switch selectedTick {
+		case "high":
+			filter = tick.High
+		case "low":
+			filter = tick.Low
+		case "open":
+			filter = tick.Open
+		case "Volume":
+			filter = tick.Volume
+		default:
+			filter = tick.Close
+		}
+		tickChart = append(tickChart, ticks.TickChartData{
+			Time:   tick.Time,
+			Filter: filter,
+		})
+	}
+	return tickChart, nil
+}
+
+func (db *MemDb) LastExchangeTickEntryTime() (time time.Time) {
+	db.mtx.RLock()
+	defer db.mtx.RUnlock()
+	if records := db.ticksOf(exchangeTickFilter{}); len(records) > 0 {
+		time = helpers.UnixTime(records[len(records)-1].Time.Unix())
+	}
+	return
+}
+
+func (db *MemDb) FetchEncodeExchangeChart(ctx context.Context, dataType, _ string, binString string, setKey ...string) ([]byte, error) {
+	if len(setKey) < 1 {
+		return nil, errors.New("exchange set key is required for exchange chart")
+	}
+	if err := checkBin(binString); err != nil {
+		return nil, err
+	}
+	db.mtx.RLock()
+	defer db.mtx.RUnlock()
+	exchangeName, currencyPair, interval := chart.ExtractExchangeKey(setKey[0])
+	records, err := db.exchangeTicksOf(exchangeName, exchangeTickFilter{currencyPair: currencyPair, interval: interval})
+	if err != nil {
+		return nil, fmt.Errorf("the selected exchange, %s does not exist, %s", exchangeName, err.Error())
+	}
+
+	var dates chart.ChartUints
+	var yAxis chart.ChartFloats
+	for _, t := range records {
+		dates = append(dates, uint64(t.Time.Unix()))
+		switch strings.ToLower(dataType) {
+		case string(chart.ExchangeOpenAxis):
+			yAxis = append(yAxis, t.Open)
+		case string(chart.ExchangeCloseAxis):
+			yAxis = append(yAxis, t.Close)
+		case string(chart.ExchangeHighAxis):
+			yAxis = append(yAxis, t.High)
+		case string(chart.ExchangeLowAxis):
+			yAxis = append(yAxis, t.Low)
+		}
+	}
+	return chart.Encode(nil, dates, yAxis)
+}
@@ -0,0 +1,59 @@
+package memdb
+
+import (
+	"math"
+	"sort"
+	"strconv"
+
+	"github.com/planetdecred/pdanalytics/chart"
+	"github.com/volatiletech/null/v8"
+)
+
+const dateTemplate = "2006-01-02 15:04"
+
+// roundValue formats a proportion as a percentage, like postgres.RoundValue.
+func roundValue(input float64) string {
+	return strconv.FormatFloat(input*100, 'f', 3, 64)
+}
+
+// sortedDates returns the dates of the set in ascending order.
+func sortedDates(set map[uint64]float64) chart.ChartUints {
+	dates := make(chart.ChartUints, 0, len(set))
+	for date := range set {
+		dates = append(dates, date)
+	}
+	sort.Slice(dates, func(i, j int) bool { return dates[i] < dates[j] })
+	return dates
+}
+
+// nullUints aligns the values of a series, keyed by date, to dates. The dates
+// before the first value of the series are nil and the missing values after it
+// are invalid, as the postgres charts do.
+func nullUints(dates chart.ChartUints, values map[uint64]float64) chart.ChartNullUints {
+	series := make(chart.ChartNullUints, len(dates))
+	var hasFoundOne bool
+	for i, date := range dates {
+		if v, found := values[date]; found {
+			series[i] = &null.Uint64{Valid: true, Uint64: uint64(math.Round(v))}
+			hasFoundOne = true
+		} else if hasFoundOne {
+			series[i] = &null.Uint64{Valid: false}
+		}
+	}
+	return series
+}
+
+// nullFloats is nullUints for float values.
+func nullFloats(dates chart.ChartUints, values map[uint64]float64) chart.ChartNullFloats {
+	series := make(chart.ChartNullFloats, len(dates))
+	var hasFoundOne bool
+	for i, date := range dates {
+		if v, found := values[date]; found {
+			series[i] = &null.Float64{Valid: true, Float64: v}
+			hasFoundOne = true
+		} else if hasFoundOne {
+			series[i] = &null.Float64{Valid: false}
+		}
+	}
+	return series
+}
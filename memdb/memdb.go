@@ -0,0 +1,207 @@
+// Package memdb implements the module data stores in memory, so the
+// collectors and the http handlers of the modules can be tested without a
+// database.
+package memdb
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/planetdecred/pdanalytics/chart"
+	"github.com/planetdecred/pdanalytics/commstats"
+	"github.com/planetdecred/pdanalytics/exchanges/ticks"
+	"github.com/planetdecred/pdanalytics/mempool"
+	"github.com/planetdecred/pdanalytics/netsnapshot"
+	"github.com/planetdecred/pdanalytics/pow"
+	"github.com/planetdecred/pdanalytics/propagation"
+	"github.com/planetdecred/pdanalytics/vsp"
+)
+
+// The table names are the ones of the postgres and bolt stores.
+const (
+	mempoolTable         = "mempool"
+	networkSnapshotTable = "network_snapshot"
+	blockTable           = "block"
+	voteTable            = "vote"
+	exchangeTable        = "exchange"
+	exchangeTickTable    = "exchange_tick"
+	redditTable          = "reddit"
+	twitterTable         = "twitter"
+	githubTable          = "github"
+	youtubeTable         = "youtube"
+	powDataTable         = "pow_data"
+	vspTable             = "vsp"
+	vspTickTable         = "vsp_tick"
+)
+
+// errBin is returned for the charts of any bin but the default one, as the
+// records are not aggregated.
+var errBin = errors.New("memdb only serves the default chart bin")
+
+var (
+	_ mempool.DataStore     = (*MemDb)(nil)
+	_ pow.PowDataStore      = (*MemDb)(nil)
+	_ vsp.DataStore         = (*MemDb)(nil)
+	_ commstats.DataStore   = (*MemDb)(nil)
+	_ ticks.Store           = (*MemDb)(nil)
+	_ netsnapshot.DataStore = (*MemDb)(nil)
+	_ propagation.Store     = (*MemDb)(nil)
+)
+
+// MemDb holds the records of every module in memory. The zero value is not
+// usable, use New. It is safe for concurrent use.
+type MemDb struct {
+	mtx sync.RWMutex
+
+	mempools   []mempool.Mempool
+	mempoolTxs map[string]mempool.MempoolTx
+
+	pows map[string]pow.PowData
+
+	vsps     []vspRecord
+	vspTicks []vspTickRecord
+
+	reddit  []commstats.Reddit
+	twitter []commstats.Twitter
+	github  []commstats.Github
+	youtube []commstats.Youtube
+
+	exchanges     []ticks.ExchangeDto
+	exchangeTicks map[string]exchangeTick
+
+	snapshots  map[int64]netsnapshot.SnapShot
+	nodes      map[string]*nodeRecord
+	heartbeats map[string]netsnapshot.Heartbeat
+
+	blocks     map[uint32]propagation.Block
+	votes      map[string]propagation.Vote
+	deviations map[string][]propagation.SourceDeviation
+}
+
+// New returns an empty MemDb.
+func New() *MemDb {
+	db := new(MemDb)
+	db.reset()
+	return db
+}
+
+func (db *MemDb) reset() {
+	db.mempools = nil
+	db.mempoolTxs = make(map[string]mempool.MempoolTx)
+	db.pows = make(map[string]pow.PowData)
+	db.vsps, db.vspTicks = nil, nil
+	db.reddit, db.twitter, db.github, db.youtube = nil, nil, nil, nil
+	db.exchanges = nil
+	db.exchangeTicks = make(map[string]exchangeTick)
+	db.snapshots = make(map[int64]netsnapshot.SnapShot)
+	db.nodes = make(map[string]*nodeRecord)
+	db.heartbeats = make(map[string]netsnapshot.Heartbeat)
+	db.blocks = make(map[uint32]propagation.Block)
+	db.votes = make(map[string]propagation.Vote)
+	db.deviations = make(map[string][]propagation.SourceDeviation)
+}
+
+// CreateTables is a no-op, the tables always exist.
+func (db *MemDb) CreateTables(ctx context.Context) error {
+	return nil
+}
+
+// DropTables deletes all the records.
+func (db *MemDb) DropTables() error {
+	db.mtx.Lock()
+	defer db.mtx.Unlock()
+	db.reset()
+	return nil
+}
+
+// LastEntry reads the last entry of the table into receiver, a *time.Time, an
+// *int64 or an *int. Like the postgres LastEntry, it returns sql.ErrNoRows
+// when the table is empty.
+func (db *MemDb) LastEntry(ctx context.Context, tableName string, receiver interface{}) error {
+	db.mtx.RLock()
+	defer db.mtx.RUnlock()
+
+	var value interface{}
+	switch tableName {
+	case mempoolTable:
+		if n := len(db.mempools); n > 0 {
+			value = db.mempools[n-1].Time.UTC()
+		}
+	case exchangeTable:
+		if n := len(db.exchanges); n > 0 {
+			value = int64(db.exchanges[n-1].ID)
+		}
+	case redditTable:
+		if n := len(db.reddit); n > 0 {
+			value = db.reddit[n-1].Date
+		}
+	case twitterTable:
+		if n := len(db.twitter); n > 0 {
+			value = db.twitter[n-1].Date
+		}
+	case githubTable:
+		if n := len(db.github); n > 0 {
+			value = db.github[n-1].Date
+		}
+	case youtubeTable:
+		if n := len(db.youtube); n > 0 {
+			value = db.youtube[n-1].Date
+		}
+	case networkSnapshotTable:
+		if snapshots := db.sortedSnapshots(); len(snapshots) > 0 {
+			value = snapshots[len(snapshots)-1].Timestamp
+		}
+	default:
+		return fmt.Errorf("no last entry for table %s", tableName)
+	}
+	if value == nil {
+		return sql.ErrNoRows
+	}
+
+	switch r := receiver.(type) {
+	case *time.Time:
+		if v, ok := value.(time.Time); ok {
+			*r = v
+			return nil
+		}
+	case *int64:
+		if v, ok := value.(int64); ok {
+			*r = v
+			return nil
+		}
+	case *int:
+		if v, ok := value.(int64); ok {
+			*r = int(v)
+			return nil
+		}
+	}
+	return fmt.Errorf("cannot read the last %s entry into %T", tableName, receiver)
+}
+
+// page returns the bounds of the page of n records starting at offset. A
+// negative limit means no limit.
+func page(n, offset, limit int) (int, int) {
+	if offset > n {
+		offset = n
+	}
+	if offset < 0 {
+		offset = 0
+	}
+	end := n
+	if limit >= 0 && offset+limit < end {
+		end = offset + limit
+	}
+	return offset, end
+}
+
+// checkBin returns errBin unless bin is the default bin.
+func checkBin(bin string) error {
+	if bin != string(chart.DefaultBin) {
+		return errBin
+	}
+	return nil
+}
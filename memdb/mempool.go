@@ -0,0 +1,167 @@
+package memdb
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/planetdecred/pdanalytics/chart"
+	"github.com/planetdecred/pdanalytics/dbhelper"
+	"github.com/planetdecred/pdanalytics/mempool"
+)
+
+// The mempool chart data types.
+const (
+	MempoolSize     = "size"
+	MempoolFees     = "fees"
+	MempoolTxCount  = "tx-count"
+	MempoolFeeRates = "fee-rates"
+	MempoolLatency  = "confirmation-latency"
+)
+
+func (db *MemDb) MempoolTableName() string {
+	return mempoolTable
+}
+
+func (db *MemDb) StoreMempool(ctx context.Context, m mempool.Mempool) error {
+	db.mtx.Lock()
+	defer db.mtx.Unlock()
+	db.mempools = append(db.mempools, m)
+	return nil
+}
+
+// UpdateMempoolAggregateData is a no-op, only the default bin is served.
+func (db *MemDb) UpdateMempoolAggregateData(ctx context.Context) error {
+	return nil
+}
+
+// LastMempoolBlockHeight returns sql.ErrNoRows as the block height is not
+// kept with the mempool entries.
+func (db *MemDb) LastMempoolBlockHeight() (height int64, err error) {
+	return 0, sql.ErrNoRows
+}
+
+func (db *MemDb) LastMempoolTime() (entryTime time.Time, err error) {
+	err = db.LastEntry(context.Background(), mempoolTable, &entryTime)
+	return
+}
+
+func (db *MemDb) MempoolCount(ctx context.Context) (int64, error) {
+	db.mtx.RLock()
+	defer db.mtx.RUnlock()
+	return int64(len(db.mempools)), nil
+}
+
+func (db *MemDb) Mempools(ctx context.Context, offtset int, limit int) ([]mempool.Dto, error) {
+	db.mtx.RLock()
+	defer db.mtx.RUnlock()
+	start, end := page(len(db.mempools), offtset, limit)
+	var result []mempool.Dto
+	for i := start; i < end; i++ {
+		m := db.mempools[len(db.mempools)-1-i]
+		result = append(result, mempool.Dto{
+			TotalFee:             m.TotalFee,
+			FirstSeenTime:        m.FirstSeenTime.UTC().Format(dbhelper.DateTemplate),
+			Total:                m.Total,
+			Voters:               m.Voters,
+			Tickets:              m.Tickets,
+			Revocations:          m.Revocations,
+			Time:                 m.Time.UTC().Format(dbhelper.DateTemplate),
+			Size:                 m.Size,
+			NumberOfTransactions: m.NumberOfTransactions,
+		})
+	}
+	return result, nil
+}
+
+// StoreMempoolTxs stores the transactions that left the mempool, keeping the
+// first record of a transaction.
+func (db *MemDb) StoreMempoolTxs(ctx context.Context, txs []mempool.MempoolTx) error {
+	db.mtx.Lock()
+	defer db.mtx.Unlock()
+	for _, tx := range txs {
+		if _, found := db.mempoolTxs[tx.Hash]; !found {
+			db.mempoolTxs[tx.Hash] = tx
+		}
+	}
+	return nil
+}
+
+func (db *MemDb) ConfirmationLatency(ctx context.Context, since time.Time) ([]mempool.LatencyStats, error) {
+	db.mtx.RLock()
+	defer db.mtx.RUnlock()
+	var txs []mempool.MempoolTx
+	for _, tx := range db.mempoolTxs {
+		if !tx.Time.Before(since) {
+			txs = append(txs, tx)
+		}
+	}
+	return mempool.ConfirmationLatencyStats(txs), nil
+}
+
+func (db *MemDb) FetchEncodeChart(ctx context.Context, dataType, binString string) ([]byte, error) {
+	if err := checkBin(binString); err != nil {
+		return nil, err
+	}
+	db.mtx.RLock()
+	defer db.mtx.RUnlock()
+
+	if txType, ok := mempool.ParseTypeChart(dataType); ok {
+		var dates chart.ChartUints
+		var stats []mempool.TypeStats
+		for _, m := range db.mempools {
+			for _, t := range m.Types {
+				if t.Type == txType {
+					dates = append(dates, uint64(m.Time.Unix()))
+					stats = append(stats, t)
+					break
+				}
+			}
+		}
+		return mempool.EncodeTypeChart(dates, stats)
+	}
+
+	if dataType == MempoolLatency {
+		txs := make([]mempool.MempoolTx, 0, len(db.mempoolTxs))
+		for _, tx := range db.mempoolTxs {
+			txs = append(txs, tx)
+		}
+		return mempool.EncodeLatencyChart(mempool.MedianLatencies(txs, func(tx *mempool.MempoolTx) (int64, bool) {
+			return tx.Time.Unix(), true
+		}))
+	}
+
+	if dataType == MempoolFeeRates {
+		dates := make(chart.ChartUints, len(db.mempools))
+		rates := make([]mempool.FeeRates, len(db.mempools))
+		for i, m := range db.mempools {
+			dates[i] = uint64(m.Time.Unix())
+			rates[i] = m.FeeRates
+		}
+		return mempool.EncodeFeeRatesChart(dates, rates)
+	}
+
+	var dates, uints chart.ChartUints
+	var floats chart.ChartFloats
+	for _, m := range db.mempools {
+		dates = append(dates, uint64(m.Time.Unix()))
+		switch dataType {
+		case MempoolSize:
+			uints = append(uints, uint64(m.Size))
+		case MempoolFees:
+			floats = append(floats, m.TotalFee)
+		case MempoolTxCount:
+			uints = append(uints, uint64(m.NumberOfTransactions))
+		default:
+			return nil, chart.UnknownChartErr
+		}
+	}
+
+	switch dataType {
+	case MempoolFees:
+		return chart.Encode(nil, dates, floats)
+	case MempoolSize, MempoolTxCount:
+		return chart.Encode(nil, dates, uints)
+	}
+	return nil, chart.UnknownChartErr
+}
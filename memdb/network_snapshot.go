@@ -0,0 +1,617 @@
+package memdb
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+
+	"github.com/planetdecred/pdanalytics/netsnapshot"
+)
+
+// nodeRecord is a node and the failures of the connections to it.
+type nodeRecord struct {
+	netsnapshot.NetworkPeer
+	FailureCount int
+}
+
+func heartbeatKey(timestamp int64, address string) string {
+	return fmt.Sprintf("%020d:%s", timestamp, address)
+}
+
+// sortedSnapshots returns the snapshots in timestamp order. The caller must
+// hold the lock.
+func (db *MemDb) sortedSnapshots() []netsnapshot.SnapShot {
+	snapshots := make([]netsnapshot.SnapShot, 0, len(db.snapshots))
+	for _, s := range db.snapshots {
+		snapshots = append(snapshots, s)
+	}
+	sort.Slice(snapshots, func(i, j int) bool { return snapshots[i].Timestamp < snapshots[j].Timestamp })
+	return snapshots
+}
+
+// heartbeatsOf returns the heartbeats of the snapshot, in address order. The
+// caller must hold the lock.
+func (db *MemDb) heartbeatsOf(timestamp int64) []netsnapshot.Heartbeat {
+	var heartbeats []netsnapshot.Heartbeat
+	for _, h := range db.heartbeats {
+		if h.Timestamp == timestamp {
+			heartbeats = append(heartbeats, h)
+		}
+	}
+	sort.Slice(heartbeats, func(i, j int) bool { return heartbeats[i].Address < heartbeats[j].Address })
+	return heartbeats
+}
+
+// snapshotNodes returns the nodes with a heartbeat in the snapshot. The caller
+// must hold the lock.
+func (db *MemDb) snapshotNodes(timestamp int64) []netsnapshot.NetworkPeer {
+	var nodes []netsnapshot.NetworkPeer
+	for _, h := range db.heartbeatsOf(timestamp) {
+		if node, found := db.nodes[h.Address]; found {
+			nodes = append(nodes, node.NetworkPeer)
+		}
+	}
+	return nodes
+}
+
+// SaveSnapshot stores the snapshot with the reachable node count, the oldest
+// node and the average latency of its heartbeats.
+func (db *MemDb) SaveSnapshot(ctx context.Context, snapshot netsnapshot.SnapShot) error {
+	db.mtx.Lock()
+	defer db.mtx.Unlock()
+	heartbeats := db.heartbeatsOf(snapshot.Timestamp)
+	snapshot.ReachableNodeCount = len(heartbeats)
+	var totalLatency, latencyCount int
+	for _, h := range heartbeats {
+		if h.Latency > 0 {
+			totalLatency += h.Latency
+			latencyCount++
+		}
+		node, found := db.nodes[h.Address]
+		if !found || snapshot.OldestNodeTimestamp != 0 && node.ConnectionTime <= snapshot.OldestNodeTimestamp {
+			continue
+		}
+		snapshot.OldestNode = node.Address
+		snapshot.OldestNodeTimestamp = node.ConnectionTime
+	}
+	if latencyCount > 0 {
+		snapshot.Latency = totalLatency / latencyCount
+	}
+	db.snapshots[snapshot.Timestamp] = snapshot
+	return nil
+}
+
+func (db *MemDb) FindNetworkSnapshot(ctx context.Context, timestamp int64) (*netsnapshot.SnapShot, error) {
+	db.mtx.RLock()
+	defer db.mtx.RUnlock()
+	snapshot, found := db.snapshots[timestamp]
+	if !found {
+		return nil, sql.ErrNoRows
+	}
+	return &snapshot, nil
+}
+
+func (db *MemDb) PreviousSnapshot(ctx context.Context, timestamp int64) (*netsnapshot.SnapShot, error) {
+	db.mtx.RLock()
+	defer db.mtx.RUnlock()
+	snapshots := db.sortedSnapshots()
+	for i := len(snapshots) - 1; i >= 0; i-- {
+		if snapshots[i].Timestamp < timestamp {
+			return &snapshots[i], nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (db *MemDb) NextSnapshot(ctx context.Context, timestamp int64) (*netsnapshot.SnapShot, error) {
+	db.mtx.RLock()
+	defer db.mtx.RUnlock()
+	for _, s := range db.sortedSnapshots() {
+		if s.Timestamp > timestamp {
+			return &s, nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (db *MemDb) SnapshotCount(ctx context.Context) (int64, error) {
+	db.mtx.RLock()
+	defer db.mtx.RUnlock()
+	return int64(len(db.snapshots)), nil
+}
+
+// heightSnapshots returns the snapshots with a height after startDate, in
+// timestamp order. The caller must hold the lock.
+func (db *MemDb) heightSnapshots(startDate int64) []netsnapshot.SnapShot {
+	var snapshots []netsnapshot.SnapShot
+	for _, s := range db.sortedSnapshots() {
+		if s.Height > 0 && s.Timestamp > startDate {
+			snapshots = append(snapshots, s)
+		}
+	}
+	return snapshots
+}
+
+func (db *MemDb) Snapshots(ctx context.Context, offset, limit int, forChart bool) ([]netsnapshot.SnapShot, int64, error) {
+	db.mtx.RLock()
+	defer db.mtx.RUnlock()
+	snapshots := db.heightSnapshots(0)
+	total := int64(len(snapshots))
+	if forChart {
+		start, _ := page(len(snapshots), offset, -1)
+		return snapshots[start:], total, nil
+	}
+	start, end := page(len(snapshots), offset, limit)
+	var result []netsnapshot.SnapShot
+	for i := start; i < end; i++ {
+		result = append(result, snapshots[len(snapshots)-1-i])
+	}
+	return result, total, nil
+}
+
+func (db *MemDb) SnapshotsByTime(ctx context.Context, startDate int64, pageSize int) ([]netsnapshot.SnapShot, error) {
+	db.mtx.RLock()
+	defer db.mtx.RUnlock()
+	snapshots := db.heightSnapshots(startDate)
+	if pageSize > 0 && pageSize < len(snapshots) {
+		snapshots = snapshots[:pageSize]
+	}
+	return snapshots, nil
+}
+
+func (db *MemDb) SnapshotsByBin(ctx context.Context, bin string) ([]netsnapshot.SnapShot, error) {
+	if err := checkBin(bin); err != nil {
+		return nil, err
+	}
+	db.mtx.RLock()
+	defer db.mtx.RUnlock()
+	return db.sortedSnapshots(), nil
+}
+
+func (db *MemDb) DeleteSnapshot(ctx context.Context, timestamp int64) {
+	db.mtx.Lock()
+	defer db.mtx.Unlock()
+	for key, h := range db.heartbeats {
+		if h.Timestamp == timestamp {
+			delete(db.heartbeats, key)
+		}
+	}
+	delete(db.snapshots, timestamp)
+}
+
+// SaveHeartbeat stores the heartbeat, updating the non zero values of a
+// heartbeat already stored for the node in the snapshot.
+func (db *MemDb) SaveHeartbeat(ctx context.Context, heartbeat netsnapshot.Heartbeat) error {
+	db.mtx.Lock()
+	defer db.mtx.Unlock()
+	key := heartbeatKey(heartbeat.Timestamp, heartbeat.Address)
+	if stored, found := db.heartbeats[key]; found {
+		if heartbeat.CurrentHeight == 0 {
+			heartbeat.CurrentHeight = stored.CurrentHeight
+		}
+		if heartbeat.Latency == 0 {
+			heartbeat.Latency = stored.Latency
+		}
+		if heartbeat.LastSeen == 0 {
+			heartbeat.LastSeen = stored.LastSeen
+		}
+	}
+	db.heartbeats[key] = heartbeat
+	return nil
+}
+
+func (db *MemDb) AttemptPeer(ctx context.Context, address string, now int64) error {
+	db.mtx.Lock()
+	defer db.mtx.Unlock()
+	if node, found := db.nodes[address]; found {
+		node.LastAttempt = now
+	}
+	return nil
+}
+
+// RecordNodeConnectionFailure increase the number of failare for the specified node
+// and mark the node as dead if the maxAllowedFailure is reached
+func (db *MemDb) RecordNodeConnectionFailure(ctx context.Context, address string, maxAllowedFailure int) error {
+	db.mtx.Lock()
+	defer db.mtx.Unlock()
+	if node, found := db.nodes[address]; found {
+		node.FailureCount++
+		if node.FailureCount >= maxAllowedFailure {
+			node.IsDead = true
+		}
+	}
+	return nil
+}
+
+func (db *MemDb) NodeExists(ctx context.Context, address string) (bool, error) {
+	db.mtx.RLock()
+	defer db.mtx.RUnlock()
+	_, found := db.nodes[address]
+	return found, nil
+}
+
+func (db *MemDb) FindNode(ctx context.Context, address string) (*netsnapshot.NetworkPeer, error) {
+	return db.NetworkPeer(ctx, address)
+}
+
+func (db *MemDb) NetworkPeer(ctx context.Context, address string) (*netsnapshot.NetworkPeer, error) {
+	db.mtx.RLock()
+	defer db.mtx.RUnlock()
+	node, found := db.nodes[address]
+	if !found {
+		return nil, sql.ErrNoRows
+	}
+	peer := node.NetworkPeer
+	return &peer, nil
+}
+
+// SaveNode inserts the new node information. The node is marked as alive by default
+func (db *MemDb) SaveNode(ctx context.Context, peer netsnapshot.NetworkPeer) error {
+	db.mtx.Lock()
+	defer db.mtx.Unlock()
+	if _, found := db.nodes[peer.Address]; found {
+		return fmt.Errorf("node %s already exists", peer.Address)
+	}
+	peer.IsDead = false
+	db.nodes[peer.Address] = &nodeRecord{NetworkPeer: peer}
+	return nil
+}
+
+// UpdateNode updates the node information in the database
+//
+// It reset the node's failure count and marks it as alive
+func (db *MemDb) UpdateNode(ctx context.Context, peer netsnapshot.NetworkPeer) error {
+	db.mtx.Lock()
+	defer db.mtx.Unlock()
+	node, found := db.nodes[peer.Address]
+	if !found {
+		return fmt.Errorf("update failed: unknown node %s", peer.Address)
+	}
+	node.LastAttempt = peer.LastAttempt
+	node.LastSeen = peer.LastSeen
+	node.LastSuccess = peer.LastSuccess
+	node.Services = peer.Services
+	node.StartingHeight = peer.StartingHeight
+	node.UserAgent = peer.UserAgent
+	node.CurrentHeight = peer.CurrentHeight
+	node.IsDead = false
+	node.FailureCount = 0
+	if node.CountryName == "" {
+		node.IPInfo = peer.IPInfo
+		node.IPVersion = peer.IPVersion
+	}
+	if node.ConnectionTime == 0 {
+		node.ConnectionTime = peer.ConnectionTime
+	}
+	return nil
+}
+
+func (db *MemDb) NetworkPeers(ctx context.Context, timestamp int64, q string, offset int,
+	limit int) ([]netsnapshot.NetworkPeer, int64, error) {
+	db.mtx.RLock()
+	defer db.mtx.RUnlock()
+	var matches []netsnapshot.NetworkPeer
+	for _, node := range db.snapshotNodes(timestamp) {
+		if q == "" || node.Address == q || node.UserAgent == q || node.CountryName == q {
+			matches = append(matches, node)
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool { return matches[i].LastSeen > matches[j].LastSeen })
+	start, end := page(len(matches), offset, limit)
+	return matches[start:end], int64(len(matches)), nil
+}
+
+func (db *MemDb) GetAvailableNodes(ctx context.Context) ([]net.IP, error) {
+	db.mtx.RLock()
+	defer db.mtx.RUnlock()
+	var peers []net.IP
+	for _, node := range db.nodes {
+		if !node.IsDead {
+			peers = append(peers, net.ParseIP(node.Address))
+		}
+	}
+	return peers, nil
+}
+
+func (db *MemDb) AverageLatency(ctx context.Context, address string) (int, error) {
+	db.mtx.RLock()
+	defer db.mtx.RUnlock()
+	var total, count int
+	for _, h := range db.heartbeats {
+		if h.Address == address && h.Latency > 0 {
+			total += h.Latency
+			count++
+		}
+	}
+	if count == 0 {
+		return 0, nil
+	}
+	return total / count, nil
+}
+
+func (db *MemDb) GetIPLocation(ctx context.Context, ip string) (string, int, error) {
+	node, err := db.NetworkPeer(ctx, ip)
+	if err != nil {
+		return "", -1, err
+	}
+	return node.CountryName, node.IPVersion, nil
+}
+
+func (db *MemDb) TotalPeerCount(ctx context.Context, timestamp int64) (int64, error) {
+	db.mtx.RLock()
+	defer db.mtx.RUnlock()
+	return int64(len(db.heartbeatsOf(timestamp))), nil
+}
+
+func (db *MemDb) SeenNodesByTimestamp(ctx context.Context) ([]netsnapshot.NodeCount, error) {
+	db.mtx.RLock()
+	defer db.mtx.RUnlock()
+	counts := make(map[int64]int64)
+	for _, h := range db.heartbeats {
+		counts[h.Timestamp]++
+	}
+	result := make([]netsnapshot.NodeCount, 0, len(counts))
+	for timestamp, count := range counts {
+		result = append(result, netsnapshot.NodeCount{Timestamp: timestamp, Count: count})
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Timestamp < result[j].Timestamp })
+	return result, nil
+}
+
+// nodeGroup is the number of nodes of a snapshot sharing a value, the user
+// agent or the country.
+type nodeGroup struct {
+	timestamp int64
+	height    int64
+	value     string
+	nodes     int64
+}
+
+// nodeGroups groups the nodes of the snapshots by the value returned by key,
+// ordered by timestamp then by node count. Only the values in sources are
+// counted when sources is not empty, "Unknown" being the empty value. The
+// caller must hold the lock.
+func (db *MemDb) nodeGroups(key func(*netsnapshot.NetworkPeer) string, sources ...string) []nodeGroup {
+	var wanted map[string]bool
+	if len(sources) > 0 {
+		wanted = make(map[string]bool, len(sources))
+		for _, source := range sources {
+			wanted[strings.ReplaceAll(source, "Unknown", "")] = true
+		}
+	}
+
+	var groups []nodeGroup
+	for _, snapshot := range db.sortedSnapshots() {
+		nodes := db.snapshotNodes(snapshot.Timestamp)
+		counts := make(map[string]int64)
+		for i := range nodes {
+			value := key(&nodes[i])
+			if wanted == nil || wanted[value] {
+				counts[value]++
+			}
+		}
+		first := len(groups)
+		for value, count := range counts {
+			groups = append(groups, nodeGroup{
+				timestamp: snapshot.Timestamp,
+				height:    snapshot.Height,
+				value:     value,
+				nodes:     count,
+			})
+		}
+		snapshotGroups := groups[first:]
+		sort.Slice(snapshotGroups, func(i, j int) bool {
+			if snapshotGroups[i].nodes != snapshotGroups[j].nodes {
+				return snapshotGroups[i].nodes > snapshotGroups[j].nodes
+			}
+			return snapshotGroups[i].value < snapshotGroups[j].value
+		})
+	}
+	return groups
+}
+
+func userAgent(n *netsnapshot.NetworkPeer) string { return n.UserAgent }
+
+func country(n *netsnapshot.NetworkPeer) string { return n.CountryName }
+
+// splitSources splits the "|" separated sources.
+func splitSources(sources string) []string {
+	if sources == "" {
+		return nil
+	}
+	return strings.Split(sources, "|")
+}
+
+func unknownIfEmpty(value string) string {
+	if strings.TrimSpace(value) == "" {
+		return "Unknown"
+	}
+	return value
+}
+
+func (db *MemDb) PeerCountByUserAgents(ctx context.Context, sources string, offset, limit int) ([]netsnapshot.UserAgentInfo, int64, error) {
+	db.mtx.RLock()
+	defer db.mtx.RUnlock()
+	groups := db.nodeGroups(userAgent, splitSources(sources)...)
+	start, end := page(len(groups), offset, limit)
+	userAgents := make([]netsnapshot.UserAgentInfo, 0, end-start)
+	for _, g := range groups[start:end] {
+		userAgents = append(userAgents, netsnapshot.UserAgentInfo{
+			UserAgent: unknownIfEmpty(g.value),
+			Nodes:     g.nodes,
+			Timestamp: g.timestamp,
+		})
+	}
+	return userAgents, int64(len(groups)), nil
+}
+
+func (db *MemDb) PeerCountByCountries(ctx context.Context, sources string, offset, limit int) ([]netsnapshot.CountryInfo, int64, error) {
+	db.mtx.RLock()
+	defer db.mtx.RUnlock()
+	groups := db.nodeGroups(country, splitSources(sources)...)
+	start, end := page(len(groups), offset, limit)
+	countries := make([]netsnapshot.CountryInfo, 0, end-start)
+	for _, g := range groups[start:end] {
+		countries = append(countries, netsnapshot.CountryInfo{
+			Country:   unknownIfEmpty(g.value),
+			Nodes:     g.nodes,
+			Timestamp: g.timestamp,
+		})
+	}
+	return countries, int64(len(groups)), nil
+}
+
+func (db *MemDb) PeerCountByIPVersion(ctx context.Context, timestamp int64, iPVersion int) (int64, error) {
+	db.mtx.RLock()
+	defer db.mtx.RUnlock()
+	var total int64
+	for _, node := range db.snapshotNodes(timestamp) {
+		if node.IPVersion == iPVersion {
+			total++
+		}
+	}
+	return total, nil
+}
+
+func (db *MemDb) LastSnapshotTime(ctx context.Context) (timestamp int64) {
+	db.mtx.RLock()
+	defer db.mtx.RUnlock()
+	if snapshots := db.heightSnapshots(0); len(snapshots) > 0 {
+		timestamp = snapshots[len(snapshots)-1].Timestamp
+	}
+	return
+}
+
+func (db *MemDb) LastSnapshot(ctx context.Context) (*netsnapshot.SnapShot, error) {
+	return db.FindNetworkSnapshot(ctx, db.LastSnapshotTime(ctx))
+}
+
+// distinctNodeValues returns the distinct values of the nodes returned by
+// key, in ascending order.
+func (db *MemDb) distinctNodeValues(key func(*netsnapshot.NetworkPeer) string) []string {
+	db.mtx.RLock()
+	defer db.mtx.RUnlock()
+	seen := make(map[string]bool)
+	var values []string
+	for _, node := range db.nodes {
+		if value := key(&node.NetworkPeer); !seen[value] {
+			seen[value] = true
+			values = append(values, value)
+		}
+	}
+	sort.Strings(values)
+	return values
+}
+
+func (db *MemDb) AllNodeVersions(ctx context.Context) ([]string, error) {
+	versions := db.distinctNodeValues(userAgent)
+	sort.Sort(sort.Reverse(sort.StringSlice(versions)))
+	return versions, nil
+}
+
+func (db *MemDb) AllNodeContries(ctx context.Context) ([]string, error) {
+	return db.distinctNodeValues(country), nil
+}
+
+// UpdateSnapshotNodesBin is a no-op, the node versions and locations are
+// counted on read.
+func (db *MemDb) UpdateSnapshotNodesBin(ctx context.Context) error {
+	return nil
+}
+
+// nodeCounts returns the number of nodes of every snapshot having the value
+// returned by key, including the snapshots without such node. The caller must
+// hold the lock.
+func (db *MemDb) nodeCounts(value string, key func(*netsnapshot.NetworkPeer) string) []nodeGroup {
+	var counts []nodeGroup
+	for _, snapshot := range db.sortedSnapshots() {
+		g := nodeGroup{timestamp: snapshot.Timestamp, height: snapshot.Height, value: value}
+		for _, node := range db.snapshotNodes(snapshot.Timestamp) {
+			if key(&node) == value {
+				g.nodes++
+			}
+		}
+		counts = append(counts, g)
+	}
+	return counts
+}
+
+func (db *MemDb) NodeVersionsByBin(ctx context.Context, userAgentName, bin string) ([]netsnapshot.UserAgentInfo, error) {
+	if err := checkBin(bin); err != nil {
+		return nil, err
+	}
+	db.mtx.RLock()
+	defer db.mtx.RUnlock()
+	var result []netsnapshot.UserAgentInfo
+	for _, c := range db.nodeCounts(userAgentName, userAgent) {
+		result = append(result, netsnapshot.UserAgentInfo{
+			Nodes:     c.nodes,
+			Timestamp: c.timestamp,
+			Height:    c.height,
+			UserAgent: userAgentName,
+		})
+	}
+	return result, nil
+}
+
+func (db *MemDb) NodeLocationsByBin(ctx context.Context, countryName, bin string) ([]netsnapshot.CountryInfo, error) {
+	if err := checkBin(bin); err != nil {
+		return nil, err
+	}
+	db.mtx.RLock()
+	defer db.mtx.RUnlock()
+	var result []netsnapshot.CountryInfo
+	for _, c := range db.nodeCounts(countryName, country) {
+		result = append(result, netsnapshot.CountryInfo{
+			Nodes:     c.nodes,
+			Timestamp: c.timestamp,
+			Height:    c.height,
+			Country:   countryName,
+		})
+	}
+	return result, nil
+}
+
+// recentNodeGroups returns a page of the groups of the snapshots, the most
+// recent first, and the number of groups. The caller must hold the lock.
+func (db *MemDb) recentNodeGroups(key func(*netsnapshot.NetworkPeer) string, offset, limit int) ([]nodeGroup, int64) {
+	groups := db.nodeGroups(key)
+	sort.SliceStable(groups, func(i, j int) bool { return groups[i].timestamp > groups[j].timestamp })
+	start, end := page(len(groups), offset, limit)
+	return groups[start:end], int64(len(groups))
+}
+
+func (db *MemDb) FetchNodeLocations(ctx context.Context, offset, limit int) ([]netsnapshot.CountryInfo, int64, error) {
+	db.mtx.RLock()
+	defer db.mtx.RUnlock()
+	groups, total := db.recentNodeGroups(country, offset, limit)
+	result := make([]netsnapshot.CountryInfo, len(groups))
+	for i, g := range groups {
+		result[i] = netsnapshot.CountryInfo{
+			Country:   g.value,
+			Height:    g.height,
+			Timestamp: g.timestamp,
+			Nodes:     g.nodes,
+		}
+	}
+	return result, total, nil
+}
+
+func (db *MemDb) FetchNodeVersion(ctx context.Context, offset, limit int) ([]netsnapshot.UserAgentInfo, int64, error) {
+	db.mtx.RLock()
+	defer db.mtx.RUnlock()
+	groups, total := db.recentNodeGroups(userAgent, offset, limit)
+	result := make([]netsnapshot.UserAgentInfo, len(groups))
+	for i, g := range groups {
+		result[i] = netsnapshot.UserAgentInfo{
+			UserAgent: g.value,
+			Height:    g.height,
+			Timestamp: g.timestamp,
+			Nodes:     g.nodes,
+		}
+	}
+	return result, total, nil
+}
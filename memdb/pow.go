@@ -0,0 +1,222 @@
+package memdb
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/planetdecred/pdanalytics/app/helpers"
+	"github.com/planetdecred/pdanalytics/chart"
+	"github.com/planetdecred/pdanalytics/pow"
+)
+
+func powDto(d pow.PowData) pow.PowDataDto {
+	return pow.PowDataDto{
+		Time:           helpers.UnixTime(d.Time).Format(dateTemplate),
+		PoolHashrateTh: fmt.Sprintf("%.0f", d.PoolHashrate/pow.Thash),
+		Workers:        d.Workers,
+		Source:         d.Source,
+		CoinPrice:      d.CoinPrice,
+		BtcPrice:       d.BtcPrice,
+	}
+}
+
+func (db *MemDb) PowTableName() string {
+	return powDataTable
+}
+
+// AddPowData stores the entries, replacing the stored entry of the same
+// source and time.
+func (db *MemDb) AddPowData(ctx context.Context, data []pow.PowData) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	db.mtx.Lock()
+	defer db.mtx.Unlock()
+	for _, d := range data {
+		db.pows[fmt.Sprintf("%s:%020d", d.Source, d.Time)] = d
+	}
+	return nil
+}
+
+// powData returns the entries of the sources, or of all the sources when none
+// is given, ordered by time then source. The caller must hold the lock.
+func (db *MemDb) powData(sources ...string) []pow.PowData {
+	wanted := make(map[string]bool, len(sources))
+	for _, source := range sources {
+		wanted[source] = true
+	}
+	var data []pow.PowData
+	for _, d := range db.pows {
+		if len(sources) == 0 || wanted[d.Source] {
+			data = append(data, d)
+		}
+	}
+	sort.Slice(data, func(i, j int) bool {
+		if data[i].Time != data[j].Time {
+			return data[i].Time < data[j].Time
+		}
+		return data[i].Source < data[j].Source
+	})
+	return data
+}
+
+func (db *MemDb) LastPowEntryTime(source string) (time int64) {
+	db.mtx.RLock()
+	defer db.mtx.RUnlock()
+	var data []pow.PowData
+	if source == "" {
+		data = db.powData()
+	} else {
+		data = db.powData(source)
+	}
+	if len(data) > 0 {
+		time = data[len(data)-1].Time
+	}
+	return
+}
+
+// UpdatePowChart is a no-op, only the default bin is served.
+func (db *MemDb) UpdatePowChart(ctx context.Context) error {
+	return nil
+}
+
+func (db *MemDb) PowCount(ctx context.Context) (int64, error) {
+	db.mtx.RLock()
+	defer db.mtx.RUnlock()
+	return int64(len(db.pows)), nil
+}
+
+// powPage returns a page of the entries of the sources, the most recent
+// first, and the number of entries.
+func (db *MemDb) powPage(offset, limit int, sources ...string) ([]pow.PowDataDto, int64) {
+	db.mtx.RLock()
+	defer db.mtx.RUnlock()
+	data := db.powData(sources...)
+	start, end := page(len(data), offset, limit)
+	var result []pow.PowDataDto
+	for i := start; i < end; i++ {
+		result = append(result, powDto(data[len(data)-1-i]))
+	}
+	return result, int64(len(data))
+}
+
+func (db *MemDb) FetchPowData(ctx context.Context, offset, limit int) ([]pow.PowDataDto, int64, error) {
+	result, total := db.powPage(offset, limit)
+	return result, total, nil
+}
+
+func (db *MemDb) FetchPowDataBySource(ctx context.Context, source string, offset, limit int) ([]pow.PowDataDto, int64, error) {
+	result, total := db.powPage(offset, limit, source)
+	return result, total, nil
+}
+
+func (db *MemDb) FetchPowDataForSync(ctx context.Context, date int64, skip, take int) ([]pow.PowData, int64, error) {
+	db.mtx.RLock()
+	defer db.mtx.RUnlock()
+	var data []pow.PowData
+	for _, d := range db.powData() {
+		if d.Time > date {
+			data = append(data, d)
+		}
+	}
+	start, end := page(len(data), skip, take)
+	return data[start:end], int64(len(data)), nil
+}
+
+func (db *MemDb) FetchPowSourceData(ctx context.Context) ([]pow.PowDataSource, error) {
+	db.mtx.RLock()
+	defer db.mtx.RUnlock()
+	seen := make(map[string]bool)
+	var result []pow.PowDataSource
+	for _, d := range db.pows {
+		if !seen[d.Source] {
+			seen[d.Source] = true
+			result = append(result, pow.PowDataSource{Source: d.Source})
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Source < result[j].Source })
+	return result, nil
+}
+
+func (db *MemDb) GetPowDistinctDates(ctx context.Context, sources []string) ([]time.Time, error) {
+	db.mtx.RLock()
+	defer db.mtx.RUnlock()
+	data := db.powData(sources...)
+	var dates []time.Time
+	for i, d := range data {
+		if i == 0 || d.Time != data[i-1].Time {
+			dates = append(dates, helpers.UnixTime(d.Time).UTC())
+		}
+	}
+	return dates, nil
+}
+
+func (db *MemDb) FetchPowChartData(ctx context.Context, source string, dataType string) ([]pow.PowChartData, error) {
+	var value func(d pow.PowData) string
+	switch strings.ToLower(dataType) {
+	case "pool_hashrate":
+		value = func(d pow.PowData) string { return fmt.Sprintf("%.0f", d.PoolHashrate/pow.Thash) }
+	case "workers":
+		value = func(d pow.PowData) string { return fmt.Sprint(d.Workers) }
+	case "coin_price":
+		value = func(d pow.PowData) string { return fmt.Sprint(d.CoinPrice) }
+	case "btc_price":
+		value = func(d pow.PowData) string { return fmt.Sprint(d.BtcPrice) }
+	default:
+		return nil, fmt.Errorf("unknown PoW data type %s", dataType)
+	}
+
+	db.mtx.RLock()
+	defer db.mtx.RUnlock()
+	var result []pow.PowChartData
+	for _, d := range db.powData(source) {
+		result = append(result, pow.PowChartData{
+			Date:   helpers.UnixTime(d.Time),
+			Record: value(d),
+		})
+	}
+	return result, nil
+}
+
+// FetchEncodePowChart encodes the chart of the pools with the dates of all
+// the sources, like the postgres one.
+func (db *MemDb) FetchEncodePowChart(ctx context.Context, dataType,
+	binString string, pools ...string) ([]byte, error) {
+	var value func(d pow.PowData) float64
+	switch strings.ToLower(dataType) {
+	case string(chart.WorkerAxis):
+		value = func(d pow.PowData) float64 { return float64(d.Workers) }
+	case string(chart.HashrateAxis):
+		value = func(d pow.PowData) float64 { return math.Round(d.PoolHashrate / pow.Thash) }
+	default:
+		return nil, chart.UnknownChartErr
+	}
+	if err := checkBin(binString); err != nil {
+		return nil, err
+	}
+
+	db.mtx.RLock()
+	defer db.mtx.RUnlock()
+	allDates := make(map[uint64]float64)
+	values := make(map[string]map[uint64]float64, len(pools))
+	for _, p := range pools {
+		values[p] = make(map[uint64]float64)
+	}
+	for _, d := range db.powData() {
+		allDates[uint64(d.Time)] = 0
+		if set, found := values[d.Source]; found {
+			set[uint64(d.Time)] = value(d)
+		}
+	}
+
+	dates := sortedDates(allDates)
+	var deviations []chart.ChartNullUints
+	for _, p := range pools {
+		deviations = append(deviations, nullUints(dates, values[p]))
+	}
+	return chart.MakePowChart(dates, deviations, pools)
+}
@@ -0,0 +1,350 @@
+package memdb
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/planetdecred/pdanalytics/dbhelper"
+	"github.com/planetdecred/pdanalytics/propagation"
+)
+
+func blockDto(b propagation.Block) propagation.BlockDto {
+	return propagation.BlockDto{
+		BlockHash:         b.BlockHash,
+		BlockHeight:       b.BlockHeight,
+		BlockInternalTime: b.BlockInternalTime.Format(dbhelper.DateTemplate),
+		BlockReceiveTime:  b.BlockReceiveTime.Format(dbhelper.DateTemplate),
+		Delay:             fmt.Sprintf("%04.2f", b.BlockReceiveTime.Sub(b.BlockInternalTime).Seconds()),
+	}
+}
+
+func voteDto(v propagation.Vote) propagation.VoteDto {
+	var shortBlockHash string
+	if len(v.BlockHash) > 0 {
+		shortBlockHash = v.BlockHash[len(v.BlockHash)-8:]
+	}
+	return propagation.VoteDto{
+		Hash:                  v.Hash,
+		ReceiveTime:           v.ReceiveTime.Format(dbhelper.DateTemplate),
+		TargetedBlockTimeDiff: fmt.Sprintf("%04.2f", v.ReceiveTime.Sub(v.TargetedBlockTime).Seconds()),
+		BlockReceiveTimeDiff:  fmt.Sprintf("%04.2f", v.ReceiveTime.Sub(v.BlockReceiveTime).Seconds()),
+		VotingOn:              v.VotingOn,
+		BlockHash:             v.BlockHash,
+		ShortBlockHash:        shortBlockHash,
+		ValidatorId:           v.ValidatorId,
+		Validity:              v.Validity,
+	}
+}
+
+func (db *MemDb) BlockTableName() string {
+	return blockTable
+}
+
+func (db *MemDb) VoteTableName() string {
+	return voteTable
+}
+
+// SaveBlock stores the block, ignoring a block already stored at its height,
+// and sets the block of the votes stored for it.
+func (db *MemDb) SaveBlock(ctx context.Context, block propagation.Block) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	db.mtx.Lock()
+	defer db.mtx.Unlock()
+	if _, found := db.blocks[block.BlockHeight]; !found {
+		db.blocks[block.BlockHeight] = block
+	}
+	for hash, vote := range db.votes {
+		if vote.VotingOn == int64(block.BlockHeight) {
+			vote.BlockReceiveTime = block.BlockReceiveTime
+			vote.BlockHash = block.BlockHash
+			db.votes[hash] = vote
+		}
+	}
+	return nil
+}
+
+func (db *MemDb) BlockCount(ctx context.Context) (int64, error) {
+	db.mtx.RLock()
+	defer db.mtx.RUnlock()
+	return int64(len(db.blocks)), nil
+}
+
+// blockPage returns a page of the blocks, the last received first. The caller
+// must hold the lock.
+func (db *MemDb) blockPage(offset, limit int) []propagation.Block {
+	blocks := make([]propagation.Block, 0, len(db.blocks))
+	for _, b := range db.blocks {
+		blocks = append(blocks, b)
+	}
+	sort.Slice(blocks, func(i, j int) bool {
+		if !blocks[i].BlockReceiveTime.Equal(blocks[j].BlockReceiveTime) {
+			return blocks[i].BlockReceiveTime.After(blocks[j].BlockReceiveTime)
+		}
+		return blocks[i].BlockHeight > blocks[j].BlockHeight
+	})
+	start, end := page(len(blocks), offset, limit)
+	return blocks[start:end]
+}
+
+func (db *MemDb) Blocks(ctx context.Context, offset int, limit int) ([]propagation.BlockDto, error) {
+	db.mtx.RLock()
+	defer db.mtx.RUnlock()
+	var blocks []propagation.BlockDto
+	for _, b := range db.blockPage(offset, limit) {
+		block := blockDto(b)
+		for _, v := range db.sortedVotes(func(v propagation.Vote) bool { return v.VotingOn == int64(b.BlockHeight) }) {
+			block.Votes = append(block.Votes, voteDto(v))
+		}
+		blocks = append(blocks, block)
+	}
+	return blocks, nil
+}
+
+func (db *MemDb) BlocksWithoutVotes(ctx context.Context, offset int, limit int) ([]propagation.BlockDto, error) {
+	db.mtx.RLock()
+	defer db.mtx.RUnlock()
+	var blocks []propagation.BlockDto
+	for _, b := range db.blockPage(offset, limit) {
+		blocks = append(blocks, blockDto(b))
+	}
+	return blocks, nil
+}
+
+// SaveVote stores the vote with the receive time of its block when it is
+// stored, ignoring a vote already stored.
+func (db *MemDb) SaveVote(ctx context.Context, vote propagation.Vote) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	db.mtx.Lock()
+	defer db.mtx.Unlock()
+	if _, found := db.votes[vote.Hash]; found {
+		return nil
+	}
+	if block, found := db.blocks[uint32(vote.VotingOn)]; found {
+		vote.BlockReceiveTime = block.BlockReceiveTime
+	}
+	db.votes[vote.Hash] = vote
+	return nil
+}
+
+// sortedVotes returns the votes matching the filter, the first received first.
+// The caller must hold the lock.
+func (db *MemDb) sortedVotes(filter func(propagation.Vote) bool) []propagation.Vote {
+	var votes []propagation.Vote
+	for _, v := range db.votes {
+		if filter(v) {
+			votes = append(votes, v)
+		}
+	}
+	sort.Slice(votes, func(i, j int) bool {
+		if !votes[i].ReceiveTime.Equal(votes[j].ReceiveTime) {
+			return votes[i].ReceiveTime.Before(votes[j].ReceiveTime)
+		}
+		return votes[i].Hash < votes[j].Hash
+	})
+	return votes
+}
+
+// votePage returns a page of the votes matching the filter, the last received
+// first.
+func (db *MemDb) votePage(offset, limit int, filter func(propagation.Vote) bool) []propagation.VoteDto {
+	db.mtx.RLock()
+	defer db.mtx.RUnlock()
+	votes := db.sortedVotes(filter)
+	start, end := page(len(votes), offset, limit)
+	result := make([]propagation.VoteDto, 0, end-start)
+	for i := start; i < end; i++ {
+		result = append(result, voteDto(votes[len(votes)-1-i]))
+	}
+	return result
+}
+
+func (db *MemDb) Votes(ctx context.Context, offset int, limit int) ([]propagation.VoteDto, error) {
+	return db.votePage(offset, limit, func(propagation.Vote) bool { return true }), nil
+}
+
+func (db *MemDb) VotesByBlock(ctx context.Context, blockHash string) ([]propagation.VoteDto, error) {
+	return db.votePage(0, -1, func(v propagation.Vote) bool { return v.BlockHash == blockHash }), nil
+}
+
+func (db *MemDb) VotesCount(ctx context.Context) (int64, error) {
+	db.mtx.RLock()
+	defer db.mtx.RUnlock()
+	return int64(len(db.votes)), nil
+}
+
+func (db *MemDb) VotesBlockReceiveTimeDiffs(ctx context.Context) ([]propagation.PropagationChartData, error) {
+	db.mtx.RLock()
+	defer db.mtx.RUnlock()
+	votes := db.sortedVotes(func(propagation.Vote) bool { return true })
+	sort.SliceStable(votes, func(i, j int) bool { return votes[i].VotingOn < votes[j].VotingOn })
+	chartData := make([]propagation.PropagationChartData, len(votes))
+	for i, v := range votes {
+		chartData[i] = propagation.PropagationChartData{
+			BlockHeight:    v.VotingOn,
+			TimeDifference: v.ReceiveTime.Sub(v.BlockReceiveTime).Seconds(),
+		}
+	}
+	return chartData, nil
+}
+
+// BlockDelays returns the delays of the blocks above height, ordered by
+// height.
+func (db *MemDb) BlockDelays(ctx context.Context, height int) ([]propagation.PropagationChartData, error) {
+	db.mtx.RLock()
+	defer db.mtx.RUnlock()
+	var chartData []propagation.PropagationChartData
+	for _, b := range db.blocks {
+		if int64(b.BlockHeight) > int64(height) {
+			chartData = append(chartData, propagation.PropagationChartData{
+				BlockHeight:    int64(b.BlockHeight),
+				TimeDifference: b.BlockReceiveTime.Sub(b.BlockInternalTime).Seconds(),
+				BlockTime:      b.BlockInternalTime,
+			})
+		}
+	}
+	sort.Slice(chartData, func(i, j int) bool { return chartData[i].BlockHeight < chartData[j].BlockHeight })
+	return chartData, nil
+}
+
+// UpdatePropagationDataForSource computes and store the difference
+// in block receive time of this instance and provided source
+// for all the blocks received since the last update of the source
+func (db *MemDb) UpdatePropagationDataForSource(ctx context.Context, source string, sourceDB propagation.Store) error {
+	db.mtx.RLock()
+	var lastHeight int64
+	if deviations := db.deviations[source]; len(deviations) > 0 {
+		lastHeight = deviations[len(deviations)-1].Height
+	}
+	db.mtx.RUnlock()
+
+	mainBlockDelays, err := db.BlockDelays(ctx, int(lastHeight))
+	if err != nil {
+		return err
+	}
+	blockDelays, err := sourceDB.BlockDelays(ctx, int(lastHeight))
+	if err != nil {
+		return err
+	}
+	receiveTimeMap := make(map[int64]float64)
+	for _, record := range blockDelays {
+		receiveTimeMap[record.BlockHeight], _ = strconv.ParseFloat(fmt.Sprintf("%04.2f", record.TimeDifference), 64)
+	}
+
+	db.mtx.Lock()
+	defer db.mtx.Unlock()
+	for _, rec := range mainBlockDelays {
+		deviation := propagation.SourceDeviation{
+			Height: rec.BlockHeight,
+			Time:   rec.BlockTime.Unix(),
+		}
+		if sourceTime, found := receiveTimeMap[rec.BlockHeight]; found {
+			localTime, _ := strconv.ParseFloat(fmt.Sprintf("%04.2f", rec.TimeDifference), 64)
+			deviation.Deviation = localTime - sourceTime
+		}
+		db.deviations[source] = append(db.deviations[source], deviation)
+	}
+	return nil
+}
+
+// UpdatePropagationBinsForSource is a no-op, only the default bin is served.
+func (db *MemDb) UpdatePropagationBinsForSource(ctx context.Context, source string) error {
+	return nil
+}
+
+// UpdateBlockBinData is a no-op, only the default bin is served.
+func (db *MemDb) UpdateBlockBinData(ctx context.Context) error {
+	return nil
+}
+
+// UpdateVoteTimeDeviationData is a no-op, only the default bin is served.
+func (db *MemDb) UpdateVoteTimeDeviationData(ctx context.Context) error {
+	return nil
+}
+
+func (db *MemDb) SourceDeviations(ctx context.Context, source, bin string) ([]propagation.SourceDeviation, error) {
+	if err := checkBin(bin); err != nil {
+		return nil, err
+	}
+	db.mtx.RLock()
+	defer db.mtx.RUnlock()
+	return append([]propagation.SourceDeviation(nil), db.deviations[source]...), nil
+}
+
+// BlockBinData returns an entry per block, ordered by block time, as the
+// records are not aggregated.
+func (db *MemDb) BlockBinData(ctx context.Context, bin string) ([]propagation.BlockBinDto, error) {
+	if err := checkBin(bin); err != nil {
+		return nil, err
+	}
+	delays, err := db.BlockDelays(ctx, 0)
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(delays, func(i, j int) bool { return delays[i].BlockTime.Before(delays[j].BlockTime) })
+	records := make([]propagation.BlockBinDto, len(delays))
+	for i, d := range delays {
+		records[i] = propagation.BlockBinDto{
+			Height:            d.BlockHeight,
+			ReceiveTimeDiff:   d.TimeDifference,
+			InternalTimestamp: d.BlockTime.Unix(),
+		}
+	}
+	return records, nil
+}
+
+// VoteReceiveTimeDeviations returns an entry per vote received after its
+// block, ordered by targeted block time, as the records are not aggregated.
+func (db *MemDb) VoteReceiveTimeDeviations(ctx context.Context, bin string) ([]propagation.VoteReceiveTimeDeviation, error) {
+	if err := checkBin(bin); err != nil {
+		return nil, err
+	}
+	db.mtx.RLock()
+	defer db.mtx.RUnlock()
+	votes := db.sortedVotes(func(v propagation.Vote) bool { return !v.BlockReceiveTime.IsZero() })
+	sort.SliceStable(votes, func(i, j int) bool { return votes[i].TargetedBlockTime.Before(votes[j].TargetedBlockTime) })
+	result := make([]propagation.VoteReceiveTimeDeviation, len(votes))
+	for i, v := range votes {
+		result[i] = propagation.VoteReceiveTimeDeviation{
+			BlockHeight:           v.VotingOn,
+			BlockTime:             v.TargetedBlockTime.Unix(),
+			ReceiveTimeDifference: v.ReceiveTime.Sub(v.BlockReceiveTime).Seconds(),
+		}
+	}
+	return result, nil
+}
+
+// RollbackBlocks deletes the blocks above the given height together with the
+// votes and the propagation data derived from them.
+func (db *MemDb) RollbackBlocks(ctx context.Context, height uint32) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	db.mtx.Lock()
+	defer db.mtx.Unlock()
+	for hash, v := range db.votes {
+		if v.VotingOn > int64(height) {
+			delete(db.votes, hash)
+		}
+	}
+	for h := range db.blocks {
+		if h > height {
+			delete(db.blocks, h)
+		}
+	}
+	for source, deviations := range db.deviations {
+		kept := deviations[:0]
+		for _, d := range deviations {
+			if d.Height <= int64(height) {
+				kept = append(kept, d)
+			}
+		}
+		db.deviations[source] = kept
+	}
+	return nil
+}
@@ -0,0 +1,269 @@
+package memdb
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/planetdecred/pdanalytics/app/helpers"
+	"github.com/planetdecred/pdanalytics/chart"
+	"github.com/planetdecred/pdanalytics/vsp"
+)
+
+type vspRecord struct {
+	ID   int
+	Name string
+	vsp.ResposeData
+}
+
+type vspTickRecord struct {
+	ID    int
+	VSPID int
+	vsp.ResposeData
+}
+
+func (t *vspTickRecord) toDto(vspName string) vsp.VSPTickDto {
+	return vsp.VSPTickDto{
+		ID:               t.ID,
+		VSP:              vspName,
+		Time:             helpers.UnixTime(t.LastUpdated).Format(dateTemplate),
+		Immature:         t.Immature,
+		Live:             t.Live,
+		Missed:           t.Missed,
+		PoolFees:         t.PoolFees,
+		ProportionLive:   roundValue(t.ProportionLive),
+		ProportionMissed: roundValue(t.ProportionMissed),
+		UserCount:        t.UserCount,
+		UsersActive:      t.UserCountActive,
+		Voted:            t.Voted,
+	}
+}
+
+func (db *MemDb) VspTableName() string {
+	return vspTable
+}
+
+func (db *MemDb) VspTickTableName() string {
+	return vspTickTable
+}
+
+// StoreVSPs stores the vsp responses, creating the missing VSPs, and returns
+// the number of ticks stored. The ticks already stored are skipped.
+func (db *MemDb) StoreVSPs(ctx context.Context, data vsp.Response) (int, []error) {
+	if ctx.Err() != nil {
+		return 0, []error{ctx.Err()}
+	}
+	db.mtx.Lock()
+	defer db.mtx.Unlock()
+
+	// The responses are stored in name order for stable ids.
+	names := make([]string, 0, len(data))
+	for name := range data {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var completed int
+	for _, name := range names {
+		resp := data[name]
+		pool := db.vspByName(name)
+		if pool == nil {
+			db.vsps = append(db.vsps, vspRecord{
+				ID:          len(db.vsps) + 1,
+				Name:        name,
+				ResposeData: *resp,
+			})
+			pool = &db.vsps[len(db.vsps)-1]
+		}
+		if db.vspTickExists(pool.ID, resp.LastUpdated) {
+			continue
+		}
+		db.vspTicks = append(db.vspTicks, vspTickRecord{
+			ID:          len(db.vspTicks) + 1,
+			VSPID:       pool.ID,
+			ResposeData: *resp,
+		})
+		completed++
+	}
+	return completed, nil
+}
+
+// vspByName returns the named VSP or nil. The caller must hold the lock.
+func (db *MemDb) vspByName(name string) *vspRecord {
+	for i := range db.vsps {
+		if db.vsps[i].Name == name {
+			return &db.vsps[i]
+		}
+	}
+	return nil
+}
+
+func (db *MemDb) vspTickExists(vspID int, time int64) bool {
+	for _, t := range db.vspTicks {
+		if t.VSPID == vspID && t.LastUpdated == time {
+			return true
+		}
+	}
+	return false
+}
+
+func (db *MemDb) FetchVSPs(ctx context.Context) ([]vsp.VSPDto, error) {
+	db.mtx.RLock()
+	defer db.mtx.RUnlock()
+	records := append([]vspRecord(nil), db.vsps...)
+	sort.SliceStable(records, func(i, j int) bool {
+		if records[i].URL != records[j].URL {
+			return records[i].URL < records[j].URL
+		}
+		return records[i].Name < records[j].Name
+	})
+	var result []vsp.VSPDto
+	for _, item := range records {
+		parsedURL, err := url.Parse(item.URL)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, vsp.VSPDto{
+			ID:                   item.ID,
+			Name:                 item.Name,
+			APIEnabled:           item.APIEnabled,
+			APIVersionsSupported: item.APIVersionsSupported,
+			Network:              item.Network,
+			URL:                  item.URL,
+			Host:                 parsedURL.Host,
+			Launched:             helpers.UnixTime(item.Launched),
+		})
+	}
+	return result, nil
+}
+
+// vspTicksOf returns the ticks of the VSP, or of all the VSPs when vspID is 0,
+// ordered by time. The caller must hold the lock.
+func (db *MemDb) vspTicksOf(vspID int) []vspTickRecord {
+	var ticks []vspTickRecord
+	for _, t := range db.vspTicks {
+		if vspID == 0 || t.VSPID == vspID {
+			ticks = append(ticks, t)
+		}
+	}
+	sort.SliceStable(ticks, func(i, j int) bool { return ticks[i].LastUpdated < ticks[j].LastUpdated })
+	return ticks
+}
+
+// vspTicksPage returns a page of the ticks of the VSP, the most recent first,
+// and the number of ticks.
+func (db *MemDb) vspTicksPage(vspID, offset, limit int) ([]vsp.VSPTickDto, int64) {
+	names := make(map[int]string, len(db.vsps))
+	for _, r := range db.vsps {
+		names[r.ID] = r.Name
+	}
+	ticks := db.vspTicksOf(vspID)
+	start, end := page(len(ticks), offset, limit)
+	var result []vsp.VSPTickDto
+	for i := start; i < end; i++ {
+		t := &ticks[len(ticks)-1-i]
+		result = append(result, t.toDto(names[t.VSPID]))
+	}
+	return result, int64(len(ticks))
+}
+
+func (db *MemDb) FilteredVSPTicks(ctx context.Context, vspName string, offset, limit int) ([]vsp.VSPTickDto, int64, error) {
+	db.mtx.RLock()
+	defer db.mtx.RUnlock()
+	pool := db.vspByName(vspName)
+	if pool == nil {
+		return nil, 0, fmt.Errorf("unknown VSP %s", vspName)
+	}
+	result, total := db.vspTicksPage(pool.ID, offset, limit)
+	return result, total, nil
+}
+
+func (db *MemDb) AllVSPTicks(ctx context.Context, offset, limit int) ([]vsp.VSPTickDto, int64, error) {
+	db.mtx.RLock()
+	defer db.mtx.RUnlock()
+	result, total := db.vspTicksPage(0, offset, limit)
+	return result, total, nil
+}
+
+func (db *MemDb) LastVspTickEntryTime() (time time.Time) {
+	db.mtx.RLock()
+	defer db.mtx.RUnlock()
+	if ticks := db.vspTicksOf(0); len(ticks) > 0 {
+		time = helpers.UnixTime(ticks[len(ticks)-1].LastUpdated)
+	}
+	return
+}
+
+func (db *MemDb) VspTickCount(ctx context.Context) (int64, error) {
+	db.mtx.RLock()
+	defer db.mtx.RUnlock()
+	return int64(len(db.vspTicks)), nil
+}
+
+// UpdateVspChart is a no-op, only the default bin is served.
+func (db *MemDb) UpdateVspChart(ctx context.Context) error {
+	return nil
+}
+
+func (db *MemDb) FetchEncodeVspChart(ctx context.Context,
+	dataType, binString string, vspSources ...string) ([]byte, error) {
+	var value func(t *vspTickRecord) float64
+	var isFloat bool
+	switch strings.ToLower(dataType) {
+	case string(chart.ImmatureAxis):
+		value = func(t *vspTickRecord) float64 { return float64(t.Immature) }
+	case string(chart.LiveAxis):
+		value = func(t *vspTickRecord) float64 { return float64(t.Live) }
+	case string(chart.VotedAxis):
+		value = func(t *vspTickRecord) float64 { return float64(t.Voted) }
+	case string(chart.MissedAxis):
+		value = func(t *vspTickRecord) float64 { return float64(t.Missed) }
+	case string(chart.PoolFeesAxis):
+		value, isFloat = func(t *vspTickRecord) float64 { return t.PoolFees }, true
+	case string(chart.ProportionLiveAxis):
+		value, isFloat = func(t *vspTickRecord) float64 { return t.ProportionLive }, true
+	case string(chart.ProportionMissedAxis):
+		value, isFloat = func(t *vspTickRecord) float64 { return t.ProportionMissed }, true
+	case string(chart.UserCountAxis):
+		value = func(t *vspTickRecord) float64 { return float64(t.UserCount) }
+	case string(chart.UsersActiveAxis):
+		value = func(t *vspTickRecord) float64 { return float64(t.UserCountActive) }
+	default:
+		return nil, chart.UnknownChartErr
+	}
+	if err := checkBin(binString); err != nil {
+		return nil, err
+	}
+
+	db.mtx.RLock()
+	defer db.mtx.RUnlock()
+	allDates := make(map[uint64]float64)
+	values := make(map[string]map[uint64]float64, len(vspSources))
+	for _, source := range vspSources {
+		pool := db.vspByName(source)
+		if pool == nil {
+			return nil, fmt.Errorf("unknown VSP %s", source)
+		}
+		set := make(map[uint64]float64)
+		ticks := db.vspTicksOf(pool.ID)
+		for i := range ticks {
+			set[uint64(ticks[i].LastUpdated)] = value(&ticks[i])
+			allDates[uint64(ticks[i].LastUpdated)] = 0
+		}
+		values[source] = set
+	}
+
+	dates := sortedDates(allDates)
+	var deviations []chart.ChartNullData
+	for _, source := range vspSources {
+		if isFloat {
+			deviations = append(deviations, nullFloats(dates, values[source]))
+		} else {
+			deviations = append(deviations, nullUints(dates, values[source]))
+		}
+	}
+	return chart.MakeVspChart(dates, deviations, vspSources)
+}
@@ -0,0 +1,191 @@
+package mempool
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/planetdecred/pdanalytics/chart"
+)
+
+const (
+	// minRelayFeeRate is the default minimum fee rate, in atoms/kB, of the
+	// transactions relayed by dcrd.
+	minRelayFeeRate = 1e4
+
+	// maxEstimateBlocks is the number of recent blocks whose inclusion fee
+	// rate is kept, and the highest target of the fee estimates.
+	maxEstimateBlocks = 24
+)
+
+// feeRateBuckets are the lower bounds, in atoms/kB, of the buckets of the fee
+// rate distribution. The first bucket holds the transactions paying less than
+// the minimum relay fee rate.
+var feeRateBuckets = []int64{0, 1e4, 2e4, 5e4, 1e5, 2e5, 5e5, 1e6}
+
+// feeRate returns the fee rate of the transaction in atoms/kB.
+func (tx *poolTx) feeRate() int64 {
+	if tx.size <= 0 {
+		return 0
+	}
+	return int64(math.Round(tx.fee*1e8)) * 1000 / int64(tx.size)
+}
+
+// competesForSpace tells whether the transaction is selected by its fee rate.
+// Votes and revocations are always mined and are left out of the fee rates.
+func (tx *poolTx) competesForSpace() bool {
+	return tx.txType != txTypeVote && tx.txType != txTypeRevocation
+}
+
+// feeRateBucket returns the index of the bucket of the fee rate.
+func feeRateBucket(rate int64) int {
+	return sort.Search(len(feeRateBuckets), func(i int) bool { return feeRateBuckets[i] > rate }) - 1
+}
+
+// percentile returns the nearest rank p percentile of the sorted rates.
+func percentile(sorted []int64, p int) int64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(float64(p) / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+// feeRates returns the fee rate distribution of the model. Every bucket is
+// returned, empty or not, so that the bucket averages of the bins are not
+// biased by the missing entries.
+func (p *txPool) feeRates() FeeRates {
+	rates := FeeRates{Buckets: make([]FeeRateBucket, len(feeRateBuckets))}
+	for i, rate := range feeRateBuckets {
+		rates.Buckets[i].FeeRate = rate
+	}
+	var sorted []int64
+	for _, tx := range p.txs {
+		if !tx.competesForSpace() {
+			continue
+		}
+		rate := tx.feeRate()
+		sorted = append(sorted, rate)
+		bucket := &rates.Buckets[feeRateBucket(rate)]
+		bucket.TxCount++
+		bucket.Size += int64(tx.size)
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	rates.P10 = percentile(sorted, 10)
+	rates.P50 = percentile(sorted, 50)
+	rates.P90 = percentile(sorted, 90)
+	return rates
+}
+
+// minMinedFeeRate returns the lowest fee rate of the mined transactions that
+// compete for the block space, false if there are none.
+func minMinedFeeRate(mined []*poolTx) (int64, bool) {
+	var min int64
+	var found bool
+	for _, tx := range mined {
+		if !tx.competesForSpace() {
+			continue
+		}
+		if rate := tx.feeRate(); !found || rate < min {
+			min, found = rate, true
+		}
+	}
+	return min, found
+}
+
+// queueFeeRate returns the lowest bucket fee rate at which the transactions
+// paying at least as much fit in capacity bytes. It is 0 when the whole
+// distribution fits.
+func queueFeeRate(rates FeeRates, capacity int64) int64 {
+	var queued int64
+	for i := len(rates.Buckets) - 1; i >= 0; i-- {
+		queued += rates.Buckets[i].Size
+		if queued <= capacity {
+			continue
+		}
+		if i == len(rates.Buckets)-1 {
+			return rates.Buckets[i].FeeRate
+		}
+		return rates.Buckets[i+1].FeeRate
+	}
+	return 0
+}
+
+// inclusionFeeRate returns the fee rate that got a transaction mined within
+// blocks blocks over the recent blocks, given the lowest fee rate mined in
+// each of them, oldest first. That is the highest of the lowest rates of every
+// run of blocks consecutive blocks.
+func inclusionFeeRate(mined []int64, blocks int) int64 {
+	if len(mined) == 0 {
+		return 0
+	}
+	if blocks > len(mined) {
+		blocks = len(mined)
+	}
+	var rate int64
+	for start := 0; start+blocks <= len(mined); start++ {
+		low := mined[start]
+		for _, r := range mined[start+1 : start+blocks] {
+			if r < low {
+				low = r
+			}
+		}
+		if low > rate {
+			rate = low
+		}
+	}
+	return rate
+}
+
+// estimateFee returns the fee estimate for the inclusion within blocks blocks
+// of blockSize bytes, from the current fee rate distribution and the lowest
+// fee rates mined in the recent blocks.
+func estimateFee(rates FeeRates, mined []int64, blocks int, blockSize int64, now time.Time) FeeEstimate {
+	estimate := FeeEstimate{
+		Blocks:           blocks,
+		QueueFeeRate:     queueFeeRate(rates, int64(blocks)*blockSize),
+		InclusionFeeRate: inclusionFeeRate(mined, blocks),
+		FeeRate:          minRelayFeeRate,
+		Time:             now,
+	}
+	if estimate.QueueFeeRate > estimate.FeeRate {
+		estimate.FeeRate = estimate.QueueFeeRate
+	}
+	if estimate.InclusionFeeRate > estimate.FeeRate {
+		estimate.FeeRate = estimate.InclusionFeeRate
+	}
+	return estimate
+}
+
+// EncodeFeeRatesChart encodes the fee-rates chart of the fee rate
+// distributions at the unix times dates. The percentiles are keyed p10, p50
+// and p90 and the bytes queued per bucket size_<bucket fee rate>.
+func EncodeFeeRatesChart(dates chart.ChartUints, rates []FeeRates) ([]byte, error) {
+	p10 := make(chart.ChartUints, len(rates))
+	p50 := make(chart.ChartUints, len(rates))
+	p90 := make(chart.ChartUints, len(rates))
+	sizes := make([]chart.ChartUints, len(feeRateBuckets))
+	for i := range sizes {
+		sizes[i] = make(chart.ChartUints, len(rates))
+	}
+	for i, r := range rates {
+		p10[i], p50[i], p90[i] = uint64(r.P10), uint64(r.P50), uint64(r.P90)
+		for _, bucket := range r.Buckets {
+			if b := feeRateBucket(bucket.FeeRate); b >= 0 {
+				sizes[b][i] = uint64(bucket.Size)
+			}
+		}
+	}
+
+	keys := []string{"x", "p10", "p50", "p90"}
+	sets := []chart.Lengther{dates, p10, p50, p90}
+	for i, rate := range feeRateBuckets {
+		keys = append(keys, "size_"+strconv.FormatInt(rate, 10))
+		sets = append(sets, sizes[i])
+	}
+	return chart.Encode(keys, sets...)
+}
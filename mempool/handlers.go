@@ -12,6 +12,15 @@ import (
 
 const (
 	mempoolDefaultChartDataType = "size"
+
+	// defaultEstimateBlocks is the inclusion target of the fee estimates
+	// when none is requested.
+	defaultEstimateBlocks = 2
+
+	// defaultLatencyDays and maxLatencyDays bound the days of transactions
+	// the confirmation latency is computed over.
+	defaultLatencyDays = 7
+	maxLatencyDays     = 90
 )
 
 func (c *Collector) mempoolPage(w http.ResponseWriter, r *http.Request) {
@@ -29,7 +38,7 @@ func (c *Collector) mempoolPage(w http.ResponseWriter, r *http.Request) {
 	}{
 		CommonPageData: c.webServer.CommonData(r),
 		Mempool:        mempoolData,
-		BlockTime:      c.client.Params.MinDiffReductionTime.Seconds(),
+		BlockTime:      c.params.MinDiffReductionTime.Seconds(),
 		BreadcrumbItems: []web.BreadcrumbItem{
 			{
 				HyperText: "Mempool",
@@ -152,3 +161,42 @@ func (c *Collector) chart(w http.ResponseWriter, r *http.Request) {
 	}
 	web.RenderJSONBytes(w, chartData)
 }
+
+// api/mempool/fee-estimate?blocks=N
+func (c *Collector) feeEstimate(w http.ResponseWriter, r *http.Request) {
+	blocks := defaultEstimateBlocks
+	if b := r.URL.Query().Get("blocks"); b != "" {
+		var err error
+		blocks, err = strconv.Atoi(b)
+		if err != nil || blocks < 1 || blocks > maxEstimateBlocks {
+			web.RenderErrorfJSON(w, "blocks must be between 1 and %d", maxEstimateBlocks)
+			return
+		}
+	}
+	web.RenderJSON(w, c.EstimateFee(blocks))
+}
+
+// api/mempool/confirmation-latency?days=N
+func (c *Collector) confirmationLatency(w http.ResponseWriter, r *http.Request) {
+	days := defaultLatencyDays
+	if d := r.URL.Query().Get("days"); d != "" {
+		var err error
+		days, err = strconv.Atoi(d)
+		if err != nil || days < 1 || days > maxLatencyDays {
+			web.RenderErrorfJSON(w, "days must be between 1 and %d", maxLatencyDays)
+			return
+		}
+	}
+	since := web.NowUTC().AddDate(0, 0, -days)
+	stats, err := c.dataStore.ConfirmationLatency(r.Context(), since)
+	if err != nil {
+		log.Errorf("Error fetching the confirmation latency: %v", err)
+		web.RenderErrorfJSON(w, "cannot get the confirmation latency")
+		return
+	}
+	web.RenderJSON(w, map[string]interface{}{
+		"since":                  since,
+		"stake_diff_window_size": c.params.StakeDiffWindowSize,
+		"stats":                  stats,
+	})
+}
@@ -3,26 +3,39 @@ package mempool
 import (
 	"context"
 	"database/sql"
+	"fmt"
 	"math"
-	"sync"
 	"time"
 
 	"github.com/decred/dcrd/chaincfg/chainhash"
+	"github.com/decred/dcrd/chaincfg/v2"
 	dcrjson "github.com/decred/dcrd/rpc/jsonrpc/types/v2"
+	"github.com/decred/dcrd/wire"
 	"github.com/planetdecred/pdanalytics/dcrd"
+	"github.com/planetdecred/pdanalytics/metrics"
+	"github.com/planetdecred/pdanalytics/module"
 	"github.com/planetdecred/pdanalytics/web"
 )
 
-func NewCollector(ctx context.Context, client *dcrd.Dcrd, interval float64,
+// NewCollector creates a Collector of the mempool of node and adds the http
+// handlers. params are the parameters of the network of the node. The mempool
+// model is stored every interval and reconciled with the node every
+// reconcileInterval, both in seconds.
+func NewCollector(ctx context.Context, node Node, params *chaincfg.Params, interval, reconcileInterval float64,
 	dataStore DataStore, webServer *web.Server) (*Collector, error) {
 
 	c := &Collector{
 		ctx:                ctx,
 		webServer:          webServer,
-		client:             client,
+		node:               node,
+		params:             params,
 		collectionInterval: interval,
+		reconcileInterval:  time.Duration(reconcileInterval * float64(time.Second)),
+		pool:               newTxPool(),
 		dataStore:          dataStore,
+		health:             module.NewHealthTracker(time.Duration(interval * float64(time.Second))),
 	}
+	c.hub = web.NewWebSocketHub(c.summary)
 
 	if err := c.webServer.Templates.AddTemplate("mempool"); err != nil {
 		log.Errorf("Unable to create new html template: %v", err)
@@ -42,84 +55,235 @@ func NewCollector(ctx context.Context, client *dcrd.Dcrd, interval float64,
 	webServer.AddRoute("/mempool", web.GET, c.mempoolPage)
 	webServer.AddRoute("/getmempool", web.GET, c.getMempool)
 	webServer.AddRoute("/api/charts/mempool/{chartDataType}", web.GET, c.chart, web.ChartDataTypeCtx)
+	webServer.AddRoute("/api/mempool/fee-estimate", web.GET, c.feeEstimate)
+	webServer.AddRoute("/api/mempool/confirmation-latency", web.GET, c.confirmationLatency)
+	webServer.AddRoute("/ws/mempool", web.GET, c.hub.ServeHTTP)
 
 	return c, nil
 }
 
-func (c *Collector) StartMonitoring(ctx context.Context) {
-	var mu sync.Mutex
+// Health reports the outcome of the last mempool collection.
+func (c *Collector) Health() module.Health {
+	return c.health.Health()
+}
 
-	collectMempool := func() {
+// TxHandler adds a transaction accepted by dcrd to the mempool model and
+// pushes it to the WebSocket clients. It is registered with the tx handlers
+// of the notifier, which the clients that do not keep up cannot block.
+func (c *Collector) TxHandler(tx *dcrjson.TxRawResult) error {
+	c.mtx.Lock()
+	ptx, err := c.pool.add(tx)
+	var event TxEvent
+	if ptx != nil {
+		event = ptx.txEvent()
+	}
+	c.mtx.Unlock()
+	if ptx != nil {
+		c.hub.Broadcast(event.Type, EventTx, event)
+	}
+	return err
+}
 
-		mu.Lock()
-		defer mu.Unlock()
+// ConnectBlock removes the transactions mined in the block, and the votes on
+// the previous blocks, from the mempool model and pushes the updated mempool
+// entry to the WebSocket clients. It is registered with the block handlers of
+// the notifier.
+func (c *Collector) ConnectBlock(header *wire.BlockHeader) error {
+	hash := header.BlockHash()
+	block, err := c.node.GetBlockVerbose(&hash, false)
+	if err != nil {
+		c.setReconcileDue()
+		return fmt.Errorf("cannot get block %d (%v): %v", header.Height, hash, err)
+	}
 
-		mempoolTransactionMap, err := c.client.Rpc.GetRawMempoolVerbose(dcrjson.GRMAll)
-		if err != nil {
-			log.Error(err)
-			return
+	height := int64(header.Height)
+	now := web.NowUTC()
+	c.mtx.Lock()
+	c.pool.setHeight(height)
+	mined := append(c.pool.remove(block.Tx), c.pool.remove(block.STx)...)
+	c.resolve(mined, OutcomeMined, height, now)
+	stale := c.pool.removeStaleVotes(height)
+	c.resolve(stale, OutcomeEvicted, height, now)
+	// The ticket purchases left are dropped when the next block starts a new
+	// stake difficulty window.
+	if (height+1)%c.params.StakeDiffWindowSize == 0 {
+		tickets := c.pool.removeTickets()
+		c.resolve(tickets, OutcomeMissedWindow, height, now)
+		log.Debugf("Block %d closed the stake difficulty window, %d tickets missed it", height, len(tickets))
+	}
+	// The blocks that mined none of the transactions of the model, e.g. while
+	// it is out of sync, tell nothing of the fee rates.
+	if rate, found := minMinedFeeRate(mined); found {
+		c.minedFeeRates = append(c.minedFeeRates, rate)
+		if len(c.minedFeeRates) > maxEstimateBlocks {
+			c.minedFeeRates = c.minedFeeRates[1:]
 		}
+	}
+	summary := c.pool.snapshot(now)
+	c.mtx.Unlock()
+	log.Debugf("Block %d removed %d mined and %d stale votes from the mempool", height, len(mined), len(stale))
+	c.hub.Broadcast("", EventSummary, summary)
+	return nil
+}
 
-		if len(mempoolTransactionMap) == 0 {
-			return
-		}
+// resolve records the transactions that left the model, to be stored at the
+// next collection. c.mtx must be held.
+func (c *Collector) resolve(txs []*poolTx, outcome string, height int64, now time.Time) {
+	for _, tx := range txs {
+		c.resolved = append(c.resolved, tx.mempoolTx(outcome, height, now))
+	}
+}
 
-		mempoolDto := Mempool{
-			NumberOfTransactions: len(mempoolTransactionMap),
-			Time:                 web.NowUTC(),
-			FirstSeenTime:        web.NowUTC(), //todo: use the time of the first tx in the mempool
-		}
+// summary returns the EventSummary of the current mempool model, the first
+// message of the WebSocket clients.
+func (c *Collector) summary() (string, interface{}) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	return EventSummary, c.pool.snapshot(web.NowUTC())
+}
 
-		for hashString, tx := range mempoolTransactionMap {
-			hash, err := chainhash.NewHashFromStr(hashString)
-			if err != nil {
-				log.Error(err)
-				continue
-			}
-			rawTx, err := c.client.Rpc.GetRawTransactionVerbose(hash)
-			if err != nil {
-				log.Error(err)
-				continue
-			}
+// EstimateFee returns the fee rate suggested for the inclusion of a
+// transaction within blocks blocks, from the current fee rate distribution of
+// the mempool model and the fee rates mined in the recent blocks.
+func (c *Collector) EstimateFee(blocks int) FeeEstimate {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	return estimateFee(c.pool.feeRates(), c.minedFeeRates, blocks, int64(c.params.MaximumBlockSizes[0]), web.NowUTC())
+}
 
-			totalOut := 0.0
-			for _, v := range rawTx.Vout {
-				totalOut += v.Value
-			}
+// Reorg gets the mempool model reconciled at the next collection, as the
+// transactions of the detached blocks return to the mempool of the node. It
+// is registered with the reorg handlers of the notifier.
+func (c *Collector) Reorg(*dcrd.ReorgData) error {
+	c.setReconcileDue()
+	return nil
+}
 
-			mempoolDto.Total += totalOut
-			mempoolDto.TotalFee += tx.Fee
-			mempoolDto.Size += tx.Size
-			if mempoolDto.FirstSeenTime.Unix() > tx.Time {
-				mempoolDto.FirstSeenTime = web.UnixTime(tx.Time)
-			}
+func (c *Collector) setReconcileDue() {
+	c.mtx.Lock()
+	c.reconcileDue = true
+	c.mtx.Unlock()
+}
 
-		}
+// Reconcile syncs the mempool model with the mempool of the node. The
+// transactions the node no longer has are removed, and the ones the model
+// missed, e.g. while dcrd was disconnected, are fetched.
+func (c *Collector) Reconcile(ctx context.Context) error {
+	since := web.NowUTC()
+	height, err := c.node.GetBlockCount()
+	if err != nil {
+		return err
+	}
+	hashes, err := c.node.GetRawMempool(dcrjson.GRMAll)
+	if err != nil {
+		return err
+	}
+	txids := make([]string, len(hashes))
+	for i, hash := range hashes {
+		txids[i] = hash.String()
+	}
 
-		votes, err := c.client.Rpc.GetRawMempool(dcrjson.GRMVotes)
+	// The transactions the node no longer has are recorded as evicted,
+	// though some may have been mined in blocks the model missed.
+	c.mtx.Lock()
+	c.pool.setHeight(height)
+	missing, removed := c.pool.reconcile(txids, since)
+	c.resolve(removed, OutcomeEvicted, height, since)
+	c.mtx.Unlock()
+
+	var added int
+	for _, txid := range missing {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		hash, err := chainhash.NewHashFromStr(txid)
 		if err != nil {
 			log.Error(err)
-			return
+			continue
 		}
-		mempoolDto.Voters = len(votes)
-
-		tickets, err := c.client.Rpc.GetRawMempool(dcrjson.GRMTickets)
+		tx, err := c.node.GetRawTransactionVerbose(hash)
 		if err != nil {
-			log.Error(err)
-			return
+			// The transaction may have been mined or dropped since.
+			log.Debugf("Cannot get mempool transaction %s: %v", txid, err)
+			continue
 		}
-		mempoolDto.Tickets = len(tickets)
-
-		revocations, err := c.client.Rpc.GetRawMempool(dcrjson.GRMRevocations)
+		if tx.BlockHeight > 0 {
+			// Mined since the mempool was read, its block removes it.
+			continue
+		}
+		c.mtx.Lock()
+		_, err = c.pool.add(tx)
+		c.mtx.Unlock()
 		if err != nil {
 			log.Error(err)
-			return
+			continue
+		}
+		added++
+	}
+
+	c.mtx.Lock()
+	c.lastReconcile = since
+	c.reconcileDue = false
+	c.mtx.Unlock()
+	log.Debugf("Reconciled the mempool with dcrd, %d transactions added and %d removed", added, len(removed))
+	return nil
+}
+
+// Collect stores an entry with the size, fees and transaction counts of the
+// mempool model, and the transactions that left it, after reconciling it with
+// the node when it is due. The entry is pushed to the WebSocket clients.
+func (c *Collector) Collect(ctx context.Context) error {
+	c.mtx.Lock()
+	due := c.reconcileDue || time.Since(c.lastReconcile) >= c.reconcileInterval
+	c.mtx.Unlock()
+	if due {
+		if err := c.Reconcile(ctx); err != nil {
+			return err
+		}
+	}
+
+	c.mtx.Lock()
+	mempoolDto := c.pool.snapshot(web.NowUTC())
+	resolved := c.resolved
+	c.resolved = nil
+	c.mtx.Unlock()
+
+	if len(resolved) > 0 {
+		if err := c.dataStore.StoreMempoolTxs(ctx, resolved); err != nil {
+			// Keep them for the next collection.
+			c.mtx.Lock()
+			c.resolved = append(resolved, c.resolved...)
+			c.mtx.Unlock()
+			return err
 		}
-		mempoolDto.Revocations = len(revocations)
+	}
 
-		if err = c.dataStore.StoreMempool(ctx, mempoolDto); err != nil {
+	metrics.MempoolTransactions.Set(float64(mempoolDto.NumberOfTransactions))
+	metrics.MempoolSize.Set(float64(mempoolDto.Size))
+	c.hub.Broadcast("", EventSummary, mempoolDto)
+	if mempoolDto.NumberOfTransactions == 0 {
+		return nil
+	}
+	return c.dataStore.StoreMempool(ctx, mempoolDto)
+}
+
+func (c *Collector) StartMonitoring(ctx context.Context) {
+	defer c.hub.Close()
+
+	collect := func() {
+		if !c.node.Connected() {
+			log.Warn("Skipping mempool collection while dcrd is disconnected")
+			// The notifications sent while disconnected are lost.
+			c.setReconcileDue()
+			return
+		}
+		start := time.Now()
+		err := c.Collect(ctx)
+		if err != nil {
 			log.Error(err)
 		}
+		c.health.Done(err)
+		metrics.ObserveCollectorRun("mempool", time.Since(start), err)
 	}
 
 	lastMempoolTime, err := c.dataStore.LastMempoolTime()
@@ -133,17 +297,21 @@ func (c *Collector) StartMonitoring(ctx context.Context) {
 			timeLeft := c.collectionInterval - sencodsPassed
 			log.Infof("Fetching mempool every %dm, collected %0.2f ago, will fetch in %0.2f.", 1, sencodsPassed,
 				timeLeft)
-			time.Sleep(time.Duration(timeLeft) * time.Second)
+			select {
+			case <-time.After(time.Duration(timeLeft) * time.Second):
+			case <-ctx.Done():
+				return
+			}
 		}
 	}
-	collectMempool()
+	collect()
 	ticker := time.NewTicker(time.Duration(c.collectionInterval) * time.Second)
 	defer ticker.Stop()
 
 	for {
 		select {
 		case <-ticker.C:
-			collectMempool()
+			collect()
 			break
 		case <-ctx.Done():
 			return
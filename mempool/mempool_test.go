@@ -0,0 +1,415 @@
+package mempool_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/decred/dcrd/chaincfg/chainhash"
+	"github.com/decred/dcrd/chaincfg/v2"
+	dcrjson "github.com/decred/dcrd/rpc/jsonrpc/types/v2"
+	"github.com/decred/dcrd/wire"
+	"github.com/gorilla/websocket"
+	"github.com/planetdecred/pdanalytics/memdb"
+	"github.com/planetdecred/pdanalytics/mempool"
+	"github.com/planetdecred/pdanalytics/testutil"
+)
+
+// fakeNode serves a fixed mempool and block.
+type fakeNode struct {
+	txs    map[string]*dcrjson.TxRawResult
+	block  []string
+	height int64
+	calls  int
+}
+
+func (n *fakeNode) Connected() bool { return true }
+
+func (n *fakeNode) GetBlockCount() (int64, error) {
+	n.calls++
+	return n.height, nil
+}
+
+func (n *fakeNode) GetRawMempool(txType dcrjson.GetRawMempoolTxTypeCmd) ([]*chainhash.Hash, error) {
+	n.calls++
+	var hashes []*chainhash.Hash
+	for txid := range n.txs {
+		hash, err := chainhash.NewHashFromStr(txid)
+		if err != nil {
+			return nil, err
+		}
+		hashes = append(hashes, hash)
+	}
+	return hashes, nil
+}
+
+func (n *fakeNode) GetRawTransactionVerbose(txHash *chainhash.Hash) (*dcrjson.TxRawResult, error) {
+	n.calls++
+	tx, found := n.txs[txHash.String()]
+	if !found {
+		return nil, fmt.Errorf("no transaction %v", txHash)
+	}
+	return tx, nil
+}
+
+func (n *fakeNode) GetBlockVerbose(blockHash *chainhash.Hash, verboseTx bool) (*dcrjson.GetBlockVerboseResult, error) {
+	n.calls++
+	return &dcrjson.GetBlockVerboseResult{Tx: n.block}, nil
+}
+
+// newTx returns a regular transaction spending in and paying the outs, in
+// atoms.
+func newTx(t *testing.T, in int64, outs ...int64) *dcrjson.TxRawResult {
+	t.Helper()
+	msgTx := wire.NewMsgTx()
+	prevOut := wire.NewOutPoint(&chainhash.Hash{byte(in)}, 0, wire.TxTreeRegular)
+	msgTx.AddTxIn(wire.NewTxIn(prevOut, in, nil))
+	tx := &dcrjson.TxRawResult{
+		Vin: []dcrjson.Vin{{AmountIn: float64(in) / 1e8}},
+	}
+	for _, out := range outs {
+		msgTx.AddTxOut(wire.NewTxOut(out, []byte{0x76, 0xa9}))
+		tx.Vout = append(tx.Vout, dcrjson.Vout{Value: float64(out) / 1e8})
+	}
+	var buf bytes.Buffer
+	if err := msgTx.Serialize(&buf); err != nil {
+		t.Fatal(err)
+	}
+	tx.Hex = hex.EncodeToString(buf.Bytes())
+	tx.Txid = msgTx.TxHash().String()
+	return tx
+}
+
+func TestCollect(t *testing.T) {
+	tx1 := newTx(t, 3e8, 1e8, 1.5e8)
+	tx2 := newTx(t, 1e8, 0.75e8)
+	node := &fakeNode{txs: map[string]*dcrjson.TxRawResult{
+		tx1.Txid: tx1,
+		tx2.Txid: tx2,
+	}}
+
+	ctx := context.Background()
+	db := memdb.New()
+	server := testutil.NewServer(t)
+	c, err := mempool.NewCollector(ctx, node, chaincfg.MainNetParams(), 60, 600, db, server.Server)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// tx2 is notified, tx1 was accepted before the collector started and is
+	// fetched by the first reconciliation.
+	if err := c.TxHandler(tx2); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Collect(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	var data struct {
+		Mempools []mempool.Dto `json:"mempoolData"`
+	}
+	server.GetJSON("/getmempool?view-option=table", &data)
+	if len(data.Mempools) != 1 {
+		t.Fatalf("got %d mempools, want 1", len(data.Mempools))
+	}
+	m := data.Mempools[0]
+	if m.NumberOfTransactions != 2 || m.Total != 3.25 || m.TotalFee != 0.75 {
+		t.Errorf("unexpected mempool %+v", m)
+	}
+
+	// The next collection within the reconcile interval reads the model only.
+	calls := node.calls
+	if err := c.Collect(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if node.calls != calls {
+		t.Errorf("got %d node calls, want none", node.calls-calls)
+	}
+	if count, _ := db.MempoolCount(ctx); count != 2 {
+		t.Errorf("got %d mempools, want 2", count)
+	}
+}
+
+func TestReconcileMined(t *testing.T) {
+	tx1 := newTx(t, 3e8, 1e8, 1.5e8)
+	tx2 := newTx(t, 1e8, 0.75e8)
+	// tx1 is mined between the reads of the mempool and of the transaction.
+	tx1.BlockHeight = 100
+	node := &fakeNode{txs: map[string]*dcrjson.TxRawResult{tx1.Txid: tx1, tx2.Txid: tx2}}
+
+	ctx := context.Background()
+	db := memdb.New()
+	c, err := mempool.NewCollector(ctx, node, chaincfg.MainNetParams(), 60, 600, db, testutil.NewServer(t).Server)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Collect(ctx); err != nil {
+		t.Fatal(err)
+	}
+	mempools, err := db.Mempools(ctx, 0, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := mempools[0].NumberOfTransactions; n != 1 {
+		t.Errorf("got %d transactions, want the unmined one only", n)
+	}
+}
+
+func TestConnectBlock(t *testing.T) {
+	tx1 := newTx(t, 3e8, 1e8, 1.5e8)
+	tx2 := newTx(t, 1e8, 0.75e8)
+	node := &fakeNode{
+		txs:   map[string]*dcrjson.TxRawResult{tx1.Txid: tx1, tx2.Txid: tx2},
+		block: []string{tx1.Txid},
+	}
+
+	ctx := context.Background()
+	db := memdb.New()
+	c, err := mempool.NewCollector(ctx, node, chaincfg.MainNetParams(), 60, 600, db, testutil.NewServer(t).Server)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Collect(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.ConnectBlock(&wire.BlockHeader{Height: 100}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Collect(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	mempools, err := db.Mempools(ctx, 0, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := mempools[0].NumberOfTransactions; n != 1 {
+		t.Errorf("got %d transactions after the block, want 1", n)
+	}
+}
+
+func TestFeeRates(t *testing.T) {
+	low := newTx(t, 1e8, 1e8-1000)
+	mid := newTx(t, 2e8, 2e8-5000)
+	high := newTx(t, 3e8, 3e8-1e5)
+	node := &fakeNode{
+		txs:   map[string]*dcrjson.TxRawResult{low.Txid: low, mid.Txid: mid, high.Txid: high},
+		block: []string{high.Txid},
+	}
+	size := func(tx *dcrjson.TxRawResult) int64 { return int64(len(tx.Hex) / 2) }
+	rate := func(tx *dcrjson.TxRawResult, fee int64) int64 { return fee * 1000 / size(tx) }
+
+	ctx := context.Background()
+	server := testutil.NewServer(t)
+	c, err := mempool.NewCollector(ctx, node, chaincfg.MainNetParams(), 60, 600, memdb.New(), server.Server)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Collect(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	var rates map[string][]uint64
+	server.GetJSON("/api/charts/mempool/fee-rates?bin=default", &rates)
+	want := map[string]int64{
+		"p10":          rate(low, 1000),
+		"p50":          rate(mid, 5000),
+		"p90":          rate(high, 1e5),
+		"size_10000":   size(low),
+		"size_50000":   size(mid),
+		"size_1000000": size(high),
+		"size_0":       0,
+	}
+	for key, value := range want {
+		if len(rates[key]) != 1 || int64(rates[key][0]) != value {
+			t.Errorf("got %s %v, want [%d]", key, rates[key], value)
+		}
+	}
+
+	// The queue fits in a block and no block was seen, the estimate is the
+	// minimum relay fee rate.
+	var estimate mempool.FeeEstimate
+	server.GetJSON("/api/mempool/fee-estimate?blocks=1", &estimate)
+	if estimate.FeeRate != 1e4 || estimate.QueueFeeRate != 0 || estimate.InclusionFeeRate != 0 {
+		t.Errorf("unexpected estimate %+v", estimate)
+	}
+
+	// A block mining only the highest paying transaction raises the estimate
+	// to its fee rate.
+	if err := c.ConnectBlock(&wire.BlockHeader{Height: 100}); err != nil {
+		t.Fatal(err)
+	}
+	server.GetJSON("/api/mempool/fee-estimate?blocks=1", &estimate)
+	if estimate.Blocks != 1 || estimate.FeeRate != rate(high, 1e5) || estimate.InclusionFeeRate != rate(high, 1e5) {
+		t.Errorf("unexpected estimate after the block %+v", estimate)
+	}
+
+	var failure struct {
+		Error string `json:"error"`
+	}
+	server.GetJSON("/api/mempool/fee-estimate?blocks=0", &failure)
+	if failure.Error == "" {
+		t.Error("blocks=0 was accepted")
+	}
+}
+
+func TestConfirmationLatency(t *testing.T) {
+	tx1 := newTx(t, 3e8, 1e8, 1.5e8)
+	tx2 := newTx(t, 1e8, 0.75e8)
+	node := &fakeNode{
+		txs:    map[string]*dcrjson.TxRawResult{tx1.Txid: tx1, tx2.Txid: tx2},
+		block:  []string{tx1.Txid},
+		height: 99,
+	}
+
+	ctx := context.Background()
+	server := testutil.NewServer(t)
+	c, err := mempool.NewCollector(ctx, node, chaincfg.MainNetParams(), 60, 600, memdb.New(), server.Server)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Collect(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// tx1 is mined in the next block and tx2 is dropped by the node.
+	if err := c.ConnectBlock(&wire.BlockHeader{Height: 100}); err != nil {
+		t.Fatal(err)
+	}
+	node.height = 100
+	delete(node.txs, tx2.Txid)
+	if err := c.Reconcile(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Collect(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	var data struct {
+		Stats []mempool.LatencyStats `json:"stats"`
+	}
+	server.GetJSON("/api/mempool/confirmation-latency", &data)
+	if len(data.Stats) != 1 {
+		t.Fatalf("got %d latency stats, want 1: %+v", len(data.Stats), data.Stats)
+	}
+	s := data.Stats[0]
+	if s.Type != "Regular" || s.FeeRateBucket != 1e6 || s.Mined != 1 || s.Evicted != 1 || s.BlocksP50 != 1 {
+		t.Errorf("unexpected latency stats %+v", s)
+	}
+
+	var latencies map[string][]*float64
+	server.GetJSON("/api/charts/mempool/confirmation-latency?bin=default", &latencies)
+	if len(latencies["x"]) != 1 || len(latencies["regular"]) != 1 || latencies["regular"][0] == nil {
+		t.Errorf("unexpected latency chart %v", latencies)
+	}
+	if len(latencies["ticket"]) != 1 || latencies["ticket"][0] != nil {
+		t.Errorf("got ticket latencies %v, want [null]", latencies["ticket"])
+	}
+}
+
+func TestTypeBreakdown(t *testing.T) {
+	mix := newTx(t, 4<<20, 1<<20, 1<<20, 1<<20)
+	regular := newTx(t, 1e8, 0.75e8)
+	node := &fakeNode{txs: map[string]*dcrjson.TxRawResult{mix.Txid: mix, regular.Txid: regular}}
+
+	ctx := context.Background()
+	server := testutil.NewServer(t)
+	c, err := mempool.NewCollector(ctx, node, chaincfg.MainNetParams(), 60, 600, memdb.New(), server.Server)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Collect(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		dataType string
+		count    float64
+		fees     float64
+	}{
+		{"type-mix", 1, float64(1<<20) / 1e8},
+		{"type-regular", 1, 0.25},
+		{"type-ticket", 0, 0},
+	}
+	for _, test := range tests {
+		var data map[string][]float64
+		server.GetJSON("/api/charts/mempool/"+test.dataType+"?bin=default", &data)
+		if len(data["count"]) != 1 || data["count"][0] != test.count || math.Abs(data["fees"][0]-test.fees) > 1e-12 {
+			t.Errorf("unexpected %s chart %v", test.dataType, data)
+		}
+	}
+
+	var failure struct {
+		Error string `json:"error"`
+	}
+	server.GetJSON("/api/charts/mempool/type-unknown?bin=default", &failure)
+	if failure.Error == "" {
+		t.Error("the type-unknown chart was served")
+	}
+}
+
+func TestWebSocket(t *testing.T) {
+	mix := newTx(t, 4<<20, 1<<20, 1<<20, 1<<20)
+	regular := newTx(t, 1e8, 0.75e8)
+	node := &fakeNode{txs: map[string]*dcrjson.TxRawResult{mix.Txid: mix, regular.Txid: regular}}
+
+	ctx := context.Background()
+	server := testutil.NewServer(t)
+	c, err := mempool.NewCollector(ctx, node, chaincfg.MainNetParams(), 60, 600, memdb.New(), server.Server)
+	if err != nil {
+		t.Fatal(err)
+	}
+	url := "ws" + strings.TrimPrefix(server.URL(), "http") + "/ws/mempool?topics=regular"
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	var msg struct {
+		Event string          `json:"event"`
+		Data  json.RawMessage `json:"data"`
+	}
+	read := func(v interface{}) string {
+		t.Helper()
+		if err := conn.ReadJSON(&msg); err != nil {
+			t.Fatal(err)
+		}
+		if err := json.Unmarshal(msg.Data, v); err != nil {
+			t.Fatal(err)
+		}
+		return msg.Event
+	}
+
+	// The client gets the current mempool first, then the transactions of
+	// its types only, once.
+	var summary mempool.Mempool
+	if event := read(&summary); event != mempool.EventSummary || summary.NumberOfTransactions != 0 {
+		t.Fatalf("got %s %+v, want an empty summary", event, summary)
+	}
+	for _, tx := range []*dcrjson.TxRawResult{mix, regular, regular} {
+		if err := c.TxHandler(tx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var tx mempool.TxEvent
+	if event := read(&tx); event != mempool.EventTx || tx.Hash != regular.Txid || tx.Type != "regular" ||
+		tx.Fee != 0.25 || tx.Value != 0.75 {
+		t.Errorf("got %s %+v, want the regular transaction", event, tx)
+	}
+
+	// The summaries go to every client.
+	if err := c.Collect(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if event := read(&summary); event != mempool.EventSummary || summary.NumberOfTransactions != 2 {
+		t.Errorf("got %s %+v, want a summary of 2 transactions", event, summary)
+	}
+}
@@ -0,0 +1,90 @@
+package mempool
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/decred/slog"
+	"github.com/planetdecred/pdanalytics/dcrd"
+	"github.com/planetdecred/pdanalytics/module"
+	"github.com/planetdecred/pdanalytics/web"
+)
+
+const (
+	defaultMempoolInterval          = 60.0
+	defaultMempoolReconcileInterval = 600.0
+)
+
+// MempoolOptions are the config options of the mempool module.
+type MempoolOptions struct {
+	EnableMempool            bool    `long:"mempool" description:"Enable/Disables the mempool component from running."`
+	MempoolInterval          float64 `long:"mempoolinterval" description:"The duration of time between mempool collection"`
+	MempoolReconcileInterval float64 `long:"mempoolreconcileinterval" description:"The number of seconds between the reconciliations of the mempool with dcrd"`
+}
+
+type mempoolModule struct {
+	options MempoolOptions
+	client  *dcrd.Dcrd
+	server  *web.Server
+	store   DataStore
+	c       *Collector
+	wg      sync.WaitGroup
+}
+
+func init() {
+	module.Register(&mempoolModule{
+		options: MempoolOptions{
+			EnableMempool:            true,
+			MempoolInterval:          defaultMempoolInterval,
+			MempoolReconcileInterval: defaultMempoolReconcileInterval,
+		},
+	})
+}
+
+func (m *mempoolModule) Name() string                 { return "mempool" }
+func (m *mempoolModule) LogSubsystem() string         { return "MEMP" }
+func (m *mempoolModule) UseLogger(logger slog.Logger) { UseLogger(logger) }
+func (m *mempoolModule) Options() interface{}         { return &m.options }
+func (m *mempoolModule) Enabled() bool                { return m.options.EnableMempool }
+
+func (m *mempoolModule) Init(deps *module.Deps) error {
+	db, err := deps.DB()
+	if err != nil {
+		return err
+	}
+	store, ok := db.(DataStore)
+	if !ok {
+		return fmt.Errorf("%T is not a mempool.DataStore", db)
+	}
+	m.client = deps.Dcrd
+	m.server = deps.Server
+	m.store = store
+	return nil
+}
+
+func (m *mempoolModule) Start(ctx context.Context) error {
+	c, err := NewCollector(ctx, NewNode(m.client), m.client.Params, m.options.MempoolInterval,
+		m.options.MempoolReconcileInterval, m.store, m.server)
+	if err != nil {
+		return err
+	}
+	m.c = c
+	m.client.Notif.RegisterTxHandlerGroup(c.TxHandler)
+	m.client.Notif.RegisterBlockHandlerGroup(c.ConnectBlock)
+	m.client.Notif.RegisterReorgHandlerGroup(c.Reorg)
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		c.StartMonitoring(ctx)
+	}()
+	return nil
+}
+
+// Stop waits for the collector to return.
+func (m *mempoolModule) Stop() error {
+	m.wg.Wait()
+	return nil
+}
+
+func (m *mempoolModule) Health() module.Health { return m.c.Health() }
@@ -0,0 +1,45 @@
+package mempool
+
+import (
+	"github.com/decred/dcrd/chaincfg/chainhash"
+	dcrjson "github.com/decred/dcrd/rpc/jsonrpc/types/v2"
+	"github.com/planetdecred/pdanalytics/dcrd"
+)
+
+// Node is the part of the dcrd RPC API read by the collector. The mempool
+// model is kept from the notifications, so it is only read to reconcile the
+// model and to get the transactions of the connected blocks.
+type Node interface {
+	Connected() bool
+	GetBlockCount() (int64, error)
+	GetRawMempool(txType dcrjson.GetRawMempoolTxTypeCmd) ([]*chainhash.Hash, error)
+	GetRawTransactionVerbose(txHash *chainhash.Hash) (*dcrjson.TxRawResult, error)
+	GetBlockVerbose(blockHash *chainhash.Hash, verboseTx bool) (*dcrjson.GetBlockVerboseResult, error)
+}
+
+// dcrdNode is a Node reading the current RPC client of the connection, which
+// is replaced when dcrd reconnects.
+type dcrdNode struct {
+	*dcrd.Dcrd
+}
+
+// NewNode returns the Node of the dcrd connection.
+func NewNode(d *dcrd.Dcrd) Node {
+	return dcrdNode{d}
+}
+
+func (n dcrdNode) GetBlockCount() (int64, error) {
+	return n.Rpc().GetBlockCount()
+}
+
+func (n dcrdNode) GetRawMempool(txType dcrjson.GetRawMempoolTxTypeCmd) ([]*chainhash.Hash, error) {
+	return n.Rpc().GetRawMempool(txType)
+}
+
+func (n dcrdNode) GetRawTransactionVerbose(txHash *chainhash.Hash) (*dcrjson.TxRawResult, error) {
+	return n.Rpc().GetRawTransactionVerbose(txHash)
+}
+
+func (n dcrdNode) GetBlockVerbose(blockHash *chainhash.Hash, verboseTx bool) (*dcrjson.GetBlockVerboseResult, error) {
+	return n.Rpc().GetBlockVerbose(blockHash, verboseTx)
+}
@@ -0,0 +1,170 @@
+package mempool
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/planetdecred/pdanalytics/chart"
+	"github.com/volatiletech/null/v8"
+)
+
+// latencyTxTypes are the transaction types of the confirmation-latency chart,
+// in the order of its series.
+var latencyTxTypes = []string{txTypeRegular, txTypeTicket, txTypeVote, txTypeRevocation}
+
+// mempoolTx returns the record of the transaction leaving the model with the
+// outcome, at height and now.
+func (tx *poolTx) mempoolTx(outcome string, height int64, now time.Time) MempoolTx {
+	rate := tx.feeRate()
+	return MempoolTx{
+		Hash:            tx.hash,
+		Type:            tx.txType,
+		Size:            tx.size,
+		FeeRate:         rate,
+		FeeRateBucket:   feeRateBuckets[feeRateBucket(rate)],
+		FirstSeenTime:   tx.time,
+		FirstSeenHeight: tx.height,
+		Outcome:         outcome,
+		Height:          height,
+		Time:            now,
+	}
+}
+
+// percentileCont returns the p percentile of the sorted values, interpolated
+// between the closest ranks like the postgres percentile_cont.
+func percentileCont(sorted []float64, p float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	pos := p * float64(len(sorted)-1)
+	lower := int(math.Floor(pos))
+	if lower+1 >= len(sorted) {
+		return sorted[lower]
+	}
+	return sorted[lower] + (pos-float64(lower))*(sorted[lower+1]-sorted[lower])
+}
+
+// ConfirmationLatencyStats returns the confirmation latency distributions of
+// the transactions per type and fee rate bucket, ordered by type and bucket.
+// It is used by the stores that do not aggregate the transactions themselves.
+func ConfirmationLatencyStats(txs []MempoolTx) []LatencyStats {
+	type key struct {
+		txType string
+		bucket int64
+	}
+	type group struct {
+		stats   LatencyStats
+		seconds []float64
+		blocks  []float64
+	}
+	groups := make(map[key]*group)
+	for _, tx := range txs {
+		k := key{tx.Type, tx.FeeRateBucket}
+		g, found := groups[k]
+		if !found {
+			g = &group{stats: LatencyStats{Type: tx.Type, FeeRateBucket: tx.FeeRateBucket}}
+			groups[k] = g
+		}
+		switch tx.Outcome {
+		case OutcomeMined:
+			g.stats.Mined++
+			g.seconds = append(g.seconds, tx.Time.Sub(tx.FirstSeenTime).Seconds())
+			g.blocks = append(g.blocks, float64(tx.Height-tx.FirstSeenHeight))
+		case OutcomeMissedWindow:
+			g.stats.MissedWindow++
+		default:
+			g.stats.Evicted++
+		}
+	}
+
+	stats := make([]LatencyStats, 0, len(groups))
+	for _, g := range groups {
+		sort.Float64s(g.seconds)
+		sort.Float64s(g.blocks)
+		var total float64
+		for _, s := range g.seconds {
+			total += s
+		}
+		if len(g.seconds) > 0 {
+			g.stats.LatencyAvg = total / float64(len(g.seconds))
+		}
+		g.stats.LatencyP50 = percentileCont(g.seconds, 0.5)
+		g.stats.LatencyP90 = percentileCont(g.seconds, 0.9)
+		g.stats.BlocksP50 = percentileCont(g.blocks, 0.5)
+		g.stats.BlocksP90 = percentileCont(g.blocks, 0.9)
+		stats = append(stats, g.stats)
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].Type != stats[j].Type {
+			return stats[i].Type < stats[j].Type
+		}
+		return stats[i].FeeRateBucket < stats[j].FeeRateBucket
+	})
+	return stats
+}
+
+// MedianLatencies returns the median confirmation latency of the mined
+// transactions per type and time, ordered by time. timeOf returns the time a
+// transaction is charted at, e.g. the start of its bin, and false to leave it
+// out.
+func MedianLatencies(txs []MempoolTx, timeOf func(tx *MempoolTx) (int64, bool)) []LatencyPoint {
+	type key struct {
+		time   int64
+		txType string
+	}
+	latencies := make(map[key][]float64)
+	for i := range txs {
+		tx := &txs[i]
+		if tx.Outcome != OutcomeMined {
+			continue
+		}
+		t, ok := timeOf(tx)
+		if !ok {
+			continue
+		}
+		k := key{t, tx.Type}
+		latencies[k] = append(latencies[k], tx.Time.Sub(tx.FirstSeenTime).Seconds())
+	}
+
+	points := make([]LatencyPoint, 0, len(latencies))
+	for k, seconds := range latencies {
+		sort.Float64s(seconds)
+		points = append(points, LatencyPoint{Time: k.time, Type: k.txType, Latency: percentileCont(seconds, 0.5)})
+	}
+	sort.Slice(points, func(i, j int) bool { return points[i].Time < points[j].Time })
+	return points
+}
+
+// EncodeLatencyChart encodes the confirmation-latency chart of the points,
+// ordered by time. The median latencies are keyed by the lowercase type, and
+// are null at the times no transaction of the type was mined.
+func EncodeLatencyChart(points []LatencyPoint) ([]byte, error) {
+	var dates chart.ChartUints
+	index := make(map[int64]int)
+	for _, p := range points {
+		if _, found := index[p.Time]; !found {
+			index[p.Time] = len(dates)
+			dates = append(dates, uint64(p.Time))
+		}
+	}
+
+	series := make(map[string]chart.ChartNullFloats, len(latencyTxTypes))
+	for _, txType := range latencyTxTypes {
+		series[txType] = make(chart.ChartNullFloats, len(dates))
+	}
+	for _, p := range points {
+		if s, found := series[p.Type]; found {
+			s[index[p.Time]] = &null.Float64{Float64: p.Latency, Valid: true}
+		}
+	}
+
+	keys := []string{"x"}
+	sets := []chart.Lengther{dates}
+	for _, txType := range latencyTxTypes {
+		keys = append(keys, strings.ToLower(txType))
+		sets = append(sets, series[txType])
+	}
+	return chart.Encode(keys, sets...)
+}
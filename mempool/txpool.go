@@ -0,0 +1,223 @@
+package mempool
+
+import (
+	"time"
+
+	dcrjson "github.com/decred/dcrd/rpc/jsonrpc/types/v2"
+	"github.com/planetdecred/pdanalytics/dcrd"
+	"github.com/planetdecred/pdanalytics/web"
+)
+
+// The transaction types returned by dcrd.DetermineTxTypeString.
+const (
+	txTypeRegular    = "Regular"
+	txTypeVote       = "Vote"
+	txTypeTicket     = "Ticket"
+	txTypeRevocation = "Revocation"
+)
+
+// poolTx is a transaction of the mempool model.
+type poolTx struct {
+	hash   string
+	txType string
+	// kind is the type of the transaction in the mempool breakdown.
+	kind     string
+	size     int32
+	fee      float64
+	totalOut float64
+	// time is the time dcrd accepted the transaction, seen the time it was
+	// added to the model.
+	time time.Time
+	seen time.Time
+	// height is the best block height when the transaction was added.
+	height int64
+	// voteHeight is the height of the block a vote votes on.
+	voteHeight int64
+}
+
+// txPool is the mempool model of the collector. It is kept up to date by the
+// tx and block notifications of dcrd and is not safe for concurrent use.
+type txPool struct {
+	txs map[string]*poolTx
+	// height is the best block height of the node.
+	height int64
+}
+
+func newTxPool() *txPool {
+	return &txPool{txs: make(map[string]*poolTx)}
+}
+
+// add adds a transaction accepted by dcrd and returns it, nil if it is
+// already in the model. The fee is the difference between the input and output
+// amounts, as the verbose transaction has no fee.
+func (p *txPool) add(tx *dcrjson.TxRawResult) (*poolTx, error) {
+	if _, found := p.txs[tx.Txid]; found {
+		return nil, nil
+	}
+	msgTx, err := dcrd.MsgTxFromHex(tx.Hex)
+	if err != nil {
+		return nil, err
+	}
+
+	now := web.NowUTC()
+	ptx := &poolTx{
+		hash:   tx.Txid,
+		txType: dcrd.DetermineTxTypeString(msgTx),
+		size:   int32(msgTx.SerializeSize()),
+		time:   now,
+		seen:   now,
+		height: p.height,
+	}
+	ptx.kind = breakdownType(msgTx, ptx.txType)
+	if tx.Time > 0 {
+		ptx.time = web.UnixTime(tx.Time)
+	}
+	if ptx.txType == txTypeVote {
+		validation, _, err := dcrd.SSGenVoteBlockValid(msgTx)
+		if err != nil {
+			return nil, err
+		}
+		ptx.voteHeight = validation.Height
+	}
+
+	var totalIn float64
+	for _, vin := range tx.Vin {
+		totalIn += vin.AmountIn
+	}
+	for _, vout := range tx.Vout {
+		ptx.totalOut += vout.Value
+	}
+	if fee := totalIn - ptx.totalOut; fee > 0 {
+		ptx.fee = fee
+	}
+
+	p.txs[tx.Txid] = ptx
+	return ptx, nil
+}
+
+// txEvent returns the event pushed to the WebSocket clients for the
+// transaction.
+func (tx *poolTx) txEvent() TxEvent {
+	return TxEvent{
+		Hash:    tx.hash,
+		Type:    tx.kind,
+		Size:    tx.size,
+		Fee:     tx.fee,
+		Value:   tx.totalOut,
+		FeeRate: tx.feeRate(),
+		Time:    tx.time,
+	}
+}
+
+// remove removes the transactions, e.g. the ones mined in a block, and returns
+// the transactions removed.
+func (p *txPool) remove(hashes []string) []*poolTx {
+	var removed []*poolTx
+	for _, hash := range hashes {
+		if tx, found := p.txs[hash]; found {
+			delete(p.txs, hash)
+			removed = append(removed, tx)
+		}
+	}
+	return removed
+}
+
+// removeStaleVotes removes the votes on the blocks below height, which dcrd
+// drops once a block at height is connected.
+func (p *txPool) removeStaleVotes(height int64) []*poolTx {
+	var removed []*poolTx
+	for hash, tx := range p.txs {
+		if tx.txType == txTypeVote && tx.voteHeight < height {
+			delete(p.txs, hash)
+			removed = append(removed, tx)
+		}
+	}
+	return removed
+}
+
+// removeTickets removes the ticket purchases, which dcrd drops when the stake
+// difficulty of the next block changes.
+func (p *txPool) removeTickets() []*poolTx {
+	var removed []*poolTx
+	for hash, tx := range p.txs {
+		if tx.txType == txTypeTicket {
+			delete(p.txs, hash)
+			removed = append(removed, tx)
+		}
+	}
+	return removed
+}
+
+// setHeight sets the best block height, and the height of the transactions
+// added before it was known.
+func (p *txPool) setHeight(height int64) {
+	if p.height == 0 {
+		for _, tx := range p.txs {
+			if tx.height == 0 {
+				tx.height = height
+			}
+		}
+	}
+	p.height = height
+}
+
+// reconcile removes the transactions that are not in hashes, the mempool of
+// the node as of since, and returns the hashes missing from the model. The
+// transactions added after since are kept, their notification may have been
+// received after the node mempool was read.
+func (p *txPool) reconcile(hashes []string, since time.Time) (missing []string, removed []*poolTx) {
+	inNode := make(map[string]struct{}, len(hashes))
+	for _, hash := range hashes {
+		inNode[hash] = struct{}{}
+		if _, found := p.txs[hash]; !found {
+			missing = append(missing, hash)
+		}
+	}
+	for hash, tx := range p.txs {
+		if _, found := inNode[hash]; !found && tx.seen.Before(since) {
+			delete(p.txs, hash)
+			removed = append(removed, tx)
+		}
+	}
+	return
+}
+
+// snapshot returns the mempool entry of the model at now.
+func (p *txPool) snapshot(now time.Time) Mempool {
+	m := Mempool{
+		NumberOfTransactions: len(p.txs),
+		Time:                 now,
+		FirstSeenTime:        now,
+		FeeRates:             p.feeRates(),
+		Types:                make([]TypeStats, len(breakdownTypes)),
+	}
+	typeIndex := make(map[string]int, len(breakdownTypes))
+	for i, t := range breakdownTypes {
+		m.Types[i].Type = t
+		typeIndex[t] = i
+	}
+	for _, tx := range p.txs {
+		if i, found := typeIndex[tx.kind]; found {
+			s := &m.Types[i]
+			s.Count++
+			s.Size += int64(tx.size)
+			s.Fees += tx.fee
+			s.Total += tx.totalOut
+		}
+		m.Size += tx.size
+		m.TotalFee += tx.fee
+		m.Total += tx.totalOut
+		if tx.time.Before(m.FirstSeenTime) {
+			m.FirstSeenTime = tx.time
+		}
+		switch tx.txType {
+		case txTypeVote:
+			m.Voters++
+		case txTypeTicket:
+			m.Tickets++
+		case txTypeRevocation:
+			m.Revocations++
+		}
+	}
+	return m
+}
@@ -0,0 +1,107 @@
+package mempool
+
+import (
+	"strings"
+
+	"github.com/decred/dcrd/blockchain/stake/v4"
+	"github.com/decred/dcrd/wire"
+	"github.com/planetdecred/pdanalytics/chart"
+)
+
+// The transaction types of the mempool breakdown.
+const (
+	typeRegular       = "regular"
+	typeTicket        = "ticket"
+	typeVote          = "vote"
+	typeRevocation    = "revocation"
+	typeTreasuryAdd   = "treasury-add"
+	typeTreasurySpend = "treasury-spend"
+	typeMix           = "mix"
+
+	// typeChartPrefix prefixes the type of the chart data types of the
+	// breakdown, e.g. type-ticket.
+	typeChartPrefix = "type-"
+
+	// minMixOutputs is the number of outputs of the same mixed denomination
+	// that make a mix transaction.
+	minMixOutputs = 3
+)
+
+// breakdownTypes are the types of the mempool breakdown, in the order of the
+// entries.
+var breakdownTypes = []string{typeRegular, typeTicket, typeVote, typeRevocation, typeTreasuryAdd,
+	typeTreasurySpend, typeMix}
+
+// breakdownType returns the type of the transaction in the mempool breakdown.
+// txType is the type returned by dcrd.DetermineTxTypeString, which tells the
+// treasury and mix transactions from no other regular transaction.
+func breakdownType(msgTx *wire.MsgTx, txType string) string {
+	switch txType {
+	case txTypeTicket:
+		return typeTicket
+	case txTypeVote:
+		return typeVote
+	case txTypeRevocation:
+		return typeRevocation
+	}
+	switch {
+	case stake.IsTAdd(msgTx):
+		return typeTreasuryAdd
+	case stake.IsTSpend(msgTx):
+		return typeTreasurySpend
+	case isMix(msgTx):
+		return typeMix
+	}
+	return typeRegular
+}
+
+// isMix tells whether the transaction is a CoinShuffle++ mix, paying
+// minMixOutputs or more outputs of the same mixed denomination.
+func isMix(msgTx *wire.MsgTx) bool {
+	counts := make(map[int64]int)
+	for _, out := range msgTx.TxOut {
+		if !isMixDenomination(out.Value) {
+			continue
+		}
+		counts[out.Value]++
+		if counts[out.Value] >= minMixOutputs {
+			return true
+		}
+	}
+	return false
+}
+
+// isMixDenomination tells whether the amount is one of the mixed output
+// denominations of dcrwallet, the powers of two from 2^18 to 2^36 atoms.
+func isMixDenomination(atoms int64) bool {
+	return atoms >= 1<<18 && atoms <= 1<<36 && atoms&(atoms-1) == 0
+}
+
+// ParseTypeChart returns the type of a chart data type of the breakdown, and
+// false for the other chart data types.
+func ParseTypeChart(dataType string) (string, bool) {
+	if !strings.HasPrefix(dataType, typeChartPrefix) {
+		return "", false
+	}
+	txType := strings.TrimPrefix(dataType, typeChartPrefix)
+	for _, t := range breakdownTypes {
+		if t == txType {
+			return txType, true
+		}
+	}
+	return "", false
+}
+
+// EncodeTypeChart encodes the chart of a transaction type, the count, size,
+// fees and total output value of its transactions at the unix times dates.
+func EncodeTypeChart(dates chart.ChartUints, stats []TypeStats) ([]byte, error) {
+	counts := make(chart.ChartUints, len(stats))
+	sizes := make(chart.ChartUints, len(stats))
+	fees := make(chart.ChartFloats, len(stats))
+	totals := make(chart.ChartFloats, len(stats))
+	for i, s := range stats {
+		counts[i], sizes[i] = uint64(s.Count), uint64(s.Size)
+		fees[i], totals[i] = s.Fees, s.Total
+	}
+	return chart.Encode([]string{"x", "count", "size", "fees", "total"}, dates, counts, sizes, fees, totals)
+}
@@ -2,9 +2,11 @@ package mempool
 
 import (
 	"context"
+	"sync"
 	"time"
 
-	"github.com/planetdecred/pdanalytics/dcrd"
+	"github.com/decred/dcrd/chaincfg/v2"
+	"github.com/planetdecred/pdanalytics/module"
 	"github.com/planetdecred/pdanalytics/web"
 )
 
@@ -18,6 +20,120 @@ type Mempool struct {
 	Size                 int32     `json:"size"`
 	TotalFee             float64   `json:"total_fee"`
 	Total                float64   `json:"total"`
+	FeeRates             FeeRates  `json:"fee_rates"`
+	// Types holds an entry per transaction type, in the breakdown order.
+	Types []TypeStats `json:"types"`
+}
+
+// TypeStats is the count, bytes, fees and total output value, in DCR, of the
+// mempool transactions of a type.
+type TypeStats struct {
+	Type  string  `json:"type"`
+	Count int     `json:"count"`
+	Size  int64   `json:"size"`
+	Fees  float64 `json:"fees"`
+	Total float64 `json:"total"`
+}
+
+// The events pushed to the clients of the /ws/mempool WebSocket.
+const (
+	// EventTx is a transaction accepted by dcrd, a TxEvent. Its topic is the
+	// transaction type in the mempool breakdown.
+	EventTx = "tx"
+	// EventSummary is the current mempool entry, a Mempool, sent to the new
+	// clients and to all clients at every collection and connected block.
+	EventSummary = "summary"
+)
+
+// TxEvent is a transaction accepted by dcrd. Fee and Value, the total output
+// amount, are in DCR and FeeRate in atoms/kB.
+type TxEvent struct {
+	Hash    string    `json:"hash"`
+	Type    string    `json:"type"`
+	Size    int32     `json:"size"`
+	Fee     float64   `json:"fee"`
+	Value   float64   `json:"value"`
+	FeeRate int64     `json:"fee_rate"`
+	Time    time.Time `json:"time"`
+}
+
+// FeeRates is the fee rate distribution, in atoms/kB, of the mempool
+// transactions that compete for the block space.
+type FeeRates struct {
+	P10     int64           `json:"p10"`
+	P50     int64           `json:"p50"`
+	P90     int64           `json:"p90"`
+	Buckets []FeeRateBucket `json:"buckets"`
+}
+
+// FeeRateBucket holds the transactions paying at least FeeRate and less than
+// the fee rate of the next bucket.
+type FeeRateBucket struct {
+	FeeRate int64 `json:"fee_rate"`
+	TxCount int   `json:"tx_count"`
+	Size    int64 `json:"size"`
+}
+
+// FeeEstimate is the fee rate, in atoms/kB, suggested for the inclusion of a
+// transaction within Blocks blocks. It is the highest of the rate of the
+// transactions queued ahead in the mempool, the rate mined within as many
+// blocks recently and the minimum relay fee rate.
+type FeeEstimate struct {
+	Blocks           int       `json:"blocks"`
+	FeeRate          int64     `json:"fee_rate"`
+	QueueFeeRate     int64     `json:"queue_fee_rate"`
+	InclusionFeeRate int64     `json:"inclusion_fee_rate"`
+	Time             time.Time `json:"time"`
+}
+
+// The outcomes of the transactions that left the mempool.
+const (
+	OutcomeMined   = "mined"
+	OutcomeEvicted = "evicted"
+	// OutcomeMissedWindow is the outcome of the ticket purchases dropped by
+	// dcrd as the stake difficulty changed before they were mined.
+	OutcomeMissedWindow = "missed-window"
+)
+
+// MempoolTx is a transaction that left the mempool. Height and Time are the
+// height of the block that mined it and the time the block was connected, or
+// the best block height and the time it was removed for the transactions that
+// were not mined.
+type MempoolTx struct {
+	Hash            string    `json:"hash"`
+	Type            string    `json:"type"`
+	Size            int32     `json:"size"`
+	FeeRate         int64     `json:"fee_rate"`
+	FeeRateBucket   int64     `json:"fee_rate_bucket"`
+	FirstSeenTime   time.Time `json:"first_seen_time"`
+	FirstSeenHeight int64     `json:"first_seen_height"`
+	Outcome         string    `json:"outcome"`
+	Height          int64     `json:"height"`
+	Time            time.Time `json:"time"`
+}
+
+// LatencyStats is the confirmation latency distribution of the transactions
+// of a type and fee rate bucket that left the mempool. The latencies of the
+// mined transactions are in seconds and in blocks.
+type LatencyStats struct {
+	Type          string  `json:"type"`
+	FeeRateBucket int64   `json:"fee_rate_bucket"`
+	Mined         int     `json:"mined"`
+	Evicted       int     `json:"evicted"`
+	MissedWindow  int     `json:"missed_window"`
+	LatencyAvg    float64 `json:"latency_avg"`
+	LatencyP50    float64 `json:"latency_p50"`
+	LatencyP90    float64 `json:"latency_p90"`
+	BlocksP50     float64 `json:"blocks_p50"`
+	BlocksP90     float64 `json:"blocks_p90"`
+}
+
+// LatencyPoint is the median confirmation latency, in seconds, of the
+// transactions of a type mined at Time, or in the bin starting at Time.
+type LatencyPoint struct {
+	Time    int64
+	Type    string
+	Latency float64
 }
 
 type Dto struct {
@@ -43,15 +159,35 @@ type DataStore interface {
 	MempoolCount(ctx context.Context) (int64, error)
 	Mempools(ctx context.Context, offtset int, limit int) ([]Dto, error)
 	FetchEncodeChart(ctx context.Context, dataType, binString string) ([]byte, error)
+	StoreMempoolTxs(ctx context.Context, txs []MempoolTx) error
+	ConfirmationLatency(ctx context.Context, since time.Time) ([]LatencyStats, error)
 }
 
 type Collector struct {
 	ctx                context.Context
 	collectionInterval float64
-	client             *dcrd.Dcrd
+	reconcileInterval  time.Duration
+	node               Node
+	params             *chaincfg.Params
 	dataStore          DataStore
+	health             *module.HealthTracker
+
+	// mtx guards the mempool model and its reconciliation state.
+	mtx           sync.Mutex
+	pool          *txPool
+	lastReconcile time.Time
+	reconcileDue  bool
+	// minedFeeRates are the lowest fee rates mined in the recent blocks,
+	// oldest first.
+	minedFeeRates []int64
+	// resolved are the transactions that left the model since they were
+	// last stored.
+	resolved []MempoolTx
 
 	webServer *web.Server
+	// hub pushes the accepted transactions and the mempool entries to the
+	// WebSocket clients.
+	hub *web.WebSocketHub
 
 	Version          string
 	NetName          string
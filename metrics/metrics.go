@@ -0,0 +1,197 @@
+// Package metrics defines the Prometheus metrics of pdanalytics and serves them
+// on /metrics. The metrics are always recorded, serving them is optional.
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "pdanalytics"
+
+// registry holds the pdanalytics metrics along with the Go runtime and process
+// metrics.
+var registry = prometheus.NewRegistry()
+
+var (
+	notifierHandlerDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "notifier",
+		Name:      "handler_duration_seconds",
+		Help:      "Duration of the block, reorg and tx notification handlers.",
+		Buckets:   []float64{.001, .005, .025, .1, .5, 1, 5, 30, 120},
+	}, []string{"kind", "handler"})
+	notifierHandlerErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "notifier",
+		Name:      "handler_errors_total",
+		Help:      "Number of notification handler runs that failed.",
+	}, []string{"kind", "handler"})
+
+	collectorRuns = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "collector",
+		Name:      "runs_total",
+		Help:      "Number of collector runs.",
+	}, []string{"collector"})
+	collectorErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "collector",
+		Name:      "errors_total",
+		Help:      "Number of collector runs that failed.",
+	}, []string{"collector"})
+	collectorDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "collector",
+		Name:      "duration_seconds",
+		Help:      "Duration of the collector runs.",
+		Buckets:   []float64{.1, .5, 1, 5, 15, 60, 300, 900},
+	}, []string{"collector"})
+
+	dbQueryDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "postgres",
+		Name:      "query_duration_seconds",
+		Help:      "Duration of the postgres queries by operation and table.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"operation", "table"})
+
+	httpRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "requests_total",
+		Help:      "Number of HTTP requests by route, method and status code.",
+	}, []string{"route", "method", "code"})
+	httpDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "request_duration_seconds",
+		Help:      "Duration of the HTTP requests by route and method.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"route", "method"})
+
+	// BestBlockHeight is the height of the last block connected by the
+	// notifier.
+	BestBlockHeight = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "best_block_height",
+		Help:      "Height of the last connected block.",
+	})
+	// TicketPrice is the ticket price of the last block connected by the
+	// notifier, in DCR.
+	TicketPrice = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "ticket_price_dcr",
+		Help:      "Ticket price of the last connected block in DCR.",
+	})
+	// MempoolTransactions is the number of transactions in the last mempool
+	// collection.
+	MempoolTransactions = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "mempool",
+		Name:      "transactions",
+		Help:      "Number of transactions in the mempool at the last collection.",
+	})
+	// MempoolSize is the size of the transactions in the last mempool
+	// collection, in bytes.
+	MempoolSize = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "mempool",
+		Name:      "size_bytes",
+		Help:      "Size of the transactions in the mempool at the last collection.",
+	})
+	// NetworkNodes is the number of reachable nodes in the last network
+	// snapshot.
+	NetworkNodes = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "netsnapshot",
+		Name:      "nodes",
+		Help:      "Number of reachable nodes in the last network snapshot.",
+	})
+)
+
+func init() {
+	registry.MustRegister(
+		prometheus.NewGoCollector(),
+		prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}),
+		notifierHandlerDuration,
+		notifierHandlerErrors,
+		collectorRuns,
+		collectorErrors,
+		collectorDuration,
+		dbQueryDuration,
+		httpRequests,
+		httpDuration,
+		BestBlockHeight,
+		TicketPrice,
+		MempoolTransactions,
+		MempoolSize,
+		NetworkNodes,
+	)
+}
+
+// RegisterQueueDepth exports the number of notifications waiting in the
+// notifier queue, as returned by queueLen.
+func RegisterQueueDepth(queueLen func() int) error {
+	return registry.Register(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "notifier",
+		Name:      "queue_depth",
+		Help:      "Number of notifications waiting to be processed.",
+	}, func() float64 {
+		return float64(queueLen())
+	}))
+}
+
+// ObserveHandler records a notification handler run. It satisfies
+// dcrd.HandlerObserver.
+func ObserveHandler(kind, handler string, duration time.Duration, err error) {
+	notifierHandlerDuration.WithLabelValues(kind, handler).Observe(duration.Seconds())
+	if err != nil {
+		notifierHandlerErrors.WithLabelValues(kind, handler).Inc()
+	}
+}
+
+// ObserveCollectorRun records a collector run.
+func ObserveCollectorRun(collector string, duration time.Duration, err error) {
+	collectorRuns.WithLabelValues(collector).Inc()
+	collectorDuration.WithLabelValues(collector).Observe(duration.Seconds())
+	if err != nil {
+		collectorErrors.WithLabelValues(collector).Inc()
+	}
+}
+
+// Handler serves the metrics in the Prometheus exposition format.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+}
+
+// ListenAndServe serves /metrics on listen until ctx is canceled.
+func ListenAndServe(ctx context.Context, listen string) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", Handler())
+	server := &http.Server{
+		Addr:         listen,
+		Handler:      mux,
+		ReadTimeout:  5 * time.Second,
+		WriteTimeout: 30 * time.Second,
+	}
+
+	go func() {
+		<-ctx.Done()
+		if err := server.Shutdown(context.Background()); err != nil {
+			log.Infof("Metrics server Shutdown: %v", err)
+		}
+	}()
+
+	log.Infof("Now serving metrics on http://%s/metrics", listen)
+	go func() {
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Errorf("Metrics server failed: %v", err)
+		}
+	}()
+}
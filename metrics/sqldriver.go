@@ -0,0 +1,194 @@
+package metrics
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// PostgresDriver is the name of the database/sql driver that times the
+// queries sent to postgres. It takes the same data source names as the pq
+// driver.
+const PostgresDriver = "postgres-metrics"
+
+func init() {
+	sql.Register(PostgresDriver, &pgDriver{})
+}
+
+// tableRe matches the first table a statement reads from or writes to.
+var tableRe = regexp.MustCompile(`(?i)\b(?:from|into|update|table(?:\s+if\s+(?:not\s+)?exists)?)\s+"?([a-z_][a-z0-9_]*)`)
+
+// queryLabels returns the operation and table labels of query. Unknown
+// operations are grouped as "other" to keep the number of series bounded.
+func queryLabels(query string) (operation, table string) {
+	fields := strings.Fields(query)
+	operation = "other"
+	if len(fields) > 0 {
+		switch op := strings.ToLower(fields[0]); op {
+		case "select", "insert", "update", "delete", "with", "create",
+			"drop", "alter", "truncate", "copy":
+			operation = op
+		}
+	}
+	table = "unknown"
+	if m := tableRe.FindStringSubmatch(query); m != nil {
+		table = strings.ToLower(m[1])
+	}
+	return
+}
+
+func observeQuery(query string, start time.Time) {
+	operation, table := queryLabels(query)
+	dbQueryDuration.WithLabelValues(operation, table).Observe(time.Since(start).Seconds())
+}
+
+// pgDriver wraps the pq driver to time the statements.
+type pgDriver struct {
+	pq.Driver
+}
+
+func (d *pgDriver) Open(name string) (driver.Conn, error) {
+	conn, err := d.Driver.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return &pgConn{conn}, nil
+}
+
+// pgConn times the queries and statements of a pq connection. The optional
+// interfaces are forwarded, driver.ErrSkip is returned for those the wrapped
+// connection does not implement.
+type pgConn struct {
+	driver.Conn
+}
+
+func (c *pgConn) Prepare(query string) (driver.Stmt, error) {
+	stmt, err := c.Conn.Prepare(query)
+	if err != nil {
+		return nil, err
+	}
+	return &pgStmt{stmt, query}, nil
+}
+
+func (c *pgConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	preparer, ok := c.Conn.(driver.ConnPrepareContext)
+	if !ok {
+		return c.Prepare(query)
+	}
+	stmt, err := preparer.PrepareContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	return &pgStmt{stmt, query}, nil
+}
+
+func (c *pgConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if beginner, ok := c.Conn.(driver.ConnBeginTx); ok {
+		return beginner.BeginTx(ctx, opts)
+	}
+	return c.Conn.Begin() //nolint:staticcheck
+}
+
+func (c *pgConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	queryer, ok := c.Conn.(driver.QueryerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	defer observeQuery(query, time.Now())
+	return queryer.QueryContext(ctx, query, args)
+}
+
+func (c *pgConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	execer, ok := c.Conn.(driver.ExecerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	defer observeQuery(query, time.Now())
+	return execer.ExecContext(ctx, query, args)
+}
+
+func (c *pgConn) Ping(ctx context.Context) error {
+	if pinger, ok := c.Conn.(driver.Pinger); ok {
+		return pinger.Ping(ctx)
+	}
+	return nil
+}
+
+func (c *pgConn) ResetSession(ctx context.Context) error {
+	if resetter, ok := c.Conn.(driver.SessionResetter); ok {
+		return resetter.ResetSession(ctx)
+	}
+	return nil
+}
+
+func (c *pgConn) CheckNamedValue(nv *driver.NamedValue) error {
+	if checker, ok := c.Conn.(driver.NamedValueChecker); ok {
+		return checker.CheckNamedValue(nv)
+	}
+	return driver.ErrSkip
+}
+
+// pgStmt times the executions of a prepared statement.
+type pgStmt struct {
+	driver.Stmt
+	query string
+}
+
+func (s *pgStmt) Exec(args []driver.Value) (driver.Result, error) {
+	defer observeQuery(s.query, time.Now())
+	return s.Stmt.Exec(args) //nolint:staticcheck
+}
+
+func (s *pgStmt) Query(args []driver.Value) (driver.Rows, error) {
+	defer observeQuery(s.query, time.Now())
+	return s.Stmt.Query(args) //nolint:staticcheck
+}
+
+func (s *pgStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	execer, ok := s.Stmt.(driver.StmtExecContext)
+	if !ok {
+		values, err := namedValuesToValues(args)
+		if err != nil {
+			return nil, err
+		}
+		return s.Exec(values)
+	}
+	defer observeQuery(s.query, time.Now())
+	return execer.ExecContext(ctx, args)
+}
+
+func (s *pgStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	queryer, ok := s.Stmt.(driver.StmtQueryContext)
+	if !ok {
+		values, err := namedValuesToValues(args)
+		if err != nil {
+			return nil, err
+		}
+		return s.Query(values)
+	}
+	defer observeQuery(s.query, time.Now())
+	return queryer.QueryContext(ctx, args)
+}
+
+func (s *pgStmt) CheckNamedValue(nv *driver.NamedValue) error {
+	if checker, ok := s.Stmt.(driver.NamedValueChecker); ok {
+		return checker.CheckNamedValue(nv)
+	}
+	return driver.ErrSkip
+}
+
+func namedValuesToValues(args []driver.NamedValue) ([]driver.Value, error) {
+	values := make([]driver.Value, len(args))
+	for i, arg := range args {
+		if arg.Name != "" {
+			return nil, driver.ErrSkip
+		}
+		values[i] = arg.Value
+	}
+	return values, nil
+}
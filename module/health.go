@@ -0,0 +1,65 @@
+package module
+
+import (
+	"sync"
+	"time"
+)
+
+// StaleIntervals is the number of collection intervals without a success
+// after which a module is stale.
+const StaleIntervals = 3
+
+// HealthTracker records the outcome of the periodic work of a module that
+// does not run on the scheduler.
+type HealthTracker struct {
+	mtx         sync.Mutex
+	interval    time.Duration
+	lastSuccess time.Time
+	lastErr     error
+}
+
+// NewHealthTracker creates a HealthTracker for work done every interval. A
+// zero interval disables the staleness check, e.g. for work triggered by
+// blocks.
+func NewHealthTracker(interval time.Duration) *HealthTracker {
+	return &HealthTracker{interval: interval}
+}
+
+// Done records the outcome of a unit of work.
+func (t *HealthTracker) Done(err error) {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	t.lastErr = err
+	if err == nil {
+		t.lastSuccess = time.Now()
+	}
+}
+
+// Health returns the Health of the tracked work. It is unhealthy if the last
+// unit of work failed.
+func (t *HealthTracker) Health() Health {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	health := Health{
+		Healthy:     t.lastErr == nil,
+		LastSuccess: t.lastSuccess,
+		Interval:    t.interval,
+	}
+	if t.lastErr != nil {
+		health.LastError = t.lastErr.Error()
+	}
+	return health
+}
+
+// stale checks if a module started at startTime has gone StaleIntervals
+// intervals without a success.
+func stale(health Health, startTime, now time.Time) bool {
+	if health.Interval <= 0 {
+		return false
+	}
+	last := health.LastSuccess
+	if last.IsZero() {
+		last = startTime
+	}
+	return now.Sub(last) > StaleIntervals*health.Interval
+}
@@ -0,0 +1,47 @@
+package module
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestStale(t *testing.T) {
+	now := time.Now()
+	started := now.Add(-time.Hour)
+	tests := []struct {
+		name   string
+		health Health
+		want   bool
+	}{
+		{"no interval", Health{}, false},
+		{"recent success", Health{Interval: time.Minute, LastSuccess: now.Add(-2 * time.Minute)}, false},
+		{"old success", Health{Interval: time.Minute, LastSuccess: now.Add(-4 * time.Minute)}, true},
+		{"never succeeded", Health{Interval: time.Minute}, true},
+		{"never succeeded, long interval", Health{Interval: time.Hour}, false},
+	}
+	for _, tt := range tests {
+		if got := stale(tt.health, started, now); got != tt.want {
+			t.Errorf("%s: stale = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestHealthTracker(t *testing.T) {
+	tracker := NewHealthTracker(time.Minute)
+	if h := tracker.Health(); !h.Healthy || !h.LastSuccess.IsZero() || h.Interval != time.Minute {
+		t.Fatalf("unexpected initial health %+v", h)
+	}
+
+	tracker.Done(nil)
+	success := tracker.Health().LastSuccess
+	if success.IsZero() {
+		t.Fatal("success not recorded")
+	}
+
+	tracker.Done(errors.New("boom"))
+	h := tracker.Health()
+	if h.Healthy || h.LastError != "boom" || !h.LastSuccess.Equal(success) {
+		t.Errorf("unexpected health after a failure %+v", h)
+	}
+}
@@ -0,0 +1,152 @@
+// Package module defines the interface implemented by the pdanalytics
+// components and a registry the components add themselves to from their init
+// function. The application parses the options of the registered modules,
+// initializes the enabled ones with the shared dependencies, starts them and
+// stops them in reverse order on shutdown.
+package module
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/decred/dcrdata/exchanges/v2"
+	"github.com/decred/slog"
+	"github.com/planetdecred/pdanalytics/dbhelper"
+	"github.com/planetdecred/pdanalytics/dcrd"
+	"github.com/planetdecred/pdanalytics/scheduler"
+	"github.com/planetdecred/pdanalytics/web"
+)
+
+// Module is a pdanalytics component.
+type Module interface {
+	// Name uniquely identifies the module.
+	Name() string
+	// Init validates the options of the module and resolves its
+	// dependencies. It is only called for enabled modules.
+	Init(deps *Deps) error
+	// Start activates the module: routes, templates, notification handlers,
+	// scheduled jobs and background goroutines. Routes must be added here as
+	// the web server builds its router after all modules have started.
+	Start(ctx context.Context) error
+	// Stop releases the resources held by the module. It is called after
+	// the context passed to Start has been canceled.
+	Stop() error
+	// Health reports the state of the module.
+	Health() Health
+}
+
+// Configurable is implemented by modules with command line and config file
+// options.
+type Configurable interface {
+	// Options returns a pointer to a struct with go-flags and env tags. The
+	// struct must hold the default values when the module is registered.
+	Options() interface{}
+	// Enabled reports whether the module should run with the parsed
+	// options. Modules that do not implement Configurable always run.
+	Enabled() bool
+}
+
+// Logger is implemented by modules with a subsystem logger.
+type Logger interface {
+	// LogSubsystem returns the identifier of the subsystem logger, as used
+	// with --debuglevel.
+	LogSubsystem() string
+	// UseLogger sets the logger of the module's package.
+	UseLogger(logger slog.Logger)
+}
+
+// Dependent is implemented by modules that read the data of other modules.
+// They are initialized and started after those modules, and stopped before
+// them.
+type Dependent interface {
+	// DependsOn returns the names of the modules the module depends on.
+	// The modules that are not registered or not enabled are ignored.
+	DependsOn() []string
+}
+
+// Health is the state of a module as reported by Module.Health. Modules that
+// collect data periodically set Interval to the collection interval. Stale is
+// set by the Registry when the last success is older than StaleIntervals
+// intervals.
+type Health struct {
+	Healthy     bool          `json:"healthy"`
+	Message     string        `json:"message,omitempty"`
+	LastSuccess time.Time     `json:"last_success,omitempty"`
+	LastError   string        `json:"last_error,omitempty"`
+	Interval    time.Duration `json:"interval,omitempty"`
+	Stale       bool          `json:"stale"`
+}
+
+// Healthy is the Health of a module without state to report.
+var Healthy = Health{Healthy: true}
+
+// DB is the shared database. Modules type assert it to the store interface
+// of their package.
+type DB interface {
+	TableExists(name string) bool
+	Close() error
+}
+
+// Deps holds the dependencies shared by the modules.
+type Deps struct {
+	Dcrd      *dcrd.Dcrd
+	Server    *web.Server
+	Scheduler *scheduler.Scheduler
+	// XcBot is nil when the exchange monitor is disabled.
+	XcBot *exchanges.ExchangeBot
+
+	DataDir           string
+	APIURL            string
+	DisabledExchanges []string
+
+	// DB returns the shared database, connecting to it and creating the
+	// tables on the first call.
+	DB func() (DB, error)
+	// OpenDB connects to another postgres database. The pool size and query
+	// timeout of the shared database apply to it, and its SSL settings when
+	// the options have none.
+	OpenDB func(opts dbhelper.ConnOptions) (DB, error)
+
+	registry *Registry
+}
+
+// ModuleEnabled checks if the named module is registered and enabled.
+func (d *Deps) ModuleEnabled(name string) bool {
+	if d.registry == nil {
+		return false
+	}
+	m := d.registry.Module(name)
+	return m != nil && enabled(m)
+}
+
+// JobsHealth builds the Health of a module from the status of its scheduled
+// jobs, i.e. the job named prefix and the jobs named prefix-*. The module is
+// unhealthy if the last run of any of them failed. Its Interval is the longest
+// interval of the jobs.
+func JobsHealth(sched *scheduler.Scheduler, prefix string) Health {
+	health := Health{Healthy: true}
+	for _, status := range sched.Status() {
+		if status.Name != prefix && !strings.HasPrefix(status.Name, prefix+"-") {
+			continue
+		}
+		if status.LastSuccess.After(health.LastSuccess) {
+			health.LastSuccess = status.LastSuccess
+		}
+		if status.Interval > health.Interval {
+			health.Interval = status.Interval
+		}
+		if status.LastError != "" {
+			health.Healthy = false
+			health.LastError = status.Name + ": " + status.LastError
+		}
+	}
+	return health
+}
+
+func enabled(m Module) bool {
+	if c, ok := m.(Configurable); ok {
+		return c.Enabled()
+	}
+	return true
+}
@@ -0,0 +1,206 @@
+package module
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Registry holds the registered modules and tracks the ones that have been
+// initialized and started.
+type Registry struct {
+	mtx     sync.Mutex
+	modules map[string]Module
+	inited  []Module
+	started []Module
+	// startTimes holds the time the started modules were started at.
+	startTimes map[string]time.Time
+}
+
+// NewRegistry creates an empty Registry.
+func NewRegistry() *Registry {
+	return &Registry{
+		modules:    make(map[string]Module),
+		startTimes: make(map[string]time.Time),
+	}
+}
+
+// defaultRegistry is the registry the module packages add themselves to.
+var defaultRegistry = NewRegistry()
+
+// Default returns the registry the module packages add themselves to.
+func Default() *Registry {
+	return defaultRegistry
+}
+
+// Register adds a module to the default registry. It is meant to be called
+// from the init function of the module's package and panics if a module with
+// the same name is already registered.
+func Register(m Module) {
+	if err := defaultRegistry.Register(m); err != nil {
+		panic(err)
+	}
+}
+
+// Register adds a module to the registry.
+func (r *Registry) Register(m Module) error {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	if _, found := r.modules[m.Name()]; found {
+		return fmt.Errorf("module %s is already registered", m.Name())
+	}
+	r.modules[m.Name()] = m
+	return nil
+}
+
+// Module returns the named module or nil if it is not registered.
+func (r *Registry) Module(name string) Module {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	return r.modules[name]
+}
+
+// Modules returns the registered modules sorted by name.
+func (r *Registry) Modules() []Module {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	modules := make([]Module, 0, len(r.modules))
+	for _, m := range r.modules {
+		modules = append(modules, m)
+	}
+	sort.Slice(modules, func(i, j int) bool {
+		return modules[i].Name() < modules[j].Name()
+	})
+	return modules
+}
+
+// startOrder returns the registered modules sorted by name, each after the
+// modules it depends on. It fails if the dependencies have a cycle.
+func (r *Registry) startOrder() ([]Module, error) {
+	const (
+		visiting = iota + 1
+		visited
+	)
+	modules := r.Modules()
+	order := make([]Module, 0, len(modules))
+	state := make(map[string]int, len(modules))
+	var visit func(m Module, path []string) error
+	visit = func(m Module, path []string) error {
+		path = append(path, m.Name())
+		switch state[m.Name()] {
+		case visited:
+			return nil
+		case visiting:
+			return fmt.Errorf("the modules depend on each other: %s", strings.Join(path, " -> "))
+		}
+		state[m.Name()] = visiting
+		if d, ok := m.(Dependent); ok {
+			for _, name := range d.DependsOn() {
+				dep := r.Module(name)
+				if dep == nil {
+					continue
+				}
+				if err := visit(dep, path); err != nil {
+					return err
+				}
+			}
+		}
+		state[m.Name()] = visited
+		order = append(order, m)
+		return nil
+	}
+	for _, m := range modules {
+		if err := visit(m, nil); err != nil {
+			return nil, err
+		}
+	}
+	return order, nil
+}
+
+// Init initializes the enabled modules with deps, each after the modules it
+// depends on, which is the order they are started in. It stops at the first
+// module that fails.
+func (r *Registry) Init(deps *Deps) error {
+	deps.registry = r
+	modules, err := r.startOrder()
+	if err != nil {
+		return err
+	}
+	for _, m := range modules {
+		if !enabled(m) {
+			log.Debugf("Module %s is disabled", m.Name())
+			continue
+		}
+		if err := m.Init(deps); err != nil {
+			return fmt.Errorf("failed to initialize the %s module: %v", m.Name(), err)
+		}
+		r.mtx.Lock()
+		r.inited = append(r.inited, m)
+		r.mtx.Unlock()
+	}
+	return nil
+}
+
+// Start starts the initialized modules. It stops at the first module that
+// fails, the modules started before it are stopped by Stop.
+func (r *Registry) Start(ctx context.Context) error {
+	r.mtx.Lock()
+	inited := r.inited
+	r.mtx.Unlock()
+
+	for _, m := range inited {
+		if err := m.Start(ctx); err != nil {
+			return fmt.Errorf("failed to start the %s module: %v", m.Name(), err)
+		}
+		r.mtx.Lock()
+		r.started = append(r.started, m)
+		r.startTimes[m.Name()] = time.Now()
+		r.mtx.Unlock()
+		log.Infof("Module %s started", m.Name())
+	}
+	return nil
+}
+
+// Stop stops the started modules in the reverse order they were started.
+func (r *Registry) Stop() {
+	r.mtx.Lock()
+	started := r.started
+	r.started = nil
+	r.startTimes = make(map[string]time.Time)
+	r.mtx.Unlock()
+
+	for i := len(started) - 1; i >= 0; i-- {
+		m := started[i]
+		if err := m.Stop(); err != nil {
+			log.Errorf("Error stopping the %s module: %v", m.Name(), err)
+			continue
+		}
+		log.Debugf("Module %s stopped", m.Name())
+	}
+}
+
+// Health returns the health of the started modules keyed by name, with the
+// modules that went StaleIntervals collection intervals without a success
+// marked stale.
+func (r *Registry) Health() map[string]Health {
+	r.mtx.Lock()
+	started := make([]Module, len(r.started))
+	copy(started, r.started)
+	startTimes := make(map[string]time.Time, len(r.startTimes))
+	for name, t := range r.startTimes {
+		startTimes[name] = t
+	}
+	r.mtx.Unlock()
+
+	now := time.Now()
+	health := make(map[string]Health, len(started))
+	for _, m := range started {
+		h := m.Health()
+		h.Stale = stale(h, startTimes[m.Name()], now)
+		health[m.Name()] = h
+	}
+	return health
+}
@@ -0,0 +1,157 @@
+package module
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+type testModule struct {
+	name     string
+	enabled  bool
+	startErr error
+	deps     []string
+	calls    *[]string
+}
+
+func (m *testModule) Name() string         { return m.name }
+func (m *testModule) Options() interface{} { return &m.enabled }
+func (m *testModule) Enabled() bool        { return m.enabled }
+func (m *testModule) Health() Health       { return Healthy }
+func (m *testModule) DependsOn() []string  { return m.deps }
+
+func (m *testModule) Init(*Deps) error {
+	*m.calls = append(*m.calls, "init "+m.name)
+	return nil
+}
+
+func (m *testModule) Start(context.Context) error {
+	*m.calls = append(*m.calls, "start "+m.name)
+	return m.startErr
+}
+
+func (m *testModule) Stop() error {
+	*m.calls = append(*m.calls, "stop "+m.name)
+	return nil
+}
+
+func TestRegistryLifecycle(t *testing.T) {
+	var calls []string
+	r := NewRegistry()
+	for _, m := range []*testModule{
+		{name: "c", enabled: true},
+		{name: "a", enabled: true},
+		{name: "b"},
+	} {
+		m.calls = &calls
+		if err := r.Register(m); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := r.Register(&testModule{name: "a", calls: &calls}); err == nil {
+		t.Error("expected an error registering a duplicate module")
+	}
+
+	deps := new(Deps)
+	if err := r.Init(deps); err != nil {
+		t.Fatal(err)
+	}
+	if !deps.ModuleEnabled("a") || deps.ModuleEnabled("b") || deps.ModuleEnabled("d") {
+		t.Error("unexpected enabled modules")
+	}
+	if err := r.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(r.Health()) != 2 {
+		t.Errorf("expected the health of 2 modules, got %v", r.Health())
+	}
+	r.Stop()
+
+	want := []string{"init a", "init c", "start a", "start c", "stop c", "stop a"}
+	if !reflect.DeepEqual(calls, want) {
+		t.Errorf("calls = %v, want %v", calls, want)
+	}
+}
+
+func TestRegistryStartFailure(t *testing.T) {
+	var calls []string
+	r := NewRegistry()
+	for _, m := range []*testModule{
+		{name: "a", enabled: true},
+		{name: "b", enabled: true, startErr: errors.New("boom")},
+		{name: "c", enabled: true},
+	} {
+		m.calls = &calls
+		if err := r.Register(m); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := r.Init(new(Deps)); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Start(context.Background()); err == nil {
+		t.Fatal("expected start to fail")
+	}
+	r.Stop()
+
+	want := []string{"init a", "init b", "init c", "start a", "start b", "stop a"}
+	if !reflect.DeepEqual(calls, want) {
+		t.Errorf("calls = %v, want %v", calls, want)
+	}
+}
+
+func TestRegistryDependencies(t *testing.T) {
+	var calls []string
+	r := NewRegistry()
+	// The sync and retention modules read the tables of the collectors and
+	// must stop before them.
+	for _, m := range []*testModule{
+		{name: "retention", enabled: true, deps: []string{"sync", "pow", "vsp"}},
+		{name: "sync", enabled: true, deps: []string{"vsp", "exchanges"}},
+		{name: "pow", enabled: true},
+		{name: "vsp", enabled: true},
+		{name: "attackcost", enabled: true},
+	} {
+		m.calls = &calls
+		if err := r.Register(m); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := r.Init(new(Deps)); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	calls = nil
+	r.Stop()
+
+	want := []string{"stop retention", "stop sync", "stop vsp", "stop pow", "stop attackcost"}
+	if !reflect.DeepEqual(calls, want) {
+		t.Errorf("calls = %v, want %v", calls, want)
+	}
+}
+
+func TestRegistryDependencyCycle(t *testing.T) {
+	var calls []string
+	r := NewRegistry()
+	for _, m := range []*testModule{
+		{name: "a", enabled: true, deps: []string{"b"}},
+		{name: "b", enabled: true, deps: []string{"c"}},
+		{name: "c", enabled: true, deps: []string{"a"}},
+	} {
+		m.calls = &calls
+		if err := r.Register(m); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := r.Init(new(Deps)); err == nil {
+		t.Fatal("expected an error for the dependency cycle")
+	}
+	if len(calls) != 0 {
+		t.Errorf("calls = %v, want none", calls)
+	}
+}
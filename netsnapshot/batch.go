@@ -0,0 +1,140 @@
+package netsnapshot
+
+import (
+	"context"
+	"time"
+)
+
+// BatchStore is implemented by the data stores that write the crawled nodes
+// and heartbeats in bulk. The taker then keeps them in a batch, written once
+// it is full or the flush interval elapsed, instead of writing every node.
+type BatchStore interface {
+	// BatchConfig returns the number of rows of a batch and the longest
+	// time a partial batch is kept.
+	BatchConfig() (batchSize int, flushInterval time.Duration)
+	// SaveNetworkPeers merges the nodes like UpdateNode and the heartbeats
+	// like SaveHeartbeat.
+	SaveNetworkPeers(ctx context.Context, peers []NetworkPeer, heartbeats []Heartbeat) error
+	// LocatedNodes returns the addresses of the stored nodes with a location.
+	LocatedNodes(ctx context.Context) ([]string, error)
+}
+
+type heartbeatKey struct {
+	timestamp int64
+	address   string
+}
+
+// peerBatch holds the nodes and heartbeats to write, at most one of each per
+// node and snapshot. It also keeps the addresses of the nodes located, stored
+// or in the batch, so the crawled nodes are geolocated once and without a
+// lookup per node.
+type peerBatch struct {
+	store      BatchStore
+	size       int
+	peers      map[string]NetworkPeer
+	heartbeats map[heartbeatKey]Heartbeat
+	located    map[string]struct{}
+}
+
+func newPeerBatch(store BatchStore, size int) *peerBatch {
+	if size < 1 {
+		size = 1
+	}
+	return &peerBatch{
+		store:      store,
+		size:       size,
+		peers:      make(map[string]NetworkPeer, size),
+		heartbeats: make(map[heartbeatKey]Heartbeat, size),
+		located:    make(map[string]struct{}),
+	}
+}
+
+// loadLocated replaces the located nodes with the stored ones, and those of
+// the batch.
+func (b *peerBatch) loadLocated(ctx context.Context) error {
+	addresses, err := b.store.LocatedNodes(ctx)
+	if err != nil {
+		return err
+	}
+	b.located = make(map[string]struct{}, len(addresses))
+	for _, address := range addresses {
+		b.located[address] = struct{}{}
+	}
+	for address, peer := range b.peers {
+		if peer.CountryName != "" {
+			b.located[address] = struct{}{}
+		}
+	}
+	return nil
+}
+
+// isLocated reports whether the location of the node is stored or in the
+// batch.
+func (b *peerBatch) isLocated(address string) bool {
+	_, found := b.located[address]
+	return found
+}
+
+// add adds the node and its heartbeat, merging them with those of the batch
+// the way the database merges them with the stored ones.
+func (b *peerBatch) add(peer NetworkPeer, heartbeat Heartbeat) {
+	if old, found := b.peers[peer.Address]; found {
+		if peer.CountryName == "" {
+			peer.IPInfo = old.IPInfo
+			peer.IPVersion = old.IPVersion
+		}
+		if peer.ConnectionTime == 0 {
+			peer.ConnectionTime = old.ConnectionTime
+		}
+	}
+	b.peers[peer.Address] = peer
+	if peer.CountryName != "" {
+		b.located[peer.Address] = struct{}{}
+	}
+
+	key := heartbeatKey{heartbeat.Timestamp, heartbeat.Address}
+	if old, found := b.heartbeats[key]; found {
+		if heartbeat.LastSeen == 0 {
+			heartbeat.LastSeen = old.LastSeen
+		}
+		if heartbeat.Latency == 0 {
+			heartbeat.Latency = old.Latency
+		}
+		if heartbeat.CurrentHeight == 0 {
+			heartbeat.CurrentHeight = old.CurrentHeight
+		}
+	}
+	b.heartbeats[key] = heartbeat
+}
+
+func (b *peerBatch) full() bool {
+	return len(b.heartbeats) >= b.size
+}
+
+func (b *peerBatch) empty() bool {
+	return len(b.heartbeats) == 0 && len(b.peers) == 0
+}
+
+// flush writes the batch and returns the number of heartbeats written. The
+// batch is emptied even if the write fails, a failed batch is not retried but
+// its nodes are located again when next crawled.
+func (b *peerBatch) flush(ctx context.Context) (int, error) {
+	peers := make([]NetworkPeer, 0, len(b.peers))
+	for _, peer := range b.peers {
+		peers = append(peers, peer)
+	}
+	heartbeats := make([]Heartbeat, 0, len(b.heartbeats))
+	for _, heartbeat := range b.heartbeats {
+		heartbeats = append(heartbeats, heartbeat)
+	}
+	b.peers = make(map[string]NetworkPeer, b.size)
+	b.heartbeats = make(map[heartbeatKey]Heartbeat, b.size)
+
+	if err := b.store.SaveNetworkPeers(ctx, peers, heartbeats); err != nil {
+		for _, peer := range peers {
+			delete(b.located, peer.Address)
+		}
+		return 0, err
+	}
+	return len(heartbeats), nil
+}
@@ -0,0 +1,183 @@
+package netsnapshot
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+// batchStore is a BatchStore recording the written batches. The DataStore
+// methods the taker is not expected to call panic.
+type batchStore struct {
+	DataStore
+	size    int
+	located []string
+	fail    bool
+
+	mtx        sync.Mutex
+	peers      [][]NetworkPeer
+	heartbeats [][]Heartbeat
+	snapshots  []SnapShot
+}
+
+func (s *batchStore) BatchConfig() (int, time.Duration) { return s.size, time.Hour }
+
+func (s *batchStore) LocatedNodes(context.Context) ([]string, error) { return s.located, nil }
+
+func (s *batchStore) SaveNetworkPeers(_ context.Context, peers []NetworkPeer, heartbeats []Heartbeat) error {
+	if s.fail {
+		return errors.New("write failed")
+	}
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.peers = append(s.peers, peers)
+	s.heartbeats = append(s.heartbeats, heartbeats)
+	return nil
+}
+
+func (s *batchStore) LastSnapshot(context.Context) (*SnapShot, error) {
+	return nil, errors.New("no snapshot")
+}
+
+func (s *batchStore) SaveSnapshot(_ context.Context, snapshot SnapShot) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.snapshots = append(s.snapshots, snapshot)
+	return nil
+}
+
+func (s *batchStore) batches() [][]Heartbeat {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	return append([][]Heartbeat(nil), s.heartbeats...)
+}
+
+func TestPeerBatchMerge(t *testing.T) {
+	b := newPeerBatch(&batchStore{}, 10)
+	located := NetworkPeer{Address: "192.0.2.1", ConnectionTime: 100, IPVersion: 4,
+		IPInfo: IPInfo{CountryName: "Nowhere", City: "Nocity"}}
+	b.add(located, Heartbeat{Timestamp: 1, Address: "192.0.2.1", LastSeen: 10, Latency: 5, CurrentHeight: 7})
+	// The next crawl of the node in the snapshot is not located again and
+	// has no connection time or latency.
+	b.add(NetworkPeer{Address: "192.0.2.1", UserAgent: "/dcrd:1.7.0/"},
+		Heartbeat{Timestamp: 1, Address: "192.0.2.1", LastSeen: 20})
+
+	peer := b.peers["192.0.2.1"]
+	if peer.CountryName != "Nowhere" || peer.City != "Nocity" || peer.IPVersion != 4 || peer.ConnectionTime != 100 ||
+		peer.UserAgent != "/dcrd:1.7.0/" {
+		t.Errorf("unexpected merged node %+v", peer)
+	}
+	heartbeat := b.heartbeats[heartbeatKey{1, "192.0.2.1"}]
+	if heartbeat.LastSeen != 20 || heartbeat.Latency != 5 || heartbeat.CurrentHeight != 7 {
+		t.Errorf("unexpected merged heartbeat %+v", heartbeat)
+	}
+	if len(b.heartbeats) != 1 || b.full() {
+		t.Errorf("got %d heartbeats, want the merged one", len(b.heartbeats))
+	}
+}
+
+func TestPeerBatchFlush(t *testing.T) {
+	store := &batchStore{}
+	b := newPeerBatch(store, 2)
+	b.add(NetworkPeer{Address: "192.0.2.1"}, Heartbeat{Timestamp: 1, Address: "192.0.2.1"})
+	if b.full() {
+		t.Fatal("the batch is full after 1 heartbeat of 2")
+	}
+	// The heartbeats of another snapshot are distinct.
+	b.add(NetworkPeer{Address: "192.0.2.1"}, Heartbeat{Timestamp: 2, Address: "192.0.2.1"})
+	if !b.full() {
+		t.Fatal("the batch is not full after 2 heartbeats of 2")
+	}
+
+	n, err := b.flush(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 || len(store.peers) != 1 || len(store.peers[0]) != 1 || len(store.heartbeats[0]) != 2 {
+		t.Errorf("flushed %d heartbeats, stored %v %v", n, store.peers, store.heartbeats)
+	}
+	if !b.empty() {
+		t.Error("the batch is not empty after the flush")
+	}
+}
+
+func TestPeerBatchLocated(t *testing.T) {
+	store := &batchStore{located: []string{"192.0.2.1"}}
+	b := newPeerBatch(store, 10)
+	if err := b.loadLocated(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if !b.isLocated("192.0.2.1") || b.isLocated("192.0.2.2") {
+		t.Fatal("the stored locations are not loaded")
+	}
+	b.add(NetworkPeer{Address: "192.0.2.2", IPInfo: IPInfo{CountryName: "Nowhere"}},
+		Heartbeat{Timestamp: 1, Address: "192.0.2.2"})
+	if !b.isLocated("192.0.2.2") {
+		t.Error("the location of the batch is not kept")
+	}
+	// Reloading keeps the locations not written yet.
+	if err := b.loadLocated(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if !b.isLocated("192.0.2.2") {
+		t.Error("the location of the batch is lost by the reload")
+	}
+
+	// The nodes of a failed batch are located again.
+	store.fail = true
+	if _, err := b.flush(context.Background()); err == nil {
+		t.Fatal("the failed write is not reported")
+	}
+	if b.isLocated("192.0.2.2") {
+		t.Error("the location of the failed batch is kept")
+	}
+}
+
+func TestRunBatches(t *testing.T) {
+	store := &batchStore{size: 2, located: []string{"192.0.2.1", "192.0.2.2", "192.0.2.3"}}
+	amgr = &Manager{
+		nodes:        make(map[string]*Node),
+		peerNtfn:     make(chan *Node),
+		attemptNtfn:  make(chan attemptedPeer),
+		connFailNtfn: make(chan net.IP),
+		quit:         make(chan struct{}, 1),
+	}
+	tk := &taker{dataStore: store, cfg: NetworkSnapshotOptions{SnapshotInterval: 60}}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		tk.run(ctx)
+		close(done)
+	}()
+
+	// The located nodes are written in batches without being looked up,
+	// FindNode panics.
+	for _, ip := range []string{"192.0.2.1", "192.0.2.2", "192.0.2.3"} {
+		amgr.peerNtfn <- &Node{IP: net.ParseIP(ip), CurrentHeight: 100}
+	}
+	if batches := store.batches(); len(batches) != 1 || len(batches[0]) != 2 {
+		t.Fatalf("got batches %v, want a full batch of 2", batches)
+	}
+
+	// The partial batch is written on shutdown.
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the taker did not stop")
+	}
+	if batches := store.batches(); len(batches) != 2 || len(batches[1]) != 1 {
+		t.Errorf("got batches %v, want the partial batch written on shutdown", batches)
+	}
+	if n := len(store.snapshots); n != 2 || store.snapshots[n-1].Height != 100 {
+		t.Errorf("got snapshots %+v, want one per batch", store.snapshots)
+	}
+	select {
+	case <-amgr.quit:
+	default:
+		t.Error("the seeder is not stopped")
+	}
+}
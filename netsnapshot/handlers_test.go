@@ -0,0 +1,73 @@
+package netsnapshot_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/planetdecred/pdanalytics/memdb"
+	"github.com/planetdecred/pdanalytics/netsnapshot"
+	"github.com/planetdecred/pdanalytics/testutil"
+)
+
+func TestSnapshotHandlers(t *testing.T) {
+	ctx := context.Background()
+	db := memdb.New()
+	const timestamp = 1600000000
+	nodes := []netsnapshot.NetworkPeer{
+		{Address: "10.0.0.1", UserAgent: "/dcrwire:0.4.0/dcrd:1.6.0/", ConnectionTime: 1590000000, IPVersion: 4},
+		{Address: "10.0.0.2", UserAgent: "/dcrwire:0.4.0/dcrd:1.6.0/", ConnectionTime: 1580000000, IPVersion: 4},
+		{Address: "10.0.0.3", UserAgent: "/dcrwire:0.3.0/dcrd:1.5.1/", ConnectionTime: 1595000000, IPVersion: 4},
+	}
+	for i, node := range nodes {
+		if err := db.SaveNode(ctx, node); err != nil {
+			t.Fatal(err)
+		}
+		err := db.SaveHeartbeat(ctx, netsnapshot.Heartbeat{
+			Timestamp: timestamp,
+			Address:   node.Address,
+			Latency:   100 * (i + 1),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.SaveSnapshot(ctx, netsnapshot.SnapShot{Timestamp: timestamp, Height: 500000, NodeCount: 3}); err != nil {
+		t.Fatal(err)
+	}
+
+	server := testutil.NewServer(t)
+	err := netsnapshot.Activate(ctx, db, netsnapshot.NetworkSnapshotOptions{EnableNetworkSnapshotHTTP: true}, server.Server, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var snapshots struct {
+		Data  []netsnapshot.SnapShot `json:"data"`
+		Total int64                  `json:"total"`
+	}
+	server.GetJSON("/api/snapshots", &snapshots)
+	if snapshots.Total != 1 || len(snapshots.Data) != 1 {
+		t.Fatalf("got %d of %d snapshots, want 1", len(snapshots.Data), snapshots.Total)
+	}
+	snapshot := snapshots.Data[0]
+	if snapshot.ReachableNodeCount != 3 || snapshot.OldestNode != "10.0.0.2" || snapshot.Latency != 200 {
+		t.Errorf("unexpected snapshot %+v", snapshot)
+	}
+
+	var userAgents struct {
+		UserAgents []netsnapshot.UserAgentInfo `json:"userAgents"`
+	}
+	server.GetJSON("/api/snapshots/user-agents", &userAgents)
+	if len(userAgents.UserAgents) != 2 {
+		t.Fatalf("got %d user agents, want 2", len(userAgents.UserAgents))
+	}
+	if top := userAgents.UserAgents[0]; top.UserAgent != "/dcrwire:0.4.0/dcrd:1.6.0/" || top.Nodes != 2 {
+		t.Errorf("unexpected top user agent %+v", top)
+	}
+
+	var versions []string
+	server.GetJSON("/api/snapshot/node-versions", &versions)
+	if len(versions) != 2 {
+		t.Errorf("got node versions %v, want 2", versions)
+	}
+}
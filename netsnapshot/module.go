@@ -0,0 +1,77 @@
+package netsnapshot
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/decred/slog"
+	"github.com/planetdecred/pdanalytics/module"
+	"github.com/planetdecred/pdanalytics/web"
+)
+
+const (
+	defaultSnapshotInterval         = 720
+	defaultSeeder                   = "127.0.0.1"
+	defaultSeederPort               = 9108
+	defaultMaxPeerConnectionFailure = 3
+)
+
+type snapshotModule struct {
+	options NetworkSnapshotOptions
+	server  *web.Server
+	store   DataStore
+	health  *module.HealthTracker
+}
+
+func init() {
+	module.Register(&snapshotModule{
+		options: NetworkSnapshotOptions{
+			EnableNetworkSnapshot:     true,
+			EnableNetworkSnapshotHTTP: true,
+			SnapshotInterval:          defaultSnapshotInterval,
+			Seeder:                    defaultSeeder,
+			SeederPort:                defaultSeederPort,
+			MaxPeerConnectionFailure:  defaultMaxPeerConnectionFailure,
+		},
+	})
+}
+
+func (m *snapshotModule) Name() string                 { return "netsnapshot" }
+func (m *snapshotModule) LogSubsystem() string         { return "NETS" }
+func (m *snapshotModule) UseLogger(logger slog.Logger) { UseLogger(logger) }
+func (m *snapshotModule) Options() interface{}         { return &m.options }
+
+func (m *snapshotModule) Enabled() bool {
+	return m.options.EnableNetworkSnapshot || m.options.EnableNetworkSnapshotHTTP
+}
+
+func (m *snapshotModule) Init(deps *module.Deps) error {
+	db, err := deps.DB()
+	if err != nil {
+		return err
+	}
+	store, ok := db.(DataStore)
+	if !ok {
+		return fmt.Errorf("%T is not a netsnapshot.DataStore", db)
+	}
+	m.server = deps.Server
+	m.store = store
+	return nil
+}
+
+func (m *snapshotModule) Start(ctx context.Context) error {
+	m.health = module.NewHealthTracker(time.Duration(m.options.SnapshotInterval) * time.Minute)
+	return Activate(ctx, m.store, m.options, m.server, m.health)
+}
+
+func (m *snapshotModule) Stop() error { return nil }
+
+// Health reports the outcome of the last snapshot. The module is always
+// healthy when it only serves the pages.
+func (m *snapshotModule) Health() module.Health {
+	if !m.options.EnableNetworkSnapshot {
+		return module.Healthy
+	}
+	return m.health.Health()
+}
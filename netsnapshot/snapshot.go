@@ -17,6 +17,8 @@ import (
 	"time"
 
 	"github.com/decred/dcrd/chaincfg/v2"
+	"github.com/planetdecred/pdanalytics/metrics"
+	"github.com/planetdecred/pdanalytics/module"
 	"github.com/planetdecred/pdanalytics/web"
 )
 
@@ -26,12 +28,16 @@ func Snapshotinterval() int {
 	return snapshotinterval
 }
 
-func Activate(ctx context.Context, store DataStore, cfg NetworkSnapshotOptions, server *web.Server) error {
+// Activate starts the snapshot taker and adds the http handlers as enabled in
+// cfg. The outcome of the snapshots is recorded in health.
+func Activate(ctx context.Context, store DataStore, cfg NetworkSnapshotOptions, server *web.Server,
+	health *module.HealthTracker) error {
 	snapshotinterval = cfg.SnapshotInterval
 	t := &taker{
 		dataStore: store,
 		server:    server,
 		cfg:       cfg,
+		health:    health,
 	}
 
 	if cfg.EnableNetworkSnapshot {
@@ -65,6 +71,13 @@ func (t *taker) Start(ctx context.Context) {
 		os.Exit(1)
 	}
 
+	go runSeeder(t.cfg, netParams)
+	t.run(ctx)
+}
+
+// run records the nodes crawled by the seeder, notified by amgr, until ctx is
+// canceled. A snapshot is taken every snapshot interval.
+func (t *taker) run(ctx context.Context) {
 	// update all reachable nodes
 	loadLiveNodes := func() {
 		nodes, err := t.dataStore.GetAvailableNodes(ctx)
@@ -77,8 +90,6 @@ func (t *taker) Start(ctx context.Context) {
 	// enqueue previous known ips
 	// loadLiveNodes()
 
-	go runSeeder(t.cfg, netParams)
-
 	var mtx sync.Mutex
 	var bestBlockHeight int64
 
@@ -106,6 +117,50 @@ func (t *taker) Start(ctx context.Context) {
 		}
 	}
 
+	// The nodes and heartbeats are written in batches when the store
+	// supports it, and the snapshot is updated after every batch.
+	var batch *peerBatch
+	flushTicker := &time.Ticker{}
+	if store, ok := t.dataStore.(BatchStore); ok {
+		batchSize, flushInterval := store.BatchConfig()
+		batch = newPeerBatch(store, batchSize)
+		flushTicker = time.NewTicker(flushInterval)
+		defer flushTicker.Stop()
+	}
+	// The located nodes are loaded once per snapshot.
+	loadLocatedNodes := func() {
+		if batch == nil {
+			return
+		}
+		if err := batch.loadLocated(ctx); err != nil {
+			log.Errorf("Error in loading the located nodes, %s", err.Error())
+		}
+	}
+	loadLocatedNodes()
+	flushBatch := func(ctx context.Context) {
+		if batch == nil || batch.empty() {
+			return
+		}
+		n, err := batch.flush(ctx)
+		if err != nil {
+			log.Errorf("Error in saving node info, %s.", err.Error())
+			return
+		}
+		mtx.Lock()
+		defer mtx.Unlock()
+		count += n
+		err = t.dataStore.SaveSnapshot(ctx, SnapShot{
+			Timestamp: timestamp,
+			Height:    bestBlockHeight,
+			NodeCount: len(amgr.nodes),
+		})
+		if err != nil {
+			t.dataStore.DeleteSnapshot(ctx, timestamp)
+			log.Errorf("Error in saving network snapshot, %s", err.Error())
+		}
+		log.Debugf("Recorded a batch of %d heartbeats", n)
+	}
+
 	ticker := time.NewTicker(time.Duration(t.cfg.SnapshotInterval) * time.Minute)
 	defer ticker.Stop()
 
@@ -113,20 +168,27 @@ func (t *taker) Start(ctx context.Context) {
 		// start listening for node heartbeat
 		select {
 		case <-ticker.C:
+			flushBatch(ctx)
+			start := time.Now()
+			nodeCount := len(amgr.nodes)
 			err := t.dataStore.SaveSnapshot(ctx, SnapShot{
 				Timestamp: timestamp,
 				Height:    bestBlockHeight,
-				NodeCount: len(amgr.nodes),
+				NodeCount: nodeCount,
 			})
 
 			if err != nil {
 				t.dataStore.DeleteSnapshot(ctx, timestamp)
 				log.Errorf("Error in saving network snapshot, %s", err.Error())
+			} else {
+				log.Info("UpdateSnapshotNodesBin")
+				if err = t.dataStore.UpdateSnapshotNodesBin(ctx); err != nil {
+					log.Errorf("Error in initial network snapshot bin update, %s", err.Error())
+				}
 			}
-			log.Info("UpdateSnapshotNodesBin")
-			if err = t.dataStore.UpdateSnapshotNodesBin(ctx); err != nil {
-				log.Errorf("Error in initial network snapshot bin update, %s", err.Error())
-			}
+			t.health.Done(err)
+			metrics.ObserveCollectorRun("netsnapshot", time.Since(start), err)
+			metrics.NetworkNodes.Set(float64(nodeCount))
 
 			mtx.Lock()
 			count = 0
@@ -135,6 +197,10 @@ func (t *taker) Start(ctx context.Context) {
 			mtx.Unlock()
 			// update all reachable nodes
 			loadLiveNodes()
+			loadLocatedNodes()
+
+		case <-flushTicker.C:
+			flushBatch(ctx)
 
 		case node := <-amgr.peerNtfn:
 			if node.IP.String() == "127.0.0.1" { // do not add the local IP
@@ -156,26 +222,17 @@ func (t *taker) Start(ctx context.Context) {
 				Latency:         int(node.Latency),
 			}
 
-			if oldRec, _ := t.dataStore.FindNode(ctx, networkPeer.Address); oldRec != nil {
-				if oldRec.CountryName == "" {
-					geoLoc, err := t.geolocation(ctx, node.IP)
-					if err == nil {
-						networkPeer.IPInfo = *geoLoc
-						networkPeer.CountryName = geoLoc.CountryName
-						if geoLoc.Type == "ipv4" {
-							networkPeer.IPVersion = 4
-						} else if geoLoc.Type == "ipv6" {
-							networkPeer.IPVersion = 6
-						}
-					} else {
-						log.Error(err)
-					}
-				}
-				err = t.dataStore.UpdateNode(ctx, networkPeer)
-				if err != nil {
-					log.Errorf("Error in saving node info, %s.", err.Error())
-				}
+			// The batched nodes are merged with the stored ones, they are
+			// only looked up to be located.
+			var oldRec *NetworkPeer
+			var located bool
+			if batch != nil {
+				located = batch.isLocated(networkPeer.Address)
 			} else {
+				oldRec, _ = t.dataStore.FindNode(ctx, networkPeer.Address)
+				located = oldRec != nil && oldRec.CountryName != ""
+			}
+			if !located {
 				geoLoc, err := t.geolocation(ctx, node.IP)
 				if err == nil {
 					networkPeer.IPInfo = *geoLoc
@@ -188,19 +245,37 @@ func (t *taker) Start(ctx context.Context) {
 				} else {
 					log.Error(err)
 				}
-
-				err = t.dataStore.SaveNode(ctx, networkPeer)
-				if err != nil {
-					log.Errorf("Error in saving node info, %s.", err.Error())
-				}
 			}
-
-			err = t.dataStore.SaveHeartbeat(ctx, Heartbeat{
+			heartbeat := Heartbeat{
 				Timestamp: timestamp,
 				Address:   node.IP.String(),
 				LastSeen:  node.LastSeen.UTC().Unix(),
 				Latency:   int(node.Latency),
-			})
+			}
+
+			if batch != nil {
+				mtx.Lock()
+				if node.CurrentHeight > bestBlockHeight {
+					bestBlockHeight = node.CurrentHeight
+				}
+				mtx.Unlock()
+				batch.add(networkPeer, heartbeat)
+				if batch.full() {
+					flushBatch(ctx)
+				}
+				break
+			}
+
+			if oldRec != nil {
+				err = t.dataStore.UpdateNode(ctx, networkPeer)
+			} else {
+				err = t.dataStore.SaveNode(ctx, networkPeer)
+			}
+			if err != nil {
+				log.Errorf("Error in saving node info, %s.", err.Error())
+			}
+
+			err = t.dataStore.SaveHeartbeat(ctx, heartbeat)
 			if err != nil {
 				log.Errorf("Error in saving node info, %s.", err.Error())
 			} else {
@@ -239,6 +314,8 @@ func (t *taker) Start(ctx context.Context) {
 			}
 
 		case <-ctx.Done():
+			// The pending batch is written before shutting down.
+			flushBatch(context.Background())
 			log.Info("Shutting down network seeder")
 			amgr.quit <- struct{}{}
 			return
@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/decred/dcrd/wire"
+	"github.com/planetdecred/pdanalytics/module"
 	"github.com/planetdecred/pdanalytics/web"
 )
 
@@ -172,4 +173,5 @@ type taker struct {
 	dataStore DataStore
 	cfg       NetworkSnapshotOptions
 	server    *web.Server
+	health    *module.HealthTracker
 }
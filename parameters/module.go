@@ -0,0 +1,50 @@
+package parameters
+
+import (
+	"context"
+
+	"github.com/decred/slog"
+	"github.com/planetdecred/pdanalytics/dcrd"
+	"github.com/planetdecred/pdanalytics/module"
+	"github.com/planetdecred/pdanalytics/web"
+)
+
+// ParametersOptions are the config options of the chain parameters module.
+type ParametersOptions struct {
+	EnableChainParameters bool `long:"parameters" description:"Enable/Disables the chain parameter component."`
+}
+
+type parametersModule struct {
+	options ParametersOptions
+	client  *dcrd.Dcrd
+	server  *web.Server
+}
+
+func init() {
+	module.Register(&parametersModule{
+		options: ParametersOptions{
+			EnableChainParameters: true,
+		},
+	})
+}
+
+func (m *parametersModule) Name() string                 { return "parameters" }
+func (m *parametersModule) LogSubsystem() string         { return "PARA" }
+func (m *parametersModule) UseLogger(logger slog.Logger) { UseLogger(logger) }
+func (m *parametersModule) Options() interface{}         { return &m.options }
+func (m *parametersModule) Enabled() bool                { return m.options.EnableChainParameters }
+
+func (m *parametersModule) Init(deps *module.Deps) error {
+	m.client = deps.Dcrd
+	m.server = deps.Server
+	return nil
+}
+
+func (m *parametersModule) Start(ctx context.Context) error {
+	_, err := New(m.client, m.server)
+	return err
+}
+
+func (m *parametersModule) Stop() error { return nil }
+
+func (m *parametersModule) Health() module.Health { return module.Healthy }
@@ -0,0 +1,343 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/lib/pq"
+	"github.com/planetdecred/pdanalytics/backup"
+	"github.com/volatiletech/sqlboiler/v4/boil"
+)
+
+const (
+	selectTableColumns = `SELECT column_name FROM information_schema.columns
+		WHERE table_schema = current_schema() AND table_name = $1 ORDER BY ordinal_position`
+
+	selectSerialColumns = `SELECT column_name FROM information_schema.columns
+		WHERE table_schema = current_schema() AND table_name = $1 AND column_default LIKE 'nextval(%'`
+)
+
+// tableColumns returns the columns of the table in their order.
+func tableColumns(ctx context.Context, exec boil.ContextExecutor, table string) ([]string, error) {
+	rows, err := exec.QueryContext(ctx, selectTableColumns, table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var columns []string
+	for rows.Next() {
+		var column string
+		if err = rows.Scan(&column); err != nil {
+			return nil, err
+		}
+		columns = append(columns, column)
+	}
+	return columns, rows.Err()
+}
+
+// Backup writes the tables of the named modules, or of all the modules when
+// none is named, to an archive with the manifest. The tables are read in a
+// single repeatable read transaction, a consistent snapshot of the database.
+func (pg *PgDb) Backup(ctx context.Context, w io.Writer, manifest *backup.Manifest, modules ...string) error {
+	if _, err := ModuleTables(modules...); err != nil {
+		return err
+	}
+	wanted := make(map[string]bool, len(modules))
+	for _, module := range modules {
+		wanted[module] = true
+	}
+	versions, err := pg.schemaVersions(ctx)
+	if err != nil {
+		return err
+	}
+
+	tx, err := pg.db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	manifest.Modules = nil
+	for _, mt := range createTableScripts {
+		if len(modules) > 0 && !wanted[mt.module] {
+			continue
+		}
+		module := backup.Module{Name: mt.module, SchemaVersion: versions[mt.module]}
+		for _, t := range mt.tables {
+			if !pg.TableExists(t.name) {
+				continue
+			}
+			table, err := backupTableInfo(ctx, tx, t.name)
+			if err != nil {
+				return fmt.Errorf("cannot describe the %s table: %v", t.name, err)
+			}
+			module.Tables = append(module.Tables, table)
+		}
+		manifest.Modules = append(manifest.Modules, module)
+	}
+
+	bw, err := backup.NewWriter(w, manifest)
+	if err != nil {
+		return err
+	}
+	for _, module := range manifest.Modules {
+		for _, table := range module.Tables {
+			if err = backupTable(ctx, tx, table, bw); err != nil {
+				return fmt.Errorf("cannot back up the %s table: %v", table.Name, err)
+			}
+			log.Infof("Backed up %d rows of the %s table", table.Rows, table.Name)
+		}
+	}
+	return bw.Close()
+}
+
+// backupTableInfo returns the columns, row count and time range of a table.
+func backupTableInfo(ctx context.Context, tx *sql.Tx, name string) (backup.Table, error) {
+	table := backup.Table{Name: name}
+	var err error
+	if table.Columns, err = tableColumns(ctx, tx, name); err != nil {
+		return table, err
+	}
+	timeColumn, found := tableTimeColumns[name]
+	if !found {
+		err = tx.QueryRowContext(ctx, fmt.Sprintf("SELECT COUNT(*) FROM %s", pq.QuoteIdentifier(name))).
+			Scan(&table.Rows)
+		return table, err
+	}
+	var from, to sql.NullTime
+	err = tx.QueryRowContext(ctx, fmt.Sprintf("SELECT COUNT(*), MIN(%s), MAX(%s) FROM %s",
+		timeColumn, timeColumn, pq.QuoteIdentifier(name))).Scan(&table.Rows, &from, &to)
+	if from.Valid && to.Valid {
+		fromUTC, toUTC := from.Time.UTC(), to.Time.UTC()
+		table.From, table.To = &fromUTC, &toUTC
+	}
+	return table, err
+}
+
+// backupTable writes the rows of the table as the text of their values, which
+// COPY reads back whatever the column types.
+func backupTable(ctx context.Context, tx *sql.Tx, table backup.Table, bw *backup.Writer) error {
+	if err := bw.BeginTable(table.Name); err != nil {
+		return err
+	}
+	selects := make([]string, len(table.Columns))
+	for i, column := range table.Columns {
+		selects[i] = pq.QuoteIdentifier(column) + "::text"
+	}
+	rows, err := tx.QueryContext(ctx, fmt.Sprintf("SELECT %s FROM %s", strings.Join(selects, ", "),
+		pq.QuoteIdentifier(table.Name)))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	scanned := make([]sql.NullString, len(table.Columns))
+	dest := make([]interface{}, len(scanned))
+	for i := range scanned {
+		dest[i] = &scanned[i]
+	}
+	values := make([]*string, len(scanned))
+	for rows.Next() {
+		if err = rows.Scan(dest...); err != nil {
+			return err
+		}
+		for i := range scanned {
+			values[i] = nil
+			if scanned[i].Valid {
+				values[i] = &scanned[i].String
+			}
+		}
+		if err = bw.WriteRow(values); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// Restore copies the tables of the named modules, or of all the modules of
+// the archive when none is named, from the archive into their empty tables,
+// in a single transaction. The tables must exist at a schema version not older
+// than the one of the archive.
+func (pg *PgDb) Restore(ctx context.Context, r *backup.Reader, modules ...string) error {
+	manifest := r.Manifest()
+	wanted := make(map[string]bool)
+	for _, module := range manifest.Modules {
+		wanted[module.Name] = len(modules) == 0
+	}
+	for _, name := range modules {
+		if _, found := wanted[name]; !found {
+			return fmt.Errorf("the backup has no %s tables", name)
+		}
+		wanted[name] = true
+	}
+
+	versions, err := pg.schemaVersions(ctx)
+	if err != nil {
+		return err
+	}
+	tables := make(map[string]backup.Table)
+	for _, module := range manifest.Modules {
+		if !wanted[module.Name] {
+			continue
+		}
+		if module.SchemaVersion > versions[module.Name] {
+			return fmt.Errorf("the %s tables of the backup are at schema version %d but the database is at "+
+				"version %d, upgrade pdanalytics", module.Name, module.SchemaVersion, versions[module.Name])
+		}
+		for _, table := range module.Tables {
+			if err = pg.checkRestoreTable(ctx, table); err != nil {
+				return err
+			}
+			tables[table.Name] = table
+		}
+	}
+
+	tx, err := pg.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for {
+		name, err := r.NextTable()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		table, found := tables[name]
+		if !found {
+			continue
+		}
+		copied, err := restoreTable(ctx, tx, table, r)
+		if err != nil {
+			return fmt.Errorf("cannot restore the %s table: %v", name, err)
+		}
+		if copied != table.Rows {
+			return fmt.Errorf("restored %d rows of the %s table, the backup lists %d", copied, name, table.Rows)
+		}
+		delete(tables, name)
+		log.Infof("Restored %d rows of the %s table", copied, name)
+	}
+	if len(tables) > 0 {
+		missing := make([]string, 0, len(tables))
+		for name := range tables {
+			missing = append(missing, name)
+		}
+		sort.Strings(missing)
+		return fmt.Errorf("the backup is truncated, the %s tables are missing", strings.Join(missing, ", "))
+	}
+	return tx.Commit()
+}
+
+// checkRestoreTable checks that the table is empty and has the columns of the
+// archived table.
+func (pg *PgDb) checkRestoreTable(ctx context.Context, table backup.Table) error {
+	columns, err := tableColumns(ctx, pg.db, table.Name)
+	if err != nil {
+		return err
+	}
+	if len(columns) == 0 {
+		return fmt.Errorf("the %s table does not exist", table.Name)
+	}
+	existing := make(map[string]bool, len(columns))
+	for _, column := range columns {
+		existing[column] = true
+	}
+	for _, column := range table.Columns {
+		if !existing[column] {
+			return fmt.Errorf("the %s table has no %s column", table.Name, column)
+		}
+	}
+	var hasRows bool
+	err = pg.db.QueryRowContext(ctx, fmt.Sprintf("SELECT EXISTS (SELECT 1 FROM %s)",
+		pq.QuoteIdentifier(table.Name))).Scan(&hasRows)
+	if err != nil {
+		return err
+	}
+	if hasRows {
+		return fmt.Errorf("the %s table is not empty, restore into an empty database or reset its module",
+			table.Name)
+	}
+	return nil
+}
+
+// restoreTable copies the rows of the current table of the archive and moves
+// the sequences of its serial columns past the restored values.
+func restoreTable(ctx context.Context, tx *sql.Tx, table backup.Table, r *backup.Reader) (int64, error) {
+	stmt, err := tx.PrepareContext(ctx, pq.CopyIn(table.Name, table.Columns...))
+	if err != nil {
+		return 0, err
+	}
+	var copied int64
+	values := make([]interface{}, len(table.Columns))
+	for {
+		row, err := r.ReadRow()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			stmt.Close()
+			return copied, err
+		}
+		if len(row) != len(values) {
+			stmt.Close()
+			return copied, fmt.Errorf("got a row of %d values, want %d", len(row), len(values))
+		}
+		for i, value := range row {
+			values[i] = nil
+			if value != nil {
+				values[i] = *value
+			}
+		}
+		if _, err = stmt.ExecContext(ctx, values...); err != nil {
+			stmt.Close()
+			return copied, err
+		}
+		copied++
+	}
+	if _, err = stmt.ExecContext(ctx); err != nil {
+		stmt.Close()
+		return copied, err
+	}
+	if err = stmt.Close(); err != nil {
+		return copied, err
+	}
+
+	serials, err := tableSerialColumns(ctx, tx, table.Name)
+	if err != nil {
+		return copied, err
+	}
+	for _, column := range serials {
+		_, err = tx.ExecContext(ctx, fmt.Sprintf("SELECT setval(pg_get_serial_sequence($1, $2), "+
+			"COALESCE(MAX(%s), 1), MAX(%s) IS NOT NULL) FROM %s", pq.QuoteIdentifier(column),
+			pq.QuoteIdentifier(column), pq.QuoteIdentifier(table.Name)), table.Name, column)
+		if err != nil {
+			return copied, err
+		}
+	}
+	return copied, nil
+}
+
+// tableSerialColumns returns the columns of the table set from a sequence.
+func tableSerialColumns(ctx context.Context, tx *sql.Tx, table string) ([]string, error) {
+	rows, err := tx.QueryContext(ctx, selectSerialColumns, table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var columns []string
+	for rows.Next() {
+		var column string
+		if err = rows.Scan(&column); err != nil {
+			return nil, err
+		}
+		columns = append(columns, column)
+	}
+	return columns, rows.Err()
+}
@@ -0,0 +1,342 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/planetdecred/pdanalytics/chart"
+)
+
+// binLevels are the bins kept for every series, from the finest.
+var binLevels = []string{
+	string(chart.HourBin),
+	string(chart.DayBin),
+	string(chart.WeekBin),
+	string(chart.MonthBin),
+}
+
+// timeKind is the type of the time column of a source table.
+type timeKind int
+
+const (
+	// unixTime columns hold unix timestamps in seconds.
+	unixTime timeKind = iota
+	// utcTimestamp columns are TIMESTAMP columns holding UTC times.
+	utcTimestamp
+	// timestampTZ columns are TIMESTAMPTZ columns.
+	timestampTZ
+)
+
+// utc returns the SQL expression of column as a UTC TIMESTAMP.
+func (k timeKind) utc(column string) string {
+	switch k {
+	case unixTime:
+		return fmt.Sprintf("(to_timestamp(%s) AT TIME ZONE 'UTC')", column)
+	case timestampTZ:
+		return fmt.Sprintf("(%s AT TIME ZONE 'UTC')", column)
+	default:
+		return column
+	}
+}
+
+// native converts the UTC TIMESTAMP SQL expression ts to the type of the
+// column, so that the comparisons with the column can use its indexes.
+func (k timeKind) native(ts string) string {
+	switch k {
+	case unixTime:
+		return fmt.Sprintf("EXTRACT(EPOCH FROM %s)::INT8", ts)
+	case timestampTZ:
+		return fmt.Sprintf("(%s AT TIME ZONE 'UTC')", ts)
+	default:
+		return ts
+	}
+}
+
+// binColumn is a column of a bin table and the SQL aggregate of the source
+// rows it holds.
+type binColumn struct {
+	name      string
+	aggregate string
+}
+
+func avg(column string) binColumn {
+	return binColumn{name: column, aggregate: fmt.Sprintf("AVG(%s)", column)}
+}
+
+func maxOf(column string) binColumn {
+	return binColumn{name: column, aggregate: fmt.Sprintf("MAX(%s)", column)}
+}
+
+// binSeries defines a time series and the bin table its hour, day, week and
+// month aggregates are kept in. The bin tables have a unix time column and a
+// bin column, and name the group and aggregated columns like the source
+// table. The bin table may be the source table itself, with the raw rows in
+// the default bin.
+type binSeries struct {
+	name       string
+	source     string
+	timeColumn string
+	timeKind   timeKind
+	// where filters the source rows. It may refer to the arguments passed to
+	// updateBins.
+	where string
+	// groupBy are the columns the rows are aggregated per, e.g. the source
+	// of the rows.
+	groupBy []string
+	columns []binColumn
+
+	binTable      string
+	binTimeColumn string
+	// binWhere filters the bin rows when looking for the latest bin. It may
+	// refer to the arguments passed to updateBins.
+	binWhere string
+}
+
+// updateBins adds the bins completed since the latest bin of each level. The
+// current, incomplete, bins are added once they complete.
+func (pg *PgDb) updateBins(ctx context.Context, s binSeries, args ...interface{}) error {
+	for _, level := range binLevels {
+		lastQuery := fmt.Sprintf(`SELECT MAX(%s) FROM %s WHERE bin = '%s'`, s.binTimeColumn, s.binTable, level)
+		if s.binWhere != "" {
+			lastQuery += " AND " + s.binWhere
+		}
+		var last sql.NullInt64
+		if err := pg.db.QueryRowContext(ctx, lastQuery, args...).Scan(&last); err != nil {
+			return fmt.Errorf("failed to get the last %s bin of %s: %v", level, s.name, err)
+		}
+
+		conditions := []string{fmt.Sprintf("%s < %s", s.timeColumn,
+			s.timeKind.native(fmt.Sprintf("date_trunc('%s', NOW() AT TIME ZONE 'UTC')", level)))}
+		if last.Valid {
+			conditions = append(conditions, fmt.Sprintf("%s >= %s", s.timeColumn,
+				s.timeKind.native(fmt.Sprintf("((to_timestamp(%d) AT TIME ZONE 'UTC') + INTERVAL '1 %s')", last.Int64, level))))
+		}
+		if s.where != "" {
+			conditions = append(conditions, s.where)
+		}
+
+		columns := append([]string{s.binTimeColumn, "bin"}, s.groupBy...)
+		selects := append([]string{
+			fmt.Sprintf("EXTRACT(EPOCH FROM date_trunc('%s', %s))::INT8 AS bin_start", level, s.timeKind.utc(s.timeColumn)),
+			fmt.Sprintf("'%s'", level),
+		}, s.groupBy...)
+		for _, c := range s.columns {
+			columns = append(columns, c.name)
+			selects = append(selects, c.aggregate)
+		}
+		groupBy := append([]string{"bin_start"}, s.groupBy...)
+
+		insert := fmt.Sprintf(`INSERT INTO %s (%s) SELECT %s FROM %s WHERE %s GROUP BY %s ON CONFLICT DO NOTHING`,
+			s.binTable, strings.Join(columns, ", "), strings.Join(selects, ", "), s.source,
+			strings.Join(conditions, " AND "), strings.Join(groupBy, ", "))
+		res, err := pg.db.ExecContext(ctx, insert, args...)
+		if err != nil {
+			return fmt.Errorf("failed to update the %s bins of %s: %v", level, s.name, err)
+		}
+		if added, err := res.RowsAffected(); err == nil && added > 0 {
+			log.Infof("Added %d %s bins of %s", added, level, s.name)
+		}
+	}
+	return nil
+}
+
+var (
+	mempoolSeries = binSeries{
+		name:       "mempool",
+		source:     "mempool",
+		timeColumn: "time",
+		timeKind:   utcTimestamp,
+		columns: []binColumn{
+			avg("number_of_transactions"),
+			avg("size"),
+			avg("total_fee"),
+		},
+		binTable:      "mempool_bin",
+		binTimeColumn: "time",
+	}
+
+	mempoolFeeRateSeries = binSeries{
+		name:       "mempool fee rate",
+		source:     "mempool_fee_rate",
+		timeColumn: "time",
+		timeKind:   utcTimestamp,
+		columns: []binColumn{
+			avg("fee_rate_p10"),
+			avg("fee_rate_p50"),
+			avg("fee_rate_p90"),
+		},
+		binTable:      "mempool_fee_rate_bin",
+		binTimeColumn: "time",
+	}
+
+	mempoolFeeBucketSeries = binSeries{
+		name:       "mempool fee bucket",
+		source:     "mempool_fee_bucket",
+		timeColumn: "time",
+		timeKind:   utcTimestamp,
+		groupBy:    []string{"fee_rate"},
+		columns: []binColumn{
+			avg("tx_count"),
+			avg("size"),
+		},
+		binTable:      "mempool_fee_bucket_bin",
+		binTimeColumn: "time",
+	}
+
+	mempoolTypeSeries = binSeries{
+		name:       "mempool type",
+		source:     "mempool_type",
+		timeColumn: "time",
+		timeKind:   utcTimestamp,
+		groupBy:    []string{"tx_type"},
+		columns: []binColumn{
+			avg("tx_count"),
+			avg("size"),
+			avg("fees"),
+			avg("total"),
+		},
+		binTable:      "mempool_type_bin",
+		binTimeColumn: "time",
+	}
+
+	// mempoolTxSeries bins the confirmation latency, in seconds, of the mined
+	// transactions per type.
+	mempoolTxSeries = binSeries{
+		name:       "mempool transaction",
+		source:     "mempool_tx",
+		timeColumn: "time",
+		timeKind:   utcTimestamp,
+		where:      "outcome = 'mined'",
+		groupBy:    []string{"tx_type"},
+		columns: []binColumn{
+			{name: "tx_count", aggregate: "COUNT(*)"},
+			{name: "latency", aggregate: "PERCENTILE_CONT(0.5) WITHIN GROUP (ORDER BY EXTRACT(EPOCH FROM time - first_seen_time))"},
+		},
+		binTable:      "mempool_tx_bin",
+		binTimeColumn: "time",
+	}
+
+	powSeries = binSeries{
+		name:       "PoW",
+		source:     "pow_data",
+		timeColumn: "time",
+		timeKind:   unixTime,
+		groupBy:    []string{"source"},
+		columns: []binColumn{
+			{name: "pool_hashrate", aggregate: "ROUND(AVG(NULLIF(pool_hashrate, '')::NUMERIC))::TEXT"},
+			avg("workers"),
+		},
+		binTable:      "pow_bin",
+		binTimeColumn: "time",
+	}
+
+	vspSeries = binSeries{
+		name:       "VSP",
+		source:     "vsp_tick",
+		timeColumn: "time",
+		timeKind:   timestampTZ,
+		groupBy:    []string{"vsp_id"},
+		columns: []binColumn{
+			avg("immature"),
+			avg("live"),
+			avg("voted"),
+			avg("missed"),
+			avg("pool_fees"),
+			avg("proportion_live"),
+			avg("proportion_missed"),
+			avg("user_count"),
+			avg("users_active"),
+		},
+		binTable:      "vsp_tick_bin",
+		binTimeColumn: "time",
+	}
+
+	snapshotSeries = binSeries{
+		name:       "network snapshot",
+		source:     "network_snapshot",
+		timeColumn: "timestamp",
+		timeKind:   unixTime,
+		columns: []binColumn{
+			maxOf("height"),
+			avg("node_count"),
+			avg("reachable_nodes"),
+		},
+		binTable:      "network_snapshot_bin",
+		binTimeColumn: "timestamp",
+	}
+
+	nodeVersionSeries = binSeries{
+		name:       "node version",
+		source:     "node_version",
+		timeColumn: "timestamp",
+		timeKind:   unixTime,
+		where:      "bin = 'default'",
+		groupBy:    []string{"user_agent"},
+		columns: []binColumn{
+			maxOf("height"),
+			avg("node_count"),
+		},
+		binTable:      "node_version",
+		binTimeColumn: "timestamp",
+	}
+
+	nodeLocationSeries = binSeries{
+		name:       "node location",
+		source:     "node_location",
+		timeColumn: "timestamp",
+		timeKind:   unixTime,
+		where:      "bin = 'default'",
+		groupBy:    []string{"country"},
+		columns: []binColumn{
+			maxOf("height"),
+			avg("node_count"),
+		},
+		binTable:      "node_location",
+		binTimeColumn: "timestamp",
+	}
+
+	blockSeries = binSeries{
+		name:       "block propagation",
+		source:     "block",
+		timeColumn: "internal_timestamp",
+		timeKind:   utcTimestamp,
+		columns: []binColumn{
+			maxOf("height"),
+			{name: "receive_time_diff", aggregate: "AVG(EXTRACT(EPOCH FROM receive_time - internal_timestamp))"},
+		},
+		binTable:      "block_bin",
+		binTimeColumn: "internal_timestamp",
+	}
+
+	voteSeries = binSeries{
+		name:       "vote receive time deviation",
+		source:     "vote",
+		timeColumn: "targeted_block_time",
+		timeKind:   utcTimestamp,
+		columns: []binColumn{
+			{name: "block_height", aggregate: "MAX(voting_on)"},
+			{name: "receive_time_difference", aggregate: "AVG(EXTRACT(EPOCH FROM receive_time - block_receive_time))"},
+		},
+		binTable:      "vote_receive_time_deviation",
+		binTimeColumn: "block_time",
+	}
+
+	// propagationSeries is updated per source, passed as the first argument.
+	propagationSeries = binSeries{
+		name:       "propagation",
+		source:     "propagation",
+		timeColumn: "time",
+		timeKind:   unixTime,
+		where:      "bin = 'default' AND source = $1",
+		groupBy:    []string{"source"},
+		columns: []binColumn{
+			maxOf("height"),
+			avg("deviation"),
+		},
+		binTable:      "propagation",
+		binTimeColumn: "time",
+		binWhere:      "source = $1",
+	}
+)
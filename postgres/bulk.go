@@ -0,0 +1,162 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const (
+	defaultBatchSize     = 500
+	defaultFlushInterval = 10 * time.Second
+)
+
+// copyTable is a table written in bulk. The rows are copied into a temp table
+// of the columns, then merged into the table with an INSERT ... SELECT ending
+// with onConflict.
+type copyTable struct {
+	name       string
+	columns    []string
+	onConflict string
+}
+
+var (
+	exchangeTickCopy = copyTable{
+		name: "exchange_tick",
+		columns: []string{"exchange_id", "interval", "high", "low", "open", "close", "volume",
+			"currency_pair", "time"},
+		onConflict: "ON CONFLICT (exchange_id, interval, currency_pair, time) DO NOTHING",
+	}
+
+	mempoolTxCopy = copyTable{
+		name: "mempool_tx",
+		columns: []string{"hash", "tx_type", "size", "fee_rate", "fee_rate_bucket", "first_seen_time",
+			"first_seen_height", "outcome", "height", "time"},
+		onConflict: "ON CONFLICT (hash) DO NOTHING",
+	}
+
+	powDataCopy = copyTable{
+		name:       "pow_data",
+		columns:    []string{"time", "pool_hashrate", "workers", "coin_price", "btc_price", "source"},
+		onConflict: "ON CONFLICT (time, source) DO NOTHING",
+	}
+
+	// The merge of the nodes does what UpdateNode does for the stored nodes.
+	nodeCopy = copyTable{
+		name: "node",
+		columns: []string{"address", "ip_version", "country", "region", "city", "zip", "last_attempt",
+			"last_seen", "last_success", "connection_time", "protocol_version", "user_agent", "services",
+			"starting_height", "current_height", "is_dead", "failure_count"},
+		onConflict: `ON CONFLICT (address) DO UPDATE SET
+			last_attempt = EXCLUDED.last_attempt,
+			last_seen = EXCLUDED.last_seen,
+			last_success = EXCLUDED.last_success,
+			services = EXCLUDED.services,
+			starting_height = EXCLUDED.starting_height,
+			user_agent = EXCLUDED.user_agent,
+			current_height = EXCLUDED.current_height,
+			is_dead = false,
+			failure_count = 0,
+			country = CASE WHEN node.country = '' THEN EXCLUDED.country ELSE node.country END,
+			region = CASE WHEN node.country = '' THEN EXCLUDED.region ELSE node.region END,
+			city = CASE WHEN node.country = '' THEN EXCLUDED.city ELSE node.city END,
+			zip = CASE WHEN node.country = '' THEN EXCLUDED.zip ELSE node.zip END,
+			ip_version = CASE WHEN node.country = '' THEN EXCLUDED.ip_version ELSE node.ip_version END,
+			connection_time = CASE WHEN node.connection_time = 0 THEN EXCLUDED.connection_time
+				ELSE node.connection_time END`,
+	}
+
+	// The merge of the heartbeats does what SaveHeartbeat does for the stored
+	// heartbeats.
+	heartbeatCopy = copyTable{
+		name:    "heartbeat",
+		columns: []string{"timestamp", "node_id", "last_seen", "latency", "current_height"},
+		onConflict: `ON CONFLICT (timestamp, node_id) DO UPDATE SET
+			last_seen = CASE WHEN EXCLUDED.last_seen > 0 THEN EXCLUDED.last_seen ELSE heartbeat.last_seen END,
+			latency = CASE WHEN EXCLUDED.latency > 0 THEN EXCLUDED.latency ELSE heartbeat.latency END,
+			current_height = CASE WHEN EXCLUDED.current_height > 0 THEN EXCLUDED.current_height
+				ELSE heartbeat.current_height END`,
+	}
+)
+
+// SetBatchWrites sets the number of rows written at once by the bulk writes,
+// and the longest time the collectors keep a partial batch before writing it.
+func (pg *PgDb) SetBatchWrites(batchSize int, flushInterval time.Duration) {
+	pg.batchSize = batchSize
+	pg.flushInterval = flushInterval
+}
+
+// BatchConfig returns the number of rows written at once by the bulk writes,
+// and the longest time the collectors keep a partial batch before writing it.
+func (pg *PgDb) BatchConfig() (int, time.Duration) {
+	return pg.batchSize, pg.flushInterval
+}
+
+// copyMerge writes the rows to the table in batches, each copied into a temp
+// table with COPY and merged in a transaction. The rows of a batch whose merge
+// conflicts on a key updated by the merge must have distinct keys. It returns
+// the number of rows inserted or updated.
+func (pg *PgDb) copyMerge(ctx context.Context, t copyTable, rows [][]interface{}) (int64, error) {
+	var merged int64
+	for start := 0; start < len(rows); start += pg.batchSize {
+		end := start + pg.batchSize
+		if end > len(rows) {
+			end = len(rows)
+		}
+		tx, err := pg.db.BeginTx(ctx, nil)
+		if err != nil {
+			return merged, err
+		}
+		n, err := copyMergeTx(ctx, tx, t, rows[start:end])
+		if err != nil {
+			_ = tx.Rollback()
+			return merged, err
+		}
+		if err = tx.Commit(); err != nil {
+			return merged, err
+		}
+		merged += n
+	}
+	return merged, nil
+}
+
+// copyMergeTx copies the rows into a temp table, dropped on commit, and merges
+// them into the table.
+func copyMergeTx(ctx context.Context, tx *sql.Tx, t copyTable, rows [][]interface{}) (int64, error) {
+	tmp := "tmp_" + t.name
+	columns := strings.Join(t.columns, ", ")
+	_, err := tx.ExecContext(ctx, fmt.Sprintf("CREATE TEMP TABLE %s ON COMMIT DROP AS SELECT %s FROM %s WITH NO DATA",
+		tmp, columns, t.name))
+	if err != nil {
+		return 0, err
+	}
+
+	stmt, err := tx.PrepareContext(ctx, pq.CopyIn(tmp, t.columns...))
+	if err != nil {
+		return 0, err
+	}
+	for _, row := range rows {
+		if _, err = stmt.ExecContext(ctx, row...); err != nil {
+			stmt.Close()
+			return 0, err
+		}
+	}
+	if _, err = stmt.ExecContext(ctx); err != nil {
+		stmt.Close()
+		return 0, err
+	}
+	if err = stmt.Close(); err != nil {
+		return 0, err
+	}
+
+	res, err := tx.ExecContext(ctx, fmt.Sprintf("INSERT INTO %s (%s) SELECT %s FROM %s %s",
+		t.name, columns, columns, tmp, t.onConflict))
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
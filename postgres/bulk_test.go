@@ -0,0 +1,190 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/planetdecred/pdanalytics/dbhelper"
+	"github.com/planetdecred/pdanalytics/netsnapshot"
+)
+
+// testDSNEnv names the connection string of an empty database, where the
+// tests needing postgres write. They are skipped when it is not set.
+const testDSNEnv = "PDANALYTICS_TEST_DSN"
+
+func testDB(t *testing.T) *PgDb {
+	dsn := os.Getenv(testDSNEnv)
+	if dsn == "" {
+		t.Skipf("%s is not set", testDSNEnv)
+	}
+	pg, err := NewPgDb(dbhelper.ConnOptions{DSN: dsn}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { pg.Close() })
+	ctx := context.Background()
+	if err = pg.CreateTables(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err = pg.Migrate(ctx); err != nil {
+		t.Fatal(err)
+	}
+	return pg
+}
+
+var (
+	alterTableRe = regexp.MustCompile(`ALTER TABLE (\w+)`)
+	addColumnRe  = regexp.MustCompile(`ADD COLUMN IF NOT EXISTS (\w+)`)
+)
+
+// tableColumns returns the columns of the tables, created by
+// createTableScripts and added by the migrations.
+func tableColumns() map[string]map[string]bool {
+	columns := make(map[string]map[string]bool)
+	for _, mt := range createTableScripts {
+		for _, tbl := range mt.tables {
+			cols := make(map[string]bool)
+			for _, line := range strings.Split(tbl.script, "\n")[1:] {
+				if fields := strings.Fields(line); len(fields) > 1 {
+					cols[strings.ToLower(fields[0])] = true
+				}
+			}
+			columns[tbl.name] = cols
+		}
+	}
+	for _, ms := range migrations {
+		for _, m := range ms {
+			for _, stmt := range strings.Split(m.up, ";") {
+				alter := alterTableRe.FindStringSubmatch(stmt)
+				if alter == nil || columns[alter[1]] == nil {
+					continue
+				}
+				for _, add := range addColumnRe.FindAllStringSubmatch(stmt, -1) {
+					columns[alter[1]][add[1]] = true
+				}
+			}
+		}
+	}
+	return columns
+}
+
+func TestCopyTables(t *testing.T) {
+	columns := tableColumns()
+	for _, ct := range []copyTable{exchangeTickCopy, mempoolTxCopy, powDataCopy, nodeCopy, heartbeatCopy} {
+		cols, found := columns[ct.name]
+		if !found {
+			t.Errorf("no %s table", ct.name)
+			continue
+		}
+		for _, col := range ct.columns {
+			if !cols[col] {
+				t.Errorf("the %s table has no %s column", ct.name, col)
+			}
+		}
+	}
+}
+
+func TestSaveNetworkPeers(t *testing.T) {
+	pg := testDB(t)
+	ctx := context.Background()
+	addresses := []string{"192.0.2.1", "192.0.2.2", "192.0.2.3", "192.0.2.4", "192.0.2.5"}
+	t.Cleanup(func() {
+		for _, address := range addresses {
+			pg.db.Exec("DELETE FROM heartbeat WHERE node_id = $1", address)
+			pg.db.Exec("DELETE FROM node WHERE address = $1", address)
+		}
+	})
+
+	located := netsnapshot.NetworkPeer{Address: addresses[0], IPVersion: 4, ConnectionTime: 100,
+		UserAgent: "/dcrd:1.6.0/", IPInfo: netsnapshot.IPInfo{CountryName: "Nowhere", City: "Nocity"}}
+	err := pg.SaveNetworkPeers(ctx, []netsnapshot.NetworkPeer{located},
+		[]netsnapshot.Heartbeat{{Timestamp: 1, Address: addresses[0], LastSeen: 10, Latency: 5, CurrentHeight: 7}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The next crawl of the node is not located and has no connection time
+	// or latency, the stored values are kept.
+	err = pg.SaveNetworkPeers(ctx, []netsnapshot.NetworkPeer{{Address: addresses[0], UserAgent: "/dcrd:1.7.0/"}},
+		[]netsnapshot.Heartbeat{{Timestamp: 1, Address: addresses[0], LastSeen: 20}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	node, err := pg.FindNode(ctx, addresses[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if node.CountryName != "Nowhere" || node.City != "Nocity" || node.IPVersion != 4 || node.ConnectionTime != 100 ||
+		node.UserAgent != "/dcrd:1.7.0/" {
+		t.Errorf("unexpected merged node %+v", node)
+	}
+	var lastSeen, latency, height int64
+	err = pg.db.QueryRow("SELECT last_seen, latency, current_height FROM heartbeat WHERE timestamp = 1 AND node_id = $1",
+		addresses[0]).Scan(&lastSeen, &latency, &height)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lastSeen != 20 || latency != 5 || height != 7 {
+		t.Errorf("unexpected merged heartbeat %d %d %d", lastSeen, latency, height)
+	}
+
+	locatedNodes, err := pg.LocatedNodes(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(strings.Join(locatedNodes, ","), addresses[0]) {
+		t.Errorf("%s is not in the located nodes %v", addresses[0], locatedNodes)
+	}
+}
+
+func TestCopyMergeBatches(t *testing.T) {
+	pg := testDB(t)
+	ctx := context.Background()
+	pg.SetBatchWrites(2, time.Second)
+	var rows [][]interface{}
+	for i := 1; i <= 5; i++ {
+		rows = append(rows, []interface{}{fmt.Sprintf("192.0.2.%d", i), 4, "", "", "", "", 0, 0, 0, 0, 0, "",
+			"", 0, 0, false, 0})
+	}
+	t.Cleanup(func() {
+		for _, row := range rows {
+			pg.db.Exec("DELETE FROM node WHERE address = $1", row[0])
+		}
+	})
+
+	// The rows are merged in batches of 2, the last one partial.
+	n, err := pg.copyMerge(ctx, nodeCopy, rows)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != int64(len(rows)) {
+		t.Errorf("merged %d rows, want %d", n, len(rows))
+	}
+	var count int
+	err = pg.db.QueryRow("SELECT COUNT(*) FROM node WHERE address LIKE '192.0.2.%'").Scan(&count)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != len(rows) {
+		t.Errorf("got %d nodes, want %d", count, len(rows))
+	}
+
+	// A batch failing leaves the batches written before it.
+	rows[4][1] = "not a number"
+	pg.db.Exec("DELETE FROM node WHERE address LIKE '192.0.2.%'")
+	if _, err = pg.copyMerge(ctx, nodeCopy, rows); err == nil {
+		t.Fatal("the invalid row is merged")
+	}
+	err = pg.db.QueryRow("SELECT COUNT(*) FROM node WHERE address LIKE '192.0.2.%'").Scan(&count)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 4 {
+		t.Errorf("got %d nodes, want the 4 of the batches before the failed one", count)
+	}
+}
@@ -232,6 +232,8 @@ func (pg *PgDb) GithubStat(ctx context.Context, repository string, offtset int,
 }
 
 func (pg *PgDb) CommunityChart(ctx context.Context, platform string, dataType string, filters map[string]string) (stats []commstats.ChartData, err error) {
+	pg = pg.reader()
+
 	dataType = strings.ToLower(dataType)
 
 	var templateArgs = []interface{}{dataType, platform}
@@ -41,6 +41,13 @@ var (
 	lastExchangeTickEntryTime = `SELECT time FROM exchange_tick ORDER BY time DESC LIMIT 1`
 
 	lastExchangeEntryID = `SELECT id FROM exchange ORDER BY id DESC LIMIT 1`
+
+	// insertExchangeTickFromSync resolves the exchange by name, as its id
+	// differs between instances, and skips the ticks already stored.
+	insertExchangeTickFromSync = `INSERT INTO exchange_tick
+		(exchange_id, interval, high, low, open, close, volume, currency_pair, time)
+		SELECT id, $2, $3, $4, $5, $6, $7, $8, $9 FROM exchange WHERE name = $1
+		ON CONFLICT (exchange_id, interval, currency_pair, time) DO NOTHING;`
 )
 
 var (
@@ -119,16 +126,16 @@ func (pg *PgDb) StoreExchangeTicks(ctx context.Context, name string, interval in
 	}
 
 	firstTime := ticks[0].Time
-	added := 0
+	rows := make([][]interface{}, 0, len(ticks))
 	for _, tick := range ticks {
-		xcTick := tickToExchangeTick(exchange.ID, pair, interval, tick)
-		err = xcTick.Insert(ctx, pg.db, boil.Infer())
-		if err != nil && !strings.Contains(err.Error(), "unique constraint") {
-			return lastTime, err
-		}
-		lastTime = xcTick.Time
-		added++
+		rows = append(rows, []interface{}{exchange.ID, interval, tick.High, tick.Low, tick.Open,
+			tick.Close, tick.Volume, pair, tick.Time.UTC()})
+	}
+	added, err := pg.copyMerge(ctx, exchangeTickCopy, rows)
+	if err != nil {
+		return lastTime, err
 	}
+	lastTime = ticks[len(ticks)-1].Time.UTC()
 
 	if added == 0 {
 		log.Infof("No new ticks on %s(%dm) for", name, pair, interval)
@@ -148,19 +155,18 @@ func (pg *PgDb) StoreExchangeTicks(ctx context.Context, name string, interval in
 	return lastTime, nil
 }
 
+// SaveExchangeFromSync stores an exchange received from another instance,
+// unless an exchange of the same name is stored. The local id is assigned by
+// the database.
 func (pg *PgDb) SaveExchangeFromSync(ctx context.Context, exchangeData interface{}) error {
 	exchange := exchangeData.(ticks.ExchangeData)
 	_, err := models.Exchanges(models.ExchangeWhere.Name.EQ(exchange.Name)).One(ctx, pg.db)
-	if err != nil {
-		if err == sql.ErrNoRows {
-			newXch := models.Exchange{
-				ID:   exchange.ID,
-				Name: exchange.Name,
-				URL:  exchange.WebsiteURL,
-			}
-			err = newXch.Insert(ctx, pg.db, boil.Infer())
-			return err
+	if err == sql.ErrNoRows {
+		newXch := models.Exchange{
+			Name: exchange.Name,
+			URL:  exchange.WebsiteURL,
 		}
+		return newXch.Insert(ctx, pg.db, boil.Infer())
 	}
 	return err
 }
@@ -187,6 +193,7 @@ func (pg *PgDb) FetchExchangeForSync(ctx context.Context, lastID int, skip, take
 	exchangeSlice, err := models.Exchanges(
 		models.ExchangeWhere.ID.GT(lastID),
 		qm.Offset(skip), qm.Limit(take),
+		qm.OrderBy(models.ExchangeColumns.ID),
 	).All(ctx, pg.db)
 	if err != nil {
 		return nil, 0, err
@@ -268,6 +275,8 @@ func (pg *PgDb) FetchExchangeTicks(ctx context.Context, currencyPair, name strin
 
 // FetchExchangeTicks fetches a slice exchange ticks of the supplied exchange name
 func (pg *PgDb) AllExchangeTicks(ctx context.Context, currencyPair string, interval, offset, limit int) ([]ticks.TickDto, int64, error) {
+	pg = pg.reader()
+
 	var exchangeTickSlice models.ExchangeTickSlice
 	var exchangeTickSliceCount int64
 	var err error
@@ -400,6 +409,8 @@ func (pg *PgDb) TickIntervalsByExchangeAndPair(ctx context.Context, exchangeName
 }
 
 func (pg *PgDb) ExchangeTicksChartData(ctx context.Context, selectedTick string, currencyPair string, selectedInterval int, source string) ([]ticks.TickChartData, error) {
+	pg = pg.reader()
+
 	exchange, err := models.Exchanges(models.ExchangeWhere.Name.EQ(source)).One(ctx, pg.db)
 	if err != nil {
 		return nil, fmt.Errorf("The selected exchange, %s does not exist, %s", source, err.Error())
@@ -476,42 +487,49 @@ func (pg *PgDb) exchangeTicksChartData(ctx context.Context, currencyPair string,
 	return exchangeFilterResult, nil
 }
 
-func (pg *PgDb) SaveExchangeTickFromSync(ctx context.Context, tickData interface{}) error {
-	tick := tickData.(ticks.TickSyncDto)
-
-	tickModel := models.ExchangeTick{
-		ID:           tick.ID,
-		ExchangeID:   tick.ExchangeID,
-		Interval:     tick.Interval,
-		High:         tick.High,
-		Low:          tick.Low,
-		Open:         tick.Open,
-		Close:        tick.Close,
-		Volume:       tick.Volume,
-		CurrencyPair: tick.CurrencyPair,
-		Time:         tick.Time,
+// FetchExchangeTicksForSync returns the ticks with an id greater than lastID,
+// ordered by id, for the sync operation.
+func (pg *PgDb) FetchExchangeTicksForSync(ctx context.Context, lastID int, skip, take int) ([]ticks.TickSyncDto, int64, error) {
+	tickSlice, err := models.ExchangeTicks(
+		qm.Load(models.ExchangeTickRels.Exchange),
+		models.ExchangeTickWhere.ID.GT(lastID),
+		qm.Offset(skip), qm.Limit(take),
+		qm.OrderBy(models.ExchangeTickColumns.ID),
+	).All(ctx, pg.db)
+	if err != nil {
+		return nil, 0, err
 	}
 
-	err := tickModel.Insert(ctx, pg.db, boil.Infer())
-	if isUniqueConstraint(err) {
-		return nil
+	var result []ticks.TickSyncDto
+	for _, tick := range tickSlice {
+		result = append(result, ticks.TickSyncDto{
+			ExchangeID:   tick.ExchangeID,
+			ID:           tick.ID,
+			ExchangeName: tick.R.Exchange.Name,
+			High:         tick.High,
+			Low:          tick.Low,
+			Open:         tick.Open,
+			Close:        tick.Close,
+			Volume:       tick.Volume,
+			Time:         tick.Time.UTC(),
+			Interval:     tick.Interval,
+			CurrencyPair: tick.CurrencyPair,
+		})
 	}
 
-	return err
+	totalCount, err := models.ExchangeTicks(models.ExchangeTickWhere.ID.GT(lastID)).Count(ctx, pg.db)
+
+	return result, totalCount, err
 }
 
-func tickToExchangeTick(exchangeID int, pair string, interval int, tick ticks.Tick) *models.ExchangeTick {
-	return &models.ExchangeTick{
-		ExchangeID:   exchangeID,
-		High:         tick.High,
-		Low:          tick.Low,
-		Open:         tick.Open,
-		Close:        tick.Close,
-		Volume:       tick.Volume,
-		Time:         tick.Time.UTC(),
-		CurrencyPair: pair,
-		Interval:     interval,
-	}
+// SaveExchangeTickFromSync stores a tick received from another instance. The
+// tick is attached to the local exchange of the same name, which must be
+// stored first, and ignored if already stored.
+func (pg *PgDb) SaveExchangeTickFromSync(ctx context.Context, tickData interface{}) error {
+	tick := tickData.(ticks.TickSyncDto)
+	_, err := pg.db.ExecContext(ctx, insertExchangeTickFromSync, tick.ExchangeName, tick.Interval,
+		tick.High, tick.Low, tick.Open, tick.Close, tick.Volume, tick.CurrencyPair, tick.Time.UTC())
+	return err
 }
 
 // LastExchangeTickEntryTime
@@ -529,6 +547,8 @@ func (pg *PgDb) LastExchangeEntryID() (id int64) {
 }
 
 func (pg *PgDb) FetchEncodeExchangeChart(ctx context.Context, dataType, _ string, binString string, setKey ...string) ([]byte, error) {
+	pg = pg.reader()
+
 	if len(setKey) < 1 {
 		return nil, errors.New("exchange set key is required for exchange chart")
 	}
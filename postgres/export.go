@@ -0,0 +1,286 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/planetdecred/pdanalytics/export"
+)
+
+// exportQuery is the query of an exported dataset.
+type exportQuery struct {
+	columns []export.Column
+	// query selects the columns, the conditions of the filter are appended
+	// as a WHERE clause.
+	query string
+	// timeColumn is the column the time range applies to, holding unix
+	// seconds when unixTime is set.
+	timeColumn string
+	unixTime   bool
+	// filters are the columns of the dataset filters.
+	filters map[string]string
+	orderBy string
+}
+
+var exportQueries = map[string]exportQuery{
+	"mempool": {
+		columns: []export.Column{
+			{Name: "time", Type: export.Time}, {Name: "first_seen_time", Type: export.Time},
+			{Name: "number_of_transactions", Type: export.Int}, {Name: "voters", Type: export.Int},
+			{Name: "tickets", Type: export.Int}, {Name: "revocations", Type: export.Int},
+			{Name: "size", Type: export.Int}, {Name: "total_fee", Type: export.Float},
+			{Name: "total", Type: export.Float},
+		},
+		query: `SELECT time, first_seen_time, number_of_transactions, voters, tickets, revocations, size,
+			total_fee, total FROM mempool`,
+		timeColumn: "time",
+		orderBy:    "time",
+	},
+	"blocks": {
+		columns: []export.Column{
+			{Name: "height", Type: export.Int}, {Name: "receive_time", Type: export.Time},
+			{Name: "internal_timestamp", Type: export.Time}, {Name: "hash", Type: export.String},
+		},
+		query:      `SELECT height, receive_time, internal_timestamp, hash FROM block`,
+		timeColumn: "receive_time",
+		orderBy:    "height",
+	},
+	"votes": {
+		columns: []export.Column{
+			{Name: "hash", Type: export.String}, {Name: "voting_on", Type: export.Int},
+			{Name: "block_hash", Type: export.String}, {Name: "receive_time", Type: export.Time},
+			{Name: "block_receive_time", Type: export.Time}, {Name: "targeted_block_time", Type: export.Time},
+			{Name: "validator_id", Type: export.Int}, {Name: "validity", Type: export.String},
+		},
+		query: `SELECT hash, voting_on, block_hash, receive_time, block_receive_time, targeted_block_time,
+			validator_id, validity FROM vote`,
+		timeColumn: "receive_time",
+		orderBy:    "receive_time, hash",
+	},
+	"exchange_ticks": {
+		columns: []export.Column{
+			{Name: "exchange", Type: export.String}, {Name: "currency_pair", Type: export.String},
+			{Name: "interval", Type: export.Int}, {Name: "high", Type: export.Float},
+			{Name: "low", Type: export.Float}, {Name: "open", Type: export.Float},
+			{Name: "close", Type: export.Float}, {Name: "volume", Type: export.Float},
+			{Name: "time", Type: export.Time},
+		},
+		query: `SELECT exchange.name, exchange_tick.currency_pair, exchange_tick.interval, exchange_tick.high,
+			exchange_tick.low, exchange_tick.open, exchange_tick.close, exchange_tick.volume, exchange_tick.time
+			FROM exchange_tick JOIN exchange ON exchange.id = exchange_tick.exchange_id`,
+		timeColumn: "exchange_tick.time",
+		filters: map[string]string{
+			export.FilterExchange: "exchange.name",
+			export.FilterPair:     "exchange_tick.currency_pair",
+		},
+		orderBy: "exchange_tick.time, exchange_tick.id",
+	},
+	"pow": {
+		columns: []export.Column{
+			{Name: "time", Type: export.Time}, {Name: "pool", Type: export.String},
+			{Name: "pool_hashrate", Type: export.Float}, {Name: "workers", Type: export.Int},
+			{Name: "coin_price", Type: export.Float}, {Name: "btc_price", Type: export.Float},
+		},
+		// The numbers stored as text are converted.
+		query: `SELECT to_timestamp(time), source, NULLIF(pool_hashrate, '')::FLOAT8, workers,
+			NULLIF(coin_price, '')::FLOAT8, NULLIF(btc_price, '')::FLOAT8 FROM pow_data`,
+		timeColumn: "time",
+		unixTime:   true,
+		filters:    map[string]string{export.FilterPool: "source"},
+		orderBy:    "time, source",
+	},
+	"vsp_ticks": {
+		columns: []export.Column{
+			{Name: "vsp", Type: export.String}, {Name: "immature", Type: export.Int},
+			{Name: "live", Type: export.Int}, {Name: "voted", Type: export.Int},
+			{Name: "missed", Type: export.Int}, {Name: "pool_fees", Type: export.Float},
+			{Name: "proportion_live", Type: export.Float}, {Name: "proportion_missed", Type: export.Float},
+			{Name: "user_count", Type: export.Int}, {Name: "users_active", Type: export.Int},
+			{Name: "time", Type: export.Time},
+		},
+		query: `SELECT vsp.name, vsp_tick.immature, vsp_tick.live, vsp_tick.voted, vsp_tick.missed,
+			vsp_tick.pool_fees, vsp_tick.proportion_live, vsp_tick.proportion_missed, vsp_tick.user_count,
+			vsp_tick.users_active, vsp_tick.time FROM vsp_tick JOIN vsp ON vsp.id = vsp_tick.vsp_id`,
+		timeColumn: "vsp_tick.time",
+		filters:    map[string]string{export.FilterVSP: "vsp.name"},
+		orderBy:    "vsp_tick.time, vsp_tick.id",
+	},
+	"reddit": {
+		columns: []export.Column{
+			{Name: "date", Type: export.Time}, {Name: "subreddit", Type: export.String},
+			{Name: "subscribers", Type: export.Int}, {Name: "active_accounts", Type: export.Int},
+		},
+		query:      `SELECT date, subreddit, subscribers, active_accounts FROM reddit`,
+		timeColumn: "date",
+		filters:    map[string]string{export.FilterSubreddit: "subreddit"},
+		orderBy:    "date",
+	},
+	"twitter": {
+		columns: []export.Column{
+			{Name: "date", Type: export.Time}, {Name: "handle", Type: export.String},
+			{Name: "followers", Type: export.Int},
+		},
+		query:      `SELECT date, handle, followers FROM twitter`,
+		timeColumn: "date",
+		orderBy:    "date",
+	},
+	"github": {
+		columns: []export.Column{
+			{Name: "date", Type: export.Time}, {Name: "repository", Type: export.String},
+			{Name: "stars", Type: export.Int}, {Name: "forks", Type: export.Int},
+		},
+		query:      `SELECT date, repository, stars, folks FROM github`,
+		timeColumn: "date",
+		orderBy:    "date",
+	},
+	"youtube": {
+		columns: []export.Column{
+			{Name: "date", Type: export.Time}, {Name: "channel", Type: export.String},
+			{Name: "subscribers", Type: export.Int}, {Name: "view_count", Type: export.Int},
+		},
+		query:      `SELECT date, channel, subscribers, view_count FROM youtube`,
+		timeColumn: "date",
+		orderBy:    "date",
+	},
+	"snapshots": {
+		columns: []export.Column{
+			{Name: "timestamp", Type: export.Time}, {Name: "height", Type: export.Int},
+			{Name: "node_count", Type: export.Int}, {Name: "reachable_nodes", Type: export.Int},
+			{Name: "oldest_node", Type: export.String}, {Name: "oldest_node_timestamp", Type: export.Time},
+			{Name: "latency", Type: export.Int},
+		},
+		query: `SELECT to_timestamp(timestamp), height, node_count, reachable_nodes, oldest_node,
+			to_timestamp(NULLIF(oldest_node_timestamp, 0)), latency FROM network_snapshot`,
+		timeColumn: "timestamp",
+		unixTime:   true,
+		orderBy:    "timestamp",
+	},
+	"nodes": {
+		columns: []export.Column{
+			{Name: "address", Type: export.String}, {Name: "ip_version", Type: export.Int},
+			{Name: "country", Type: export.String}, {Name: "region", Type: export.String},
+			{Name: "city", Type: export.String}, {Name: "zip", Type: export.String},
+			{Name: "last_attempt", Type: export.Time}, {Name: "last_seen", Type: export.Time},
+			{Name: "last_success", Type: export.Time}, {Name: "failure_count", Type: export.Int},
+			{Name: "is_dead", Type: export.Bool}, {Name: "connection_time", Type: export.Time},
+			{Name: "protocol_version", Type: export.Int}, {Name: "user_agent", Type: export.String},
+			{Name: "services", Type: export.String}, {Name: "starting_height", Type: export.Int},
+			{Name: "current_height", Type: export.Int},
+		},
+		query: `SELECT address, ip_version, country, region, city, zip, to_timestamp(NULLIF(last_attempt, 0)),
+			to_timestamp(NULLIF(last_seen, 0)), to_timestamp(NULLIF(last_success, 0)), failure_count, is_dead,
+			to_timestamp(NULLIF(connection_time, 0)), protocol_version, user_agent, services, starting_height,
+			current_height FROM node`,
+		timeColumn: "last_seen",
+		unixTime:   true,
+		orderBy:    "last_seen, address",
+	},
+}
+
+// ExportDataset streams the rows of the dataset matching the filter, ordered
+// by time, from the replica when one is set.
+func (pg *PgDb) ExportDataset(ctx context.Context, dataset string, filter export.Filter, w export.RowWriter) error {
+	q, found := exportQueries[dataset]
+	if !found {
+		return fmt.Errorf("unknown dataset %q", dataset)
+	}
+
+	var conditions []string
+	var args []interface{}
+	addCondition := func(column, op string, value interface{}) {
+		args = append(args, value)
+		conditions = append(conditions, fmt.Sprintf("%s %s $%d", column, op, len(args)))
+	}
+	if !filter.From.IsZero() {
+		if q.unixTime {
+			addCondition(q.timeColumn, ">=", filter.From.Unix())
+		} else {
+			addCondition(q.timeColumn, ">=", filter.From)
+		}
+	}
+	if !filter.To.IsZero() {
+		if q.unixTime {
+			addCondition(q.timeColumn, "<", filter.To.Unix())
+		} else {
+			addCondition(q.timeColumn, "<", filter.To)
+		}
+	}
+	for name, value := range filter.Values {
+		if value == "" {
+			continue
+		}
+		column, found := q.filters[name]
+		if !found {
+			return fmt.Errorf("the %s dataset cannot be filtered by %s", dataset, name)
+		}
+		addCondition(column, "=", value)
+	}
+
+	query := q.query
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	query += " ORDER BY " + q.orderBy
+
+	rows, err := pg.reader().db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	if err = w.WriteHeader(q.columns); err != nil {
+		return err
+	}
+	dest := make([]interface{}, len(q.columns))
+	for i, column := range q.columns {
+		switch column.Type {
+		case export.Int:
+			dest[i] = new(sql.NullInt64)
+		case export.Float:
+			dest[i] = new(sql.NullFloat64)
+		case export.String:
+			dest[i] = new(sql.NullString)
+		case export.Bool:
+			dest[i] = new(sql.NullBool)
+		case export.Time:
+			dest[i] = new(sql.NullTime)
+		}
+	}
+	values := make([]interface{}, len(q.columns))
+	for rows.Next() {
+		if err = rows.Scan(dest...); err != nil {
+			return err
+		}
+		for i, d := range dest {
+			values[i] = nil
+			switch v := d.(type) {
+			case *sql.NullInt64:
+				if v.Valid {
+					values[i] = v.Int64
+				}
+			case *sql.NullFloat64:
+				if v.Valid {
+					values[i] = v.Float64
+				}
+			case *sql.NullString:
+				if v.Valid {
+					values[i] = v.String
+				}
+			case *sql.NullBool:
+				if v.Valid {
+					values[i] = v.Bool
+				}
+			case *sql.NullTime:
+				if v.Valid {
+					values[i] = v.Time
+				}
+			}
+		}
+		if err = w.WriteRow(values); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
@@ -0,0 +1,28 @@
+package postgres
+
+import (
+	"testing"
+
+	"github.com/planetdecred/pdanalytics/export"
+)
+
+func TestExportQueries(t *testing.T) {
+	for _, d := range export.Datasets {
+		q, found := exportQueries[d.Name]
+		if !found {
+			t.Errorf("no query for the %s dataset", d.Name)
+			continue
+		}
+		if len(q.filters) != len(d.Filters) {
+			t.Errorf("the %s query has %d filters, want %d", d.Name, len(q.filters), len(d.Filters))
+		}
+		for _, filter := range d.Filters {
+			if _, found := q.filters[filter]; !found {
+				t.Errorf("the %s query has no %s filter", d.Name, filter)
+			}
+		}
+	}
+	if len(exportQueries) != len(export.Datasets) {
+		t.Errorf("got %d queries for %d datasets", len(exportQueries), len(export.Datasets))
+	}
+}
@@ -3,7 +3,6 @@ package postgres
 import (
 	"context"
 	"database/sql"
-	"fmt"
 	"strings"
 	"time"
 
@@ -18,12 +17,58 @@ import (
 
 const (
 	// chart data types
-	MempoolSize    = "size"
-	MempoolFees    = "fees"
-	MempoolTxCount = "tx-count"
+	MempoolSize     = "size"
+	MempoolFees     = "fees"
+	MempoolTxCount  = "tx-count"
+	MempoolFeeRates = "fee-rates"
+	MempoolLatency  = "confirmation-latency"
 
 	lastMempoolBlockHeight = `SELECT last_block_height FROM mempool ORDER BY last_block_height DESC LIMIT 1`
 	lastMempoolEntryTime   = `SELECT time FROM mempool ORDER BY time DESC LIMIT 1`
+
+	insertMempoolFeeRate = `INSERT INTO mempool_fee_rate (time, fee_rate_p10, fee_rate_p50, fee_rate_p90)
+		VALUES ($1, $2, $3, $4) ON CONFLICT DO NOTHING;`
+	insertMempoolType = `INSERT INTO mempool_type (time, tx_type, tx_count, size, fees, total)
+		VALUES ($1, $2, $3, $4, $5, $6) ON CONFLICT DO NOTHING;`
+	insertMempoolFeeBucket = `INSERT INTO mempool_fee_bucket (time, fee_rate, tx_count, size)
+		VALUES ($1, $2, $3, $4) ON CONFLICT DO NOTHING;`
+
+	selectMempoolFeeRates = `SELECT EXTRACT(EPOCH FROM time)::INT8, fee_rate_p10, fee_rate_p50, fee_rate_p90
+		FROM mempool_fee_rate ORDER BY time;`
+	selectMempoolFeeBuckets = `SELECT EXTRACT(EPOCH FROM time)::INT8, fee_rate, size
+		FROM mempool_fee_bucket ORDER BY time, fee_rate;`
+	selectMempoolTypes = `SELECT EXTRACT(EPOCH FROM time)::INT8, tx_count, size, fees, total
+		FROM mempool_type WHERE tx_type = $1 ORDER BY time;`
+	selectMempoolTypeBins = `SELECT time, tx_count, size, fees, total
+		FROM mempool_type_bin WHERE tx_type = $1 AND bin = $2 ORDER BY time;`
+	selectMempoolFeeRateBins = `SELECT time, fee_rate_p10, fee_rate_p50, fee_rate_p90
+		FROM mempool_fee_rate_bin WHERE bin = $1 ORDER BY time;`
+	selectMempoolFeeBucketBins = `SELECT time, fee_rate, size
+		FROM mempool_fee_bucket_bin WHERE bin = $1 ORDER BY time, fee_rate;`
+
+	selectConfirmationLatency = `SELECT tx_type, fee_rate_bucket,
+			COUNT(*) FILTER (WHERE outcome = 'mined'),
+			COUNT(*) FILTER (WHERE outcome = 'evicted'),
+			COUNT(*) FILTER (WHERE outcome = 'missed-window'),
+			COALESCE(AVG(EXTRACT(EPOCH FROM time - first_seen_time)) FILTER (WHERE outcome = 'mined'), 0),
+			COALESCE(PERCENTILE_CONT(0.5) WITHIN GROUP (ORDER BY EXTRACT(EPOCH FROM time - first_seen_time))
+				FILTER (WHERE outcome = 'mined'), 0),
+			COALESCE(PERCENTILE_CONT(0.9) WITHIN GROUP (ORDER BY EXTRACT(EPOCH FROM time - first_seen_time))
+				FILTER (WHERE outcome = 'mined'), 0),
+			COALESCE(PERCENTILE_CONT(0.5) WITHIN GROUP (ORDER BY height - first_seen_height)
+				FILTER (WHERE outcome = 'mined'), 0),
+			COALESCE(PERCENTILE_CONT(0.9) WITHIN GROUP (ORDER BY height - first_seen_height)
+				FILTER (WHERE outcome = 'mined'), 0)
+		FROM mempool_tx WHERE time >= $1
+		GROUP BY tx_type, fee_rate_bucket ORDER BY tx_type, fee_rate_bucket;`
+
+	// The default bin of the confirmation-latency chart is per block, the
+	// transactions mined in a block having the time it was connected.
+	selectMempoolTxLatencies = `SELECT EXTRACT(EPOCH FROM time)::INT8, tx_type,
+			PERCENTILE_CONT(0.5) WITHIN GROUP (ORDER BY EXTRACT(EPOCH FROM time - first_seen_time))
+		FROM mempool_tx WHERE outcome = 'mined' GROUP BY time, tx_type ORDER BY time;`
+	selectMempoolTxLatencyBins = `SELECT time, tx_type, latency
+		FROM mempool_tx_bin WHERE bin = $1 ORDER BY time;`
 )
 
 func (pg PgDb) MempoolTableName() string {
@@ -38,6 +83,12 @@ func (pg PgDb) StoreMempool(ctx context.Context, mempoolDto mempool.Mempool) err
 			return err
 		}
 	}
+	if err = pg.storeMempoolFeeRates(ctx, mempoolDto); err != nil {
+		return err
+	}
+	if err = pg.storeMempoolTypes(ctx, mempoolDto); err != nil {
+		return err
+	}
 	//  tx count 76, total size 54205 B, fees 0.00367100
 	log.Infof("Added mempool entry at %s, tx count %2d, total size: %6d B, Total Fee: %010.8f",
 		mempoolDto.Time.Format(dbhelper.DateTemplate), mempoolDto.NumberOfTransactions, mempoolDto.Size, mempoolDto.TotalFee)
@@ -47,6 +98,82 @@ func (pg PgDb) StoreMempool(ctx context.Context, mempoolDto mempool.Mempool) err
 	return nil
 }
 
+// storeMempoolFeeRates stores the fee rate percentiles and buckets of the
+// mempool entry.
+func (pg PgDb) storeMempoolFeeRates(ctx context.Context, m mempool.Mempool) error {
+	tx, err := pg.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	rates := m.FeeRates
+	if _, err = tx.ExecContext(ctx, insertMempoolFeeRate, m.Time, rates.P10, rates.P50, rates.P90); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	for _, bucket := range rates.Buckets {
+		if _, err = tx.ExecContext(ctx, insertMempoolFeeBucket, m.Time, bucket.FeeRate, bucket.TxCount,
+			bucket.Size); err != nil {
+			_ = tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// StoreMempoolTxs stores the transactions that left the mempool, keeping the
+// first record of a transaction.
+func (pg *PgDb) StoreMempoolTxs(ctx context.Context, txs []mempool.MempoolTx) error {
+	rows := make([][]interface{}, 0, len(txs))
+	for _, tx := range txs {
+		rows = append(rows, []interface{}{tx.Hash, tx.Type, tx.Size, tx.FeeRate, tx.FeeRateBucket,
+			tx.FirstSeenTime, tx.FirstSeenHeight, tx.Outcome, tx.Height, tx.Time})
+	}
+	added, err := pg.copyMerge(ctx, mempoolTxCopy, rows)
+	if err != nil {
+		return err
+	}
+	log.Debugf("Added %d of %d mempool transactions", added, len(txs))
+	return nil
+}
+
+// ConfirmationLatency returns the confirmation latency distributions of the
+// transactions that left the mempool since the time, per type and fee rate
+// bucket.
+func (pg *PgDb) ConfirmationLatency(ctx context.Context, since time.Time) ([]mempool.LatencyStats, error) {
+	rows, err := pg.reader().db.QueryContext(ctx, selectConfirmationLatency, since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var stats []mempool.LatencyStats
+	for rows.Next() {
+		var s mempool.LatencyStats
+		if err = rows.Scan(&s.Type, &s.FeeRateBucket, &s.Mined, &s.Evicted, &s.MissedWindow, &s.LatencyAvg,
+			&s.LatencyP50, &s.LatencyP90, &s.BlocksP50, &s.BlocksP90); err != nil {
+			return nil, err
+		}
+		stats = append(stats, s)
+	}
+	return stats, rows.Err()
+}
+
+// storeMempoolTypes stores the breakdown by transaction type of the mempool
+// entry.
+func (pg PgDb) storeMempoolTypes(ctx context.Context, m mempool.Mempool) error {
+	tx, err := pg.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	for _, t := range m.Types {
+		if _, err = tx.ExecContext(ctx, insertMempoolType, m.Time, t.Type, t.Count, t.Size, t.Fees,
+			t.Total); err != nil {
+			_ = tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
 func mempoolDtoToModel(mempoolDto mempool.Mempool) models.Mempool {
 	return models.Mempool{
 		Time:                 mempoolDto.Time,
@@ -104,207 +231,25 @@ func (pg *PgDb) Mempools(ctx context.Context, offtset int, limit int) ([]mempool
 
 func (pg PgDb) UpdateMempoolAggregateData(ctx context.Context) error {
 	log.Info("Updating mempool bin data")
-	if err := pg.updateMempoolHourlyAverage(ctx); err != nil && err != sql.ErrNoRows {
-		return err
-	}
-
-	if err := pg.updateMempoolDailyAvg(ctx); err != nil && err != sql.ErrNoRows {
-		return err
-	}
-
-	log.Info("Mempool bin data updated")
-	return nil
-}
-
-func (pg *PgDb) updateMempoolHourlyAverage(ctx context.Context) error {
-	lastHourEntry, err := models.MempoolBins(
-		models.MempoolBinWhere.Bin.EQ(string(chart.HourBin)),
-		qm.OrderBy(fmt.Sprintf("%s desc", models.MempoolBinColumns.Time)),
-	).One(ctx, pg.db)
-	if err != nil && err != sql.ErrNoRows {
-		return err
-	}
-
-	var nextHour = time.Time{}
-	if lastHourEntry != nil {
-		nextHour = time.Unix(lastHourEntry.Time, 0).Add(chart.AnHour * time.Second).UTC()
-	}
-	if time.Now().Before(nextHour) {
-		return nil
-	}
-
-	totalCount, err := models.Mempools(
-		models.MempoolWhere.Time.GTE(nextHour),
-	).Count(ctx, pg.db)
-	if err != nil {
-		return err
-	}
-
-	tx, err := pg.db.Begin()
-	if err != nil {
-		return err
-	}
-
-	var processed int64
-	for processed < totalCount {
-
-		// get the first record for the next day to fill gap
-		firstMem, err := models.Mempools(
-			models.MempoolWhere.Time.GTE(nextHour),
-			qm.OrderBy(models.MempoolColumns.Time),
-		).One(ctx, pg.db)
-		if err != nil {
-			return err
-		}
-		if firstMem != nil {
-			nextHour = firstMem.Time
-		}
-
-		mempoolSlice, err := models.Mempools(
-			models.MempoolWhere.Time.GTE(nextHour),
-			models.MempoolWhere.Time.LT(nextHour.Add(7*24*time.Hour)),
-			qm.OrderBy(models.MempoolColumns.Time),
-		).All(ctx, pg.db)
-		if err != nil {
-			return err
-		}
-
-		dLen := len(mempoolSlice)
-		dates, txCounts, sizes := make(chart.ChartUints, dLen), make(chart.ChartUints, dLen), make(chart.ChartUints, dLen)
-		fees := make(chart.ChartFloats, dLen)
-		for i, m := range mempoolSlice {
-			dates[i] = uint64(m.Time.Unix())
-			txCounts[i] = uint64(m.NumberOfTransactions.Int)
-			sizes[i] = uint64(m.Size.Int)
-			fees[i] = m.TotalFee.Float64
-		}
-
-		hours, _, hourIntervals := chart.GenerateHourBin(dates, nil)
-		for i, interval := range hourIntervals {
-			mempoolBin := models.MempoolBin{
-				Time:                 int64(hours[i]),
-				Bin:                  string(chart.HourBin),
-				Size:                 null.IntFrom(int(sizes.Avg(interval[0], interval[1]))),
-				TotalFee:             null.Float64From(fees.Avg(interval[0], interval[1])),
-				NumberOfTransactions: null.IntFrom(int(txCounts.Avg(interval[0], interval[1]))),
-			}
-			if err = mempoolBin.Insert(ctx, tx, boil.Infer()); err != nil {
-				_ = tx.Rollback()
-				return err
-			}
-		}
-		nextHour = nextHour.Add(7 * 24 * time.Hour).UTC()
-		log.Infof("Processed hourly average of %d to %d of %d mempool record", processed,
-			processed+int64(len(mempoolSlice)), totalCount)
-		processed += int64(len(mempoolSlice))
-	}
-
-	if err = tx.Commit(); err != nil {
-		return err
-	}
-	return nil
-}
-
-func (pg *PgDb) updateMempoolDailyAvg(ctx context.Context) error {
-	lastDayEntry, err := models.MempoolBins(
-		models.MempoolBinWhere.Bin.EQ(string(chart.DayBin)),
-		qm.OrderBy(fmt.Sprintf("%s desc", models.MempoolBinColumns.Time)),
-	).One(ctx, pg.db)
-	if err != nil && err != sql.ErrNoRows {
-		return err
-	}
-
-	var nextDay = time.Time{}
-	if lastDayEntry != nil {
-		nextDay = time.Unix(lastDayEntry.Time, 0).Add(chart.ADay * time.Second).UTC()
-	} else {
-		firstMem, err := models.Mempools(
-			qm.OrderBy(models.MempoolColumns.Time),
-		).One(ctx, pg.db)
-		if err != nil {
+	for _, series := range []binSeries{mempoolSeries, mempoolFeeRateSeries, mempoolFeeBucketSeries, mempoolTypeSeries,
+		mempoolTxSeries} {
+		if err := pg.updateBins(ctx, series); err != nil {
 			return err
 		}
-		nextDay = firstMem.Time
-	}
-	if time.Now().Before(nextDay) {
-		return nil
-	}
-
-	totalCount, err := models.Mempools(
-		models.MempoolWhere.Time.GTE(nextDay),
-	).Count(ctx, pg.db)
-	if err != nil {
-		return err
 	}
 
-	tx, err := pg.db.Begin()
-	if err != nil {
-		return err
-	}
-
-	var processed int64
-	for processed < totalCount {
-
-		// get the first record for the next day to fill gap
-		firstMem, err := models.Mempools(
-			models.MempoolWhere.Time.GTE(nextDay),
-			qm.OrderBy(models.MempoolColumns.Time),
-		).One(ctx, pg.db)
-		if err != nil {
-			return err
-		}
-		if firstMem != nil {
-			nextDay = firstMem.Time
-		}
-
-		mempoolSlice, err := models.Mempools(
-			models.MempoolWhere.Time.GTE(nextDay),
-			models.MempoolWhere.Time.LT(nextDay.Add(30*24*time.Hour)),
-			qm.OrderBy(models.MempoolColumns.Time),
-		).All(ctx, pg.db)
-		if err != nil {
-			return err
-		}
-
-		dLen := len(mempoolSlice)
-		dates, txCounts, sizes := make(chart.ChartUints, dLen), make(chart.ChartUints, dLen), make(chart.ChartUints, dLen)
-		fees := make(chart.ChartFloats, dLen)
-		for i, m := range mempoolSlice {
-			dates[i] = uint64(m.Time.Unix())
-			txCounts[i] = uint64(m.NumberOfTransactions.Int)
-			sizes[i] = uint64(m.Size.Int)
-			fees[i] = m.TotalFee.Float64
-		}
-
-		days, _, dayIntervals := chart.GenerateDayBin(dates, nil)
-		for i, interval := range dayIntervals {
-			mempoolBin := models.MempoolBin{
-				Time:                 int64(days[i]),
-				Bin:                  string(chart.DayBin),
-				Size:                 null.IntFrom(int(sizes.Avg(interval[0], interval[1]))),
-				TotalFee:             null.Float64From(fees.Avg(interval[0], interval[1])),
-				NumberOfTransactions: null.IntFrom(int(txCounts.Avg(interval[0], interval[1]))),
-			}
-			if err = mempoolBin.Insert(ctx, tx, boil.Infer()); err != nil {
-				_ = tx.Rollback()
-				return err
-			}
-		}
-		nextDay = nextDay.Add(30 * 24 * time.Hour)
-		log.Infof("Processed daily average of %d to %d of %d mempool record", processed,
-			processed+int64(len(mempoolSlice)), totalCount)
-		processed += int64(len(mempoolSlice))
-	}
-
-	if err = tx.Commit(); err != nil {
-		return err
-	}
+	log.Info("Mempool bin data updated")
 	return nil
 }
 
 // *****CHARTS GETTER******* //
 
 func (pg *PgDb) FetchEncodeChart(ctx context.Context, dataType, binString string) ([]byte, error) {
+	pg = pg.reader()
+
+	if txType, ok := mempool.ParseTypeChart(dataType); ok {
+		return pg.fetchEncodeMempoolType(ctx, txType, binString)
+	}
 
 	switch dataType {
 	case MempoolSize:
@@ -314,6 +259,12 @@ func (pg *PgDb) FetchEncodeChart(ctx context.Context, dataType, binString string
 
 	case MempoolTxCount:
 		return pg.fetchEncodeMempoolTxCount(ctx, binString)
+
+	case MempoolFeeRates:
+		return pg.fetchEncodeMempoolFeeRates(ctx, binString)
+
+	case MempoolLatency:
+		return pg.fetchEncodeMempoolLatency(ctx, binString)
 	}
 	return nil, chart.UnknownChartErr
 }
@@ -422,3 +373,114 @@ func (pg *PgDb) fetchEncodeMempoolTxCount(ctx context.Context, binString string)
 	}
 	return chart.Encode(nil, time, data)
 }
+
+// fetchEncodeMempoolFeeRates encodes the fee rate percentiles and the bytes
+// queued per fee rate bucket, from the raw rows for the default bin.
+func (pg *PgDb) fetchEncodeMempoolFeeRates(ctx context.Context, binString string) ([]byte, error) {
+	ratesQuery, bucketsQuery := selectMempoolFeeRates, selectMempoolFeeBuckets
+	var args []interface{}
+	if binString != string(chart.DefaultBin) {
+		ratesQuery, bucketsQuery = selectMempoolFeeRateBins, selectMempoolFeeBucketBins
+		args = append(args, binString)
+	}
+
+	rows, err := pg.db.QueryContext(ctx, ratesQuery, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var dates chart.ChartUints
+	var rates []mempool.FeeRates
+	index := make(map[int64]int)
+	for rows.Next() {
+		var t int64
+		var r mempool.FeeRates
+		if err = rows.Scan(&t, &r.P10, &r.P50, &r.P90); err != nil {
+			return nil, err
+		}
+		index[t] = len(rates)
+		dates = append(dates, uint64(t))
+		rates = append(rates, r)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	bucketRows, err := pg.db.QueryContext(ctx, bucketsQuery, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer bucketRows.Close()
+	for bucketRows.Next() {
+		var t int64
+		var bucket mempool.FeeRateBucket
+		if err = bucketRows.Scan(&t, &bucket.FeeRate, &bucket.Size); err != nil {
+			return nil, err
+		}
+		if i, found := index[t]; found {
+			rates[i].Buckets = append(rates[i].Buckets, bucket)
+		}
+	}
+	if err = bucketRows.Err(); err != nil {
+		return nil, err
+	}
+	return mempool.EncodeFeeRatesChart(dates, rates)
+}
+
+// fetchEncodeMempoolLatency encodes the median confirmation latency per
+// transaction type, per block for the default bin.
+func (pg *PgDb) fetchEncodeMempoolLatency(ctx context.Context, binString string) ([]byte, error) {
+	query := selectMempoolTxLatencies
+	var args []interface{}
+	if binString != string(chart.DefaultBin) {
+		query = selectMempoolTxLatencyBins
+		args = append(args, binString)
+	}
+	rows, err := pg.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var points []mempool.LatencyPoint
+	for rows.Next() {
+		var p mempool.LatencyPoint
+		if err = rows.Scan(&p.Time, &p.Type, &p.Latency); err != nil {
+			return nil, err
+		}
+		points = append(points, p)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return mempool.EncodeLatencyChart(points)
+}
+
+// fetchEncodeMempoolType encodes the chart of the mempool transactions of a
+// type.
+func (pg *PgDb) fetchEncodeMempoolType(ctx context.Context, txType, binString string) ([]byte, error) {
+	query, args := selectMempoolTypes, []interface{}{txType}
+	if binString != string(chart.DefaultBin) {
+		query = selectMempoolTypeBins
+		args = append(args, binString)
+	}
+	rows, err := pg.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var dates chart.ChartUints
+	var stats []mempool.TypeStats
+	for rows.Next() {
+		var t int64
+		var s mempool.TypeStats
+		if err = rows.Scan(&t, &s.Count, &s.Size, &s.Fees, &s.Total); err != nil {
+			return nil, err
+		}
+		dates = append(dates, uint64(t))
+		stats = append(stats, s)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return mempool.EncodeTypeChart(dates, stats)
+}
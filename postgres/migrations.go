@@ -0,0 +1,171 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"sort"
+)
+
+// The table creation scripts are the version 0 schema of each module. Schema
+// changes are never made to them, they are added as up migrations so existing
+// databases get them too.
+
+const (
+	createSchemaVersionTable = `CREATE TABLE IF NOT EXISTS schema_version (
+		module VARCHAR(64) NOT NULL PRIMARY KEY,
+		version INT NOT NULL,
+		updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+	);`
+
+	upsertSchemaVersion = `INSERT INTO schema_version (module, version, updated_at)
+		VALUES ($1, $2, NOW())
+		ON CONFLICT (module) DO UPDATE SET version = $2, updated_at = NOW();`
+
+	selectSchemaVersions = `SELECT module, version FROM schema_version;`
+
+	deleteSchemaVersion = `DELETE FROM schema_version WHERE module = $1;`
+)
+
+// migration is an up migration of the tables of a module.
+type migration struct {
+	description string
+	up          string
+}
+
+// migrations holds the ordered up migrations of each module. The schema
+// version of a module is the number of its applied migrations. Migrations are
+// only ever appended.
+var migrations = map[string][]migration{
+	"netsnapshot": {
+		{
+			// These columns were added before the migrations existed and
+			// are already part of the creation scripts.
+			description: "add the network snapshot summary columns and the node failure count",
+			up: `ALTER TABLE network_snapshot
+					ADD COLUMN IF NOT EXISTS oldest_node VARCHAR(256) NOT NULL DEFAULT '',
+					ADD COLUMN IF NOT EXISTS oldest_node_timestamp INT8 NOT NULL DEFAULT 0,
+					ADD COLUMN IF NOT EXISTS latency INT NOT NULL DEFAULT 0;
+				ALTER TABLE node ADD COLUMN IF NOT EXISTS failure_count INT NOT NULL DEFAULT 0;`,
+		},
+	},
+}
+
+// SchemaVersion returns the latest schema version of the named module.
+func SchemaVersion(module string) int {
+	return len(migrations[module])
+}
+
+// pendingMigrations returns the migrations to apply to bring the modules at
+// the given versions to their latest schema version, keyed by module. It
+// fails if any module is at a version this release does not know of.
+func pendingMigrations(versions map[string]int) (map[string][]migration, error) {
+	modules := make([]string, 0, len(versions))
+	for module := range versions {
+		modules = append(modules, module)
+	}
+	sort.Strings(modules)
+	for _, module := range modules {
+		if versions[module] > SchemaVersion(module) {
+			return nil, fmt.Errorf("the %s tables are at schema version %d but this release only "+
+				"supports up to version %d, upgrade pdanalytics", module, versions[module], SchemaVersion(module))
+		}
+	}
+
+	pending := make(map[string][]migration)
+	for module, ms := range migrations {
+		if version := versions[module]; version < len(ms) {
+			pending[module] = ms[version:]
+		}
+	}
+	return pending, nil
+}
+
+// schemaVersions returns the schema version of the modules recorded in the
+// schema_version table.
+func (pg *PgDb) schemaVersions(ctx context.Context) (map[string]int, error) {
+	versions := make(map[string]int)
+	if !pg.TableExists("schema_version") {
+		return versions, nil
+	}
+	rows, err := pg.db.QueryContext(ctx, selectSchemaVersions)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var module string
+		var version int
+		if err = rows.Scan(&module, &version); err != nil {
+			return nil, err
+		}
+		versions[module] = version
+	}
+	return versions, rows.Err()
+}
+
+// CheckSchema returns an error if the database schema is newer than the one
+// of this release.
+func (pg *PgDb) CheckSchema(ctx context.Context) error {
+	versions, err := pg.schemaVersions(ctx)
+	if err != nil {
+		return err
+	}
+	_, err = pendingMigrations(versions)
+	return err
+}
+
+// Migrate applies the pending migrations of every module, each migration in
+// its own transaction. It must be called after CreateTables and fails without
+// applying anything if the database schema is newer than the one of this
+// release.
+func (pg *PgDb) Migrate(ctx context.Context) error {
+	if _, err := pg.db.ExecContext(ctx, createSchemaVersionTable); err != nil {
+		return err
+	}
+	versions, err := pg.schemaVersions(ctx)
+	if err != nil {
+		return err
+	}
+	pending, err := pendingMigrations(versions)
+	if err != nil {
+		return err
+	}
+
+	for _, mt := range createTableScripts {
+		version := versions[mt.module]
+		for _, m := range pending[mt.module] {
+			version++
+			if err = pg.applyMigration(ctx, mt.module, version, m); err != nil {
+				return fmt.Errorf("migration %d of the %s tables failed: %v", version, mt.module, err)
+			}
+			log.Infof("Migrated the %s tables to version %d: %s", mt.module, version, m.description)
+		}
+	}
+	return nil
+}
+
+func (pg *PgDb) applyMigration(ctx context.Context, module string, version int, m migration) error {
+	tx, err := pg.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if _, err = tx.ExecContext(ctx, m.up); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	if _, err = tx.ExecContext(ctx, upsertSchemaVersion, module, version); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// resetSchemaVersion forgets the schema version of a module whose tables are
+// dropped.
+func (pg *PgDb) resetSchemaVersion(module string) error {
+	if !pg.TableExists("schema_version") {
+		return nil
+	}
+	_, err := pg.db.Exec(deleteSchemaVersion, module)
+	return err
+}
@@ -0,0 +1,56 @@
+package postgres
+
+import "testing"
+
+func TestPendingMigrations(t *testing.T) {
+	latest := SchemaVersion("netsnapshot")
+	if latest == 0 {
+		t.Fatal("expected netsnapshot migrations")
+	}
+
+	pending, err := pendingMigrations(map[string]int{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pending["netsnapshot"]) != latest {
+		t.Errorf("expected %d pending netsnapshot migrations on a new database, got %d",
+			latest, len(pending["netsnapshot"]))
+	}
+
+	pending, err = pendingMigrations(map[string]int{"netsnapshot": latest})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pending) != 0 {
+		t.Errorf("expected no pending migrations, got %v", pending)
+	}
+
+	if _, err = pendingMigrations(map[string]int{"netsnapshot": latest + 1}); err == nil {
+		t.Error("expected an error for a newer schema")
+	}
+	if _, err = pendingMigrations(map[string]int{"unknown": 1}); err == nil {
+		t.Error("expected an error for the schema of an unknown module")
+	}
+}
+
+func TestModuleTables(t *testing.T) {
+	tables, err := ModuleTables("pow", "mempool")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"mempool", "mempool_bin", "mempool_fee_rate", "mempool_fee_rate_bin", "mempool_fee_bucket",
+		"mempool_fee_bucket_bin", "mempool_tx", "mempool_tx_bin", "mempool_type", "mempool_type_bin", "pow_data",
+		"pow_bin"}
+	if len(tables) != len(want) {
+		t.Fatalf("tables = %v, want %v", tables, want)
+	}
+	for i := range want {
+		if tables[i] != want[i] {
+			t.Fatalf("tables = %v, want %v", tables, want)
+		}
+	}
+
+	if _, err = ModuleTables("mempool", "agendas"); err == nil {
+		t.Error("expected an error for a module without tables")
+	}
+}
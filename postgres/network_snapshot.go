@@ -6,7 +6,6 @@ import (
 	"fmt"
 	"net"
 	"strings"
-	"time"
 
 	"github.com/planetdecred/pdanalytics/chart"
 	"github.com/planetdecred/pdanalytics/netsnapshot"
@@ -281,6 +280,39 @@ func (pg PgDb) SaveHeartbeat(ctx context.Context, heartbeat netsnapshot.Heartbea
 	return nil
 }
 
+// SaveNetworkPeers writes the crawled nodes and their heartbeats in bulk, in a
+// single transaction. The nodes are merged like UpdateNode does, and the
+// heartbeats like SaveHeartbeat does. The nodes must have distinct addresses
+// and the heartbeats distinct timestamps and addresses.
+func (pg PgDb) SaveNetworkPeers(ctx context.Context, peers []netsnapshot.NetworkPeer, heartbeats []netsnapshot.Heartbeat) error {
+	nodeRows := make([][]interface{}, 0, len(peers))
+	for _, peer := range peers {
+		nodeRows = append(nodeRows, []interface{}{peer.Address, peer.IPVersion, peer.CountryName,
+			peer.RegionName, peer.City, peer.Zip, peer.LastAttempt, peer.LastSeen, peer.LastSuccess,
+			peer.ConnectionTime, int(peer.ProtocolVersion), peer.UserAgent, peer.Services,
+			peer.StartingHeight, peer.CurrentHeight, false, 0})
+	}
+	heartbeatRows := make([][]interface{}, 0, len(heartbeats))
+	for _, heartbeat := range heartbeats {
+		heartbeatRows = append(heartbeatRows, []interface{}{heartbeat.Timestamp, heartbeat.Address,
+			heartbeat.LastSeen, heartbeat.Latency, heartbeat.CurrentHeight})
+	}
+
+	tx, err := pg.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if _, err = copyMergeTx(ctx, tx, nodeCopy, nodeRows); err != nil {
+		_ = tx.Rollback()
+		return fmt.Errorf("error in saving nodes, %s", err.Error())
+	}
+	if _, err = copyMergeTx(ctx, tx, heartbeatCopy, heartbeatRows); err != nil {
+		_ = tx.Rollback()
+		return fmt.Errorf("error in saving heartbeats, %s", err.Error())
+	}
+	return tx.Commit()
+}
+
 func (pg PgDb) AttemptPeer(ctx context.Context, address string, now int64) error {
 	var cols = models.M{
 		models.NodeColumns.LastAttempt: now,
@@ -334,9 +366,28 @@ func (pd PgDb) FindNode(ctx context.Context, address string) (*netsnapshot.Netwo
 		IPVersion:       n.IPVersion,
 		Services:        n.Services,
 		LastAttempt:     n.LastAttempt,
+		IPInfo: netsnapshot.IPInfo{
+			CountryName: n.Country,
+			RegionName:  n.Region,
+			City:        n.City,
+			Zip:         n.Zip,
+		},
 	}, nil
 }
 
+// LocatedNodes returns the addresses of the nodes with a location.
+func (pg PgDb) LocatedNodes(ctx context.Context) ([]string, error) {
+	nodes, err := models.Nodes(models.NodeWhere.Country.NEQ(""), qm.Select(models.NodeColumns.Address)).All(ctx, pg.db)
+	if err != nil {
+		return nil, err
+	}
+	addresses := make([]string, len(nodes))
+	for i, node := range nodes {
+		addresses[i] = node.Address
+	}
+	return addresses, nil
+}
+
 // SaveNode inserts the new node information. The node is marked as alive by default
 func (pg PgDb) SaveNode(ctx context.Context, peer netsnapshot.NetworkPeer) error {
 	newNode := models.Node{
@@ -383,6 +434,9 @@ func (pg PgDb) UpdateNode(ctx context.Context, peer netsnapshot.NetworkPeer) err
 	}
 	if existingNode.Country == "" {
 		cols[models.NodeColumns.Country] = peer.CountryName
+		cols[models.NodeColumns.Region] = peer.RegionName
+		cols[models.NodeColumns.City] = peer.City
+		cols[models.NodeColumns.Zip] = peer.Zip
 		cols[models.NodeColumns.IPVersion] = peer.IPVersion
 	}
 	if existingNode.ConnectionTime == 0 {
@@ -394,6 +448,8 @@ func (pg PgDb) UpdateNode(ctx context.Context, peer netsnapshot.NetworkPeer) err
 
 func (pg PgDb) NetworkPeers(ctx context.Context, timestamp int64, q string, offset int,
 	limit int) ([]netsnapshot.NetworkPeer, int64, error) {
+	pg = *pg.reader()
+
 	where := fmt.Sprintf("heartbeat.timestamp = %d", timestamp)
 	if q != "" {
 		where += fmt.Sprintf(" AND (node.address = '%s' OR node.user_agent = '%s' OR node.country = '%s')", q, q, q)
@@ -816,120 +872,11 @@ func (pg PgDb) NodeVersionsByBin(ctx context.Context, userAgent, bin string) ([]
 
 func (pg *PgDb) UpdateSnapshotNodesBin(ctx context.Context) error {
 	log.Info("Updating snapshot node bin data")
-	// hour bin
-	lastHourEntry, err := models.NetworkSnapshotBins(
-		models.NetworkSnapshotBinWhere.Bin.EQ(string(chart.HourBin)),
-		qm.OrderBy(fmt.Sprintf("%s desc", models.NetworkSnapshotBinColumns.Timestamp)),
-	).One(ctx, pg.db)
-	if err != nil && err != sql.ErrNoRows {
-		return err
-	}
-
-	var nextHour = time.Time{}
-	var lastHour int64
-	if lastHourEntry != nil {
-		lastHour = lastHourEntry.Timestamp
-		nextHour = time.Unix(lastHourEntry.Timestamp, 0).Add(chart.AnHour * time.Second).UTC()
-	}
-	if time.Now().Before(nextHour) {
-		return nil
-	}
-
-	records, err := pg.SnapshotsByTime(ctx, lastHour, 0)
-	if err != nil {
-		return err
-	}
-
-	var dates, heights, nodes, reachableNodes chart.ChartUints
-	for _, rec := range records {
-		dates = append(dates, uint64(rec.Timestamp))
-		heights = append(heights, uint64(rec.Height))
-		nodes = append(nodes, uint64(rec.NodeCount))
-		reachableNodes = append(reachableNodes, uint64(rec.ReachableNodeCount))
-	}
-
-	tx, err := pg.db.Begin()
-	if err != nil {
-		return err
-	}
-	hours, hourHeights, hourIntervals := chart.GenerateHourBin(dates, heights)
-	for i, interval := range hourIntervals {
-		if int64(hours[i]) < nextHour.Unix() {
-			continue
-		}
-		m := models.NetworkSnapshotBin{
-			Timestamp:      int64(hours[i]),
-			Height:         int64(hourHeights[i]),
-			Bin:            string(chart.HourBin),
-			NodeCount:      int(nodes.Avg(interval[0], interval[1])),
-			ReachableNodes: int(reachableNodes.Avg(interval[0], interval[1])),
-		}
-		if err = m.Insert(ctx, tx, boil.Infer()); err != nil {
-			_ = tx.Rollback()
-			return err
-		}
-	}
-	if err = tx.Commit(); err != nil {
-		return err
-	}
-
-	// day bin
-	lastDayEntry, err := models.NetworkSnapshotBins(
-		models.NetworkSnapshotBinWhere.Bin.EQ(string(chart.DayBin)),
-		qm.OrderBy(fmt.Sprintf("%s desc", models.NetworkSnapshotBinColumns.Timestamp)),
-	).One(ctx, pg.db)
-	if err != nil && err != sql.ErrNoRows {
-		return err
-	}
-
-	var nextDay time.Time
-	var lastDay int64
-	if lastDayEntry != nil {
-		lastDay = lastDayEntry.Timestamp
-		nextDay = time.Unix(lastDayEntry.Timestamp, 0).Add(chart.ADay * time.Second).UTC()
-	}
-	if time.Now().Before(nextDay) {
-		return nil
-	}
-
-	records, err = pg.SnapshotsByTime(ctx, lastDay, 0)
+	err := pg.updateBins(ctx, snapshotSeries)
 	if err != nil {
 		return err
 	}
 
-	dates, heights, nodes, reachableNodes = chart.ChartUints{}, chart.ChartUints{}, chart.ChartUints{}, chart.ChartUints{}
-	for _, rec := range records {
-		dates = append(dates, uint64(rec.Timestamp))
-		heights = append(heights, uint64(rec.Height))
-		nodes = append(nodes, uint64(rec.NodeCount))
-		reachableNodes = append(reachableNodes, uint64(rec.ReachableNodeCount))
-	}
-
-	tx, err = pg.db.Begin()
-	if err != nil {
-		return err
-	}
-	days, dayHeights, dayIntervals := chart.GenerateDayBin(dates, heights)
-	for i, interval := range dayIntervals {
-		if int64(days[i]) < nextDay.Unix() {
-			continue
-		}
-		m := models.NetworkSnapshotBin{
-			Timestamp:      int64(days[i]),
-			Height:         int64(dayHeights[i]),
-			Bin:            string(chart.DayBin),
-			NodeCount:      int(nodes.Avg(interval[0], interval[1])),
-			ReachableNodes: int(reachableNodes.Avg(interval[0], interval[1])),
-		}
-		if err = m.Insert(ctx, tx, boil.Infer()); err != nil {
-			_ = tx.Rollback()
-			return err
-		}
-	}
-	if err = tx.Commit(); err != nil {
-		return err
-	}
-
 	if err = pg.UpdateNodeVersion(ctx); err != nil {
 		return err
 	}
@@ -1093,134 +1040,7 @@ func (pg *PgDb) fetchNodeLocationChart(ctx context.Context, startDate int64) (ch
 
 func (pg *PgDb) updateSnapshotVersionBinData(ctx context.Context) error {
 	log.Info("Updating snapshot version bin data")
-	allNodeVersion, err := pg.AllNodeVersions(ctx)
-	if err != nil {
-		return err
-	}
-
-	// hour bin
-	lastHourEntry, err := models.NodeVersions(
-		models.NodeVersionWhere.Bin.EQ(string(chart.HourBin)),
-		qm.OrderBy(fmt.Sprintf("%s desc", models.NodeVersionColumns.Timestamp)),
-	).One(ctx, pg.db)
-	if err != nil && err != sql.ErrNoRows {
-		return err
-	}
-
-	var nextHour = time.Time{}
-	var lastHour int64
-	if lastHourEntry != nil {
-		lastHour = lastHourEntry.Timestamp
-		nextHour = time.Unix(lastHourEntry.Timestamp, 0).Add(chart.AnHour * time.Second).UTC()
-	}
-	if time.Now().Before(nextHour) {
-		return nil
-	}
-	tx, err := pg.db.Begin()
-	if err != nil {
-		return err
-	}
-	for _, userAgent := range allNodeVersion {
-		records, err := models.NodeVersions(
-			models.NodeVersionWhere.Bin.EQ(string(chart.DefaultBin)),
-			models.NodeVersionWhere.UserAgent.EQ(userAgent),
-			models.NodeVersionWhere.Timestamp.GT(lastHour),
-			qm.OrderBy(models.NodeVersionColumns.Timestamp),
-		).All(ctx, pg.db)
-		if err != nil {
-			_ = tx.Rollback()
-			return err
-		}
-		var dates, heights, nodeCounts chart.ChartUints
-		for _, rec := range records {
-			dates = append(dates, uint64(rec.Timestamp))
-			heights = append(heights, uint64(rec.Height))
-			nodeCounts = append(nodeCounts, uint64(rec.NodeCount))
-		}
-		hours, hourHeights, hourIntervals := chart.GenerateHourBin(dates, heights)
-		for i, interval := range hourIntervals {
-			if int64(hours[i]) < nextHour.Unix() {
-				continue
-			}
-			m := models.NodeVersion{
-				Timestamp: int64(hours[i]),
-				Height:    int64(hourHeights[i]),
-				Bin:       string(chart.HourBin),
-				NodeCount: int(nodeCounts.Avg(interval[0], interval[1])),
-				UserAgent: userAgent,
-			}
-			if err = m.Insert(ctx, tx, boil.Infer()); err != nil {
-				_ = tx.Rollback()
-				return err
-			}
-		}
-	}
-	if err = tx.Commit(); err != nil {
-		return err
-	}
-
-	// day bin
-	lastDayEntry, err := models.NodeVersions(
-		models.NodeVersionWhere.Bin.EQ(string(chart.DayBin)),
-		qm.OrderBy(fmt.Sprintf("%s desc", models.NodeVersionColumns.Timestamp)),
-	).One(ctx, pg.db)
-	if err != nil && err != sql.ErrNoRows {
-		return err
-	}
-
-	var nextDay = time.Time{}
-	var lastDay int64
-	if lastDayEntry != nil {
-		lastDay = lastDayEntry.Timestamp
-		nextDay = time.Unix(lastDayEntry.Timestamp, 0).Add(chart.AnHour * time.Second).UTC()
-	}
-	if time.Now().Before(nextDay) {
-		return nil
-	}
-	tx, err = pg.db.Begin()
-	if err != nil {
-		return err
-	}
-	for _, userAgent := range allNodeVersion {
-		records, err := models.NodeVersions(
-			models.NodeVersionWhere.Bin.EQ(string(chart.DefaultBin)),
-			models.NodeVersionWhere.UserAgent.EQ(userAgent),
-			models.NodeVersionWhere.Timestamp.GT(lastDay),
-			qm.OrderBy(models.NodeVersionColumns.Timestamp),
-		).All(ctx, pg.db)
-		if err != nil {
-			_ = tx.Rollback()
-			return err
-		}
-		var dates, heights, nodeCounts chart.ChartUints
-		for _, rec := range records {
-			dates = append(dates, uint64(rec.Timestamp))
-			heights = append(heights, uint64(rec.Height))
-			nodeCounts = append(nodeCounts, uint64(rec.NodeCount))
-		}
-		days, dayHeights, dayIntervals := chart.GenerateDayBin(dates, heights)
-		for i, interval := range dayIntervals {
-			if int64(days[i]) < nextDay.Unix() {
-				continue
-			}
-			m := models.NodeVersion{
-				Timestamp: int64(days[i]),
-				Height:    int64(dayHeights[i]),
-				Bin:       string(chart.DayBin),
-				NodeCount: int(nodeCounts.Avg(interval[0], interval[1])),
-				UserAgent: userAgent,
-			}
-			if err = m.Insert(ctx, tx, boil.Infer()); err != nil {
-				_ = tx.Rollback()
-				return err
-			}
-		}
-	}
-	if err = tx.Commit(); err != nil {
-		return err
-	}
-
-	return nil
+	return pg.updateBins(ctx, nodeVersionSeries)
 }
 
 func (pg *PgDb) UpdateNodeLocation(ctx context.Context) error {
@@ -1278,134 +1098,7 @@ func (pg *PgDb) UpdateNodeLocation(ctx context.Context) error {
 
 func (pg *PgDb) updateNodeLocationBinData(ctx context.Context) error {
 	log.Info("Updating snapshot location bin data")
-	allCountries, err := pg.AllNodeContries(ctx)
-	if err != nil {
-		return err
-	}
-
-	// hour bin
-	lastHourEntry, err := models.NodeLocations(
-		models.NodeLocationWhere.Bin.EQ(string(chart.HourBin)),
-		qm.OrderBy(fmt.Sprintf("%s desc", models.NodeLocationColumns.Timestamp)),
-	).One(ctx, pg.db)
-	if err != nil && err != sql.ErrNoRows {
-		return err
-	}
-
-	var nextHour = time.Time{}
-	var lastHour int64
-	if lastHourEntry != nil {
-		lastHour = lastHourEntry.Timestamp
-		nextHour = time.Unix(lastHourEntry.Timestamp, 0).Add(chart.AnHour * time.Second).UTC()
-	}
-	if time.Now().Before(nextHour) {
-		return nil
-	}
-	tx, err := pg.db.Begin()
-	if err != nil {
-		return err
-	}
-	for _, country := range allCountries {
-		records, err := models.NodeLocations(
-			models.NodeLocationWhere.Bin.EQ(string(chart.DefaultBin)),
-			models.NodeLocationWhere.Country.EQ(country),
-			models.NodeLocationWhere.Timestamp.GT(lastHour),
-			qm.OrderBy(models.NodeVersionColumns.Timestamp),
-		).All(ctx, pg.db)
-		if err != nil {
-			_ = tx.Rollback()
-			return err
-		}
-		var dates, heights, nodeCounts chart.ChartUints
-		for _, rec := range records {
-			dates = append(dates, uint64(rec.Timestamp))
-			heights = append(heights, uint64(rec.Height))
-			nodeCounts = append(nodeCounts, uint64(rec.NodeCount))
-		}
-		hours, hourHeights, hourIntervals := chart.GenerateHourBin(dates, heights)
-		for i, interval := range hourIntervals {
-			if int64(hours[i]) < nextHour.Unix() {
-				continue
-			}
-			m := models.NodeLocation{
-				Timestamp: int64(hours[i]),
-				Height:    int64(hourHeights[i]),
-				Bin:       string(chart.HourBin),
-				NodeCount: int(nodeCounts.Avg(interval[0], interval[1])),
-				Country:   country,
-			}
-			if err = m.Insert(ctx, tx, boil.Infer()); err != nil {
-				_ = tx.Rollback()
-				return err
-			}
-		}
-	}
-	if err = tx.Commit(); err != nil {
-		return err
-	}
-
-	// day bin
-	lastDayEntry, err := models.NodeLocations(
-		models.NodeLocationWhere.Bin.EQ(string(chart.DayBin)),
-		qm.OrderBy(fmt.Sprintf("%s desc", models.NodeLocationColumns.Timestamp)),
-	).One(ctx, pg.db)
-	if err != nil && err != sql.ErrNoRows {
-		return err
-	}
-
-	var nextDay = time.Time{}
-	var lastDay int64
-	if lastDayEntry != nil {
-		lastDay = lastDayEntry.Timestamp
-		nextDay = time.Unix(lastDayEntry.Timestamp, 0).Add(chart.ADay * time.Second).UTC()
-	}
-	if time.Now().Before(nextDay) {
-		return nil
-	}
-	tx, err = pg.db.Begin()
-	if err != nil {
-		return err
-	}
-	for _, country := range allCountries {
-		records, err := models.NodeLocations(
-			models.NodeLocationWhere.Bin.EQ(string(chart.DefaultBin)),
-			models.NodeLocationWhere.Country.EQ(country),
-			models.NodeLocationWhere.Timestamp.GT(lastDay),
-			qm.OrderBy(models.NodeLocationColumns.Timestamp),
-		).All(ctx, pg.db)
-		if err != nil {
-			_ = tx.Rollback()
-			return err
-		}
-		var dates, heights, nodeCounts chart.ChartUints
-		for _, rec := range records {
-			dates = append(dates, uint64(rec.Timestamp))
-			heights = append(heights, uint64(rec.Height))
-			nodeCounts = append(nodeCounts, uint64(rec.NodeCount))
-		}
-		days, dayHeights, dayIntervals := chart.GenerateDayBin(dates, heights)
-		for i, interval := range dayIntervals {
-			if int64(days[i]) < nextDay.Unix() {
-				continue
-			}
-			m := models.NodeLocation{
-				Timestamp: int64(days[i]),
-				Height:    int64(dayHeights[i]),
-				Bin:       string(chart.DayBin),
-				NodeCount: int(nodeCounts.Avg(interval[0], interval[1])),
-				Country:   country,
-			}
-			if err = m.Insert(ctx, tx, boil.Infer()); err != nil {
-				_ = tx.Rollback()
-				return err
-			}
-		}
-	}
-	if err = tx.Commit(); err != nil {
-		return err
-	}
-
-	return nil
+	return pg.updateBins(ctx, nodeLocationSeries)
 }
 
 func (pg *PgDb) FetchNodeLocations(ctx context.Context, offset, limit int) ([]netsnapshot.CountryInfo, int64, error) {
@@ -7,6 +7,7 @@ package postgres
 //go:generate sqlboiler --wipe psql --no-hooks --no-auto-timestamps
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
@@ -18,8 +19,13 @@ import (
 )
 
 type PgDb struct {
-	db           *sql.DB
-	queryTimeout time.Duration
+	db            *sql.DB
+	queryTimeout  time.Duration
+	batchSize     int
+	flushInterval time.Duration
+	// replica reads the heavy chart and HTTP queries from a read-only
+	// replica, when one is set.
+	replica *PgDb
 }
 
 type logWriter struct{}
@@ -29,27 +35,64 @@ func (l logWriter) Write(p []byte) (n int, err error) {
 	return len(p), nil
 }
 
-func NewPgDb(host, port, user, pass, dbname string, debug bool) (*PgDb, error) {
-	db, err := dbhelper.Connect(host, port, user, pass, dbname)
+func NewPgDb(opts dbhelper.ConnOptions, debug bool) (*PgDb, error) {
+	db, err := dbhelper.Open(opts)
 	if err != nil {
 		return nil, err
 	}
-	db.SetMaxOpenConns(5)
 	if debug {
 		boil.DebugMode = true
 		boil.DebugWriter = logWriter{}
 	}
 	return &PgDb{
-		db:           db,
-		queryTimeout: time.Second * 30,
+		db:            db,
+		queryTimeout:  opts.QueryTimeout,
+		batchSize:     defaultBatchSize,
+		flushInterval: defaultFlushInterval,
 	}, nil
 }
 
+// OpenReplica connects to a read-only replica of the database, which then
+// serves the chart and HTTP read queries. The collectors keep writing to the
+// primary, so the replica reads lag behind by the replication delay.
+func (pg *PgDb) OpenReplica(opts dbhelper.ConnOptions) error {
+	db, err := dbhelper.Open(opts)
+	if err != nil {
+		return err
+	}
+	pg.replica = &PgDb{
+		db:            db,
+		queryTimeout:  opts.QueryTimeout,
+		batchSize:     pg.batchSize,
+		flushInterval: pg.flushInterval,
+	}
+	return nil
+}
+
+// reader returns the database to run the heavy read queries on, the replica
+// if one is set.
+func (pg *PgDb) reader() *PgDb {
+	if pg.replica != nil {
+		return pg.replica
+	}
+	return pg
+}
+
 func (pg *PgDb) Close() error {
 	log.Trace("Closing postgresql connection")
+	if pg.replica != nil {
+		if err := pg.replica.db.Close(); err != nil {
+			log.Errorf("Error closing the replica connection: %v", err)
+		}
+	}
 	return pg.db.Close()
 }
 
+// Ping checks that the database is reachable.
+func (pg *PgDb) Ping(ctx context.Context) error {
+	return pg.db.PingContext(ctx)
+}
+
 func (pg *PgDb) timeoutError() string {
 	return fmt.Sprintf("%s after %v", dbhelper.TimeoutPrefix, pg.queryTimeout)
 }
@@ -8,7 +8,6 @@ import (
 	"strings"
 	"time"
 
-	"github.com/davecgh/go-spew/spew"
 	"github.com/planetdecred/pdanalytics/app/helpers"
 	cache "github.com/planetdecred/pdanalytics/chart"
 	"github.com/planetdecred/pdanalytics/postgres/models"
@@ -71,17 +70,14 @@ func (pg *PgDb) AddPowData(ctx context.Context, data []pow.PowData) error {
 		return err
 	}
 
-	added := 0
+	rows := make([][]interface{}, 0, len(data))
 	for _, d := range data {
-		powModel := responseToPowModel(d)
-
-		err := powModel.Insert(ctx, pg.db, boil.Infer())
-		if err != nil {
-			if !strings.Contains(err.Error(), "unique constraint") { // Ignore duplicate entries
-				return err
-			}
-		}
-		added++
+		m := responseToPowModel(d)
+		rows = append(rows, []interface{}{m.Time, m.PoolHashrate, m.Workers, m.CoinPrice, m.BTCPrice, m.Source})
+	}
+	added, err := pg.copyMerge(ctx, powDataCopy, rows)
+	if err != nil {
+		return err
 	}
 	if len(data) == 1 {
 		log.Infof("Added %4d PoW   entry from %10s %s", added, data[0].Source, UnixTimeToString(data[0].Time))
@@ -149,7 +145,7 @@ func (pg *PgDb) FetchPowDataForSync(ctx context.Context, date int64, skip, take
 	powDatum, err := models.PowData(
 		models.PowDatumWhere.Time.GT(int(date)),
 		qm.Offset(skip), qm.Limit(take),
-		qm.OrderBy(models.PowDatumColumns.Time)).All(ctx, pg.db)
+		qm.OrderBy(models.PowDatumColumns.Time+", "+models.PowDatumColumns.Source)).All(ctx, pg.db)
 	if err != nil {
 		return nil, 0, err
 	}
@@ -247,6 +243,8 @@ func (pg *PgDb) powDistinctDates(ctx context.Context, sources []string, startDat
 }
 
 func (pg *PgDb) FetchPowChartData(ctx context.Context, source string, dataType string) (records []pow.PowChartData, err error) {
+	pg = pg.reader()
+
 	dataType = strings.ToLower(dataType)
 	query := fmt.Sprintf("SELECT %s as date, %s as record FROM %s where %s = '%s' ORDER BY %s",
 		models.PowDatumColumns.Time, dataType, models.TableNames.PowData, models.PowDatumColumns.Source, source, models.PowDatumColumns.Time)
@@ -296,6 +294,8 @@ func (pg *PgDb) powDataModelToDto(item *models.PowDatum) (dto pow.PowDataDto, er
 	}, nil
 }
 
+// powDataModelToDomainObj returns the entry as collected, with the pool
+// hashrate in H/s.
 func (pg *PgDb) powDataModelToDomainObj(item *models.PowDatum) (dto pow.PowData, err error) {
 	poolHashRate, err := strconv.ParseFloat(item.PoolHashrate.String, 64)
 	if err != nil {
@@ -314,7 +314,7 @@ func (pg *PgDb) powDataModelToDomainObj(item *models.PowDatum) (dto pow.PowData,
 
 	return pow.PowData{
 		Time:         int64(item.Time),
-		PoolHashrate: poolHashRate,
+		PoolHashrate: poolHashRate * pow.Thash,
 		Workers:      int64(item.Workers.Int),
 		Source:       item.Source,
 		CoinPrice:    coinPrice,
@@ -346,6 +346,7 @@ type powSet struct {
 
 func (pg *PgDb) FetchEncodePowChart(ctx context.Context, dataType,
 	binString string, pools ...string) ([]byte, error) {
+	pg = pg.reader()
 
 	switch binString {
 	case string(cache.DefaultBin):
@@ -471,178 +472,5 @@ func (pg *PgDb) FetchPowChart(ctx context.Context, startDate uint64, endDate uin
 
 func (pg *PgDb) UpdatePowChart(ctx context.Context) error {
 	log.Info("Updating PoW bin data")
-	if err := pg.updatePowHourlyAvg(ctx); err != nil && err != sql.ErrNoRows {
-		return err
-	}
-
-	if err := pg.updatePowDailyAvg(ctx); err != nil && err != sql.ErrNoRows {
-		return err
-	}
-
-	return nil
-}
-
-func (pg *PgDb) updatePowHourlyAvg(ctx context.Context) error {
-	log.Info("Updating PoW hourly avg")
-	lastHourEntry, err := models.PowBins(
-		models.PowBinWhere.Bin.EQ(string(cache.HourBin)),
-		qm.OrderBy(fmt.Sprintf("%s desc", models.PowBinColumns.Time)),
-	).One(ctx, pg.db)
-	if err != nil && err != sql.ErrNoRows {
-		return err
-	}
-
-	var nextHour = time.Time{}
-	if lastHourEntry != nil && lastHourEntry.Time > 0 {
-		nextHour = time.Unix(lastHourEntry.Time, 0).Add(cache.AnHour * time.Second).UTC()
-	} else {
-		firstEntry, err := models.PowData(
-			qm.OrderBy(models.PowDatumColumns.Time),
-		).One(ctx, pg.db)
-		if err != nil {
-			return err
-		}
-		nextHour = time.Unix(int64(firstEntry.Time), 0).UTC()
-	}
-	if time.Now().Before(nextHour) {
-		return nil
-	}
-
-	pools, err := pg.FetchPowSourceData(ctx)
-	if err != nil {
-		return err
-	}
-
-	tx, err := pg.db.Begin()
-	if err != nil {
-		return err
-	}
-
-	step := 7 * 24 * time.Hour
-	timeNow := time.Now().UTC()
-	for nextHour.Unix() < timeNow.Unix() {
-		powSet, err := pg.FetchPowChart(ctx, uint64(nextHour.Unix()), uint64(nextHour.Add(step).Unix()))
-		if err != nil && err != sql.ErrNoRows {
-			return err
-		}
-
-		hours, _, hourIntervals := cache.GenerateHourBin(powSet.time, nil)
-		for _, pool := range pools {
-			for i, interval := range hourIntervals {
-
-				if int64(hours[i]) < nextHour.Unix() {
-					continue
-				}
-				workers := powSet.workers[pool.Source].Avg(interval[0], interval[1])
-				hashrate := powSet.hashrate[pool.Source].Avg(interval[0], interval[1])
-				powBin := models.PowBin{
-					Time:   int64(hours[i]),
-					Bin:    string(cache.HourBin),
-					Source: pool.Source,
-				}
-				if workers != nil {
-					powBin.Workers = null.IntFrom(int(workers.Uint64))
-				}
-				if hashrate != nil {
-					powBin.PoolHashrate = null.StringFrom(fmt.Sprintf("%d", hashrate.Uint64))
-				}
-				if err = powBin.Insert(ctx, tx, boil.Infer()); err != nil {
-					_ = tx.Rollback()
-					spew.Dump(powBin)
-					return err
-				}
-			}
-		}
-		nextHour = nextHour.Add(step)
-	}
-
-	if err = tx.Commit(); err != nil {
-		return err
-	}
-
-	log.Info("PoW hourly average updated")
-
-	return nil
-}
-
-func (pg *PgDb) updatePowDailyAvg(ctx context.Context) error {
-	log.Info("Updating PoW daily avg")
-	lastDayEntry, err := models.PowBins(
-		models.PowBinWhere.Bin.EQ(string(cache.DayBin)),
-		qm.OrderBy(fmt.Sprintf("%s desc", models.PowBinColumns.Time)),
-	).One(ctx, pg.db)
-	if err != nil && err != sql.ErrNoRows {
-		return err
-	}
-
-	var nextday = time.Time{}
-	if lastDayEntry != nil && lastDayEntry.Time > 0 {
-		nextday = time.Unix(lastDayEntry.Time, 0).Add(cache.AnHour * time.Second).UTC()
-	} else {
-		firstEntry, err := models.PowData(
-			qm.OrderBy(models.PowDatumColumns.Time),
-		).One(ctx, pg.db)
-		if err != nil {
-			return err
-		}
-		nextday = time.Unix(int64(firstEntry.Time), 0).UTC()
-	}
-	if time.Now().Before(nextday) {
-		return nil
-	}
-
-	pools, err := pg.FetchPowSourceData(ctx)
-	if err != nil {
-		return err
-	}
-
-	tx, err := pg.db.Begin()
-	if err != nil {
-		return err
-	}
-
-	step := 30 * 24 * time.Hour
-	timeNow := time.Now().UTC()
-	for nextday.Unix() < timeNow.Unix() {
-		powSet, err := pg.FetchPowChart(ctx, uint64(nextday.Unix()), uint64(nextday.Add(step).Unix()))
-		if err != nil && err != sql.ErrNoRows {
-			return err
-		}
-
-		days, _, dayIntervals := cache.GenerateDayBin(powSet.time, nil)
-		for _, pool := range pools {
-			for i, interval := range dayIntervals {
-
-				if int64(days[i]) < nextday.Unix() {
-					continue
-				}
-				workers := powSet.workers[pool.Source].Avg(interval[0], interval[1])
-				hashrate := powSet.hashrate[pool.Source].Avg(interval[0], interval[1])
-				powBin := models.PowBin{
-					Time:   int64(days[i]),
-					Bin:    string(cache.DayBin),
-					Source: pool.Source,
-				}
-				if workers != nil {
-					powBin.Workers = null.IntFrom(int(workers.Uint64))
-				}
-				if hashrate != nil {
-					powBin.PoolHashrate = null.StringFrom(fmt.Sprintf("%d", hashrate.Uint64))
-				}
-				if err = powBin.Insert(ctx, tx, boil.Infer()); err != nil {
-					_ = tx.Rollback()
-					return err
-				}
-			}
-		}
-		nextday = nextday.Add(step)
-	}
-
-	if err = tx.Commit(); err != nil {
-		return err
-	}
-
-	log.Info("PoW daily average updated")
-
-	return nil
+	return pg.updateBins(ctx, powSeries)
 }
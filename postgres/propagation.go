@@ -4,10 +4,8 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
-	"math"
 	"strconv"
 	"strings"
-	"time"
 
 	"github.com/planetdecred/pdanalytics/chart"
 	"github.com/planetdecred/pdanalytics/dbhelper"
@@ -364,619 +362,24 @@ func (pg *PgDb) UpdatePropagationDataForSource(ctx context.Context, source strin
 	return nil
 }
 
-// UpdatePropagationHourlyAvgForSource updates the hourly average deviation of the
-// block receive time of the provided source from this instance
-func (pg *PgDb) UpdatePropagationHourlyAvgForSource(ctx context.Context, source string) error {
-
-	tx, err := pg.db.Begin()
-	if err != nil {
-		return err
-	}
-
-	log.Infof("Updating propagation hourly average for %s", source)
-	lastHourEntry, err := models.Propagations(
-		models.PropagationWhere.Bin.EQ(string(chart.HourBin)),
-		models.PropagationWhere.Source.EQ(source),
-		qm.OrderBy(fmt.Sprintf("%s desc", models.PropagationColumns.Time)),
-	).One(ctx, tx)
-	if err != nil && err != sql.ErrNoRows {
-		_ = tx.Rollback()
-		return err
-	}
-
-	var nextHour time.Time
-	if lastHourEntry != nil {
-		nextHour = time.Unix(lastHourEntry.Time, 0).Add(chart.AnHour * time.Second).UTC()
-	} else {
-		lastHourEntry, err = models.Propagations(
-			models.PropagationWhere.Bin.EQ(string(chart.DefaultBin)),
-			models.PropagationWhere.Source.EQ(source),
-			qm.OrderBy(models.PropagationColumns.Time),
-		).One(ctx, tx)
-		if err != nil {
-			_ = tx.Rollback()
-			return err
-		}
-		nextHour = time.Unix(lastHourEntry.Time, 0).UTC()
-	}
-	if time.Now().Before(nextHour) {
-		_ = tx.Rollback()
-		return nil
-	}
-
-	totalCount, err := models.Propagations(
-		models.PropagationWhere.Bin.EQ(string(chart.DefaultBin)),
-		models.PropagationWhere.Time.GTE(nextHour.Unix()),
-		models.PropagationWhere.Source.EQ(source),
-	).Count(ctx, pg.db)
-	if err != nil {
-		_ = tx.Rollback()
-		return err
-	}
-
-	step := 7 * 24 * time.Hour
-	var processed int64
-	for processed < totalCount {
-		nextEntry, err := models.Propagations(
-			models.PropagationWhere.Bin.EQ(string(chart.DefaultBin)),
-			models.PropagationWhere.Time.GTE(nextHour.Unix()),
-			qm.OrderBy(models.PropagationColumns.Time),
-		).One(ctx, tx)
-		if err != nil && err == sql.ErrNoRows {
-			break
-		} else if err != nil {
-			return nil
-		}
-		nextHour = time.Unix(nextEntry.Time, 0)
-
-		propagations, err := models.Propagations(
-			models.PropagationWhere.Bin.EQ(string(chart.DefaultBin)),
-			models.PropagationWhere.Time.GTE(nextHour.Unix()),
-			models.PropagationWhere.Time.LT(nextHour.Add(step).Unix()),
-			models.PropagationWhere.Source.EQ(source),
-			qm.OrderBy(models.PropagationColumns.Time),
-		).All(ctx, tx)
-		if err != nil && err != sql.ErrNoRows {
-			_ = tx.Rollback()
-			return err
-		}
-		dLen := len(propagations)
-		var dates, heights = make(chart.ChartUints, dLen), make(chart.ChartUints, dLen)
-		var deviations = make(chart.ChartFloats, dLen)
-		for i, rec := range propagations {
-			dates[i] = uint64(rec.Time)
-			heights[i] = uint64(rec.Height)
-			deviations[i] = rec.Deviation
-		}
-		hours, hourHeights, hourIntervals := chart.GenerateHourBin(dates, heights)
-		for i, interval := range hourIntervals {
-			propagationBin := models.Propagation{
-				Time:      int64(hours[i]),
-				Height:    int64(hourHeights[i]),
-				Bin:       string(chart.HourBin),
-				Source:    source,
-				Deviation: deviations.Avg(interval[0], interval[1]),
-			}
-			if err = propagationBin.Insert(ctx, tx, boil.Infer()); err != nil {
-				_ = tx.Rollback()
-				return err
-			}
-		}
-		log.Infof("Processed hourly average of %d to %d of %d propagation records", processed,
-			processed+int64(dLen), totalCount)
-		processed += int64(dLen)
-		nextHour = nextHour.Add(step)
-	}
-
-	if err = tx.Commit(); err != nil {
-		return err
-	}
-	return nil
-}
-
-// UpdatePropagationDailyAvgForSource updates the daily average deviation of the
-// block receive time of the provided source from this instance
-func (pg *PgDb) UpdatePropagationDailyAvgForSource(ctx context.Context, source string) error {
-
-	tx, err := pg.db.Begin()
-	if err != nil {
-		return err
-	}
-	log.Infof("Updating propagation daily average for %s", source)
-	lastDayEntry, err := models.Propagations(
-		models.PropagationWhere.Bin.EQ(string(chart.DayBin)),
-		models.PropagationWhere.Source.EQ(source),
-		qm.OrderBy(fmt.Sprintf("%s desc", models.PropagationColumns.Time)),
-	).One(ctx, tx)
-	if err != nil && err != sql.ErrNoRows {
-		_ = tx.Rollback()
-		return err
-	}
-
-	var nextDay time.Time
-	if lastDayEntry != nil {
-		nextDay = time.Unix(lastDayEntry.Time, 0).Add(chart.ADay * time.Second).UTC()
-	} else {
-		lastDayEntry, err = models.Propagations(
-			models.PropagationWhere.Bin.EQ(string(chart.DefaultBin)),
-			models.PropagationWhere.Source.EQ(source),
-			qm.OrderBy(models.PropagationColumns.Time),
-		).One(ctx, tx)
-		if err != nil {
-			_ = tx.Rollback()
-			return err
-		}
-		nextDay = time.Unix(lastDayEntry.Time, 0).UTC()
-	}
-	if time.Now().Before(nextDay) {
-		_ = tx.Rollback()
-		return nil
-	}
-
-	totalCount, err := models.Propagations(
-		models.PropagationWhere.Time.GTE(nextDay.Unix()),
-		models.PropagationWhere.Source.EQ(source),
-	).Count(ctx, pg.db)
-	if err != nil {
-		_ = tx.Rollback()
-		return err
-	}
-
-	var processed int64
-	step := 30 * 24 * time.Hour
-	for processed < totalCount {
-		nextEntry, err := models.Propagations(
-			models.PropagationWhere.Bin.EQ(string(chart.DefaultBin)),
-			models.PropagationWhere.Time.GTE(nextDay.Unix()),
-			qm.OrderBy(models.PropagationColumns.Time),
-		).One(ctx, tx)
-		if err != nil && err == sql.ErrNoRows {
-			break
-		} else if err != nil {
-			return nil
-		}
-		nextDay = time.Unix(nextEntry.Time, 0)
-		propagations, err := models.Propagations(
-			models.PropagationWhere.Bin.EQ(string(chart.DefaultBin)),
-			models.PropagationWhere.Time.GTE(nextDay.Unix()),
-			models.PropagationWhere.Time.LT(nextDay.Add(step).Unix()),
-			models.PropagationWhere.Source.EQ(source),
-			qm.OrderBy(models.PropagationColumns.Time),
-		).All(ctx, tx)
-		if err != nil && err != sql.ErrNoRows {
-			_ = tx.Rollback()
-			return err
-		}
-		dLen := len(propagations)
-		var dates, heights = make(chart.ChartUints, dLen), make(chart.ChartUints, dLen)
-		var deviations = make(chart.ChartFloats, dLen)
-		for i, rec := range propagations {
-			dates[i] = uint64(rec.Time)
-			heights[i] = uint64(rec.Height)
-			deviations[i] = rec.Deviation
-		}
-		days, dayHeight, dayIntervals := chart.GenerateDayBin(dates, heights)
-		for i, interval := range dayIntervals {
-			propagationBin := models.Propagation{
-				Time:      int64(days[i]),
-				Height:    int64(dayHeight[i]),
-				Bin:       string(chart.DayBin),
-				Source:    source,
-				Deviation: deviations.Avg(interval[0], interval[1]),
-			}
-			if err = propagationBin.Insert(ctx, tx, boil.Infer()); err != nil {
-				_ = tx.Rollback()
-				return err
-			}
-		}
-		log.Infof("Processed daily average of %d to %d of %d propagation records", processed,
-			processed+int64(dLen), totalCount)
-		processed += int64(dLen)
-		nextDay = nextDay.Add(step)
-	}
-
-	if err = tx.Commit(); err != nil {
-		return err
-	}
-	return nil
+// UpdatePropagationBinsForSource updates the hourly, daily, weekly and monthly
+// average deviation of the block receive time of the provided source from this
+// instance
+func (pg *PgDb) UpdatePropagationBinsForSource(ctx context.Context, source string) error {
+	log.Infof("Updating propagation bin data for %s", source)
+	return pg.updateBins(ctx, propagationSeries, source)
 }
 
 // UpdateBlockBinData
 func (pg *PgDb) UpdateBlockBinData(ctx context.Context) error {
 	log.Info("Updating block bin data")
-	if err := pg.updateBlockHourlyAvgData(ctx); err != nil && err != sql.ErrNoRows {
-		return err
-	}
-	if err := pg.updateBlockDailyAvgData(ctx); err != nil && err != sql.ErrNoRows {
-		return err
-	}
-	return nil
-}
-
-func (pg *PgDb) updateBlockHourlyAvgData(ctx context.Context) error {
-	lastEntry, err := models.BlockBins(
-		models.BlockBinWhere.Bin.EQ(string(chart.HourBin)),
-		qm.OrderBy(fmt.Sprintf("%s desc", models.BlockBinColumns.Height)),
-	).One(ctx, pg.db)
-	if err != nil && err != sql.ErrNoRows {
-		return err
-	}
-
-	var nextHour = time.Time{}
-	var lastHeight int64
-	if lastEntry != nil {
-		lastHeight = lastEntry.Height
-		nextHour = time.Unix(lastEntry.InternalTimestamp, 0).Add(chart.AnHour * time.Second).UTC()
-	}
-
-	if time.Now().Before(nextHour) {
-		return nil
-	}
-
-	totalCount, err := models.Blocks(
-		models.BlockWhere.Height.GT(int(lastHeight)),
-	).Count(ctx, pg.db)
-	if err != nil {
-		return err
-	}
-
-	tx, err := pg.db.Begin()
-	if err != nil {
-		return err
-	}
-
-	const pageSize = 1000
-	var processed int64
-	for processed < totalCount {
-		log.Infof("Processing hourly average deviation of %d to %.0f of %d blocks", processed+1,
-			math.Min(float64(processed+pageSize), float64(totalCount)), totalCount)
-		blockSlice, err := models.Blocks(
-			models.BlockWhere.Height.GT(int(lastHeight)), // lastHeight is updated below to ensure appropriate pagination
-			qm.OrderBy(models.BlockColumns.Height),
-			qm.Limit(pageSize),
-		).All(ctx, pg.db)
-		if err != nil && err != sql.ErrNoRows {
-			_ = tx.Rollback()
-			return err
-		}
-		if err == sql.ErrNoRows {
-			break
-		}
-		var dates, heights chart.ChartUints
-		var diffs chart.ChartFloats
-		for _, block := range blockSlice {
-			dates = append(dates, uint64(block.InternalTimestamp.Time.Unix()))
-			heights = append(heights, uint64(block.Height))
-			blockReceiveTimeDiff := block.ReceiveTime.Time.Sub(block.InternalTimestamp.Time).Seconds()
-			diffs = append(diffs, blockReceiveTimeDiff)
-		}
-		hours, hourHeights, hourIntervals := chart.GenerateHourBin(dates, heights)
-		for i, interval := range hourIntervals {
-			if int64(hours[i]) < nextHour.Unix() {
-				continue
-			}
-			blockBin := models.BlockBin{
-				InternalTimestamp: int64(hours[i]),
-				Height:            int64(hourHeights[i]),
-				Bin:               string(chart.HourBin),
-				ReceiveTimeDiff:   diffs.Avg(interval[0], interval[1]),
-			}
-			if err = blockBin.Insert(ctx, tx, boil.Infer()); err != nil {
-				_ = tx.Rollback()
-				return err
-			}
-			lastHeight = blockBin.Height
-		}
-		processed += int64(len(blockSlice))
-	}
-	if err = tx.Commit(); err != nil {
-		return err
-	}
-
-	return nil
-}
-
-func (pg *PgDb) updateBlockDailyAvgData(ctx context.Context) error {
-	lastEntry, err := models.BlockBins(
-		models.BlockBinWhere.Bin.EQ(string(chart.DayBin)),
-		qm.OrderBy(fmt.Sprintf("%s desc", models.BlockBinColumns.Height)),
-	).One(ctx, pg.db)
-	if err != nil && err != sql.ErrNoRows {
-		return err
-	}
-
-	var nextDay = time.Time{}
-	var lastHeight int64
-	if lastEntry != nil {
-		lastHeight = lastEntry.Height
-		nextDay = time.Unix(lastEntry.InternalTimestamp, 0).Add(chart.ADay * time.Second).UTC()
-	}
-
-	if time.Now().Before(nextDay) {
-		return nil
-	}
-
-	totalCount, err := models.Blocks(
-		models.BlockWhere.Height.GT(int(lastHeight)),
-	).Count(ctx, pg.db)
-	if err != nil {
-		return err
-	}
-
-	tx, err := pg.db.Begin()
-	if err != nil {
-		return err
-	}
-
-	const pageSize = 1000
-	var processed int64
-	for processed < totalCount {
-		log.Infof("Processing daily average deviation of %d to %.0f of %d blocks", processed+1,
-			math.Min(float64(processed+pageSize), float64(totalCount)), totalCount)
-		blockSlice, err := models.Blocks(
-			models.BlockWhere.Height.GT(int(lastHeight)), // lastHeight is updated below to ensure appropriate pagination
-			qm.OrderBy(models.BlockColumns.Height),
-			qm.Limit(pageSize),
-		).All(ctx, pg.db)
-		if err != nil && err != sql.ErrNoRows {
-			_ = tx.Rollback()
-			return err
-		}
-		if err == sql.ErrNoRows {
-			break
-		}
-		var dates, heights chart.ChartUints
-		var diffs chart.ChartFloats
-		for _, block := range blockSlice {
-			dates = append(dates, uint64(block.InternalTimestamp.Time.Unix()))
-			heights = append(heights, uint64(block.Height))
-			blockReceiveTimeDiff := block.ReceiveTime.Time.Sub(block.InternalTimestamp.Time).Seconds()
-			diffs = append(diffs, blockReceiveTimeDiff)
-		}
-		days, dayHeights, dayIntervals := chart.GenerateDayBin(dates, heights)
-		for i, interval := range dayIntervals {
-			if int64(days[i]) < nextDay.Unix() {
-				continue
-			}
-			blockBin := models.BlockBin{
-				InternalTimestamp: int64(days[i]),
-				Height:            int64(dayHeights[i]),
-				Bin:               string(chart.DayBin),
-				ReceiveTimeDiff:   diffs.Avg(interval[0], interval[1]),
-			}
-			if err = blockBin.Insert(ctx, tx, boil.Infer()); err != nil {
-				_ = tx.Rollback()
-				return err
-			}
-			lastHeight = blockBin.Height
-		}
-		processed += int64(len(blockSlice))
-	}
-	if err = tx.Commit(); err != nil {
-		return err
-	}
-
-	return nil
+	return pg.updateBins(ctx, blockSeries)
 }
 
 // UpdateVoteTimeDeviationData
 func (pg *PgDb) UpdateVoteTimeDeviationData(ctx context.Context) error {
 	log.Info("Updating vote time deviation data")
-	if err := pg.updateVoteTimeDeviationHourlyAvgData(ctx); err != nil && err != sql.ErrNoRows {
-		return err
-	}
-	if err := pg.updateVoteTimeDeviationDailyAvgData(ctx); err != nil && err != sql.ErrNoRows {
-		return err
-	}
-	return nil
-}
-
-func (pg *PgDb) updateVoteTimeDeviationHourlyAvgData(ctx context.Context) error {
-	lastEntry, err := models.VoteReceiveTimeDeviations(
-		models.VoteReceiveTimeDeviationWhere.Bin.EQ(string(chart.HourBin)),
-		qm.OrderBy(fmt.Sprintf("%s desc", models.VoteReceiveTimeDeviationColumns.BlockTime)),
-		// The retrival process below ensure that all votes for the block is processed in one circle
-		// qm.OrderBy(fmt.Sprintf("%s desc", models.VoteReceiveTimeDeviationColumns.Hash)),
-	).One(ctx, pg.db)
-	if err != nil && err != sql.ErrNoRows {
-		return err
-	}
-
-	var nextHour time.Time
-	if lastEntry != nil {
-		nextHour = time.Unix(lastEntry.BlockTime, 0).Add(chart.AnHour * time.Second).UTC()
-	} else {
-		firstBlock, err := models.Blocks(
-			qm.OrderBy(models.BlockColumns.Height),
-		).One(ctx, pg.db)
-		if err != nil && err != sql.ErrNoRows {
-			return nil
-		}
-		if firstBlock == nil {
-			return nil
-		}
-		nextHour = firstBlock.ReceiveTime.Time
-	}
-
-	if time.Now().Before(nextHour) {
-		return nil
-	}
-
-	totalCount, err := models.Votes(
-		models.VoteWhere.TargetedBlockTime.GTE(null.TimeFrom(nextHour)),
-	).Count(ctx, pg.db)
-	if err != nil {
-		return err
-	}
-
-	if totalCount == 0 {
-		return nil
-	}
-
-	tx, err := pg.db.Begin()
-	if err != nil {
-		return err
-	}
-
-	const step = 7 * 24 * time.Hour
-	var processed int64
-	for processed < totalCount {
-
-		voteSlice, err := models.Votes(
-			// lastHeight is updated below to ensure appropriate pagination
-			models.VoteWhere.TargetedBlockTime.GTE(null.TimeFrom(nextHour)),
-			// Using block height to coordinate pagination to ensure the processing of all votes
-			models.VoteWhere.TargetedBlockTime.LT(null.TimeFrom(nextHour.Add(step))),
-			qm.OrderBy(models.VoteColumns.VotingOn),
-		).All(ctx, tx)
-
-		if err != nil && err != sql.ErrNoRows {
-			_ = tx.Rollback()
-			return err
-		}
-		if err == sql.ErrNoRows {
-			return nil
-		}
-
-		var dates, heights chart.ChartUints
-		var diffs chart.ChartFloats
-		for _, vote := range voteSlice {
-			dates = append(dates, uint64(vote.TargetedBlockTime.Time.Unix()))
-			heights = append(heights, uint64(vote.VotingOn.Int64))
-			blockReceiveTimeDiff := vote.ReceiveTime.Time.Sub(vote.BlockReceiveTime.Time).Seconds()
-			diffs = append(diffs, blockReceiveTimeDiff)
-		}
-		hours, hourHeights, hourIntervals := chart.GenerateHourBin(dates, heights)
-		for i, interval := range hourIntervals {
-			if int64(hours[i]) < nextHour.Unix() {
-				continue
-			}
-			m := models.VoteReceiveTimeDeviation{
-				BlockTime:             int64(hours[i]),
-				BlockHeight:           int64(hourHeights[i]),
-				Bin:                   string(chart.HourBin),
-				ReceiveTimeDifference: diffs.Avg(interval[0], interval[1]),
-			}
-			if err = m.Insert(ctx, tx, boil.Infer()); err != nil {
-				_ = tx.Rollback()
-				return err
-			}
-		}
-
-		log.Infof("Processed hourly average vote receive time deviation of %d to %d of %d votes", processed,
-			processed+int64(len(voteSlice)), totalCount)
-		processed += int64(len(voteSlice))
-		nextHour = nextHour.Add(step)
-	}
-	if err = tx.Commit(); err != nil {
-		return err
-	}
-
-	return nil
-}
-
-func (pg *PgDb) updateVoteTimeDeviationDailyAvgData(ctx context.Context) error {
-	lastEntry, err := models.VoteReceiveTimeDeviations(
-		models.VoteReceiveTimeDeviationWhere.Bin.EQ(string(chart.DayBin)),
-		qm.OrderBy(fmt.Sprintf("%s desc", models.VoteReceiveTimeDeviationColumns.BlockTime)),
-		// The retrival process below ensure that all votes for the block is processed in one circle
-		// qm.OrderBy(fmt.Sprintf("%s desc", models.VoteReceiveTimeDeviationColumns.Hash)),
-	).One(ctx, pg.db)
-	if err != nil && err != sql.ErrNoRows {
-		return err
-	}
-
-	var nextDay time.Time
-	if lastEntry != nil {
-		nextDay = time.Unix(lastEntry.BlockTime, 0).Add(chart.ADay * time.Second).UTC()
-	} else {
-		firstBlock, err := models.Blocks(
-			qm.OrderBy(models.BlockColumns.Height),
-		).One(ctx, pg.db)
-		if err != nil && err != sql.ErrNoRows {
-			return nil
-		}
-		if firstBlock == nil {
-			return nil
-		}
-		nextDay = firstBlock.ReceiveTime.Time
-	}
-
-	if time.Now().Before(nextDay) {
-		return nil
-	}
-
-	totalCount, err := models.Votes(
-		models.VoteWhere.TargetedBlockTime.GTE(null.TimeFrom(nextDay)),
-	).Count(ctx, pg.db)
-	if err != nil {
-		return err
-	}
-
-	if totalCount == 0 {
-		return nil
-	}
-
-	tx, err := pg.db.Begin()
-	if err != nil {
-		return err
-	}
-
-	const step = 14 * 24 * time.Hour // 14 days
-	var processed int64
-	for processed < totalCount {
-
-		voteSlice, err := models.Votes(
-			// lastHeight is updated below to ensure appropriate pagination
-			models.VoteWhere.TargetedBlockTime.GTE(null.TimeFrom(nextDay)),
-			// Using block height to coordinate pagination to ensure the processing of all votes
-			models.VoteWhere.TargetedBlockTime.LT(null.TimeFrom(nextDay.Add(step))),
-			qm.OrderBy(models.VoteColumns.VotingOn),
-		).All(ctx, tx)
-
-		if err != nil && err != sql.ErrNoRows {
-			_ = tx.Rollback()
-			return err
-		}
-		if err == sql.ErrNoRows {
-			return nil
-		}
-
-		var dates, heights chart.ChartUints
-		var diffs chart.ChartFloats
-		for _, vote := range voteSlice {
-			dates = append(dates, uint64(vote.TargetedBlockTime.Time.Unix()))
-			heights = append(heights, uint64(vote.VotingOn.Int64))
-			blockReceiveTimeDiff := vote.ReceiveTime.Time.Sub(vote.BlockReceiveTime.Time).Seconds()
-			diffs = append(diffs, blockReceiveTimeDiff)
-		}
-		days, dayHeights, dayIntervals := chart.GenerateDayBin(dates, heights)
-		for i, interval := range dayIntervals {
-			if int64(days[i]) < nextDay.Unix() {
-				continue
-			}
-			m := models.VoteReceiveTimeDeviation{
-				BlockTime:             int64(days[i]),
-				BlockHeight:           int64(dayHeights[i]),
-				Bin:                   string(chart.DayBin),
-				ReceiveTimeDifference: diffs.Avg(interval[0], interval[1]),
-			}
-			if err = m.Insert(ctx, tx, boil.Infer()); err != nil {
-				_ = tx.Rollback()
-				return err
-			}
-		}
-
-		log.Infof("Processed daily average vote receive time deviation of %d to %d of %d votes", processed,
-			processed+int64(len(voteSlice)), totalCount)
-		processed += int64(len(voteSlice))
-		nextDay = nextDay.Add(step)
-	}
-	if err = tx.Commit(); err != nil {
-		return err
-	}
-
-	return nil
+	return pg.updateBins(ctx, voteSeries)
 }
 
 func (pg *PgDb) SourceDeviations(ctx context.Context, source, bin string) (records []propagation.SourceDeviation, err error) {
@@ -1034,3 +437,49 @@ func (pg *PgDb) VoteReceiveTimeDeviations(ctx context.Context, bin string) (resu
 	}
 	return
 }
+
+// RollbackBlocks deletes the blocks above the given height together with the
+// votes and the chart data derived from them. It is used to undo the blocks
+// detached from the best chain during a reorg.
+func (pg *PgDb) RollbackBlocks(ctx context.Context, height uint32) error {
+	tx, err := pg.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	votes, err := models.Votes(models.VoteWhere.VotingOn.GT(null.Int64From(int64(height)))).DeleteAll(ctx, tx)
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	blocks, err := models.Blocks(models.BlockWhere.Height.GT(int(height))).DeleteAll(ctx, tx)
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	if _, err = models.BlockBins(models.BlockBinWhere.Height.GT(int64(height))).DeleteAll(ctx, tx); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	if _, err = models.VoteReceiveTimeDeviations(
+		models.VoteReceiveTimeDeviationWhere.BlockHeight.GT(int64(height)),
+	).DeleteAll(ctx, tx); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	if _, err = models.Propagations(models.PropagationWhere.Height.GT(int64(height))).DeleteAll(ctx, tx); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+
+	log.Infof("Rolled back %d blocks and %d votes above height %d", blocks, votes, height)
+	return nil
+}
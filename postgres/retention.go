@@ -0,0 +1,175 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/planetdecred/pdanalytics/retention"
+)
+
+// pruneBatchSize is the number of rows deleted per statement so pruning a
+// large backlog does not hold long locks.
+const pruneBatchSize = 10000
+
+// prunableTable describes how the raw rows of a table are pruned.
+type prunableTable struct {
+	// coverage returns, per group, the unix time up to which the raw rows are
+	// covered by aggregates. That is the start of the latest bin of the
+	// least advanced bin level, as that bin may still be partial. The group
+	// is empty for tables that are not aggregated per group.
+	coverage string
+	// prune deletes a batch of the rows older than the unix time $1, of the
+	// group $2 for grouped tables.
+	prune   string
+	grouped bool
+}
+
+var prunableTables = map[string]prunableTable{
+	"mempool": {
+		coverage: `SELECT '', MIN(last) FROM (
+				SELECT MAX(time) AS last FROM mempool_bin WHERE bin IN ('hour', 'day') GROUP BY bin
+			) b HAVING COUNT(*) = 2;`,
+		prune: `DELETE FROM mempool WHERE ctid = ANY(ARRAY(
+				SELECT ctid FROM mempool WHERE time < to_timestamp($1) AT TIME ZONE 'UTC' LIMIT %d));`,
+	},
+	"mempool_fee_rate": {
+		coverage: `SELECT '', MIN(last) FROM (
+				SELECT MAX(time) AS last FROM mempool_fee_rate_bin WHERE bin IN ('hour', 'day') GROUP BY bin
+			) b HAVING COUNT(*) = 2;`,
+		prune: `DELETE FROM mempool_fee_rate WHERE ctid = ANY(ARRAY(
+				SELECT ctid FROM mempool_fee_rate WHERE time < to_timestamp($1) AT TIME ZONE 'UTC' LIMIT %d));`,
+	},
+	"mempool_fee_bucket": {
+		coverage: `SELECT '', MIN(last) FROM (
+				SELECT MAX(time) AS last FROM mempool_fee_bucket_bin WHERE bin IN ('hour', 'day') GROUP BY bin
+			) b HAVING COUNT(*) = 2;`,
+		prune: `DELETE FROM mempool_fee_bucket WHERE ctid = ANY(ARRAY(
+				SELECT ctid FROM mempool_fee_bucket WHERE time < to_timestamp($1) AT TIME ZONE 'UTC' LIMIT %d));`,
+	},
+	"mempool_type": {
+		coverage: `SELECT '', MIN(last) FROM (
+				SELECT MAX(time) AS last FROM mempool_type_bin WHERE bin IN ('hour', 'day') GROUP BY bin
+			) b HAVING COUNT(*) = 2;`,
+		prune: `DELETE FROM mempool_type WHERE ctid = ANY(ARRAY(
+				SELECT ctid FROM mempool_type WHERE time < to_timestamp($1) AT TIME ZONE 'UTC' LIMIT %d));`,
+	},
+	"mempool_tx": {
+		coverage: `SELECT '', MIN(last) FROM (
+				SELECT MAX(time) AS last FROM mempool_tx_bin WHERE bin IN ('hour', 'day') GROUP BY bin
+			) b HAVING COUNT(*) = 2;`,
+		prune: `DELETE FROM mempool_tx WHERE ctid = ANY(ARRAY(
+				SELECT ctid FROM mempool_tx WHERE time < to_timestamp($1) AT TIME ZONE 'UTC' LIMIT %d));`,
+	},
+	"heartbeat": {
+		coverage: `SELECT '', MIN(last) FROM (
+				SELECT MAX(timestamp) AS last FROM network_snapshot_bin WHERE bin IN ('hour', 'day') GROUP BY bin
+			) b HAVING COUNT(*) = 2;`,
+		prune: `DELETE FROM heartbeat WHERE ctid = ANY(ARRAY(
+				SELECT ctid FROM heartbeat WHERE timestamp < $1 LIMIT %d));`,
+	},
+	"block": {
+		coverage: `SELECT '', MIN(last) FROM (
+				SELECT MAX(internal_timestamp) AS last FROM block_bin WHERE bin IN ('hour', 'day') GROUP BY bin
+			) b HAVING COUNT(*) = 2;`,
+		prune: `DELETE FROM block WHERE ctid = ANY(ARRAY(
+				SELECT ctid FROM block WHERE receive_time < to_timestamp($1) AT TIME ZONE 'UTC' LIMIT %d));`,
+	},
+	"vote": {
+		coverage: `SELECT '', MIN(last) FROM (
+				SELECT MAX(block_time) AS last FROM vote_receive_time_deviation WHERE bin IN ('hour', 'day') GROUP BY bin
+			) b HAVING COUNT(*) = 2;`,
+		prune: `DELETE FROM vote WHERE ctid = ANY(ARRAY(
+				SELECT ctid FROM vote WHERE receive_time < to_timestamp($1) AT TIME ZONE 'UTC' LIMIT %d));`,
+	},
+	"pow_data": {
+		coverage: `SELECT source, MIN(last) FROM (
+				SELECT source, MAX(time) AS last FROM pow_bin WHERE bin IN ('hour', 'day') GROUP BY source, bin
+			) b GROUP BY source HAVING COUNT(*) = 2;`,
+		prune: `DELETE FROM pow_data WHERE ctid = ANY(ARRAY(
+				SELECT ctid FROM pow_data WHERE time < $1 AND source = $2 LIMIT %d));`,
+		grouped: true,
+	},
+	"vsp_tick": {
+		coverage: `SELECT vsp_id::TEXT, MIN(last) FROM (
+				SELECT vsp_id, MAX(time) AS last FROM vsp_tick_bin WHERE bin IN ('hour', 'day') GROUP BY vsp_id, bin
+			) b GROUP BY vsp_id HAVING COUNT(*) = 2;`,
+		prune: `DELETE FROM vsp_tick WHERE ctid = ANY(ARRAY(
+				SELECT ctid FROM vsp_tick WHERE time < to_timestamp($1) AND vsp_id = $2::INT LIMIT %d));`,
+		grouped: true,
+	},
+	// The short interval exchange ticks are covered by the hourly and daily
+	// ticks fetched from the same exchange.
+	"exchange_tick": {
+		coverage: `SELECT exchange_id::TEXT || ':' || currency_pair, MIN(last)::INT8 FROM (
+				SELECT exchange_id, currency_pair, interval, EXTRACT(EPOCH FROM MAX(time)) AS last
+				FROM exchange_tick WHERE interval >= 60 GROUP BY exchange_id, currency_pair, interval
+			) b GROUP BY exchange_id, currency_pair;`,
+		prune: `DELETE FROM exchange_tick WHERE ctid = ANY(ARRAY(
+				SELECT ctid FROM exchange_tick WHERE interval < 60 AND time < to_timestamp($1)
+				AND exchange_id::TEXT || ':' || currency_pair = $2 LIMIT %d));`,
+		grouped: true,
+	},
+}
+
+// PruneTable deletes the raw rows of table older than olderThan, or than the
+// start of the latest aggregates if they lag behind. Tables aggregated per
+// source are pruned per source. Nothing is deleted while the aggregates are
+// missing.
+func (pg *PgDb) PruneTable(ctx context.Context, table string, olderThan time.Time) (retention.PruneResult, error) {
+	res := retention.PruneResult{Table: table}
+	pt, found := prunableTables[table]
+	if !found {
+		return res, fmt.Errorf("the %s table cannot be pruned", table)
+	}
+
+	rows, err := pg.db.QueryContext(ctx, pt.coverage)
+	if err != nil {
+		return res, err
+	}
+	coverage := make(map[string]int64)
+	for rows.Next() {
+		var group string
+		var covered int64
+		if err = rows.Scan(&group, &covered); err != nil {
+			rows.Close()
+			return res, err
+		}
+		coverage[group] = covered
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return res, err
+	}
+
+	for group, covered := range coverage {
+		cutoff := olderThan.Unix()
+		if covered < cutoff {
+			cutoff = covered
+			res.Lagging = true
+		}
+		if res.Cutoff.IsZero() || cutoff < res.Cutoff.Unix() {
+			res.Cutoff = time.Unix(cutoff, 0)
+		}
+
+		args := []interface{}{cutoff}
+		if pt.grouped {
+			args = append(args, group)
+		}
+		for {
+			result, err := pg.db.ExecContext(ctx, fmt.Sprintf(pt.prune, pruneBatchSize), args...)
+			if err != nil {
+				return res, err
+			}
+			deleted, err := result.RowsAffected()
+			if err != nil {
+				return res, err
+			}
+			res.Deleted += deleted
+			if deleted < pruneBatchSize {
+				break
+			}
+		}
+	}
+	return res, nil
+}
@@ -3,6 +3,7 @@ package postgres
 import (
 	"context"
 	"fmt"
+	"strings"
 )
 
 const (
@@ -28,6 +29,86 @@ const (
 		PRIMARY KEY (time,bin)
 	);`
 
+	createMempoolFeeRateTable = `CREATE TABLE IF NOT EXISTS mempool_fee_rate (
+		time timestamp,
+		fee_rate_p10 INT8 NOT NULL,
+		fee_rate_p50 INT8 NOT NULL,
+		fee_rate_p90 INT8 NOT NULL,
+		PRIMARY KEY (time)
+	);`
+
+	createMempoolFeeRateBinTable = `CREATE TABLE IF NOT EXISTS mempool_fee_rate_bin (
+		time INT8,
+		bin VARCHAR(25),
+		fee_rate_p10 INT8,
+		fee_rate_p50 INT8,
+		fee_rate_p90 INT8,
+		PRIMARY KEY (time,bin)
+	);`
+
+	createMempoolFeeBucketTable = `CREATE TABLE IF NOT EXISTS mempool_fee_bucket (
+		time timestamp,
+		fee_rate INT8,
+		tx_count INT NOT NULL,
+		size INT8 NOT NULL,
+		PRIMARY KEY (time,fee_rate)
+	);`
+
+	createMempoolFeeBucketBinTable = `CREATE TABLE IF NOT EXISTS mempool_fee_bucket_bin (
+		time INT8,
+		bin VARCHAR(25),
+		fee_rate INT8,
+		tx_count INT,
+		size INT8,
+		PRIMARY KEY (time,bin,fee_rate)
+	);`
+
+	createMempoolTypeTable = `CREATE TABLE IF NOT EXISTS mempool_type (
+		time timestamp,
+		tx_type VARCHAR(16),
+		tx_count INT NOT NULL,
+		size INT8 NOT NULL,
+		fees FLOAT8 NOT NULL,
+		total FLOAT8 NOT NULL,
+		PRIMARY KEY (time,tx_type)
+	);`
+
+	createMempoolTypeBinTable = `CREATE TABLE IF NOT EXISTS mempool_type_bin (
+		time INT8,
+		bin VARCHAR(25),
+		tx_type VARCHAR(16),
+		tx_count INT,
+		size INT8,
+		fees FLOAT8,
+		total FLOAT8,
+		PRIMARY KEY (time,bin,tx_type)
+	);`
+
+	createMempoolTxTable = `CREATE TABLE IF NOT EXISTS mempool_tx (
+		hash VARCHAR(64) NOT NULL,
+		tx_type VARCHAR(16) NOT NULL,
+		size INT NOT NULL,
+		fee_rate INT8 NOT NULL,
+		fee_rate_bucket INT8 NOT NULL,
+		first_seen_time timestamp NOT NULL,
+		first_seen_height INT8 NOT NULL,
+		outcome VARCHAR(16) NOT NULL,
+		height INT8 NOT NULL,
+		time timestamp NOT NULL,
+		PRIMARY KEY (hash)
+	);`
+
+	createMempoolTxIndex = `CREATE INDEX IF NOT EXISTS mempool_tx_time_idx ON mempool_tx (time);`
+
+	createMempoolTxBinTable = `CREATE TABLE IF NOT EXISTS mempool_tx_bin (
+		time INT8,
+		bin VARCHAR(25),
+		tx_type VARCHAR(16),
+		tx_count INT,
+		latency FLOAT8,
+		PRIMARY KEY (time,bin,tx_type)
+	);`
+
 	createNetworkSnapshotTable = `CREATE TABLE If NOT EXISTS network_snapshot (
 		timestamp INT8 NOT NULL,
 		height INT8 NOT NULL,
@@ -141,65 +222,78 @@ const (
 	);`
 )
 
-var (
-	createTableScripts = map[string]string{
-		"mempool":                     createMempoolTable,
-		"mempool_bin":                 createMempoolDayBinTable,
-		"network_snapshot":            createNetworkSnapshotTable,
-		"network_snapshot_bin":        createNetworkSnapshotBinTable,
-		"node_version":                createNodeVersionTable,
-		"node_location":               createNodeLocationTable,
-		"node":                        createNodeTable,
-		"heartbeat":                   createHeartbeatTable,
-		"propagation":                 createPropagationTableScript,
-		"block":                       createBlockTableScript,
-		"block_bin":                   createBlockBinTableScript,
-		"vote":                        createVoteTableScript,
-		"vote_receive_time_deviation": createVoteReceiveTimeDeviationTableScript,
-		"exchange":                    createExchangeTable,
-		"exchange_tick":               createExchangeTickTable,
-		"reddit":                      createRedditTable,
-		"twitter":                     createTwitterTable,
-		"github":                      createGithubTable,
-		"youtube":                     createYoutubeTable,
-		"pow_data":                    createPowDataTable,
-		"pow_bin":                     createPowBInTable,
-		"vsp":                         createVSPInfoTable,
-		"vsp_tick":                    createVSPTickTable,
-		"vsp_tick_bin":                createVSPTickBinTable,
-	}
+// table is a postgres table and the script that creates it.
+type table struct {
+	name   string
+	script string
+}
+
+// moduleTables are the tables wanted by a module.
+type moduleTables struct {
+	module string
+	tables []table
+}
 
-	tableOrder = []string{
-		"mempool",
-		"mempool_bin",
-		"network_snapshot",
-		"network_snapshot_bin",
-		"node_version",
-		"node_location",
-		"node",
-		"heartbeat",
-		"propagation",
-		"block",
-		"block_bin",
-		"vote",
-		"vote_receive_time_deviation",
-		"proposals",
-		"proposal_votes",
-		"exchange",
-		"exchange_tick",
-		"reddit",
-		"twitter",
-		"github",
-		"youtube",
-		"pow_data",
-		"pow_bin",
-		"vsp",
-		"vsp_tick",
-		"vsp_tick_bin",
+var (
+	// createTableScripts holds the tables of each module, in creation order.
+	// The _bin aggregates belong to the module of the table they aggregate.
+	createTableScripts = []moduleTables{
+		{"mempool", []table{
+			{"mempool", createMempoolTable},
+			{"mempool_bin", createMempoolDayBinTable},
+			{"mempool_fee_rate", createMempoolFeeRateTable},
+			{"mempool_fee_rate_bin", createMempoolFeeRateBinTable},
+			{"mempool_fee_bucket", createMempoolFeeBucketTable},
+			{"mempool_fee_bucket_bin", createMempoolFeeBucketBinTable},
+			{"mempool_tx", createMempoolTxTable},
+			{"mempool_tx_bin", createMempoolTxBinTable},
+			{"mempool_type", createMempoolTypeTable},
+			{"mempool_type_bin", createMempoolTypeBinTable},
+		}},
+		{"netsnapshot", []table{
+			{"network_snapshot", createNetworkSnapshotTable},
+			{"network_snapshot_bin", createNetworkSnapshotBinTable},
+			{"node_version", createNodeVersionTable},
+			{"node_location", createNodeLocationTable},
+			{"node", createNodeTable},
+			{"heartbeat", createHeartbeatTable},
+		}},
+		{"propagation", []table{
+			{"propagation", createPropagationTableScript},
+			{"block", createBlockTableScript},
+			{"block_bin", createBlockBinTableScript},
+			{"vote", createVoteTableScript},
+			{"vote_receive_time_deviation", createVoteReceiveTimeDeviationTableScript},
+		}},
+		{"exchanges", []table{
+			{"exchange", createExchangeTable},
+			{"exchange_tick", createExchangeTickTable},
+		}},
+		{"commstats", []table{
+			{"reddit", createRedditTable},
+			{"twitter", createTwitterTable},
+			{"github", createGithubTable},
+			{"youtube", createYoutubeTable},
+		}},
+		{"pow", []table{
+			{"pow_data", createPowDataTable},
+			{"pow_bin", createPowBInTable},
+		}},
+		{"vsp", []table{
+			{"vsp", createVSPInfoTable},
+			{"vsp_tick", createVSPTickTable},
+			{"vsp_tick_bin", createVSPTickBinTable},
+		}},
+		{"sync", []table{
+			{"sync_cursor", createSyncCursorTable},
+		}},
 	}
 
 	// createIndexScripts is a map of table name to a collection of index on the table
 	createIndexScripts = map[string][]string{
+		"mempool_tx": {
+			createMempoolTxIndex,
+		},
 		"exchange_tick": {
 			createExchangeTickIndex,
 		},
@@ -209,30 +303,69 @@ var (
 	}
 )
 
+// TableModules returns the names of the modules that own postgres tables, in
+// table creation order.
+func TableModules() []string {
+	modules := make([]string, 0, len(createTableScripts))
+	for _, mt := range createTableScripts {
+		modules = append(modules, mt.module)
+	}
+	return modules
+}
+
+// ModuleTables returns the names of the tables wanted by the named modules, in
+// creation order. All the tables are returned when no module is named.
+func ModuleTables(modules ...string) ([]string, error) {
+	wanted := make(map[string]bool, len(modules))
+	for _, name := range modules {
+		wanted[name] = true
+	}
+	var tables []string
+	for _, mt := range createTableScripts {
+		if len(modules) > 0 && !wanted[mt.module] {
+			continue
+		}
+		delete(wanted, mt.module)
+		for _, t := range mt.tables {
+			tables = append(tables, t.name)
+		}
+	}
+	for _, name := range modules {
+		if !wanted[name] {
+			continue
+		}
+		return nil, fmt.Errorf("module %s has no postgres tables, expected one of %s", name,
+			strings.Join(TableModules(), ", "))
+	}
+	return tables, nil
+}
+
 func (pg *PgDb) CreateTables(ctx context.Context) error {
 	tx, err := pg.db.Begin()
 	if err != nil {
 		return err
 	}
-	for _, tableName := range tableOrder {
-		if exist := pg.TableExists(tableName); exist {
-			continue
-		}
-		_, err := tx.Exec(createTableScripts[tableName])
-		if err != nil {
-			_ = tx.Rollback()
-			log.Errorf("an error occurred while running %s", createTableScripts[tableName])
-			return err
-		}
-		for _, createScript := range createIndexScripts[tableName] {
-			_, err := tx.Exec(createScript)
+	for _, mt := range createTableScripts {
+		for _, t := range mt.tables {
+			if exist := pg.TableExists(t.name); exist {
+				continue
+			}
+			_, err := tx.Exec(t.script)
 			if err != nil {
 				_ = tx.Rollback()
-				log.Errorf("an error occurred while running %s", createIndexScripts[tableName])
+				log.Errorf("an error occurred while running %s", t.script)
 				return err
 			}
+			for _, createScript := range createIndexScripts[t.name] {
+				_, err := tx.Exec(createScript)
+				if err != nil {
+					_ = tx.Rollback()
+					log.Errorf("an error occurred while running %s", createIndexScripts[t.name])
+					return err
+				}
+			}
+			log.Infof("Created %s table", t.name)
 		}
-		log.Infof("Created %s table", tableName)
 	}
 	return tx.Commit()
 }
@@ -250,9 +383,31 @@ func (pg *PgDb) TableExists(name string) bool {
 	return false
 }
 
+// DropTables drops all the tables.
 func (pg *PgDb) DropTables() error {
-	for tableName := range createTableScripts {
-		if err := pg.dropTable(tableName); err != nil {
+	return pg.DropModuleTables()
+}
+
+// DropModuleTables drops the tables wanted by the named modules, or all the
+// tables when no module is named. The tables are dropped in the reverse
+// creation order so referencing tables go first.
+func (pg *PgDb) DropModuleTables(modules ...string) error {
+	tables, err := ModuleTables(modules...)
+	if err != nil {
+		return err
+	}
+	for i := len(tables) - 1; i >= 0; i-- {
+		if err := pg.dropTable(tables[i]); err != nil {
+			return err
+		}
+		log.Infof("Dropped %s table", tables[i])
+	}
+
+	if len(modules) == 0 {
+		modules = TableModules()
+	}
+	for _, module := range modules {
+		if err := pg.resetSchemaVersion(module); err != nil {
 			return err
 		}
 	}
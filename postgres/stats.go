@@ -0,0 +1,78 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/lib/pq"
+	"github.com/planetdecred/pdanalytics/stats"
+)
+
+// tableTimeColumns are the time columns of the tables, for their time range in
+// the storage stats and the backup manifests.
+var tableTimeColumns = map[string]string{
+	"mempool":            "time",
+	"mempool_fee_rate":   "time",
+	"mempool_fee_bucket": "time",
+	"mempool_tx":         "time",
+	"mempool_type":       "time",
+	"block":              "receive_time",
+	"vote":               "receive_time",
+	"exchange_tick":      "time",
+	"vsp_tick":           "time",
+	"reddit":             "date",
+	"twitter":            "date",
+	"github":             "date",
+	"youtube":            "date",
+	// unix seconds
+	"pow_data":         "to_timestamp(time)",
+	"network_snapshot": "to_timestamp(timestamp)",
+	"heartbeat":        "to_timestamp(timestamp)",
+}
+
+// StorageModules returns the modules that own postgres tables.
+func (pg *PgDb) StorageModules() []string {
+	return TableModules()
+}
+
+// ModuleStorageStats returns the row count, size and time range of the
+// existing tables of the module, read from the replica when one is set.
+func (pg *PgDb) ModuleStorageStats(ctx context.Context, module string) ([]stats.TableStats, error) {
+	tables, err := ModuleTables(module)
+	if err != nil {
+		return nil, err
+	}
+	pg = pg.reader()
+	var result []stats.TableStats
+	for _, name := range tables {
+		if !pg.TableExists(name) {
+			continue
+		}
+		table, err := pg.tableStats(ctx, name)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read the stats of the %s table: %v", name, pg.replaceCancelError(err))
+		}
+		result = append(result, table)
+	}
+	return result, nil
+}
+
+func (pg *PgDb) tableStats(ctx context.Context, name string) (stats.TableStats, error) {
+	table := stats.TableStats{Name: name}
+	timeColumn, found := tableTimeColumns[name]
+	if !found {
+		err := pg.db.QueryRowContext(ctx, fmt.Sprintf("SELECT COUNT(*), pg_total_relation_size($1::regclass) FROM %s",
+			pq.QuoteIdentifier(name)), name).Scan(&table.Rows, &table.Size)
+		return table, err
+	}
+	var oldest, newest sql.NullTime
+	err := pg.db.QueryRowContext(ctx, fmt.Sprintf("SELECT COUNT(*), pg_total_relation_size($1::regclass), "+
+		"MIN(%s), MAX(%s) FROM %s", timeColumn, timeColumn, pq.QuoteIdentifier(name)), name).
+		Scan(&table.Rows, &table.Size, &oldest, &newest)
+	if oldest.Valid && newest.Valid {
+		oldestUTC, newestUTC := oldest.Time.UTC(), newest.Time.UTC()
+		table.Oldest, table.Newest = &oldestUTC, &newestUTC
+	}
+	return table, err
+}
@@ -0,0 +1,40 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+)
+
+const (
+	createSyncCursorTable = `CREATE TABLE IF NOT EXISTS sync_cursor (
+		source TEXT NOT NULL,
+		table_name VARCHAR(64) NOT NULL,
+		cursor INT8 NOT NULL,
+		updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+		PRIMARY KEY (source, table_name)
+	);`
+
+	selectSyncCursor = `SELECT cursor FROM sync_cursor WHERE source = $1 AND table_name = $2;`
+
+	upsertSyncCursor = `INSERT INTO sync_cursor (source, table_name, cursor, updated_at)
+		VALUES ($1, $2, $3, NOW())
+		ON CONFLICT (source, table_name) DO UPDATE SET cursor = $3, updated_at = NOW();`
+)
+
+// SyncCursor returns the cursor of the last record of table synced from the
+// source instance, or 0 if nothing was synced.
+func (pg *PgDb) SyncCursor(ctx context.Context, source, table string) (int64, error) {
+	var cursor int64
+	err := pg.db.QueryRowContext(ctx, selectSyncCursor, source, table).Scan(&cursor)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return cursor, err
+}
+
+// SaveSyncCursor records the cursor of the last record of table synced from the
+// source instance.
+func (pg *PgDb) SaveSyncCursor(ctx context.Context, source, table string, cursor int64) error {
+	_, err := pg.db.ExecContext(ctx, upsertSyncCursor, source, table, cursor)
+	return err
+}
@@ -8,7 +8,6 @@ import (
 	"strings"
 	"time"
 
-	"github.com/davecgh/go-spew/spew"
 	"github.com/planetdecred/pdanalytics/app/helpers"
 	cache "github.com/planetdecred/pdanalytics/chart"
 	"github.com/planetdecred/pdanalytics/postgres/models"
@@ -64,6 +63,13 @@ const (
 	createVSPTickIndex = `CREATE UNIQUE INDEX IF NOT EXISTS vsp_tick_idx ON vsp_tick (vsp_id,immature,live,voted,missed,pool_fees,proportion_live,proportion_missed,user_count,users_active, time);`
 
 	lastVspTickEntryTime = `SELECT time FROM vsp_tick ORDER BY time DESC LIMIT 1`
+
+	// insertVSPTickFromSync resolves the VSP by name, as its id differs
+	// between instances, and skips the ticks already stored.
+	insertVSPTickFromSync = `INSERT INTO vsp_tick (vsp_id, immature, live, voted, missed, pool_fees,
+		proportion_live, proportion_missed, user_count, users_active, time)
+		SELECT id, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11 FROM vsp WHERE name = $1
+		ON CONFLICT DO NOTHING;`
 )
 
 var (
@@ -196,14 +202,15 @@ func (pg *PgDb) FetchVSPs(ctx context.Context) ([]vsp.VSPDto, error) {
 	return result, nil
 }
 
+// AddVspSourceFromSync stores a VSP received from another instance, unless a
+// VSP of the same name is stored. The local id is assigned by the database.
 func (pg *PgDb) AddVspSourceFromSync(ctx context.Context, vspData interface{}) error {
 	vspDto := vspData.(vsp.VSPDto)
-	count, _ := models.VSPS(models.VSPWhere.Name.EQ(null.StringFrom(vspDto.Name))).Count(ctx, pg.db)
-	if count > 0 {
-		return nil
+	count, err := models.VSPS(models.VSPWhere.Name.EQ(null.StringFrom(vspDto.Name))).Count(ctx, pg.db)
+	if err != nil || count > 0 {
+		return err
 	}
 	vspModel := models.VSP{
-		ID:                   vspDto.ID,
 		Name:                 null.StringFrom(vspDto.Name),
 		APIEnabled:           null.BoolFrom(vspDto.APIEnabled),
 		APIVersionsSupported: vspDto.APIVersionsSupported,
@@ -211,14 +218,14 @@ func (pg *PgDb) AddVspSourceFromSync(ctx context.Context, vspData interface{}) e
 		URL:                  null.StringFrom(vspDto.URL),
 		Launched:             null.TimeFrom(vspDto.Launched),
 	}
-	err := vspModel.Insert(ctx, pg.db, boil.Infer())
-	return err
+	return vspModel.Insert(ctx, pg.db, boil.Infer())
 }
 
 func (pg *PgDb) FetchVspSourcesForSync(ctx context.Context, lastID int64, skip, take int) ([]vsp.VSPDto, int64, error) {
 	vspData, err := models.VSPS(
 		models.VSPWhere.ID.GT(int(lastID)),
-		qm.Offset(skip), qm.Limit(take)).All(ctx, pg.db)
+		qm.Offset(skip), qm.Limit(take),
+		qm.OrderBy(models.VSPColumns.ID)).All(ctx, pg.db)
 	if err != nil {
 		return nil, 0, err
 	}
@@ -246,6 +253,52 @@ func (pg *PgDb) FetchVspSourcesForSync(ctx context.Context, lastID int64, skip,
 	return result, totalCount, err
 }
 
+// FetchVspTicksForSync returns the ticks with an id greater than lastID,
+// ordered by id, for the sync operation.
+func (pg *PgDb) FetchVspTicksForSync(ctx context.Context, lastID int64, skip, take int) ([]vsp.VSPTickSyncDto, int64, error) {
+	tickSlice, err := models.VSPTicks(
+		qm.Load(models.VSPTickRels.VSP),
+		models.VSPTickWhere.ID.GT(int(lastID)),
+		qm.Offset(skip), qm.Limit(take),
+		qm.OrderBy(models.VSPTickColumns.ID)).All(ctx, pg.db)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var result []vsp.VSPTickSyncDto
+	for _, tick := range tickSlice {
+		result = append(result, vsp.VSPTickSyncDto{
+			ID:               tick.ID,
+			VSP:              tick.R.VSP.Name.String,
+			Immature:         tick.Immature,
+			Live:             tick.Live,
+			Voted:            tick.Voted,
+			Missed:           tick.Missed,
+			PoolFees:         tick.PoolFees,
+			ProportionLive:   tick.ProportionLive,
+			ProportionMissed: tick.ProportionMissed,
+			UserCount:        tick.UserCount,
+			UsersActive:      tick.UsersActive,
+			Time:             tick.Time.UTC(),
+		})
+	}
+
+	totalCount, err := models.VSPTicks(models.VSPTickWhere.ID.GT(int(lastID))).Count(ctx, pg.db)
+
+	return result, totalCount, err
+}
+
+// AddVspTickFromSync stores a tick received from another instance. The tick
+// is attached to the local VSP of the same name, which must be stored first,
+// and ignored if already stored.
+func (pg *PgDb) AddVspTickFromSync(ctx context.Context, tickData interface{}) error {
+	tick := tickData.(vsp.VSPTickSyncDto)
+	_, err := pg.db.ExecContext(ctx, insertVSPTickFromSync, tick.VSP, tick.Immature, tick.Live,
+		tick.Voted, tick.Missed, tick.PoolFees, tick.ProportionLive, tick.ProportionMissed,
+		tick.UserCount, tick.UsersActive, tick.Time.UTC())
+	return err
+}
+
 // VSPTicks
 func (pg *PgDb) FilteredVSPTicks(ctx context.Context, vspName string, offset, limit int) ([]vsp.VSPTickDto, int64, error) {
 
@@ -470,6 +523,8 @@ type vspSet struct {
 
 func (pg *PgDb) FetchEncodeVspChart(ctx context.Context,
 	dataType, binString string, vspSources ...string) ([]byte, error) {
+	pg = pg.reader()
+
 	if binString != string(cache.DefaultBin) {
 		return pg.FetchEncodeBinVspChart(ctx, binString, dataType, vspSources...)
 	}
@@ -546,6 +601,8 @@ func (pg *PgDb) FetchEncodeVspChart(ctx context.Context,
 
 func (pg *PgDb) FetchEncodeBinVspChart(ctx context.Context, binString, dataType string,
 	vspSources ...string) ([]byte, error) {
+	pg = pg.reader()
+
 	var dates cache.ChartUints
 	var dateMap = make(map[int64]bool)
 	var deviations []cache.ChartNullData
@@ -762,319 +819,7 @@ func (pg *PgDb) fetchVspChart(ctx context.Context, startDate uint64, axisString
 	return &vspDataSet, nil
 }
 
-func (pg *PgDb) fetchVspChartForSource(ctx context.Context, startDate uint64, axisString string, vspSource string) (*vspSet, error) {
-	var vspDataSet = vspSet{
-		time:             []uint64{},
-		immature:         make(map[string]cache.ChartNullUints),
-		live:             make(map[string]cache.ChartNullUints),
-		voted:            make(map[string]cache.ChartNullUints),
-		missed:           make(map[string]cache.ChartNullUints),
-		poolFees:         make(map[string]cache.ChartNullFloats),
-		proportionLive:   make(map[string]cache.ChartNullFloats),
-		proportionMissed: make(map[string]cache.ChartNullFloats),
-		userCount:        make(map[string]cache.ChartNullUints),
-		usersActive:      make(map[string]cache.ChartNullUints),
-	}
-
-	dates, err := pg.allVspTickDates(ctx, helpers.UnixTime(int64(startDate)))
-	if err != nil && err != sql.ErrNoRows {
-		return nil, err
-	}
-
-	for _, date := range dates {
-		vspDataSet.time = append(vspDataSet.time, uint64(date.Unix()))
-	}
-
-	points, err := pg.fetchVSPChartData(ctx, vspSource, helpers.UnixTime(int64(startDate)), 0, axisString)
-	if err != nil {
-		if err.Error() == sql.ErrNoRows.Error() {
-			return &vspSet{}, nil
-		}
-		return nil, fmt.Errorf("error in fetching records for %s: %s", vspSource, err.Error())
-	}
-
-	var pointsMap = map[time.Time]*models.VSPTick{}
-	for _, record := range points {
-		pointsMap[record.Time] = record
-	}
-
-	var hasFoundOne bool
-	for _, date := range dates {
-		if record, found := pointsMap[date]; found {
-			vspDataSet.immature[vspSource] = append(vspDataSet.immature[vspSource], &null.Uint64{Valid: true, Uint64: uint64(record.Immature)})
-			vspDataSet.live[vspSource] = append(vspDataSet.live[vspSource], &null.Uint64{Valid: true, Uint64: uint64(record.Live)})
-			vspDataSet.voted[vspSource] = append(vspDataSet.voted[vspSource], &null.Uint64{Valid: true, Uint64: uint64(record.Voted)})
-			vspDataSet.missed[vspSource] = append(vspDataSet.missed[vspSource], &null.Uint64{Valid: true, Uint64: uint64(record.Missed)})
-			vspDataSet.poolFees[vspSource] = append(vspDataSet.poolFees[vspSource], &null.Float64{Valid: true, Float64: record.PoolFees})
-			vspDataSet.proportionLive[vspSource] = append(vspDataSet.proportionLive[vspSource], &null.Float64{Valid: true, Float64: record.ProportionLive})
-			vspDataSet.proportionMissed[vspSource] = append(vspDataSet.proportionMissed[vspSource], &null.Float64{Valid: true, Float64: record.ProportionMissed})
-			vspDataSet.userCount[vspSource] = append(vspDataSet.userCount[vspSource], &null.Uint64{Valid: true, Uint64: uint64(record.UserCount)})
-			vspDataSet.usersActive[vspSource] = append(vspDataSet.usersActive[vspSource], &null.Uint64{Valid: true, Uint64: uint64(record.UsersActive)})
-			hasFoundOne = true
-		} else {
-			if hasFoundOne {
-				vspDataSet.immature[vspSource] = append(vspDataSet.immature[vspSource], &null.Uint64{Valid: false})
-				vspDataSet.live[vspSource] = append(vspDataSet.live[vspSource], &null.Uint64{Valid: false})
-				vspDataSet.voted[vspSource] = append(vspDataSet.voted[vspSource], &null.Uint64{Valid: false})
-				vspDataSet.missed[vspSource] = append(vspDataSet.missed[vspSource], &null.Uint64{Valid: false})
-				vspDataSet.poolFees[vspSource] = append(vspDataSet.poolFees[vspSource], &null.Float64{Valid: false})
-				vspDataSet.proportionLive[vspSource] = append(vspDataSet.proportionLive[vspSource], &null.Float64{Valid: false})
-				vspDataSet.proportionMissed[vspSource] = append(vspDataSet.proportionMissed[vspSource], &null.Float64{Valid: false})
-				vspDataSet.userCount[vspSource] = append(vspDataSet.userCount[vspSource], &null.Uint64{Valid: false})
-				vspDataSet.usersActive[vspSource] = append(vspDataSet.usersActive[vspSource], &null.Uint64{Valid: false})
-			} else {
-				vspDataSet.immature[vspSource] = append(vspDataSet.immature[vspSource], nil)
-				vspDataSet.live[vspSource] = append(vspDataSet.live[vspSource], nil)
-				vspDataSet.voted[vspSource] = append(vspDataSet.voted[vspSource], nil)
-				vspDataSet.missed[vspSource] = append(vspDataSet.missed[vspSource], nil)
-				vspDataSet.poolFees[vspSource] = append(vspDataSet.poolFees[vspSource], nil)
-				vspDataSet.proportionLive[vspSource] = append(vspDataSet.proportionLive[vspSource], nil)
-				vspDataSet.proportionMissed[vspSource] = append(vspDataSet.proportionMissed[vspSource], nil)
-				vspDataSet.userCount[vspSource] = append(vspDataSet.userCount[vspSource], nil)
-				vspDataSet.usersActive[vspSource] = append(vspDataSet.usersActive[vspSource], nil)
-			}
-		}
-	}
-
-	return &vspDataSet, nil
-}
-
 func (pg *PgDb) UpdateVspChart(ctx context.Context) error {
 	log.Info("Updating VSP bin data")
-	if err := pg.UpdateVspHourlyChart(ctx); err != nil {
-		return err
-	}
-
-	if err := pg.UpdateVspDailyChart(ctx); err != nil {
-		return err
-	}
-	return nil
-}
-
-func (pg *PgDb) UpdateVspHourlyChart(ctx context.Context) error {
-	log.Info("Updating VSP hourly average")
-	lastHourEntry, err := models.VSPTickBins(
-		models.VSPTickBinWhere.Bin.EQ(string(cache.HourBin)),
-		qm.OrderBy(fmt.Sprintf("%s desc", models.VSPTickBinColumns.Time)),
-	).One(ctx, pg.db)
-	if err != nil && err != sql.ErrNoRows {
-		return err
-	}
-
-	var nextHour = time.Time{}
-	var lastHour int64
-	if lastHourEntry != nil {
-		nextHour = time.Unix(lastHourEntry.Time, 0).Add(cache.AnHour * time.Second).UTC()
-		lastHour = lastHourEntry.Time
-	}
-	if time.Now().Before(nextHour) {
-		return nil
-	}
-
-	allVspData, err := pg.FetchVSPs(ctx)
-	if err != nil {
-		return err
-	}
-	var vsps = make([]string, len(allVspData))
-	for i, vspSource := range allVspData {
-		vsps[i] = vspSource.Name
-	}
-
-	tx, err := pg.db.Begin()
-	if err != nil {
-		return err
-	}
-	for _, source := range allVspData {
-		startTime := time.Now()
-		vspSet, err := pg.fetchVspChartForSource(ctx, uint64(lastHour), "", source.Name)
-		if err != nil {
-			return err
-		}
-		hours, _, hourIntervals := cache.GenerateHourBin(vspSet.time, nil)
-		for i, interval := range hourIntervals {
-			if int64(hours[i]) < nextHour.Unix() {
-				continue
-			}
-			immature := vspSet.immature[source.Name].Avg(interval[0], interval[1])
-			live := vspSet.live[source.Name].Avg(interval[0], interval[1])
-			voted := vspSet.voted[source.Name].Avg(interval[0], interval[1])
-			missed := vspSet.missed[source.Name].Avg(interval[0], interval[1])
-			poolFees := vspSet.poolFees[source.Name].Avg(interval[0], interval[1])
-			proportionLive := vspSet.proportionLive[source.Name].Avg(interval[0], interval[1])
-			proportionMissed := vspSet.proportionMissed[source.Name].Avg(interval[0], interval[1])
-			userCount := vspSet.userCount[source.Name].Avg(interval[0], interval[1])
-			usersActive := vspSet.usersActive[source.Name].Avg(interval[0], interval[1])
-			vspBin := models.VSPTickBin{
-				Time:  int64(hours[i]),
-				Bin:   string(cache.HourBin),
-				VSPID: source.ID,
-			}
-			if immature != nil {
-				vspBin.Immature = null.IntFrom(int(immature.Uint64))
-			}
-			if live != nil {
-				vspBin.Live = null.IntFrom(int(live.Uint64))
-			}
-			if voted != nil {
-				vspBin.Voted = null.IntFrom(int(voted.Uint64))
-			}
-			if missed != nil {
-				vspBin.Missed = null.IntFrom(int(missed.Uint64))
-			}
-			if poolFees != nil {
-				vspBin.PoolFees = null.Float64From(poolFees.Float64)
-			}
-			if proportionLive != nil {
-				vspBin.ProportionLive = null.Float64From(proportionLive.Float64)
-			}
-			if proportionMissed != nil {
-				vspBin.ProportionMissed = null.Float64From(proportionMissed.Float64)
-			}
-			if userCount != nil {
-				vspBin.UserCount = null.IntFrom(int(userCount.Uint64))
-			}
-			if usersActive != nil {
-				vspBin.UsersActive = null.IntFrom(int(usersActive.Uint64))
-			}
-			if err = vspBin.Insert(ctx, tx, boil.Infer()); err != nil {
-				_ = tx.Rollback()
-				spew.Dump(vspBin)
-				return err
-			}
-		}
-		// show log if the previous circle took up to 5s
-		if time.Since(startTime).Seconds() >= 5 {
-			log.Infof("Updated VSP hourly average for %s", source.Name)
-		}
-	}
-	if err = tx.Commit(); err != nil {
-		return err
-	}
-
-	return nil
-}
-
-func (pg *PgDb) UpdateVspDailyChart(ctx context.Context) error {
-	log.Info("Updating VSP daily average")
-	lastDayEntry, err := models.VSPTickBins(
-		models.VSPTickBinWhere.Bin.EQ(string(cache.DayBin)),
-		qm.OrderBy(fmt.Sprintf("%s desc", models.VSPTickBinColumns.Time)),
-	).One(ctx, pg.db)
-	if err != nil && err != sql.ErrNoRows {
-		return err
-	}
-
-	var nextDay = time.Time{}
-	if lastDayEntry != nil {
-		nextDay = time.Unix(lastDayEntry.Time, 0).Add(cache.ADay * time.Second).UTC()
-	}
-	if time.Now().Before(nextDay) {
-		return nil
-	}
-
-	allVspData, err := pg.FetchVSPs(ctx)
-	if err != nil {
-		return err
-	}
-	var vsps = make([]string, len(allVspData))
-	for i, vspSource := range allVspData {
-		vsps[i] = vspSource.Name
-	}
-
-	tx, err := pg.db.Begin()
-	if err != nil {
-		return err
-	}
-
-	for _, source := range allVspData {
-		startTime := time.Now()
-
-		records, err := models.VSPTickBins(
-			models.VSPTickBinWhere.VSPID.EQ(source.ID),
-			models.VSPTickBinWhere.Bin.EQ(string(cache.HourBin)),
-			models.VSPTickBinWhere.Time.GTE(nextDay.Unix()),
-		).All(ctx, tx)
-		if err != nil {
-			_ = tx.Rollback()
-			return err
-		}
-		var timeSet cache.ChartUints
-		var immatureSet, liveSet, votedSet, missedSet, userCountSet, usersActiveSet cache.ChartNullUints
-		var poolFeesSet, proportionLiveSet, proportionMissedSet cache.ChartNullFloats
-
-		for _, rec := range records {
-			timeSet = append(timeSet, uint64(rec.Time))
-			immatureSet = append(immatureSet, &null.Uint64{Uint64: uint64(rec.Immature.Int), Valid: rec.Immature.Valid})
-			liveSet = append(liveSet, &null.Uint64{Uint64: uint64(rec.Live.Int), Valid: rec.Live.Valid})
-			missedSet = append(missedSet, &null.Uint64{Uint64: uint64(rec.Missed.Int), Valid: rec.Missed.Valid})
-			votedSet = append(votedSet, &null.Uint64{Uint64: uint64(rec.Voted.Int), Valid: rec.Voted.Valid})
-			userCountSet = append(userCountSet, &null.Uint64{Uint64: uint64(rec.UserCount.Int), Valid: rec.UserCount.Valid})
-			usersActiveSet = append(usersActiveSet, &null.Uint64{Uint64: uint64(rec.UsersActive.Int), Valid: rec.UsersActive.Valid})
-			poolFeesSet = append(poolFeesSet, &null.Float64{Float64: rec.PoolFees.Float64, Valid: rec.PoolFees.Valid})
-			proportionLiveSet = append(proportionLiveSet, &null.Float64{
-				Float64: rec.ProportionLive.Float64, Valid: rec.ProportionLive.Valid})
-			proportionMissedSet = append(proportionMissedSet, &null.Float64{
-				Float64: rec.ProportionMissed.Float64, Valid: rec.ProportionMissed.Valid})
-		}
-		days, _, dayIntervals := cache.GenerateDayBin(timeSet, nil)
-		for i, interval := range dayIntervals {
-			if int64(days[i]) < nextDay.Unix() {
-				continue
-			}
-			immature := immatureSet.Avg(interval[0], interval[1])
-			live := liveSet.Avg(interval[0], interval[1])
-			voted := votedSet.Avg(interval[0], interval[1])
-			missed := missedSet.Avg(interval[0], interval[1])
-			poolFees := poolFeesSet.Avg(interval[0], interval[1])
-			proportionLive := proportionLiveSet.Avg(interval[0], interval[1])
-			proportionMissed := proportionMissedSet.Avg(interval[0], interval[1])
-			userCount := userCountSet.Avg(interval[0], interval[1])
-			usersActive := usersActiveSet.Avg(interval[0], interval[1])
-			vspBin := models.VSPTickBin{
-				Time:  int64(days[i]),
-				Bin:   string(cache.DayBin),
-				VSPID: source.ID,
-			}
-			if immature != nil {
-				vspBin.Immature = null.IntFrom(int(immature.Uint64))
-			}
-			if live != nil {
-				vspBin.Live = null.IntFrom(int(live.Uint64))
-			}
-			if voted != nil {
-				vspBin.Voted = null.IntFrom(int(voted.Uint64))
-			}
-			if missed != nil {
-				vspBin.Missed = null.IntFrom(int(missed.Uint64))
-			}
-			if poolFees != nil {
-				vspBin.PoolFees = null.Float64From(poolFees.Float64)
-			}
-			if proportionLive != nil {
-				vspBin.ProportionLive = null.Float64From(proportionLive.Float64)
-			}
-			if proportionMissed != nil {
-				vspBin.ProportionMissed = null.Float64From(proportionMissed.Float64)
-			}
-			if userCount != nil {
-				vspBin.UserCount = null.IntFrom(int(userCount.Uint64))
-			}
-			if usersActive != nil {
-				vspBin.UsersActive = null.IntFrom(int(usersActive.Uint64))
-			}
-			if err = vspBin.Insert(ctx, tx, boil.Infer()); err != nil {
-				_ = tx.Rollback()
-				return err
-			}
-		}
-		// show log if the previous circle took up to 5s
-		if time.Since(startTime).Seconds() >= 5 {
-			log.Infof("Updated VSP daily average for %s", source.Name)
-		}
-	}
-	if err = tx.Commit(); err != nil {
-		return err
-	}
-
-	return nil
+	return pg.updateBins(ctx, vspSeries)
 }
@@ -9,8 +9,8 @@ import (
 	"net/http"
 	"time"
 
-	"github.com/planetdecred/pdanalytics/app"
 	"github.com/planetdecred/pdanalytics/app/helpers"
+	"github.com/planetdecred/pdanalytics/scheduler"
 	"github.com/planetdecred/pdanalytics/web"
 )
 
@@ -45,10 +45,13 @@ type Collector struct {
 	period int64
 	store  PowDataStore
 	server *web.Server
+	// chartUpdated is closed once the chart is updated on startup, the
+	// collection waiting for it.
+	chartUpdated chan struct{}
 }
 
 func Activate(ctx context.Context, disabledPows []string, period int64,
-	store PowDataStore, server *web.Server, dataMode, httpMode bool) error {
+	store PowDataStore, server *web.Server, sched *scheduler.Scheduler, dataMode, httpMode bool) error {
 
 	pows := make([]Pow, 0, len(availablePows)-len(disabledPows))
 	disabledMap := make(map[string]struct{})
@@ -79,12 +82,25 @@ func Activate(ctx context.Context, disabledPows []string, period int64,
 	}
 
 	if dataMode {
+		c.chartUpdated = make(chan struct{})
 		go func() {
+			defer close(c.chartUpdated)
 			if err := c.store.UpdatePowChart(ctx); err != nil {
 				log.Error(err)
 			}
-			c.Run(ctx)
 		}()
+		err := sched.Register(scheduler.Job{
+			Name:     "pow",
+			Interval: time.Duration(period) * time.Second,
+			Timeout:  time.Duration(period) * time.Second,
+			LastRun: func(ctx context.Context) (time.Time, error) {
+				return helpers.UnixTime(c.store.LastPowEntryTime("")), nil
+			},
+			Run: c.Collect,
+		})
+		if err != nil {
+			return err
+		}
 	}
 
 	if httpMode {
@@ -96,67 +112,17 @@ func Activate(ctx context.Context, disabledPows []string, period int64,
 	return nil
 }
 
-func (pc *Collector) Run(ctx context.Context) {
-	app.MarkBusyIfFree()
-	log.Info("Triggering PoW collectors.")
-
-	lastCollectionDateUnix := pc.store.LastPowEntryTime("")
-	lastCollectionDate := helpers.UnixTime(lastCollectionDateUnix)
-	secondsPassed := time.Since(lastCollectionDate)
-	period := time.Duration(pc.period) * time.Second
-
-	if lastCollectionDateUnix > 0 && secondsPassed < period {
-		timeLeft := period - secondsPassed
-		log.Infof("Fetching PoW data every %dm, collected %s ago, will fetch in %s.", pc.period/60,
-			helpers.DurationToString(secondsPassed), helpers.DurationToString(timeLeft))
-
-		app.ReleaseForNewModule()
-		time.Sleep(timeLeft)
-	}
-
-	if lastCollectionDateUnix > 0 && secondsPassed < period {
-		// continually check the state of the app until its free to run this module
-		app.MarkBusyIfFree()
-	}
-	pc.Collect(ctx)
-	app.ReleaseForNewModule()
-	go pc.CollectAsync(ctx)
-}
-
-func (pc *Collector) CollectAsync(ctx context.Context) {
-	if ctx.Err() != nil {
-		return
+func (pc *Collector) Collect(ctx context.Context) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-pc.chartUpdated:
 	}
-
-	ticker := time.NewTicker(time.Duration(pc.period) * time.Second)
-	defer ticker.Stop()
-
-	for {
-		select {
-		case <-ctx.Done():
-			log.Infof("Stopping PoW collectors")
-			return
-		case <-ticker.C:
-			// continually check the state of the app until its free to run this module
-			app.MarkBusyIfFree()
-			completeCollectionCycle := pc.store.LastPowEntryTime("")
-			collectionCycleDate := helpers.UnixTime(completeCollectionCycle)
-			timeInterval := time.Since(collectionCycleDate)
-			log.Info("The next collection cycle begins in", timeInterval)
-
-			log.Info("Starting a new PoW collection cycle")
-			pc.Collect(ctx)
-			app.ReleaseForNewModule()
-		}
-	}
-}
-
-func (pc *Collector) Collect(ctx context.Context) {
 	log.Info("Fetching PoW data.")
 	for _, powInfo := range pc.pows {
 		select {
 		case <-ctx.Done():
-			return
+			return ctx.Err()
 		default:
 			data, err := powInfo.Collect(ctx)
 			if err != nil {
@@ -168,9 +134,7 @@ func (pc *Collector) Collect(ctx context.Context) {
 			}
 		}
 	}
-	if err := pc.store.UpdatePowChart(ctx); err != nil {
-		log.Error(err)
-	}
+	return pc.store.UpdatePowChart(ctx)
 }
 
 func (c *Collector) setupServer() error {
@@ -0,0 +1,70 @@
+package pow
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/decred/slog"
+	"github.com/planetdecred/pdanalytics/module"
+	"github.com/planetdecred/pdanalytics/scheduler"
+	"github.com/planetdecred/pdanalytics/web"
+)
+
+const defaultPowInterval = 300
+
+// PowOptions are the config options of the PoW module.
+type PowOptions struct {
+	EnablePow     bool     `long:"pow" description:"Enable/Disable PoW module from running"`
+	EnablePowHttp bool     `long:"powhttp" description:"Enable/Disable PoW http endpoint from running"`
+	DisabledPows  []string `long:"disabledpow" description:"Disable data collection for this Pow"`
+	PowInterval   int64    `long:"powinterval" description:"Collection interval for Pow"`
+}
+
+type powModule struct {
+	options PowOptions
+	server  *web.Server
+	sched   *scheduler.Scheduler
+	store   PowDataStore
+}
+
+func init() {
+	module.Register(&powModule{
+		options: PowOptions{
+			EnablePow:     true,
+			EnablePowHttp: true,
+			PowInterval:   defaultPowInterval,
+		},
+	})
+}
+
+func (m *powModule) Name() string                 { return "pow" }
+func (m *powModule) LogSubsystem() string         { return "POWL" }
+func (m *powModule) UseLogger(logger slog.Logger) { UseLogger(logger) }
+func (m *powModule) Options() interface{}         { return &m.options }
+func (m *powModule) Enabled() bool                { return m.options.EnablePow || m.options.EnablePowHttp }
+
+func (m *powModule) Init(deps *module.Deps) error {
+	db, err := deps.DB()
+	if err != nil {
+		return err
+	}
+	store, ok := db.(PowDataStore)
+	if !ok {
+		return fmt.Errorf("%T is not a pow.PowDataStore", db)
+	}
+	m.server = deps.Server
+	m.sched = deps.Scheduler
+	m.store = store
+	return nil
+}
+
+func (m *powModule) Start(ctx context.Context) error {
+	opts := m.options
+	return Activate(ctx, opts.DisabledPows, opts.PowInterval, m.store, m.server, m.sched, opts.EnablePow, opts.EnablePowHttp)
+}
+
+func (m *powModule) Stop() error { return nil }
+
+func (m *powModule) Health() module.Health {
+	return module.JobsHealth(m.sched, "pow")
+}
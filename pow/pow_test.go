@@ -0,0 +1,46 @@
+package pow_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/planetdecred/pdanalytics/memdb"
+	"github.com/planetdecred/pdanalytics/pow"
+	"github.com/planetdecred/pdanalytics/testutil"
+)
+
+const luxorResponse = `{"global_stats":[
+	{"time":"2020-09-01T00:00:00Z","pool_hashrate":2.5e15,"workers":120,"coin_price":"17.5","btc_price":"0.0015"},
+	{"time":"2020-09-01T01:00:00Z","pool_hashrate":3e15,"workers":125,"coin_price":"17.8","btc_price":"0.0016"}
+]}`
+
+func TestCollect(t *testing.T) {
+	testutil.MockAPIs(t, map[string]http.Handler{
+		"master-api.luxor.tech": testutil.JSON(luxorResponse),
+	})
+	sched := testutil.NewScheduler(t)
+	server := testutil.NewServer(t)
+	db := memdb.New()
+
+	disabled := []string{pow.Coinmine, pow.F2pool, pow.Uupool}
+	err := pow.Activate(context.Background(), disabled, 300, db, server.Server, sched, true, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testutil.WaitForJob(t, sched, "pow", 5*time.Second)
+
+	var data struct {
+		PowData    []pow.PowDataDto `json:"powData"`
+		TotalPages int              `json:"totalPages"`
+	}
+	server.GetJSON("/filteredpow?filter=luxor&view-option=table", &data)
+	if len(data.PowData) != 2 || data.TotalPages != 1 {
+		t.Fatalf("got %d records in %d pages, want 2 in 1", len(data.PowData), data.TotalPages)
+	}
+	latest := data.PowData[0]
+	if latest.Source != pow.Luxor || latest.Workers != 125 || latest.PoolHashrateTh != "3000" {
+		t.Errorf("unexpected latest record %+v", latest)
+	}
+}
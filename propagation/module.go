@@ -0,0 +1,130 @@
+package propagation
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/decred/slog"
+	"github.com/planetdecred/pdanalytics/dbhelper"
+	"github.com/planetdecred/pdanalytics/dcrd"
+	"github.com/planetdecred/pdanalytics/module"
+	"github.com/planetdecred/pdanalytics/web"
+)
+
+// PropagationOptions are the config options of the propagation module. Each
+// external database is described by the values at the same index of the
+// PropDB* options.
+type PropagationOptions struct {
+	EnablePropagation bool     `long:"propagation" description:"Enable/Disable the propagation module from running"`
+	PropDBHost        []string `long:"propdbhost" description:"Propagation database host"`
+	PropDBPort        []string `long:"propdbport" description:"Propagation database port"`
+	PropDBUser        []string `long:"propdbuser" description:"Propagation database username"`
+	PropDBPass        []string `long:"propdbpass" description:"Propagation database password"`
+	PropDBName        []string `long:"propdbname" description:"Database with external block propagation entry for comparison. Must comatain block and vote tables"`
+	PropDBSSLMode     []string `long:"propdbsslmode" description:"Propagation database sslmode, the dbsslmode when not set for any external database"`
+}
+
+type propagationModule struct {
+	options     PropagationOptions
+	client      *dcrd.Dcrd
+	server      *web.Server
+	store       Store
+	externalDBs map[string]Store
+}
+
+func init() {
+	module.Register(&propagationModule{
+		options: PropagationOptions{
+			EnablePropagation: true,
+		},
+	})
+}
+
+func (m *propagationModule) Name() string                 { return "propagation" }
+func (m *propagationModule) LogSubsystem() string         { return "PROP" }
+func (m *propagationModule) UseLogger(logger slog.Logger) { UseLogger(logger) }
+func (m *propagationModule) Options() interface{}         { return &m.options }
+func (m *propagationModule) Enabled() bool                { return m.options.EnablePropagation }
+
+// Init connects to the external databases and checks that they have the block
+// and vote tables.
+func (m *propagationModule) Init(deps *module.Deps) error {
+	opts := m.options
+	n := len(opts.PropDBName)
+	if len(opts.PropDBHost) != n || len(opts.PropDBPort) != n || len(opts.PropDBUser) != n || len(opts.PropDBPass) != n {
+		return fmt.Errorf("propdbhost, propdbport, propdbuser, propdbpass and propdbname must be set for every external database")
+	}
+	if len(opts.PropDBSSLMode) != 0 && len(opts.PropDBSSLMode) != n {
+		return fmt.Errorf("propdbsslmode must be set for every external database or for none")
+	}
+
+	m.externalDBs = make(map[string]Store, n)
+	for i, databaseName := range opts.PropDBName {
+		connOpts := dbhelper.ConnOptions{
+			Host: opts.PropDBHost[i],
+			Port: opts.PropDBPort[i],
+			User: opts.PropDBUser[i],
+			Pass: opts.PropDBPass[i],
+			Name: databaseName,
+		}
+		if len(opts.PropDBSSLMode) != 0 {
+			connOpts.SSLMode = opts.PropDBSSLMode[i]
+		}
+		db, err := deps.OpenDB(connOpts)
+		if err != nil {
+			return err
+		}
+		syncDb, ok := db.(Store)
+		if !ok {
+			db.Close()
+			return fmt.Errorf("%T is not a propagation.Store", db)
+		}
+		m.externalDBs[databaseName] = syncDb
+
+		for _, table := range []string{"block", "vote"} {
+			if !db.TableExists(table) {
+				m.closeExternalDBs()
+				return fmt.Errorf("the database, %s is missing the %s table", databaseName, table)
+			}
+		}
+	}
+
+	db, err := deps.DB()
+	if err != nil {
+		m.closeExternalDBs()
+		return err
+	}
+	store, ok := db.(Store)
+	if !ok {
+		m.closeExternalDBs()
+		return fmt.Errorf("%T is not a propagation.Store", db)
+	}
+	m.client = deps.Dcrd
+	m.server = deps.Server
+	m.store = store
+	return nil
+}
+
+func (m *propagationModule) Start(ctx context.Context) error {
+	_, err := New(ctx, m.client, m.store, m.externalDBs, m.server)
+	return err
+}
+
+// Stop closes the connections to the external databases.
+func (m *propagationModule) Stop() error {
+	m.closeExternalDBs()
+	return nil
+}
+
+func (m *propagationModule) closeExternalDBs() {
+	for name, db := range m.externalDBs {
+		if closer, ok := db.(interface{ Close() error }); ok {
+			if err := closer.Close(); err != nil {
+				log.Errorf("Error closing the %s database: %v", name, err)
+			}
+		}
+	}
+	m.externalDBs = nil
+}
+
+func (m *propagationModule) Health() module.Health { return module.Healthy }
@@ -56,13 +56,22 @@ func New(ctx context.Context, client *dcrd.Dcrd, dataStore Store, externalDBs ma
 	prop.server.AddRoute("/getvotebyblock", web.GET, prop.getVoteByBlock)
 	prop.server.AddRoute("/api/charts/propagation/{chartDataType}", web.GET, prop.chart, chartDataTypeCtx)
 
-	prop.client.Notif.RegisterBlockHandlerGroup(prop.ConnectBlock)
+	prop.client.Notif.RegisterBlockInfoHandlerGroup(prop.ConnectBlock)
 	prop.client.Notif.RegisterTxHandlerGroup(prop.TxReceived)
+	prop.client.Notif.RegisterReorgHandlerGroup(prop.Reorg)
 
 	return prop, nil
 }
 
-func (prop *propagation) ConnectBlock(blockHeader *wire.BlockHeader) error {
+func (prop *propagation) ConnectBlock(info *dcrd.BlockInfo) error {
+	blockHeader := info.Header
+	if info.Backfilled {
+		// The receive time of a backfilled block is unknown, recording the
+		// time it was fetched would distort the propagation charts.
+		log.Infof("Received a backfilled block height %d, block dropped", blockHeader.Height)
+		return nil
+	}
+
 	if !prop.syncIsDone {
 		done, err := prop.client.IsSynced()
 		if err != nil {
@@ -97,6 +106,24 @@ func (prop *propagation) ConnectBlock(blockHeader *wire.BlockHeader) error {
 	return nil
 }
 
+// Reorg removes the blocks and votes recorded for the detached blocks. The
+// blocks of the new chain are saved by ConnectBlock when the notifier replays
+// them.
+func (prop *propagation) Reorg(reorg *dcrd.ReorgData) error {
+	if err := prop.dataStore.RollbackBlocks(prop.ctx, reorg.CommonAncestorHeight); err != nil {
+		log.Errorf("Error in rolling back blocks above %d, %s", reorg.CommonAncestorHeight, err.Error())
+		return err
+	}
+
+	prop.ticketIndsMutex.Lock()
+	for _, header := range reorg.OldChain {
+		delete(prop.ticketInds, header.BlockHash().String())
+	}
+	prop.ticketIndsMutex.Unlock()
+
+	return nil
+}
+
 func (prop *propagation) TxReceived(txDetails *chainjson.TxRawResult) error {
 	if !prop.syncIsDone {
 		return nil
@@ -155,7 +182,7 @@ func (prop *propagation) TxReceived(txDetails *chainjson.TxRawResult) error {
 	// try to get the block from the blockchain until the number of retries has elapsed
 	for i := 0; i <= retries; i++ {
 		hash, _ := chainhash.NewHashFromStr(validation.Hash)
-		targetedBlock, err = prop.client.Rpc.GetBlock(hash)
+		targetedBlock, err = prop.client.Rpc().GetBlock(hash)
 		if err == nil {
 			break
 		}
@@ -192,10 +219,7 @@ func (prop *propagation) UpdatePropagationData(ctx context.Context) error {
 		if err := prop.dataStore.UpdatePropagationDataForSource(ctx, source, prop.externalDBs[source]); err != nil && err != sql.ErrNoRows {
 			return err
 		}
-		if err := prop.dataStore.UpdatePropagationHourlyAvgForSource(ctx, source); err != nil && err != sql.ErrNoRows {
-			return err
-		}
-		if err := prop.dataStore.UpdatePropagationDailyAvgForSource(ctx, source); err != nil && err != sql.ErrNoRows {
+		if err := prop.dataStore.UpdatePropagationBinsForSource(ctx, source); err != nil {
 			return err
 		}
 	}
@@ -0,0 +1,105 @@
+package propagation_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/planetdecred/pdanalytics/dcrd"
+	"github.com/planetdecred/pdanalytics/memdb"
+	"github.com/planetdecred/pdanalytics/propagation"
+	"github.com/planetdecred/pdanalytics/testutil"
+)
+
+func blockHash(height uint32) string {
+	return fmt.Sprintf("%064x", height)
+}
+
+// saveBlocks stores the blocks 1 to 3, received delay after their time.
+func saveBlocks(t *testing.T, store propagation.Store, delay time.Duration) {
+	t.Helper()
+	start := time.Date(2020, 9, 1, 0, 0, 0, 0, time.UTC)
+	for height := uint32(1); height <= 3; height++ {
+		blockTime := start.Add(time.Duration(height) * 5 * time.Minute)
+		err := store.SaveBlock(context.Background(), propagation.Block{
+			BlockInternalTime: blockTime,
+			BlockReceiveTime:  blockTime.Add(delay),
+			BlockHeight:       height,
+			BlockHash:         blockHash(height),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestPropagation(t *testing.T) {
+	ctx := context.Background()
+	db, source := memdb.New(), memdb.New()
+	saveBlocks(t, db, 2*time.Second)
+	saveBlocks(t, source, 3*time.Second)
+	for i, height := range []int64{2, 3, 3} {
+		err := db.SaveVote(ctx, propagation.Vote{
+			Hash:        fmt.Sprintf("%064x", 100+i),
+			ReceiveTime: time.Date(2020, 9, 1, 0, 16, i, 0, time.UTC),
+			VotingOn:    height,
+			BlockHash:   blockHash(uint32(height)),
+			Validity:    "Valid",
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	server := testutil.NewServer(t)
+	client := &dcrd.Dcrd{Notif: dcrd.NewNotifier(ctx)}
+	prop, err := propagation.New(ctx, client, db, map[string]propagation.Store{"source": source}, server.Server)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = prop.UpdatePropagationData(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	var blocks struct {
+		Records    []propagation.BlockDto `json:"records"`
+		TotalPages int                    `json:"totalPages"`
+	}
+	server.GetJSON("/getblocks?view-option=table", &blocks)
+	if len(blocks.Records) != 3 || blocks.TotalPages != 1 {
+		t.Fatalf("got %d blocks in %d pages, want 3 in 1", len(blocks.Records), blocks.TotalPages)
+	}
+	if latest := blocks.Records[0]; latest.BlockHeight != 3 || latest.Delay != "2.00" {
+		t.Errorf("unexpected latest block %+v", latest)
+	}
+
+	var votes []propagation.VoteDto
+	server.GetJSON("/getvotebyblock?block_hash="+blockHash(3), &votes)
+	if len(votes) != 2 || votes[0].VotingOn != 3 || votes[0].ReceiveTime != "2020-09-01 00:16" {
+		t.Errorf("unexpected votes of block 3 %+v", votes)
+	}
+
+	var deviations map[string][]float64
+	server.GetJSON("/api/charts/propagation/block-propagation?bin=default&axis=height", &deviations)
+	if fmt.Sprint(deviations["x"]) != "[1 2 3]" || fmt.Sprint(deviations["y"]) != "[-1 -1 -1]" {
+		t.Errorf("unexpected block propagation chart %v", deviations)
+	}
+
+	// A reorg to a fork of block 2 removes the blocks above it, their votes
+	// and their propagation data.
+	if err = prop.Reorg(&dcrd.ReorgData{CommonAncestorHeight: 2}); err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := db.BlockCount(ctx); n != 2 {
+		t.Errorf("got %d blocks after the reorg, want 2", n)
+	}
+	if n, _ := db.VotesCount(ctx); n != 1 {
+		t.Errorf("got %d votes after the reorg, want the vote on block 2", n)
+	}
+	var rolledBack map[string][]float64
+	server.GetJSON("/api/charts/propagation/block-propagation?bin=default&axis=height", &rolledBack)
+	if fmt.Sprint(rolledBack["x"]) != "[1 2]" {
+		t.Errorf("unexpected block propagation chart after the reorg %v", rolledBack)
+	}
+}
@@ -33,6 +33,7 @@ type Store interface {
 	UpdateBlockBinData(context.Context) error
 	SaveVote(ctx context.Context, vote Vote) error
 	UpdateVoteTimeDeviationData(context.Context) error
+	RollbackBlocks(ctx context.Context, height uint32) error
 
 	BlockCount(ctx context.Context) (int64, error)
 	Blocks(ctx context.Context, offset int, limit int) ([]BlockDto, error)
@@ -43,8 +44,7 @@ type Store interface {
 	VotesCount(ctx context.Context) (int64, error)
 
 	UpdatePropagationDataForSource(ctx context.Context, source string, sourceDB Store) error
-	UpdatePropagationHourlyAvgForSource(ctx context.Context, source string) error
-	UpdatePropagationDailyAvgForSource(ctx context.Context, source string) error
+	UpdatePropagationBinsForSource(ctx context.Context, source string) error
 
 	BlockDelays(ctx context.Context, height int) ([]PropagationChartData, error)
 	SourceDeviations(ctx context.Context, source, bin string) ([]SourceDeviation, error)
@@ -0,0 +1,114 @@
+package retention
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/decred/slog"
+	"github.com/planetdecred/pdanalytics/module"
+	"github.com/planetdecred/pdanalytics/scheduler"
+)
+
+const (
+	defaultRetentionInterval = 24
+	defaultRawDays           = 30
+	defaultEventDays         = 90
+)
+
+// RetentionOptions are the config options of the retention module. The
+// retention periods are in days, 0 keeps the raw rows of the table forever.
+type RetentionOptions struct {
+	EnableRetention   bool  `long:"retention" description:"Enable the pruning of the raw rows older than their retention period"`
+	RetentionInterval int64 `long:"retentioninterval" description:"Pruning interval in hours"`
+	MempoolDays       int   `long:"retention-mempool" description:"Days of raw mempool rows to keep"`
+	HeartbeatDays     int   `long:"retention-heartbeat" description:"Days of raw node heartbeats to keep"`
+	BlockDays         int   `long:"retention-block" description:"Days of raw block propagation rows to keep"`
+	VoteDays          int   `long:"retention-vote" description:"Days of raw vote propagation rows to keep"`
+	PowDays           int   `long:"retention-pow" description:"Days of raw PoW pool rows to keep"`
+	VspTickDays       int   `long:"retention-vsp" description:"Days of raw VSP ticks to keep"`
+	ExchangeTickDays  int   `long:"retention-exchange" description:"Days of short interval exchange ticks to keep"`
+}
+
+type retentionModule struct {
+	options RetentionOptions
+	sched   *scheduler.Scheduler
+	store   DataStore
+}
+
+func init() {
+	module.Register(&retentionModule{
+		options: RetentionOptions{
+			RetentionInterval: defaultRetentionInterval,
+			MempoolDays:       defaultRawDays,
+			HeartbeatDays:     defaultRawDays,
+			BlockDays:         defaultEventDays,
+			VoteDays:          defaultEventDays,
+			PowDays:           defaultEventDays,
+			VspTickDays:       defaultEventDays,
+			ExchangeTickDays:  defaultRawDays,
+		},
+	})
+}
+
+func (m *retentionModule) Name() string                 { return "retention" }
+func (m *retentionModule) LogSubsystem() string         { return "RTNT" }
+func (m *retentionModule) UseLogger(logger slog.Logger) { UseLogger(logger) }
+func (m *retentionModule) Options() interface{}         { return &m.options }
+func (m *retentionModule) Enabled() bool                { return m.options.EnableRetention }
+
+// DependsOn returns the modules whose tables are pruned.
+func (m *retentionModule) DependsOn() []string {
+	return []string{"exchanges", "mempool", "netsnapshot", "pow", "propagation", "vsp"}
+}
+
+func (m *retentionModule) Init(deps *module.Deps) error {
+	if m.options.RetentionInterval <= 0 {
+		return fmt.Errorf("invalid retention interval %d", m.options.RetentionInterval)
+	}
+	db, err := deps.DB()
+	if err != nil {
+		return err
+	}
+	store, ok := db.(DataStore)
+	if !ok {
+		return fmt.Errorf("%T is not a retention.DataStore", db)
+	}
+	m.sched = deps.Scheduler
+	m.store = store
+	return nil
+}
+
+func (m *retentionModule) Start(ctx context.Context) error {
+	days := func(n int) time.Duration { return time.Duration(n) * 24 * time.Hour }
+	opts := m.options
+	policies := []Policy{
+		{Table: "mempool", Keep: days(opts.MempoolDays)},
+		{Table: "mempool_fee_rate", Keep: days(opts.MempoolDays)},
+		{Table: "mempool_fee_bucket", Keep: days(opts.MempoolDays)},
+		{Table: "mempool_type", Keep: days(opts.MempoolDays)},
+		{Table: "mempool_tx", Keep: days(opts.MempoolDays)},
+		{Table: "heartbeat", Keep: days(opts.HeartbeatDays)},
+		{Table: "block", Keep: days(opts.BlockDays)},
+		{Table: "vote", Keep: days(opts.VoteDays)},
+		{Table: "pow_data", Keep: days(opts.PowDays)},
+		{Table: "vsp_tick", Keep: days(opts.VspTickDays)},
+		{Table: "exchange_tick", Keep: days(opts.ExchangeTickDays)},
+	}
+	interval := time.Duration(opts.RetentionInterval) * time.Hour
+	return m.sched.Register(scheduler.Job{
+		Name:     "retention",
+		Interval: interval,
+		Jitter:   interval / 10,
+		CatchUp:  scheduler.CatchUpSkip,
+		Run: func(ctx context.Context) error {
+			return Prune(ctx, m.store, policies)
+		},
+	})
+}
+
+func (m *retentionModule) Stop() error { return nil }
+
+func (m *retentionModule) Health() module.Health {
+	return module.JobsHealth(m.sched, "retention")
+}
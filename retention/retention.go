@@ -0,0 +1,69 @@
+// Package retention prunes the raw rows of the fast growing tables once they
+// are older than their retention period and covered by the hourly and daily
+// aggregates of their _bin table.
+package retention
+
+import (
+	"context"
+	"time"
+)
+
+// PruneResult is the outcome of pruning a table.
+type PruneResult struct {
+	Table string
+	// Cutoff is the time the deleted rows were older than. It is before the
+	// retention cutoff when the aggregates lag behind it, and the earliest
+	// cutoff for tables pruned per source.
+	Cutoff time.Time
+	// Lagging is set when the aggregates do not cover the retention cutoff.
+	Lagging bool
+	Deleted int64
+}
+
+// DataStore prunes the tables.
+type DataStore interface {
+	// PruneTable deletes the raw rows of table older than olderThan and
+	// covered by the aggregates.
+	PruneTable(ctx context.Context, table string, olderThan time.Time) (PruneResult, error)
+}
+
+// Policy is the retention period of the raw rows of a table.
+type Policy struct {
+	Table string
+	Keep  time.Duration
+}
+
+// Prune applies the policies with a positive retention period, reporting the
+// results in the logs. It goes on with the next table when one fails and
+// returns the last error.
+func Prune(ctx context.Context, store DataStore, policies []Policy) error {
+	var lastErr error
+	var total int64
+	for _, p := range policies {
+		if p.Keep <= 0 {
+			continue
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		res, err := store.PruneTable(ctx, p.Table, time.Now().Add(-p.Keep))
+		if err != nil {
+			log.Errorf("Pruning the %s table failed: %v", p.Table, err)
+			lastErr = err
+			continue
+		}
+		total += res.Deleted
+		switch {
+		case res.Cutoff.IsZero():
+			log.Warnf("Not pruning the %s table, its aggregates are missing", p.Table)
+		case res.Lagging:
+			log.Warnf("Pruned %d %s rows older than %s, the aggregates lag behind the retention cutoff",
+				res.Deleted, p.Table, res.Cutoff.UTC().Format(time.RFC3339))
+		default:
+			log.Infof("Pruned %d %s rows older than %s", res.Deleted, p.Table,
+				res.Cutoff.UTC().Format(time.RFC3339))
+		}
+	}
+	log.Infof("Pruning done, %d rows deleted", total)
+	return lastErr
+}
@@ -0,0 +1,43 @@
+package retention
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+type testStore struct {
+	pruned []string
+	fail   string
+}
+
+func (s *testStore) PruneTable(_ context.Context, table string, olderThan time.Time) (PruneResult, error) {
+	s.pruned = append(s.pruned, table)
+	if table == s.fail {
+		return PruneResult{}, errors.New("boom")
+	}
+	return PruneResult{Table: table, Cutoff: olderThan, Deleted: 1}, nil
+}
+
+func TestPrune(t *testing.T) {
+	store := &testStore{fail: "vote"}
+	err := Prune(context.Background(), store, []Policy{
+		{Table: "mempool", Keep: time.Hour},
+		{Table: "heartbeat"},
+		{Table: "vote", Keep: time.Hour},
+		{Table: "vsp_tick", Keep: time.Hour},
+	})
+	if err == nil {
+		t.Error("expected the error of the failed table")
+	}
+	want := []string{"mempool", "vote", "vsp_tick"}
+	if len(store.pruned) != len(want) {
+		t.Fatalf("pruned %v, want %v", store.pruned, want)
+	}
+	for i := range want {
+		if store.pruned[i] != want[i] {
+			t.Fatalf("pruned %v, want %v", store.pruned, want)
+		}
+	}
+}
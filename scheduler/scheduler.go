@@ -0,0 +1,312 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+)
+
+// CatchUpPolicy decides what happens when a job is overdue, either because
+// its last run, as reported by Job.LastRun, is older than its interval when
+// the job is registered, or because a run took longer than the interval.
+type CatchUpPolicy int
+
+const (
+	// CatchUpOnce runs an overdue job immediately, once, however many runs
+	// were missed.
+	CatchUpOnce CatchUpPolicy = iota
+	// CatchUpSkip drops the missed runs and waits for the next run time on
+	// the job's interval grid.
+	CatchUpSkip
+)
+
+// defaultClassLimit is the number of jobs of the same concurrency class that
+// may run at the same time unless set with SetClassLimit.
+const defaultClassLimit = 1
+
+// Job describes a unit of work that is run periodically by the Scheduler.
+type Job struct {
+	// Name uniquely identifies the job.
+	Name string
+	// Interval is the time between the start of two runs.
+	Interval time.Duration
+	// Jitter is the upper bound of a random delay added to every run time.
+	Jitter time.Duration
+	// Timeout bounds the duration of a run. Zero means no timeout.
+	Timeout time.Duration
+	// Class is the concurrency class of the job. Jobs of the same class
+	// share the class limit, jobs without a class only avoid overlapping
+	// themselves.
+	Class string
+	// CatchUp is the policy applied when the job is overdue.
+	CatchUp CatchUpPolicy
+	// LastRun optionally returns the time of the last run persisted by the
+	// module, e.g. the time of the last stored entry. It is used to decide
+	// when to run the job first.
+	LastRun func(ctx context.Context) (time.Time, error)
+	// Run does the work.
+	Run func(ctx context.Context) error
+}
+
+// JobStatus is a snapshot of the state of a registered job.
+type JobStatus struct {
+	Name         string        `json:"name"`
+	Class        string        `json:"class,omitempty"`
+	Interval     time.Duration `json:"interval"`
+	Running      bool          `json:"running"`
+	Runs         int64         `json:"runs"`
+	Failures     int64         `json:"failures"`
+	LastRun      time.Time     `json:"last_run"`
+	LastDuration time.Duration `json:"last_duration"`
+	LastSuccess  time.Time     `json:"last_success"`
+	LastError    string        `json:"last_error,omitempty"`
+	NextRun      time.Time     `json:"next_run"`
+}
+
+type job struct {
+	Job
+
+	mtx    sync.Mutex
+	status JobStatus
+}
+
+// Scheduler runs registered jobs at their interval, preventing a job from
+// overlapping itself and limiting the number of jobs of the same concurrency
+// class that run at the same time.
+type Scheduler struct {
+	ctx     context.Context
+	wg      sync.WaitGroup
+	mtx     sync.Mutex
+	jobs    map[string]*job
+	classes map[string]chan struct{}
+	limits  map[string]int
+
+	observer func(name string, duration time.Duration, err error)
+}
+
+// New creates a Scheduler. Jobs are stopped when ctx is canceled.
+func New(ctx context.Context) *Scheduler {
+	return &Scheduler{
+		ctx:     ctx,
+		jobs:    make(map[string]*job),
+		classes: make(map[string]chan struct{}),
+		limits:  make(map[string]int),
+	}
+}
+
+// SetRunObserver sets a function called after every job run, e.g. to export
+// the run durations. It must be called before the first job is registered.
+func (s *Scheduler) SetRunObserver(observer func(name string, duration time.Duration, err error)) {
+	s.observer = observer
+}
+
+// SetClassLimit sets the number of jobs of the given class that may run at
+// the same time. It must be called before the first job of the class is
+// registered.
+func (s *Scheduler) SetClassLimit(class string, limit int) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.limits[class] = limit
+}
+
+// Register adds a job and starts scheduling it.
+func (s *Scheduler) Register(j Job) error {
+	if j.Name == "" {
+		return fmt.Errorf("job name is required")
+	}
+	if j.Interval <= 0 {
+		return fmt.Errorf("invalid interval %v for job %s", j.Interval, j.Name)
+	}
+	if j.Run == nil {
+		return fmt.Errorf("job %s has no Run function", j.Name)
+	}
+
+	s.mtx.Lock()
+	if _, found := s.jobs[j.Name]; found {
+		s.mtx.Unlock()
+		return fmt.Errorf("job %s is already registered", j.Name)
+	}
+	jb := &job{
+		Job: j,
+		status: JobStatus{
+			Name:     j.Name,
+			Class:    j.Class,
+			Interval: j.Interval,
+		},
+	}
+	s.jobs[j.Name] = jb
+	var sem chan struct{}
+	if j.Class != "" {
+		if sem = s.classes[j.Class]; sem == nil {
+			limit, ok := s.limits[j.Class]
+			if !ok || limit < 1 {
+				limit = defaultClassLimit
+			}
+			sem = make(chan struct{}, limit)
+			s.classes[j.Class] = sem
+		}
+	}
+	s.mtx.Unlock()
+
+	s.wg.Add(1)
+	go s.loop(jb, sem)
+	return nil
+}
+
+// Wait blocks until all the job loops have returned after the scheduler's
+// context was canceled.
+func (s *Scheduler) Wait() {
+	s.wg.Wait()
+}
+
+// Status returns the status of all the registered jobs sorted by name.
+func (s *Scheduler) Status() []JobStatus {
+	s.mtx.Lock()
+	jobs := make([]*job, 0, len(s.jobs))
+	for _, jb := range s.jobs {
+		jobs = append(jobs, jb)
+	}
+	s.mtx.Unlock()
+
+	status := make([]JobStatus, 0, len(jobs))
+	for _, jb := range jobs {
+		jb.mtx.Lock()
+		status = append(status, jb.status)
+		jb.mtx.Unlock()
+	}
+	sort.Slice(status, func(i, j int) bool {
+		return status[i].Name < status[j].Name
+	})
+	return status
+}
+
+// JobStatus returns the status of the named job.
+func (s *Scheduler) JobStatus(name string) (JobStatus, bool) {
+	s.mtx.Lock()
+	jb, found := s.jobs[name]
+	s.mtx.Unlock()
+	if !found {
+		return JobStatus{}, false
+	}
+	jb.mtx.Lock()
+	defer jb.mtx.Unlock()
+	return jb.status, true
+}
+
+func (s *Scheduler) loop(jb *job, sem chan struct{}) {
+	defer s.wg.Done()
+
+	next := firstRun(s.ctx, jb.Job, time.Now())
+	for {
+		runAt := next
+		if jb.Jitter > 0 {
+			runAt = runAt.Add(time.Duration(rand.Int63n(int64(jb.Jitter))))
+		}
+		jb.mtx.Lock()
+		jb.status.NextRun = runAt
+		jb.mtx.Unlock()
+
+		if wait := time.Until(runAt); wait > 0 {
+			log.Debugf("Job %s will run in %v", jb.Name, wait.Round(time.Second))
+			timer := time.NewTimer(wait)
+			select {
+			case <-s.ctx.Done():
+				timer.Stop()
+				return
+			case <-timer.C:
+			}
+		}
+
+		if sem != nil {
+			select {
+			case <-s.ctx.Done():
+				return
+			case sem <- struct{}{}:
+			}
+		}
+		start := time.Now()
+		s.run(jb)
+		if sem != nil {
+			<-sem
+		}
+
+		if s.ctx.Err() != nil {
+			return
+		}
+		next = nextRun(jb.Job, start, time.Now())
+	}
+}
+
+func (s *Scheduler) run(jb *job) {
+	ctx := s.ctx
+	if jb.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, jb.Timeout)
+		defer cancel()
+	}
+
+	start := time.Now()
+	jb.mtx.Lock()
+	jb.status.Running = true
+	jb.status.LastRun = start
+	jb.mtx.Unlock()
+
+	log.Tracef("Running job %s", jb.Name)
+	err := jb.Run(ctx)
+	duration := time.Since(start)
+
+	jb.mtx.Lock()
+	jb.status.Running = false
+	jb.status.Runs++
+	jb.status.LastDuration = duration
+	if err != nil {
+		jb.status.Failures++
+		jb.status.LastError = err.Error()
+	} else {
+		jb.status.LastError = ""
+		jb.status.LastSuccess = time.Now()
+	}
+	jb.mtx.Unlock()
+
+	if s.observer != nil {
+		s.observer(jb.Name, duration, err)
+	}
+	if err != nil {
+		log.Errorf("Job %s failed after %v: %v", jb.Name, duration, err)
+		return
+	}
+	log.Debugf("Job %s completed in %v", jb.Name, duration)
+}
+
+// firstRun computes the time of the first run of a job from its persisted
+// last run. A job without history runs immediately.
+func firstRun(ctx context.Context, j Job, now time.Time) time.Time {
+	if j.LastRun == nil {
+		return now
+	}
+	last, err := j.LastRun(ctx)
+	if err != nil {
+		log.Warnf("Unable to get the last run of job %s, running it now: %v", j.Name, err)
+		return now
+	}
+	if last.IsZero() {
+		return now
+	}
+	return nextRun(j, last, now)
+}
+
+// nextRun computes the next run time of a job that last started at last.
+func nextRun(j Job, last, now time.Time) time.Time {
+	next := last.Add(j.Interval)
+	if !next.Before(now) {
+		return next
+	}
+	if j.CatchUp == CatchUpSkip {
+		missed := now.Sub(last) / j.Interval
+		return last.Add((missed + 1) * j.Interval)
+	}
+	return now
+}
@@ -0,0 +1,164 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestNextRun(t *testing.T) {
+	now := time.Unix(10000, 0)
+	tests := []struct {
+		name    string
+		last    time.Time
+		catchUp CatchUpPolicy
+		want    time.Time
+	}{
+		{
+			name: "not due",
+			last: now.Add(-40 * time.Second),
+			want: now.Add(20 * time.Second),
+		},
+		{
+			name: "due now",
+			last: now.Add(-time.Minute),
+			want: now,
+		},
+		{
+			name: "overdue, catch up once",
+			last: now.Add(-150 * time.Second),
+			want: now,
+		},
+		{
+			name:    "overdue, skip missed runs",
+			last:    now.Add(-150 * time.Second),
+			catchUp: CatchUpSkip,
+			want:    now.Add(30 * time.Second),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			j := Job{Interval: time.Minute, CatchUp: test.catchUp}
+			if got := nextRun(j, test.last, now); !got.Equal(test.want) {
+				t.Errorf("nextRun() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestFirstRun(t *testing.T) {
+	now := time.Unix(10000, 0)
+	lastRun := func(last time.Time, err error) func(context.Context) (time.Time, error) {
+		return func(context.Context) (time.Time, error) { return last, err }
+	}
+	tests := []struct {
+		name    string
+		lastRun func(context.Context) (time.Time, error)
+		want    time.Time
+	}{
+		{name: "no history", want: now},
+		{name: "zero last run", lastRun: lastRun(time.Time{}, nil), want: now},
+		{name: "last run error", lastRun: lastRun(time.Time{}, errors.New("db down")), want: now},
+		{name: "recent last run", lastRun: lastRun(now.Add(-10*time.Second), nil), want: now.Add(50 * time.Second)},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			j := Job{Name: "test", Interval: time.Minute, LastRun: test.lastRun}
+			if got := firstRun(context.Background(), j, now); !got.Equal(test.want) {
+				t.Errorf("firstRun() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestSchedulerRecordsStatus(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	s := New(ctx)
+
+	var runs int32
+	done := make(chan struct{})
+	err := s.Register(Job{
+		Name:     "failing",
+		Interval: time.Hour,
+		Run: func(context.Context) error {
+			if atomic.AddInt32(&runs, 1) == 1 {
+				close(done)
+			}
+			return errors.New("boom")
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = s.Register(Job{Name: "failing", Interval: time.Hour, Run: func(context.Context) error { return nil }}); err == nil {
+		t.Error("expected an error registering a duplicate job")
+	}
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("job did not run")
+	}
+	cancel()
+	s.Wait()
+
+	status, found := s.JobStatus("failing")
+	if !found {
+		t.Fatal("job status not found")
+	}
+	if status.Runs != 1 || status.Failures != 1 || status.LastError != "boom" {
+		t.Errorf("unexpected status %+v", status)
+	}
+	if !status.LastSuccess.IsZero() {
+		t.Errorf("LastSuccess should not be set, got %v", status.LastSuccess)
+	}
+}
+
+func TestSchedulerClassLimit(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s := New(ctx)
+
+	var running, maxRunning int32
+	release := make(chan struct{})
+	finished := make(chan struct{}, 2)
+	run := func(context.Context) error {
+		n := atomic.AddInt32(&running, 1)
+		for {
+			m := atomic.LoadInt32(&maxRunning)
+			if n <= m || atomic.CompareAndSwapInt32(&maxRunning, m, n) {
+				break
+			}
+		}
+		<-release
+		atomic.AddInt32(&running, -1)
+		finished <- struct{}{}
+		return nil
+	}
+	for _, name := range []string{"a", "b"} {
+		if err := s.Register(Job{Name: name, Interval: time.Hour, Class: "api", Run: run}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	if n := atomic.LoadInt32(&running); n != 1 {
+		t.Errorf("expected 1 running job, got %d", n)
+	}
+
+	close(release)
+	for i := 0; i < 2; i++ {
+		select {
+		case <-finished:
+		case <-time.After(5 * time.Second):
+			t.Fatal("jobs did not run")
+		}
+	}
+	if maxRunning != 1 {
+		t.Errorf("expected at most 1 concurrent job in class, got %d", maxRunning)
+	}
+}
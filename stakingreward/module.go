@@ -0,0 +1,54 @@
+package stakingreward
+
+import (
+	"context"
+
+	"github.com/decred/dcrdata/exchanges/v2"
+	"github.com/decred/slog"
+	"github.com/planetdecred/pdanalytics/dcrd"
+	"github.com/planetdecred/pdanalytics/module"
+	"github.com/planetdecred/pdanalytics/web"
+)
+
+// StakingRewardOptions are the config options of the staking reward
+// calculator module.
+type StakingRewardOptions struct {
+	EnableStakingRewardCalculator bool `long:"staking-reward" description:"Enable/Disables the staking reward calculator component."`
+}
+
+type stakingRewardModule struct {
+	options StakingRewardOptions
+	client  *dcrd.Dcrd
+	server  *web.Server
+	xcBot   *exchanges.ExchangeBot
+}
+
+func init() {
+	module.Register(&stakingRewardModule{
+		options: StakingRewardOptions{
+			EnableStakingRewardCalculator: true,
+		},
+	})
+}
+
+func (m *stakingRewardModule) Name() string                 { return "stakingreward" }
+func (m *stakingRewardModule) LogSubsystem() string         { return "STCK" }
+func (m *stakingRewardModule) UseLogger(logger slog.Logger) { UseLogger(logger) }
+func (m *stakingRewardModule) Options() interface{}         { return &m.options }
+func (m *stakingRewardModule) Enabled() bool                { return m.options.EnableStakingRewardCalculator }
+
+func (m *stakingRewardModule) Init(deps *module.Deps) error {
+	m.client = deps.Dcrd
+	m.server = deps.Server
+	m.xcBot = deps.XcBot
+	return nil
+}
+
+func (m *stakingRewardModule) Start(ctx context.Context) error {
+	_, err := New(m.client, m.server, m.xcBot)
+	return err
+}
+
+func (m *stakingRewardModule) Stop() error { return nil }
+
+func (m *stakingRewardModule) Health() module.Health { return module.Healthy }
@@ -25,12 +25,12 @@ func New(client *dcrd.Dcrd, webServer *web.Server, xcBot *exchanges.ExchangeBot)
 
 	calc.MeanVotingBlocks = CalcMeanVotingBlocks(client.Params)
 
-	hash, err := client.Rpc.GetBestBlockHash()
+	hash, err := client.Rpc().GetBestBlockHash()
 	if err != nil {
 		return nil, err
 	}
 
-	blockHeader, err := client.Rpc.GetBlockHeader(hash)
+	blockHeader, err := client.Rpc().GetBlockHeader(hash)
 	if err != nil {
 		return nil, err
 	}
@@ -40,6 +40,7 @@ func New(client *dcrd.Dcrd, webServer *web.Server, xcBot *exchanges.ExchangeBot)
 	}
 
 	calc.client.Notif.RegisterBlockHandlerGroup(calc.ConnectBlock)
+	calc.client.Notif.RegisterReorgHandlerGroup(calc.Reorg)
 
 	calc.webServer.AddMenuItem(web.MenuItem{
 		Href:      "/stakingcalc",
@@ -70,13 +71,13 @@ func (calc *Calculator) ConnectBlock(w *wire.BlockHeader) error {
 	calc.Height = w.Height
 
 	// Stake difficulty (ticket price)
-	stakeDiff, err := calc.client.Rpc.GetStakeDifficulty()
+	stakeDiff, err := calc.client.Rpc().GetStakeDifficulty()
 	if err != nil {
 		return err
 	}
 	calc.TicketPrice = stakeDiff.CurrentStakeDifficulty
 
-	nbSubsidy, err := calc.client.Rpc.GetBlockSubsidy(int64(w.Height)+1, 5)
+	nbSubsidy, err := calc.client.Rpc().GetBlockSubsidy(int64(w.Height)+1, 5)
 	if err != nil {
 		log.Errorf("GetBlockSubsidy for %d failed: %v", w.Height, err)
 	}
@@ -96,14 +97,14 @@ func (calc *Calculator) ConnectBlock(w *wire.BlockHeader) error {
 		calc.client.Params.TargetTimePerBlock.Hours() / 24
 
 	// Coin supply
-	coinSupply, err := calc.client.Rpc.GetCoinSupply()
+	coinSupply, err := calc.client.Rpc().GetCoinSupply()
 	if err != nil {
 		return err
 	}
 	calc.coinSupply = coinSupply.ToCoin()
 
 	// Ticket pool info
-	poolValue, err := calc.client.Rpc.GetTicketPoolValue()
+	poolValue, err := calc.client.Rpc().GetTicketPoolValue()
 	if err != nil {
 		return err
 	}
@@ -112,6 +113,17 @@ func (calc *Calculator) ConnectBlock(w *wire.BlockHeader) error {
 	return nil
 }
 
+// Reorg satisfies reorg notifier interface. It recomputes the staking data at
+// the common ancestor, the blocks of the new chain are then connected by
+// ConnectBlock.
+func (calc *Calculator) Reorg(reorg *dcrd.ReorgData) error {
+	blockHeader, err := calc.client.Rpc().GetBlockHeader(&reorg.CommonAncestor)
+	if err != nil {
+		return err
+	}
+	return calc.ConnectBlock(blockHeader)
+}
+
 // CalcMeanVotingBlocks computes the average number of blocks a ticket will be
 // live before voting. The expected block (aka mean) of the probability
 // distribution is given by:
@@ -144,7 +156,7 @@ func (calc *Calculator) simulateStakingReward(numberOfDays float64, startingDCRB
 	StakeRewardAtBlock := func(blocknum float64) float64 {
 		// Option 1:  RPC Call
 
-		Subsidy, _ := calc.client.Rpc.GetBlockSubsidy(int64(blocknum), 1)
+		Subsidy, _ := calc.client.Rpc().GetBlockSubsidy(int64(blocknum), 1)
 		return dcrutil.Amount(Subsidy.PoS).ToCoin()
 
 		// Option 2:  Calculation
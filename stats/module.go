@@ -0,0 +1,57 @@
+package stats
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/decred/slog"
+	"github.com/planetdecred/pdanalytics/module"
+	"github.com/planetdecred/pdanalytics/web"
+)
+
+// StatsOptions are the config options of the stats module.
+type StatsOptions struct {
+	EnableStats bool `long:"stats" description:"Enable/Disable Stats endpoint from running"`
+}
+
+type statsModule struct {
+	options StatsOptions
+	server  *web.Server
+	db      store
+}
+
+func init() {
+	module.Register(&statsModule{
+		options: StatsOptions{
+			EnableStats: true,
+		},
+	})
+}
+
+func (m *statsModule) Name() string                 { return "stats" }
+func (m *statsModule) LogSubsystem() string         { return "STAT" }
+func (m *statsModule) UseLogger(logger slog.Logger) { UseLogger(logger) }
+func (m *statsModule) Options() interface{}         { return &m.options }
+func (m *statsModule) Enabled() bool                { return m.options.EnableStats }
+
+func (m *statsModule) Init(deps *module.Deps) error {
+	db, err := deps.DB()
+	if err != nil {
+		return err
+	}
+	st, ok := db.(store)
+	if !ok {
+		return fmt.Errorf("%T is not a stats store", db)
+	}
+	m.server = deps.Server
+	m.db = st
+	return nil
+}
+
+func (m *statsModule) Start(ctx context.Context) error {
+	return Activate(m.server, m.db)
+}
+
+func (m *statsModule) Stop() error { return nil }
+
+func (m *statsModule) Health() module.Health { return module.Healthy }
@@ -4,7 +4,9 @@ import (
 	"context"
 	"io"
 	"net/http"
+	"time"
 
+	"github.com/dustin/go-humanize"
 	"github.com/planetdecred/pdanalytics/web"
 )
 
@@ -14,12 +16,82 @@ type stat struct {
 }
 
 type store interface {
-	MempoolCount(ctx context.Context) (int64, error)
-	BlockCount(ctx context.Context) (int64, error)
-	VotesCount(ctx context.Context) (int64, error)
-	PowCount(ctx context.Context) (int64, error)
-	VspTickCount(ctx context.Context) (int64, error)
-	ExchangeTickCount(ctx context.Context) (int64, error)
+	// StorageModules returns the modules that own tables, in table creation
+	// order.
+	StorageModules() []string
+	// ModuleStorageStats returns the statistics of the existing tables of
+	// the module.
+	ModuleStorageStats(ctx context.Context, module string) ([]TableStats, error)
+}
+
+// TableStats are the storage statistics of a table.
+type TableStats struct {
+	Name string `json:"name"`
+	Rows int64  `json:"rows"`
+	// Size is the size on disk in bytes, indexes included.
+	Size int64 `json:"size"`
+	// Oldest and Newest are the times of the first and last rows, for the
+	// tables with a time column and rows.
+	Oldest *time.Time `json:"oldest,omitempty"`
+	Newest *time.Time `json:"newest,omitempty"`
+	// RowsPerDay and BytesPerDay are the average growth of the table between
+	// its oldest and newest rows.
+	RowsPerDay  float64 `json:"rows_per_day"`
+	BytesPerDay float64 `json:"bytes_per_day"`
+}
+
+// ModuleStats are the storage statistics of the tables of a module. Error is
+// set instead of the tables when they could not be read.
+type ModuleStats struct {
+	Name   string       `json:"name"`
+	Tables []TableStats `json:"tables"`
+	Rows   int64        `json:"rows"`
+	Size   int64        `json:"size"`
+	Error  string       `json:"error,omitempty"`
+}
+
+// HumanSize returns the size of the table with a unit.
+func (t TableStats) HumanSize() string { return humanize.Bytes(uint64(t.Size)) }
+
+// HumanSize returns the size of the tables of the module with a unit.
+func (m ModuleStats) HumanSize() string { return humanize.Bytes(uint64(m.Size)) }
+
+// setGrowth sets the growth per day of the table from its time range.
+func (t *TableStats) setGrowth() {
+	if t.Oldest == nil || t.Newest == nil {
+		return
+	}
+	days := t.Newest.Sub(*t.Oldest).Hours() / 24
+	if days <= 0 {
+		return
+	}
+	t.RowsPerDay = float64(t.Rows) / days
+	t.BytesPerDay = float64(t.Size) / days
+}
+
+// storageStats returns the statistics of the tables of every module. The
+// modules whose tables cannot be read get an error and do not fail the
+// others.
+func storageStats(ctx context.Context, db store) []ModuleStats {
+	var result []ModuleStats
+	for _, name := range db.StorageModules() {
+		module := ModuleStats{Name: name}
+		tables, err := db.ModuleStorageStats(ctx, name)
+		if err != nil {
+			log.Errorf("Cannot read the storage stats of the %s module: %v", name, err)
+			module.Error = err.Error()
+			result = append(result, module)
+			continue
+		}
+		for i := range tables {
+			tables[i].setGrowth()
+			module.Rows += tables[i].Rows
+			module.Size += tables[i].Size
+		}
+		module.Tables = tables
+		result = append(result, module)
+	}
+	return result
 }
 
 func Activate(server *web.Server, db store) error {
@@ -33,6 +105,7 @@ func Activate(server *web.Server, db store) error {
 	}
 
 	st.server.AddRoute("/stats", web.GET, st.statsPage)
+	st.server.AddRoute("/api/stats", web.GET, st.statsAPI)
 
 	st.server.AddMenuItem(web.MenuItem{
 		Href:      "/stats",
@@ -48,66 +121,13 @@ func Activate(server *web.Server, db store) error {
 }
 
 func (s stat) statsPage(w http.ResponseWriter, r *http.Request) {
-	mempoolCount, err := s.db.MempoolCount(r.Context())
-	if err != nil {
-		log.Errorf("Template execute failure: %v", err)
-		s.server.StatusPage(w, r, web.DefaultErrorCode, web.DefaultErrorMessage, "", web.ExpStatusError)
-		return
-	}
-
-	blocksCount, err := s.db.BlockCount(r.Context())
-	if err != nil {
-		log.Errorf("Template execute failure: %v", err)
-		s.server.StatusPage(w, r, web.DefaultErrorCode, web.DefaultErrorMessage, "", web.ExpStatusError)
-
-		return
-	}
-
-	votesCount, err := s.db.VotesCount(r.Context())
-	if err != nil {
-		log.Errorf("Template execute failure: %v", err)
-		s.server.StatusPage(w, r, web.DefaultErrorCode, web.DefaultErrorMessage, "", web.ExpStatusError)
-
-		return
-	}
-
-	powCount, err := s.db.PowCount(r.Context())
-	if err != nil {
-		log.Errorf("Template execute failure: %v", err)
-		s.server.StatusPage(w, r, web.DefaultErrorCode, web.DefaultErrorMessage, "", web.ExpStatusError)
-		return
-	}
-
-	vspCount, err := s.db.VspTickCount(r.Context())
-	if err != nil {
-		log.Errorf("Template execute failure: %v", err)
-		s.server.StatusPage(w, r, web.DefaultErrorCode, web.DefaultErrorMessage, "", web.ExpStatusError)
-		return
-	}
-
-	exchangeCount, err := s.db.ExchangeTickCount(r.Context())
-	if err != nil {
-		log.Errorf("Template execute failure: %v", err)
-		s.server.StatusPage(w, r, web.DefaultErrorCode, web.DefaultErrorMessage, "", web.ExpStatusError)
-		return
-	}
-
-	data := map[string]interface{}{
-		"mempoolCount": mempoolCount,
-		"blocksCount":  blocksCount,
-		"votesCount":   votesCount,
-		"powCount":     powCount,
-		"vspCount":     vspCount,
-		"exchangeTick": exchangeCount,
-	}
-
 	str, err := s.server.Templates.ExecTemplateToString("stats", struct {
 		*web.CommonPageData
-		Data            map[string]interface{}
+		Modules         []ModuleStats
 		BreadcrumbItems []web.BreadcrumbItem
 	}{
 		CommonPageData: s.server.CommonData(r),
-		Data:           data,
+		Modules:        storageStats(r.Context(), s.db),
 		BreadcrumbItems: []web.BreadcrumbItem{
 			{
 				HyperText: "DB stats about pdanalytics",
@@ -128,3 +148,8 @@ func (s stat) statsPage(w http.ResponseWriter, r *http.Request) {
 		log.Error(err)
 	}
 }
+
+// statsAPI serves the storage statistics of the modules as JSON.
+func (s stat) statsAPI(w http.ResponseWriter, r *http.Request) {
+	web.RenderJSON(w, storageStats(r.Context(), s.db))
+}
@@ -0,0 +1,63 @@
+package stats
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+type fakeStore struct {
+	modules map[string][]TableStats
+	errors  map[string]error
+}
+
+func (s fakeStore) StorageModules() []string { return []string{"mempool", "propagation", "pow"} }
+
+func (s fakeStore) ModuleStorageStats(ctx context.Context, module string) ([]TableStats, error) {
+	return s.modules[module], s.errors[module]
+}
+
+func TestStorageStats(t *testing.T) {
+	oldest := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	newest := oldest.Add(48 * time.Hour)
+	db := fakeStore{
+		modules: map[string][]TableStats{
+			"mempool": {
+				{Name: "mempool", Rows: 100, Size: 4000, Oldest: &oldest, Newest: &newest},
+				{Name: "mempool_bin", Rows: 10, Size: 1000},
+			},
+			"pow": {
+				{Name: "pow_data", Rows: 1, Size: 100, Oldest: &oldest, Newest: &oldest},
+			},
+		},
+		errors: map[string]error{"propagation": errors.New("relation \"block\" does not exist")},
+	}
+
+	modules := storageStats(context.Background(), db)
+	if len(modules) != 3 {
+		t.Fatalf("got %d modules, want 3", len(modules))
+	}
+
+	mempool := modules[0]
+	if mempool.Name != "mempool" || mempool.Error != "" || mempool.Rows != 110 || mempool.Size != 5000 {
+		t.Errorf("wrong mempool stats %+v", mempool)
+	}
+	if table := mempool.Tables[0]; table.RowsPerDay != 50 || table.BytesPerDay != 2000 {
+		t.Errorf("got a growth of %v rows and %v bytes per day, want 50 and 2000", table.RowsPerDay,
+			table.BytesPerDay)
+	}
+	if table := mempool.Tables[1]; table.RowsPerDay != 0 {
+		t.Errorf("got a growth of %v rows per day for a table without time range", table.RowsPerDay)
+	}
+
+	propagation := modules[1]
+	if propagation.Error == "" || propagation.Tables != nil {
+		t.Errorf("the error of the propagation module was not reported: %+v", propagation)
+	}
+
+	pow := modules[2]
+	if pow.Error != "" || pow.Rows != 1 || pow.Tables[0].RowsPerDay != 0 {
+		t.Errorf("wrong pow stats %+v", pow)
+	}
+}
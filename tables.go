@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/planetdecred/pdanalytics/boltdb"
+	"github.com/planetdecred/pdanalytics/postgres"
+)
+
+// resetTables drops and recreates the tables of the modules listed in
+// cfg.Reset, or of all the modules when it is "all", after the user confirms.
+func resetTables(ctx context.Context, cfg *config) error {
+	var modules []string
+	if cfg.Reset != "all" {
+		modules = splitModules(cfg.Reset)
+	}
+	if cfg.DBBackend == "embedded" {
+		return resetEmbeddedTables(ctx, cfg, modules)
+	}
+	tables, err := postgres.ModuleTables(modules...)
+	if err != nil {
+		return err
+	}
+
+	if !cfg.Yes {
+		confirmed, err := confirmReset(cfg.DBName, tables)
+		if err != nil {
+			return err
+		}
+		if !confirmed {
+			log.Info("Reset canceled")
+			return nil
+		}
+	}
+
+	db, err := postgres.NewPgDb(cfg.dbConnOptions(), cfg.DebugLevel == "debug")
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	if err = db.DropModuleTables(modules...); err != nil {
+		return fmt.Errorf("failed to drop the tables: %v", err)
+	}
+	if err = setupTables(ctx, db); err != nil {
+		return fmt.Errorf("failed to recreate the tables: %v", err)
+	}
+	log.Infof("Reset %d tables", len(tables))
+	return nil
+}
+
+// resetEmbeddedTables drops and recreates the tables of the modules in the
+// embedded database, after the user confirms.
+func resetEmbeddedTables(ctx context.Context, cfg *config, modules []string) error {
+	tables, err := boltdb.ModuleTables(modules...)
+	if err != nil {
+		return err
+	}
+
+	if !cfg.Yes {
+		confirmed, err := confirmReset(embeddedDbFilename, tables)
+		if err != nil {
+			return err
+		}
+		if !confirmed {
+			log.Info("Reset canceled")
+			return nil
+		}
+	}
+
+	db, err := boltdb.NewBoltDb(filepath.Join(cfg.DataDir, embeddedDbFilename))
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	if err = db.DropModuleTables(modules...); err != nil {
+		return fmt.Errorf("failed to drop the tables: %v", err)
+	}
+	if err = db.CreateTables(ctx); err != nil {
+		return fmt.Errorf("failed to recreate the tables: %v", err)
+	}
+	log.Infof("Reset %d tables", len(tables))
+	return nil
+}
+
+// confirmReset asks the user to confirm the loss of the data of the tables.
+func confirmReset(dbName string, tables []string) (bool, error) {
+	return confirm(fmt.Sprintf("The following tables of the %s database will be dropped "+
+		"and all their data lost:\n  %s\nType \"yes\" to continue: ", dbName, strings.Join(tables, ", ")))
+}
+
+// confirm prints prompt and reads the answer of the user from stdin.
+func confirm(prompt string) (bool, error) {
+	fmt.Print(prompt)
+	answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil {
+		return false, fmt.Errorf("no confirmation read, use --yes to reset without one: %v", err)
+	}
+	return strings.TrimSpace(strings.ToLower(answer)) == "yes", nil
+}
+
+// migrateTables creates the missing tables and applies the pending schema
+// migrations. The embedded database only gets its missing tables.
+func migrateTables(ctx context.Context, cfg *config) error {
+	if cfg.DBBackend == "embedded" {
+		// The embedded tables have no schema to migrate.
+		db, err := openEmbeddedDb(ctx, cfg)
+		if err != nil {
+			return err
+		}
+		defer db.Close()
+		log.Info("The embedded database tables are created")
+		return nil
+	}
+	db, err := postgres.NewPgDb(cfg.dbConnOptions(), cfg.DebugLevel == "debug")
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	if err = setupTables(ctx, db); err != nil {
+		return err
+	}
+	log.Info("The database schema is up to date")
+	return nil
+}
+
+// setupTables refuses a database with a schema newer than the one of this
+// release, then creates the missing tables and migrates them.
+func setupTables(ctx context.Context, db *postgres.PgDb) error {
+	if err := db.CheckSchema(ctx); err != nil {
+		return err
+	}
+	if err := db.CreateTables(ctx); err != nil {
+		log.Error("Error creating tables: ", err)
+		return err
+	}
+	if err := db.Migrate(ctx); err != nil {
+		log.Error("Error migrating tables: ", err)
+		return err
+	}
+	return nil
+}
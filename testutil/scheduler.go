@@ -0,0 +1,45 @@
+package testutil
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/planetdecred/pdanalytics/scheduler"
+)
+
+// NewScheduler returns a scheduler whose jobs are stopped when the test ends.
+// Call it after MockAPIs, so the jobs are stopped before the transport is
+// restored.
+func NewScheduler(t testing.TB) *scheduler.Scheduler {
+	ctx, cancel := context.WithCancel(context.Background())
+	sched := scheduler.New(ctx)
+	t.Cleanup(func() {
+		cancel()
+		sched.Wait()
+	})
+	return sched
+}
+
+// WaitForJob waits for the named job of the scheduler to complete a run and
+// fails the test if it does not within timeout or if the run failed.
+func WaitForJob(t testing.TB, sched *scheduler.Scheduler, name string, timeout time.Duration) {
+	t.Helper()
+	deadline := time.Now().Add(timeout)
+	for {
+		status, found := sched.JobStatus(name)
+		if !found {
+			t.Fatalf("no %s job", name)
+		}
+		if status.Runs > 0 {
+			if status.Failures > 0 {
+				t.Fatalf("%s job failed: %s", name, status.LastError)
+			}
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%s job did not run within %s", name, timeout)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
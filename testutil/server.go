@@ -0,0 +1,80 @@
+// Package testutil is a harness for the module tests. It serves the module
+// routes, without listening on a port unless a test needs a connection,
+// answers the requests of the collectors with canned responses and waits on
+// the scheduled jobs.
+package testutil
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"testing"
+
+	"github.com/decred/dcrd/chaincfg/v2"
+	"github.com/go-chi/chi"
+	"github.com/planetdecred/pdanalytics/web"
+)
+
+// Server is a web.Server reading the templates of the repository views folder.
+// The modules add their routes to it as they do to the app server.
+type Server struct {
+	*web.Server
+	t    testing.TB
+	mux  *chi.Mux
+	once sync.Once
+}
+
+// NewServer returns a Server for the mainnet parameters.
+func NewServer(t testing.TB) *Server {
+	t.Helper()
+	_, file, _, ok := runtime.Caller(0)
+	if !ok {
+		t.Fatal("cannot locate the repository root")
+	}
+	root := filepath.Dir(filepath.Dir(file))
+
+	mux := chi.NewRouter()
+	server, err := web.NewServer(web.Config{
+		Viewsfolder:  filepath.Join(root, "views"),
+		AssetsFolder: filepath.Join(root, "web", "public"),
+	}, mux, chaincfg.MainNetParams())
+	if err != nil {
+		t.Fatalf("cannot create the web server: %v", err)
+	}
+	return &Server{Server: server, t: t, mux: mux}
+}
+
+// Get serves a GET request for path. The routes are mounted on the first
+// request, so every route must be added before it.
+func (s *Server) Get(path string) *httptest.ResponseRecorder {
+	s.once.Do(s.BuildRoute)
+	rec := httptest.NewRecorder()
+	s.mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+	return rec
+}
+
+// GetJSON serves a GET request for path and decodes the response into v. It
+// fails the test unless the response is a 200 with a JSON body.
+func (s *Server) GetJSON(path string, v interface{}) {
+	s.t.Helper()
+	rec := s.Get(path)
+	if rec.Code != http.StatusOK {
+		s.t.Fatalf("GET %s: status %d: %s", path, rec.Code, rec.Body.String())
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), v); err != nil {
+		s.t.Fatalf("GET %s: cannot decode %q: %v", path, rec.Body.String(), err)
+	}
+}
+
+// URL serves the routes on a local listener, closed when the test ends, and
+// returns its base URL. It is for the clients that hold the connection, e.g.
+// the WebSocket ones, which Get cannot serve. Like Get, it mounts the routes.
+func (s *Server) URL() string {
+	s.once.Do(s.BuildRoute)
+	ts := httptest.NewServer(s.mux)
+	s.t.Cleanup(ts.Close)
+	return ts.URL
+}
@@ -0,0 +1,46 @@
+package testutil
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// MockAPIs answers the requests made through http.DefaultTransport, which the
+// http clients of the collectors use, with the handler of the request host. A
+// request to any other host fails the test. The transport is restored when
+// the test ends, so the tests calling MockAPIs must not run in parallel.
+func MockAPIs(t testing.TB, apis map[string]http.Handler) {
+	t.Helper()
+	transport := http.DefaultTransport
+	http.DefaultTransport = roundTripper(func(req *http.Request) (*http.Response, error) {
+		handler, found := apis[req.URL.Host]
+		if !found {
+			t.Errorf("unexpected request to %s", req.URL)
+			return nil, fmt.Errorf("no mock api for %s", req.URL.Host)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		resp := rec.Result()
+		resp.Request = req
+		return resp, nil
+	})
+	t.Cleanup(func() {
+		http.DefaultTransport = transport
+	})
+}
+
+type roundTripper func(*http.Request) (*http.Response, error)
+
+func (f roundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// JSON returns a handler answering every request with body as JSON.
+func JSON(body string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(body))
+	})
+}
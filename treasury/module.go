@@ -0,0 +1,51 @@
+package treasury
+
+import (
+	"context"
+
+	"github.com/decred/dcrdata/exchanges/v2"
+	"github.com/decred/slog"
+	"github.com/planetdecred/pdanalytics/module"
+	"github.com/planetdecred/pdanalytics/web"
+)
+
+// TreasuryOptions are the config options of the treasury chart module.
+type TreasuryOptions struct {
+	EnableTreasuryChart bool `long:"treasury-chart" description:"Enable/Disable treasury chart module"`
+}
+
+type treasuryModule struct {
+	options TreasuryOptions
+	server  *web.Server
+	xcBot   *exchanges.ExchangeBot
+	apiURL  string
+}
+
+func init() {
+	module.Register(&treasuryModule{
+		options: TreasuryOptions{
+			EnableTreasuryChart: true,
+		},
+	})
+}
+
+func (m *treasuryModule) Name() string                 { return "treasury" }
+func (m *treasuryModule) LogSubsystem() string         { return "TRS" }
+func (m *treasuryModule) UseLogger(logger slog.Logger) { UseLogger(logger) }
+func (m *treasuryModule) Options() interface{}         { return &m.options }
+func (m *treasuryModule) Enabled() bool                { return m.options.EnableTreasuryChart }
+
+func (m *treasuryModule) Init(deps *module.Deps) error {
+	m.server = deps.Server
+	m.xcBot = deps.XcBot
+	m.apiURL = deps.APIURL
+	return nil
+}
+
+func (m *treasuryModule) Start(ctx context.Context) error {
+	return Activate(m.server, m.xcBot, m.apiURL)
+}
+
+func (m *treasuryModule) Stop() error { return nil }
+
+func (m *treasuryModule) Health() module.Health { return module.Healthy }
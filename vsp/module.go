@@ -0,0 +1,69 @@
+package vsp
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/decred/slog"
+	"github.com/planetdecred/pdanalytics/module"
+	"github.com/planetdecred/pdanalytics/scheduler"
+	"github.com/planetdecred/pdanalytics/web"
+)
+
+const defaultVSPInterval = 300
+
+// VSPOptions are the config options of the VSP module.
+type VSPOptions struct {
+	EnableVSP     bool  `long:"vsp" description:"Enable/Disable VSP module from running"`
+	EnableVSPHttp bool  `long:"vsphttp" description:"Enable/Disable VSP http endpoint from running"`
+	VSPInterval   int64 `long:"vspinterval" description:"Collection interval for pool status collection"`
+}
+
+type vspModule struct {
+	options VSPOptions
+	server  *web.Server
+	sched   *scheduler.Scheduler
+	store   DataStore
+}
+
+func init() {
+	module.Register(&vspModule{
+		options: VSPOptions{
+			EnableVSP:     true,
+			EnableVSPHttp: true,
+			VSPInterval:   defaultVSPInterval,
+		},
+	})
+}
+
+func (m *vspModule) Name() string                 { return "vsp" }
+func (m *vspModule) LogSubsystem() string         { return "VSPL" }
+func (m *vspModule) UseLogger(logger slog.Logger) { UseLogger(logger) }
+func (m *vspModule) Options() interface{}         { return &m.options }
+func (m *vspModule) Enabled() bool                { return m.options.EnableVSP || m.options.EnableVSPHttp }
+
+func (m *vspModule) Init(deps *module.Deps) error {
+	db, err := deps.DB()
+	if err != nil {
+		return err
+	}
+	store, ok := db.(DataStore)
+	if !ok {
+		return fmt.Errorf("%T is not a vsp.DataStore", db)
+	}
+	m.server = deps.Server
+	m.sched = deps.Scheduler
+	m.store = store
+	return nil
+}
+
+func (m *vspModule) Start(ctx context.Context) error {
+	opts := m.options
+	return Activate(ctx, opts.VSPInterval, m.store, m.server, m.sched, opts.EnableVSP, opts.EnableVSPHttp)
+}
+
+func (m *vspModule) Stop() error { return nil }
+
+func (m *vspModule) Health() module.Health {
+	return module.JobsHealth(m.sched, "vsp")
+}
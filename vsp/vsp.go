@@ -11,8 +11,7 @@ import (
 	"net/http"
 	"time"
 
-	"github.com/planetdecred/pdanalytics/app"
-	"github.com/planetdecred/pdanalytics/app/helpers"
+	"github.com/planetdecred/pdanalytics/scheduler"
 	"github.com/planetdecred/pdanalytics/web"
 )
 
@@ -21,7 +20,8 @@ const (
 	retryLimit = 3
 )
 
-func Activate(ctx context.Context, period int64, store DataStore, server *web.Server, dataMode, httpMode bool) error {
+func Activate(ctx context.Context, period int64, store DataStore, server *web.Server, sched *scheduler.Scheduler,
+	dataMode, httpMode bool) error {
 	request, err := http.NewRequest(http.MethodGet, requestURL, nil)
 	if err != nil {
 		return err
@@ -36,9 +36,18 @@ func Activate(ctx context.Context, period int64, store DataStore, server *web.Se
 	}
 
 	if dataMode {
-		go func() {
-			c.Run(ctx)
-		}()
+		err = sched.Register(scheduler.Job{
+			Name:     "vsp",
+			Interval: c.period * time.Second,
+			Timeout:  c.period * time.Second,
+			LastRun: func(ctx context.Context) (time.Time, error) {
+				return c.dataStore.LastVspTickEntryTime(), nil
+			},
+			Run: c.collectAndStore,
+		})
+		if err != nil {
+			return err
+		}
 	}
 
 	if httpMode {
@@ -68,57 +77,6 @@ func (vsp *Collector) fetch(ctx context.Context, response interface{}) error {
 	return nil
 }
 
-func (vsp *Collector) Run(ctx context.Context) {
-	if ctx.Err() != nil {
-		return
-	}
-
-	lastCollectionDate := vsp.dataStore.LastVspTickEntryTime()
-	secondsPassed := time.Since(lastCollectionDate)
-	period := vsp.period * time.Second
-
-	log.Info("Starting VSP collection cycle.")
-
-	if secondsPassed < period {
-		timeLeft := period - secondsPassed
-		log.Infof("Fetching VSPs every %dm, collected %s ago, will fetch in %s.", vsp.period/60, helpers.DurationToString(secondsPassed),
-			helpers.DurationToString(timeLeft))
-
-		time.Sleep(timeLeft)
-	}
-
-	// continually check the state of the app until its free to run this module
-	app.MarkBusyIfFree()
-
-	err := vsp.collectAndStore(ctx)
-	app.ReleaseForNewModule()
-	if err != nil {
-		log.Errorf("Could not start collection: %s", err.Error())
-		return
-	}
-
-	go func() {
-		ticker := time.NewTicker(vsp.period * time.Second)
-		defer ticker.Stop()
-
-		for {
-			select {
-			case <-ctx.Done():
-				log.Infof("Shutting down VSP collector")
-				return
-			case <-ticker.C:
-				// continually check the state of the app until its free to run this module
-				app.MarkBusyIfFree()
-				err := vsp.collectAndStore(ctx)
-				app.ReleaseForNewModule()
-				if err != nil {
-					return
-				}
-			}
-		}
-	}()
-}
-
 func (vsp *Collector) collectAndStore(ctx context.Context) error {
 	if ctx.Err() != nil {
 		return ctx.Err()
@@ -0,0 +1,51 @@
+package vsp_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/planetdecred/pdanalytics/memdb"
+	"github.com/planetdecred/pdanalytics/testutil"
+	"github.com/planetdecred/pdanalytics/vsp"
+)
+
+const vspResponse = `{
+	"Alpha": {"APIEnabled":true,"Network":"mainnet","URL":"https://alpha.example.org","Launched":1500000000,
+		"LastUpdated":1600000000,"Immature":12,"Live":340,"Voted":5000,"Missed":20,"PoolFees":1,
+		"ProportionLive":0.008,"ProportionMissed":0.004,"UserCount":90,"UserCountActive":40},
+	"Bravo": {"APIEnabled":true,"Network":"mainnet","URL":"https://bravo.example.org","Launched":1510000000,
+		"LastUpdated":1600000100,"Immature":3,"Live":120,"Voted":1800,"Missed":2,"PoolFees":2,
+		"ProportionLive":0.003,"ProportionMissed":0.001,"UserCount":30,"UserCountActive":12}
+}`
+
+func TestCollect(t *testing.T) {
+	testutil.MockAPIs(t, map[string]http.Handler{
+		"api.decred.org": testutil.JSON(vspResponse),
+	})
+	sched := testutil.NewScheduler(t)
+	server := testutil.NewServer(t)
+	db := memdb.New()
+
+	if err := vsp.Activate(context.Background(), 300, db, server.Server, sched, true, true); err != nil {
+		t.Fatal(err)
+	}
+	testutil.WaitForJob(t, sched, "vsp", 5*time.Second)
+
+	var data struct {
+		VspData []vsp.VSPTickDto `json:"vspData"`
+	}
+	server.GetJSON("/vsps?view-option=table", &data)
+	if len(data.VspData) != 2 {
+		t.Fatalf("got %d ticks, want 2", len(data.VspData))
+	}
+
+	server.GetJSON("/vsps?view-option=table&filter=Bravo", &data)
+	if len(data.VspData) != 1 {
+		t.Fatalf("got %d Bravo ticks, want 1", len(data.VspData))
+	}
+	if tick := data.VspData[0]; tick.VSP != "Bravo" || tick.Live != 120 || tick.UserCount != 30 {
+		t.Errorf("unexpected tick %+v", tick)
+	}
+}
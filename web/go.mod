@@ -11,4 +11,5 @@ require (
 	github.com/decred/slog v1.1.0
 	github.com/dustin/go-humanize v1.0.0
 	github.com/go-chi/chi v4.1.2+incompatible
+	github.com/gorilla/websocket v1.4.2
 )
@@ -0,0 +1,80 @@
+import { Controller } from 'stimulus'
+import { getDefault } from '../helpers/module_helper'
+import { multiColumnBarPlotter } from '../helpers/chart_helper'
+import { requestJSON } from '../helpers/http'
+
+const common = {
+  labelsKMB: true,
+  legend: 'always',
+  strokeWidth: 2,
+  gridLineColor: '#C4CBD2',
+  labelsUTC: true
+}
+
+const cumulativeConfig = {
+  ...common,
+  fillGraph: true,
+  labels: ['Date', 'Yes', 'Abstain', 'No'],
+  ylabel: 'Cumulative Vote Choices',
+  colors: ['#2DD8A3', '#94B6FF', '#ED6D47']
+}
+
+const byBlockConfig = {
+  ...common,
+  plotter: multiColumnBarPlotter,
+  showRangeSelector: true,
+  labels: ['Block Height', 'Yes', 'Abstain', 'No'],
+  ylabel: 'Vote Choices By Block',
+  xlabel: 'Height',
+  colors: ['#2DD8A3', '#94B6FF', '#ED6D47'],
+  fillColors: ['rgb(150,235,209)', 'rgb(201,218,255)', 'rgb(246,182,163)']
+}
+
+let gs = []
+let Dygraph
+
+export default class extends Controller {
+  static get targets () {
+    return ['cumulativeVoteChoices', 'voteChoicesByBlock']
+  }
+
+  async connect () {
+    const chartData = await requestJSON('/api/agenda/' + this.data.element.dataset.agendaId)
+
+    Dygraph = await getDefault(
+      import(/* webpackChunkName: "dygraphs" */ '../vendor/dygraphs.min.js')
+    )
+
+    this.plotGraph(chartData)
+  }
+
+  disconnect () {
+    gs.map((chart) => { chart.destroy() })
+  }
+
+  plotGraph (chartData) {
+    const byTime = chartData.by_time
+    const byHeight = chartData.by_height
+    const cumulative = []
+    let yes = 0
+    let abstain = 0
+    let no = 0
+    ;(byTime.time || []).forEach((t, i) => {
+      yes += byTime.yes[i]
+      abstain += byTime.abstain[i]
+      no += byTime.no[i]
+      cumulative.push([new Date(t * 1000), yes, abstain, no])
+    })
+    const perBlock = (byHeight.height || []).map((h, i) => {
+      return [h, byHeight.yes[i], byHeight.abstain[i], byHeight.no[i]]
+    })
+
+    gs = []
+    if (cumulative.length) {
+      gs.push(new Dygraph(this.cumulativeVoteChoicesTarget, cumulative, cumulativeConfig))
+    }
+    if (perBlock.length) {
+      gs.push(new Dygraph(this.voteChoicesByBlockTarget, perBlock, byBlockConfig))
+    }
+  }
+}
@@ -457,6 +457,7 @@ func MakeTemplateFuncMap(params *chaincfg.Params) template.FuncMap {
 			}
 			return pair
 		},
+		"toTitleCase": strings.Title,
 		"stringsReplace": func(input string, old string, new string) string {
 			return strings.Replace(input, old, new, -1)
 		},
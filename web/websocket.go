@@ -0,0 +1,305 @@
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// wsSendBuffer is the number of messages queued per client. The messages
+	// broadcast while the queue of a client is full are dropped.
+	wsSendBuffer = 256
+
+	wsWriteWait      = 10 * time.Second
+	wsPongWait       = 60 * time.Second
+	wsPingPeriod     = wsPongWait * 9 / 10
+	wsMaxMessageSize = 4096
+
+	// EventDropped is the event sent to a client, before its next message,
+	// with the number of messages dropped while its queue was full.
+	EventDropped = "dropped"
+)
+
+// WebSocketMessage is the envelope of the messages sent to the clients.
+type WebSocketMessage struct {
+	Event string      `json:"event"`
+	Data  interface{} `json:"data"`
+}
+
+// DroppedMessages is the data of the EventDropped messages.
+type DroppedMessages struct {
+	Count uint64 `json:"count"`
+}
+
+// wsSubscription is a message of a client changing its topics.
+type wsSubscription struct {
+	Subscribe   []string `json:"subscribe"`
+	Unsubscribe []string `json:"unsubscribe"`
+}
+
+// WebSocketHub pushes messages to the WebSocket clients it serves. The
+// messages have a topic, and a client receives the messages of every topic
+// until it subscribes to some, with the comma separated topics query
+// parameter or a {"subscribe":[...]} message. The messages without a topic go
+// to all clients. Broadcast never blocks, the messages for the clients that do
+// not keep up are dropped.
+type WebSocketHub struct {
+	upgrader websocket.Upgrader
+	welcome  func() (event string, data interface{})
+
+	mtx     sync.RWMutex
+	clients map[*wsClient]struct{}
+	closed  bool
+}
+
+// NewWebSocketHub creates a WebSocketHub, served by ServeHTTP. welcome, if not
+// nil, returns the first message sent to the new clients, e.g. the current
+// state that the broadcasts update. It is called with the hub locked, so that
+// the client gets every later broadcast, and must not call the hub.
+func NewWebSocketHub(welcome func() (event string, data interface{})) *WebSocketHub {
+	return &WebSocketHub{
+		upgrader: websocket.Upgrader{
+			ReadBufferSize:  1024,
+			WriteBufferSize: 1024,
+		},
+		welcome: welcome,
+		clients: make(map[*wsClient]struct{}),
+	}
+}
+
+// ServeHTTP upgrades the connection and serves the client until it
+// disconnects or the hub is closed.
+func (h *WebSocketHub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mtx.RLock()
+	closed := h.closed
+	h.mtx.RUnlock()
+	if closed {
+		http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+		return
+	}
+
+	conn, err := h.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// The upgrader replied with the error.
+		log.Debugf("WebSocket upgrade from %s failed: %v", r.RemoteAddr, err)
+		return
+	}
+
+	c := &wsClient{
+		hub:  h,
+		conn: conn,
+		send: make(chan []byte, wsSendBuffer),
+		quit: make(chan struct{}),
+	}
+	if topics := r.URL.Query().Get("topics"); topics != "" {
+		c.subscribe(strings.Split(topics, ","))
+	}
+
+	h.mtx.Lock()
+	if h.closed {
+		h.mtx.Unlock()
+		conn.Close()
+		return
+	}
+	if h.welcome != nil {
+		event, data := h.welcome()
+		if msg, err := json.Marshal(WebSocketMessage{Event: event, Data: data}); err != nil {
+			log.Errorf("Cannot encode the %s WebSocket message: %v", event, err)
+		} else {
+			c.send <- msg
+		}
+	}
+	h.clients[c] = struct{}{}
+	h.mtx.Unlock()
+
+	go c.writePump()
+	go c.readPump()
+}
+
+// Broadcast sends the event with data to the clients subscribed to topic, or
+// to all clients when topic is empty.
+func (h *WebSocketHub) Broadcast(topic, event string, data interface{}) {
+	h.mtx.RLock()
+	defer h.mtx.RUnlock()
+	if len(h.clients) == 0 {
+		return
+	}
+	msg, err := json.Marshal(WebSocketMessage{Event: event, Data: data})
+	if err != nil {
+		log.Errorf("Cannot encode the %s WebSocket message: %v", event, err)
+		return
+	}
+	for c := range h.clients {
+		if !c.subscribed(topic) {
+			continue
+		}
+		select {
+		case c.send <- msg:
+		default:
+			atomic.AddUint64(&c.dropped, 1)
+		}
+	}
+}
+
+// Clients returns the number of connected clients.
+func (h *WebSocketHub) Clients() int {
+	h.mtx.RLock()
+	defer h.mtx.RUnlock()
+	return len(h.clients)
+}
+
+// Close disconnects the clients and rejects the new ones.
+func (h *WebSocketHub) Close() {
+	h.mtx.Lock()
+	h.closed = true
+	clients := make([]*wsClient, 0, len(h.clients))
+	for c := range h.clients {
+		clients = append(clients, c)
+	}
+	h.mtx.Unlock()
+	for _, c := range clients {
+		c.close()
+	}
+}
+
+func (h *WebSocketHub) remove(c *wsClient) {
+	h.mtx.Lock()
+	delete(h.clients, c)
+	h.mtx.Unlock()
+}
+
+// wsClient is a client of a WebSocketHub. Its queued messages are written by
+// writePump and its subscriptions read by readPump.
+type wsClient struct {
+	// dropped is the number of messages dropped since the last one written,
+	// accessed atomically. It is first to be 64-bit aligned.
+	dropped uint64
+
+	hub  *WebSocketHub
+	conn *websocket.Conn
+	send chan []byte
+
+	quit      chan struct{}
+	closeOnce sync.Once
+
+	// mtx guards topics, nil until the client subscribes to a topic.
+	mtx    sync.Mutex
+	topics map[string]struct{}
+}
+
+func (c *wsClient) subscribed(topic string) bool {
+	if topic == "" {
+		return true
+	}
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	if c.topics == nil {
+		return true
+	}
+	_, found := c.topics[topic]
+	return found
+}
+
+func (c *wsClient) subscribe(topics []string) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	if c.topics == nil {
+		c.topics = make(map[string]struct{}, len(topics))
+	}
+	for _, topic := range topics {
+		if topic = strings.TrimSpace(topic); topic != "" {
+			c.topics[topic] = struct{}{}
+		}
+	}
+}
+
+// unsubscribe removes subscribed topics. The client gets only the messages
+// without a topic once it has unsubscribed from all of them.
+func (c *wsClient) unsubscribe(topics []string) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	for _, topic := range topics {
+		delete(c.topics, strings.TrimSpace(topic))
+	}
+}
+
+// close removes the client from the hub and stops writePump, which closes the
+// connection.
+func (c *wsClient) close() {
+	c.closeOnce.Do(func() {
+		c.hub.remove(c)
+		close(c.quit)
+	})
+}
+
+// readPump reads the subscription messages of the client until the
+// connection fails. The pongs extend the read deadline.
+func (c *wsClient) readPump() {
+	defer c.close()
+	c.conn.SetReadLimit(wsMaxMessageSize)
+	c.conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	c.conn.SetPongHandler(func(string) error {
+		return c.conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	})
+	for {
+		_, msg, err := c.conn.ReadMessage()
+		if err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseNormalClosure) {
+				log.Debugf("WebSocket read error: %v", err)
+			}
+			return
+		}
+		var sub wsSubscription
+		if err := json.Unmarshal(msg, &sub); err != nil {
+			log.Debugf("Invalid WebSocket message %q: %v", msg, err)
+			continue
+		}
+		if len(sub.Subscribe) > 0 {
+			c.subscribe(sub.Subscribe)
+		}
+		if len(sub.Unsubscribe) > 0 {
+			c.unsubscribe(sub.Unsubscribe)
+		}
+	}
+}
+
+// writePump writes the queued messages, preceded by the count of the dropped
+// ones, and pings the client.
+func (c *wsClient) writePump() {
+	ticker := time.NewTicker(wsPingPeriod)
+	defer func() {
+		ticker.Stop()
+		c.conn.Close()
+		c.close()
+	}()
+	for {
+		select {
+		case msg := <-c.send:
+			if n := atomic.SwapUint64(&c.dropped, 0); n > 0 {
+				c.conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+				if err := c.conn.WriteJSON(WebSocketMessage{Event: EventDropped, Data: DroppedMessages{n}}); err != nil {
+					return
+				}
+			}
+			c.conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+			if err := c.conn.WriteMessage(websocket.TextMessage, msg); err != nil {
+				return
+			}
+		case <-ticker.C:
+			c.conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		case <-c.quit:
+			c.conn.WriteControl(websocket.CloseMessage,
+				websocket.FormatCloseMessage(websocket.CloseGoingAway, ""), time.Now().Add(wsWriteWait))
+			return
+		}
+	}
+}